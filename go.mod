@@ -3,11 +3,11 @@ module github.com/butter-bot-machines/skylark
 go 1.21.5
 
 require (
+	github.com/benbjohnson/clock v1.3.5
 	github.com/fsnotify/fsnotify v1.8.0
+	github.com/yuin/goldmark v1.7.8
+	golang.org/x/text v0.16.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
-require (
-	github.com/benbjohnson/clock v1.3.5 // indirect
-	golang.org/x/sys v0.22.0 // indirect
-)
+require golang.org/x/sys v0.22.0 // indirect
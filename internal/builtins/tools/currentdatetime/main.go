@@ -26,6 +26,7 @@ func main() {
 
 	if *usage {
 		schema := map[string]interface{}{
+			"version": "1.0.0",
 			"schema": map[string]interface{}{
 				"name":        "currentdatetime",
 				"description": "Returns current date and time in RFC3339 format",
@@ -0,0 +1,289 @@
+// Package access manages the bearer tokens of the server API and the
+// scopes that limit what each may do. Only hashes of the tokens are kept.
+package access
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scope is a permission granted to a token
+type Scope string
+
+const (
+	ReadStatus     Scope = "read-status"     // Read the dashboard and the event stream
+	SubmitCommands Scope = "submit-commands" // Submit jobs and read their results
+	AdminConfig    Scope = "admin-config"    // Read the configuration, and pause, resume and reload processing
+)
+
+// Scopes lists every scope
+var Scopes = []Scope{ReadStatus, SubmitCommands, AdminConfig}
+
+// secretPrefix starts the tokens created by a store
+const secretPrefix = "skai_"
+
+var (
+	// ErrInvalidToken is returned by Verify for an unknown token
+	ErrInvalidToken = errors.New("invalid token")
+
+	// ErrTokenNotFound is returned by Revoke for an unknown name or ID
+	ErrTokenNotFound = errors.New("token not found")
+)
+
+// ParseScopes parses scope names, returning them in the order of Scopes
+func ParseScopes(names []string) ([]Scope, error) {
+	var scopes []Scope
+	for _, name := range names {
+		s := Scope(strings.TrimSpace(name))
+		if !slices.Contains(Scopes, s) {
+			return nil, fmt.Errorf("unknown scope %q (expected one of %s)", name, strings.Join(scopeNames(Scopes), ", "))
+		}
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	sort.Slice(scopes, func(i, j int) bool {
+		return slices.Index(Scopes, scopes[i]) < slices.Index(Scopes, scopes[j])
+	})
+	return scopes, nil
+}
+
+// scopeNames returns scopes as strings
+func scopeNames(scopes []Scope) []string {
+	names := make([]string, len(scopes))
+	for i, s := range scopes {
+		names[i] = string(s)
+	}
+	return names
+}
+
+// Token is an API token, identified by the hash of its secret
+type Token struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"` // Recorded as the submitter of its jobs
+	Scopes  []Scope   `json:"scopes"`
+	Hash    string    `json:"hash"` // Hex SHA-256 of the secret
+	Created time.Time `json:"created"`
+	Config  bool      `json:"-"` // Defined in config.yaml rather than created with skai token create
+}
+
+// Allows reports whether the token grants scope
+func (t Token) Allows(scope Scope) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+// ScopeList returns the scopes of the token separated by commas
+func (t Token) ScopeList() string {
+	return strings.Join(scopeNames(t.Scopes), ",")
+}
+
+// Fixed returns the token of a secret set in the configuration
+func Fixed(name, secret string, scopes []Scope) Token {
+	hash := hashSecret(secret)
+	return Token{ID: hash[:8], Name: name, Scopes: scopes, Hash: hash, Config: true}
+}
+
+// Store keeps the tokens created with skai token create in a JSON file,
+// alongside fixed tokens from the configuration. Verify reads the file
+// again when it changes, so tokens created or revoked while the server
+// runs take effect on its next request.
+type Store struct {
+	path  string
+	fixed []Token
+
+	mu      sync.Mutex
+	tokens  []Token
+	modTime time.Time // Of the file when tokens was read
+	size    int64
+}
+
+// NewStore creates a store backed by path with the fixed tokens
+func NewStore(path string, fixed []Token) *Store {
+	return &Store{path: path, fixed: fixed}
+}
+
+// Create stores a new token named name and returns it with its secret,
+// which is not kept and cannot be shown again
+func (s *Store) Create(name string, scopes []Scope) (Token, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Token{}, "", fmt.Errorf("token name required")
+	}
+	if len(scopes) == 0 {
+		return Token{}, "", fmt.Errorf("token %s needs at least one scope", name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tokens, err := s.load()
+	if err != nil {
+		return Token{}, "", err
+	}
+	for _, t := range append(tokens, s.fixed...) {
+		if t.Name == name {
+			return Token{}, "", fmt.Errorf("token %s already exists", name)
+		}
+	}
+
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return Token{}, "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	secret := secretPrefix + base64.RawURLEncoding.EncodeToString(b[:])
+	id, err := newID()
+	if err != nil {
+		return Token{}, "", err
+	}
+	t := Token{
+		ID:      id,
+		Name:    name,
+		Scopes:  scopes,
+		Hash:    hashSecret(secret),
+		Created: time.Now().UTC(),
+	}
+	if err := s.save(append(tokens, t)); err != nil {
+		return Token{}, "", err
+	}
+	return t, secret, nil
+}
+
+// Revoke deletes the token with the given name or ID
+func (s *Store) Revoke(ref string) (Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.fixed {
+		if t.Name == ref || t.ID == ref {
+			return Token{}, fmt.Errorf("token %s is set in config.yaml; remove it there", t.Name)
+		}
+	}
+	tokens, err := s.load()
+	if err != nil {
+		return Token{}, err
+	}
+	for i, t := range tokens {
+		if t.Name == ref || t.ID == ref {
+			return t, s.save(append(tokens[:i], tokens[i+1:]...))
+		}
+	}
+	return Token{}, fmt.Errorf("%w: %s", ErrTokenNotFound, ref)
+}
+
+// List returns the fixed tokens, then the stored ones, oldest first
+func (s *Store) List() ([]Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tokens, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return append(slices.Clone(s.fixed), tokens...), nil
+}
+
+// Verify returns the token whose secret is secret, or ErrInvalidToken
+func (s *Store) Verify(secret string) (Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refresh(); err != nil {
+		return Token{}, err
+	}
+	hash := []byte(hashSecret(secret))
+	var found *Token
+	for _, tokens := range [][]Token{s.fixed, s.tokens} {
+		for i := range tokens {
+			if subtle.ConstantTimeCompare([]byte(tokens[i].Hash), hash) == 1 {
+				found = &tokens[i]
+			}
+		}
+	}
+	if found == nil {
+		return Token{}, ErrInvalidToken
+	}
+	return *found, nil
+}
+
+// refresh reads the file again if it changed since it was last read.
+// Callers must hold s.mu.
+func (s *Store) refresh() error {
+	info, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.tokens, s.modTime, s.size = nil, time.Time{}, 0
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read token store: %w", err)
+	}
+	if info.ModTime().Equal(s.modTime) && info.Size() == s.size && s.tokens != nil {
+		return nil
+	}
+	tokens, err := s.load()
+	if err != nil {
+		return err
+	}
+	s.tokens, s.modTime, s.size = tokens, info.ModTime(), info.Size()
+	return nil
+}
+
+// load reads the stored tokens. Callers must hold s.mu.
+func (s *Store) load() ([]Token, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Token{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token store: %w", err)
+	}
+	tokens := []Token{}
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("failed to parse token store: %w", err)
+	}
+	return tokens, nil
+}
+
+// save writes the stored tokens, readable by the owner only. Callers must
+// hold s.mu.
+func (s *Store) save(tokens []Token) error {
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal tokens: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create token directory: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write token store: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write token store: %w", err)
+	}
+	return nil
+}
+
+// hashSecret returns the hex SHA-256 of secret
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// newID returns a short random identifier
+func newID() (string, error) {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate token id: %w", err)
+	}
+	return hex.EncodeToString(b[:]), nil
+}
@@ -0,0 +1,89 @@
+package access
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseScopes(t *testing.T) {
+	tests := []struct {
+		names   []string
+		want    string
+		wantErr bool
+	}{
+		{[]string{"admin-config", " read-status"}, "read-status,admin-config", false},
+		{[]string{"submit-commands", "submit-commands"}, "submit-commands", false},
+		{nil, "", false},
+		{[]string{"write-files"}, "", true},
+	}
+	for _, tt := range tests {
+		scopes, err := ParseScopes(tt.names)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%v: expected error %v, got %v", tt.names, tt.wantErr, err)
+			continue
+		}
+		if got := (Token{Scopes: scopes}).ScopeList(); got != tt.want {
+			t.Errorf("%v: expected %q, got %q", tt.names, tt.want, got)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	editor := Fixed("editor", "editor-0123456789abcdef", Scopes)
+	store := NewStore(path, []Token{editor})
+
+	ci, secret, err := store.Create("ci", []Scope{SubmitCommands})
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	if !strings.HasPrefix(secret, secretPrefix) || ci.ID == "" || ci.Hash == "" {
+		t.Errorf("Unexpected token %+v with secret %q", ci, secret)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), secret) {
+		t.Error("Expected the secret not to be stored")
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600, got %v", info.Mode().Perm())
+	}
+	if _, _, err := store.Create("editor", Scopes); err == nil {
+		t.Error("Expected error creating a token with a taken name")
+	}
+
+	got, err := store.Verify(secret)
+	if err != nil || got.Name != "ci" || !got.Allows(SubmitCommands) || got.Allows(AdminConfig) {
+		t.Errorf("Expected ci allowed to submit commands only, got %+v, %v", got, err)
+	}
+	if got, err := store.Verify("editor-0123456789abcdef"); err != nil || !got.Config {
+		t.Errorf("Expected the fixed editor token, got %+v, %v", got, err)
+	}
+	if _, err := store.Verify("skai_unknown"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken, got %v", err)
+	}
+
+	tokens, err := store.List()
+	if err != nil || len(tokens) != 2 || tokens[0].Name != "editor" || tokens[1].Name != "ci" {
+		t.Errorf("Expected editor and ci, got %+v, %v", tokens, err)
+	}
+
+	if _, err := store.Revoke("editor"); err == nil {
+		t.Error("Expected error revoking a token set in the configuration")
+	}
+	// Another process, such as skai token revoke, revokes the token
+	if _, err := NewStore(path, nil).Revoke(ci.ID); err != nil {
+		t.Fatalf("Failed to revoke token: %v", err)
+	}
+	if _, err := store.Verify(secret); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected the revoked token rejected, got %v", err)
+	}
+	if _, err := store.Revoke("ci"); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("Expected ErrTokenNotFound, got %v", err)
+	}
+}
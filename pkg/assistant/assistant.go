@@ -4,38 +4,81 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/knowledge"
 	"github.com/butter-bot-machines/skylark/pkg/logging"
+	"github.com/butter-bot-machines/skylark/pkg/models"
 	"github.com/butter-bot-machines/skylark/pkg/parser"
 	"github.com/butter-bot-machines/skylark/pkg/provider"
 	"github.com/butter-bot-machines/skylark/pkg/provider/registry"
 	"github.com/butter-bot-machines/skylark/pkg/sandbox"
+	"github.com/butter-bot-machines/skylark/pkg/security"
 	"github.com/butter-bot-machines/skylark/pkg/tool"
+	"github.com/butter-bot-machines/skylark/pkg/tracing"
 	"gopkg.in/yaml.v3"
 )
 
+// ErrToolNotAllowed is returned for calls of tools missing from an
+// assistant's tools
+var ErrToolNotAllowed = errors.New("tool not allowed")
+
 // toolManager defines what we need from a tool manager
 type toolManager interface {
 	LoadTool(name string) (*tool.Tool, error)
 }
 
+// Response formats an assistant can declare in its front matter
+const (
+	FormatText  = "text"  // Free text, written as returned (default)
+	FormatTable = "table" // A JSON table, written as a Markdown table
+	FormatJSON  = "json"  // JSON, written as a fenced code block
+)
+
 // Assistant represents a configured assistant
 type Assistant struct {
-	Name            string             `yaml:"name"`
-	Description     string             `yaml:"description"`
-	Model           string             `yaml:"model"`
-	Tools           []string           `yaml:"tools,omitempty"`
-	Prompt          string             `yaml:"-"` // Loaded from prompt.md content
-	toolMgr         toolManager        // Tool manager
-	providers       *registry.Registry // Provider registry
-	defaultProvider string             // Default provider name
-	sandbox         *sandbox.Sandbox   // Tool sandbox
-	logger          *slog.Logger       // Logger
+	Name            string                       `yaml:"name"`
+	Description     string                       `yaml:"description"`
+	Model           string                       `yaml:"model"`
+	Tools           []string                     `yaml:"tools,omitempty"`
+	Format          string                       `yaml:"format,omitempty"`
+	Output          string                       `yaml:"output,omitempty"` // Where responses go, a parser.Output mode (empty = inline)
+	Extends         string                       `yaml:"extends,omitempty"`
+	Developer       string                       `yaml:"developer,omitempty"`
+	Examples        []Example                    `yaml:"examples,omitempty"`
+	MaxToolRounds   int                          `yaml:"max_tool_rounds,omitempty"`   // Rounds of tool calls answered per command (0 = provider.DefaultMaxToolRounds)
+	ToolTokenBudget int                          `yaml:"tool_token_budget,omitempty"` // Tokens a command's tool calls may use (0 = unlimited)
+	MinToolVersions map[string]string            `yaml:"min_tool_versions,omitempty"` // Earliest version of each tool it works with, by tool name
+	Constraints     Constraints                  `yaml:"constraints,omitempty"`       // Rules responses must follow
+	Prompt          string                       `yaml:"-"`                           // Loaded from prompt.md content
+	toolMgr         toolManager                  // Tool manager
+	providers       *registry.Registry           // Provider registry
+	defaultProvider string                       // Default provider name
+	sandbox         *sandbox.Sandbox             // Tool sandbox
+	limiter         *toolLimiter                 // Concurrent calls per tool
+	quotas          *toolQuotas                  // Call limits per tool
+	toolEnv         map[string]map[string]string // Configured environment of each tool
+	content         security.ContentFilter       // Screens prompts and responses (optional)
+	knowledge       *knowledge.Base              // Indexed knowledge/ directory (optional)
+	route           *config.RoutingPolicy        // Chooses the model per command, when Model is route:<policy>
+	models          *models.Registry             // Capabilities routing checks the cheap model against
+	lineage         []string                     // Assistants whose prompt.md it was built from, itself first
+	logger          *slog.Logger                 // Logger
+}
+
+// Example is a sample exchange sent ahead of each command to show the
+// model the expected response
+type Example struct {
+	User      string `yaml:"user"`
+	Assistant string `yaml:"assistant"`
 }
 
 // Manager handles loading and managing assistants
@@ -46,7 +89,15 @@ type Manager struct {
 	providers       *registry.Registry
 	defaultProvider string
 	sandbox         *sandbox.Sandbox
+	limiter         *toolLimiter
+	quotas          *toolQuotas
+	toolEnv         map[string]map[string]string
+	content         security.ContentFilter
+	knowledge       map[string]*knowledge.Base // By assistant name, shared by its versions
+	routing         map[string]config.RoutingPolicy
+	models          *models.Registry
 	logger          *slog.Logger
+	mu              sync.Mutex
 }
 
 // NewManager creates a new assistant manager
@@ -64,12 +115,48 @@ func NewManager(basePath string, toolMgr *tool.Manager, providers *registry.Regi
 		providers:       providers,
 		defaultProvider: defaultProvider,
 		sandbox:         sb,
-		logger:          logging.NewLogger(&logging.Options{Level: slog.LevelDebug}),
+		limiter:         newToolLimiter(),
+		quotas:          newToolQuotas(),
+		knowledge:       make(map[string]*knowledge.Base),
+		logger:          logging.Default(),
 	}, nil
 }
 
+// SetToolConcurrency caps how many calls of each named tool run at once
+// across the manager's assistants. Tools without a limit are not capped.
+func (m *Manager) SetToolConcurrency(limits map[string]int) {
+	m.limiter.set(limits)
+}
+
+// SetToolQuotas limits how often each named tool is called across the
+// manager's assistants. Calls over a limit are refused and audited.
+func (m *Manager) SetToolQuotas(limits map[string]config.ToolLimits, opts QuotaOptions) error {
+	return m.quotas.set(limits, opts)
+}
+
+// SetToolEnv sets the configured environment of each named tool, for the
+// tools assistants loaded afterwards run. Values may be secret://
+// references.
+func (m *Manager) SetToolEnv(env map[string]map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.toolEnv = env
+}
+
+// SetContentFilter screens the text assistants loaded afterwards exchange
+// with providers: the user and tool messages they send and the responses
+// they receive
+func (m *Manager) SetContentFilter(f security.ContentFilter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.content = f
+}
+
 // Get returns an assistant by name, loading it if necessary
 func (m *Manager) Get(name string) (*Assistant, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	// Check if already loaded
 	if assistant, exists := m.assistants[name]; exists {
 		return assistant, nil
@@ -81,11 +168,27 @@ func (m *Manager) Get(name string) (*Assistant, error) {
 		return nil, err
 	}
 
+	// Fail fast on tools older than the assistant needs
+	if err := m.checkToolVersions(assistant); err != nil {
+		return nil, err
+	}
+	route, err := m.routingPolicy(assistant)
+	if err != nil {
+		return nil, err
+	}
+
 	// Initialize assistant components
 	assistant.toolMgr = m.toolMgr
 	assistant.providers = m.providers
 	assistant.defaultProvider = m.defaultProvider
 	assistant.sandbox = m.sandbox
+	assistant.limiter = m.limiter
+	assistant.quotas = m.quotas
+	assistant.toolEnv = m.toolEnv
+	assistant.content = m.content
+	assistant.knowledge = m.knowledgeBase(name)
+	assistant.route = route
+	assistant.models = m.models
 	assistant.logger = m.logger
 
 	// Cache for future use
@@ -93,12 +196,191 @@ func (m *Manager) Get(name string) (*Assistant, error) {
 	return assistant, nil
 }
 
-// loadAssistant loads an assistant from its prompt.md file
+// checkToolVersions loads each tool with a minimum version in the
+// assistant's front matter and checks the version its usage reports
+func (m *Manager) checkToolVersions(a *Assistant) error {
+	if len(a.MinToolVersions) == 0 {
+		return nil
+	}
+	if m.toolMgr == nil {
+		return fmt.Errorf("assistant %s declares min_tool_versions but no tools are available", a.Name)
+	}
+
+	names := make([]string, 0, len(a.MinToolVersions))
+	for name := range a.MinToolVersions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t, err := m.toolMgr.LoadTool(name)
+		if err != nil {
+			return fmt.Errorf("assistant %s needs tool %s: %w", a.Name, name, err)
+		}
+		if err := t.Satisfies(a.MinToolVersions[name]); err != nil {
+			return fmt.Errorf("assistant %s is incompatible: %w", a.Name, err)
+		}
+	}
+	return nil
+}
+
+// List returns the names of the assistants under the base path, sorted.
+// An assistant is any subdirectory containing a prompt.md.
+func (m *Manager) List() ([]string, error) {
+	entries, err := os.ReadDir(m.basePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read assistants directory: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(m.basePath, entry.Name(), "prompt.md")); err == nil {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// RunTool runs a tool in the assistants' sandbox with JSON input, outside
+// of any conversation
+func (m *Manager) RunTool(ctx context.Context, name string, input string) (string, error) {
+	m.mu.Lock()
+	env := m.toolEnv[name]
+	m.mu.Unlock()
+	return runTool(ctx, m.toolMgr, m.sandbox, m.limiter, m.quotas, env, name, input)
+}
+
+// loadAssistant loads an assistant and the assistants it extends. A child
+// inherits its parent's settings: its prompt and developer instructions
+// follow the parent's, its examples and tools are added to the parent's,
+// and any other setting it declares replaces the parent's.
 func (m *Manager) loadAssistant(name string) (*Assistant, error) {
-	promptPath := filepath.Join(m.basePath, name, "prompt.md")
-	content, err := os.ReadFile(promptPath)
+	return m.resolveAssistant(name, nil)
+}
+
+// resolveAssistant loads name and merges it over its parents. chain holds
+// the assistants that extend name, to detect cycles.
+func (m *Manager) resolveAssistant(name string, chain []string) (*Assistant, error) {
+	for _, seen := range chain {
+		if seen == name {
+			return nil, fmt.Errorf("assistant inheritance cycle: %s", strings.Join(append(chain, name), " -> "))
+		}
+	}
+
+	assistant, err := m.readAssistant(name)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(name, "@") {
+		if err := m.snapshot(name); err != nil {
+			m.logger.Warn("prompt version not saved", "assistant", name, "error", err)
+		}
+	}
+	assistant.lineage = []string{name}
+	if assistant.Extends == "" {
+		return assistant, nil
+	}
+
+	parent, err := m.resolveAssistant(assistant.Extends, append(chain, name))
 	if err != nil {
-		return nil, fmt.Errorf("failed to read prompt.md: %w", err)
+		return nil, fmt.Errorf("failed to load parent assistant %s: %w", assistant.Extends, err)
+	}
+	merged := mergeAssistant(parent, assistant)
+	merged.lineage = append([]string{name}, parent.lineage...)
+	return merged, nil
+}
+
+// mergeAssistant returns child with the settings it leaves out taken from
+// parent
+func mergeAssistant(parent, child *Assistant) *Assistant {
+	merged := *child
+	if merged.Description == "" {
+		merged.Description = parent.Description
+	}
+	if merged.Model == "" {
+		merged.Model = parent.Model
+	}
+	if merged.Format == "" {
+		merged.Format = parent.Format
+	}
+	if merged.Output == "" {
+		merged.Output = parent.Output
+	}
+	if merged.MaxToolRounds == 0 {
+		merged.MaxToolRounds = parent.MaxToolRounds
+	}
+	if merged.ToolTokenBudget == 0 {
+		merged.ToolTokenBudget = parent.ToolTokenBudget
+	}
+	if len(parent.MinToolVersions) > 0 {
+		merged.MinToolVersions = make(map[string]string)
+		for name, version := range parent.MinToolVersions {
+			merged.MinToolVersions[name] = version
+		}
+		for name, version := range child.MinToolVersions {
+			merged.MinToolVersions[name] = version
+		}
+	}
+	merged.Constraints = parent.Constraints.merge(child.Constraints)
+	merged.Developer = joinInstructions(parent.Developer, child.Developer)
+	merged.Examples = append(append([]Example(nil), parent.Examples...), child.Examples...)
+
+	merged.Tools = append([]string(nil), parent.Tools...)
+	for _, tool := range child.Tools {
+		if !contains(merged.Tools, tool) {
+			merged.Tools = append(merged.Tools, tool)
+		}
+	}
+
+	merged.Prompt = joinInstructions(parent.Prompt, child.Prompt)
+	return &merged
+}
+
+// joinInstructions returns a parent's instructions followed by a child's
+func joinInstructions(parent, child string) string {
+	switch {
+	case parent == "":
+		return child
+	case child == "":
+		return parent
+	default:
+		return parent + "\n\n" + child
+	}
+}
+
+// contains reports whether list holds s
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// readAssistant reads an assistant from its prompt.md file. A name of the
+// form name@v<number> reads that version of the prompt.md instead.
+func (m *Manager) readAssistant(name string) (*Assistant, error) {
+	base, version, err := splitVersion(name)
+	if err != nil {
+		return nil, err
+	}
+	var content []byte
+	if version > 0 {
+		if content, err = ReadVersion(m.basePath, base, version); err != nil {
+			return nil, err
+		}
+	} else {
+		promptPath := filepath.Join(m.basePath, name, "prompt.md")
+		if content, err = os.ReadFile(promptPath); err != nil {
+			return nil, fmt.Errorf("failed to read prompt.md: %w", err)
+		}
 	}
 
 	// Split front matter and prompt content
@@ -113,6 +395,35 @@ func (m *Manager) loadAssistant(name string) (*Assistant, error) {
 		return nil, fmt.Errorf("invalid YAML front matter: %w", err)
 	}
 
+	switch assistant.Format {
+	case "", FormatText, FormatTable, FormatJSON:
+	default:
+		return nil, fmt.Errorf("invalid response format: %s", assistant.Format)
+	}
+	if !parser.ValidOutput(assistant.Output) {
+		return nil, fmt.Errorf("invalid output mode: %s", assistant.Output)
+	}
+	for i, example := range assistant.Examples {
+		if strings.TrimSpace(example.User) == "" || strings.TrimSpace(example.Assistant) == "" {
+			return nil, fmt.Errorf("example %d needs both user and assistant", i+1)
+		}
+	}
+	if assistant.MaxToolRounds < 0 {
+		return nil, fmt.Errorf("invalid max_tool_rounds: %d", assistant.MaxToolRounds)
+	}
+	if assistant.ToolTokenBudget < 0 {
+		return nil, fmt.Errorf("invalid tool_token_budget: %d", assistant.ToolTokenBudget)
+	}
+	for name, version := range assistant.MinToolVersions {
+		if !tool.ValidVersion(version) {
+			return nil, fmt.Errorf("invalid min_tool_versions for %s: %q is not a semantic version", name, version)
+		}
+	}
+	if err := assistant.Constraints.validate(); err != nil {
+		return nil, fmt.Errorf("invalid constraints: %w", err)
+	}
+	assistant.Developer = strings.TrimSpace(assistant.Developer)
+
 	// Store prompt content
 	assistant.Prompt = strings.TrimSpace(parts[2])
 
@@ -121,15 +432,37 @@ func (m *Manager) loadAssistant(name string) (*Assistant, error) {
 
 // Process processes a command using this assistant
 func (a *Assistant) Process(cmd *parser.Command) (string, error) {
-	a.logger.Debug("processing command",
+	return a.ProcessContext(context.Background(), cmd)
+}
+
+// ProcessContext processes a command within ctx, which carries the trace
+// and cancellation for provider requests
+func (a *Assistant) ProcessContext(ctx context.Context, cmd *parser.Command) (string, error) {
+	logging.FromContext(ctx, a.logger).Debug("processing command",
 		"assistant", a.Name,
 		"command", cmd.Text)
+	ctx = withCommandCalls(ctx) // For tools limited per command
+	a = a.forCommand(cmd)       // Flags such as --no-tools apply to this command only
+
+	// Choose the model before tool results lengthen the command: the
+	// assistant's, the one the command asks for or the one it is routed to
+	model := a.ModelFor(cmd)
+	if a.route != nil && cmd.Model == "" {
+		reason := a.routeReason(cmd)
+		if reason == "" {
+			reason = "simple"
+		}
+		logging.FromContext(ctx, a.logger).Debug("routed command",
+			"assistant", a.Name,
+			"model", model,
+			"reason", reason)
+	}
 
 	// Check for tool usage in command
 	toolName, toolInput := a.parseToolUsage(cmd.Text)
 	if toolName != "" {
 		// Execute tool
-		result, err := a.executeTool(toolName, toolInput)
+		result, err := a.executeTool(ctx, toolName, toolInput)
 		if err != nil {
 			return "", err // Don't wrap error to allow proper error propagation
 		}
@@ -138,19 +471,15 @@ func (a *Assistant) Process(cmd *parser.Command) (string, error) {
 		cmd.Text = fmt.Sprintf("%s\nTool result: %s", cmd.Text, result)
 	}
 
-	// Build context with any references
-	ctx := context.Background()
-	prompt := a.buildPrompt(cmd)
-
-	// Get provider for this assistant's model
-	p, err := a.providers.CreateForModel(a.Model, a.defaultProvider)
+	// Get provider for the model
+	p, err := a.providers.CreateForModel(model, a.defaultProvider)
 	if err != nil {
 		return "", fmt.Errorf("failed to create provider: %w", err)
 	}
 	defer p.Close()
 
 	// Get model name without provider prefix
-	_, modelName := registry.ParseModelSpec(a.Model)
+	_, modelName := registry.ParseModelSpec(model)
 
 	// Build request options from assistant config
 	opts := &provider.RequestOptions{
@@ -158,42 +487,137 @@ func (a *Assistant) Process(cmd *parser.Command) (string, error) {
 		Temperature: 0.7,  // Default temperature
 		MaxTokens:   2000, // Default max tokens
 	}
+	applyFlags(opts, cmd)
+	schema, err := commandSchema(cmd)
+	if err != nil {
+		return "", err
+	}
+	if schema != nil {
+		opts.Schema = schema.Raw()
+	}
 
-	// Get response from provider
-	resp, err := p.Send(ctx, prompt, opts)
+	// Get response from provider, answering tool calls until the model
+	// responds without any
+	messages, err := a.screenPrompt(a.assembleMessages(ctx, cmd))
 	if err != nil {
-		return "", fmt.Errorf("provider error: %w", err)
+		return "", err
 	}
-	if resp.Error != nil {
-		return "", fmt.Errorf("provider error: %v", resp.Error)
+	loop := provider.ToolLoop{MaxRounds: a.MaxToolRounds, MaxTokens: a.ToolTokenBudget}
+	ask := func(messages []provider.Message) (string, error) {
+		resp, err := loop.Run(ctx, messages,
+			func(ctx context.Context, messages []provider.Message) (*provider.Response, error) {
+				resp, err := a.send(ctx, p, messages, opts)
+				if err != nil {
+					return nil, fmt.Errorf("provider error: %w", err)
+				}
+				return resp, nil
+			},
+			func(ctx context.Context, call provider.ToolCall) (string, error) {
+				// Don't wrap error to allow proper error propagation
+				result, err := a.executeTool(ctx, call.Function.Name, call.Function.Arguments)
+				if errors.Is(err, ErrToolNotAllowed) || errors.Is(err, ErrToolQuotaExceeded) {
+					// Tell the model rather than fail the command, so it can
+					// answer without the call
+					code := "not_allowed"
+					if errors.Is(err, ErrToolQuotaExceeded) {
+						code = "quota_exceeded"
+					}
+					failure := &tool.Failure{Code: code, Message: err.Error()}
+					return failure.Result(), nil
+				}
+				if err != nil || a.content == nil {
+					return result, err
+				}
+				return a.content.ScreenPrompt(result)
+			})
+		if err != nil {
+			return "", err
+		}
+		if resp.Error != nil {
+			return "", fmt.Errorf("provider error: %v", resp.Error)
+		}
+		return resp.Content, nil
+	}
+	response, err := ask(messages)
+	if err != nil {
+		return "", err
+	}
+
+	// Structured responses must match their schema; others follow the
+	// assistant's constraints
+	if schema != nil {
+		response, err = a.conform(ctx, messages, response, schema, ask)
+	} else {
+		response, err = a.enforceConstraints(ctx, messages, response, ask)
+	}
+	if err != nil {
+		return "", err
 	}
 
-	// Handle tool calls if present
-	if len(resp.ToolCalls) > 0 {
-		// Execute each tool
-		for _, call := range resp.ToolCalls {
-			result, err := a.executeTool(call.Function.Name, call.Function.Arguments)
+	if a.content != nil {
+		return a.content.ScreenResponse(response)
+	}
+	return response, nil
+}
+
+// screenPrompt passes the user and tool messages to be sent through the
+// content filter, if one is set
+func (a *Assistant) screenPrompt(messages []provider.Message) ([]provider.Message, error) {
+	if a.content == nil {
+		return messages, nil
+	}
+	screened := make([]provider.Message, len(messages))
+	for i, m := range messages {
+		if m.Role == provider.RoleUser || m.Role == provider.RoleTool {
+			content, err := a.content.ScreenPrompt(m.Content)
 			if err != nil {
-				return "", err // Don't wrap error to allow proper error propagation
+				return nil, err
 			}
-
-			// Include tool result in context
-			cmd.Text = fmt.Sprintf("%s\nTool '%s' result: %s",
-				cmd.Text, call.Function.Name, result)
+			m.Content = content
 		}
+		screened[i] = m
+	}
+	return screened, nil
+}
 
-		// Get final response with tool results
-		prompt = a.buildPrompt(cmd)
-		resp, err = p.Send(ctx, prompt, opts)
-		if err != nil {
-			return "", fmt.Errorf("provider error after tools: %w", err)
-		}
-		if resp.Error != nil {
-			return "", fmt.Errorf("provider error after tools: %v", resp.Error)
-		}
+// send issues a provider request inside a client span
+func (a *Assistant) send(ctx context.Context, p provider.Provider, messages []provider.Message, opts *provider.RequestOptions) (*provider.Response, error) {
+	length := 0
+	for _, m := range messages {
+		length += len(m.Content)
 	}
+	ctx, span := tracing.Start(ctx, "provider.send",
+		tracing.WithKind(tracing.KindClient),
+		tracing.WithAttributes(
+			tracing.String("assistant.name", a.Name),
+			tracing.String("model.name", opts.Model),
+			tracing.Int("prompt.length", length),
+			tracing.Int("message.count", len(messages))))
+	defer span.End()
+
+	resp, err := p.Send(ctx, messages, opts)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	provider.RecordUsage(ctx, resp.Usage)
+	span.RecordError(resp.Error)
+	span.SetAttributes(
+		tracing.Int("usage.prompt_tokens", resp.Usage.PromptTokens),
+		tracing.Int("usage.completion_tokens", resp.Usage.CompletionTokens),
+		tracing.Int("tool_calls", len(resp.ToolCalls)))
+	return resp, nil
+}
 
-	return resp.Content, nil
+// assembleMessages builds the messages for cmd inside a context assembly
+// span
+func (a *Assistant) assembleMessages(ctx context.Context, cmd *parser.Command) []provider.Message {
+	_, span := tracing.Start(ctx, "context.assemble",
+		tracing.WithAttributes(
+			tracing.String("assistant.name", a.Name),
+			tracing.Int("reference.count", len(cmd.References))))
+	defer span.End()
+	return a.buildMessages(cmd)
 }
 
 // parseToolUsage checks if a command wants to use a tool
@@ -209,10 +633,41 @@ func (a *Assistant) parseToolUsage(text string) (string, string) {
 	return "", ""
 }
 
-// executeTool runs a tool in the sandbox
-func (a *Assistant) executeTool(name string, input string) (string, error) {
+// executeTool runs a tool in the sandbox. Only the tools the assistant
+// declares may run, whoever asks for them. A failure the tool reports in
+// structured error output becomes its result, for the model to act on.
+func (a *Assistant) executeTool(ctx context.Context, name string, input string) (string, error) {
+	if !contains(a.Tools, name) {
+		logging.FromContext(ctx, a.logger).Warn("refused tool call",
+			"assistant", a.Name,
+			"tool", name)
+		return "", fmt.Errorf("%w: assistant %s cannot use %s", ErrToolNotAllowed, a.Name, name)
+	}
+	result, err := runTool(ctx, a.toolMgr, a.sandbox, a.limiter, a.quotas, a.toolEnv[name], name, input)
+	var failure *tool.Failure
+	if errors.As(err, &failure) {
+		logging.FromContext(ctx, a.logger).Warn("tool reported an error",
+			"tool", name,
+			"code", failure.Code,
+			"error", failure.Message)
+		return failure.Result(), nil
+	}
+	return result, err
+}
+
+// runTool loads, validates and executes a tool in sb, with env as its
+// configured environment, once quotas allow the call and limiter lets it
+// run
+func runTool(ctx context.Context, toolMgr toolManager, sb *sandbox.Sandbox, limiter *toolLimiter, quotas *toolQuotas, env map[string]string, name string, input string) (out string, err error) {
+	_, span := tracing.Start(ctx, "tool.execute",
+		tracing.WithAttributes(tracing.String("tool.name", name)))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
 	// Get tool
-	tool, err := a.toolMgr.LoadTool(name)
+	tool, err := toolMgr.LoadTool(name)
 	if err != nil {
 		return "", fmt.Errorf("failed to load tool: %w", err)
 	}
@@ -235,8 +690,16 @@ func (a *Assistant) executeTool(name string, input string) (string, error) {
 		return "", fmt.Errorf("invalid tool input: %w", err)
 	}
 
-	// Execute in sandbox
-	output, err := tool.Execute(inputJSON, nil, a.sandbox)
+	// Execute in sandbox, waiting for a slot when the tool is limited
+	if err := quotas.acquire(ctx, name); err != nil {
+		return "", err
+	}
+	release, err := limiter.acquire(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	output, err := tool.ExecuteContext(ctx, inputJSON, env, sb)
+	release()
 	if err != nil {
 		return "", err // Don't wrap error to allow proper error propagation
 	}
@@ -251,27 +714,150 @@ func (a *Assistant) executeTool(name string, input string) (string, error) {
 	return prettyOutput.String(), nil
 }
 
-// buildPrompt creates the full prompt with context
-func (a *Assistant) buildPrompt(cmd *parser.Command) string {
-	var b strings.Builder
+// buildMessages creates the request as messages: the system prompt, the
+// developer instructions, the examples and earlier exchanges as user and
+// assistant turns, and the command with its context and images
+func (a *Assistant) buildMessages(cmd *parser.Command) []provider.Message {
+	messages := []provider.Message{{Role: provider.RoleSystem, Content: a.instructions()}}
+	if a.Developer != "" {
+		messages = append(messages, provider.Message{Role: provider.RoleDeveloper, Content: a.Developer})
+	}
+	for _, example := range a.Examples {
+		messages = append(messages,
+			provider.Message{Role: provider.RoleUser, Content: example.User},
+			provider.Message{Role: provider.RoleAssistant, Content: example.Assistant})
+	}
+	for _, exchange := range cmd.History {
+		messages = append(messages,
+			provider.Message{Role: provider.RoleUser, Content: exchange.Prompt},
+			provider.Message{Role: provider.RoleAssistant, Content: exchange.Response})
+	}
+	request := provider.Message{Role: provider.RoleUser, Content: a.request(cmd)}
+	for _, image := range cmd.Images {
+		if len(image.Data) > 0 {
+			request.Images = append(request.Images, provider.Image{MediaType: image.MediaType, Data: image.Data})
+		}
+	}
+	return append(messages, request)
+}
 
-	// Add system prompt
+// instructions returns the system prompt with the tools the assistant may
+// use and the rules of its responses
+func (a *Assistant) instructions() string {
+	rules := a.Constraints.rules()
+	if len(a.Tools) == 0 && len(rules) == 0 {
+		return a.Prompt
+	}
+	var b strings.Builder
 	b.WriteString(a.Prompt)
-	b.WriteString("\n\n")
-
-	// Add available tools
 	if len(a.Tools) > 0 {
-		b.WriteString("Available tools:\n")
-		for _, tool := range a.Tools {
-			b.WriteString(fmt.Sprintf("- %s\n", tool))
+		b.WriteString("\n\nAvailable tools:\n")
+		for i, tool := range a.Tools {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			b.WriteString(fmt.Sprintf("- %s", tool))
+		}
+	}
+	if len(rules) > 0 {
+		b.WriteString("\n\nResponse rules:\n- ")
+		b.WriteString(strings.Join(rules, "\n- "))
+	}
+	return b.String()
+}
+
+// request returns the command with the sections it references and the
+// expected response format
+func (a *Assistant) request(cmd *parser.Command) string {
+	var b strings.Builder
+
+	// Add referenced sections, in the order the command names them
+	var sections []string
+	referenced := make(map[string]bool, len(cmd.References))
+	for _, ref := range cmd.References {
+		referenced[ref] = true
+		if block, ok := cmd.Context[ref]; ok {
+			sections = append(sections, fmt.Sprintf("## %s\n%s\n%s", ref, block.Content, tableData(block)))
+		}
+	}
+	if len(sections) > 0 {
+		b.WriteString("Referenced sections:\n")
+		for _, section := range sections {
+			b.WriteString(section)
 		}
 		b.WriteString("\n")
 	}
 
-	// Add command and any references
+	// Add surrounding sections, such as the parents and siblings of
+	// referenced ones, by header
+	var related []string
+	for header := range cmd.Context {
+		if !referenced[header] {
+			related = append(related, header)
+		}
+	}
+	if len(related) > 0 {
+		sort.Strings(related)
+		b.WriteString("Related sections:\n")
+		for _, header := range related {
+			b.WriteString(fmt.Sprintf("## %s\n%s\n", header, cmd.Context[header].Content))
+		}
+		b.WriteString("\n")
+	}
+
+	// Add the passages of the assistant's knowledge most relevant to the
+	// command
+	if chunks := a.knowledge.Search(cmd.Text, maxKnowledgeChunks); len(chunks) > 0 {
+		b.WriteString("Knowledge:\n")
+		for _, chunk := range chunks {
+			b.WriteString(fmt.Sprintf("## %s\n%s\n", chunk.Title(), chunk.Text))
+		}
+		b.WriteString("\n")
+	}
+
+	// Add command
 	b.WriteString("Command: ")
 	b.WriteString(cmd.Text)
 	b.WriteString("\n")
 
+	switch {
+	case cmd.Schema != nil && len(cmd.Schema.Data) > 0:
+		b.WriteString("\nRespond only with JSON conforming to this JSON schema:\n")
+		b.WriteString(strings.TrimSpace(string(cmd.Schema.Data)))
+		b.WriteString("\n")
+	case a.ResponseFormat(cmd) == FormatTable:
+		b.WriteString("\nRespond only with a JSON object of the form " +
+			`{"columns": ["Name", ...], "rows": [["value", ...], ...]}` + "\n")
+	case a.ResponseFormat(cmd) == FormatJSON:
+		b.WriteString("\nRespond only with JSON.\n")
+	}
+
 	return b.String()
 }
+
+// ResponseFormat returns the format of the response to cmd: the one the
+// command asks for, or the assistant's. Responses to a schema are JSON
+// unless written as a table.
+func (a *Assistant) ResponseFormat(cmd *parser.Command) string {
+	format := cmd.Format
+	if format == "" {
+		format = a.Format
+	}
+	if cmd.Schema != nil && format != FormatTable {
+		return FormatJSON
+	}
+	return format
+}
+
+// tableData returns the rows and columns of a table section as JSON, or
+// nothing for other sections
+func tableData(block parser.Block) string {
+	if block.Table == nil {
+		return ""
+	}
+	data, err := json.Marshal(block.Table)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("Table data: %s\n", data)
+}
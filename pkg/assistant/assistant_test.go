@@ -2,15 +2,22 @@ package assistant
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/butter-bot-machines/skylark/pkg/logging"
 	"github.com/butter-bot-machines/skylark/pkg/parser"
 	"github.com/butter-bot-machines/skylark/pkg/provider"
 	"github.com/butter-bot-machines/skylark/pkg/provider/registry"
 	"github.com/butter-bot-machines/skylark/pkg/sandbox"
+	secconcrete "github.com/butter-bot-machines/skylark/pkg/security/concrete"
+	"github.com/butter-bot-machines/skylark/pkg/security/types"
 	"github.com/butter-bot-machines/skylark/pkg/tool"
 )
 
@@ -21,7 +28,7 @@ type mockProvider struct {
 	verifyOptions func(*provider.RequestOptions) error
 }
 
-func (m *mockProvider) Send(ctx context.Context, prompt string, opts *provider.RequestOptions) (*provider.Response, error) {
+func (m *mockProvider) Send(ctx context.Context, messages []provider.Message, opts *provider.RequestOptions) (*provider.Response, error) {
 	if m.err != nil {
 		return nil, m.err
 	}
@@ -48,6 +55,7 @@ func TestAssistantModelConfig(t *testing.T) {
 	tests := []struct {
 		name        string
 		modelConfig string
+		override    string
 		wantModel   string
 	}{
 		{
@@ -60,6 +68,12 @@ func TestAssistantModelConfig(t *testing.T) {
 			modelConfig: "openai:gpt-4",
 			wantModel:   "gpt-4",
 		},
+		{
+			name:        "command overrides model",
+			modelConfig: "gpt-4",
+			override:    "openai:gpt-3.5-turbo",
+			wantModel:   "gpt-3.5-turbo",
+		},
 	}
 
 	for _, tt := range tests {
@@ -122,7 +136,7 @@ Test prompt content
 			}
 
 			// Process command - this should use the assistant's model config
-			_, err = assistant.Process(&parser.Command{Text: "test"})
+			_, err = assistant.Process(&parser.Command{Text: "test", Model: tt.override})
 			if err != nil {
 				t.Fatalf("Process() error = %v", err)
 			}
@@ -284,3 +298,484 @@ func main() {
 		t.Errorf("Process() with tool response = %v, want 'The current time is 2025-01-05T10:00:00Z'", response)
 	}
 }
+
+func TestAssistantManagerList(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"writer", "default"} {
+		dir := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create assistant directory: %v", err)
+		}
+		prompt := fmt.Sprintf("---\nname: %s\ndescription: The %s assistant\nmodel: gpt-4\n---\nYou help.\n", name, name)
+		if err := os.WriteFile(filepath.Join(dir, "prompt.md"), []byte(prompt), 0644); err != nil {
+			t.Fatalf("Failed to write prompt.md: %v", err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(tempDir, "knowledge"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	toolMgr, err := tool.NewManager(filepath.Join(tempDir, "tools"))
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer toolMgr.Close()
+	manager, err := NewManager(tempDir, toolMgr, registry.New(), &sandbox.NetworkPolicy{}, "openai")
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+
+	names, err := manager.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(names) != 2 || names[0] != "default" || names[1] != "writer" {
+		t.Errorf("Expected [default writer], got %v", names)
+	}
+}
+
+func TestAssistantExtends(t *testing.T) {
+	tempDir := t.TempDir()
+	prompts := map[string]string{
+		"default":  "---\nname: default\ndescription: General help\nmodel: gpt-4\ntools:\n  - currentdatetime\nexamples:\n  - user: hi\n    assistant: hello\n---\nYou help.\n",
+		"research": "---\nname: research\nextends: default\ndeveloper: Be brief.\ntools:\n  - web_search\n  - currentdatetime\n---\nCite your sources.\n",
+		"brief":    "---\nname: brief\nextends: research\nmodel: gpt-3.5-turbo\n---\n",
+		"loop-a":   "---\nname: loop-a\nextends: loop-b\n---\nA.\n",
+		"loop-b":   "---\nname: loop-b\nextends: loop-a\n---\nB.\n",
+		"orphan":   "---\nname: orphan\nextends: missing\n---\nAlone.\n",
+	}
+	for name, prompt := range prompts {
+		dir := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create assistant directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "prompt.md"), []byte(prompt), 0644); err != nil {
+			t.Fatalf("Failed to write prompt.md: %v", err)
+		}
+	}
+
+	toolMgr, err := tool.NewManager(filepath.Join(tempDir, "tools"))
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer toolMgr.Close()
+	manager, err := NewManager(tempDir, toolMgr, registry.New(), &sandbox.NetworkPolicy{}, "openai")
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+
+	tests := []struct {
+		name            string
+		wantPrompt      string
+		wantModel       string
+		wantTools       []string
+		wantErr         string
+		wantDescription string
+	}{
+		{
+			name:            "research",
+			wantPrompt:      "You help.\n\nCite your sources.",
+			wantModel:       "gpt-4",
+			wantTools:       []string{"currentdatetime", "web_search"},
+			wantDescription: "General help",
+		},
+		{
+			name:            "brief",
+			wantPrompt:      "You help.\n\nCite your sources.",
+			wantModel:       "gpt-3.5-turbo",
+			wantTools:       []string{"currentdatetime", "web_search"},
+			wantDescription: "General help",
+		},
+		{name: "loop-a", wantErr: "assistant inheritance cycle: loop-a -> loop-b -> loop-a"},
+		{name: "orphan", wantErr: "failed to load parent assistant missing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := manager.Get(tt.name)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if a.Name != tt.name {
+				t.Errorf("Expected name %s, got %s", tt.name, a.Name)
+			}
+			if a.Prompt != tt.wantPrompt {
+				t.Errorf("Expected prompt %q, got %q", tt.wantPrompt, a.Prompt)
+			}
+			if a.Model != tt.wantModel {
+				t.Errorf("Expected model %s, got %s", tt.wantModel, a.Model)
+			}
+			if strings.Join(a.Tools, ",") != strings.Join(tt.wantTools, ",") {
+				t.Errorf("Expected tools %v, got %v", tt.wantTools, a.Tools)
+			}
+			if a.Developer != "Be brief." || len(a.Examples) != 1 || a.Examples[0].User != "hi" {
+				t.Errorf("Expected inherited developer instructions and examples, got %q and %+v", a.Developer, a.Examples)
+			}
+			if a.Description != tt.wantDescription {
+				t.Errorf("Expected description %q, got %q", tt.wantDescription, a.Description)
+			}
+		})
+	}
+}
+
+func TestBuildRequestReferences(t *testing.T) {
+	a := &Assistant{Name: "test", Prompt: "You help."}
+	cmd := &parser.Command{
+		Text:       "summarize #Roadmap# and #Risks#",
+		References: []string{"Roadmap", "Risks"},
+		Context: map[string]parser.Block{
+			"Roadmap": {Type: parser.Paragraph, Content: "Ship v1 in May."},
+		},
+	}
+
+	prompt := a.request(cmd)
+	expected := "Referenced sections:\n## Roadmap\nShip v1 in May.\n\nCommand: summarize #Roadmap# and #Risks#\n"
+	if prompt != expected {
+		t.Errorf("Expected prompt:\n%q\ngot:\n%q", expected, prompt)
+	}
+
+	// Sections the command does not name follow as related sections
+	cmd.Context["Goals"] = parser.Block{Type: parser.Paragraph, Content: "Grow."}
+	prompt = a.request(cmd)
+	expected = "Referenced sections:\n## Roadmap\nShip v1 in May.\n\nRelated sections:\n## Goals\nGrow.\n\nCommand: summarize #Roadmap# and #Risks#\n"
+	if prompt != expected {
+		t.Errorf("Expected prompt:\n%q\ngot:\n%q", expected, prompt)
+	}
+
+	// Without context the prompt carries only the command
+	cmd.Context = nil
+	if prompt := a.request(cmd); strings.Contains(prompt, "Referenced sections") {
+		t.Errorf("Expected no referenced sections, got %q", prompt)
+	}
+}
+
+func TestBuildRequestTable(t *testing.T) {
+	a := &Assistant{Name: "test", Prompt: "You help.", Format: FormatTable}
+	cmd := &parser.Command{
+		Text:       "add a Team plan to #Pricing#",
+		References: []string{"Pricing"},
+		Context: map[string]parser.Block{
+			"Pricing": {
+				Type:    parser.Table,
+				Content: "| Plan | Price |\n|---|---|\n| Free | 0 |",
+				Table:   &parser.TableData{Columns: []string{"Plan", "Price"}, Rows: [][]string{{"Free", "0"}}},
+			},
+		},
+	}
+
+	prompt := a.request(cmd)
+	for _, want := range []string{
+		"## Pricing\n| Plan | Price |\n|---|---|\n| Free | 0 |\nTable data: {\"columns\":[\"Plan\",\"Price\"],\"rows\":[[\"Free\",\"0\"]]}\n",
+		"Command: add a Team plan to #Pricing#\n\nRespond only with a JSON object",
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("Expected prompt to contain %q, got:\n%s", want, prompt)
+		}
+	}
+}
+
+func TestBuildMessages(t *testing.T) {
+	a := &Assistant{
+		Name:      "test",
+		Prompt:    "You help.",
+		Tools:     []string{"currentdatetime"},
+		Developer: "Answer in one line.",
+		Examples:  []Example{{User: "2+2?", Assistant: "4"}},
+	}
+	cmd := &parser.Command{
+		Text:    "and 3+3?",
+		History: []parser.Exchange{{Prompt: "1+1?", Response: "2"}},
+	}
+
+	messages := a.buildMessages(cmd)
+	expected := []provider.Message{
+		{Role: provider.RoleSystem, Content: "You help.\n\nAvailable tools:\n- currentdatetime"},
+		{Role: provider.RoleDeveloper, Content: "Answer in one line."},
+		{Role: provider.RoleUser, Content: "2+2?"},
+		{Role: provider.RoleAssistant, Content: "4"},
+		{Role: provider.RoleUser, Content: "1+1?"},
+		{Role: provider.RoleAssistant, Content: "2"},
+		{Role: provider.RoleUser, Content: "Command: and 3+3?\n"},
+	}
+	if !reflect.DeepEqual(messages, expected) {
+		t.Errorf("Expected messages:\n%+v\ngot:\n%+v", expected, messages)
+	}
+
+	// Loaded images go with the command; images that failed to load do not
+	cmd = &parser.Command{
+		Text: "describe ![diagram](arch.png) ![missing](gone.png)",
+		Images: []parser.Image{
+			{Alt: "diagram", Path: "arch.png", MediaType: "image/png", Data: []byte("png")},
+			{Alt: "missing", Path: "gone.png"},
+		},
+	}
+	messages = a.buildMessages(cmd)
+	request := messages[len(messages)-1]
+	if !reflect.DeepEqual(request.Images, []provider.Image{{MediaType: "image/png", Data: []byte("png")}}) {
+		t.Errorf("Expected the diagram with the command, got %+v", request.Images)
+	}
+}
+
+func TestAssistantInvalidExample(t *testing.T) {
+	tempDir := t.TempDir()
+	dir := filepath.Join(tempDir, "tutor")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Failed to create assistant directory: %v", err)
+	}
+	prompt := "---\nname: tutor\nmodel: gpt-4\nexamples:\n  - user: 2+2?\n---\nYou teach.\n"
+	if err := os.WriteFile(filepath.Join(dir, "prompt.md"), []byte(prompt), 0644); err != nil {
+		t.Fatalf("Failed to write prompt.md: %v", err)
+	}
+
+	toolMgr, err := tool.NewManager(filepath.Join(tempDir, "tools"))
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer toolMgr.Close()
+	manager, err := NewManager(tempDir, toolMgr, registry.New(), &sandbox.NetworkPolicy{}, "openai")
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+
+	if _, err := manager.Get("tutor"); err == nil || !strings.Contains(err.Error(), "example 1 needs both user and assistant") {
+		t.Errorf("Expected invalid example error, got %v", err)
+	}
+}
+
+func TestAssistantInvalidFormat(t *testing.T) {
+	tempDir := t.TempDir()
+	dir := filepath.Join(tempDir, "charts")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Failed to create assistant directory: %v", err)
+	}
+	prompt := "---\nname: charts\nmodel: gpt-4\nformat: chart\n---\nYou draw.\n"
+	if err := os.WriteFile(filepath.Join(dir, "prompt.md"), []byte(prompt), 0644); err != nil {
+		t.Fatalf("Failed to write prompt.md: %v", err)
+	}
+
+	toolMgr, err := tool.NewManager(filepath.Join(tempDir, "tools"))
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer toolMgr.Close()
+	manager, err := NewManager(tempDir, toolMgr, registry.New(), &sandbox.NetworkPolicy{}, "openai")
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+
+	if _, err := manager.Get("charts"); err == nil || !strings.Contains(err.Error(), "invalid response format") {
+		t.Errorf("Expected invalid response format error, got %v", err)
+	}
+}
+
+func TestAssistantInvalidOutput(t *testing.T) {
+	tempDir := t.TempDir()
+	dir := filepath.Join(tempDir, "scribe")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Failed to create assistant directory: %v", err)
+	}
+	prompt := "---\nname: scribe\nmodel: gpt-4\noutput: margin\n---\nYou write.\n"
+	if err := os.WriteFile(filepath.Join(dir, "prompt.md"), []byte(prompt), 0644); err != nil {
+		t.Fatalf("Failed to write prompt.md: %v", err)
+	}
+
+	toolMgr, err := tool.NewManager(filepath.Join(tempDir, "tools"))
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer toolMgr.Close()
+	manager, err := NewManager(tempDir, toolMgr, registry.New(), &sandbox.NetworkPolicy{}, "openai")
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+
+	if _, err := manager.Get("scribe"); err == nil || !strings.Contains(err.Error(), "invalid output mode") {
+		t.Errorf("Expected invalid output mode error, got %v", err)
+	}
+}
+
+func TestAssistantInvalidToolLimits(t *testing.T) {
+	tempDir := t.TempDir()
+	dir := filepath.Join(tempDir, "looper")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Failed to create assistant directory: %v", err)
+	}
+	prompt := "---\nname: looper\nmodel: gpt-4\nmax_tool_rounds: -1\n---\nYou loop.\n"
+	if err := os.WriteFile(filepath.Join(dir, "prompt.md"), []byte(prompt), 0644); err != nil {
+		t.Fatalf("Failed to write prompt.md: %v", err)
+	}
+
+	toolMgr, err := tool.NewManager(filepath.Join(tempDir, "tools"))
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer toolMgr.Close()
+	manager, err := NewManager(tempDir, toolMgr, registry.New(), &sandbox.NetworkPolicy{}, "openai")
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+
+	if _, err := manager.Get("looper"); err == nil || !strings.Contains(err.Error(), "invalid max_tool_rounds: -1") {
+		t.Errorf("Expected invalid max_tool_rounds error, got %v", err)
+	}
+}
+
+func TestAssistantContentFilter(t *testing.T) {
+	content, err := secconcrete.NewContentFilter([]types.ContentFilterConfig{
+		{Name: secconcrete.DetectorEmails},
+		{Name: "codename", Pattern: `Project Falcon`, Action: types.ActionBlock, Scope: types.ScopeResponses},
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewContentFilter() error = %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		command      string
+		response     string
+		wantPrompt   string
+		wantResponse string
+		wantErr      bool
+	}{
+		{
+			name:         "redacts both ways",
+			command:      "Reply to ana@example.com",
+			response:     "Drafted a reply to ana@example.com",
+			wantPrompt:   "Reply to [REDACTED:emails]",
+			wantResponse: "Drafted a reply to [REDACTED:emails]",
+		},
+		{
+			name:     "blocks response",
+			command:  "What are we building?",
+			response: "Project Falcon",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &testProvider{responses: []provider.Response{{Content: tt.response}}}
+			reg := registry.New()
+			reg.Register("openai", func(model string) (provider.Provider, error) { return p, nil })
+			a := &Assistant{
+				Name:            "test",
+				Model:           "gpt-4",
+				providers:       reg,
+				defaultProvider: "openai",
+				content:         content,
+				logger:          logging.Default(),
+			}
+
+			got, err := a.Process(&parser.Command{Text: tt.command})
+			if tt.wantErr {
+				if !errors.Is(err, secconcrete.ErrContentBlocked) {
+					t.Errorf("Expected the response to be blocked, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Process() error = %v", err)
+			}
+			if got != tt.wantResponse {
+				t.Errorf("Expected response %q, got %q", tt.wantResponse, got)
+			}
+			sent := p.requests[0][len(p.requests[0])-1].Content
+			if !strings.Contains(sent, tt.wantPrompt) || strings.Contains(sent, "ana@example.com") {
+				t.Errorf("Expected the redacted prompt, got %q", sent)
+			}
+		})
+	}
+}
+
+func TestAssistantMinToolVersions(t *testing.T) {
+	tempDir := t.TempDir()
+	prompts := map[string]string{
+		"base":     "---\nmodel: gpt-4\nmin_tool_versions:\n  search: 1.0.0\n---\nYou search.\n",
+		"current":  "---\nextends: base\nmin_tool_versions:\n  search: 1.2.0\n---\nYou search more.\n",
+		"future":   "---\nextends: base\nmin_tool_versions:\n  search: 2.0.0\n---\nYou search ahead.\n",
+		"unpinned": "---\nmodel: gpt-4\nmin_tool_versions:\n  plain: 1.0.0\n---\nYou use plain.\n",
+		"invalid":  "---\nmodel: gpt-4\nmin_tool_versions:\n  search: latest\n---\nYou guess.\n",
+	}
+	for name, prompt := range prompts {
+		writeFiles(t, filepath.Join(tempDir, name), map[string]string{"prompt.md": prompt})
+	}
+
+	toolMgr, err := tool.NewManager(filepath.Join(tempDir, "tools"))
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer toolMgr.Close()
+	noop := func(input []byte) ([]byte, error) { return input, nil }
+	for _, def := range []tool.Definition{
+		{Name: "search", Version: "1.2.0", Func: noop},
+		{Name: "plain", Func: noop},
+	} {
+		if err := toolMgr.Register(def); err != nil {
+			t.Fatalf("Register() error = %v", err)
+		}
+	}
+	manager, err := NewManager(tempDir, toolMgr, registry.New(), &sandbox.NetworkPolicy{}, "openai")
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		wantErr string
+	}{
+		{"base", ""},
+		{"current", ""},
+		{"future", "assistant future is incompatible: tool search is version 1.2.0, 2.0.0 or later required"},
+		{"unpinned", "tool plain declares no version"},
+		{"invalid", `invalid min_tool_versions for search: "latest"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := manager.Get(tt.name)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+			if a != nil {
+				t.Errorf("Expected no assistant, got %+v", a)
+			}
+		})
+	}
+
+	a, err := manager.Get("current")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if a.MinToolVersions["search"] != "1.2.0" {
+		t.Errorf("Expected the child's minimum to win, got %v", a.MinToolVersions)
+	}
+}
+
+func TestAssistantToolNotAllowed(t *testing.T) {
+	a := &Assistant{Name: "writer", Tools: []string{"web_search"}, logger: slog.Default()}
+
+	// Refused before the tool is looked up
+	_, err := a.executeTool(context.Background(), "currentdatetime", "")
+	if !errors.Is(err, ErrToolNotAllowed) {
+		t.Fatalf("Expected ErrToolNotAllowed, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "assistant writer cannot use currentdatetime") {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	a.Tools = nil
+	if _, err := a.executeTool(context.Background(), "web_search", ""); !errors.Is(err, ErrToolNotAllowed) {
+		t.Errorf("Expected every tool refused without tools, got %v", err)
+	}
+}
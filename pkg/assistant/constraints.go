@@ -0,0 +1,316 @@
+package assistant
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+)
+
+// Constraints are rules an assistant's responses must follow, declared
+// under constraints in its front matter. Responses breaking them are sent
+// back with corrective instructions up to Retries times, then repaired
+// where possible.
+type Constraints struct {
+	MaxWords     int    `yaml:"max_words,omitempty"`      // Longest response in words, outside code blocks (0 = unlimited)
+	Language     string `yaml:"language,omitempty"`       // ISO 639-1 code of the language responses are written in
+	NoCodeBlocks bool   `yaml:"no_code_blocks,omitempty"` // Forbid fenced code blocks
+	BulletList   bool   `yaml:"bullet_list,omitempty"`    // Require responses to be a bullet list
+	Retries      int    `yaml:"retries,omitempty"`        // Corrective requests per command (0 = repair without asking again)
+}
+
+// languages names the languages responses can be constrained to
+var languages = map[string]string{
+	"ar": "Arabic", "de": "German", "el": "Greek", "en": "English",
+	"es": "Spanish", "fr": "French", "he": "Hebrew", "hi": "Hindi",
+	"it": "Italian", "ja": "Japanese", "ko": "Korean", "nl": "Dutch",
+	"pt": "Portuguese", "ru": "Russian", "zh": "Chinese",
+}
+
+// stopwords are frequent words telling apart languages in Latin script
+var stopwords = map[string][]string{
+	"en": {"the", "and", "is", "are", "of", "to", "that", "it", "with", "for", "this", "was", "be", "not", "you", "have"},
+	"es": {"el", "los", "las", "que", "y", "es", "por", "con", "para", "una", "se", "del", "lo", "como", "más", "pero"},
+	"fr": {"le", "les", "des", "et", "est", "une", "du", "pour", "pas", "dans", "qui", "sur", "avec", "ce", "sont", "au"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "zu", "den", "mit", "von", "sich", "ein", "eine", "auf", "für", "auch"},
+	"it": {"il", "di", "che", "è", "per", "non", "della", "sono", "gli", "si", "più", "anche", "nel", "alla", "questo", "ma"},
+	"pt": {"os", "que", "é", "do", "da", "em", "um", "uma", "para", "não", "com", "por", "mais", "dos", "ao", "também"},
+	"nl": {"het", "een", "en", "van", "is", "dat", "niet", "op", "te", "zijn", "met", "voor", "er", "ook", "maar", "bij"},
+}
+
+// validate checks the constraints read from front matter
+func (c Constraints) validate() error {
+	if c.MaxWords < 0 {
+		return fmt.Errorf("invalid max_words: %d", c.MaxWords)
+	}
+	if c.Retries < 0 {
+		return fmt.Errorf("invalid retries: %d", c.Retries)
+	}
+	if c.Language != "" && languages[c.Language] == "" {
+		codes := make([]string, 0, len(languages))
+		for code := range languages {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		return fmt.Errorf("unsupported language %q, expected one of %s", c.Language, strings.Join(codes, ", "))
+	}
+	return nil
+}
+
+// merge returns c with the rules child sets added or replaced
+func (c Constraints) merge(child Constraints) Constraints {
+	if child.MaxWords != 0 {
+		c.MaxWords = child.MaxWords
+	}
+	if child.Language != "" {
+		c.Language = child.Language
+	}
+	if child.Retries != 0 {
+		c.Retries = child.Retries
+	}
+	c.NoCodeBlocks = c.NoCodeBlocks || child.NoCodeBlocks
+	c.BulletList = c.BulletList || child.BulletList
+	return c
+}
+
+// rules describes the constraints as instructions for the model
+func (c Constraints) rules() []string {
+	var rules []string
+	if c.Language != "" {
+		rules = append(rules, fmt.Sprintf("Write in %s.", languages[c.Language]))
+	}
+	if c.MaxWords > 0 {
+		rules = append(rules, fmt.Sprintf("Use at most %d words.", c.MaxWords))
+	}
+	if c.NoCodeBlocks {
+		rules = append(rules, "Do not use code blocks.")
+	}
+	if c.BulletList {
+		rules = append(rules, "Answer with a bullet list only.")
+	}
+	return rules
+}
+
+// Check returns the rules response breaks
+func (c Constraints) Check(response string) []string {
+	var broken []string
+	prose := stripCodeBlocks(response)
+	if c.Language != "" {
+		if detected := detectLanguage(prose); detected != "" && detected != c.Language {
+			broken = append(broken, fmt.Sprintf("Write in %s, not %s.", languages[c.Language], languages[detected]))
+		}
+	}
+	if c.MaxWords > 0 {
+		if words := len(strings.Fields(prose)); words > c.MaxWords {
+			broken = append(broken, fmt.Sprintf("Use at most %d words, not %d.", c.MaxWords, words))
+		}
+	}
+	if c.NoCodeBlocks && hasCodeBlock(response) {
+		broken = append(broken, "Do not use code blocks.")
+	}
+	if c.BulletList && !isBulletList(response) {
+		broken = append(broken, "Answer with a bullet list only, one item per line starting with \"- \".")
+	}
+	return broken
+}
+
+// Repair fixes the rules of response that can be fixed without the model:
+// code blocks lose their fences, lines become list items, and long
+// responses are cut. The language cannot be repaired.
+func (c Constraints) Repair(response string) string {
+	if c.NoCodeBlocks {
+		var kept []string
+		for _, line := range strings.Split(response, "\n") {
+			if !isFence(line) {
+				kept = append(kept, line)
+			}
+		}
+		response = strings.Join(kept, "\n")
+	}
+	if c.BulletList && !isBulletList(response) {
+		lines := strings.Split(response, "\n")
+		for i, line := range lines {
+			if strings.TrimSpace(line) != "" && !isListLine(line) {
+				lines[i] = "- " + strings.TrimSpace(line)
+			}
+		}
+		response = strings.Join(lines, "\n")
+	}
+	if c.MaxWords > 0 {
+		if words := wordPattern.FindAllStringIndex(response, c.MaxWords+1); len(words) > c.MaxWords {
+			response = strings.TrimSpace(response[:words[c.MaxWords-1][1]]) + " …"
+		}
+	}
+	return response
+}
+
+// enforceConstraints asks again with corrective instructions while
+// response breaks the assistant's constraints and retries are left, then
+// repairs what is still broken. ask sends a conversation and returns the
+// response.
+func (a *Assistant) enforceConstraints(ctx context.Context, messages []provider.Message, response string, ask func([]provider.Message) (string, error)) (string, error) {
+	log := logging.FromContext(ctx, a.logger)
+	for attempt := 1; ; attempt++ {
+		broken := a.Constraints.Check(response)
+		if len(broken) == 0 {
+			return response, nil
+		}
+		if attempt > a.Constraints.Retries {
+			break
+		}
+		log.Debug("response breaks constraints, asking again",
+			"assistant", a.Name,
+			"rules", broken,
+			"attempt", attempt)
+		messages = append(messages,
+			provider.Message{Role: provider.RoleAssistant, Content: response},
+			provider.Message{Role: provider.RoleUser, Content: "Your response does not follow these rules:\n- " +
+				strings.Join(broken, "\n- ") + "\n\nRewrite it so that it does."})
+		var err error
+		if response, err = ask(messages); err != nil {
+			return "", err
+		}
+	}
+
+	response = a.Constraints.Repair(response)
+	if broken := a.Constraints.Check(response); len(broken) > 0 {
+		log.Warn("response breaks constraints", "assistant", a.Name, "rules", broken)
+	}
+	return response, nil
+}
+
+// wordPattern matches a word
+var wordPattern = regexp.MustCompile(`\S+`)
+
+// isFence reports whether line opens or closes a fenced code block
+func isFence(line string) bool {
+	line = strings.TrimSpace(line)
+	return strings.HasPrefix(line, "```") || strings.HasPrefix(line, "~~~")
+}
+
+// hasCodeBlock reports whether response holds a fenced code block
+func hasCodeBlock(response string) bool {
+	for _, line := range strings.Split(response, "\n") {
+		if isFence(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// stripCodeBlocks returns response without its fenced code blocks
+func stripCodeBlocks(response string) string {
+	var kept []string
+	inside := false
+	for _, line := range strings.Split(response, "\n") {
+		if isFence(line) {
+			inside = !inside
+			continue
+		}
+		if !inside {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// listItem matches the start of a bullet or numbered list item
+var listItem = regexp.MustCompile(`^\s*([-*+]|\d+[.)])\s`)
+
+// isListLine reports whether line belongs in a list: an item, a line
+// continuing one, or a heading
+func isListLine(line string) bool {
+	return listItem.MatchString(line) ||
+		strings.HasPrefix(line, "  ") || strings.HasPrefix(line, "\t") ||
+		strings.HasPrefix(strings.TrimSpace(line), "#")
+}
+
+// isBulletList reports whether response has list items and nothing but
+// lines belonging in a list
+func isBulletList(response string) bool {
+	items := 0
+	for _, line := range strings.Split(stripCodeBlocks(response), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if !isListLine(line) {
+			return false
+		}
+		if listItem.MatchString(line) {
+			items++
+		}
+	}
+	return items > 0
+}
+
+// detectLanguage guesses the language text is written in, by its script
+// and, for Latin script, its most frequent words. It returns "" when
+// unsure.
+func detectLanguage(text string) string {
+	scripts := make(map[string]int)
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r):
+			scripts["ja"]++
+		case unicode.Is(unicode.Han, r):
+			scripts["zh"]++
+		case unicode.Is(unicode.Hangul, r):
+			scripts["ko"]++
+		case unicode.Is(unicode.Cyrillic, r):
+			scripts["ru"]++
+		case unicode.Is(unicode.Greek, r):
+			scripts["el"]++
+		case unicode.Is(unicode.Arabic, r):
+			scripts["ar"]++
+		case unicode.Is(unicode.Hebrew, r):
+			scripts["he"]++
+		case unicode.Is(unicode.Devanagari, r):
+			scripts["hi"]++
+		}
+	}
+	if letters == 0 {
+		return ""
+	}
+	if scripts["ja"] > 0 && scripts["ja"]+scripts["zh"] > letters/2 {
+		return "ja" // Japanese mixes kana with Han characters
+	}
+	for code, n := range scripts {
+		if n > letters/2 {
+			return code
+		}
+	}
+
+	counts := make(map[string]int)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		for code, words := range stopwords {
+			for _, w := range words {
+				if w == word {
+					counts[code]++
+				}
+			}
+		}
+	}
+	best, bestCount, second := "", 0, 0
+	for code, n := range counts {
+		switch {
+		case n > bestCount:
+			best, bestCount, second = code, n, bestCount
+		case n > second:
+			second = n
+		}
+	}
+	if bestCount < 3 || bestCount <= second {
+		return ""
+	}
+	return best
+}
@@ -0,0 +1,238 @@
+package assistant
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+	"github.com/butter-bot-machines/skylark/pkg/provider/registry"
+	"github.com/butter-bot-machines/skylark/pkg/sandbox"
+	"github.com/butter-bot-machines/skylark/pkg/tool"
+)
+
+func TestConstraintsCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		constraints Constraints
+		response    string
+		want        []string
+	}{
+		{
+			name:        "within limits",
+			constraints: Constraints{MaxWords: 5, Language: "en", NoCodeBlocks: true},
+			response:    "This is the answer.",
+		},
+		{
+			name:        "too long",
+			constraints: Constraints{MaxWords: 3},
+			response:    "one two three four",
+			want:        []string{"Use at most 3 words, not 4."},
+		},
+		{
+			name:        "code is not counted",
+			constraints: Constraints{MaxWords: 2},
+			response:    "Run this:\n```sh\nmake all install clean\n```",
+		},
+		{
+			name:        "code block",
+			constraints: Constraints{NoCodeBlocks: true},
+			response:    "Use\n```\nls\n```",
+			want:        []string{"Do not use code blocks."},
+		},
+		{
+			name:        "wrong language",
+			constraints: Constraints{Language: "de"},
+			response:    "The report is ready and it covers the plans for this year.",
+			want:        []string{"Write in German, not English."},
+		},
+		{
+			name:        "other script",
+			constraints: Constraints{Language: "en"},
+			response:    "Отчёт готов и охватывает планы на этот год.",
+			want:        []string{"Write in English, not Russian."},
+		},
+		{
+			name:        "bullet list",
+			constraints: Constraints{BulletList: true},
+			response:    "## Steps\n- first\n  details\n1. second",
+		},
+		{
+			name:        "not a bullet list",
+			constraints: Constraints{BulletList: true},
+			response:    "Here are the steps:\n- first",
+			want:        []string{"Answer with a bullet list only, one item per line starting with \"- \"."},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.constraints.Check(tt.response); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestConstraintsRepair(t *testing.T) {
+	tests := []struct {
+		name        string
+		constraints Constraints
+		response    string
+		want        string
+	}{
+		{
+			name:        "cut",
+			constraints: Constraints{MaxWords: 3},
+			response:    "one two\nthree four five",
+			want:        "one two\nthree …",
+		},
+		{
+			name:        "fences removed",
+			constraints: Constraints{NoCodeBlocks: true},
+			response:    "Run\n```sh\nmake\n```",
+			want:        "Run\nmake",
+		},
+		{
+			name:        "lines listed",
+			constraints: Constraints{BulletList: true},
+			response:    "First point\n\n- second point",
+			want:        "- First point\n\n- second point",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.constraints.Repair(tt.response); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"The meeting is on Monday and the notes are in the shared folder.", "en"},
+		{"La reunión es el lunes y las notas están en la carpeta para todos.", "es"},
+		{"Die Besprechung ist am Montag und die Notizen sind auf dem Laufwerk.", "de"},
+		{"La réunion est lundi et les notes sont dans le dossier partagé.", "fr"},
+		{"会議は月曜日です。メモは共有フォルダにあります。", "ja"},
+		{"OK", ""},
+	}
+	for _, tt := range tests {
+		if got := detectLanguage(tt.text); got != tt.want {
+			t.Errorf("detectLanguage(%q): expected %q, got %q", tt.text, tt.want, got)
+		}
+	}
+}
+
+func TestAssistantConstraints(t *testing.T) {
+	tests := []struct {
+		name        string
+		constraints Constraints
+		responses   []string
+		want        string
+		wantSends   int
+	}{
+		{
+			name:        "corrected on retry",
+			constraints: Constraints{MaxWords: 3, Retries: 1},
+			responses:   []string{"far too many words here", "short enough"},
+			want:        "short enough",
+			wantSends:   2,
+		},
+		{
+			name:        "repaired after retries",
+			constraints: Constraints{MaxWords: 3, Retries: 1},
+			responses:   []string{"far too many words here", "still too many words"},
+			want:        "still too many …",
+			wantSends:   2,
+		},
+		{
+			name:        "repaired without retries",
+			constraints: Constraints{NoCodeBlocks: true},
+			responses:   []string{"```\nls\n```"},
+			want:        "ls",
+			wantSends:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &testProvider{}
+			for _, r := range tt.responses {
+				p.responses = append(p.responses, provider.Response{Content: r})
+			}
+			reg := registry.New()
+			reg.Register("openai", func(model string) (provider.Provider, error) { return p, nil })
+			a := &Assistant{
+				Name:            "test",
+				Model:           "gpt-4",
+				Prompt:          "You answer briefly.",
+				Constraints:     tt.constraints,
+				providers:       reg,
+				defaultProvider: "openai",
+				logger:          logging.Default(),
+			}
+
+			got, err := a.Process(&parser.Command{Text: "Summarize"})
+			if err != nil {
+				t.Fatalf("Process() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+			if len(p.requests) != tt.wantSends {
+				t.Fatalf("Expected %d requests, got %d", tt.wantSends, len(p.requests))
+			}
+			if system := p.requests[0][0].Content; !strings.Contains(system, "Response rules:") {
+				t.Errorf("Expected the rules in the system prompt, got %q", system)
+			}
+			if tt.wantSends > 1 {
+				retry := p.requests[1]
+				if last := retry[len(retry)-1].Content; !strings.Contains(last, "does not follow these rules") {
+					t.Errorf("Expected corrective instructions, got %q", last)
+				}
+			}
+		})
+	}
+}
+
+func TestAssistantInvalidConstraints(t *testing.T) {
+	tempDir := t.TempDir()
+	prompts := map[string]string{
+		"klingon":  "---\nmodel: gpt-4\nconstraints:\n  language: tlh\n---\nQapla'\n",
+		"negative": "---\nmodel: gpt-4\nconstraints:\n  max_words: -1\n---\nShort.\n",
+	}
+	for name, prompt := range prompts {
+		dir := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "prompt.md"), []byte(prompt), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	toolMgr, err := tool.NewManager(filepath.Join(tempDir, "tools"))
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer toolMgr.Close()
+	m, err := NewManager(tempDir, toolMgr, registry.New(), &sandbox.NetworkPolicy{}, "openai")
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	for name := range prompts {
+		if _, err := m.Get(name); err == nil || !strings.Contains(err.Error(), "invalid constraints") {
+			t.Errorf("Expected invalid constraints error for %s, got %v", name, err)
+		}
+	}
+}
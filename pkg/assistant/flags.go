@@ -0,0 +1,35 @@
+package assistant
+
+import (
+	"strconv"
+
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+)
+
+// forCommand returns the assistant as the flags of cmd adjust it, for that
+// command only
+func (a *Assistant) forCommand(cmd *parser.Command) *Assistant {
+	if !cmd.Flag(parser.FlagMaxWords) && !cmd.Flag(parser.FlagNoTools) {
+		return a
+	}
+	adjusted := *a
+	if value, ok := cmd.Option(parser.FlagMaxWords); ok {
+		adjusted.Constraints.MaxWords, _ = strconv.Atoi(value)
+	}
+	if cmd.Flag(parser.FlagNoTools) {
+		adjusted.Tools = nil
+	}
+	return &adjusted
+}
+
+// applyFlags sets the request options the flags of cmd ask for. The
+// parser checked their values.
+func applyFlags(opts *provider.RequestOptions, cmd *parser.Command) {
+	if value, ok := cmd.Option(parser.FlagTemperature); ok {
+		opts.Temperature, _ = strconv.ParseFloat(value, 64)
+	}
+	if value, ok := cmd.Option(parser.FlagMaxTokens); ok {
+		opts.MaxTokens, _ = strconv.Atoi(value)
+	}
+}
@@ -0,0 +1,123 @@
+package assistant
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+	"github.com/butter-bot-machines/skylark/pkg/provider/registry"
+	"github.com/butter-bot-machines/skylark/pkg/sandbox"
+	"github.com/butter-bot-machines/skylark/pkg/tool"
+)
+
+// optionsProvider answers every request and records its messages and
+// options
+type optionsProvider struct {
+	messages [][]provider.Message
+	opts     []provider.RequestOptions
+}
+
+func (p *optionsProvider) Send(ctx context.Context, messages []provider.Message, opts *provider.RequestOptions) (*provider.Response, error) {
+	p.messages = append(p.messages, messages)
+	p.opts = append(p.opts, *opts)
+	return &provider.Response{Content: "one two three four five"}, nil
+}
+
+func (p *optionsProvider) Close() error {
+	return nil
+}
+
+func TestAssistantFlags(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tempDir, "writer"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	prompt := "---\nmodel: gpt-4\ntools: [web_search]\n---\nYou write.\n"
+	if err := os.WriteFile(filepath.Join(tempDir, "writer", "prompt.md"), []byte(prompt), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &optionsProvider{}
+	var models []string
+	reg := registry.New()
+	reg.Register("openai", func(model string) (provider.Provider, error) {
+		models = append(models, model)
+		return p, nil
+	})
+	toolMgr, err := tool.NewManager(filepath.Join(tempDir, "tools"))
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer toolMgr.Close()
+	m, err := NewManager(tempDir, toolMgr, reg, &sandbox.NetworkPolicy{}, "openai")
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	a, err := m.Get("writer")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		command     string
+		model       string
+		temperature float64
+		maxTokens   int
+		tools       bool
+		response    string
+	}{
+		{
+			name:        "defaults",
+			command:     "!writer draft",
+			model:       "gpt-4",
+			temperature: 0.7,
+			maxTokens:   2000,
+			tools:       true,
+			response:    "one two three four five",
+		},
+		{
+			name:        "flags",
+			command:     "!writer --model gpt-3.5-turbo --max-words 3 --no-tools --temperature 0.2 --max-tokens 50 draft",
+			model:       "gpt-3.5-turbo",
+			temperature: 0.2,
+			maxTokens:   50,
+			response:    "one two three …",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := parser.New().ParseCommand(tt.command)
+			if err != nil {
+				t.Fatalf("ParseCommand() error = %v", err)
+			}
+			p.messages, p.opts, models = nil, nil, nil
+			response, err := a.Process(cmd)
+			if err != nil {
+				t.Fatalf("Process() error = %v", err)
+			}
+			if response != tt.response {
+				t.Errorf("Expected response %q, got %q", tt.response, response)
+			}
+			if len(models) != 1 || models[0] != tt.model {
+				t.Errorf("Expected model %s, got %v", tt.model, models)
+			}
+			opts := p.opts[0]
+			if opts.Temperature != tt.temperature || opts.MaxTokens != tt.maxTokens {
+				t.Errorf("Expected temperature %v and max tokens %d, got %+v", tt.temperature, tt.maxTokens, opts)
+			}
+			if system := p.messages[0][0].Content; strings.Contains(system, "web_search") != tt.tools {
+				t.Errorf("Expected tools offered: %v, got system prompt %q", tt.tools, system)
+			}
+		})
+	}
+
+	// Flags do not outlast their command
+	if a.Constraints.MaxWords != 0 || len(a.Tools) != 1 {
+		t.Errorf("Expected the assistant unchanged, got %+v", a.Constraints)
+	}
+}
@@ -0,0 +1,138 @@
+package assistant
+
+import (
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/butter-bot-machines/skylark/internal/builtins"
+	"github.com/butter-bot-machines/skylark/pkg/fetch"
+	"gopkg.in/yaml.v3"
+)
+
+// ManifestFile names the optional manifest of an assistant package, next
+// to its prompt.md
+const ManifestFile = "assistant.yaml"
+
+// Manifest describes an assistant package. A package is a directory, or
+// git repository, holding a prompt.md, optionally a knowledge/ directory,
+// and the sources of tools it bundles under tools/<name>/main.go.
+type Manifest struct {
+	Name  string   `yaml:"name"`  // Installed name (default: the directory or repository name)
+	Tools []string `yaml:"tools"` // Tools needed beyond those of the front matter, such as ones its prompt tells it to call
+}
+
+// InstallOptions controls where and how a package is installed
+type InstallOptions struct {
+	AssistantsDir string // Assistants are installed here, one directory each
+	ToolsDir      string // Bundled tools are installed here
+	Name          string // Replaces the package's name
+	Force         bool   // Replace an installed assistant and tools of the same names
+}
+
+// Installed describes an installed assistant
+type Installed struct {
+	Name  string
+	Path  string
+	Model string   // Model of its front matter, empty when it inherits one
+	Tools []string // Tools installed from the package
+}
+
+// Install installs the assistant package at source, a directory or git
+// URL. Every tool the assistant needs must be bundled with it, installed
+// in the project or built in; otherwise nothing is installed.
+func Install(source string, opts InstallOptions) (*Installed, error) {
+	pkg, err := fetch.Fetch(source, "")
+	if err != nil {
+		return nil, err
+	}
+	defer pkg.Close()
+	dir, name := pkg.Dir, pkg.Name
+
+	// Read and validate the package
+	manifest := Manifest{}
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err == nil {
+		if err := yaml.Unmarshal(data, &manifest); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", ManifestFile, err)
+		}
+	} else if !errors.Is(err, iofs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read %s: %w", ManifestFile, err)
+	}
+	if manifest.Name != "" {
+		name = manifest.Name
+	}
+	if opts.Name != "" {
+		name = opts.Name
+	}
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("invalid assistant name: %q", name)
+	}
+	a, err := (&Manager{basePath: filepath.Dir(dir)}).readAssistant(filepath.Base(dir))
+	if err != nil {
+		return nil, err
+	}
+
+	target := filepath.Join(opts.AssistantsDir, name)
+	if _, err := os.Stat(target); err == nil && !opts.Force {
+		return nil, fmt.Errorf("assistant %s is already installed", name)
+	}
+	if a.Extends != "" {
+		if _, err := os.Stat(filepath.Join(opts.AssistantsDir, a.Extends, "prompt.md")); err != nil {
+			return nil, fmt.Errorf("assistant %s extends %s, which is not installed", name, a.Extends)
+		}
+	}
+
+	// Resolve the tools it needs
+	var bundled, missing []string
+	for _, tool := range append(append([]string(nil), a.Tools...), manifest.Tools...) {
+		switch {
+		case contains(bundled, tool) || contains(missing, tool):
+		case fileExists(filepath.Join(dir, "tools", tool, "main.go")):
+			if opts.Force || !fileExists(filepath.Join(opts.ToolsDir, tool, "main.go")) {
+				bundled = append(bundled, tool)
+			}
+		case fileExists(filepath.Join(opts.ToolsDir, tool, "main.go")):
+		case builtinTool(tool):
+		default:
+			missing = append(missing, tool)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("assistant %s needs tools that are not installed: %s", name, strings.Join(missing, ", "))
+	}
+
+	// Copy the assistant without its tools, then the tools
+	if err := os.RemoveAll(target); err != nil {
+		return nil, fmt.Errorf("failed to remove installed assistant: %w", err)
+	}
+	if err := pkg.CopyTo(target, func(name string) bool { return name == "tools" }); err != nil {
+		return nil, fmt.Errorf("failed to install assistant: %w", err)
+	}
+	for _, tool := range bundled {
+		toolTarget := filepath.Join(opts.ToolsDir, tool)
+		if err := os.RemoveAll(toolTarget); err != nil {
+			return nil, fmt.Errorf("failed to remove installed tool %s: %w", tool, err)
+		}
+		if err := fetch.CopyDir(filepath.Join(dir, "tools", tool), toolTarget, nil); err != nil {
+			return nil, fmt.Errorf("failed to install tool %s: %w", tool, err)
+		}
+	}
+
+	return &Installed{Name: name, Path: target, Model: a.Model, Tools: bundled}, nil
+}
+
+// builtinTool reports whether name is a tool every project has
+func builtinTool(name string) bool {
+	_, err := builtins.GetToolSource(name)
+	return err == nil
+}
+
+// fileExists reports whether path is an existing file
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
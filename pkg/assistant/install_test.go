@@ -0,0 +1,153 @@
+package assistant
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFiles creates files under dir from a map of relative paths to content
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func TestInstall(t *testing.T) {
+	pkg := filepath.Join(t.TempDir(), "researcher")
+	writeFiles(t, pkg, map[string]string{
+		"prompt.md":                "---\nmodel: gpt-4\ntools: [web_search, currentdatetime]\n---\nYou research.",
+		"assistant.yaml":           "tools: [summarize]\n",
+		"knowledge/sources.md":     "# Sources",
+		"tools/web_search/main.go": "package main",
+	})
+	project := t.TempDir()
+	opts := InstallOptions{
+		AssistantsDir: filepath.Join(project, "assistants"),
+		ToolsDir:      filepath.Join(project, "tools"),
+	}
+
+	// summarize is neither bundled, installed nor built in
+	_, err := Install(pkg, opts)
+	if err == nil || !strings.Contains(err.Error(), "not installed: summarize") {
+		t.Fatalf("Expected missing tool error, got %v", err)
+	}
+	if _, err := os.Stat(opts.AssistantsDir); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing installed, got %v", err)
+	}
+
+	writeFiles(t, opts.ToolsDir, map[string]string{"summarize/main.go": "package main"})
+	installed, err := Install(pkg, opts)
+	if err != nil {
+		t.Fatalf("Failed to install: %v", err)
+	}
+	want := &Installed{
+		Name:  "researcher",
+		Path:  filepath.Join(opts.AssistantsDir, "researcher"),
+		Model: "gpt-4",
+		Tools: []string{"web_search"},
+	}
+	if !reflect.DeepEqual(installed, want) {
+		t.Errorf("Expected %+v, got %+v", want, installed)
+	}
+	for _, path := range []string{
+		filepath.Join(installed.Path, "prompt.md"),
+		filepath.Join(installed.Path, "knowledge", "sources.md"),
+		filepath.Join(opts.ToolsDir, "web_search", "main.go"),
+	} {
+		if !fileExists(path) {
+			t.Errorf("Expected %s to be installed", path)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(installed.Path, "tools")); !os.IsNotExist(err) {
+		t.Errorf("Expected tools to be left out of the assistant, got %v", err)
+	}
+
+	// Installing again needs --force, or another name
+	if _, err := Install(pkg, opts); err == nil || !strings.Contains(err.Error(), "already installed") {
+		t.Errorf("Expected already installed error, got %v", err)
+	}
+	opts.Name = "scholar"
+	if installed, err := Install(pkg, opts); err != nil || installed.Name != "scholar" || len(installed.Tools) != 0 {
+		t.Errorf("Expected scholar installed with the existing tools, got %+v, %v", installed, err)
+	}
+	opts.Name, opts.Force = "", true
+	if _, err := Install(pkg, opts); err != nil {
+		t.Errorf("Expected forced install to succeed, got %v", err)
+	}
+}
+
+func TestInstallErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"missing prompt", map[string]string{"assistant.yaml": "name: x\n"}, "failed to read prompt.md"},
+		{"invalid manifest", map[string]string{"prompt.md": "---\n---\nHi", "assistant.yaml": "tools: {"}, "invalid assistant.yaml"},
+		{"invalid name", map[string]string{"prompt.md": "---\n---\nHi", "assistant.yaml": "name: ../x\n"}, "invalid assistant name"},
+		{"missing parent", map[string]string{"prompt.md": "---\nextends: base\n---\nHi"}, "extends base, which is not installed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pkg := filepath.Join(t.TempDir(), "pkg")
+			writeFiles(t, pkg, tt.files)
+			project := t.TempDir()
+			_, err := Install(pkg, InstallOptions{
+				AssistantsDir: filepath.Join(project, "assistants"),
+				ToolsDir:      filepath.Join(project, "tools"),
+			})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+
+	if _, err := Install("no/such/package", InstallOptions{}); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+}
+
+func TestInstallFromGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	repo := filepath.Join(t.TempDir(), "writer.git")
+	writeFiles(t, repo, map[string]string{"prompt.md": "---\nmodel: gpt-4\n---\nYou write."})
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"add", "."},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "-m", "Add writer"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %s: %v", args, output, err)
+		}
+	}
+
+	project := t.TempDir()
+	installed, err := Install("file://"+repo, InstallOptions{
+		AssistantsDir: filepath.Join(project, "assistants"),
+		ToolsDir:      filepath.Join(project, "tools"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to install: %v", err)
+	}
+	if installed.Name != "writer" {
+		t.Errorf("Expected name writer, got %s", installed.Name)
+	}
+	if _, err := os.Stat(filepath.Join(installed.Path, ".git")); !os.IsNotExist(err) {
+		t.Errorf("Expected the repository metadata to be left out, got %v", err)
+	}
+}
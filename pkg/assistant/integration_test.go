@@ -27,6 +27,7 @@ func TestAssistantProviderIntegration(t *testing.T) {
 		command      string
 		responses    []provider.Response
 		toolResult   string
+		maxRounds    int
 		wantExecuted bool
 		wantRequests int
 		wantResponse string
@@ -66,6 +67,77 @@ func TestAssistantProviderIntegration(t *testing.T) {
 			wantRequests: 2,
 			wantResponse: "The result is success",
 		},
+		{
+			name:    "tool call rounds",
+			command: "run test twice",
+			responses: []provider.Response{
+				{
+					Content: "Let me run that",
+					ToolCalls: []provider.ToolCall{
+						{
+							ID: "call_1",
+							Function: provider.Function{
+								Name:      "test-mock",
+								Arguments: `{}`,
+							},
+						},
+					},
+				},
+				{
+					Content: "Let me run that",
+					ToolCalls: []provider.ToolCall{
+						{
+							ID: "call_2",
+							Function: provider.Function{
+								Name:      "test-mock",
+								Arguments: `{}`,
+							},
+						},
+					},
+				},
+				{Content: "Both runs succeeded"},
+			},
+			toolResult:   `{"result":"success"}`,
+			wantExecuted: true,
+			wantRequests: 3,
+			wantResponse: "Both runs succeeded",
+		},
+		{
+			name:    "tool round limit",
+			command: "run test forever",
+			responses: []provider.Response{
+				{
+					Content: "Let me run that",
+					ToolCalls: []provider.ToolCall{
+						{
+							ID: "call_1",
+							Function: provider.Function{
+								Name:      "test-mock",
+								Arguments: `{}`,
+							},
+						},
+					},
+				},
+				{
+					Content: "Let me run that",
+					ToolCalls: []provider.ToolCall{
+						{
+							ID: "call_2",
+							Function: provider.Function{
+								Name:      "test-mock",
+								Arguments: `{}`,
+							},
+						},
+					},
+				},
+				{Content: "Never reached"},
+			},
+			toolResult:   `{"result":"success"}`,
+			maxRounds:    1,
+			wantExecuted: true,
+			wantRequests: 2,
+			wantError:    true,
+		},
 		{
 			name:    "provider error",
 			command: "break things",
@@ -80,6 +152,26 @@ func TestAssistantProviderIntegration(t *testing.T) {
 			command:   "use nonexistent test input",
 			wantError: true,
 		},
+		{
+			name:    "ungranted tool call",
+			command: "what time is it",
+			responses: []provider.Response{
+				{
+					ToolCalls: []provider.ToolCall{
+						{
+							ID: "call_1",
+							Function: provider.Function{
+								Name:      "currentdatetime",
+								Arguments: `{}`,
+							},
+						},
+					},
+				},
+				{Content: "I cannot tell the time"},
+			},
+			wantRequests: 2,
+			wantResponse: "I cannot tell the time",
+		},
 		{
 			name:    "tool execution error",
 			command: "use test-mock error",
@@ -131,6 +223,29 @@ func TestAssistantProviderIntegration(t *testing.T) {
 			wantRequests: 1,
 			wantResponse: "The result is success",
 		},
+		{
+			name:    "structured tool error",
+			command: "run test badly",
+			responses: []provider.Response{
+				{
+					Content: "Let me run that",
+					ToolCalls: []provider.ToolCall{
+						{
+							ID: "call_1",
+							Function: provider.Function{
+								Name:      "test-mock",
+								Arguments: `{}`,
+							},
+						},
+					},
+				},
+				{Content: "The tool needs a mode"},
+			},
+			toolResult:   `{"error":{"code":"bad_input","message":"mode required"}}`,
+			wantExecuted: true,
+			wantRequests: 2,
+			wantResponse: "The tool needs a mode",
+		},
 		{
 			name:    "context size limit",
 			command: "use test-mock " + strings.Repeat("x", 8000), // Exceed context limit
@@ -274,6 +389,7 @@ func main() {
 				Name:            "test",
 				Tools:           []string{"test-mock"},
 				Model:           "test:model",
+				MaxToolRounds:   tt.maxRounds,
 				toolMgr:         toolMgr,
 				providers:       reg,
 				defaultProvider: "test",
@@ -310,7 +426,8 @@ func main() {
 
 			// Verify context in provider requests
 			if tt.name == "tool result in context" && len(testProv.requests) > 0 {
-				request := testProv.requests[0]
+				messages := testProv.requests[0]
+				request := messages[len(messages)-1].Content
 				normalized := strings.Map(func(r rune) rune {
 					if r == ' ' || r == '\n' {
 						return -1
@@ -322,6 +439,39 @@ func main() {
 					t.Error("Tool result not found in provider context")
 				}
 			}
+
+			// Structured tool errors are sent to the model as the result
+			if tt.name == "structured tool error" && len(testProv.requests) == 2 {
+				messages := testProv.requests[1]
+				result := messages[len(messages)-1]
+				if result.Role != provider.RoleTool || result.Content != `{"error":{"code":"bad_input","message":"mode required"}}` {
+					t.Errorf("Expected the structured error as the tool result, got %+v", result)
+				}
+			}
+
+			// Calls of tools the assistant lacks are refused, telling the model
+			if tt.name == "ungranted tool call" && len(testProv.requests) == 2 {
+				messages := testProv.requests[1]
+				result := messages[len(messages)-1]
+				if result.Role != provider.RoleTool || !strings.Contains(result.Content, `"code":"not_allowed"`) || !strings.Contains(result.Content, "assistant test cannot use currentdatetime") {
+					t.Errorf("Expected the call refused, got %+v", result)
+				}
+			}
+
+			// Tool calls are answered with tool messages after the call
+			if tt.name == "provider tool call" && len(testProv.requests) == 2 {
+				messages := testProv.requests[1]
+				if len(messages) < 2 {
+					t.Fatalf("Expected the tool call and its result, got %+v", messages)
+				}
+				call, result := messages[len(messages)-2], messages[len(messages)-1]
+				if call.Role != provider.RoleAssistant || len(call.ToolCalls) != 1 || call.ToolCalls[0].ID != "call_1" {
+					t.Errorf("Expected the assistant's tool call, got %+v", call)
+				}
+				if result.Role != provider.RoleTool || result.ToolCallID != "call_1" || !strings.Contains(result.Content, "success") {
+					t.Errorf("Expected the tool result for call_1, got %+v", result)
+				}
+			}
 		})
 	}
 }
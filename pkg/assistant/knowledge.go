@@ -0,0 +1,61 @@
+package assistant
+
+import (
+	"path/filepath"
+
+	"github.com/butter-bot-machines/skylark/pkg/knowledge"
+)
+
+// maxKnowledgeChunks is how many passages of its knowledge an assistant
+// sends with each command
+const maxKnowledgeChunks = 3
+
+// KnowledgeDir returns the knowledge directory of the assistant name in
+// assistantsDir
+func KnowledgeDir(assistantsDir, name string) string {
+	return filepath.Join(assistantsDir, name, "knowledge")
+}
+
+// knowledgeBase returns the indexed knowledge of an assistant, indexing it
+// on first use. Versions of an assistant share its knowledge. The caller
+// holds m.mu.
+func (m *Manager) knowledgeBase(name string) *knowledge.Base {
+	name, _, _ = splitVersion(name)
+	if b, ok := m.knowledge[name]; ok {
+		return b
+	}
+	b, err := knowledge.Open(KnowledgeDir(m.basePath, name))
+	if err != nil {
+		m.logger.Warn("knowledge not indexed", "assistant", name, "error", err)
+		return nil
+	}
+	if n := b.Len(); n > 0 {
+		m.logger.Debug("indexed knowledge", "assistant", name, "chunks", n)
+	}
+	m.knowledge[name] = b
+	return b
+}
+
+// RefreshKnowledge re-indexes the files of an assistant's knowledge
+// directory that changed and returns their paths, relative to that
+// directory. Knowledge not indexed yet is indexed, and all of its files
+// are returned.
+func (m *Manager) RefreshKnowledge(name string) ([]string, error) {
+	m.mu.Lock()
+	b, indexed := m.knowledge[name]
+	if !indexed {
+		b = m.knowledgeBase(name)
+	}
+	m.mu.Unlock()
+	if !indexed {
+		return b.Files(), nil
+	}
+	changed, err := b.Refresh()
+	if err != nil {
+		return nil, err
+	}
+	if len(changed) > 0 {
+		m.logger.Info("refreshed knowledge", "assistant", name, "files", changed, "chunks", b.Len())
+	}
+	return changed, nil
+}
@@ -0,0 +1,73 @@
+package assistant
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+	"github.com/butter-bot-machines/skylark/pkg/provider/registry"
+	"github.com/butter-bot-machines/skylark/pkg/sandbox"
+	"github.com/butter-bot-machines/skylark/pkg/tool"
+)
+
+func TestAssistantKnowledge(t *testing.T) {
+	tempDir := t.TempDir()
+	dir := filepath.Join(tempDir, "support")
+	knowledgeDir := KnowledgeDir(tempDir, "support")
+	if err := os.MkdirAll(knowledgeDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "prompt.md"), []byte("---\nmodel: gpt-4\n---\nYou answer customers.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	faq := filepath.Join(knowledgeDir, "faq.md")
+	if err := os.WriteFile(faq, []byte("# Refunds\nRefunds are granted within 30 days.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &testProvider{responses: []provider.Response{{Content: "Within 30 days."}, {Content: "Within 60 days."}}}
+	reg := registry.New()
+	reg.Register("openai", func(model string) (provider.Provider, error) { return p, nil })
+	toolMgr, err := tool.NewManager(filepath.Join(tempDir, "tools"))
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer toolMgr.Close()
+	m, err := NewManager(tempDir, toolMgr, reg, &sandbox.NetworkPolicy{}, "openai")
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	a, err := m.Get("support")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+
+	if _, err := a.Process(&parser.Command{Text: "When are refunds granted?"}); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	request := p.requests[0][len(p.requests[0])-1].Content
+	if !strings.Contains(request, "Knowledge:\n## faq.md > Refunds\nRefunds are granted within 30 days.") {
+		t.Errorf("Expected the relevant knowledge in the request, got %q", request)
+	}
+
+	// Changed files are re-indexed
+	if err := os.WriteFile(faq, []byte("# Refunds\nRefunds are granted within 60 days.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := m.RefreshKnowledge("support")
+	if err != nil {
+		t.Fatalf("RefreshKnowledge() error = %v", err)
+	}
+	if len(changed) != 1 || changed[0] != "faq.md" {
+		t.Errorf("Expected faq.md to change, got %v", changed)
+	}
+	if _, err := a.Process(&parser.Command{Text: "When are refunds granted?"}); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if request := p.requests[1][len(p.requests[1])-1].Content; !strings.Contains(request, "within 60 days") {
+		t.Errorf("Expected the refreshed knowledge in the request, got %q", request)
+	}
+}
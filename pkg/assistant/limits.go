@@ -0,0 +1,53 @@
+package assistant
+
+import (
+	"context"
+	"sync"
+)
+
+// toolLimiter caps how many calls of each tool run at once across the
+// assistants of a manager. A nil limiter places no limit.
+type toolLimiter struct {
+	mu    sync.Mutex
+	slots map[string]chan struct{} // One slot per call allowed to run
+}
+
+// newToolLimiter creates a limiter with no limits set
+func newToolLimiter() *toolLimiter {
+	return &toolLimiter{slots: make(map[string]chan struct{})}
+}
+
+// set replaces the limits by tool name. Calls already running keep the
+// slot they hold.
+func (l *toolLimiter) set(limits map[string]int) {
+	slots := make(map[string]chan struct{}, len(limits))
+	for name, n := range limits {
+		if n > 0 {
+			slots[name] = make(chan struct{}, n)
+		}
+	}
+	l.mu.Lock()
+	l.slots = slots
+	l.mu.Unlock()
+}
+
+// acquire waits until a call of name may run or ctx is done, returning a
+// function that releases the call's slot
+func (l *toolLimiter) acquire(ctx context.Context, name string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	l.mu.Lock()
+	slots := l.slots[name]
+	l.mu.Unlock()
+	if slots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,45 @@
+package assistant
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestToolLimiter(t *testing.T) {
+	l := newToolLimiter()
+	l.set(map[string]int{"web_search": 1, "currentdatetime": 0})
+
+	release, err := l.acquire(context.Background(), "web_search")
+	if err != nil {
+		t.Fatalf("acquire() error = %v", err)
+	}
+
+	// A second call waits for the first
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(ctx, "web_search"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the second call to wait, got %v", err)
+	}
+
+	// Unlimited tools never wait
+	for i := 0; i < 3; i++ {
+		if _, err := l.acquire(ctx, "currentdatetime"); err != nil {
+			t.Errorf("Expected currentdatetime to be unlimited, got %v", err)
+		}
+	}
+
+	release()
+	again, err := l.acquire(context.Background(), "web_search")
+	if err != nil {
+		t.Fatalf("Expected a slot after release, got %v", err)
+	}
+	again()
+
+	// A nil limiter places no limit
+	var none *toolLimiter
+	if _, err := none.acquire(context.Background(), "web_search"); err != nil {
+		t.Errorf("Expected no limit, got %v", err)
+	}
+}
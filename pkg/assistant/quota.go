@@ -0,0 +1,154 @@
+package assistant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/security"
+	"github.com/butter-bot-machines/skylark/pkg/security/types"
+	"github.com/butter-bot-machines/skylark/pkg/state"
+	"github.com/butter-bot-machines/skylark/pkg/timing"
+)
+
+// ErrToolQuotaExceeded is returned for tool calls over one of the tool's
+// limits
+var ErrToolQuotaExceeded = errors.New("tool quota exceeded")
+
+// quotaFile holds the tool calls of the day, relative to the configuration
+// directory
+var quotaFile = filepath.Join(state.Dir, "tool_calls.json")
+
+// QuotaOptions configures how tool quotas are kept
+type QuotaOptions struct {
+	ConfigDir string               // Calls of the day are persisted under it when set
+	AuditLog  security.AuditLogger // Records refused calls (optional)
+	Clock     timing.Clock         // Optional, defaults to the system clock
+}
+
+// toolQuotas counts tool calls against the limits of each tool across the
+// assistants of a manager. A nil toolQuotas places no limit.
+type toolQuotas struct {
+	mu       sync.Mutex
+	limits   map[string]config.ToolLimits
+	clock    timing.Clock
+	auditLog security.AuditLogger
+	recent   map[string][]time.Time // Start of each call of the last minute
+	day      *state.Daily           // Calls of each tool today
+}
+
+// newToolQuotas creates quotas with no limits set
+func newToolQuotas() *toolQuotas {
+	day, _ := state.LoadDaily("")
+	return &toolQuotas{clock: timing.New(), recent: make(map[string][]time.Time), day: day}
+}
+
+// set replaces the limits by tool name, loading the calls of the day
+func (q *toolQuotas) set(limits map[string]config.ToolLimits, opts QuotaOptions) error {
+	path := ""
+	if opts.ConfigDir != "" {
+		path = filepath.Join(opts.ConfigDir, quotaFile)
+	}
+	day, err := state.LoadDaily(path)
+	if err != nil {
+		return fmt.Errorf("failed to load tool calls: %w", err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.limits = limits
+	q.day = day
+	q.auditLog = opts.AuditLog
+	if opts.Clock != nil {
+		q.clock = opts.Clock
+	}
+	return nil
+}
+
+// acquire counts a call of name, or returns an error wrapping
+// ErrToolQuotaExceeded when that would go over one of its limits. Calls
+// are counted per command when ctx comes from withCommandCalls.
+func (q *toolQuotas) acquire(ctx context.Context, name string) error {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	limits, ok := q.limits[name]
+	if !ok {
+		return nil
+	}
+	now := q.clock.Now()
+
+	calls, _ := ctx.Value(commandCallsKey{}).(commandCalls)
+	if limits.PerCommand > 0 && calls != nil && calls[name] >= limits.PerCommand {
+		return q.exceeded(name, "per_command", fmt.Sprintf("%d calls in this command, limit %d", calls[name], limits.PerCommand))
+	}
+	if limits.PerMinute > 0 {
+		recent := q.recent[name][:0]
+		for _, start := range q.recent[name] {
+			if now.Sub(start) < time.Minute {
+				recent = append(recent, start)
+			}
+		}
+		q.recent[name] = recent
+		if len(recent) >= limits.PerMinute {
+			return q.exceeded(name, "per_minute", fmt.Sprintf("%d calls in the last minute, limit %d", len(recent), limits.PerMinute))
+		}
+	}
+	if limits.PerDay > 0 {
+		q.day.Roll(now)
+		if n := int(q.day.Get(name)); n >= limits.PerDay {
+			return q.exceeded(name, "per_day", fmt.Sprintf("%d calls today, limit %d", n, limits.PerDay))
+		}
+	}
+
+	// Count the call against every limit
+	if calls != nil {
+		calls[name]++
+	}
+	if limits.PerMinute > 0 {
+		q.recent[name] = append(q.recent[name], now)
+	}
+	if limits.PerDay > 0 {
+		if err := q.day.Add(name, 1); err != nil {
+			return fmt.Errorf("failed to save tool calls: %w", err)
+		}
+	}
+	return nil
+}
+
+// exceeded audits a refused call and returns its error. The caller holds
+// q.mu.
+func (q *toolQuotas) exceeded(name, limit, detail string) error {
+	if q.auditLog != nil {
+		q.auditLog.Log(
+			types.EventToolQuotaExceeded,
+			types.SeverityWarning,
+			"tool",
+			fmt.Sprintf("tool %s refused by its %s limit: %s", name, limit, detail),
+			map[string]interface{}{
+				"tool":   name,
+				"limit":  limit,
+				"detail": detail,
+			},
+		)
+	}
+	return fmt.Errorf("%w: tool %s: %s", ErrToolQuotaExceeded, name, detail)
+}
+
+// commandCallsKey carries the calls of the command being answered
+type commandCallsKey struct{}
+
+// commandCalls counts the calls of each tool while answering a command.
+// It is guarded by the mutex of the quotas counting them.
+type commandCalls map[string]int
+
+// withCommandCalls returns a context counting tool calls for a command
+func withCommandCalls(ctx context.Context) context.Context {
+	return context.WithValue(ctx, commandCallsKey{}, commandCalls{})
+}
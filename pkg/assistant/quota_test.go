@@ -0,0 +1,95 @@
+package assistant
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/security"
+	"github.com/butter-bot-machines/skylark/pkg/security/types"
+	"github.com/butter-bot-machines/skylark/pkg/timing"
+)
+
+// recordingLog records the types of logged events
+type recordingLog struct {
+	security.AuditLogger
+	events []types.EventType
+}
+
+func (r *recordingLog) Log(t types.EventType, _ types.Severity, _, _ string, _ map[string]interface{}) error {
+	r.events = append(r.events, t)
+	return nil
+}
+
+func TestToolQuotas(t *testing.T) {
+	clock := timing.NewMock()
+	clock.Set(time.Date(2025, 1, 5, 23, 59, 0, 0, time.Local))
+	audit := &recordingLog{}
+	dir := t.TempDir()
+	limits := map[string]config.ToolLimits{
+		"web_search": {PerCommand: 2, PerMinute: 3, PerDay: 4},
+	}
+
+	q := newToolQuotas()
+	if err := q.set(limits, QuotaOptions{ConfigDir: dir, AuditLog: audit, Clock: clock}); err != nil {
+		t.Fatalf("set() error = %v", err)
+	}
+
+	// Per command
+	cmd := withCommandCalls(context.Background())
+	for i := 0; i < 2; i++ {
+		if err := q.acquire(cmd, "web_search"); err != nil {
+			t.Fatalf("Call %d: unexpected error %v", i+1, err)
+		}
+	}
+	if err := q.acquire(cmd, "web_search"); !errors.Is(err, ErrToolQuotaExceeded) {
+		t.Errorf("Expected the per command limit, got %v", err)
+	}
+	if err := q.acquire(cmd, "currentdatetime"); err != nil {
+		t.Errorf("Expected tools without limits to run, got %v", err)
+	}
+
+	// Per minute, across commands
+	if err := q.acquire(context.Background(), "web_search"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := q.acquire(context.Background(), "web_search"); !errors.Is(err, ErrToolQuotaExceeded) {
+		t.Errorf("Expected the per minute limit, got %v", err)
+	}
+
+	// Per day, which starts over the next day
+	clock.Add(time.Minute)
+	if err := q.acquire(context.Background(), "web_search"); err != nil {
+		t.Fatalf("Expected a new day, got %v", err)
+	}
+
+	// The calls of the day are kept across processes
+	reloaded := newToolQuotas()
+	if err := reloaded.set(limits, QuotaOptions{ConfigDir: dir, Clock: clock}); err != nil {
+		t.Fatalf("set() error = %v", err)
+	}
+	if reloaded.day.Get("web_search") != 1 {
+		t.Errorf("Expected 1 call today after reloading, got %v", reloaded.day)
+	}
+	for i := 0; i < 3; i++ {
+		clock.Add(time.Minute)
+		if err := reloaded.acquire(context.Background(), "web_search"); err != nil {
+			t.Fatalf("Call %d: unexpected error %v", i+2, err)
+		}
+	}
+	clock.Add(time.Minute)
+	if err := reloaded.acquire(context.Background(), "web_search"); !errors.Is(err, ErrToolQuotaExceeded) {
+		t.Errorf("Expected the per day limit, got %v", err)
+	}
+
+	if len(audit.events) != 2 || audit.events[0] != types.EventToolQuotaExceeded {
+		t.Errorf("Expected two refused calls audited, got %v", audit.events)
+	}
+
+	var none *toolQuotas
+	if err := none.acquire(context.Background(), "web_search"); err != nil {
+		t.Errorf("Expected no limits on nil quotas, got %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+package assistant
+
+import (
+	"errors"
+	"sort"
+)
+
+// Reload drops the cached assistants built from the prompt.md of name,
+// the assistant itself and those that extend it, and loads them again so
+// that edits take effect. It returns the names of the dropped assistants.
+// Those that no longer load are left out of the cache and fail when next
+// used.
+func (m *Manager) Reload(name string) ([]string, error) {
+	m.mu.Lock()
+	var dropped []string
+	for cached, a := range m.assistants {
+		if contains(a.lineage, name) {
+			delete(m.assistants, cached)
+			dropped = append(dropped, cached)
+		}
+	}
+	m.mu.Unlock()
+	sort.Strings(dropped)
+
+	var errs []error
+	for _, cached := range dropped {
+		if _, err := m.Get(cached); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		m.logger.Info("reloaded assistant", "assistant", cached)
+	}
+	return dropped, errors.Join(errs...)
+}
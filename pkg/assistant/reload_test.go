@@ -0,0 +1,78 @@
+package assistant
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/provider/registry"
+	"github.com/butter-bot-machines/skylark/pkg/sandbox"
+	"github.com/butter-bot-machines/skylark/pkg/tool"
+)
+
+func TestReload(t *testing.T) {
+	tempDir := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Join(tempDir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(tempDir, name, "prompt.md"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("base", "---\nmodel: gpt-4\n---\nBe brief.\n")
+	write("child", "---\nextends: base\n---\nWrite poems.\n")
+	write("other", "---\nmodel: gpt-4\n---\nBe thorough.\n")
+
+	toolMgr, err := tool.NewManager(filepath.Join(tempDir, "tools"))
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer toolMgr.Close()
+	m, err := NewManager(tempDir, toolMgr, registry.New(), &sandbox.NetworkPolicy{}, "openai")
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	other, err := m.Get("other")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if _, err := m.Get("child"); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+
+	// Editing a parent reloads the assistants extending it
+	write("base", "---\nmodel: gpt-4o\n---\nBe very brief.\n")
+	reloaded, err := m.Reload("base")
+	if err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if strings.Join(reloaded, ",") != "child" {
+		t.Errorf("Expected child to be reloaded, got %v", reloaded)
+	}
+	child, err := m.Get("child")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if child.Model != "gpt-4o" || !strings.HasPrefix(child.Prompt, "Be very brief.") {
+		t.Errorf("Expected the edited parent, got model %s and prompt %q", child.Model, child.Prompt)
+	}
+	if a, _ := m.Get("other"); a != other {
+		t.Error("Expected other to stay cached")
+	}
+
+	// A broken prompt is reported and fails until fixed
+	write("other", "---\nformat: poem\n---\nBe thorough.\n")
+	if _, err := m.Reload("other"); err == nil || !strings.Contains(err.Error(), "invalid response format") {
+		t.Errorf("Expected the invalid format to be reported, got %v", err)
+	}
+	if _, err := m.Get("other"); err == nil {
+		t.Error("Expected the broken assistant to fail")
+	}
+	write("other", "---\nmodel: gpt-4\n---\nBe concise.\n")
+	if a, err := m.Get("other"); err != nil || a.Prompt != "Be concise." {
+		t.Errorf("Expected the fixed assistant, got %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package assistant
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	doccontext "github.com/butter-bot-machines/skylark/pkg/context"
+	"github.com/butter-bot-machines/skylark/pkg/models"
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+)
+
+// RoutePrefix starts the model of an assistant that picks its model per
+// command with a routing policy, as in route:<policy>
+const RoutePrefix = "route:"
+
+// SetRouting sets the routing policies, by name, of the assistants loaded
+// afterwards
+func (m *Manager) SetRouting(policies map[string]config.RoutingPolicy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.routing = policies
+}
+
+// SetModels sets the metadata routing checks the cheap models of the
+// assistants loaded afterwards against
+func (m *Manager) SetModels(r *models.Registry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.models = r
+}
+
+// routingPolicy returns the policy an assistant routes with, if its model
+// names one
+func (m *Manager) routingPolicy(a *Assistant) (*config.RoutingPolicy, error) {
+	name, ok := strings.CutPrefix(a.Model, RoutePrefix)
+	if !ok {
+		return nil, nil
+	}
+	policy, ok := m.routing[name]
+	if !ok {
+		return nil, fmt.Errorf("assistant %s routes with unknown policy %s", a.Name, name)
+	}
+	return &policy, nil
+}
+
+// ModelFor returns the model cmd is sent to: the one it asks for, the one
+// the assistant's routing policy chooses, or the assistant's model
+func (a *Assistant) ModelFor(cmd *parser.Command) string {
+	if cmd.Model != "" {
+		return cmd.Model
+	}
+	if a.route == nil {
+		return a.Model
+	}
+	if a.routeReason(cmd) != "" {
+		return a.route.Expensive
+	}
+	return a.route.Cheap
+}
+
+// routeReason returns why cmd goes to the expensive model of the
+// assistant's routing policy, or "" when the cheap one takes it
+func (a *Assistant) routeReason(cmd *parser.Command) string {
+	if reason := complexity(a.route, cmd); reason != "" {
+		return reason
+	}
+	return a.exceeds(a.route.Cheap, cmd)
+}
+
+// exceeds returns what cmd needs that model lacks by its metadata: images,
+// tools or a larger context window. Models without metadata are assumed
+// capable.
+func (a *Assistant) exceeds(model string, cmd *parser.Command) string {
+	meta, ok := a.models.Lookup(model)
+	if !ok {
+		return ""
+	}
+	if len(cmd.Images) > 0 && !meta.Vision {
+		return "images"
+	}
+	if len(a.Tools) > 0 && !meta.Tools {
+		return "tools"
+	}
+	if meta.ContextWindow > 0 {
+		enc := doccontext.EncodingForModel(model)
+		tokens := doccontext.CountTokens(cmd.Text, enc) + doccontext.DefaultResponseReserve
+		for _, block := range cmd.Context {
+			tokens += doccontext.CountTokens(block.Content, enc)
+		}
+		if tokens > meta.ContextWindow {
+			return "context window"
+		}
+	}
+	return ""
+}
+
+// complexity returns why policy considers cmd complex, or "" when it is
+// simple
+func complexity(policy *config.RoutingPolicy, cmd *parser.Command) string {
+	if policy.MaxWords > 0 {
+		if n := len(strings.Fields(cmd.Text)); n > policy.MaxWords {
+			return fmt.Sprintf("%d words", n)
+		}
+	}
+	if policy.References && len(cmd.References)+len(cmd.Links) > 0 {
+		return "references"
+	}
+	text := strings.ToLower(cmd.Text)
+	for _, keyword := range policy.Keywords {
+		if strings.Contains(text, strings.ToLower(keyword)) {
+			return "keyword " + keyword
+		}
+	}
+	return ""
+}
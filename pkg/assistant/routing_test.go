@@ -0,0 +1,140 @@
+package assistant
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/models"
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+	"github.com/butter-bot-machines/skylark/pkg/provider/registry"
+	"github.com/butter-bot-machines/skylark/pkg/sandbox"
+	"github.com/butter-bot-machines/skylark/pkg/tool"
+)
+
+func TestRouting(t *testing.T) {
+	tempDir := t.TempDir()
+	for name, model := range map[string]string{"router": "route:by-size", "lost": "route:gone"} {
+		if err := os.MkdirAll(filepath.Join(tempDir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		prompt := "---\nmodel: " + model + "\n---\nYou help.\n"
+		if err := os.WriteFile(filepath.Join(tempDir, name, "prompt.md"), []byte(prompt), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var models []string
+	reg := registry.New()
+	reg.Register("openai", func(model string) (provider.Provider, error) {
+		models = append(models, model)
+		return &testProvider{responses: []provider.Response{{Content: "ok"}}}, nil
+	})
+	toolMgr, err := tool.NewManager(filepath.Join(tempDir, "tools"))
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer toolMgr.Close()
+	m, err := NewManager(tempDir, toolMgr, reg, &sandbox.NetworkPolicy{}, "openai")
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	m.SetRouting(map[string]config.RoutingPolicy{"by-size": {
+		Cheap:      "gpt-4o-mini",
+		Expensive:  "gpt-4o",
+		MaxWords:   5,
+		References: true,
+		Keywords:   []string{"Analyze"},
+	}})
+
+	if _, err := m.Get("lost"); err == nil || !strings.Contains(err.Error(), "unknown policy gone") {
+		t.Errorf("Expected an unknown policy error, got %v", err)
+	}
+	a, err := m.Get("router")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		cmd  *parser.Command
+		want string
+	}{
+		{"short", &parser.Command{Text: "fix the typo"}, "gpt-4o-mini"},
+		{"long", &parser.Command{Text: "rewrite this paragraph for a general audience"}, "gpt-4o"},
+		{"references", &parser.Command{Text: "summarize #Plan#", References: []string{"Plan"}}, "gpt-4o"},
+		{"keyword", &parser.Command{Text: "analyze churn"}, "gpt-4o"},
+		{"asked for", &parser.Command{Text: "analyze churn", Model: "gpt-4"}, "gpt-4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := a.ModelFor(tt.cmd); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+			models = nil
+			if _, err := a.Process(tt.cmd); err != nil {
+				t.Fatalf("Process() error = %v", err)
+			}
+			if len(models) != 1 || models[0] != tt.want {
+				t.Errorf("Expected the request sent to %s, got %v", tt.want, models)
+			}
+		})
+	}
+}
+
+func TestRoutingCapabilities(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tempDir, "router"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	prompt := "---\nmodel: route:by-capability\n---\nYou help.\n"
+	if err := os.WriteFile(filepath.Join(tempDir, "router", "prompt.md"), []byte(prompt), 0644); err != nil {
+		t.Fatal(err)
+	}
+	toolMgr, err := tool.NewManager(filepath.Join(tempDir, "tools"))
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer toolMgr.Close()
+	m, err := NewManager(tempDir, toolMgr, registry.New(), &sandbox.NetworkPolicy{}, "openai")
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	m.SetRouting(map[string]config.RoutingPolicy{"by-capability": {
+		Cheap:     "gpt-3.5-turbo",
+		Expensive: "gpt-4o",
+	}})
+	no := false
+	m.SetModels(models.New(map[string]config.ModelMetadata{
+		"gpt-3.5-turbo": {SupportsTools: &no},
+	}))
+	a, err := m.Get("router")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	withTools := *a
+	withTools.Tools = []string{"search"}
+
+	long := parser.Block{Content: strings.Repeat("note ", 20000)}
+	tests := []struct {
+		name      string
+		assistant *Assistant
+		cmd       *parser.Command
+		want      string
+	}{
+		{"text", a, &parser.Command{Text: "fix the typo"}, "gpt-3.5-turbo"},
+		{"images", a, &parser.Command{Text: "describe", Images: []parser.Image{{Path: "chart.png"}}}, "gpt-4o"},
+		{"tools", &withTools, &parser.Command{Text: "fix the typo"}, "gpt-4o"},
+		{"context window", a, &parser.Command{Text: "summarize", Context: map[string]parser.Block{"Notes": long}}, "gpt-4o"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.assistant.ModelFor(tt.cmd); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package assistant
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/butter-bot-machines/skylark/pkg/jsonschema"
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+)
+
+// ErrSchemaMismatch is returned for structured responses that do not
+// conform to the command's schema, even after asking again
+var ErrSchemaMismatch = errors.New("response does not match schema")
+
+// schemaRetries is how often a response not conforming to its schema is
+// sent back for correction
+const schemaRetries = 1
+
+// commandSchema parses the schema cmd asks its response to conform to, or
+// returns nil when it asks for none
+func commandSchema(cmd *parser.Command) (*jsonschema.Schema, error) {
+	if cmd.Schema == nil {
+		return nil, nil
+	}
+	if len(cmd.Schema.Data) == 0 {
+		return nil, fmt.Errorf("schema %s could not be loaded", cmd.Schema.Path)
+	}
+	schema, err := jsonschema.Parse(cmd.Schema.Data)
+	if err != nil {
+		return nil, fmt.Errorf("schema %s: %w", cmd.Schema.Path, err)
+	}
+	return schema, nil
+}
+
+// conform checks response against schema, sending it back with the
+// violation until it conforms or the retries are used up. The result is
+// the JSON of the response, indented.
+func (a *Assistant) conform(ctx context.Context, messages []provider.Message, response string, schema *jsonschema.Schema, ask func([]provider.Message) (string, error)) (string, error) {
+	for attempt := 0; ; attempt++ {
+		body := jsonBody(response)
+		_, err := schema.Validate([]byte(body))
+		if err == nil {
+			var indented bytes.Buffer
+			if err := json.Indent(&indented, []byte(body), "", "  "); err != nil {
+				return "", err
+			}
+			return indented.String(), nil
+		}
+		if attempt == schemaRetries {
+			return "", fmt.Errorf("%w: %v", ErrSchemaMismatch, err)
+		}
+
+		logging.FromContext(ctx, a.logger).Debug("response does not match schema, asking again",
+			"assistant", a.Name,
+			"error", err)
+		messages = append(messages,
+			provider.Message{Role: provider.RoleAssistant, Content: response},
+			provider.Message{Role: provider.RoleUser, Content: fmt.Sprintf(
+				"Your response does not conform to the JSON schema: %v. Respond only with the corrected JSON.", err)})
+		if response, err = ask(messages); err != nil {
+			return "", err
+		}
+	}
+}
+
+// jsonBody returns response without the code fence models tend to wrap
+// JSON in
+func jsonBody(response string) string {
+	body := strings.TrimSpace(response)
+	if strings.HasPrefix(body, "```") {
+		body = strings.TrimSuffix(body, "```")
+		if i := strings.Index(body, "\n"); i >= 0 {
+			body = body[i+1:]
+		}
+	}
+	return strings.TrimSpace(body)
+}
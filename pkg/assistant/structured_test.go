@@ -0,0 +1,83 @@
+package assistant
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+	"github.com/butter-bot-machines/skylark/pkg/provider/registry"
+)
+
+func TestAssistantSchema(t *testing.T) {
+	schema := `{"type": "object", "required": ["names"], "properties": {"names": {"type": "array", "items": {"type": "string"}}}}`
+	tests := []struct {
+		name      string
+		responses []string
+		want      string
+		wantErr   error
+		wantSends int
+	}{
+		{
+			name:      "conforming",
+			responses: []string{"```json\n{\"names\": [\"Ana\"]}\n```"},
+			want:      "{\n  \"names\": [\n    \"Ana\"\n  ]\n}",
+			wantSends: 1,
+		},
+		{
+			name:      "corrected on retry",
+			responses: []string{`{"names": "Ana"}`, `{"names": ["Ana"]}`},
+			want:      "{\n  \"names\": [\n    \"Ana\"\n  ]\n}",
+			wantSends: 2,
+		},
+		{
+			name:      "mismatch",
+			responses: []string{"Ana", `{"people": ["Ana"]}`},
+			wantErr:   ErrSchemaMismatch,
+			wantSends: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &testProvider{}
+			for _, r := range tt.responses {
+				p.responses = append(p.responses, provider.Response{Content: r})
+			}
+			reg := registry.New()
+			reg.Register("openai", func(model string) (provider.Provider, error) { return p, nil })
+			a := &Assistant{
+				Name:            "test",
+				Model:           "gpt-4",
+				Prompt:          "You extract data.",
+				providers:       reg,
+				defaultProvider: "openai",
+				logger:          logging.Default(),
+			}
+
+			cmd := &parser.Command{Text: "List the attendees", Schema: &parser.Schema{Path: "names.json", Data: []byte(schema)}}
+			got, err := a.Process(cmd)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Expected %v, got %v", tt.wantErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("Process() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+			if len(p.requests) != tt.wantSends {
+				t.Fatalf("Expected %d requests, got %d", tt.wantSends, len(p.requests))
+			}
+			if tt.wantSends > 1 {
+				retry := p.requests[1]
+				if last := retry[len(retry)-1].Content; !strings.Contains(last, "does not conform to the JSON schema") {
+					t.Errorf("Expected corrective instructions, got %q", last)
+				}
+			}
+		})
+	}
+}
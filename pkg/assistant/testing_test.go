@@ -9,16 +9,16 @@ import (
 // testProvider simulates an AI provider for testing
 type testProvider struct {
 	responses []provider.Response
-	requests  []string
+	requests  [][]provider.Message
 }
 
-func (p *testProvider) Send(ctx context.Context, prompt string, opts *provider.RequestOptions) (*provider.Response, error) {
+func (p *testProvider) Send(ctx context.Context, messages []provider.Message, opts *provider.RequestOptions) (*provider.Response, error) {
 	if len(p.responses) == 0 {
 		return nil, &provider.Error{Code: provider.ErrServerError, Message: "no responses configured"}
 	}
 	resp := p.responses[0]
 	p.responses = p.responses[1:]
-	p.requests = append(p.requests, prompt)
+	p.requests = append(p.requests, messages)
 	return &resp, resp.Error
 }
 
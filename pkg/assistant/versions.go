@@ -0,0 +1,134 @@
+package assistant
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// versionsDir holds the snapshots of an assistant's prompt.md, inside the
+// assistant's directory
+const versionsDir = "versions"
+
+// versionFile matches the name of a snapshot, v<number>.md
+var versionFile = regexp.MustCompile(`^v([1-9][0-9]*)\.md$`)
+
+// Version is a snapshot of an assistant's prompt.md
+type Version struct {
+	Number  int
+	Path    string
+	Created time.Time
+}
+
+// String returns the version as v<number>
+func (v Version) String() string {
+	return fmt.Sprintf("v%d", v.Number)
+}
+
+// ParseVersion parses a version given as v<number> or <number>
+func ParseVersion(s string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(s), "v"))
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid version %q, expected v<number>", s)
+	}
+	return n, nil
+}
+
+// splitVersion splits an assistant name of the form name@v<number> into
+// the name and version. Names without a version return 0.
+func splitVersion(name string) (string, int, error) {
+	base, version, ok := strings.Cut(name, "@")
+	if !ok {
+		return name, 0, nil
+	}
+	n, err := ParseVersion(version)
+	if err != nil {
+		return "", 0, fmt.Errorf("assistant %s: %w", name, err)
+	}
+	return base, n, nil
+}
+
+// Versions returns the snapshots of the prompt.md of the assistant name in
+// assistantsDir, oldest first. A snapshot is taken whenever the assistant
+// is loaded with a prompt.md that differs from the latest one.
+func Versions(assistantsDir, name string) ([]Version, error) {
+	dir := filepath.Join(assistantsDir, name, versionsDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read versions: %w", err)
+	}
+
+	var versions []Version
+	for _, entry := range entries {
+		match := versionFile.FindStringSubmatch(entry.Name())
+		if match == nil || entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read versions: %w", err)
+		}
+		n, _ := strconv.Atoi(match[1])
+		versions = append(versions, Version{Number: n, Path: filepath.Join(dir, entry.Name()), Created: info.ModTime()})
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Number < versions[j].Number })
+	return versions, nil
+}
+
+// ReadVersion returns the prompt.md of the assistant name in
+// assistantsDir as of version
+func ReadVersion(assistantsDir, name string, version int) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(assistantsDir, name, versionsDir, fmt.Sprintf("v%d.md", version)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("assistant %s has no version v%d", name, version)
+		}
+		return nil, fmt.Errorf("failed to read version: %w", err)
+	}
+	return data, nil
+}
+
+// snapshot saves an assistant's prompt.md as its next version unless it
+// matches the latest version
+func (m *Manager) snapshot(name string) error {
+	content, err := os.ReadFile(filepath.Join(m.basePath, name, "prompt.md"))
+	if err != nil {
+		return fmt.Errorf("failed to read prompt.md: %w", err)
+	}
+	versions, err := Versions(m.basePath, name)
+	if err != nil {
+		return err
+	}
+	next := 1
+	if len(versions) > 0 {
+		latest := versions[len(versions)-1]
+		data, err := os.ReadFile(latest.Path)
+		if err != nil {
+			return fmt.Errorf("failed to read version: %w", err)
+		}
+		if bytes.Equal(data, content) {
+			return nil
+		}
+		next = latest.Number + 1
+	}
+
+	dir := filepath.Join(m.basePath, name, versionsDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create versions directory: %w", err)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("v%d.md", next))
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return fmt.Errorf("failed to write version: %w", err)
+	}
+	m.logger.Info("saved prompt version", "assistant", name, "version", fmt.Sprintf("v%d", next))
+	return nil
+}
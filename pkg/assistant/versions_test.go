@@ -0,0 +1,74 @@
+package assistant
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/provider/registry"
+	"github.com/butter-bot-machines/skylark/pkg/sandbox"
+	"github.com/butter-bot-machines/skylark/pkg/tool"
+)
+
+func TestVersions(t *testing.T) {
+	tempDir := t.TempDir()
+	dir := filepath.Join(tempDir, "writer")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	toolMgr, err := tool.NewManager(filepath.Join(tempDir, "tools"))
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer toolMgr.Close()
+
+	// Each load of a changed prompt.md saves a version
+	prompts := []string{
+		"---\nmodel: gpt-4\n---\nWrite plainly.\n",
+		"---\nmodel: gpt-4\n---\nWrite plainly.\n",
+		"---\nmodel: gpt-4o\n---\nWrite briefly.\n",
+	}
+	for _, prompt := range prompts {
+		if err := os.WriteFile(filepath.Join(dir, "prompt.md"), []byte(prompt), 0644); err != nil {
+			t.Fatal(err)
+		}
+		m, err := NewManager(tempDir, toolMgr, registry.New(), &sandbox.NetworkPolicy{}, "openai")
+		if err != nil {
+			t.Fatalf("NewManager() error = %v", err)
+		}
+		if _, err := m.Get("writer"); err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+	}
+
+	versions, err := Versions(tempDir, "writer")
+	if err != nil {
+		t.Fatalf("Versions() error = %v", err)
+	}
+	if len(versions) != 2 || versions[0].String() != "v1" || versions[1].String() != "v2" {
+		t.Fatalf("Expected versions v1 and v2, got %v", versions)
+	}
+	if data, err := ReadVersion(tempDir, "writer", 1); err != nil || string(data) != prompts[0] {
+		t.Errorf("Expected v1 to hold the first prompt, got %q: %v", data, err)
+	}
+
+	// name@v<number> loads a saved version
+	m, err := NewManager(tempDir, toolMgr, registry.New(), &sandbox.NetworkPolicy{}, "openai")
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	a, err := m.Get("writer@v1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if a.Model != "gpt-4" || a.Prompt != "Write plainly." {
+		t.Errorf("Expected the first version, got model %s and prompt %q", a.Model, a.Prompt)
+	}
+	if _, err := m.Get("writer@v9"); err == nil || !strings.Contains(err.Error(), "has no version v9") {
+		t.Errorf("Expected a missing version error, got %v", err)
+	}
+	if _, err := m.Get("writer@latest"); err == nil || !strings.Contains(err.Error(), "invalid version") {
+		t.Errorf("Expected an invalid version error, got %v", err)
+	}
+}
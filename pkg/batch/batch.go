@@ -0,0 +1,251 @@
+package batch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+	"github.com/butter-bot-machines/skylark/pkg/state"
+	"github.com/butter-bot-machines/skylark/pkg/timing"
+)
+
+// logger writes through the default handler installed by the CLI
+var logger = logging.Default()
+
+// Status is the outcome of a command or file
+type Status string
+
+const (
+	StatusOK      Status = "ok"
+	StatusFailed  Status = "failed"
+	StatusSkipped Status = "skipped" // Not run because an earlier command failed
+)
+
+// CommandResult reports one command
+type CommandResult struct {
+	File       string         `json:"file"`
+	Line       int            `json:"line,omitempty"` // 1-based line of the command in the file
+	Assistant  string         `json:"assistant"`
+	Command    string         `json:"command"`
+	Status     Status         `json:"status"`
+	Error      string         `json:"error,omitempty"`
+	Response   string         `json:"response,omitempty"`
+	Tokens     provider.Usage `json:"tokens"`
+	DurationMS int64          `json:"duration_ms"`
+	Err        error          `json:"-"` // The error behind Error, for classifying failures
+}
+
+// FileResult reports one file
+type FileResult struct {
+	File     string `json:"file"`
+	Status   Status `json:"status"`
+	Error    string `json:"error,omitempty"` // Reading, parsing or updating the file failed
+	Commands int    `json:"commands"`
+}
+
+// Summary counts the results of a run
+type Summary struct {
+	Files       int            `json:"files"`
+	FilesFailed int            `json:"files_failed"`
+	Commands    int            `json:"commands"`
+	Succeeded   int            `json:"succeeded"`
+	Failed      int            `json:"failed"`
+	Skipped     int            `json:"skipped"`
+	Tokens      provider.Usage `json:"tokens"`
+}
+
+// Report is the machine-readable result of a batch run
+type Report struct {
+	StartedAt  time.Time       `json:"started_at"`
+	FinishedAt time.Time       `json:"finished_at"`
+	OnFailure  string          `json:"on_failure"`
+	Summary    Summary         `json:"summary"`
+	Files      []FileResult    `json:"files"`
+	Commands   []CommandResult `json:"commands"`
+}
+
+// Failed reports whether any file or command failed
+func (r *Report) Failed() bool {
+	return r.Summary.FilesFailed > 0 || r.Summary.Failed > 0
+}
+
+// Runner runs the commands of a manifest's files through a processor
+type Runner struct {
+	proc   processor.ProcessManager
+	parser *parser.Parser
+	clock  timing.Clock
+}
+
+// NewRunner creates a runner. Commands are parsed with p, which may
+// expand templates, and run with proc.
+func NewRunner(proc processor.ProcessManager, p *parser.Parser, clock timing.Clock) *Runner {
+	if clock == nil {
+		clock = timing.New()
+	}
+	return &Runner{proc: proc, parser: p, clock: clock}
+}
+
+// Run processes files as m describes. Files are processed up to
+// m.Concurrency at once, each file's commands in order. The responses of
+// the commands that succeed are written back into their files. With the
+// stop policy, commands not yet started when one fails are skipped.
+func (r *Runner) Run(ctx context.Context, m *Manifest, files []string) *Report {
+	report := &Report{StartedAt: r.clock.Now(), OnFailure: m.OnFailure}
+
+	// Commands already running finish when another fails; only those not
+	// yet started are skipped
+	var stopped atomic.Bool
+
+	concurrency := m.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	fileResults := make([]FileResult, len(files))
+	commandResults := make([][]CommandResult, len(files))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, file := range files {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, file string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fileResults[i], commandResults[i] = r.runFile(ctx, m, file, &stopped)
+			if m.OnFailure == OnFailureStop && fileResults[i].Status == StatusFailed {
+				stopped.Store(true)
+			}
+		}(i, file)
+	}
+	wg.Wait()
+
+	report.Files = fileResults
+	report.Commands = []CommandResult{}
+	for i, results := range commandResults {
+		report.Commands = append(report.Commands, results...)
+		report.Summary.Files++
+		if fileResults[i].Status == StatusFailed {
+			report.Summary.FilesFailed++
+		}
+		for _, result := range results {
+			report.Summary.Commands++
+			report.Summary.Tokens.PromptTokens += result.Tokens.PromptTokens
+			report.Summary.Tokens.CompletionTokens += result.Tokens.CompletionTokens
+			report.Summary.Tokens.TotalTokens += result.Tokens.TotalTokens
+			switch result.Status {
+			case StatusOK:
+				report.Summary.Succeeded++
+			case StatusFailed:
+				report.Summary.Failed++
+			case StatusSkipped:
+				report.Summary.Skipped++
+			}
+		}
+	}
+	report.FinishedAt = r.clock.Now()
+	return report
+}
+
+// runFile runs the commands of one file and writes back the responses of
+// those that succeed
+func (r *Runner) runFile(ctx context.Context, m *Manifest, path string, stopped *atomic.Bool) (FileResult, []CommandResult) {
+	log := logging.FromContext(ctx, logger).With("file", path)
+	file := FileResult{File: path, Status: StatusOK}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		file.Status, file.Error = StatusFailed, fmt.Sprintf("failed to read file: %v", err)
+		return file, nil
+	}
+	content := string(data)
+	commands, err := r.parser.ParseCommands(content)
+	if err != nil {
+		file.Status, file.Error = StatusFailed, err.Error()
+		return file, nil
+	}
+	file.Commands = len(commands)
+
+	// Commands stay skipped unless they run
+	originals := make([]string, len(commands))
+	for i, cmd := range commands {
+		originals[i] = cmd.Original
+	}
+	instances := state.Locate(content, originals)
+	results := make([]CommandResult, len(commands))
+	for i, cmd := range commands {
+		if m.Assistant != "" {
+			cmd.Assistant = m.Assistant
+		}
+		results[i] = CommandResult{
+			File:      path,
+			Line:      instances[i].Line,
+			Assistant: cmd.Assistant,
+			Command:   cmd.Original,
+			Status:    StatusSkipped,
+		}
+	}
+
+	var responses []processor.Response
+	for i, cmd := range commands {
+		if stopped.Load() || ctx.Err() != nil {
+			break
+		}
+
+		start := r.clock.Now()
+		response, usage, err := r.runCommand(ctx, cmd, path, content, instances[i])
+		results[i].Tokens = usage
+		results[i].DurationMS = r.clock.Now().Sub(start).Milliseconds()
+		if err != nil {
+			log.Warn("command failed", "command", cmd.Original, "error", err)
+			results[i].Status, results[i].Error, results[i].Err = StatusFailed, err.Error(), err
+			if m.OnFailure == OnFailureStop {
+				stopped.Store(true)
+				break
+			}
+			continue
+		}
+		results[i].Status, results[i].Response = StatusOK, response
+		if response != "" {
+			responses = append(responses, processor.Response{Command: cmd, Response: response})
+		}
+	}
+
+	if len(responses) > 0 {
+		if err := r.proc.UpdateFile(path, responses); err != nil {
+			file.Status, file.Error = StatusFailed, fmt.Sprintf("failed to update file: %v", err)
+		} else if p, ok := r.proc.(processor.InstanceProcessor); ok {
+			p.MarkWritten(ctx, path, instances)
+		}
+	}
+	return file, results
+}
+
+// runCommand attaches the sections cmd references and processes it,
+// returning the tokens its provider requests used. Processors recording
+// command instances answer inst with the response recorded by an
+// interrupted run, if any.
+func (r *Runner) runCommand(ctx context.Context, cmd *parser.Command, path, content string, inst state.Instance) (string, provider.Usage, error) {
+	if resolver, ok := r.proc.(processor.ReferenceResolver); ok {
+		resolver.AttachReferences(ctx, cmd, path, content)
+	}
+
+	meter := &provider.UsageMeter{}
+	ctx = provider.ContextWithUsageMeter(ctx, meter)
+	var response string
+	var err error
+	if p, ok := r.proc.(processor.InstanceProcessor); ok {
+		response, err = p.ProcessInstance(ctx, path, inst, cmd)
+	} else if p, ok := r.proc.(processor.ContextCommandProcessor); ok {
+		response, err = p.ProcessContext(ctx, cmd)
+	} else {
+		response, err = r.proc.Process(cmd)
+	}
+	return response, meter.Usage(), err
+}
@@ -0,0 +1,197 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/process"
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+	"github.com/butter-bot-machines/skylark/pkg/state"
+)
+
+// mockProcessor answers commands with their assistant and text, failing
+// commands whose text contains "fail"
+type mockProcessor struct {
+	mu      sync.Mutex
+	updates map[string][]processor.Response
+}
+
+func (p *mockProcessor) Process(cmd *parser.Command) (string, error) {
+	if strings.Contains(cmd.Text, "fail") {
+		return "", fmt.Errorf("provider error")
+	}
+	return cmd.Assistant + ": " + cmd.Text, nil
+}
+
+// ProcessContext records the usage of one provider request per command
+func (p *mockProcessor) ProcessContext(ctx context.Context, cmd *parser.Command) (string, error) {
+	provider.RecordUsage(ctx, provider.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15})
+	return p.Process(cmd)
+}
+
+func (p *mockProcessor) ProcessFile(path string) error {
+	return nil
+}
+
+func (p *mockProcessor) ProcessDirectory(dir string) error {
+	return nil
+}
+
+func (p *mockProcessor) HandleResponse(cmd *parser.Command, response string) error {
+	return nil
+}
+
+func (p *mockProcessor) UpdateFile(path string, responses []processor.Response) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.updates[filepath.Base(path)] = responses
+	return nil
+}
+
+func (p *mockProcessor) GetProcessManager() process.Manager {
+	return nil
+}
+
+func (p *mockProcessor) Close() error {
+	return nil
+}
+
+// instanceProcessor answers instances with a recorded response, as after
+// an interrupted run, until they are marked written
+type instanceProcessor struct {
+	mockProcessor
+	recorded map[string]string // By instance key
+	written  []string
+}
+
+func (p *instanceProcessor) ProcessInstance(ctx context.Context, path string, inst state.Instance, cmd *parser.Command) (string, error) {
+	if response, ok := p.recorded[inst.Key]; ok {
+		return response, nil
+	}
+	return p.ProcessContext(ctx, cmd)
+}
+
+func (p *instanceProcessor) MarkWritten(ctx context.Context, path string, instances []state.Instance) {
+	for _, inst := range instances {
+		delete(p.recorded, inst.Key)
+		p.written = append(p.written, inst.Key)
+	}
+}
+
+func TestRunnerInstances(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.md": "!one first\n!two second\n!one first\n"})
+	proc := &instanceProcessor{
+		mockProcessor: mockProcessor{updates: make(map[string][]processor.Response)},
+		recorded:      map[string]string{state.Key("!one first", 1): "recorded"},
+	}
+	m := &Manifest{Files: []string{"a.md"}, OnFailure: OnFailureContinue, dir: dir}
+	report := NewRunner(proc, parser.New(), nil).Run(context.Background(), m, []string{filepath.Join(dir, "a.md")})
+
+	// The second "!one first" reuses its recorded response, without tokens
+	if last := report.Commands[2]; last.Response != "recorded" || last.Line != 3 || last.Tokens.TotalTokens != 0 {
+		t.Errorf("Expected the recorded response, got %+v", last)
+	}
+	if report.Summary.Tokens.TotalTokens != 30 {
+		t.Errorf("Expected 30 tokens, got %d", report.Summary.Tokens.TotalTokens)
+	}
+	if len(proc.written) != 3 || len(proc.recorded) != 0 {
+		t.Errorf("Expected the instances marked written, got %v", proc.written)
+	}
+}
+
+func TestRunner(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.md": "# A\n\n!one first\n\n!two please fail\n\n!three last\n",
+		"b.md": "# B\n!writer summarize\n",
+	})
+	files := []string{filepath.Join(dir, "a.md"), filepath.Join(dir, "b.md")}
+
+	t.Run("continue", func(t *testing.T) {
+		proc := &mockProcessor{updates: make(map[string][]processor.Response)}
+		m := &Manifest{Files: []string{"*.md"}, OnFailure: OnFailureContinue, Concurrency: 2, dir: dir}
+		report := NewRunner(proc, parser.New(), nil).Run(context.Background(), m, files)
+
+		expected := Summary{Files: 2, Commands: 4, Succeeded: 3, Failed: 1,
+			Tokens: provider.Usage{PromptTokens: 40, CompletionTokens: 20, TotalTokens: 60}}
+		if report.Summary != expected {
+			t.Errorf("Expected summary %+v, got %+v", expected, report.Summary)
+		}
+		if !report.Failed() {
+			t.Error("Expected report to be failed")
+		}
+
+		failed := report.Commands[1]
+		if failed.Status != StatusFailed || failed.Line != 5 || failed.Command != "!two please fail" || !strings.Contains(failed.Error, "provider error") {
+			t.Errorf("Unexpected failed command result: %+v", failed)
+		}
+		if last := report.Commands[2]; last.Status != StatusOK || last.Response != "three: last" || last.Tokens.TotalTokens != 15 {
+			t.Errorf("Expected the last command to run, got %+v", last)
+		}
+
+		// Responses of the commands that succeeded are written back
+		if len(proc.updates["a.md"]) != 2 || len(proc.updates["b.md"]) != 1 {
+			t.Errorf("Expected 2 and 1 responses written, got %v", proc.updates)
+		}
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		proc := &mockProcessor{updates: make(map[string][]processor.Response)}
+		m := &Manifest{Files: []string{"*.md"}, OnFailure: OnFailureStop, Concurrency: 1, dir: dir}
+		report := NewRunner(proc, parser.New(), nil).Run(context.Background(), m, files)
+
+		expected := Summary{Files: 2, Commands: 4, Succeeded: 1, Failed: 1, Skipped: 2,
+			Tokens: provider.Usage{PromptTokens: 20, CompletionTokens: 10, TotalTokens: 30}}
+		if report.Summary != expected {
+			t.Errorf("Expected summary %+v, got %+v", expected, report.Summary)
+		}
+		for _, result := range report.Commands[2:] {
+			if result.Status != StatusSkipped {
+				t.Errorf("Expected %q to be skipped, got %s", result.Command, result.Status)
+			}
+		}
+		if _, ok := proc.updates["b.md"]; ok {
+			t.Error("Expected skipped file to be left unchanged")
+		}
+	})
+
+	t.Run("assistant override", func(t *testing.T) {
+		proc := &mockProcessor{updates: make(map[string][]processor.Response)}
+		m := &Manifest{Files: []string{"b.md"}, Assistant: "reviewer", OnFailure: OnFailureStop, dir: dir}
+		report := NewRunner(proc, parser.New(), nil).Run(context.Background(), m, files[1:])
+
+		if report.Failed() || len(report.Commands) != 1 {
+			t.Fatalf("Expected one successful command, got %+v", report)
+		}
+		if got := report.Commands[0]; got.Assistant != "reviewer" || got.Response != "reviewer: summarize" {
+			t.Errorf("Expected the override assistant, got %+v", got)
+		}
+	})
+
+	t.Run("unreadable file", func(t *testing.T) {
+		proc := &mockProcessor{updates: make(map[string][]processor.Response)}
+		m := &Manifest{Files: []string{"*.md"}, OnFailure: OnFailureContinue, dir: dir}
+		report := NewRunner(proc, parser.New(), nil).Run(context.Background(), m, []string{filepath.Join(dir, "missing.md")})
+
+		if report.Summary.FilesFailed != 1 || !strings.Contains(report.Files[0].Error, "failed to read file") {
+			t.Errorf("Expected a failed file, got %+v", report.Files)
+		}
+
+		// The report is valid JSON with an empty command list
+		data, err := json.Marshal(report)
+		if err != nil {
+			t.Fatalf("Marshal() error = %v", err)
+		}
+		if !strings.Contains(string(data), `"commands":[]`) {
+			t.Errorf("Expected an empty command list, got %s", data)
+		}
+	})
+}
@@ -0,0 +1,142 @@
+// Package batch runs the commands of a set of documents listed in a
+// manifest and reports the outcome of each command, for CI pipelines.
+package batch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Failure policies
+const (
+	OnFailureStop     = "stop"     // Skip remaining commands after the first failure
+	OnFailureContinue = "continue" // Run every command regardless of failures
+)
+
+// Manifest describes a batch run
+type Manifest struct {
+	Files       []string `yaml:"files"`       // Files, directories or globs, relative to the manifest
+	Assistant   string   `yaml:"assistant"`   // Runs every command with this assistant when set
+	Concurrency int      `yaml:"concurrency"` // Files processed at once (0 = workers.count)
+	OnFailure   string   `yaml:"on_failure"`  // stop (default) or continue
+	Report      string   `yaml:"report"`      // JSON report path, relative to the manifest (empty = stdout)
+
+	dir string // Directory of the manifest file
+}
+
+// LoadManifest reads and validates the manifest at path
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	m := &Manifest{}
+	if err := yaml.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	m.dir = filepath.Dir(path)
+	if err := m.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	return m, nil
+}
+
+// Validate checks the manifest for missing or invalid settings
+func (m *Manifest) Validate() error {
+	if len(m.Files) == 0 {
+		return fmt.Errorf("no files listed")
+	}
+	if m.Concurrency < 0 {
+		return fmt.Errorf("concurrency must not be negative")
+	}
+	switch m.OnFailure {
+	case "":
+		m.OnFailure = OnFailureStop
+	case OnFailureStop, OnFailureContinue:
+	default:
+		return fmt.Errorf("on_failure must be %q or %q, got %q", OnFailureStop, OnFailureContinue, m.OnFailure)
+	}
+	m.Assistant = strings.ToLower(strings.TrimSpace(m.Assistant))
+	return nil
+}
+
+// ReportPath returns the report path resolved against the manifest's
+// directory, or "" when the report goes to stdout
+func (m *Manifest) ReportPath() string {
+	if m.Report == "" || filepath.IsAbs(m.Report) {
+		return m.Report
+	}
+	return filepath.Join(m.dir, m.Report)
+}
+
+// Resolve returns the Markdown files the manifest lists, sorted and
+// without duplicates. A directory stands for every Markdown file under
+// it, outside of .skai. Each entry must match at least one file.
+func (m *Manifest) Resolve() ([]string, error) {
+	seen := make(map[string]bool)
+	var files []string
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+
+	for _, pattern := range m.Files {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(m.dir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+
+		count := 0
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, fmt.Errorf("failed to stat %s: %w", match, err)
+			}
+			if !info.IsDir() {
+				if isMarkdown(match) {
+					add(match)
+					count++
+				}
+				continue
+			}
+			err = filepath.WalkDir(match, func(path string, d os.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.IsDir() && d.Name() == ".skai" {
+					return filepath.SkipDir
+				}
+				if !d.IsDir() && isMarkdown(path) {
+					add(path)
+					count++
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to walk %s: %w", match, err)
+			}
+		}
+		if count == 0 {
+			return nil, fmt.Errorf("%q matches no Markdown files", pattern)
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// isMarkdown reports whether path names a Markdown file
+func isMarkdown(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".md")
+}
@@ -0,0 +1,113 @@
+package batch
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFiles creates files under dir, keyed by slash-separated path
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func TestLoadManifest(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		wantError string
+		want      Manifest
+	}{
+		{
+			name:    "defaults",
+			content: "files: [notes.md]\n",
+			want:    Manifest{Files: []string{"notes.md"}, OnFailure: OnFailureStop},
+		},
+		{
+			name:    "all settings",
+			content: "files: [docs, '*.md']\nassistant: Writer\nconcurrency: 3\non_failure: continue\nreport: out/report.json\n",
+			want: Manifest{
+				Files:       []string{"docs", "*.md"},
+				Assistant:   "writer",
+				Concurrency: 3,
+				OnFailure:   OnFailureContinue,
+				Report:      "out/report.json",
+			},
+		},
+		{name: "no files", content: "assistant: writer\n", wantError: "no files listed"},
+		{name: "bad policy", content: "files: [a.md]\non_failure: retry\n", wantError: "on_failure must be"},
+		{name: "negative concurrency", content: "files: [a.md]\nconcurrency: -1\n", wantError: "must not be negative"},
+		{name: "invalid YAML", content: "files: [a.md\n", wantError: "invalid manifest"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "batch.yaml")
+			writeFiles(t, dir, map[string]string{"batch.yaml": tt.content})
+
+			m, err := LoadManifest(path)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Errorf("Expected error containing %q, got %v", tt.wantError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadManifest() error = %v", err)
+			}
+			tt.want.dir = dir
+			if !reflect.DeepEqual(*m, tt.want) {
+				t.Errorf("Expected %+v, got %+v", tt.want, *m)
+			}
+		})
+	}
+}
+
+func TestManifestResolve(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.md":                 "!cmd",
+		"b.md":                 "!cmd",
+		"b.txt":                "text",
+		"docs/c.md":            "!cmd",
+		"docs/deep/d.md":       "!cmd",
+		"docs/.skai/prompt.md": "prompt",
+	})
+
+	m := &Manifest{Files: []string{"*.md", "docs", "a.md"}, dir: dir}
+	files, err := m.Resolve()
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	var rel []string
+	for _, file := range files {
+		r, _ := filepath.Rel(dir, file)
+		rel = append(rel, filepath.ToSlash(r))
+	}
+	expected := []string{"a.md", "b.md", "docs/c.md", "docs/deep/d.md"}
+	if !reflect.DeepEqual(rel, expected) {
+		t.Errorf("Expected %v, got %v", expected, rel)
+	}
+
+	m.Files = []string{"missing/*.md"}
+	if _, err := m.Resolve(); err == nil || !strings.Contains(err.Error(), "matches no Markdown files") {
+		t.Errorf("Expected no match error, got %v", err)
+	}
+
+	m.Report = "report.json"
+	if got := m.ReportPath(); got != filepath.Join(dir, "report.json") {
+		t.Errorf("Expected report next to the manifest, got %s", got)
+	}
+}
@@ -0,0 +1,301 @@
+// Package breaker stops sending requests to a provider that is down. After
+// consecutive server errors or rate limits, the provider's circuit opens:
+// its requests fail with ErrOpen without reaching it, and the worker pool
+// holds back queued jobs. Once the cooldown has passed, the next request
+// probes the provider, closing the circuit if it succeeds and opening it
+// again if it fails the same way.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+	"github.com/butter-bot-machines/skylark/pkg/notify"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+	"github.com/butter-bot-machines/skylark/pkg/provider/registry"
+	"github.com/butter-bot-machines/skylark/pkg/timing"
+)
+
+var logger = logging.Default()
+
+const (
+	defaultThreshold = 5
+	defaultCooldown  = 30 * time.Second
+)
+
+// ErrOpen is returned for requests to a provider whose circuit is open
+var ErrOpen = errors.New("provider unavailable")
+
+// State is the state of a provider's circuit
+type State int
+
+const (
+	// Closed lets requests through
+	Closed State = iota
+	// Open fails requests until the cooldown has passed
+	Open
+	// HalfOpen lets one request through to probe the provider
+	HalfOpen
+)
+
+// String returns the name of the state
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// circuit is the breaker of one provider
+type circuit struct {
+	state    State
+	failures int  // Consecutive outage errors while closed
+	probing  bool // A request is probing the provider
+}
+
+// Set holds a circuit breaker per provider. It is safe for concurrent use.
+type Set struct {
+	clock    timing.Clock
+	notifier *notify.Notifier
+	changed  chan struct{}
+
+	mu       sync.Mutex
+	cfg      config.BreakerConfig
+	circuits map[string]*circuit // By provider name
+}
+
+// New creates circuit breakers configured by cfg. A nil clock uses the
+// real clock.
+func New(cfg config.BreakerConfig, clock timing.Clock) *Set {
+	if clock == nil {
+		clock = timing.New()
+	}
+	return &Set{
+		clock:    clock,
+		changed:  make(chan struct{}, 1),
+		cfg:      cfg,
+		circuits: make(map[string]*circuit),
+	}
+}
+
+// Configure applies cfg to requests made from now on
+func (s *Set) Configure(cfg config.BreakerConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cfg = cfg
+}
+
+// SetNotifier sends provider_unavailable and provider_recovered events to
+// n when a circuit opens or closes again
+func (s *Set) SetNotifier(n *notify.Notifier) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notifier = n
+}
+
+// State returns the state of the named provider's circuit
+func (s *Set) State(name string) State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.circuits[name]; ok {
+		return c.state
+	}
+	return Closed
+}
+
+// Holding reports whether jobs should wait: a circuit is open or probing.
+// Jobs are held whatever provider they use, since which one a job needs is
+// only known once its commands run.
+func (s *Set) Holding() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.circuits {
+		if c.state == Open || c.probing {
+			return true
+		}
+	}
+	return false
+}
+
+// Changed returns a channel that receives when Holding may have changed
+func (s *Set) Changed() <-chan struct{} {
+	return s.changed
+}
+
+// Wrap returns a factory whose providers go through the named provider's
+// circuit, for use with registry.Wrap
+func (s *Set) Wrap(name string, factory registry.Factory) registry.Factory {
+	return func(model string) (provider.Provider, error) {
+		inner, err := factory(model)
+		if err != nil {
+			return nil, err
+		}
+		return &guardedProvider{inner: inner, set: s, name: name}, nil
+	}
+}
+
+// allow returns ErrOpen unless a request to the named provider may be sent
+func (s *Set) allow(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.circuits[name]
+	if !ok {
+		return nil
+	}
+	switch {
+	case c.state == Open, c.state == HalfOpen && c.probing:
+		return fmt.Errorf("%w: %s", ErrOpen, name)
+	case c.state == HalfOpen:
+		c.probing = true
+		logger.Info("probing provider", "provider", name)
+	}
+	return nil
+}
+
+// record updates the named provider's circuit with the outcome of a
+// request. Errors other than outages, such as invalid input or a
+// cancelled request, leave a closed circuit as it is.
+func (s *Set) record(name string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	threshold := s.cfg.Threshold
+	if threshold == 0 {
+		threshold = defaultThreshold
+	}
+	if threshold < 0 {
+		return
+	}
+	c, ok := s.circuits[name]
+	if !ok {
+		c = &circuit{}
+		s.circuits[name] = c
+	}
+
+	down := outage(err)
+	switch c.state {
+	case Closed:
+		switch {
+		case down:
+			c.failures++
+			if c.failures >= threshold {
+				s.openLocked(name, c, err)
+			}
+		case err == nil:
+			c.failures = 0
+		}
+	case HalfOpen:
+		if !c.probing {
+			return // Sent before the circuit opened
+		}
+		c.probing = false
+		switch {
+		case down:
+			s.openLocked(name, c, err)
+		case err == nil:
+			s.closeLocked(name, c)
+		default:
+			s.signal() // The next request probes instead
+		}
+	}
+}
+
+// openLocked opens a circuit until the cooldown has passed. The caller
+// holds s.mu.
+func (s *Set) openLocked(name string, c *circuit, err error) {
+	cooldown := s.cfg.Cooldown
+	if cooldown <= 0 {
+		cooldown = defaultCooldown
+	}
+	reopened := c.state == HalfOpen
+	c.state, c.failures = Open, 0
+	s.clock.AfterFunc(cooldown, func() { s.halfOpen(name, c) })
+	s.signal()
+
+	logger.Warn("provider circuit opened", "provider", name, "cooldown", cooldown, "error", err)
+	if !reopened {
+		s.notifier.Notify(notify.Event{
+			Type: config.NotifyProviderUnavailable,
+			Data: map[string]interface{}{
+				"provider": name,
+				"error":    err.Error(),
+				"cooldown": cooldown.String(),
+			},
+		})
+	}
+}
+
+// halfOpen lets the next request probe a provider whose cooldown passed
+func (s *Set) halfOpen(name string, c *circuit) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c.state != Open {
+		return
+	}
+	c.state = HalfOpen
+	logger.Info("provider circuit half-open", "provider", name)
+	s.signal()
+}
+
+// closeLocked closes a circuit after a successful probe. The caller holds
+// s.mu.
+func (s *Set) closeLocked(name string, c *circuit) {
+	c.state, c.failures = Closed, 0
+	s.signal()
+
+	logger.Info("provider circuit closed", "provider", name)
+	s.notifier.Notify(notify.Event{
+		Type: config.NotifyProviderRecovered,
+		Data: map[string]interface{}{"provider": name},
+	})
+}
+
+// signal notifies Changed without blocking
+func (s *Set) signal() {
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+// outage reports whether err shows the provider is down: a server error or
+// a rate limit
+func outage(err error) bool {
+	var perr *provider.Error
+	if !errors.As(err, &perr) {
+		return false
+	}
+	return perr.Code == provider.ErrServerError || perr.Code == provider.ErrRateLimit
+}
+
+// guardedProvider implements provider.Provider behind a circuit breaker
+type guardedProvider struct {
+	inner provider.Provider
+	set   *Set
+	name  string
+}
+
+// Send implements provider.Provider
+func (p *guardedProvider) Send(ctx context.Context, messages []provider.Message, opts *provider.RequestOptions) (*provider.Response, error) {
+	if err := p.set.allow(p.name); err != nil {
+		return nil, err
+	}
+	resp, err := p.inner.Send(ctx, messages, opts)
+	p.set.record(p.name, err)
+	return resp, err
+}
+
+// Close implements provider.Provider
+func (p *guardedProvider) Close() error {
+	return p.inner.Close()
+}
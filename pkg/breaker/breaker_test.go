@@ -0,0 +1,126 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+	"github.com/butter-bot-machines/skylark/pkg/provider/registry"
+	"github.com/butter-bot-machines/skylark/pkg/timing"
+)
+
+// scriptedProvider fails with err while it is set
+type scriptedProvider struct {
+	err   error
+	calls int
+}
+
+func (p *scriptedProvider) Send(ctx context.Context, messages []provider.Message, opts *provider.RequestOptions) (*provider.Response, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &provider.Response{Content: "ok"}, nil
+}
+
+func (p *scriptedProvider) Close() error {
+	return nil
+}
+
+// newGuarded returns a provider behind the circuit of openai in s
+func newGuarded(t *testing.T, s *Set, inner provider.Provider) provider.Provider {
+	t.Helper()
+	r := registry.New()
+	r.Register("openai", func(model string) (provider.Provider, error) { return inner, nil })
+	r.Wrap(s.Wrap)
+	p, err := r.CreateForModel("gpt-4", "openai")
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	return p
+}
+
+// drain empties the Changed channel, reporting whether it had a signal
+func drain(s *Set) bool {
+	select {
+	case <-s.Changed():
+		return true
+	default:
+		return false
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	mock := timing.NewMock()
+	s := New(config.BreakerConfig{Threshold: 3, Cooldown: time.Minute}, mock)
+	inner := &scriptedProvider{err: &provider.Error{Code: provider.ErrServerError, Message: "bad gateway"}}
+	p := newGuarded(t, s, inner)
+	send := func() error {
+		_, err := p.Send(context.Background(), nil, nil)
+		return err
+	}
+
+	// Other errors and successes keep the circuit closed
+	send()
+	send()
+	inner.err = &provider.Error{Code: provider.ErrInvalidInput}
+	send()
+	inner.err = nil
+	send()
+	if s.State("openai") != Closed || s.Holding() {
+		t.Fatalf("Expected a closed circuit, got %v", s.State("openai"))
+	}
+
+	// Consecutive rate limits open it
+	inner.err = &provider.Error{Code: provider.ErrRateLimit, Message: "slow down"}
+	for i := 0; i < 3; i++ {
+		send()
+	}
+	if s.State("openai") != Open || !s.Holding() || !drain(s) {
+		t.Fatalf("Expected an open circuit holding jobs, got %v", s.State("openai"))
+	}
+	calls := inner.calls
+	if err := send(); !errors.Is(err, ErrOpen) {
+		t.Errorf("Expected ErrOpen, got %v", err)
+	}
+	if inner.calls != calls {
+		t.Error("Expected no request while the circuit is open")
+	}
+
+	// After the cooldown one request probes; a failed probe reopens it
+	mock.Add(time.Minute)
+	if s.State("openai") != HalfOpen || s.Holding() || !drain(s) {
+		t.Fatalf("Expected a half-open circuit, got %v", s.State("openai"))
+	}
+	if err := send(); errors.Is(err, ErrOpen) {
+		t.Errorf("Expected the probe to reach the provider, got %v", err)
+	}
+	if s.State("openai") != Open {
+		t.Fatalf("Expected the failed probe to reopen the circuit, got %v", s.State("openai"))
+	}
+
+	// A successful probe closes it
+	mock.Add(time.Minute)
+	inner.err = nil
+	if err := send(); err != nil {
+		t.Fatalf("Expected the probe to succeed, got %v", err)
+	}
+	if s.State("openai") != Closed || s.Holding() {
+		t.Errorf("Expected a closed circuit, got %v", s.State("openai"))
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	s := New(config.BreakerConfig{Threshold: -1}, timing.NewMock())
+	inner := &scriptedProvider{err: &provider.Error{Code: provider.ErrServerError}}
+	p := newGuarded(t, s, inner)
+	for i := 0; i < 10; i++ {
+		p.Send(context.Background(), nil, nil)
+	}
+	if inner.calls != 10 || s.State("openai") != Closed {
+		t.Errorf("Expected every request to be sent, got %d and %v", inner.calls, s.State("openai"))
+	}
+}
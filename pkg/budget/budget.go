@@ -0,0 +1,216 @@
+// Package budget limits what providers may spend: the tokens of a run and
+// the cost of a day. Once a limit is reached, further requests fail with
+// ErrBudgetExceeded instead of reaching the provider.
+package budget
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+	"github.com/butter-bot-machines/skylark/pkg/models"
+	"github.com/butter-bot-machines/skylark/pkg/notify"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+	"github.com/butter-bot-machines/skylark/pkg/provider/registry"
+	"github.com/butter-bot-machines/skylark/pkg/security"
+	"github.com/butter-bot-machines/skylark/pkg/security/types"
+	"github.com/butter-bot-machines/skylark/pkg/state"
+	"github.com/butter-bot-machines/skylark/pkg/timing"
+)
+
+var logger = logging.Default()
+
+// ErrBudgetExceeded is returned for requests made after a limit was reached
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// spendFile holds the spending of the day, relative to the configuration
+// directory
+var spendFile = filepath.Join(state.Dir, "budget.json")
+
+// costCount names the cost of the day among the counts of spendFile
+const costCount = "cost"
+
+// Budget tracks spending against the limits of a configuration. It is safe
+// for concurrent use.
+type Budget struct {
+	cfg      *config.Config
+	clock    timing.Clock
+	auditLog security.AuditLogger
+	notifier *notify.Notifier
+	models   *models.Registry // Prices of models without configured ones
+
+	mu        sync.Mutex
+	runTokens int
+	spent     *state.Daily    // Cost of the day, persisted with a configuration directory
+	reported  map[string]bool // Limits whose breach was reported
+}
+
+// New creates a budget for cfg, loading the spending of the day from its
+// configuration directory. auditLog records breaches (optional); a nil
+// clock uses the real clock.
+func New(cfg *config.Config, auditLog security.AuditLogger, clock timing.Clock) (*Budget, error) {
+	if clock == nil {
+		clock = timing.New()
+	}
+	b := &Budget{
+		cfg:      cfg,
+		clock:    clock,
+		auditLog: auditLog,
+		models:   models.New(cfg.ModelMetadata),
+		reported: make(map[string]bool),
+	}
+	path := ""
+	if cfg.Environment.ConfigDir != "" {
+		path = filepath.Join(cfg.Environment.ConfigDir, spendFile)
+	}
+	spent, err := state.LoadDaily(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load budget spending: %w", err)
+	}
+	b.spent = spent
+	return b, nil
+}
+
+// SetNotifier sends budget_exceeded events to n when a limit is first
+// reached
+func (b *Budget) SetNotifier(n *notify.Notifier) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.notifier = n
+}
+
+// Check returns an error wrapping ErrBudgetExceeded when a limit has been
+// reached
+func (b *Budget) Check() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	limits := b.cfg.Budget
+	if limits.MaxTokensPerRun > 0 && b.runTokens >= limits.MaxTokensPerRun {
+		return b.exceeded("max_tokens_per_run",
+			fmt.Sprintf("%d tokens used this run, limit %d", b.runTokens, limits.MaxTokensPerRun))
+	}
+	if limits.MaxCostPerDay > 0 {
+		cost := b.todayLocked()
+		if cost >= limits.MaxCostPerDay {
+			return b.exceeded("max_cost_per_day",
+				fmt.Sprintf("%.4f spent today, limit %.4f", cost, limits.MaxCostPerDay))
+		}
+	}
+	return nil
+}
+
+// Add records the usage of a request to model of the named provider,
+// priced by the model's configuration or, when it sets no prices, by its
+// metadata
+func (b *Budget) Add(name, model string, u provider.Usage) error {
+	var cost float64
+	if prices, _ := b.cfg.GetModelConfig(name, model); prices.PromptCost > 0 || prices.CompletionCost > 0 {
+		cost = (float64(u.PromptTokens)*prices.PromptCost + float64(u.CompletionTokens)*prices.CompletionCost) / 1e6
+	} else if meta, ok := b.models.Lookup(model); ok {
+		cost = meta.Cost(u.PromptTokens, u.CompletionTokens)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.runTokens += u.TotalTokens
+	if cost == 0 {
+		return nil
+	}
+	b.todayLocked()
+	if err := b.spent.Add(costCount, cost); err != nil {
+		return fmt.Errorf("failed to save budget spending: %w", err)
+	}
+	return nil
+}
+
+// Spent returns the last day spending was recorded for and what was
+// spent on it
+func (b *Budget) Spent() (day string, cost float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.spent.Day(), b.spent.Get(costCount)
+}
+
+// Wrap returns a factory whose providers check the budget before each
+// request and record its usage after, for use with registry.Wrap
+func (b *Budget) Wrap(name string, factory registry.Factory) registry.Factory {
+	return func(model string) (provider.Provider, error) {
+		inner, err := factory(model)
+		if err != nil {
+			return nil, err
+		}
+		return &budgetedProvider{inner: inner, budget: b, name: name, model: model}, nil
+	}
+}
+
+// todayLocked returns the cost of the current day, starting a new day when
+// the date changed. The caller holds b.mu.
+func (b *Budget) todayLocked() float64 {
+	if b.spent.Roll(b.clock.Now()) {
+		delete(b.reported, "max_cost_per_day")
+	}
+	return b.spent.Get(costCount)
+}
+
+// exceeded returns the error for a reached limit, auditing and notifying
+// the first breach. The caller holds b.mu.
+func (b *Budget) exceeded(limit, detail string) error {
+	if b.reported[limit] {
+		return fmt.Errorf("%w: %s", ErrBudgetExceeded, detail)
+	}
+	b.reported[limit] = true
+	if b.auditLog != nil {
+		b.auditLog.Log(
+			types.EventBudgetExceeded,
+			types.SeverityWarning,
+			"budget",
+			fmt.Sprintf("budget %s reached: %s", limit, detail),
+			map[string]interface{}{
+				"limit":  limit,
+				"detail": detail,
+			},
+		)
+	}
+	b.notifier.Notify(notify.Event{
+		Type: config.NotifyBudgetExceeded,
+		Data: map[string]interface{}{
+			"limit":  limit,
+			"detail": detail,
+		},
+	})
+	return fmt.Errorf("%w: %s", ErrBudgetExceeded, detail)
+}
+
+// budgetedProvider implements provider.Provider within a budget
+type budgetedProvider struct {
+	inner  provider.Provider
+	budget *Budget
+	name   string
+	model  string
+}
+
+// Send implements provider.Provider
+func (p *budgetedProvider) Send(ctx context.Context, messages []provider.Message, opts *provider.RequestOptions) (*provider.Response, error) {
+	if err := p.budget.Check(); err != nil {
+		return nil, err
+	}
+	resp, err := p.inner.Send(ctx, messages, opts)
+	if resp != nil {
+		// The response was paid for, so it is returned even when the
+		// spending could not be saved
+		if addErr := p.budget.Add(p.name, p.model, resp.Usage); addErr != nil {
+			logging.FromContext(ctx, logger).Warn("failed to record budget spending", "error", addErr)
+		}
+	}
+	return resp, err
+}
+
+// Close implements provider.Provider
+func (p *budgetedProvider) Close() error {
+	return p.inner.Close()
+}
@@ -0,0 +1,164 @@
+package budget
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+	"github.com/butter-bot-machines/skylark/pkg/provider/registry"
+	"github.com/butter-bot-machines/skylark/pkg/security"
+	"github.com/butter-bot-machines/skylark/pkg/security/types"
+	"github.com/butter-bot-machines/skylark/pkg/timing"
+)
+
+// recordingLog records the types of logged events
+type recordingLog struct {
+	security.AuditLogger
+	events []types.EventType
+}
+
+func (r *recordingLog) Log(t types.EventType, _ types.Severity, _, _ string, _ map[string]interface{}) error {
+	r.events = append(r.events, t)
+	return nil
+}
+
+// fixedProvider responds with the same usage to every request
+type fixedProvider struct {
+	usage provider.Usage
+	calls int
+}
+
+func (p *fixedProvider) Send(ctx context.Context, messages []provider.Message, opts *provider.RequestOptions) (*provider.Response, error) {
+	p.calls++
+	return &provider.Response{Content: "ok", Usage: p.usage}, nil
+}
+
+func (p *fixedProvider) Close() error {
+	return nil
+}
+
+// newBudgeted returns a provider within a budget for cfg
+func newBudgeted(t *testing.T, cfg *config.Config, inner provider.Provider, log security.AuditLogger, clock timing.Clock) provider.Provider {
+	t.Helper()
+	b, err := New(cfg, log, clock)
+	if err != nil {
+		t.Fatalf("Failed to create budget: %v", err)
+	}
+	r := registry.New()
+	r.Register("openai", func(model string) (provider.Provider, error) { return inner, nil })
+	r.Wrap(b.Wrap)
+	p, err := r.CreateForModel("gpt-4", "openai")
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	return p
+}
+
+func TestMaxTokensPerRun(t *testing.T) {
+	inner := &fixedProvider{usage: provider.Usage{TotalTokens: 40}}
+	log := &recordingLog{}
+	p := newBudgeted(t, &config.Config{Budget: config.BudgetConfig{MaxTokensPerRun: 100}}, inner, log, nil)
+
+	// 40 + 40 + 40 passes the limit on the third request
+	for i := 0; i < 3; i++ {
+		if _, err := p.Send(context.Background(), provider.Prompt("hi"), nil); err != nil {
+			t.Fatalf("Request %d failed: %v", i+1, err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		_, err := p.Send(context.Background(), provider.Prompt("hi"), nil)
+		if !errors.Is(err, ErrBudgetExceeded) {
+			t.Errorf("Expected ErrBudgetExceeded, got %v", err)
+		}
+	}
+	if inner.calls != 3 {
+		t.Errorf("Expected 3 requests to reach the provider, got %d", inner.calls)
+	}
+	if len(log.events) != 1 || log.events[0] != types.EventBudgetExceeded {
+		t.Errorf("Expected one budget_exceeded event, got %v", log.events)
+	}
+}
+
+func TestMaxCostPerDay(t *testing.T) {
+	cfg := &config.Config{
+		Environment: config.EnvironmentConfig{ConfigDir: t.TempDir()},
+		Budget:      config.BudgetConfig{MaxCostPerDay: 1},
+		Models: map[string]config.ModelConfigSet{
+			"openai": {"gpt-4": {PromptCost: 10, CompletionCost: 30}},
+		},
+	}
+	clock := timing.NewMock()
+	clock.Set(time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local))
+
+	// Each request costs 20000*10/1e6 + 10000*30/1e6 = 0.5
+	inner := &fixedProvider{usage: provider.Usage{PromptTokens: 20000, CompletionTokens: 10000, TotalTokens: 30000}}
+	p := newBudgeted(t, cfg, inner, nil, clock)
+	for i := 0; i < 2; i++ {
+		if _, err := p.Send(context.Background(), provider.Prompt("hi"), nil); err != nil {
+			t.Fatalf("Request %d failed: %v", i+1, err)
+		}
+	}
+
+	// The spending is persisted, so a later run is blocked too
+	p = newBudgeted(t, cfg, inner, nil, clock)
+	if _, err := p.Send(context.Background(), provider.Prompt("hi"), nil); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("Expected ErrBudgetExceeded, got %v", err)
+	}
+
+	b, err := New(cfg, nil, clock)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if day, cost := b.Spent(); day != "2024-03-01" || cost != 1 {
+		t.Errorf("Expected 1 spent on 2024-03-01, got %v on %q", cost, day)
+	}
+
+	// A new day starts over
+	clock.Add(24 * time.Hour)
+	if _, err := p.Send(context.Background(), provider.Prompt("hi"), nil); err != nil {
+		t.Errorf("Expected requests the next day to pass, got %v", err)
+	}
+	if inner.calls != 3 {
+		t.Errorf("Expected 3 requests to reach the provider, got %d", inner.calls)
+	}
+}
+
+func TestMetadataPrices(t *testing.T) {
+	prompt, completion := 0.01, 0.03
+	cfg := &config.Config{
+		Environment: config.EnvironmentConfig{ConfigDir: t.TempDir()},
+		ModelMetadata: map[string]config.ModelMetadata{
+			"gpt-4": {PromptPer1K: &prompt, CompletionPer1K: &completion},
+		},
+	}
+	clock := timing.NewMock()
+	clock.Set(time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local))
+
+	// Without configured prices, 2000*0.01/1000 + 1000*0.03/1000 = 0.05
+	inner := &fixedProvider{usage: provider.Usage{PromptTokens: 2000, CompletionTokens: 1000, TotalTokens: 3000}}
+	p := newBudgeted(t, cfg, inner, nil, clock)
+	if _, err := p.Send(context.Background(), provider.Prompt("hi"), nil); err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+
+	b, err := New(cfg, nil, clock)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, cost := b.Spent(); cost < 0.0499 || cost > 0.0501 {
+		t.Errorf("Expected 0.05 spent, got %v", cost)
+	}
+}
+
+func TestNoLimits(t *testing.T) {
+	inner := &fixedProvider{usage: provider.Usage{TotalTokens: 1000000}}
+	p := newBudgeted(t, &config.Config{}, inner, nil, nil)
+	for i := 0; i < 3; i++ {
+		if _, err := p.Send(context.Background(), provider.Prompt("hi"), nil); err != nil {
+			t.Fatalf("Request %d failed: %v", i+1, err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/butter-bot-machines/skylark/pkg/assistant"
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/provider/registry"
+)
+
+// Assistant manages the assistants of the project
+func (c *CLI) Assistant(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("expected 'install', 'versions', 'diff' or 'compare' subcommand")
+	}
+
+	switch args[0] {
+	case "install":
+		opts, source, err := parseInstallArgs(args[1:])
+		if err != nil {
+			return err
+		}
+		if err := c.loadConfig(); err != nil {
+			return err
+		}
+		cfg := c.config.GetConfig()
+		opts.AssistantsDir = filepath.Join(cfg.Environment.ConfigDir, "assistants")
+		opts.ToolsDir = filepath.Join(cfg.Environment.ConfigDir, "tools")
+
+		installed, err := assistant.Install(source, opts)
+		if err != nil {
+			return err
+		}
+		printInstalled(os.Stdout, installed, cfg)
+		return nil
+	case "versions":
+		return c.assistantVersions(args[1:])
+	case "diff":
+		return c.assistantDiff(args[1:])
+	case "compare":
+		return c.assistantCompare(args[1:])
+	default:
+		return fmt.Errorf("unknown assistant command: %s", args[0])
+	}
+}
+
+// parseInstallArgs parses `install <git-url|path> [--name <name>] [--force]`
+func parseInstallArgs(args []string) (assistant.InstallOptions, string, error) {
+	var opts assistant.InstallOptions
+	var source string
+	fs := newFlagSet("assistant install")
+	fs.BoolVar(&opts.Force, "force", false, "replace an installed assistant of the same name")
+	fs.StringVar(&opts.Name, "name", "", "install under this name")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return opts, "", err
+	}
+	if len(args) > 0 {
+		source = args[0]
+		if err := noArguments(args[1:]); err != nil {
+			return opts, "", err
+		}
+	}
+	if source == "" {
+		return opts, "", fmt.Errorf("expected 'assistant install <git-url|path> [--name <name>] [--force]'")
+	}
+	return opts, source, nil
+}
+
+// printInstalled reports an installed assistant, warning when its model
+// is not configured
+func printInstalled(w io.Writer, installed *assistant.Installed, cfg *config.Config) {
+	fmt.Fprintf(w, "Installed assistant %s to %s\n", installed.Name, installed.Path)
+	if len(installed.Tools) > 0 {
+		fmt.Fprintf(w, "Installed tools: %s\n", strings.Join(installed.Tools, ", "))
+	}
+	if installed.Model == "" {
+		return
+	}
+	if policy, ok := strings.CutPrefix(installed.Model, assistant.RoutePrefix); ok {
+		if _, ok := cfg.Routing[policy]; !ok {
+			fmt.Fprintf(w, "Warning: routing policy %s is not configured; add it under routing in config.yaml\n", policy)
+		}
+		return
+	}
+	providerName, model := registry.ParseModelSpec(installed.Model)
+	if providerName == "" {
+		providerName = "openai"
+	}
+	if _, ok := cfg.GetModelConfig(providerName, model); !ok {
+		fmt.Fprintf(w, "Warning: model %s is not configured; add it under models.%s in config.yaml\n", installed.Model, providerName)
+	}
+}
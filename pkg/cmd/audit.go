@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	secconcrete "github.com/butter-bot-machines/skylark/pkg/security/concrete"
+	"github.com/butter-bot-machines/skylark/pkg/security/types"
+)
+
+// auditOptions holds the parsed arguments of audit query and export
+type auditOptions struct {
+	query  secconcrete.EventQuery
+	output string // query: text or json
+	format string // export: json or csv
+}
+
+// parseAuditArgs parses `[--since <age|time>] [--until <age|time>]
+// [--type <type>] [--source <source>] [--severity <severity>]
+// [--output text|json] [--format json|csv]`. Type, source and severity may
+// be repeated or given as comma-separated lists.
+func parseAuditArgs(args []string, now time.Time) (*auditOptions, error) {
+	opts := &auditOptions{}
+	fs := newFlagSet("audit")
+	fs.Func("since", "events at or after an `age` or time", func(value string) (err error) {
+		opts.query.Since, err = parseAuditTime(value, now)
+		return err
+	})
+	fs.Func("until", "events before an `age` or time", func(value string) (err error) {
+		opts.query.Until, err = parseAuditTime(value, now)
+		return err
+	})
+	fs.Func("type", "event types, repeatable", func(value string) error {
+		for _, v := range splitList(value) {
+			opts.query.Types = append(opts.query.Types, types.EventType(v))
+		}
+		return nil
+	})
+	fs.Func("source", "event sources, repeatable", func(value string) error {
+		opts.query.Sources = append(opts.query.Sources, splitList(value)...)
+		return nil
+	})
+	fs.Func("severity", "event severities, repeatable", func(value string) error {
+		for _, v := range splitList(value) {
+			opts.query.Severities = append(opts.query.Severities, types.Severity(v))
+		}
+		return nil
+	})
+	fs.StringVar(&opts.output, "output", outputText, "text or json")
+	fs.StringVar(&opts.format, "format", secconcrete.ExportJSON, "export as json or csv")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if err := noArguments(args); err != nil {
+		return nil, err
+	}
+
+	if err := validateOutput(opts.output); err != nil {
+		return nil, err
+	}
+	if opts.format != secconcrete.ExportJSON && opts.format != secconcrete.ExportCSV {
+		return nil, fmt.Errorf("--format must be %q or %q, got %q", secconcrete.ExportJSON, secconcrete.ExportCSV, opts.format)
+	}
+	return opts, nil
+}
+
+// parseAuditTime reads an age before now, such as 24h, 30m or 7d, or an
+// RFC 3339 time or date
+func parseAuditTime(value string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("expected an age such as 24h or 7d, or a time such as 2006-01-02, got %q", value)
+}
+
+// splitList splits a comma-separated flag value
+func splitList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// Audit queries and exports the security audit log
+func (c *CLI) Audit(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("expected 'query', 'export' or 'verify' subcommands")
+	}
+	switch args[0] {
+	case "query", "export":
+	case "verify":
+		if len(args) > 1 {
+			return fmt.Errorf("unexpected argument: %s", args[1])
+		}
+		return c.verifyAudit()
+	default:
+		return fmt.Errorf("unknown audit command: %s", args[0])
+	}
+
+	opts, err := parseAuditArgs(args[1:], time.Now())
+	if err != nil {
+		return err
+	}
+	opts.output = c.outputFormat(opts.output)
+
+	// Stdout carries only the events
+	out, restore := c.reserveStdout()
+	defer restore()
+
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+	path := c.config.GetConfig().Security.AuditLog.Path
+	if path == "" {
+		return fmt.Errorf("no audit log configured: set security.audit_log.path")
+	}
+
+	events, err := secconcrete.ReadAuditLog(path, opts.query)
+	if err != nil {
+		return err
+	}
+
+	if args[0] == "export" {
+		return secconcrete.ExportEvents(out, events, opts.format)
+	}
+	if opts.output == outputJSON {
+		return secconcrete.ExportEvents(out, events, secconcrete.ExportJSON)
+	}
+	printAuditEvents(out, events)
+	return nil
+}
+
+// verifyAudit checks the hash chain and checkpoint signatures of the audit
+// log, failing when it was tampered with
+func (c *CLI) verifyAudit() error {
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+	cfg := c.config.GetConfig().Security.AuditLog
+	if cfg.Path == "" {
+		return fmt.Errorf("no audit log configured: set security.audit_log.path")
+	}
+
+	report, err := secconcrete.VerifyAuditLog(cfg.Path, cfg.CheckpointSecret)
+	if err != nil {
+		return err
+	}
+	printVerifyReport(os.Stdout, report, cfg.CheckpointSecret != "")
+	return nil
+}
+
+// printVerifyReport writes the result of a successful verification
+func printVerifyReport(w io.Writer, report *secconcrete.VerifyReport, signed bool) {
+	fmt.Fprintf(w, "Audit log verified: %d events, %d signed checkpoints\n", report.Events, report.Checkpoints)
+	if !signed {
+		fmt.Fprintln(w, "Checkpoint signatures were not checked: set security.audit_log.checkpoint_secret")
+	} else if report.Unsigned > 0 {
+		fmt.Fprintf(w, "%d events after the last checkpoint are not covered by a signature\n", report.Unsigned)
+	}
+	if report.Unchained > 0 {
+		fmt.Fprintf(w, "%d events written before hash chaining could not be verified\n", report.Unchained)
+	}
+}
+
+// printAuditEvents writes a table of audit events
+func printAuditEvents(w io.Writer, events []*types.Event) {
+	if len(events) == 0 {
+		fmt.Fprintln(w, "No matching audit events")
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tTYPE\tSEVERITY\tSOURCE\tDETAILS")
+	for _, e := range events {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			e.Timestamp.Local().Format(time.DateTime),
+			e.Type,
+			e.Severity,
+			e.Source,
+			firstLine(e.Details))
+	}
+	tw.Flush()
+}
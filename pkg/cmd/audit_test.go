@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	secconcrete "github.com/butter-bot-machines/skylark/pkg/security/concrete"
+	"github.com/butter-bot-machines/skylark/pkg/security/types"
+)
+
+func TestParseAuditArgs(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    auditOptions
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			want: auditOptions{output: outputText, format: secconcrete.ExportJSON},
+		},
+		{
+			name: "filters",
+			args: []string{"--since", "24h", "--type", "access_denied,content_filtered", "--source", "file_guard", "--severity", "error"},
+			want: auditOptions{
+				query: secconcrete.EventQuery{
+					Since:      now.Add(-24 * time.Hour),
+					Types:      []types.EventType{types.EventAccessDenied, types.EventContentFiltered},
+					Sources:    []string{"file_guard"},
+					Severities: []types.Severity{types.SeverityError},
+				},
+				output: outputText,
+				format: secconcrete.ExportJSON,
+			},
+		},
+		{
+			name: "days and times",
+			args: []string{"--since", "7d", "--until", "2026-10-16T06:00:00Z", "--format", "csv"},
+			want: auditOptions{
+				query: secconcrete.EventQuery{
+					Since: now.AddDate(0, 0, -7),
+					Until: time.Date(2026, 10, 16, 6, 0, 0, 0, time.UTC),
+				},
+				output: outputText,
+				format: secconcrete.ExportCSV,
+			},
+		},
+		{name: "invalid since", args: []string{"--since", "yesterday"}, wantErr: "invalid --since"},
+		{name: "missing value", args: []string{"--type"}, wantErr: "--type requires a value"},
+		{name: "unknown format", args: []string{"--format", "xml"}, wantErr: "--format must be"},
+		{name: "unknown flag", args: []string{"--limit", "10"}, wantErr: "unknown flag"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAuditArgs(tt.args, now)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("Expected %+v, got %+v", tt.want, *got)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/butter-bot-machines/skylark/pkg/batch"
+	"github.com/butter-bot-machines/skylark/pkg/fs/osfs"
+	"github.com/butter-bot-machines/skylark/pkg/ignore"
+	"github.com/butter-bot-machines/skylark/pkg/processor/concrete"
+)
+
+// Output formats of run and exec
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// runOptions holds the parsed arguments of run
+type runOptions struct {
+	manifest string
+	report   string
+	output   string
+	diff     bool
+}
+
+// parseRunArgs parses `run [--manifest <path> [--report <path>]] [--output text|json] [--diff]`
+func parseRunArgs(args []string) (*runOptions, error) {
+	opts := &runOptions{}
+	fs := newFlagSet("run")
+	fs.StringVar(&opts.manifest, "manifest", "", "batch manifest to run")
+	fs.StringVar(&opts.report, "report", "", "file the batch report is written to")
+	fs.StringVar(&opts.output, "output", outputText, "text or json")
+	fs.BoolVar(&opts.diff, "diff", false, "preview changes without writing them")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if err := noArguments(args); err != nil {
+		return nil, err
+	}
+	if opts.report != "" && opts.manifest == "" {
+		return nil, fmt.Errorf("--report requires --manifest")
+	}
+	if err := validateOutput(opts.output); err != nil {
+		return nil, err
+	}
+	if opts.diff && (opts.manifest != "" || opts.output != outputText) {
+		return nil, fmt.Errorf("--diff cannot be combined with --manifest or --output")
+	}
+	return opts, nil
+}
+
+// validateOutput checks an --output value
+func validateOutput(output string) error {
+	if output != outputText && output != outputJSON {
+		return fmt.Errorf("--output must be %q or %q, got %q", outputText, outputJSON, output)
+	}
+	return nil
+}
+
+// runManifest runs the commands of the files a batch manifest lists and
+// writes a JSON report of every command. Without a report path, the
+// report is the only output on stdout.
+func (c *CLI) runManifest(opts *runOptions) error {
+	m, err := batch.LoadManifest(opts.manifest)
+	if err != nil {
+		return err
+	}
+	reportPath := opts.report
+	if reportPath == "" {
+		reportPath = m.ReportPath()
+	}
+	return c.runBatch(m, m.Resolve, reportPath)
+}
+
+// runJSON processes every Markdown file like run, continuing past
+// failures, and prints a JSON report of every command instead of progress
+func (c *CLI) runJSON() error {
+	return c.runBatch(&batch.Manifest{OnFailure: batch.OnFailureContinue}, c.projectFiles, "")
+}
+
+// runBatch runs the commands of the files resolve returns, once the
+// configuration is loaded, as m describes and writes the JSON report to
+// reportPath, or as the only output on stdout when it is empty
+func (c *CLI) runBatch(m *batch.Manifest, resolve func() ([]string, error), reportPath string) error {
+	var out io.Writer = os.Stdout
+	if reportPath == "" {
+		protocolOut, restore := c.reserveStdout()
+		defer restore()
+		out = protocolOut
+	}
+
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+
+	// Open the audit log and export traces
+	teardown, err := c.setupRuntime()
+	if err != nil {
+		return err
+	}
+	defer teardown()
+
+	cfg := c.config.GetConfig()
+	files, err := resolve()
+	if err != nil {
+		return err
+	}
+	if m.Concurrency == 0 {
+		m.Concurrency = cfg.Workers.Count
+	}
+
+	proc, err := c.newProcessor(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create processor: %w", err)
+	}
+	defer proc.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	c.logger.Info("starting batch run",
+		"file_count", len(files),
+		"concurrency", m.Concurrency,
+		"on_failure", m.OnFailure)
+	report := batch.NewRunner(proc, concrete.NewParser(cfg), nil).Run(ctx, m, files)
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	data = append(data, '\n')
+	if reportPath != "" {
+		if err := osfs.WriteFile(reportPath, data, 0644, false); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+	} else if _, err := out.Write(data); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+
+	s := report.Summary
+	c.logger.Info("batch run complete",
+		"commands", s.Commands,
+		"succeeded", s.Succeeded,
+		"failed", s.Failed,
+		"skipped", s.Skipped,
+		"files_failed", s.FilesFailed,
+		"total_tokens", s.Tokens.TotalTokens)
+	if report.Failed() {
+		err := fmt.Errorf("batch failed: %d of %d commands failed, %d skipped, %d of %d files failed",
+			s.Failed, s.Commands, s.Skipped, s.FilesFailed, s.Files)
+		var errs []error
+		for _, r := range report.Commands {
+			if r.Err != nil {
+				errs = append(errs, r.Err)
+			}
+		}
+		for _, f := range report.Files {
+			if f.Status == batch.StatusFailed && f.Error != "" {
+				errs = append(errs, errors.New(f.Error))
+			}
+		}
+		return partialFailure(err, errs, s.Succeeded > 0)
+	}
+	return nil
+}
+
+// projectFiles returns the Markdown files under the working directory
+// that the project's ignore rules do not exclude
+func (c *CLI) projectFiles() ([]string, error) {
+	cfg := c.config.GetConfig()
+	ignored, err := ignore.Load(filepath.Dir(cfg.Environment.ConfigDir), cfg.FileWatch.Ignore)
+	if err != nil {
+		return nil, err
+	}
+	return markdownFiles(".", ignored)
+}
+
+// markdownFiles returns the Markdown files under dir, outside of .skai and
+// not ignored
+func markdownFiles(dir string, ignored *ignore.Matcher) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".skai" || (path != dir && ignored.Ignored(path, true)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) == ".md" && !ignored.Ignored(path, false) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk directory: %w", err)
+	}
+	return files, nil
+}
@@ -1,18 +1,27 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"syscall"
 	"time"
 
+	"github.com/butter-bot-machines/skylark/pkg/breaker"
 	"github.com/butter-bot-machines/skylark/pkg/config"
+	skerrors "github.com/butter-bot-machines/skylark/pkg/errors"
 	"github.com/butter-bot-machines/skylark/pkg/job"
 	"github.com/butter-bot-machines/skylark/pkg/logging"
 	slogging "github.com/butter-bot-machines/skylark/pkg/logging/slog"
+	"github.com/butter-bot-machines/skylark/pkg/notify"
+	"github.com/butter-bot-machines/skylark/pkg/processor"
 	"github.com/butter-bot-machines/skylark/pkg/processor/concrete"
-	wconcrete "github.com/butter-bot-machines/skylark/pkg/watcher/concrete"
+	"github.com/butter-bot-machines/skylark/pkg/security"
 	"github.com/butter-bot-machines/skylark/pkg/worker"
 	wkconcrete "github.com/butter-bot-machines/skylark/pkg/worker/concrete"
 )
@@ -21,8 +30,20 @@ const Version = "0.1.0"
 
 // CLI represents the command-line interface
 type CLI struct {
-	config *config.Manager
-	logger logging.Logger
+	config   *config.Manager
+	logger   logging.Logger
+	auditLog security.AuditLogger
+	logFile  io.Closer // Open log file, when environment.log_file is set
+	runID    string    // Correlates all log entries of this invocation
+	notifier *notify.Notifier
+	breakers *breaker.Set
+	offline  bool // Offline mode was forced with --offline
+
+	// Global flags, given before the command
+	configPath string // --config: .skai directory or config.yaml to use
+	logLevel   string // --log-level: overrides environment.log_level
+	quiet      bool   // --quiet: print errors and requested output only
+	json       bool   // --json: print reports and results as JSON
 }
 
 // NewCLI creates a new CLI instance
@@ -34,10 +55,31 @@ func NewCLI() *CLI {
 
 // Run executes the CLI with the given arguments
 func (c *CLI) Run(args []string) error {
+	args, err := c.parseGlobalFlags(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if level, err := c.level(""); err == nil {
+		c.logger = slogging.NewLogger(level, os.Stdout)
+	}
 	if len(args) < 1 {
-		return fmt.Errorf("expected 'init', 'watch', 'run' or 'version' subcommands")
+		return skerrors.Typed(fmt.Errorf("expected 'init', 'watch', 'run', 'daemon', 'status', 'pause', 'resume', 'reload', 'jobs', 'audit', 'review', 'eval', 'assistant', 'tool', 'secret', 'exec', 'repl', 'template', 'mcp', 'lsp', 'doctor', 'service', 'token', 'self-update' or 'version' subcommands"), ExitUsage)
 	}
+	defer c.closeLogging()
+	defer c.closeNotifier()
 
+	// Asking a command for help is not an error
+	if err := c.dispatch(args); !errors.Is(err, flag.ErrHelp) {
+		return err
+	}
+	return nil
+}
+
+// dispatch runs the command args name
+func (c *CLI) dispatch(args []string) error {
 	switch args[0] {
 	case "init":
 		return c.Init(args[1:])
@@ -45,10 +87,48 @@ func (c *CLI) Run(args []string) error {
 		return c.Watch(args[1:])
 	case "run":
 		return c.RunOnce(args[1:])
+	case "daemon":
+		return c.Daemon(args[1:])
+	case "status":
+		return c.Status(args[1:])
+	case "pause", "resume", "reload":
+		return c.Control(args[0], args[1:])
+	case "jobs":
+		return c.Jobs(args[1:])
+	case "audit":
+		return c.Audit(args[1:])
+	case "review":
+		return c.Review(args[1:])
+	case "eval":
+		return c.Eval(args[1:])
+	case "assistant":
+		return c.Assistant(args[1:])
+	case "tool":
+		return c.Tool(args[1:])
+	case "secret":
+		return c.Secret(args[1:])
+	case "exec":
+		return c.Exec(args[1:])
+	case "repl":
+		return c.REPL(args[1:])
+	case "template":
+		return c.Template(args[1:])
+	case "mcp":
+		return c.MCP(args[1:])
+	case "lsp":
+		return c.LSP(args[1:])
+	case "doctor":
+		return c.Doctor(args[1:])
+	case "service":
+		return c.Service(args[1:])
+	case "token":
+		return c.Token(args[1:])
+	case "self-update":
+		return c.SelfUpdate(args[1:])
 	case "version":
 		return c.Version(args[1:])
 	default:
-		return fmt.Errorf("unknown command: %s", args[0])
+		return skerrors.Typed(fmt.Errorf("unknown command: %s", args[0]), ExitUsage)
 	}
 }
 
@@ -91,6 +171,11 @@ environment:
   log_level: "info"
   log_file: "skylark.log"
 
+logging:
+  format: json
+  max_size: 10      # megabytes before skylark.log is rotated
+  max_backups: 5
+
 models:
   openai:
     gpt-4:
@@ -112,11 +197,15 @@ tools:
 
 workers:
   count: 4
+  max: 8
   queue_size: 100
+  shutdown_grace: "10s"
+  retry_backoff: "1s"
 
 file_watch:
   debounce_delay: "500ms"
   max_delay: "2s"
+  backend: auto  # fsnotify, poll or auto
   extensions:
     - ".md"
 
@@ -145,24 +234,25 @@ When processing commands, you should:
 		return fmt.Errorf("failed to create prompt.md: %w", err)
 	}
 
-	fmt.Printf("Initialized Skylark project in %s\n", projectDir)
+	c.infof("Initialized Skylark project in %s\n", projectDir)
 	return nil
 }
 
 // Watch starts watching for file changes
 func (c *CLI) Watch(args []string) error {
-	// Parse timeout flag
+	// Parse flags
 	var timeout time.Duration
-	if len(args) > 0 && args[0] == "--timeout" {
-		if len(args) < 2 {
-			return fmt.Errorf("--timeout requires a duration (e.g., 5s)")
-		}
-		var err error
-		timeout, err = time.ParseDuration(args[1])
-		if err != nil {
-			return fmt.Errorf("invalid timeout duration: %w", err)
-		}
-		args = args[2:]
+	var noResume bool
+	fs := newFlagSet("watch")
+	fs.DurationVar(&timeout, "timeout", 0, "stop watching after `duration`, e.g. 5s")
+	fs.BoolVar(&noResume, "no-resume", false, "discard jobs queued by the last run")
+	fs.BoolVar(&c.offline, "offline", false, "queue commands instead of sending them")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := noArguments(args); err != nil {
+		return err
 	}
 
 	// Load configuration
@@ -170,62 +260,37 @@ func (c *CLI) Watch(args []string) error {
 		return err
 	}
 
-	c.logger.Info("starting watch command",
-		"timeout", timeout)
-
-	// Create processor
-	proc, err := concrete.NewProcessor(c.config.GetConfig())
+	// Open the audit log and export traces
+	teardown, err := c.setupRuntime()
 	if err != nil {
-		return fmt.Errorf("failed to create processor: %w", err)
-	}
-
-	// Create worker pool
-	cfg := c.config.GetConfig()
-	c.logger.Debug("creating worker pool",
-		"worker_count", cfg.Workers.Count,
-		"queue_size", cfg.Workers.QueueSize)
-
-	pool, err := wkconcrete.NewPool(worker.Options{
-		Config:    c.config,
-		Logger:    c.logger,
-		ProcMgr:   proc.GetProcessManager(),
-		QueueSize: cfg.Workers.QueueSize,
-		Workers:   cfg.Workers.Count,
-	})
-	if err != nil {
-		return fmt.Errorf("failed to create worker pool: %w", err)
+		return err
 	}
-	defer pool.Stop()
+	defer teardown()
 
-	// Create channels
-	jobQueue := make(chan job.Job, cfg.Workers.QueueSize)
-	done := make(chan struct{})
-	progressDone := make(chan struct{})
-	sigChan := make(chan os.Signal, 1)
+	c.logger.Info("starting watch command",
+		"timeout", timeout,
+		"resume", !noResume,
+		"offline", c.offline)
 
-	// Start components
-	c.logger.Debug("creating file watcher")
-	watcher, err := wconcrete.NewWatcher(cfg, jobQueue, proc)
+	sess, err := c.startSession()
 	if err != nil {
-		return fmt.Errorf("failed to create watcher: %w", err)
+		return err
 	}
-
-	// Start worker pool consumer
-	go func() {
-		defer close(done)
-		for j := range jobQueue {
-			pool.Queue() <- j
-		}
-	}()
+	pool := sess.pool
 
 	// Start progress monitoring
+	progressDone := make(chan struct{})
 	go c.monitorProgress(pool, progressDone)
 
+	// Replay jobs left over from the previous run
+	sess.resume(noResume)
+
 	// Show initial message
-	fmt.Println("Watching for changes...")
+	c.infof("Watching for changes...\n")
 
 	// Wait for interrupt or timeout
-	signal.Notify(sigChan, os.Interrupt)
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
 	if timeout > 0 {
 		// Use timeout if specified
@@ -241,62 +306,91 @@ func (c *CLI) Watch(args []string) error {
 		c.logger.Info("received interrupt")
 	}
 
-	// Cleanup in reverse order of creation
-	c.logger.Info("shutting down")
-
-	// 1. Stop accepting new events
-	watcher.Stop()
-	c.logger.Debug("stopped file watcher")
-
-	// 2. Stop accepting new jobs
-	close(jobQueue)
-	c.logger.Debug("closed job queue")
-
-	// 3. Wait for worker to finish
-	<-done
-	c.logger.Debug("worker pool drained")
+	sess.shutdown()
 
-	// 4. Stop progress monitoring
+	// Stop progress monitoring
 	close(progressDone)
 	c.logger.Debug("stopped progress monitoring")
 
 	// Final stats
 	stats := pool.Stats()
 	c.logger.Info("final status",
-		"processed", stats.ProcessedJobs(),
-		"failed", stats.FailedJobs(),
-		"queued", stats.QueuedJobs())
+		"processed", stats.ProcessedJobs,
+		"failed", stats.FailedJobs,
+		"queued", stats.QueuedJobs,
+		"scaled_up", stats.ScaledUp,
+		"scaled_down", stats.ScaledDown,
+		"avg_duration", stats.AvgDuration,
+		"p95_duration", stats.Latency.Quantile(0.95),
+		"errors", stats.Errors)
 
 	return nil
 }
 
-// RunOnce processes files once without watching
+// RunOnce processes files once without watching. With --manifest, only
+// the files the manifest lists are processed and a JSON report is written;
+// --output json prints the same report for every file.
 func (c *CLI) RunOnce(args []string) error {
+	opts, err := parseRunArgs(args)
+	if err != nil {
+		return err
+	}
+	if !opts.diff {
+		opts.output = c.outputFormat(opts.output)
+	}
+	if opts.manifest != "" {
+		return c.runManifest(opts)
+	}
+	if opts.output == outputJSON {
+		return c.runJSON()
+	}
+	if opts.diff {
+		return c.runDiff()
+	}
+
 	// Load configuration
 	if err := c.loadConfig(); err != nil {
 		return err
 	}
 
+	// Open the audit log and export traces
+	teardown, err := c.setupRuntime()
+	if err != nil {
+		return err
+	}
+	defer teardown()
+
 	c.logger.Info("starting run command")
 
 	// Create processor
-	proc, err := concrete.NewProcessor(c.config.GetConfig())
+	proc, err := c.newProcessor(c.config.GetConfig())
 	if err != nil {
 		return fmt.Errorf("failed to create processor: %w", err)
 	}
+	defer proc.Close()
 
 	// Create worker pool
 	cfg := c.config.GetConfig()
 	c.logger.Debug("creating worker pool",
 		"worker_count", cfg.Workers.Count,
+		"max_workers", cfg.Workers.Max,
 		"queue_size", cfg.Workers.QueueSize)
 
 	pool, err := wkconcrete.NewPool(worker.Options{
-		Config:    c.config,
-		Logger:    c.logger,
-		ProcMgr:   proc.GetProcessManager(),
-		QueueSize: cfg.Workers.QueueSize,
-		Workers:   cfg.Workers.Count,
+		Config:       c.config,
+		Logger:       c.logger,
+		ProcMgr:      proc.GetProcessManager(),
+		QueueSize:    cfg.Workers.QueueSize,
+		Workers:      cfg.Workers.Count,
+		RetryBackoff: cfg.Workers.RetryBackoff,
+		JobTimeout:   cfg.Workers.JobTimeout,
+		Gates:        []worker.Gate{c.circuitBreakers(cfg)},
+		DeadLetters:  c.deadLetters(),
+
+		MaxWorkers:     cfg.Workers.Max,
+		ScaleThreshold: cfg.Workers.ScaleThreshold,
+		IdleTimeout:    cfg.Workers.IdleTimeout,
+		Concurrency:    cfg.AssistantConcurrency(),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create worker pool: %w", err)
@@ -308,43 +402,34 @@ func (c *CLI) RunOnce(args []string) error {
 	go c.monitorProgress(pool, done)
 
 	// Queue files for processing
-	fileCount := 0
 	c.logger.Debug("scanning for markdown files")
-
-	err = filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
+	files, err := c.projectFiles()
+	if err != nil {
+		return err
+	}
+	fileCount := len(files)
+	ctx := context.Background()
+	futures := make([]*worker.Future[struct{}], 0, fileCount)
+	for _, path := range files {
+		c.logger.Debug("queueing file", "path", path)
+		future, err := worker.Submit(ctx, pool, worker.FromJob(job.NewFileChangeJob(path, proc)))
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to queue %s: %w", path, err)
 		}
-		// Skip .skai directory and non-markdown files
-		if info.IsDir() {
-			if filepath.Base(path) == ".skai" {
-				return filepath.SkipDir // Skip the entire .skai directory
-			}
-			return nil
-		}
-		if filepath.Ext(path) == ".md" {
-			c.logger.Debug("queueing file", "path", path)
-			pool.Queue() <- job.NewFileChangeJob(path, proc)
-			fileCount++
-		}
-		return nil
-	})
-	if err != nil {
-		return fmt.Errorf("failed to walk directory: %w", err)
+		futures = append(futures, future)
 	}
 
 	// Show initial count
 	c.logger.Info("starting processing",
 		"file_count", fileCount)
-	fmt.Printf("Processing %d files...\n", fileCount)
+	c.infof("Processing %d files...\n", fileCount)
 
 	// Wait for all jobs to complete
-	for {
-		stats := pool.Stats()
-		if stats.ProcessedJobs()+stats.FailedJobs() == uint64(fileCount) {
-			break
+	var errs []error
+	for _, future := range futures {
+		if _, err := future.Wait(ctx); err != nil {
+			errs = append(errs, err)
 		}
-		time.Sleep(100 * time.Millisecond)
 	}
 
 	// Signal progress monitor to stop
@@ -353,41 +438,57 @@ func (c *CLI) RunOnce(args []string) error {
 	// Get final status
 	stats := pool.Stats()
 	c.logger.Info("processing complete",
-		"processed", stats.ProcessedJobs(),
-		"failed", stats.FailedJobs(),
-		"total", fileCount)
-
-	if stats.FailedJobs() > 0 {
-		return fmt.Errorf("%d/%d files failed processing", stats.FailedJobs(), fileCount)
+		"processed", stats.ProcessedJobs,
+		"failed", stats.FailedJobs,
+		"total", fileCount,
+		"avg_duration", stats.AvgDuration,
+		"p95_duration", stats.Latency.Quantile(0.95),
+		"errors", stats.Errors)
+
+	if stats.FailedJobs > 0 {
+		err := fmt.Errorf("%d/%d files failed processing", stats.FailedJobs, fileCount)
+		return partialFailure(err, errs, int(stats.FailedJobs) < fileCount)
 	}
 
-	fmt.Printf("\nSuccessfully processed %d files\n", stats.ProcessedJobs())
+	c.infof("\nSuccessfully processed %d files\n", stats.ProcessedJobs)
 	return nil
 }
 
-// monitorProgress displays progress information
+// monitorProgress displays job progress until done is closed. Terminals get
+// a live per-file view; other outputs get one line per event. Nothing is
+// shown with --quiet.
 func (c *CLI) monitorProgress(pool worker.Pool, done chan struct{}) {
-	ticker := time.NewTicker(500 * time.Millisecond)
+	if c.quiet {
+		return
+	}
+	events, unsubscribe := pool.Subscribe()
+	defer unsubscribe()
+
+	ticker := time.NewTicker(progressInterval)
 	defer ticker.Stop()
 
-	var lastStats worker.Stats
+	interactive := isTerminal(os.Stdout)
+	view := newProgressView()
 	for {
 		select {
 		case <-done:
+			if interactive {
+				view.render(os.Stdout, pool.Stats(), time.Now())
+			}
 			return
+		case e := <-events:
+			c.logger.Debug("job progress",
+				"event", e.Type,
+				"file", e.File,
+				"attempt", e.Attempt)
+			view.apply(e)
+			if !interactive {
+				printEvent(os.Stdout, e)
+			}
 		case <-ticker.C:
-			stats := pool.Stats()
-			if stats != lastStats {
-				c.logger.Debug("progress update",
-					"processed", stats.ProcessedJobs(),
-					"failed", stats.FailedJobs(),
-					"queued", stats.QueuedJobs())
-				lastStats = stats
+			if interactive {
+				view.render(os.Stdout, pool.Stats(), time.Now())
 			}
-			fmt.Printf("\rProcessed: %d, Failed: %d, Queued: %d",
-				stats.ProcessedJobs(),
-				stats.FailedJobs(),
-				stats.QueuedJobs())
 		}
 	}
 }
@@ -401,18 +502,47 @@ func (c *CLI) Version(args []string) error {
 // loadConfig loads and validates the configuration
 func (c *CLI) loadConfig() error {
 	// Find .skai directory
-	dir, err := findSkaiDir()
+	dir, err := c.skaiDir()
 	if err != nil {
-		return err
+		return skerrors.Typed(err, ExitConfig)
 	}
 
 	// Load configuration
 	c.config = config.NewManager(dir)
 	if err := c.config.Load(); err != nil {
-		return fmt.Errorf("failed to load configuration: %w", err)
+		return skerrors.Typed(fmt.Errorf("failed to load configuration: %w", err), ExitConfig)
 	}
 
-	return nil
+	return skerrors.Typed(c.setupLogging(), ExitConfig)
+}
+
+// setupRuntime opens the audit log according to its failure policy and
+// exports traces when configured. The returned function flushes the traces
+// and closes the audit log.
+func (c *CLI) setupRuntime() (func(), error) {
+	if err := c.openAuditLog(); err != nil {
+		return nil, err
+	}
+	stopTracing, err := c.startTracing()
+	if err != nil {
+		c.closeAuditLog()
+		return nil, err
+	}
+	return func() {
+		stopTracing()
+		c.closeAuditLog()
+	}, nil
+}
+
+// newProcessor creates a processor for cfg that records content filter
+// matches in the audit log, when one is open, and sends processing events
+// to the configured notifications
+func (c *CLI) newProcessor(cfg *config.Config) (processor.ProcessManager, error) {
+	return concrete.NewProcessorWithOptions(cfg, concrete.Options{
+		AuditLog: c.auditLog,
+		Notifier: c.notifications(cfg),
+		Breakers: c.circuitBreakers(cfg),
+	})
 }
 
 // findSkaiDir finds the nearest .skai directory
@@ -1,10 +1,25 @@
 package cmd
 
 import (
+	"log/slog"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/daemon"
+	"github.com/butter-bot-machines/skylark/pkg/ignore"
+	"github.com/butter-bot-machines/skylark/pkg/job"
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+	"github.com/butter-bot-machines/skylark/pkg/security/types"
+	"github.com/butter-bot-machines/skylark/pkg/state"
+	"github.com/butter-bot-machines/skylark/pkg/template"
+	"github.com/butter-bot-machines/skylark/pkg/worker"
 )
 
 func TestCLIRun(t *testing.T) {
@@ -314,3 +329,396 @@ file_watch:
 		t.Error("loadConfig() did not set config")
 	}
 }
+
+func TestPrintStatus(t *testing.T) {
+	var out strings.Builder
+	printStatus(&out, []types.ComponentStatus{
+		{Name: "audit_log", State: types.StateDegraded, Policy: types.PolicyWarn, Reason: "disk full"},
+	})
+
+	got := out.String()
+	if !strings.Contains(got, "DEGRADED MODE") {
+		t.Errorf("Expected degraded banner, got:\n%s", got)
+	}
+	if !strings.Contains(got, "disk full") {
+		t.Errorf("Expected degradation reason, got:\n%s", got)
+	}
+
+	out.Reset()
+	printStatus(&out, []types.ComponentStatus{
+		{Name: "audit_log", State: types.StateOK, Policy: types.PolicyWarn},
+	})
+	if strings.Contains(out.String(), "DEGRADED") {
+		t.Errorf("Unexpected degraded banner for healthy components:\n%s", out.String())
+	}
+}
+
+func TestPrintFileStatus(t *testing.T) {
+	commands := []string{"!default pending", "!default retry"}
+	instances := state.Locate("!default pending\n-!default done\n!default retry\n", commands)
+	processedAt := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	records := []state.Record{
+		{Key: state.Key("!default retry", 0), Line: 3, Command: "!default retry", Outcome: state.OutcomeFailed, Error: "timeout", ProcessedAt: processedAt},
+		{Key: state.Key("!default done", 0), Line: 2, Command: "!default done", Assistant: "default", Model: "gpt-4",
+			Tokens: provider.Usage{TotalTokens: 15}, Outcome: state.OutcomeProcessed, ProcessedAt: processedAt},
+	}
+
+	var out strings.Builder
+	printFileStatus(&out, "notes.md", commands, instances, records)
+	got := out.String()
+	for _, want := range []string{
+		"Pending: 2",
+		"!default pending\n",
+		"!default retry  (failed 2026-10-16 12:00:00: timeout)",
+		"Processed: 1",
+		"!default done  (default/gpt-4, 15 tokens, 2026-10-16 12:00:00)",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %q in:\n%s", want, got)
+		}
+	}
+}
+
+func TestPrintDeadLetters(t *testing.T) {
+	var out strings.Builder
+	printDeadLetters(&out, nil)
+	if !strings.Contains(out.String(), "No failed jobs") {
+		t.Errorf("Expected empty message, got:\n%s", out.String())
+	}
+
+	entry := job.DeadLetter{
+		ID:       "abcd1234",
+		Job:      job.Record{Path: "notes.md", Priority: job.PriorityInteractive},
+		Error:    "provider timeout\nsecond line",
+		Stack:    "main.go:10 main.main",
+		Attempts: 4,
+		FailedAt: time.Now(),
+	}
+
+	out.Reset()
+	printDeadLetters(&out, []job.DeadLetter{entry})
+	got := out.String()
+	for _, want := range []string{"abcd1234", "notes.md", "provider timeout"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %q in listing, got:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "second line") {
+		t.Errorf("Expected only the first error line in listing, got:\n%s", got)
+	}
+
+	out.Reset()
+	printDeadLetter(&out, entry)
+	got = out.String()
+	for _, want := range []string{"interactive", "second line", "main.go:10 main.main"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %q in details, got:\n%s", want, got)
+		}
+	}
+}
+
+func TestPrintTemplates(t *testing.T) {
+	var out strings.Builder
+	printTemplates(&out, nil)
+	if !strings.Contains(out.String(), "No templates") {
+		t.Errorf("Expected empty message, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	printTemplates(&out, []*template.Template{
+		{Name: "standup", Description: "Draft a standup"},
+		{Name: "summarize", Assistant: "writer", Description: "Summarize a section"},
+	})
+	got := out.String()
+	for _, want := range []string{"!standup", "default", "!summarize", "writer", "Summarize a section"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %q in listing, got:\n%s", want, got)
+		}
+	}
+}
+
+func TestSetupLogging(t *testing.T) {
+	previous := slog.Default()
+	defer slog.SetDefault(previous)
+
+	tempDir := t.TempDir()
+	skaiDir := filepath.Join(tempDir, ".skai")
+	if err := os.MkdirAll(skaiDir, 0755); err != nil {
+		t.Fatalf("Failed to create test directories: %v", err)
+	}
+	configContent := `version: "1.0"
+environment:
+  log_level: info
+  log_file: skylark.log
+logging:
+  format: text
+  max_size: 1
+`
+	if err := os.WriteFile(filepath.Join(skaiDir, "config.yaml"), []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create config.yaml: %v", err)
+	}
+
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	defer os.Chdir(originalWd)
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+
+	cli := NewCLI()
+	if err := cli.loadConfig(); err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	defer cli.closeLogging()
+
+	cli.logger.Debug("hidden message")
+	cli.logger.Info("cli message")
+	logging.Default().With("file", "notes.md").Info("package message")
+
+	content, err := os.ReadFile(filepath.Join(skaiDir, "skylark.log"))
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	got := string(content)
+	if strings.Contains(got, "hidden message") {
+		t.Errorf("Expected debug message filtered at info level, got:\n%s", got)
+	}
+	for _, want := range []string{`msg="cli message"`, `msg="package message"`, "file=notes.md"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %s in log file, got:\n%s", want, got)
+		}
+	}
+	if strings.Count(got, "run_id="+cli.runID) != 2 {
+		t.Errorf("Expected run_id %s on every entry, got:\n%s", cli.runID, got)
+	}
+}
+
+func TestPrintDaemonStatus(t *testing.T) {
+	var out strings.Builder
+	printDaemonStatus(&out, &daemon.Status{
+		PID:        1234,
+		Paused:     true,
+		Started:    time.Now().Add(-time.Minute),
+		QueueDepth: 5,
+		Processed:  9,
+		Failed:     1,
+		LastError:  &worker.Failure{File: "notes.md", Error: "provider timeout\ndetails"},
+	})
+
+	got := out.String()
+	for _, want := range []string{"paused", "pid 1234", "queued: 5", "processed: 9", "notes.md: provider timeout"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %q in daemon status, got:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "details") {
+		t.Errorf("Expected only the first error line, got:\n%s", got)
+	}
+}
+
+func TestPrintDaemonStatusOffline(t *testing.T) {
+	var out strings.Builder
+	printDaemonStatus(&out, &daemon.Status{
+		PID:     1234,
+		Started: time.Now(),
+		Offline: true,
+		Backlog: 3,
+	})
+
+	got := out.String()
+	for _, want := range []string{"Daemon: offline", "queued offline: 3 files"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %q in daemon status, got:\n%s", want, got)
+		}
+	}
+}
+
+func TestProviderHosts(t *testing.T) {
+	cfg := &config.Config{
+		Models: map[string]config.ModelConfigSet{
+			"openai": {
+				"gpt-4":   {APIKey: "key"},
+				"gpt-4o":  {APIKey: "key", BaseURL: "http://gateway.internal/v1"},
+				"gpt-3.5": {APIKey: "key", Proxy: "http://proxy.example.com:8080"},
+			},
+			config.AzureOpenAI: {
+				"chat": {Endpoint: "https://example.openai.azure.com"},
+			},
+			config.OpenAICompatible: {
+				"llama": {BaseURL: "http://localhost:8000/v1"},
+			},
+		},
+	}
+
+	noProxy := func(*http.Request) (*url.URL, error) { return nil, nil }
+	got := providerHosts(cfg, noProxy)
+	expected := []string{
+		"api.openai.com:443",
+		"example.openai.azure.com:443",
+		"gateway.internal:80",
+		"localhost:8000",
+		"proxy.example.com:8080",
+	}
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected hosts %v, got %v", expected, got)
+	}
+}
+
+func TestProviderHostsProxy(t *testing.T) {
+	// Proxies everything but the gateway and loopback, as HTTPS_PROXY with
+	// NO_PROXY=gateway.internal would
+	corpProxy, _ := url.Parse("http://corp-proxy:3128")
+	proxy := func(r *http.Request) (*url.URL, error) {
+		switch r.URL.Hostname() {
+		case "gateway.internal", "localhost":
+			return nil, nil
+		}
+		return corpProxy, nil
+	}
+
+	cfg := &config.Config{
+		Models: map[string]config.ModelConfigSet{
+			"openai": {
+				"gpt-4":   {APIKey: "key"},
+				"gpt-4o":  {APIKey: "key", BaseURL: "https://gateway.internal/v1"},
+				"gpt-3.5": {APIKey: "key", Proxy: "http://proxy.example.com:8080"},
+			},
+			config.OpenAICompatible: {
+				"llama": {BaseURL: "http://localhost:8000/v1"},
+			},
+		},
+	}
+	got := providerHosts(cfg, proxy)
+	expected := []string{
+		"corp-proxy:3128",        // api.openai.com through the proxy
+		"gateway.internal:443",   // Not proxied
+		"localhost:8000",         // Not proxied
+		"proxy.example.com:8080", // The configured proxy wins
+	}
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected hosts %v, got %v", expected, got)
+	}
+}
+
+func TestControlWithoutDaemon(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tempDir, ".skai"), 0755); err != nil {
+		t.Fatalf("Failed to create test directories: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, ".skai", "config.yaml"), []byte("version: \"1.0\"\n"), 0644); err != nil {
+		t.Fatalf("Failed to create config.yaml: %v", err)
+	}
+
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	defer os.Chdir(originalWd)
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+
+	cli := NewCLI()
+	err = cli.Control("pause", nil)
+	if err == nil || !strings.Contains(err.Error(), "no daemon running") {
+		t.Errorf("Expected no daemon error, got %v", err)
+	}
+}
+
+func TestMCPArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"no subcommand", nil, "expected 'mcp serve"},
+		{"unknown subcommand", []string{"start"}, "expected 'mcp serve"},
+		{"missing address", []string{"serve", "--sse"}, "--sse requires an address"},
+		{"unknown flag", []string{"serve", "--verbose"}, "unknown flag"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewCLI().MCP(tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestRunArgs(t *testing.T) {
+	opts, err := parseRunArgs([]string{"--manifest", "batch.yaml", "--report", "out.json"})
+	if err != nil {
+		t.Fatalf("parseRunArgs() error = %v", err)
+	}
+	if opts.manifest != "batch.yaml" || opts.report != "out.json" || opts.output != outputText {
+		t.Errorf("Expected batch.yaml, out.json and text output, got %+v", opts)
+	}
+	if opts, err := parseRunArgs([]string{"--output", "json"}); err != nil || opts.output != outputJSON {
+		t.Errorf("Expected json output, got %+v, %v", opts, err)
+	}
+	if opts, err := parseRunArgs([]string{"--diff"}); err != nil || !opts.diff {
+		t.Errorf("Expected diff, got %+v, %v", opts, err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"missing manifest path", []string{"--manifest"}, "--manifest requires a value"},
+		{"unknown output", []string{"--output", "xml"}, "--output must be"},
+		{"report without manifest", []string{"--report", "out.json"}, "--report requires --manifest"},
+		{"unknown flag", []string{"--all"}, "unknown flag"},
+		{"argument", []string{"notes.md"}, "unexpected argument"},
+		{"diff with json", []string{"--diff", "--output", "json"}, "--diff cannot be combined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseRunArgs(tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLSPArgs(t *testing.T) {
+	stdout := os.Stdout
+	err := NewCLI().LSP([]string{"--tcp"})
+	if err == nil || !strings.Contains(err.Error(), "unknown flag") {
+		t.Errorf("Expected unknown flag error, got %v", err)
+	}
+	if os.Stdout != stdout {
+		t.Error("Expected stdout to be left untouched")
+	}
+}
+
+func TestMarkdownFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.md", "notes.txt", ".skai/x.md", "build/out.md", "docs/b.md", "docs/draft.md"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("# "+name), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	ignored, err := ignore.New(dir, []string{"build/", "draft.md"})
+	if err != nil {
+		t.Fatalf("Failed to create matcher: %v", err)
+	}
+
+	files, err := markdownFiles(dir, ignored)
+	if err != nil {
+		t.Fatalf("markdownFiles failed: %v", err)
+	}
+	want := []string{filepath.Join(dir, "a.md"), filepath.Join(dir, "docs", "b.md")}
+	if strings.Join(files, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected %v, got %v", want, files)
+	}
+}
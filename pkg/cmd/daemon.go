@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/daemon"
+)
+
+const (
+	// controlSocket is the name of the daemon's control socket inside .skai
+	controlSocket = "skylark.sock"
+
+	// daemonOutput captures a detached daemon's stdout and stderr
+	daemonOutput = "daemon.out"
+
+	// daemonStartTimeout is how long to wait for a detached daemon's
+	// control socket to come up
+	daemonStartTimeout = 10 * time.Second
+)
+
+// socketPath returns the location of the daemon's control socket
+func (c *CLI) socketPath() string {
+	return filepath.Join(c.config.GetConfig().Environment.ConfigDir, controlSocket)
+}
+
+// Daemon runs the watcher in the background, controlled through a
+// unix-domain socket. With --foreground it stays attached, which suits
+// service managers such as systemd.
+func (c *CLI) Daemon(args []string) error {
+	var foreground, noResume bool
+	fs := newFlagSet("daemon")
+	fs.BoolVar(&foreground, "foreground", false, "stay attached instead of detaching")
+	fs.BoolVar(&noResume, "no-resume", false, "discard jobs queued by the last run")
+	fs.BoolVar(&c.offline, "offline", false, "queue commands instead of sending them")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := noArguments(args); err != nil {
+		return err
+	}
+
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+	if _, err := daemon.Call(c.socketPath(), daemon.CommandStatus); err == nil {
+		return fmt.Errorf("daemon already running (socket %s)", c.socketPath())
+	}
+	if !foreground {
+		return c.detach(noResume)
+	}
+
+	// Open the audit log and export traces
+	teardown, err := c.setupRuntime()
+	if err != nil {
+		return err
+	}
+	defer teardown()
+
+	c.logger.Info("starting daemon", "pid", os.Getpid(), "resume", !noResume, "offline", c.offline)
+
+	sess, err := c.startSession()
+	if err != nil {
+		return err
+	}
+	ctrl, err := daemon.Listen(c.socketPath(), sess, c.logger)
+	if err != nil {
+		sess.shutdown()
+		return err
+	}
+	sess.resume(noResume)
+
+	// Run until stopped
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	sig := <-sigChan
+	c.logger.Info("received signal", "signal", sig.String())
+
+	ctrl.Close()
+	sess.shutdown()
+
+	stats := sess.pool.Stats()
+	c.logger.Info("daemon stopped",
+		"processed", stats.ProcessedJobs,
+		"failed", stats.FailedJobs)
+	return nil
+}
+
+// detach starts the daemon as a background process in its own session and
+// waits until its control socket answers
+func (c *CLI) detach(noResume bool) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate executable: %w", err)
+	}
+	args := []string{"daemon", "--foreground"}
+	if noResume {
+		args = append(args, "--no-resume")
+	}
+	if c.offline {
+		args = append(args, "--offline")
+	}
+
+	outPath := filepath.Join(c.config.GetConfig().Environment.ConfigDir, daemonOutput)
+	out, err := os.OpenFile(outPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open daemon output: %w", err)
+	}
+	defer out.Close()
+
+	cmd := exec.Command(exe, args...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start daemon: %w", err)
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	deadline := time.Now().Add(daemonStartTimeout)
+	for time.Now().Before(deadline) {
+		select {
+		case err := <-exited:
+			return fmt.Errorf("daemon exited during startup (%v), see %s", err, outPath)
+		case <-time.After(100 * time.Millisecond):
+		}
+		if _, err := daemon.Call(c.socketPath(), daemon.CommandStatus); err == nil {
+			c.infof("Daemon started (pid %d)\n", cmd.Process.Pid)
+			return nil
+		}
+	}
+	return fmt.Errorf("daemon did not become ready within %v, see %s", daemonStartTimeout, outPath)
+}
+
+// Control sends pause, resume or reload to the running daemon
+func (c *CLI) Control(command string, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %v", args)
+	}
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+
+	status, err := daemon.Call(c.socketPath(), command)
+	if errors.Is(err, daemon.ErrNotRunning) {
+		return fmt.Errorf("no daemon running for this project (start one with 'skai daemon')")
+	}
+	if err != nil {
+		return fmt.Errorf("%s failed: %w", command, err)
+	}
+
+	switch command {
+	case daemon.CommandPause:
+		c.infof("Daemon paused; changes are queued until 'skai resume'\n")
+	case daemon.CommandResume:
+		c.infof("Daemon resumed\n")
+	case daemon.CommandReload:
+		c.infof("Configuration reloaded\n")
+	}
+	printDaemonStatus(os.Stdout, status)
+	return nil
+}
+
+// printDaemonStatus writes a summary of a running daemon
+func printDaemonStatus(w io.Writer, s *daemon.Status) {
+	state := "running"
+	switch {
+	case s.Paused:
+		state = "paused"
+	case s.Offline:
+		state = "offline"
+	}
+	fmt.Fprintf(w, "Daemon: %s (pid %d, up %s)\n", state, s.PID, time.Since(s.Started).Round(time.Second))
+	fmt.Fprintf(w, "  queued: %d  processed: %d  failed: %d  workers: %d\n",
+		s.QueueDepth, s.Processed, s.Failed, s.ActiveWorkers)
+	if s.Backlog > 0 {
+		fmt.Fprintf(w, "  queued offline: %d files\n", s.Backlog)
+	}
+	if !s.Reloaded.IsZero() {
+		fmt.Fprintf(w, "  config reloaded: %s\n", s.Reloaded.Format(time.RFC3339))
+	}
+	if s.LastError != nil {
+		fmt.Fprintf(w, "  last error: %s: %s\n", s.LastError.File, firstLine(s.LastError.Error))
+	}
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/job"
+	"github.com/butter-bot-machines/skylark/pkg/models"
+	"github.com/butter-bot-machines/skylark/pkg/server"
+	"github.com/butter-bot-machines/skylark/pkg/state"
+)
+
+// Extent of the activity shown by the dashboard
+const (
+	dashboardFiles    = 20 // Files listed as recently processed
+	dashboardFailures = 20 // Failures listed
+	dashboardDays     = 14 // Days of spending charted, including today
+)
+
+// activity reads the recent files, failures and spending of the project
+// for the dashboard from its command records and dead letters
+func (c *CLI) activity() (*server.Activity, error) {
+	cfg := c.config.GetConfig()
+	store, err := state.Open(cfg.Environment.ConfigDir)
+	if err != nil {
+		return nil, err
+	}
+	dead, err := c.deadLetters().List()
+	if err != nil {
+		return nil, err
+	}
+	root := filepath.Dir(cfg.Environment.ConfigDir)
+	return buildActivity(root, store, dead, models.New(cfg.ModelMetadata), time.Now()), nil
+}
+
+// buildActivity summarizes the records of store and the dead letters as of
+// now. Spending counts the tokens of each command's last processing, priced
+// with registry; commands processed again only count once.
+func buildActivity(root string, store *state.Store, dead []job.DeadLetter, registry *models.Registry, now time.Time) *server.Activity {
+	a := &server.Activity{
+		Files:    []server.FileActivity{},
+		Failures: []server.FailureDetail{},
+		Spend:    make([]server.DailySpend, dashboardDays),
+	}
+	days := make(map[string]*server.DailySpend, dashboardDays)
+	for i := range a.Spend {
+		day := now.AddDate(0, 0, i-dashboardDays+1).Format("2006-01-02")
+		a.Spend[i].Day = day
+		days[day] = &a.Spend[i]
+	}
+
+	for _, document := range store.Documents() {
+		file := relativeTo(root, document)
+		fa := server.FileActivity{File: file}
+		for _, r := range store.Records(document) {
+			if r.ProcessedAt.After(fa.ProcessedAt) {
+				fa.ProcessedAt = r.ProcessedAt
+			}
+			fa.Commands++
+			fa.Tokens += r.Tokens.TotalTokens
+			if r.Outcome == state.OutcomeFailed {
+				fa.Failed++
+				a.Failures = append(a.Failures, server.FailureDetail{
+					Source:  "command",
+					File:    file,
+					Command: r.Command,
+					Error:   r.Error,
+					Time:    r.ProcessedAt,
+				})
+			}
+			if d := days[r.ProcessedAt.In(now.Location()).Format("2006-01-02")]; d != nil {
+				d.Tokens += r.Tokens.TotalTokens
+				if meta, ok := registry.Lookup(r.Model); ok {
+					d.Cost += meta.Cost(r.Tokens.PromptTokens, r.Tokens.CompletionTokens)
+				}
+			}
+		}
+		a.Files = append(a.Files, fa)
+	}
+	for _, d := range dead {
+		a.Failures = append(a.Failures, server.FailureDetail{
+			Source:   "job",
+			File:     relativeTo(root, d.Job.Path),
+			Error:    d.Error,
+			Stack:    d.Stack,
+			Attempts: d.Attempts,
+			Time:     d.FailedAt,
+		})
+	}
+
+	sort.SliceStable(a.Files, func(i, j int) bool { return a.Files[i].ProcessedAt.After(a.Files[j].ProcessedAt) })
+	sort.SliceStable(a.Failures, func(i, j int) bool { return a.Failures[i].Time.After(a.Failures[j].Time) })
+	if len(a.Files) > dashboardFiles {
+		a.Files = a.Files[:dashboardFiles]
+	}
+	if len(a.Failures) > dashboardFailures {
+		a.Failures = a.Failures[:dashboardFailures]
+	}
+	return a
+}
+
+// relativeTo returns path relative to root when it is inside it
+func relativeTo(root, path string) string {
+	if rel, err := filepath.Rel(root, path); err == nil && filepath.IsLocal(rel) {
+		return rel
+	}
+	return path
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/job"
+	"github.com/butter-bot-machines/skylark/pkg/models"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+	"github.com/butter-bot-machines/skylark/pkg/state"
+)
+
+func TestBuildActivity(t *testing.T) {
+	root := t.TempDir()
+	now := time.Date(2026, 3, 14, 12, 0, 0, 0, time.Local)
+	yesterday := now.AddDate(0, 0, -1)
+	store, err := state.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []struct {
+		file string
+		r    state.Record
+	}{
+		{"notes.md", state.Record{Key: "a:0", Line: 1, Model: "priced", ProcessedAt: yesterday, Outcome: state.OutcomeProcessed,
+			Tokens: provider.Usage{PromptTokens: 1000, CompletionTokens: 1000, TotalTokens: 2000}}},
+		{"notes.md", state.Record{Key: "b:0", Line: 3, Command: "!fix", ProcessedAt: now, Outcome: state.OutcomeFailed, Error: "timeout"}},
+		{"old.md", state.Record{Key: "c:0", Line: 1, ProcessedAt: now.AddDate(0, -1, 0), Outcome: state.OutcomeProcessed,
+			Tokens: provider.Usage{TotalTokens: 500}}},
+	}
+	for _, rec := range records {
+		if err := store.Put(filepath.Join(root, rec.file), rec.r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dead := []job.DeadLetter{{Job: job.Record{Path: filepath.Join(root, "todo.md")}, Error: "panic", Attempts: 3, FailedAt: now.Add(time.Hour)}}
+	prompt, completion := 0.01, 0.03
+	registry := models.New(map[string]config.ModelMetadata{"priced": {PromptPer1K: &prompt, CompletionPer1K: &completion}})
+
+	a := buildActivity(root, store, dead, registry, now)
+
+	if len(a.Files) != 2 || a.Files[0].File != "notes.md" || a.Files[0].Commands != 2 || a.Files[0].Failed != 1 {
+		t.Errorf("Expected notes.md first with 2 commands, 1 failed, got %+v", a.Files)
+	}
+	if len(a.Failures) != 2 || a.Failures[0].Source != "job" || a.Failures[0].File != "todo.md" || a.Failures[1].Command != "!fix" {
+		t.Errorf("Expected the dead letter, then the failed command, got %+v", a.Failures)
+	}
+	if len(a.Spend) != dashboardDays || a.Spend[dashboardDays-1].Day != "2026-03-14" {
+		t.Fatalf("Expected %d days ending today, got %+v", dashboardDays, a.Spend)
+	}
+	spent := a.Spend[dashboardDays-2]
+	if spent.Tokens != 2000 || spent.Cost < 0.0399 || spent.Cost > 0.0401 {
+		t.Errorf("Expected 2000 tokens costing 0.04 yesterday, got %+v", spent)
+	}
+}
@@ -0,0 +1,425 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	procesos "github.com/butter-bot-machines/skylark/pkg/process/os"
+	"github.com/butter-bot-machines/skylark/pkg/provider/azure"
+)
+
+const (
+	// inotifyWatchesPath holds the number of directories a user may watch
+	inotifyWatchesPath = "/proc/sys/fs/inotify/max_user_watches"
+
+	// pingTimeout bounds each provider reachability check
+	pingTimeout = 10 * time.Second
+)
+
+// checkState is the outcome of a doctor check
+type checkState string
+
+const (
+	checkOK   checkState = "ok"
+	checkWarn checkState = "warn"
+	checkFail checkState = "fail"
+	checkSkip checkState = "skip"
+)
+
+// checkResult is one doctor check and, unless it passed, how to fix it
+type checkResult struct {
+	Name   string     `json:"name"`
+	State  checkState `json:"state"`
+	Detail string     `json:"detail,omitempty"`
+	Fix    string     `json:"fix,omitempty"`
+}
+
+// Doctor checks that the environment can run Skylark and prints how to fix
+// what it finds wrong. It fails when any check fails.
+func (c *CLI) Doctor(args []string) error {
+	args, err := parseFlags(newFlagSet("doctor"), args)
+	if err != nil {
+		return err
+	}
+	if err := noArguments(args); err != nil {
+		return err
+	}
+
+	results := []checkResult{checkGo()}
+	cfg, result := c.checkConfig()
+	results = append(results, result)
+	if cfg == nil {
+		for _, name := range []string{"providers", "file watches", "watch paths"} {
+			results = append(results, checkResult{Name: name, State: checkSkip, Detail: "needs a valid configuration"})
+		}
+	} else {
+		client := &http.Client{Timeout: pingTimeout}
+		results = append(results, checkProviders(client, cfg)...)
+		results = append(results, checkWatchLimit(cfg, inotifyWatchesPath))
+		results = append(results, checkWatchPaths(cfg))
+	}
+	results = append(results, checkSandbox())
+
+	var failed int
+	if c.json {
+		for _, r := range results {
+			if r.State == checkFail {
+				failed++
+			}
+		}
+		if err := printJSON(os.Stdout, results); err != nil {
+			return err
+		}
+	} else {
+		failed = printDoctor(os.Stdout, results)
+	}
+	if failed > 0 {
+		return fmt.Errorf("checks failed: %d", failed)
+	}
+	return nil
+}
+
+// printDoctor prints the results with the fix of each that did not pass,
+// returning how many failed
+func printDoctor(w io.Writer, results []checkResult) int {
+	failed := 0
+	fmt.Fprintln(w, "Skylark doctor")
+	for _, r := range results {
+		line := fmt.Sprintf("  %-24s %s", r.Name+":", strings.ToUpper(string(r.State)))
+		if r.Detail != "" {
+			line += " " + r.Detail
+		}
+		fmt.Fprintln(w, line)
+		if r.State == checkFail {
+			failed++
+		}
+	}
+
+	var fixes []checkResult
+	for _, r := range results {
+		if r.Fix != "" && (r.State == checkFail || r.State == checkWarn) {
+			fixes = append(fixes, r)
+		}
+	}
+	if len(fixes) == 0 {
+		return failed
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "To fix:")
+	for _, r := range fixes {
+		fmt.Fprintf(w, "  %s: %s\n", r.Name, r.Fix)
+	}
+	return failed
+}
+
+// checkGo checks for the Go toolchain tools are compiled with
+func checkGo() checkResult {
+	result := checkResult{Name: "go toolchain"}
+	path, err := exec.LookPath("go")
+	if err != nil {
+		result.State = checkFail
+		result.Detail = "go not found on PATH"
+		result.Fix = "install Go 1.21 or later from https://go.dev/dl and add it to PATH; tools are compiled with it"
+		return result
+	}
+	out, err := exec.Command(path, "version").Output()
+	if err != nil {
+		result.State = checkFail
+		result.Detail = fmt.Sprintf("%s version failed: %v", path, err)
+		result.Fix = "reinstall Go from https://go.dev/dl"
+		return result
+	}
+	result.State = checkOK
+	result.Detail = strings.TrimPrefix(strings.TrimSpace(string(out)), "go version ")
+	return result
+}
+
+// checkConfig loads and validates the project's configuration, returning
+// it when valid
+func (c *CLI) checkConfig() (*config.Config, checkResult) {
+	result := checkResult{Name: "config"}
+	if err := c.loadConfig(); err != nil {
+		result.State = checkFail
+		result.Detail = err.Error()
+		result.Fix = "run skai doctor inside a project, or create one with skai init"
+		return nil, result
+	}
+	cfg := c.config.GetConfig()
+	if err := cfg.Validate(); err != nil {
+		result.State = checkFail
+		result.Detail = err.Error()
+		result.Fix = "correct .skai/config.yaml; see the Configuration section of the README"
+		return nil, result
+	}
+	result.State = checkOK
+	result.Detail = "valid"
+	return cfg, result
+}
+
+// checkProviders pings each provider endpoint and API key the models of
+// cfg use, once however many models share them
+func checkProviders(client *http.Client, cfg *config.Config) []checkResult {
+	if cfg.Providers.Mode == config.ProviderReplay {
+		return []checkResult{{Name: "providers", State: checkSkip, Detail: "replaying recorded responses"}}
+	}
+
+	var names []string
+	for name := range cfg.Models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var results []checkResult
+	seen := make(map[string]bool)
+	for _, name := range names {
+		var models []string
+		for model := range cfg.Models[name] {
+			models = append(models, model)
+		}
+		sort.Strings(models)
+		for _, model := range models {
+			m := cfg.Models[name][model]
+			key := strings.Join([]string{name, m.Endpoint, m.BaseURL, m.Proxy, m.APIKey}, "\x00")
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			results = append(results, checkProvider(client, name, model, m))
+		}
+	}
+	if len(results) == 0 {
+		return []checkResult{{Name: "providers", State: checkWarn, Detail: "no models configured",
+			Fix: "add a model under models in .skai/config.yaml"}}
+	}
+	return results
+}
+
+// checkProvider lists the models of a provider, the cheapest request that
+// proves both the endpoint and the API key work
+func checkProvider(client *http.Client, name, model string, m config.ModelConfig) checkResult {
+	result := checkResult{Name: name + "/" + model}
+	setting := fmt.Sprintf("models.%s.%s", name, model)
+
+	req, err := pingRequest(name, m)
+	if err != nil {
+		result.State = checkFail
+		result.Detail = err.Error()
+		result.Fix = fmt.Sprintf("set api_key, endpoint or base_url under %s", setting)
+		return result
+	}
+	if req == nil {
+		result.State = checkSkip
+		result.Detail = "not a built-in provider"
+		return result
+	}
+
+	if m.Proxy != "" {
+		proxy, err := url.Parse(m.Proxy)
+		if err != nil || proxy.Host == "" {
+			result.State = checkFail
+			result.Detail = fmt.Sprintf("invalid proxy URL %q", m.Proxy)
+			result.Fix = fmt.Sprintf("correct proxy under %s", setting)
+			return result
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = http.ProxyURL(proxy)
+		client = &http.Client{Transport: transport, Timeout: client.Timeout}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		result.State = checkFail
+		result.Detail = fmt.Sprintf("unreachable: %v", err)
+		result.Fix = "check the network connection and the proxy, endpoint or base_url under " + setting +
+			"; skai watch --offline queues commands until it is back"
+		return result
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		result.State = checkOK
+		result.Detail = "reachable, API key accepted"
+	case m.AzureAD != nil:
+		// The request carried no token, so any answer proves reachability
+		result.State = checkOK
+		result.Detail = "reachable (Azure AD sign-in not checked)"
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		result.State = checkFail
+		result.Detail = fmt.Sprintf("API key rejected (HTTP %d)", resp.StatusCode)
+		result.Fix = fmt.Sprintf("check api_key under %s", setting)
+	default:
+		result.State = checkWarn
+		result.Detail = fmt.Sprintf("reachable, but answered HTTP %d", resp.StatusCode)
+		result.Fix = fmt.Sprintf("check endpoint or base_url under %s", setting)
+	}
+	return result
+}
+
+// pingRequest returns the request listing a provider's models, or nil for
+// providers Skylark does not know how to ping
+func pingRequest(name string, m config.ModelConfig) (*http.Request, error) {
+	var target string
+	header := http.Header{}
+	switch name {
+	case "openai":
+		if m.APIKey == "" {
+			return nil, fmt.Errorf("no API key")
+		}
+		target = "https://api.openai.com/v1"
+		if m.BaseURL != "" {
+			target = m.BaseURL
+		}
+		target = strings.TrimSuffix(target, "/") + "/models"
+		header.Set("Authorization", "Bearer "+m.APIKey)
+		if m.Organization != "" {
+			header.Set("OpenAI-Organization", m.Organization)
+		}
+		if m.Project != "" {
+			header.Set("OpenAI-Project", m.Project)
+		}
+	case config.AzureOpenAI:
+		if m.Endpoint == "" {
+			return nil, fmt.Errorf("no endpoint")
+		}
+		if m.APIKey == "" && m.AzureAD == nil {
+			return nil, fmt.Errorf("no API key or Azure AD app")
+		}
+		version := m.APIVersion
+		if version == "" {
+			version = azure.DefaultAPIVersion
+		}
+		target = strings.TrimSuffix(m.Endpoint, "/") + "/openai/models?api-version=" + url.QueryEscape(version)
+		if m.AzureAD == nil {
+			header.Set("api-key", m.APIKey)
+		}
+	case config.OpenAICompatible:
+		if m.BaseURL == "" {
+			return nil, fmt.Errorf("no base_url")
+		}
+		target = strings.TrimSuffix(m.BaseURL, "/") + "/models"
+		if m.APIKey != "" {
+			header.Set("Authorization", "Bearer "+m.APIKey)
+		}
+	default:
+		return nil, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %q: %w", target, err)
+	}
+	req.Header = header
+	return req, nil
+}
+
+// checkWatchLimit compares the directories under the watch paths with the
+// inotify watches a user may hold, read from limitPath
+func checkWatchLimit(cfg *config.Config, limitPath string) checkResult {
+	result := checkResult{Name: "file watches"}
+	if cfg.FileWatch.Backend == config.WatchPoll {
+		result.State = checkSkip
+		result.Detail = "polling for changes"
+		return result
+	}
+	data, err := os.ReadFile(limitPath)
+	if err != nil {
+		result.State = checkSkip
+		result.Detail = "no inotify limit on this system"
+		return result
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		result.State = checkSkip
+		result.Detail = fmt.Sprintf("unreadable %s", limitPath)
+		return result
+	}
+
+	dirs := 0
+	for _, path := range cfg.WatchPaths {
+		filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+			if err == nil && d.IsDir() {
+				dirs++
+			}
+			return nil
+		})
+	}
+
+	result.Detail = fmt.Sprintf("%d directories, limit %d", dirs, limit)
+	switch {
+	case dirs > limit:
+		result.State = checkFail
+	case dirs > limit*4/5:
+		result.State = checkWarn
+	default:
+		result.State = checkOK
+		return result
+	}
+	result.Fix = fmt.Sprintf("raise the limit with sudo sysctl fs.inotify.max_user_watches=%d "+
+		"(add it to /etc/sysctl.conf to keep it), narrow watch_paths, or set file_watch.backend: poll", max(limit*2, 524288))
+	return result
+}
+
+// checkWatchPaths checks that responses can be written in each watch path
+func checkWatchPaths(cfg *config.Config) checkResult {
+	result := checkResult{Name: "watch paths"}
+	if len(cfg.WatchPaths) == 0 {
+		result.State = checkWarn
+		result.Detail = "none configured"
+		result.Fix = "list the directories to watch under watch_paths in .skai/config.yaml"
+		return result
+	}
+
+	var problems []string
+	for _, path := range cfg.WatchPaths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			abs = path
+		}
+		f, err := os.CreateTemp(abs, ".skylark-doctor-*")
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", path, err))
+			continue
+		}
+		f.Close()
+		os.Remove(f.Name())
+	}
+	if len(problems) > 0 {
+		result.State = checkFail
+		result.Detail = strings.Join(problems, "; ")
+		result.Fix = "create the directories or make them writable (chmod u+w), or correct watch_paths"
+		return result
+	}
+	result.State = checkOK
+	result.Detail = fmt.Sprintf("%d writable", len(cfg.WatchPaths))
+	return result
+}
+
+// checkSandbox checks that tool memory limits can be enforced
+func checkSandbox() checkResult {
+	result := checkResult{Name: "sandbox"}
+	if err := procesos.CheckCgroups(); err != nil {
+		result.State = checkWarn
+		result.Detail = fmt.Sprintf("tool memory limits unavailable: %v", err)
+		result.Fix = "on Linux, run as a user allowed to create cgroups (for instance under systemd with Delegate=yes, " +
+			"or a container started with --cgroupns=private); elsewhere tools run without memory limits"
+		return result
+	}
+	result.State = checkOK
+	result.Detail = "cgroups available"
+	return result
+}
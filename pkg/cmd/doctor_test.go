@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+)
+
+func TestCheckProvider(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		switch {
+		case r.URL.Path != "/v1/models":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Header.Get("Authorization") != "Bearer good":
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		provider string
+		model    config.ModelConfig
+		want     checkState
+	}{
+		{"accepted", "openai", config.ModelConfig{APIKey: "good", BaseURL: server.URL + "/v1/"}, checkOK},
+		{"rejected", "openai", config.ModelConfig{APIKey: "bad", BaseURL: server.URL + "/v1"}, checkFail},
+		{"no key", "openai", config.ModelConfig{}, checkFail},
+		{"wrong path", config.OpenAICompatible, config.ModelConfig{BaseURL: server.URL}, checkWarn},
+		{"unreachable", config.OpenAICompatible, config.ModelConfig{BaseURL: "http://127.0.0.1:1/v1"}, checkFail},
+		{"plugin", "anthropic", config.ModelConfig{}, checkSkip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := checkProvider(server.Client(), tt.provider, "model", tt.model)
+			if result.State != tt.want {
+				t.Errorf("Expected %s, got %s (%s)", tt.want, result.State, result.Detail)
+			}
+			if (result.State == checkFail || result.State == checkWarn) && result.Fix == "" {
+				t.Error("Expected a fix for a check that did not pass")
+			}
+		})
+	}
+
+	checkProvider(server.Client(), "openai", "model", config.ModelConfig{APIKey: "good", BaseURL: server.URL + "/v1", Project: "proj"})
+	if got := header.Get("OpenAI-Project"); got != "proj" {
+		t.Errorf("Expected the project header, got %q", got)
+	}
+}
+
+func TestCheckWatchLimit(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a", "a/b", "c"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	limitPath := filepath.Join(t.TempDir(), "max_user_watches")
+	cfg := &config.Config{WatchPaths: []string{root}}
+
+	tests := []struct {
+		limit string
+		want  checkState
+	}{
+		{"8192\n", checkOK},
+		{"4\n", checkWarn},
+		{"2\n", checkFail},
+	}
+	for _, tt := range tests {
+		if err := os.WriteFile(limitPath, []byte(tt.limit), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if result := checkWatchLimit(cfg, limitPath); result.State != tt.want {
+			t.Errorf("Expected %s with a limit of %s, got %s (%s)", tt.want, strings.TrimSpace(tt.limit), result.State, result.Detail)
+		}
+	}
+
+	if result := checkWatchLimit(cfg, filepath.Join(root, "missing")); result.State != checkSkip {
+		t.Errorf("Expected the check to be skipped without a limit, got %s", result.State)
+	}
+	cfg.FileWatch.Backend = config.WatchPoll
+	if result := checkWatchLimit(cfg, limitPath); result.State != checkSkip {
+		t.Errorf("Expected the check to be skipped when polling, got %s", result.State)
+	}
+}
+
+func TestCheckWatchPaths(t *testing.T) {
+	dir := t.TempDir()
+	result := checkWatchPaths(&config.Config{WatchPaths: []string{dir}})
+	if result.State != checkOK {
+		t.Errorf("Expected a writable path to pass, got %s (%s)", result.State, result.Detail)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("Expected the probe file to be removed, got %d entries", len(entries))
+	}
+
+	result = checkWatchPaths(&config.Config{WatchPaths: []string{filepath.Join(dir, "missing")}})
+	if result.State != checkFail || result.Fix == "" {
+		t.Errorf("Expected a missing path to fail with a fix, got %s", result.State)
+	}
+}
+
+func TestPrintDoctor(t *testing.T) {
+	var out strings.Builder
+	failed := printDoctor(&out, []checkResult{
+		{Name: "go toolchain", State: checkOK, Detail: "go1.21.5 linux/amd64"},
+		{Name: "sandbox", State: checkWarn, Detail: "cgroups not available", Fix: "enable cgroups"},
+		{Name: "config", State: checkFail, Detail: "invalid", Fix: "correct config.yaml"},
+	})
+	if failed != 1 {
+		t.Errorf("Expected 1 failed check, got %d", failed)
+	}
+	for _, want := range []string{"go toolchain:", "OK go1.21.5", "WARN", "FAIL invalid", "To fix:", "sandbox: enable cgroups", "config: correct config.yaml"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out.String())
+		}
+	}
+}
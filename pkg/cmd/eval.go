@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/butter-bot-machines/skylark/pkg/eval"
+	"github.com/butter-bot-machines/skylark/pkg/fs/osfs"
+	"github.com/butter-bot-machines/skylark/pkg/processor/concrete"
+)
+
+// evalOptions holds the parsed arguments of eval
+type evalOptions struct {
+	specs  []string
+	models []string
+	output string
+	report string
+}
+
+// parseEvalArgs parses `eval [<spec>...] [--model <model>]... [--output text|json] [--report <path>]`
+func parseEvalArgs(args []string) (*evalOptions, error) {
+	opts := &evalOptions{}
+	fs := newFlagSet("eval")
+	fs.Func("model", "model to evaluate, repeatable", func(model string) error {
+		opts.models = append(opts.models, model)
+		return nil
+	})
+	fs.StringVar(&opts.output, "output", outputText, "text or json")
+	fs.StringVar(&opts.report, "report", "", "file the report is written to")
+	specs, err := parseFlags(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	opts.specs = specs
+	if err := validateOutput(opts.output); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// Eval runs the eval specs in .skai/evals against their assistants and
+// prints a scored report. It fails when a spec scores below its threshold
+// on any model, so that CI can gate changes to assistants on it.
+func (c *CLI) Eval(args []string) error {
+	opts, err := parseEvalArgs(args)
+	if err != nil {
+		return err
+	}
+	opts.output = c.outputFormat(opts.output)
+
+	out, restore := c.reserveStdout()
+	defer restore()
+
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+
+	// Open the audit log and export traces
+	teardown, err := c.setupRuntime()
+	if err != nil {
+		return err
+	}
+	defer teardown()
+
+	cfg := c.config.GetConfig()
+	specs, err := eval.LoadSpecs(filepath.Join(cfg.Environment.ConfigDir, "evals"), opts.specs...)
+	if err != nil {
+		return err
+	}
+
+	proc, err := c.newProcessor(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create processor: %w", err)
+	}
+	defer proc.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	c.logger.Info("starting eval run", "specs", len(specs), "models", opts.models)
+	report := eval.NewRunner(proc, concrete.NewParser(cfg), nil).Run(ctx, specs, opts.models)
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	data = append(data, '\n')
+	if opts.report != "" {
+		if err := osfs.WriteFile(opts.report, data, 0644, false); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+	}
+	if opts.output == outputJSON {
+		if _, err := out.Write(data); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+	} else {
+		printEvalReport(out, report)
+	}
+
+	if report.Failed() {
+		failed := 0
+		for _, result := range report.Results {
+			if !result.Passed {
+				failed++
+			}
+		}
+		return fmt.Errorf("eval failed: %d of %d results below their threshold", failed, len(report.Results))
+	}
+	return nil
+}
+
+// printEvalReport prints the score of each spec and model, with the
+// checks that failed
+func printEvalReport(w io.Writer, report *eval.Report) {
+	for _, result := range report.Results {
+		model := result.Model
+		if model == "" {
+			model = "assistant model"
+		}
+		status := "PASS"
+		if !result.Passed {
+			status = "FAIL"
+		}
+		fmt.Fprintf(w, "%s  %s (%s, %s)  %.2f / %.2f  %d tokens\n",
+			status, result.Spec, result.Assistant, model, result.Score, result.Threshold, result.Tokens.TotalTokens)
+		for _, cr := range result.Cases {
+			if cr.Error != "" {
+				fmt.Fprintf(w, "  %s: %s\n", cr.Case, cr.Error)
+				continue
+			}
+			for _, check := range cr.Checks {
+				if !check.Passed {
+					fmt.Fprintf(w, "  %s: %s: %s\n", cr.Case, check.Check, check.Detail)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/batch"
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+	"github.com/butter-bot-machines/skylark/pkg/processor/concrete"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+)
+
+// execOptions holds the parsed arguments of exec
+type execOptions struct {
+	command string
+	file    string
+	apply   bool
+	output  string
+}
+
+// parseExecArgs parses `exec "<command>" [--file <path>] [--apply] [--output text|json]`
+func parseExecArgs(args []string) (*execOptions, error) {
+	opts := &execOptions{}
+	fs := newFlagSet("exec")
+	fs.StringVar(&opts.file, "file", "", "document whose sections the command references, at `path`")
+	fs.BoolVar(&opts.apply, "apply", false, "write the response into --file")
+	fs.StringVar(&opts.output, "output", outputText, "text or json")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) > 0 {
+		opts.command = args[0]
+		if err := noArguments(args[1:]); err != nil {
+			return nil, err
+		}
+	}
+
+	if strings.TrimSpace(opts.command) == "" {
+		return nil, fmt.Errorf("expected 'exec \"<command>\" [--file <path>] [--apply]'")
+	}
+	if opts.apply && opts.file == "" {
+		return nil, fmt.Errorf("--apply requires --file")
+	}
+	if err := validateOutput(opts.output); err != nil {
+		return nil, err
+	}
+	// The leading "!" is optional on the command line
+	if !strings.HasPrefix(strings.TrimSpace(opts.command), "!") {
+		opts.command = "!" + strings.TrimSpace(opts.command)
+	}
+	return opts, nil
+}
+
+// Exec runs a single command and prints the response. Sections the command
+// references are read from --file, and --apply writes the response back
+// into that file as watch and run would.
+func (c *CLI) Exec(args []string) error {
+	opts, err := parseExecArgs(args)
+	if err != nil {
+		return err
+	}
+	opts.output = c.outputFormat(opts.output)
+
+	// Stdout carries only the response
+	out, restore := c.reserveStdout()
+	defer restore()
+
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+
+	cmd, err := concrete.NewParser(c.config.GetConfig()).ParseCommand(opts.command)
+	if err != nil {
+		return err
+	}
+
+	if opts.file == "" && len(cmd.References) > 0 {
+		return fmt.Errorf("command references sections but no --file was given")
+	}
+
+	// Open the audit log and export traces
+	teardown, err := c.setupRuntime()
+	if err != nil {
+		return err
+	}
+	defer teardown()
+
+	proc, err := c.newProcessor(c.config.GetConfig())
+	if err != nil {
+		return fmt.Errorf("failed to create processor: %w", err)
+	}
+	defer proc.Close()
+
+	var content string
+	if opts.file != "" {
+		data, err := readDocument(proc, opts.file)
+		if err != nil {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+		content = string(data)
+	}
+
+	if r, ok := proc.(processor.ReferenceResolver); ok {
+		r.AttachReferences(context.Background(), cmd, opts.file, content)
+	}
+
+	c.logger.Info("executing command", "assistant", cmd.Assistant, "file", opts.file)
+	if opts.output == outputJSON {
+		return c.execJSON(out, proc, opts, cmd, content)
+	}
+
+	response, err := c.processCommand(context.Background(), proc, cmd)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, response)
+
+	if opts.apply {
+		return applyResponse(proc, opts.file, content, cmd, response)
+	}
+	return nil
+}
+
+// execJSON runs cmd and prints its result as JSON, applying the response
+// first when asked so that a failure to apply it is reported too
+func (c *CLI) execJSON(out io.Writer, proc processor.ProcessManager, opts *execOptions, cmd *parser.Command, content string) error {
+	result := batch.CommandResult{
+		File:      opts.file,
+		Assistant: cmd.Assistant,
+		Command:   cmd.Original,
+		Status:    batch.StatusOK,
+	}
+
+	meter := &provider.UsageMeter{}
+	start := time.Now()
+	response, err := c.processCommand(provider.ContextWithUsageMeter(context.Background(), meter), proc, cmd)
+	result.DurationMS = time.Since(start).Milliseconds()
+	result.Tokens = meter.Usage()
+	result.Response = response
+	if err == nil && opts.apply {
+		err = applyResponse(proc, opts.file, content, cmd, response)
+	}
+	if err != nil {
+		result.Status, result.Error = batch.StatusFailed, err.Error()
+	}
+
+	data, marshalErr := json.MarshalIndent(result, "", "  ")
+	if marshalErr != nil {
+		return fmt.Errorf("failed to encode result: %w", marshalErr)
+	}
+	fmt.Fprintln(out, string(data))
+	return err
+}
+
+// processCommand runs cmd, within ctx when the processor accepts one
+func (c *CLI) processCommand(ctx context.Context, proc processor.ProcessManager, cmd *parser.Command) (string, error) {
+	if p, ok := proc.(processor.ContextCommandProcessor); ok {
+		return p.ProcessContext(ctx, cmd)
+	}
+	return proc.Process(cmd)
+}
+
+// applyResponse writes the response below the command in path. A command
+// that is not in the file yet is appended first.
+func applyResponse(proc processor.ProcessManager, path, content string, cmd *parser.Command, response string) error {
+	found := false
+	lines := strings.Split(content, "\n")
+	for i := range lines {
+		if parser.MatchesAt(lines, i, cmd.Original) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		if err := writeDocument(proc, path, []byte(content+cmd.Original+"\n")); err != nil {
+			return fmt.Errorf("failed to write file: %w", err)
+		}
+	}
+
+	if err := proc.UpdateFile(path, []processor.Response{{Command: cmd, Response: response}}); err != nil {
+		return fmt.Errorf("failed to update file: %w", err)
+	}
+	return nil
+}
+
+// readDocument reads the document at path through the processor's file
+// system when it has one
+func readDocument(proc processor.ProcessManager, path string) ([]byte, error) {
+	if store, ok := proc.(processor.DocumentStore); ok {
+		return store.ReadFile(path)
+	}
+	return os.ReadFile(path)
+}
+
+// writeDocument writes the document at path through the processor's file
+// system when it has one
+func writeDocument(proc processor.ProcessManager, path string, data []byte) error {
+	if store, ok := proc.(processor.DocumentStore); ok {
+		return store.WriteFile(path, data)
+	}
+	return os.WriteFile(path, data, 0644)
+}
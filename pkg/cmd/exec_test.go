@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/batch"
+)
+
+func TestParseExecArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    execOptions
+		wantErr string
+	}{
+		{
+			name: "command only",
+			args: []string{"!research summarize"},
+			want: execOptions{command: "!research summarize", output: outputText},
+		},
+		{
+			name: "bang is optional",
+			args: []string{"research summarize"},
+			want: execOptions{command: "!research summarize", output: outputText},
+		},
+		{
+			name: "file and apply",
+			args: []string{"--apply", "!research summarize #Roadmap#", "--file", "notes/plan.md"},
+			want: execOptions{command: "!research summarize #Roadmap#", file: "notes/plan.md", apply: true, output: outputText},
+		},
+		{
+			name: "json output",
+			args: []string{"!research summarize", "--output", "json"},
+			want: execOptions{command: "!research summarize", output: outputJSON},
+		},
+		{name: "missing command", args: []string{"--file", "a.md"}, wantErr: "expected 'exec"},
+		{name: "missing path", args: []string{"!a b", "--file"}, wantErr: "--file requires a path"},
+		{name: "apply without file", args: []string{"!a b", "--apply"}, wantErr: "--apply requires --file"},
+		{name: "unknown flag", args: []string{"!a b", "--dry-run"}, wantErr: "unknown flag"},
+		{name: "two commands", args: []string{"!a b", "!c d"}, wantErr: "unexpected argument"},
+		{name: "unknown output", args: []string{"!a b", "--output", "yaml"}, wantErr: "--output must be"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := parseExecArgs(tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if *opts != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, *opts)
+			}
+		})
+	}
+}
+
+func TestExec(t *testing.T) {
+	projectDir := t.TempDir()
+	skaiDir := filepath.Join(projectDir, ".skai")
+	assistantDir := filepath.Join(skaiDir, "assistants", "default")
+	if err := os.MkdirAll(assistantDir, 0755); err != nil {
+		t.Fatalf("Failed to create test directories: %v", err)
+	}
+	config := `version: "1.0"
+environment:
+  log_file: skylark.log
+models:
+  openai:
+    gpt-4:
+      api_key: test-key
+`
+	if err := os.WriteFile(filepath.Join(skaiDir, "config.yaml"), []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create config.yaml: %v", err)
+	}
+	prompt := "---\nname: default\ndescription: Test assistant\nmodel: gpt-4\n---\nYou help.\n"
+	if err := os.WriteFile(filepath.Join(assistantDir, "prompt.md"), []byte(prompt), 0644); err != nil {
+		t.Fatalf("Failed to create prompt.md: %v", err)
+	}
+	notes := filepath.Join(projectDir, "notes.md")
+	if err := os.WriteFile(notes, []byte("# Notes\n\n## Roadmap\nShip it.\n"), 0644); err != nil {
+		t.Fatalf("Failed to create notes.md: %v", err)
+	}
+
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	defer os.Chdir(originalWd)
+	if err := os.Chdir(projectDir); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+
+	// Capture the response printed to stdout
+	stdout := os.Stdout
+	defer func() { os.Stdout = stdout }()
+	outFile, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	if err != nil {
+		t.Fatalf("Failed to create output file: %v", err)
+	}
+	defer outFile.Close()
+	os.Stdout = outFile
+
+	cli := NewCLI()
+	defer cli.closeLogging()
+	if err := cli.Exec([]string{"!default summarize #Roadmap#", "--file", "notes.md", "--apply"}); err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+	if os.Stdout != outFile {
+		t.Error("Expected stdout to be restored")
+	}
+
+	printed, err := os.ReadFile(outFile.Name())
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	// The mock provider answers every command with "command"
+	if string(printed) != "command\n" {
+		t.Errorf("Expected only the response on stdout, got %q", printed)
+	}
+
+	updated, err := os.ReadFile(notes)
+	if err != nil {
+		t.Fatalf("Failed to read notes.md: %v", err)
+	}
+	expected := "# Notes\n\n## Roadmap\nShip it.\n-!default summarize #Roadmap#\n\ncommand\n"
+	if string(updated) != expected {
+		t.Errorf("Expected file:\n%q\ngot:\n%q", expected, updated)
+	}
+
+	// With --output json the result is printed as a JSON object
+	jsonFile, err := os.Create(filepath.Join(t.TempDir(), "stdout.json"))
+	if err != nil {
+		t.Fatalf("Failed to create output file: %v", err)
+	}
+	defer jsonFile.Close()
+	os.Stdout = jsonFile
+	if err := cli.Exec([]string{"!default summarize", "--output", "json"}); err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+	printed, err = os.ReadFile(jsonFile.Name())
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	var result batch.CommandResult
+	if err := json.Unmarshal(printed, &result); err != nil {
+		t.Fatalf("Expected JSON output, got %q: %v", printed, err)
+	}
+	if result.Status != batch.StatusOK || result.Assistant != "default" || result.Response != "command" || result.Tokens.TotalTokens != 15 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"errors"
+	"net"
+
+	"github.com/butter-bot-machines/skylark/pkg/breaker"
+	"github.com/butter-bot-machines/skylark/pkg/budget"
+	skerrors "github.com/butter-bot-machines/skylark/pkg/errors"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+)
+
+// Failure categories of commands. The code of each is the status skai
+// exits with, so that scripts can branch on the kind of failure.
+var (
+	exitCodes = skerrors.NewRegistry()
+
+	ExitFailure     = exitCodes.Register("Failure", 1)             // Anything not classified below
+	ExitConfig      = exitCodes.Register("ConfigError", 2)         // Missing or invalid configuration
+	ExitAuth        = exitCodes.Register("AuthError", 3)           // A provider rejected its credentials
+	ExitPartial     = exitCodes.Register("PartialFailure", 4)      // Some files or commands failed
+	ExitBudget      = exitCodes.Register("BudgetExceeded", 5)      // A spending limit was reached
+	ExitUnavailable = exitCodes.Register("ProviderUnavailable", 6) // Providers unreachable, rate limited or failing
+	ExitUsage       = exitCodes.Register("UsageError", 7)          // Unknown command, flag or argument
+)
+
+// ExitCode returns the status skai exits with after err: 0 without one,
+// the code of its category when it was classified, and otherwise the code
+// its causes imply
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if t := skerrors.GetType(err); t != nil {
+		if known, ok := exitCodes.Get(t.Name()); ok && known == t {
+			return t.Code()
+		}
+	}
+	return classify(err).Code()
+}
+
+// classify returns the category of err from its causes
+func classify(err error) skerrors.ErrorType {
+	var perr *provider.Error
+	var netErr net.Error
+	switch {
+	case errors.Is(err, budget.ErrBudgetExceeded):
+		return ExitBudget
+	case errors.As(err, &perr) && perr.Code == provider.ErrAuthentication:
+		return ExitAuth
+	case errors.Is(err, breaker.ErrOpen),
+		provider.Retryable(err),
+		errors.As(err, &netErr):
+		return ExitUnavailable
+	case skerrors.GetType(err) == skerrors.ConfigError:
+		return ExitConfig
+	}
+	return ExitFailure
+}
+
+// partialFailure returns err, the error of a run whose files or commands
+// failed with errs. Failures of a single category report that category;
+// otherwise a run that partly succeeded is a partial failure.
+func partialFailure(err error, errs []error, succeeded bool) error {
+	var category skerrors.ErrorType
+	for i, e := range errs {
+		t := classify(e)
+		if i > 0 && t != category {
+			category = nil
+			break
+		}
+		category = t
+	}
+	switch {
+	case category != nil && category != ExitFailure:
+		return skerrors.Typed(err, category)
+	case succeeded:
+		return skerrors.Typed(err, ExitPartial)
+	}
+	return err
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/breaker"
+	"github.com/butter-bot-machines/skylark/pkg/budget"
+	skerrors "github.com/butter-bot-machines/skylark/pkg/errors"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+)
+
+func TestExitCode(t *testing.T) {
+	_, flagErr := parseRunArgs([]string{"--all"})
+	auth := &provider.Error{Code: provider.ErrAuthentication, Message: "invalid API key"}
+	rateLimit := &provider.Error{Code: provider.ErrRateLimit, Message: "slow down"}
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"success", nil, 0},
+		{"unclassified", errors.New("failed"), 1},
+		{"config", skerrors.Typed(errors.New(".skai directory not found"), ExitConfig), 2},
+		{"config type", skerrors.New(skerrors.ConfigError, "bad value"), 2},
+		{"auth", fmt.Errorf("failed to create processor: %w", auth), 3},
+		{"budget", fmt.Errorf("command failed: %w", fmt.Errorf("%w: daily limit", budget.ErrBudgetExceeded)), 5},
+		{"rate limit", fmt.Errorf("command failed: %w", rateLimit), 6},
+		{"breaker", fmt.Errorf("job held: %w", breaker.ErrOpen), 6},
+		{"network", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, 6},
+		{"usage", flagErr, 7},
+		{"unknown command", NewCLI().Run([]string{"frobnicate"}), 7},
+		{"outermost category", fmt.Errorf("run: %w", skerrors.Typed(fmt.Errorf("%w", auth), ExitPartial)), 4},
+	}
+	for _, tt := range tests {
+		if got := ExitCode(tt.err); got != tt.want {
+			t.Errorf("%s: expected exit code %d, got %d (%v)", tt.name, tt.want, got, tt.err)
+		}
+	}
+}
+
+func TestPartialFailure(t *testing.T) {
+	failed := errors.New("2/3 files failed processing")
+	budgetErr := fmt.Errorf("%w: daily limit", budget.ErrBudgetExceeded)
+	other := errors.New("failed to update file")
+
+	tests := []struct {
+		name      string
+		errs      []error
+		succeeded bool
+		want      int
+	}{
+		{"one category", []error{budgetErr, budgetErr}, true, 5},
+		{"mixed, some succeeded", []error{budgetErr, other}, true, 4},
+		{"mixed, none succeeded", []error{budgetErr, other}, false, 1},
+		{"unclassified, some succeeded", []error{other}, true, 4},
+	}
+	for _, tt := range tests {
+		err := partialFailure(failed, tt.errs, tt.succeeded)
+		if got := ExitCode(err); got != tt.want {
+			t.Errorf("%s: expected exit code %d, got %d", tt.name, tt.want, got)
+		}
+		if err.Error() != failed.Error() {
+			t.Errorf("%s: expected the message to be kept, got %q", tt.name, err)
+		}
+	}
+}
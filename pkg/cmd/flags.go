@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	skerrors "github.com/butter-bot-machines/skylark/pkg/errors"
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+)
+
+// invalidValue matches the flag package's errors for values that do not
+// parse, capturing the flag and the reason
+var invalidValue = regexp.MustCompile(`^invalid (?:boolean )?value ".*" for (?:flag )?-(\S+): (.*)$`)
+
+// newFlagSet creates the flag set of a command. Flags are written with one
+// or two dashes and take their value as the next argument or after "=".
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+// parseFlags parses the flags of fs wherever they appear among args and
+// returns the remaining arguments in order. Arguments after "--" are never
+// taken as flags.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for len(args) > 0 {
+		if err := fs.Parse(args); err != nil {
+			return nil, flagError(fs, err)
+		}
+		rest := fs.Args()
+		if n := len(args) - len(rest); n > 0 && args[n-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		if len(rest) == 0 {
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+	return positional, nil
+}
+
+// noArguments fails on the first of args, for commands taking flags only
+func noArguments(args []string) error {
+	if len(args) > 0 {
+		return skerrors.Typed(fmt.Errorf("unexpected argument: %s", args[0]), ExitUsage)
+	}
+	return nil
+}
+
+// flagError rewords the flag package's errors the way Skylark reports them,
+// as usage errors. Asking for help prints the flags of fs and returns
+// flag.ErrHelp.
+func flagError(fs *flag.FlagSet, err error) error {
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintf(os.Stdout, "Flags of %s:\n", fs.Name())
+		fs.SetOutput(os.Stdout)
+		fs.PrintDefaults()
+		fs.SetOutput(io.Discard)
+		return err
+	}
+	msg := err.Error()
+	if name, ok := strings.CutPrefix(msg, "flag provided but not defined: -"); ok {
+		err = fmt.Errorf("unknown flag: --%s", strings.TrimPrefix(name, "-"))
+	} else if name, ok := strings.CutPrefix(msg, "flag needs an argument: -"); ok {
+		name = strings.TrimPrefix(name, "-")
+		err = fmt.Errorf("--%s requires %s", name, valueName(fs.Lookup(name)))
+	} else if m := invalidValue.FindStringSubmatch(msg); m != nil {
+		err = fmt.Errorf("invalid --%s: %s", m[1], m[2])
+	}
+	return skerrors.Typed(err, ExitUsage)
+}
+
+// valueName names the value a flag takes, from the `quoted` word of its
+// usage, for errors such as "--file requires a path"
+func valueName(f *flag.Flag) string {
+	if f == nil {
+		return "a value"
+	}
+	name, _ := flag.UnquoteUsage(f)
+	switch name {
+	case "", "string", "value":
+		return "a value"
+	}
+	if strings.ContainsRune("aeiou", rune(name[0])) {
+		return "an " + name
+	}
+	return "a " + name
+}
+
+// parseGlobalFlags parses the flags given before the command, which apply
+// to every command, and returns the command and its arguments
+func (c *CLI) parseGlobalFlags(args []string) ([]string, error) {
+	fs := newFlagSet("skai")
+	fs.StringVar(&c.configPath, "config", "", "`path` of the .skai directory or its config.yaml")
+	fs.StringVar(&c.logLevel, "log-level", "", "log `level`: debug, info, warn or error")
+	fs.BoolVar(&c.quiet, "quiet", false, "print errors and requested output only")
+	fs.BoolVar(&c.json, "json", false, "print reports and results as JSON")
+	if err := fs.Parse(args); err != nil {
+		return nil, flagError(fs, err)
+	}
+	if c.logLevel != "" {
+		if _, err := logging.ParseLevel(c.logLevel); err != nil {
+			return nil, skerrors.Typed(fmt.Errorf("invalid --log-level: %w", err), ExitUsage)
+		}
+	}
+	return fs.Args(), nil
+}
+
+// level returns the log level: --log-level, errors only with --quiet, then
+// the configured level, then debug
+func (c *CLI) level(configured string) (logging.Level, error) {
+	switch {
+	case c.logLevel != "":
+		return logging.ParseLevel(c.logLevel)
+	case c.quiet:
+		return logging.LevelError, nil
+	case configured != "":
+		return logging.ParseLevel(configured)
+	default:
+		return logging.LevelDebug, nil
+	}
+}
+
+// skaiDir returns the .skai directory named by --config, or else the
+// nearest one
+func (c *CLI) skaiDir() (string, error) {
+	if c.configPath == "" {
+		return findSkaiDir()
+	}
+	info, err := os.Stat(c.configPath)
+	if err != nil {
+		return "", fmt.Errorf("invalid --config: %w", err)
+	}
+	dir := c.configPath
+	if !info.IsDir() {
+		if filepath.Base(dir) != "config.yaml" {
+			return "", fmt.Errorf("invalid --config: %s is not a .skai directory or its config.yaml", c.configPath)
+		}
+		dir = filepath.Dir(dir)
+	}
+	return filepath.Abs(dir)
+}
+
+// infof prints a progress or confirmation message, unless --quiet
+func (c *CLI) infof(format string, args ...any) {
+	if !c.quiet {
+		fmt.Printf(format, args...)
+	}
+}
+
+// outputFormat returns output, or JSON when --json was given
+func (c *CLI) outputFormat(output string) string {
+	if c.json {
+		return outputJSON
+	}
+	return output
+}
+
+// printJSON writes v to w as indented JSON
+func printJSON(w io.Writer, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+)
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+		file string
+		wait time.Duration
+		dry  bool
+	}{
+		{"interleaved", []string{"a", "--file", "x.md", "b", "-dry-run"}, []string{"a", "b"}, "x.md", 0, true},
+		{"equals", []string{"--file=x.md", "--wait=5s"}, nil, "x.md", 5 * time.Second, false},
+		{"terminator", []string{"a", "--", "--file", "b"}, []string{"a", "--file", "b"}, "", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var file string
+			var wait time.Duration
+			var dry bool
+			fs := newFlagSet("test")
+			fs.StringVar(&file, "file", "", "document at `path`")
+			fs.DurationVar(&wait, "wait", 0, "time to wait")
+			fs.BoolVar(&dry, "dry-run", false, "change nothing")
+
+			got, err := parseFlags(fs, tt.args)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected arguments %q, got %q", tt.want, got)
+			}
+			if file != tt.file || wait != tt.wait || dry != tt.dry {
+				t.Errorf("Expected file %q, wait %v, dry run %v, got %q, %v, %v", tt.file, tt.wait, tt.dry, file, wait, dry)
+			}
+		})
+	}
+}
+
+func TestFlagErrors(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--verbose"}, "unknown flag: --verbose"},
+		{[]string{"--file"}, "--file requires a path"},
+		{[]string{"--name"}, "--name requires a value"},
+		{[]string{"--addr"}, "--addr requires an address"},
+		{[]string{"--wait", "soon"}, "invalid --wait"},
+	}
+	for _, tt := range tests {
+		fs := newFlagSet("test")
+		fs.String("file", "", "document at `path`")
+		fs.String("name", "", "name to use")
+		fs.String("addr", "", "listen on `address`")
+		fs.Duration("wait", 0, "time to wait")
+		_, err := parseFlags(fs, tt.args)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Expected error containing %q for %q, got %v", tt.want, tt.args, err)
+		}
+	}
+}
+
+func TestGlobalFlags(t *testing.T) {
+	c := NewCLI()
+	args, err := c.parseGlobalFlags([]string{"--config", ".skai", "--log-level", "warn", "--quiet", "--json", "run", "--diff"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(args, []string{"run", "--diff"}) {
+		t.Errorf("Expected the command and its flags to remain, got %q", args)
+	}
+	if c.configPath != ".skai" || c.logLevel != "warn" || !c.quiet || !c.json {
+		t.Errorf("Expected every global flag to be set, got %+v", c)
+	}
+	if got := c.outputFormat(outputText); got != outputJSON {
+		t.Errorf("Expected --json to select JSON output, got %q", got)
+	}
+
+	if _, err := NewCLI().parseGlobalFlags([]string{"--log-level", "loud", "status"}); err == nil {
+		t.Error("Expected an invalid log level to fail")
+	}
+}
+
+func TestLevel(t *testing.T) {
+	tests := []struct {
+		name       string
+		logLevel   string
+		quiet      bool
+		configured string
+		want       logging.Level
+	}{
+		{"default", "", false, "", logging.LevelDebug},
+		{"configured", "", false, "info", logging.LevelInfo},
+		{"quiet", "", true, "info", logging.LevelError},
+		{"flag", "warn", true, "info", logging.LevelWarn},
+	}
+	for _, tt := range tests {
+		c := &CLI{logLevel: tt.logLevel, quiet: tt.quiet}
+		got, err := c.level(tt.configured)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: expected level %v, got %v (%v)", tt.name, tt.want, got, err)
+		}
+	}
+}
+
+func TestSkaiDirFlag(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), ".skai")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	configFile := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(configFile, []byte("version: \"1.0\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(dir, "other.yaml")
+	if err := os.WriteFile(other, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{dir, configFile} {
+		c := &CLI{configPath: path}
+		if got, err := c.skaiDir(); err != nil || got != dir {
+			t.Errorf("Expected --config %s to select %s, got %s (%v)", path, dir, got, err)
+		}
+	}
+	for _, path := range []string{other, filepath.Join(dir, "missing")} {
+		c := &CLI{configPath: path}
+		if _, err := c.skaiDir(); err == nil || !strings.Contains(err.Error(), "invalid --config") {
+			t.Errorf("Expected --config %s to be rejected, got %v", path, err)
+		}
+	}
+}
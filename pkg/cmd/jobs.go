@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/job"
+)
+
+// deadLetterFile is the name of the dead letter store inside the .skai directory
+const deadLetterFile = "dead_letter.json"
+
+// deadLetters returns the store for permanently failed jobs
+func (c *CLI) deadLetters() *job.DeadLetterStore {
+	dir := c.config.GetConfig().Environment.ConfigDir
+	return job.NewDeadLetterStore(filepath.Join(dir, deadLetterFile))
+}
+
+// Jobs inspects and retries jobs that failed permanently
+func (c *CLI) Jobs(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("expected 'failed' or 'retry' subcommands")
+	}
+
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "failed":
+		if len(args) > 1 {
+			entry, err := c.deadLetters().Get(args[1])
+			if err != nil {
+				return err
+			}
+			printDeadLetter(os.Stdout, entry)
+			return nil
+		}
+		entries, err := c.deadLetters().List()
+		if err != nil {
+			return err
+		}
+		printDeadLetters(os.Stdout, entries)
+		return nil
+	case "retry":
+		if len(args) < 2 {
+			return fmt.Errorf("retry requires a job id")
+		}
+		return c.retryDeadLetter(args[1])
+	default:
+		return fmt.Errorf("unknown jobs command: %s", args[0])
+	}
+}
+
+// retryDeadLetter runs a failed job again, removing it from the store on success
+func (c *CLI) retryDeadLetter(id string) error {
+	store := c.deadLetters()
+	entry, err := store.Get(id)
+	if err != nil {
+		return err
+	}
+	if !entry.Retryable() {
+		return fmt.Errorf("job %s cannot be retried: no payload recorded", id)
+	}
+
+	proc, err := c.newProcessor(c.config.GetConfig())
+	if err != nil {
+		return fmt.Errorf("failed to create processor: %w", err)
+	}
+	defer proc.Close()
+
+	c.logger.Info("retrying failed job", "id", id, "path", entry.Job.Path)
+	ctx := context.Background()
+	if timeout := c.config.GetConfig().Workers.JobTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	j := job.FromRecords([]job.Record{entry.Job}, proc)[0]
+	if err := j.Process(ctx); err != nil {
+		return fmt.Errorf("retry of job %s failed: %w", id, err)
+	}
+
+	if err := store.Remove(id); err != nil {
+		return err
+	}
+	c.infof("Retried job %s (%s) successfully\n", id, entry.Job.Path)
+	return nil
+}
+
+// printDeadLetters writes a summary table of failed jobs
+func printDeadLetters(w io.Writer, entries []job.DeadLetter) {
+	if len(entries) == 0 {
+		fmt.Fprintln(w, "No failed jobs")
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tFAILED AT\tATTEMPTS\tPATH\tERROR")
+	for _, e := range entries {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n",
+			e.ID,
+			e.FailedAt.Local().Format(time.DateTime),
+			e.Attempts,
+			e.Job.Path,
+			firstLine(e.Error))
+	}
+	tw.Flush()
+}
+
+// printDeadLetter writes the full details of a failed job
+func printDeadLetter(w io.Writer, e job.DeadLetter) {
+	fmt.Fprintf(w, "ID:        %s\n", e.ID)
+	fmt.Fprintf(w, "Path:      %s\n", e.Job.Path)
+	fmt.Fprintf(w, "Priority:  %s\n", e.Job.Priority)
+	fmt.Fprintf(w, "Failed at: %s\n", e.FailedAt.Local().Format(time.DateTime))
+	fmt.Fprintf(w, "Attempts:  %d\n", e.Attempts)
+	fmt.Fprintf(w, "Error:     %s\n", e.Error)
+	if e.Stack != "" {
+		fmt.Fprintf(w, "\nStack trace:\n%s\n", strings.TrimRight(e.Stack, "\n"))
+	}
+}
+
+// firstLine returns the first line of s
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
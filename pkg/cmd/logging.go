@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+	slogging "github.com/butter-bot-machines/skylark/pkg/logging/slog"
+)
+
+// setupLogging applies the configured level, format and log file. Every
+// entry written during the run carries the same run_id.
+func (c *CLI) setupLogging() error {
+	cfg := c.config.GetConfig()
+
+	level, err := c.level(cfg.Environment.LogLevel)
+	if err != nil {
+		return fmt.Errorf("invalid log level: %w", err)
+	}
+
+	format := cfg.Logging.Format
+	if format == "" || c.json {
+		format = logging.FormatJSON
+	}
+
+	var out io.Writer = os.Stdout
+	if cfg.Environment.LogFile != "" {
+		path := cfg.Environment.LogFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(cfg.Environment.ConfigDir, path)
+		}
+		file, err := logging.NewRotatingFile(path, logging.RotateOptions{
+			MaxSize:    int64(cfg.Logging.MaxSize) << 20,
+			MaxAge:     cfg.Logging.MaxAge,
+			MaxBackups: cfg.Logging.MaxBackups,
+		})
+		if err != nil {
+			return err
+		}
+		c.closeLogging()
+		c.logFile = file
+		out = file
+	}
+
+	c.runID = logging.NewID()
+	c.logger = slogging.NewLoggerWithFormat(level, out, format).With("run_id", c.runID)
+
+	// Package loggers write through the default handler
+	slog.SetDefault(logging.NewLogger(&logging.Options{
+		Level:  level.SlogLevel(),
+		Output: out,
+		JSON:   format == logging.FormatJSON,
+	}).With("run_id", c.runID))
+	return nil
+}
+
+// closeLogging closes the log file if one is open
+func (c *CLI) closeLogging() {
+	if c.logFile != nil {
+		c.logFile.Close()
+		c.logFile = nil
+	}
+}
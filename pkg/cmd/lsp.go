@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/butter-bot-machines/skylark/pkg/lsp"
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+)
+
+// LSP runs a language server over stdin and stdout for editors, offering
+// completion, diagnostics and running commands in place
+func (c *CLI) LSP(args []string) error {
+	fs := newFlagSet("lsp")
+	// Accepted for editors that always pass it; stdio is the only transport
+	fs.Bool("stdio", true, "serve over stdin and stdout")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := noArguments(args); err != nil {
+		return err
+	}
+
+	protocolOut, restore := c.reserveStdout()
+	defer restore()
+
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+
+	// Open the audit log and export traces
+	teardown, err := c.setupRuntime()
+	if err != nil {
+		return err
+	}
+	defer teardown()
+
+	proc, err := c.newProcessor(c.config.GetConfig())
+	if err != nil {
+		return fmt.Errorf("failed to create processor: %w", err)
+	}
+	defer proc.Close()
+	catalog, ok := proc.(processor.Catalog)
+	if !ok {
+		return fmt.Errorf("processor does not expose its assistants")
+	}
+
+	srv, err := lsp.New(lsp.Options{
+		Catalog: catalog,
+		Version: Version,
+		Logger:  c.logger,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	c.logger.Info("serving LSP over stdio")
+	if err := srv.Serve(ctx, os.Stdin, protocolOut); err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
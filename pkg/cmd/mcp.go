@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/mcp"
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+)
+
+// MCP serves the project's tools and assistants to Model Context Protocol
+// clients. By default it speaks over stdin and stdout, as launched by a
+// client; with --sse <addr> it listens for HTTP clients instead.
+func (c *CLI) MCP(args []string) error {
+	if len(args) < 1 || args[0] != "serve" {
+		return fmt.Errorf("expected 'mcp serve [--sse <addr>]'")
+	}
+
+	var sseAddr string
+	fs := newFlagSet("mcp serve")
+	fs.StringVar(&sseAddr, "sse", "", "listen for HTTP clients on `address` instead of stdio")
+	args, err := parseFlags(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	if err := noArguments(args); err != nil {
+		return err
+	}
+
+	// Stdout carries the protocol in stdio mode
+	protocolOut := os.Stdout
+	if sseAddr == "" {
+		var restore func()
+		protocolOut, restore = c.reserveStdout()
+		defer restore()
+	}
+
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+
+	// Open the audit log and export traces
+	teardown, err := c.setupRuntime()
+	if err != nil {
+		return err
+	}
+	defer teardown()
+
+	proc, err := c.newProcessor(c.config.GetConfig())
+	if err != nil {
+		return fmt.Errorf("failed to create processor: %w", err)
+	}
+	defer proc.Close()
+	catalog, ok := proc.(processor.Catalog)
+	if !ok {
+		return fmt.Errorf("processor does not expose its tools")
+	}
+
+	srv, err := mcp.New(mcp.Options{
+		Catalog: catalog,
+		Name:    "skylark",
+		Version: Version,
+		Logger:  c.logger,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if sseAddr == "" {
+		c.logger.Info("serving MCP over stdio")
+		if err := srv.ServeStdio(ctx, os.Stdin, protocolOut); err != nil && !errors.Is(err, context.Canceled) {
+			return err
+		}
+		return nil
+	}
+	return c.serveMCPSSE(ctx, srv, sseAddr)
+}
+
+// serveMCPSSE serves the SSE transport on addr until ctx is done
+func (c *CLI) serveMCPSSE(ctx context.Context, srv *mcp.Server, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	// Requests inherit ctx so open event streams end on shutdown
+	httpSrv := &http.Server{
+		Handler:           srv.SSEHandler(),
+		ReadHeaderTimeout: 5 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- httpSrv.Serve(ln)
+	}()
+	c.logger.Info("serving MCP over SSE", "addr", ln.Addr().String())
+
+	select {
+	case err := <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return fmt.Errorf("MCP server failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	c.logger.Info("stopping MCP server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+	defer cancel()
+	if err := httpSrv.Shutdown(shutdownCtx); err != nil {
+		c.logger.Warn("failed to stop MCP server", "error", err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"github.com/butter-bot-machines/skylark/pkg/breaker"
+	"github.com/butter-bot-machines/skylark/pkg/budget"
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/notify"
+)
+
+// notifications returns the notifier sending the events of this run to
+// the notifications cfg configures, creating it on first use
+func (c *CLI) notifications(cfg *config.Config) *notify.Notifier {
+	if c.notifier == nil {
+		c.notifier = notify.New(nil, notify.Options{ConfigDir: cfg.Environment.ConfigDir})
+	}
+	c.notifier.SetTargets(cfg.Notifications)
+	return c.notifier
+}
+
+// circuitBreakers returns the circuit breakers of the providers, configured
+// by cfg. They are shared by the processors of a run and hold back its
+// jobs while a provider is down.
+func (c *CLI) circuitBreakers(cfg *config.Config) *breaker.Set {
+	if c.breakers == nil {
+		c.breakers = breaker.New(cfg.Providers.Breaker, nil)
+	}
+	c.breakers.Configure(cfg.Providers.Breaker)
+	c.breakers.SetNotifier(c.notifications(cfg))
+	return c.breakers
+}
+
+// closeNotifier waits for the notifications still being delivered
+func (c *CLI) closeNotifier() {
+	c.notifier.Close()
+}
+
+// spentOn returns the spending recorded for day, as of the budget's last
+// update
+func (c *CLI) spentOn(day string) float64 {
+	b, err := budget.New(c.config.GetConfig(), nil, nil)
+	if err != nil {
+		c.logger.Warn("failed to read spending", "error", err)
+		return 0
+	}
+	if recorded, cost := b.Spent(); recorded == day {
+		return cost
+	}
+	return 0
+}
@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/job"
+	"github.com/butter-bot-machines/skylark/pkg/offline"
+)
+
+// openAIURL is where OpenAI models are reached without a base URL
+const openAIURL = "https://api.openai.com"
+
+// connectivity returns a monitor of whether the providers of cfg can be
+// reached, offline for good when offline mode is forced
+func (c *CLI) connectivity(cfg *config.Config) *offline.Monitor {
+	var hosts []string
+	if cfg.Providers.Mode != config.ProviderReplay {
+		hosts = providerHosts(cfg, http.ProxyFromEnvironment)
+	}
+	return offline.New(offline.Options{
+		Hosts:    hosts,
+		Interval: cfg.Providers.Offline.CheckInterval,
+		Forced:   c.offline,
+	})
+}
+
+// providerHosts returns the host:port addresses requests to the models of
+// cfg go to first: their configured proxy, else the one proxy (as
+// http.ProxyFromEnvironment) picks for their endpoint or base URL, else
+// the endpoint or base URL itself
+func providerHosts(cfg *config.Config, proxy func(*http.Request) (*url.URL, error)) []string {
+	seen := make(map[string]bool)
+	for name, models := range cfg.Models {
+		for _, m := range models {
+			target := ""
+			switch {
+			case name == config.AzureOpenAI:
+				target = m.Endpoint
+			case m.BaseURL != "":
+				target = m.BaseURL
+			case name == "openai":
+				target = openAIURL
+			}
+			if host := firstHop(target, m.Proxy, proxy); host != "" {
+				seen[host] = true
+			}
+		}
+	}
+	hosts := make([]string, 0, len(seen))
+	for host := range seen {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// firstHop returns the host:port address a request to target connects
+// to: the configured proxy when set, else the one proxy returns, else
+// target's own
+func firstHop(target, configured string, proxy func(*http.Request) (*url.URL, error)) string {
+	if configured != "" {
+		return hostPort(configured)
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	if p, err := proxy(&http.Request{URL: u}); err == nil && p != nil {
+		return hostPort(p.String())
+	}
+	return hostPort(target)
+}
+
+// hostPort returns the host:port address of a URL, with the default port
+// of its scheme, or "" when it has no host
+func hostPort(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// hold queues j in the persisted queue when offline, returning whether it
+// did. Files without commands have nothing to send and are dropped.
+func (s *session) hold(j job.Job) bool {
+	s.backlogMu.Lock()
+	defer s.backlogMu.Unlock()
+	if !s.offline.Offline() {
+		return false
+	}
+
+	d := job.DescriptionOf(j)
+	if len(d.Commands) == 0 {
+		return true
+	}
+	if err := job.AppendQueue(s.cli.queuePath(), job.Records([]job.Job{j})); err != nil {
+		s.cli.logger.Error("failed to queue job while offline", "file", d.File, "error", err)
+		return false
+	}
+	s.cli.logger.Info("queued commands while offline",
+		"file", d.File,
+		"commands", len(d.Commands))
+	return true
+}
+
+// watchConnectivity hands the persisted queue to the workers each time
+// connectivity returns
+func (s *session) watchConnectivity() {
+	defer s.draining.Done()
+	for {
+		changed := s.offline.Changed()
+		select {
+		case <-s.stop:
+			return
+		case <-changed:
+		}
+		if s.offline.Offline() {
+			s.cli.infof("Offline: queueing commands until providers can be reached\n")
+			continue
+		}
+		s.drain()
+	}
+}
+
+// drain hands the persisted queue to the workers, at most drain_rate files
+// a minute so the backlog does not run into rate limits. Files not handed
+// over when the session stops are queued again.
+func (s *session) drain() {
+	path := s.cli.queuePath()
+	s.backlogMu.Lock()
+	records, err := job.LoadQueue(path)
+	if err == nil {
+		err = job.SaveQueue(path, nil)
+	}
+	s.backlogMu.Unlock()
+	if err != nil {
+		s.cli.logger.Warn("failed to drain offline queue", "error", err)
+		return
+	}
+	if len(records) == 0 {
+		return
+	}
+
+	s.cli.logger.Info("draining offline queue", "jobs", len(records))
+	s.cli.infof("Back online: processing %d queued files\n", len(records))
+	s.mu.Lock()
+	proc := s.proc
+	s.mu.Unlock()
+
+	var interval time.Duration
+	if rate := s.cli.config.GetConfig().Providers.Offline.DrainRate; rate > 0 {
+		interval = time.Minute / time.Duration(rate)
+	}
+	for i, j := range job.FromRecords(records, proc) {
+		if i > 0 && interval > 0 {
+			select {
+			case <-time.After(interval):
+			case <-s.stop:
+				s.requeue(records[i:])
+				return
+			}
+		}
+		select {
+		case s.pool.Queue() <- j:
+		case <-s.stop:
+			s.requeue(records[i:])
+			return
+		}
+	}
+}
+
+// requeue puts records back in the persisted queue
+func (s *session) requeue(records []job.Record) {
+	s.backlogMu.Lock()
+	defer s.backlogMu.Unlock()
+	if err := job.AppendQueue(s.cli.queuePath(), records); err != nil {
+		s.cli.logger.Error("failed to persist offline queue", "error", err)
+	}
+}
+
+// backlog returns the number of files waiting in the persisted queue
+func (s *session) backlog() int {
+	s.backlogMu.Lock()
+	defer s.backlogMu.Unlock()
+	records, err := job.LoadQueue(s.cli.queuePath())
+	if err != nil {
+		return 0
+	}
+	return len(records)
+}
@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/worker"
+)
+
+const (
+	// progressInterval is how often the progress view is redrawn
+	progressInterval = 500 * time.Millisecond
+
+	// maxProgressFiles limits how many files the progress view shows
+	maxProgressFiles = 8
+
+	// maxTrackedFiles bounds the memory used for finished files
+	maxTrackedFiles = 100
+
+	// maxCommandWidth truncates long commands in the progress view
+	maxCommandWidth = 40
+)
+
+// fileProgress tracks the latest state of a single file
+type fileProgress struct {
+	file     string
+	state    worker.EventType
+	commands []string
+	attempt  int
+	err      error
+	started  time.Time
+	duration time.Duration
+	updated  time.Time
+	progress string // Latest progress message of the running job
+}
+
+// progressView aggregates progress events into a per-file status display
+type progressView struct {
+	files    map[string]*fileProgress
+	finished int
+	elapsed  time.Duration // Summed run time of finished jobs, for the ETA
+	lines    int           // Lines drawn by the last render
+}
+
+// newProgressView creates an empty progress view
+func newProgressView() *progressView {
+	return &progressView{
+		files: make(map[string]*fileProgress),
+	}
+}
+
+// apply updates the view with an event
+func (v *progressView) apply(e worker.Event) {
+	if e.Finished() {
+		v.finished++
+		v.elapsed += e.Duration
+	}
+	if e.File == "" {
+		return
+	}
+
+	f, ok := v.files[e.File]
+	if !ok {
+		f = &fileProgress{file: e.File, state: worker.EventStarted, started: e.Time}
+		v.files[e.File] = f
+	}
+	if e.Type == worker.EventProgress {
+		f.progress = e.Message
+		f.updated = e.Time
+		return
+	}
+	f.progress = ""
+	f.state = e.Type
+	if len(e.Commands) > 0 {
+		f.commands = e.Commands
+	}
+	f.attempt = e.Attempt
+	f.err = e.Err
+	f.duration = e.Duration
+	f.updated = e.Time
+	if e.Type == worker.EventStarted {
+		f.started = e.Time
+	}
+
+	v.prune()
+}
+
+// prune forgets the oldest finished files once too many are tracked
+func (v *progressView) prune() {
+	if len(v.files) <= maxTrackedFiles {
+		return
+	}
+	var oldest *fileProgress
+	for _, f := range v.files {
+		if f.state != worker.EventCompleted && f.state != worker.EventFailed {
+			continue
+		}
+		if oldest == nil || f.updated.Before(oldest.updated) {
+			oldest = f
+		}
+	}
+	if oldest != nil {
+		delete(v.files, oldest.file)
+	}
+}
+
+// eta estimates how long the remaining jobs will take, or 0 if unknown
+func (v *progressView) eta(stats worker.Stats) time.Duration {
+	workers := stats.ActiveWorkers
+	if v.finished == 0 || workers == 0 {
+		return 0
+	}
+	avg := v.elapsed / time.Duration(v.finished)
+	remaining := time.Duration(stats.QueuedJobs)
+	return avg * remaining / time.Duration(workers)
+}
+
+// render redraws the view in place, replacing the previous render
+func (v *progressView) render(w io.Writer, stats worker.Stats, now time.Time) {
+	var b strings.Builder
+	if v.lines > 0 {
+		fmt.Fprintf(&b, "\033[%dA\033[J", v.lines) // Move up and clear
+	}
+
+	files := make([]*fileProgress, 0, len(v.files))
+	for _, f := range v.files {
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].updated.Equal(files[j].updated) {
+			return files[i].updated.After(files[j].updated)
+		}
+		return files[i].file < files[j].file
+	})
+	if len(files) > maxProgressFiles {
+		files = files[:maxProgressFiles]
+	}
+
+	lines := 0
+	for _, f := range files {
+		fmt.Fprintf(&b, "  %s\n", f.describe(now))
+		lines++
+	}
+
+	eta := "-"
+	if d := v.eta(stats); d > 0 {
+		eta = d.Round(time.Second).String()
+	}
+	fmt.Fprintf(&b, "Processed: %d, Failed: %d, Queued: %d, Workers: %d, ETA: %s\n",
+		stats.ProcessedJobs,
+		stats.FailedJobs,
+		stats.QueuedJobs,
+		stats.ActiveWorkers,
+		eta)
+	lines++
+
+	v.lines = lines
+	io.WriteString(w, b.String())
+}
+
+// describe returns the status line for a file
+func (f *fileProgress) describe(now time.Time) string {
+	name := filepath.Base(f.file)
+	var status string
+	switch f.state {
+	case worker.EventQueued:
+		status = "· queued"
+	case worker.EventStarted:
+		status = fmt.Sprintf("▶ running %s", now.Sub(f.started).Round(time.Second))
+	case worker.EventRetrying:
+		status = fmt.Sprintf("↻ retrying after attempt %d: %v", f.attempt, f.err)
+	case worker.EventCompleted:
+		status = fmt.Sprintf("✓ done in %s", f.duration.Round(time.Millisecond))
+	case worker.EventFailed:
+		status = fmt.Sprintf("✗ failed: %v", f.err)
+	}
+
+	line := fmt.Sprintf("%-24s %s", name, status)
+	if f.progress != "" {
+		return line + "  " + f.progress
+	}
+	if cmds := summarizeCommands(f.commands); cmds != "" && f.state != worker.EventFailed && f.state != worker.EventRetrying {
+		line += "  " + cmds
+	}
+	return line
+}
+
+// summarizeCommands shortens a file's commands to fit on one line
+func summarizeCommands(commands []string) string {
+	if len(commands) == 0 {
+		return ""
+	}
+	s := commands[0]
+	if len(s) > maxCommandWidth {
+		s = s[:maxCommandWidth-3] + "..."
+	}
+	if len(commands) > 1 {
+		s += fmt.Sprintf(" (+%d more)", len(commands)-1)
+	}
+	return s
+}
+
+// printEvent writes a single progress event as a plain line, for output
+// that is not a terminal
+func printEvent(w io.Writer, e worker.Event) {
+	if e.File == "" {
+		return
+	}
+	switch e.Type {
+	case worker.EventRetrying:
+		fmt.Fprintf(w, "%s %s (attempt %d): %v\n", e.Type, e.File, e.Attempt, e.Err)
+	case worker.EventFailed:
+		fmt.Fprintf(w, "%s %s after %s: %v\n", e.Type, e.File, e.Duration.Round(time.Millisecond), e.Err)
+	case worker.EventCompleted:
+		fmt.Fprintf(w, "%s %s in %s\n", e.Type, e.File, e.Duration.Round(time.Millisecond))
+	case worker.EventProgress:
+		fmt.Fprintf(w, "%s %s: %s\n", e.Type, e.File, e.Message)
+	default:
+		fmt.Fprintf(w, "%s %s\n", e.Type, e.File)
+	}
+}
+
+// isTerminal reports whether f is attached to a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/worker"
+)
+
+func TestProgressView(t *testing.T) {
+	start := time.Now()
+	view := newProgressView()
+
+	view.apply(worker.Event{Type: worker.EventQueued, File: "/notes/a.md", Commands: []string{"!summarize this"}, Time: start})
+	view.apply(worker.Event{Type: worker.EventStarted, File: "/notes/a.md", Commands: []string{"!summarize this"}, Time: start})
+	view.apply(worker.Event{Type: worker.EventCompleted, File: "/notes/a.md", Duration: 2 * time.Second, Time: start.Add(2 * time.Second)})
+	view.apply(worker.Event{Type: worker.EventStarted, File: "/notes/b.md", Commands: []string{"!research", "!summarize"}, Time: start.Add(2 * time.Second)})
+	view.apply(worker.Event{Type: worker.EventFailed, File: "/notes/c.md", Err: errors.New("rate limited"), Time: start.Add(3 * time.Second)})
+
+	stats := worker.Stats{ProcessedJobs: 1, FailedJobs: 1, QueuedJobs: 4, ActiveWorkers: 2}
+	if got := view.eta(stats); got != 2*time.Second {
+		t.Errorf("Expected ETA of 2s, got %v", got)
+	}
+
+	var out strings.Builder
+	view.render(&out, stats, start.Add(5*time.Second))
+	got := out.String()
+	for _, want := range []string{
+		"a.md", "done in 2s", "!summarize this",
+		"b.md", "running 3s", "(+1 more)",
+		"c.md", "failed: rate limited",
+		"Processed: 1, Failed: 1, Queued: 4, Workers: 2, ETA: 2s",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %q in render, got:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "\033[") {
+		t.Errorf("Expected first render not to move the cursor, got:\n%q", got)
+	}
+
+	// Later renders replace the previous one in place
+	out.Reset()
+	view.render(&out, stats, start.Add(6*time.Second))
+	if !strings.HasPrefix(out.String(), "\033[4A\033[J") {
+		t.Errorf("Expected render to clear previous 4 lines, got:\n%q", out.String())
+	}
+}
+
+func TestProgressViewMessages(t *testing.T) {
+	start := time.Now()
+	view := newProgressView()
+	view.apply(worker.Event{Type: worker.EventStarted, File: "/notes/b.md", Commands: []string{"!research"}, Time: start})
+	view.apply(worker.Event{Type: worker.EventProgress, File: "/notes/b.md", Message: "crawler: page 3 of 10 (30%)", Time: start.Add(time.Second)})
+
+	now := start.Add(2 * time.Second)
+	if got := view.files["/notes/b.md"].describe(now); !strings.Contains(got, "running 2s  crawler: page 3 of 10 (30%)") {
+		t.Errorf("Expected the progress message in place of the commands, got %q", got)
+	}
+
+	// Progress ends with the job
+	view.apply(worker.Event{Type: worker.EventCompleted, File: "/notes/b.md", Duration: 3 * time.Second, Time: start.Add(3 * time.Second)})
+	if got := view.files["/notes/b.md"].describe(now); strings.Contains(got, "crawler") || !strings.Contains(got, "!research") {
+		t.Errorf("Expected the commands after completion, got %q", got)
+	}
+}
+
+func TestPrintEvent(t *testing.T) {
+	var out strings.Builder
+	printEvent(&out, worker.Event{Type: worker.EventRetrying, File: "a.md", Attempt: 1, Err: errors.New("timeout")})
+	printEvent(&out, worker.Event{Type: worker.EventCompleted, File: "a.md", Duration: 1500 * time.Millisecond})
+	printEvent(&out, worker.Event{Type: worker.EventQueued})
+	printEvent(&out, worker.Event{Type: worker.EventProgress, File: "b.md", Message: "crawler: page 3 of 10"})
+
+	want := "retrying a.md (attempt 1): timeout\ncompleted a.md in 1.5s\nprogress b.md: crawler: page 3 of 10\n"
+	if out.String() != want {
+		t.Errorf("Expected %q, got %q", want, out.String())
+	}
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/job"
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+)
+
+// defaultShutdownGrace is how long in-flight jobs get to finish when
+// workers.shutdown_grace is not configured
+const defaultShutdownGrace = 10 * time.Second
+
+// queueFile is the name of the persisted queue inside the .skai directory
+const queueFile = "queue.json"
+
+// queuePath returns the location of the persisted queue
+func (c *CLI) queuePath() string {
+	return filepath.Join(c.config.GetConfig().Environment.ConfigDir, queueFile)
+}
+
+// resumeQueue replays jobs persisted by the previous shutdown. With
+// noResume set the saved queue is discarded instead.
+func (c *CLI) resumeQueue(queue chan<- job.Job, proc processor.ProcessManager, noResume bool) error {
+	path := c.queuePath()
+	records, err := job.LoadQueue(path)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	// The saved queue is consumed either way
+	if err := job.SaveQueue(path, nil); err != nil {
+		return err
+	}
+
+	if noResume {
+		c.logger.Info("discarding persisted queue", "jobs", len(records))
+		return nil
+	}
+
+	c.logger.Info("resuming persisted queue", "jobs", len(records))
+	c.infof("Resuming %d queued jobs\n", len(records))
+	for _, j := range job.FromRecords(records, proc) {
+		queue <- j
+	}
+	return nil
+}
+
+// persistQueue saves jobs that did not complete so the next start can
+// replay them, along with those queued while offline
+func (c *CLI) persistQueue(pending []job.Job) error {
+	records := job.Records(pending)
+	if err := job.AppendQueue(c.queuePath(), records); err != nil {
+		return err
+	}
+	if len(records) > 0 {
+		c.logger.Info("persisted unprocessed jobs",
+			"jobs", len(records),
+			"path", c.queuePath())
+		c.infof("\nSaved %d unprocessed jobs for next start\n", len(records))
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+	"github.com/butter-bot-machines/skylark/pkg/repl"
+)
+
+// REPL opens an interactive conversation with an assistant, the default
+// one unless named. Logs go to stderr so they do not interleave with the
+// conversation.
+func (c *CLI) REPL(args []string) error {
+	args, err := parseFlags(newFlagSet("repl"), args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("expected 'repl [assistant]'")
+	}
+	assistantName := "default"
+	if len(args) == 1 {
+		assistantName = args[0]
+	}
+
+	out, restore := c.reserveStdout()
+	defer restore()
+
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+
+	// Open the audit log and export traces
+	teardown, err := c.setupRuntime()
+	if err != nil {
+		return err
+	}
+	defer teardown()
+
+	proc, err := c.newProcessor(c.config.GetConfig())
+	if err != nil {
+		return fmt.Errorf("failed to create processor: %w", err)
+	}
+	defer proc.Close()
+	catalog, ok := proc.(processor.Catalog)
+	if !ok {
+		return fmt.Errorf("processor does not expose its tools")
+	}
+	cp, ok := proc.(processor.ContextCommandProcessor)
+	if !ok {
+		return fmt.Errorf("processor does not accept a context")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	session, err := repl.New(ctx, repl.Options{
+		Catalog:   catalog,
+		Processor: cp,
+		Assistant: assistantName,
+	})
+	if err != nil {
+		return err
+	}
+
+	c.logger.Info("starting repl", "assistant", assistantName)
+	if err := session.Run(ctx, os.Stdin, out); err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
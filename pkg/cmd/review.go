@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/butter-bot-machines/skylark/pkg/diff"
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+	"github.com/butter-bot-machines/skylark/pkg/state"
+)
+
+// Review presents the responses held for approval, one at a time, and
+// writes, edits or discards each as the user decides. Without files, every
+// document with pending responses is reviewed.
+func (c *CLI) Review(args []string) error {
+	args, err := parseFlags(newFlagSet("review"), args)
+	if err != nil {
+		return err
+	}
+
+	out, restore := c.reserveStdout()
+	defer restore()
+
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+
+	// Open the audit log and export traces
+	teardown, err := c.setupRuntime()
+	if err != nil {
+		return err
+	}
+	defer teardown()
+
+	files := args
+	if len(files) == 0 {
+		store, err := state.Open(c.config.GetConfig().Environment.ConfigDir)
+		if err != nil {
+			return err
+		}
+		files = pendingDocuments(store)
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(out, "No responses awaiting review")
+		return nil
+	}
+
+	proc, err := c.newProcessor(c.config.GetConfig())
+	if err != nil {
+		return fmt.Errorf("failed to create processor: %w", err)
+	}
+	defer proc.Close()
+	reviewer, ok := proc.(processor.Reviewer)
+	if !ok {
+		return fmt.Errorf("processor does not support review")
+	}
+
+	return review(bufio.NewReader(os.Stdin), out, reviewer, files, editResponse)
+}
+
+// pendingDocuments returns the documents with responses held for review
+func pendingDocuments(store *state.Store) []string {
+	var documents []string
+	for _, document := range store.Documents() {
+		for _, r := range store.Records(document) {
+			if r.Outcome == state.OutcomePending {
+				documents = append(documents, document)
+				break
+			}
+		}
+	}
+	return documents
+}
+
+// review walks through the pending responses of files, reading a decision
+// for each from in. edit lets the user change a response before it is
+// accepted.
+func review(in *bufio.Reader, out io.Writer, reviewer processor.Reviewer, files []string, edit func(string) (string, error)) error {
+	var accepted, rejected, skipped int
+	defer func() {
+		fmt.Fprintf(out, "\n%d accepted, %d rejected, %d skipped\n", accepted, rejected, skipped)
+	}()
+
+	for _, file := range files {
+		skip := make(map[string]bool)
+		for {
+			// Each decision changes the document or its records, so the
+			// pending responses are looked up again
+			r, ok, err := nextPending(reviewer, file, skip)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				break
+			}
+
+			answer, err := decide(in, out, reviewer, file, &r, edit)
+			if err != nil {
+				return err
+			}
+			switch answer {
+			case "a":
+				if err := reviewer.Approve(file, r); err != nil {
+					return err
+				}
+				accepted++
+			case "r":
+				if err := reviewer.Reject(file, r); err != nil {
+					return err
+				}
+				rejected++
+			case "s":
+				skip[r.Key] = true
+				skipped++
+			case "q":
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// nextPending returns the first pending response of file not in skip
+func nextPending(reviewer processor.Reviewer, file string, skip map[string]bool) (processor.PendingResponse, bool, error) {
+	pending, err := reviewer.Pending(file)
+	if err != nil {
+		return processor.PendingResponse{}, false, err
+	}
+	for _, r := range pending {
+		if !skip[r.Key] {
+			return r, true, nil
+		}
+	}
+	return processor.PendingResponse{}, false, nil
+}
+
+// decide shows the change r makes to file and asks what to do with it.
+// Edits update r and show it again.
+func decide(in *bufio.Reader, out io.Writer, reviewer processor.Reviewer, file string, r *processor.PendingResponse, edit func(string) (string, error)) (string, error) {
+	for {
+		before, after, err := reviewer.Preview(file, *r)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(out, "\n%s:%d  %s\n", file, r.Line, r.Command.Original)
+		fmt.Fprint(out, diff.Unified(file, file, before, after))
+
+		answer, err := prompt(in, out)
+		if err != nil || answer != "e" {
+			return answer, err
+		}
+		if r.Response.Response, err = edit(r.Response.Response); err != nil {
+			return "", err
+		}
+	}
+}
+
+// prompt asks for a review decision until a valid one is given
+func prompt(in *bufio.Reader, out io.Writer) (string, error) {
+	for {
+		fmt.Fprint(out, "[a]ccept, [r]eject, [e]dit, [s]kip or [q]uit? ")
+		line, err := in.ReadString('\n')
+		answer := strings.ToLower(strings.TrimSpace(line))
+		switch answer {
+		case "a", "r", "e", "s", "q":
+			return answer, nil
+		}
+		if err == io.EOF {
+			return "q", nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// editResponse opens response in $EDITOR (vi by default) and returns the
+// edited text
+func editResponse(response string) (string, error) {
+	f, err := os.CreateTemp("", "skai-review-*.md")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(response); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+	fields := strings.Fields(editor)
+	cmd := exec.Command(fields[0], append(fields[1:], f.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("editor failed: %w", err)
+	}
+
+	edited, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(edited), "\n"), nil
+}
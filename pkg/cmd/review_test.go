@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+)
+
+// fakeReviewer holds pending responses in memory, recording decisions
+type fakeReviewer struct {
+	pending  []processor.PendingResponse
+	approved []string
+	rejected []string
+}
+
+func (f *fakeReviewer) Pending(path string) ([]processor.PendingResponse, error) {
+	return f.pending, nil
+}
+
+func (f *fakeReviewer) Preview(path string, r processor.PendingResponse) (string, string, error) {
+	return r.Command.Original + "\n", r.Response.Response + "\n", nil
+}
+
+func (f *fakeReviewer) Approve(path string, r processor.PendingResponse) error {
+	f.approved = append(f.approved, r.Response.Response)
+	return f.remove(r.Key)
+}
+
+func (f *fakeReviewer) Reject(path string, r processor.PendingResponse) error {
+	f.rejected = append(f.rejected, r.Key)
+	return f.remove(r.Key)
+}
+
+func (f *fakeReviewer) remove(key string) error {
+	for i, r := range f.pending {
+		if r.Key == key {
+			f.pending = append(f.pending[:i], f.pending[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func pendingResponse(key, response string) processor.PendingResponse {
+	return processor.PendingResponse{
+		Response: processor.Response{Command: &parser.Command{Original: "!test " + key}, Response: response},
+		Key:      key,
+	}
+}
+
+func TestReview(t *testing.T) {
+	reviewer := &fakeReviewer{pending: []processor.PendingResponse{
+		pendingResponse("one", "First"),
+		pendingResponse("two", "Second"),
+		pendingResponse("three", "Third"),
+		pendingResponse("four", "Fourth"),
+	}}
+	edit := func(response string) (string, error) {
+		return response + " (edited)", nil
+	}
+
+	// Skip one, edit and accept two, reject three, an invalid answer, then quit
+	in := bufio.NewReader(strings.NewReader("s\ne\na\nr\nx\nq\n"))
+	var out bytes.Buffer
+	if err := review(in, &out, reviewer, []string{"notes.md"}, edit); err != nil {
+		t.Fatalf("Review failed: %v", err)
+	}
+
+	if len(reviewer.approved) != 1 || reviewer.approved[0] != "Second (edited)" {
+		t.Errorf("Expected the edited second response approved, got %v", reviewer.approved)
+	}
+	if len(reviewer.rejected) != 1 || reviewer.rejected[0] != "three" {
+		t.Errorf("Expected the third response rejected, got %v", reviewer.rejected)
+	}
+	if len(reviewer.pending) != 2 {
+		t.Errorf("Expected 2 responses left pending, got %d", len(reviewer.pending))
+	}
+	if !strings.Contains(out.String(), "+Second (edited)") {
+		t.Errorf("Expected the edited response to be shown, got:\n%s", out.String())
+	}
+	if !strings.HasSuffix(out.String(), "1 accepted, 1 rejected, 1 skipped\n") {
+		t.Errorf("Expected a summary, got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/butter-bot-machines/skylark/pkg/diff"
+	"github.com/butter-bot-machines/skylark/pkg/processor/concrete"
+)
+
+// runDiff processes the project without writing to it, printing the
+// changes it would make as unified diffs on stdout. The responses are kept
+// as answered, so a later run applies them without asking again.
+func (c *CLI) runDiff() error {
+	out, restore := c.reserveStdout()
+	defer restore()
+
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+
+	// Open the audit log and export traces
+	teardown, err := c.setupRuntime()
+	if err != nil {
+		return err
+	}
+	defer teardown()
+
+	proc, err := concrete.NewProcessorWithOptions(c.config.GetConfig(), concrete.Options{
+		AuditLog: c.auditLog,
+		DryRun:   printDiff(out),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create processor: %w", err)
+	}
+	defer proc.Close()
+
+	files, err := c.projectFiles()
+	if err != nil {
+		return err
+	}
+	c.logger.Info("starting dry run", "file_count", len(files))
+
+	// One file at a time, so diffs do not interleave
+	failed := 0
+	for _, path := range files {
+		if err := proc.ProcessFile(path); err != nil {
+			c.logger.Error("failed to process file", "path", path, "error", err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d/%d files failed processing", failed, len(files))
+	}
+	return nil
+}
+
+// printDiff returns a dry run callback writing each change to out
+func printDiff(out io.Writer) func(path, before, after string) {
+	return func(path, before, after string) {
+		name := filepath.ToSlash(path)
+		fmt.Fprint(out, diff.Unified("a/"+name, "b/"+name, before, after))
+	}
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/butter-bot-machines/skylark/pkg/security"
+	secconcrete "github.com/butter-bot-machines/skylark/pkg/security/concrete"
+)
+
+// Secret manages the encrypted secrets tool environments refer to as
+// secret://<name>
+func (c *CLI) Secret(args []string) error {
+	if err := checkSecretArgs(args); err != nil {
+		return err
+	}
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+	cfg := c.config.GetConfig()
+	if cfg.Security.EncryptionKey == "" {
+		return fmt.Errorf("secrets need security.encryption_key in config.yml, a base64-encoded 32-byte key")
+	}
+	keys, err := secconcrete.NewKeyStore(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to open secret store: %w", err)
+	}
+	defer keys.Close()
+
+	return secret(keys, args, os.Stdin, os.Stdout)
+}
+
+// checkSecretArgs checks `set <name>`, `list` or `delete <name>`
+func checkSecretArgs(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("expected 'set', 'list' or 'delete' subcommand")
+	}
+	want := 2
+	switch args[0] {
+	case "set", "delete":
+	case "list":
+		want = 1
+	default:
+		return fmt.Errorf("unknown secret command: %s", args[0])
+	}
+	if len(args) != want {
+		return fmt.Errorf("expected 'secret set <name>', 'secret list' or 'secret delete <name>'")
+	}
+	return nil
+}
+
+// secret runs a checked secret subcommand against keys. set reads the
+// value from in, so it stays out of the shell history.
+func secret(keys security.KeyStore, args []string, in io.Reader, out io.Writer) error {
+	switch args[0] {
+	case "set":
+		name := args[1]
+		value, err := bufio.NewReader(in).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("failed to read secret: %w", err)
+		}
+		value = strings.TrimRight(value, "\r\n")
+		if value == "" {
+			return fmt.Errorf("secret %s is empty", name)
+		}
+		if err := keys.Set(name, value); err != nil {
+			return fmt.Errorf("failed to store secret: %w", err)
+		}
+		fmt.Fprintf(out, "Stored secret %s; refer to it as secret://%s\n", name, name)
+	case "delete":
+		if err := keys.Delete(args[1]); err != nil {
+			return fmt.Errorf("failed to delete secret %s: %w", args[1], err)
+		}
+		fmt.Fprintf(out, "Deleted secret %s\n", args[1])
+	case "list":
+		names := keys.List()
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintln(out, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fakeKeyStore implements security.KeyStore in memory
+type fakeKeyStore map[string]string
+
+func (s fakeKeyStore) Get(name string) (string, error) {
+	if value, ok := s[name]; ok {
+		return value, nil
+	}
+	return "", errors.New("key not found")
+}
+func (s fakeKeyStore) Set(name, value string) error { s[name] = value; return nil }
+func (s fakeKeyStore) Delete(name string) error {
+	if _, ok := s[name]; !ok {
+		return errors.New("key not found")
+	}
+	delete(s, name)
+	return nil
+}
+func (s fakeKeyStore) List() []string {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	return names
+}
+func (s fakeKeyStore) Close() error { return nil }
+
+func TestSecret(t *testing.T) {
+	keys := fakeKeyStore{}
+	var out strings.Builder
+
+	if err := secret(keys, []string{"set", "search_key"}, strings.NewReader("s3cret\n"), &out); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if keys["search_key"] != "s3cret" {
+		t.Errorf("Expected the secret stored without its newline, got %q", keys["search_key"])
+	}
+	if err := secret(keys, []string{"set", "empty"}, strings.NewReader(""), &out); err == nil || !strings.Contains(err.Error(), "empty") {
+		t.Errorf("Expected empty secret error, got %v", err)
+	}
+	keys["a_key"] = "x"
+
+	out.Reset()
+	if err := secret(keys, []string{"list"}, nil, &out); err != nil || out.String() != "a_key\nsearch_key\n" {
+		t.Errorf("Expected sorted names, got %q, %v", out.String(), err)
+	}
+	if err := secret(keys, []string{"delete", "a_key"}, nil, &out); err != nil || keys["a_key"] != "" {
+		t.Errorf("Expected a_key deleted, got %v", err)
+	}
+	if err := secret(keys, []string{"delete", "a_key"}, nil, &out); err == nil {
+		t.Error("Expected error deleting a missing secret")
+	}
+}
+
+func TestCheckSecretArgs(t *testing.T) {
+	tests := []struct {
+		args    []string
+		wantErr string
+	}{
+		{[]string{"set", "key"}, ""},
+		{[]string{"list"}, ""},
+		{[]string{"delete", "key"}, ""},
+		{nil, "expected 'set', 'list' or 'delete' subcommand"},
+		{[]string{"get", "key"}, "unknown secret command: get"},
+		{[]string{"set"}, "expected 'secret set <name>'"},
+		{[]string{"list", "key"}, "expected 'secret set <name>'"},
+	}
+	for _, tt := range tests {
+		err := checkSecretArgs(tt.args)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("%v: expected no error, got %v", tt.args, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%v: expected error containing %q, got %v", tt.args, tt.wantErr, err)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	skerrors "github.com/butter-bot-machines/skylark/pkg/errors"
+	"github.com/butter-bot-machines/skylark/pkg/update"
+)
+
+// updateReport is the --json output of self-update
+type updateReport struct {
+	Channel string `json:"channel"`
+	Current string `json:"current"`
+	Latest  string `json:"latest"`
+	Notes   string `json:"notes,omitempty"`
+	Updated bool   `json:"updated"`
+}
+
+// SelfUpdate replaces the skai binary with the latest signed release of
+// the configured channel
+func (c *CLI) SelfUpdate(args []string) error {
+	var check bool
+	var channel string
+	fs := newFlagSet("self-update")
+	fs.BoolVar(&check, "check", false, "report whether an update is available without installing it")
+	fs.StringVar(&channel, "channel", "", "release `channel` to follow: stable or beta")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := noArguments(args); err != nil {
+		return err
+	}
+
+	cfg, err := c.updateConfig()
+	if err != nil {
+		return err
+	}
+	if channel != "" {
+		cfg.Channel = config.UpdateChannel(channel)
+		if cfg.Channel == "" || !cfg.Channel.Valid() {
+			return skerrors.Typed(fmt.Errorf("invalid --channel: %s (expected stable or beta)", channel), ExitUsage)
+		}
+	}
+	u, err := update.New(cfg, nil)
+	if err != nil {
+		return skerrors.Typed(err, ExitConfig)
+	}
+
+	ctx := context.Background()
+	release, err := u.Latest(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check for updates: %w", err)
+	}
+	report := updateReport{
+		Channel: string(u.Channel()),
+		Current: Version,
+		Latest:  release.Version,
+		Notes:   release.Notes,
+	}
+
+	if update.Newer(release.Version, Version) && !check {
+		executable, err := os.Executable()
+		if err == nil {
+			executable, err = filepath.EvalSymlinks(executable)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to locate the skai binary: %w", err)
+		}
+		if err := u.Install(ctx, release, executable); err != nil {
+			return fmt.Errorf("failed to install %s: %w", release.Version, err)
+		}
+		report.Updated = true
+	}
+
+	if c.json {
+		return printJSON(os.Stdout, report)
+	}
+	switch {
+	case report.Updated:
+		c.infof("Updated Skylark %s to %s (%s channel)\n", Version, release.Version, report.Channel)
+	case update.Newer(release.Version, Version):
+		fmt.Printf("Skylark %s is available on the %s channel (current %s)\n", release.Version, report.Channel, Version)
+		if release.Notes != "" {
+			fmt.Println(release.Notes)
+		}
+	default:
+		c.infof("Skylark %s is up to date (%s channel)\n", Version, report.Channel)
+	}
+	return nil
+}
+
+// updateConfig returns the update settings of the project, or the defaults
+// when skai runs outside of one
+func (c *CLI) updateConfig() (config.UpdateConfig, error) {
+	if c.configPath == "" {
+		if _, err := findSkaiDir(); err != nil {
+			return config.UpdateConfig{}, nil
+		}
+	}
+	if err := c.loadConfig(); err != nil {
+		return config.UpdateConfig{}, err
+	}
+	return c.config.GetConfig().Update, nil
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSelfUpdateErrors(t *testing.T) {
+	dir := t.TempDir()
+	skaiDir := filepath.Join(dir, ".skai")
+	if err := os.MkdirAll(skaiDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// No release endpoint is configured or built in
+	if err := os.WriteFile(filepath.Join(skaiDir, "config.yaml"), []byte("version: \"1.0\"\nupdate:\n  channel: beta\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"not configured", nil, ExitConfig.Code()},
+		{"unknown channel", []string{"--channel", "nightly"}, ExitUsage.Code()},
+		{"argument", []string{"now"}, ExitUsage.Code()},
+	}
+	for _, tt := range tests {
+		c := &CLI{configPath: skaiDir, quiet: true}
+		err := c.SelfUpdate(tt.args)
+		if got := ExitCode(err); got != tt.want {
+			t.Errorf("%s: expected exit code %d, got %d (%v)", tt.name, tt.want, got, err)
+		}
+	}
+}
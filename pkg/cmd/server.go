@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+	"github.com/butter-bot-machines/skylark/pkg/processor/concrete"
+	"github.com/butter-bot-machines/skylark/pkg/server"
+)
+
+// serverShutdownTimeout bounds how long open status requests may take on exit
+const serverShutdownTimeout = 5 * time.Second
+
+// startServer starts the status server of s when server.listen_addr is
+// set, with the job API running submissions in s when server.api is
+// enabled, and the dashboard controlling s when server.dashboard is. It
+// returns nil when the server is disabled.
+func (c *CLI) startServer(s *session) (*server.Server, error) {
+	cfg := c.config.GetConfig()
+	if cfg.Server.ListenAddr == "" {
+		return nil, nil
+	}
+
+	var api *server.APIOptions
+	if cfg.Server.API.Enabled {
+		api = &server.APIOptions{
+			Tokens:  c.tokenStore(),
+			Run:     s.runSubmission,
+			Workers: cfg.Workers.Count,
+			MaxJobs: cfg.Server.API.MaxJobs,
+		}
+	}
+
+	var dashboard *server.DashboardOptions
+	if cfg.Server.Dashboard {
+		dashboard = &server.DashboardOptions{Control: s, Activity: c.activity}
+	}
+
+	srv, err := server.New(server.Options{
+		Addr:      cfg.Server.ListenAddr,
+		Stats:     s.pool.Stats,
+		Config:    cfg,
+		Logger:    c.logger,
+		Audit:     c.auditLog,
+		API:       api,
+		Dashboard: dashboard,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := srv.Start(); err != nil {
+		return nil, err
+	}
+	return srv, nil
+}
+
+// stopServer shuts down the status server if one is running
+func (c *CLI) stopServer(srv *server.Server) {
+	if srv == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		c.logger.Warn("failed to stop status server", "error", err)
+	}
+}
+
+// runSubmission runs a command submitted through the job API as exec
+// would, reading and applying to its file relative to the project root
+func (s *session) runSubmission(ctx context.Context, sub server.Submission) (string, error) {
+	c := s.cli
+	cfg := c.config.GetConfig()
+	s.mu.Lock()
+	proc := s.proc
+	s.mu.Unlock()
+
+	command := sub.Command
+	if !strings.HasPrefix(command, "!") {
+		command = "!" + command
+	}
+	cmd, err := concrete.NewParser(cfg).ParseCommand(command)
+	if err != nil {
+		return "", err
+	}
+	if sub.File == "" && len(cmd.References) > 0 {
+		return "", fmt.Errorf("command references sections but no file was given")
+	}
+
+	var path, content string
+	if sub.File != "" {
+		path, err = projectFile(filepath.Dir(cfg.Environment.ConfigDir), sub.File)
+		if err != nil {
+			return "", err
+		}
+		data, err := readDocument(proc, path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read file: %w", err)
+		}
+		content = string(data)
+	}
+	if r, ok := proc.(processor.ReferenceResolver); ok {
+		r.AttachReferences(ctx, cmd, path, content)
+	}
+
+	response, err := c.processCommand(ctx, proc, cmd)
+	if err != nil {
+		return "", err
+	}
+	if sub.Apply {
+		if err := applyResponse(proc, path, content, cmd, response); err != nil {
+			return "", err
+		}
+	}
+	return response, nil
+}
+
+// projectFile returns the path of file within root, failing when it, or a
+// symlink on the way, leads outside the project
+func projectFile(root, file string) (string, error) {
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	path, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(file)))
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	if rel, err := filepath.Rel(root, path); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("file is outside the project: %s", file)
+	}
+	return path, nil
+}
+
+// streamEvents publishes the job events of the pool and the notifications
+// of the run on the server's event stream until the session stops
+func (s *session) streamEvents() {
+	jobs, stopJobs := s.pool.Subscribe()
+	notes, stopNotes := s.cli.notifier.Subscribe()
+	go func() {
+		defer stopJobs()
+		defer stopNotes()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case e := <-jobs:
+				s.srv.Publish(server.JobEvent(e))
+			case e := <-notes:
+				s.srv.Publish(e)
+			}
+		}
+	}()
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProjectFile(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "notes"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{filepath.Join(root, "notes", "today.md"), filepath.Join(outside, "secret.md")} {
+		if err := os.WriteFile(path, []byte("# Notes\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.md"), filepath.Join(root, "link.md")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		file    string
+		wantErr bool
+	}{
+		{"notes/today.md", false},
+		{"link.md", true},
+		{"missing.md", true},
+	}
+	for _, tt := range tests {
+		path, err := projectFile(root, tt.file)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: expected error %v, got %v", tt.file, tt.wantErr, err)
+		}
+		if err == nil && filepath.Base(path) != filepath.Base(tt.file) {
+			t.Errorf("%s: expected a path within the project, got %s", tt.file, path)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	skerrors "github.com/butter-bot-machines/skylark/pkg/errors"
+	"github.com/butter-bot-machines/skylark/pkg/service"
+)
+
+// serviceEnvFile is the default environment file of the service inside
+// the .skai directory
+const serviceEnvFile = "service.env"
+
+// Service installs, inspects and removes the systemd unit or launchd agent
+// running the daemon of the project
+func (c *CLI) Service(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("expected 'install', 'status' or 'uninstall' subcommand")
+	}
+
+	var name, envFile string
+	var system, dryRun bool
+	fs := newFlagSet("service " + args[0])
+	fs.StringVar(&name, "name", "", "service `name` (default: skylark-<project directory>)")
+	fs.BoolVar(&system, "system", false, "install a system unit running as the current user rather than a user unit (systemd only)")
+	switch args[0] {
+	case "install":
+		fs.StringVar(&envFile, "env-file", "", "environment `file` of the daemon (default: .skai/"+serviceEnvFile+")")
+		fs.BoolVar(&dryRun, "dry-run", false, "print the unit or property list instead of installing it")
+	case "status", "uninstall":
+	default:
+		return fmt.Errorf("unknown service command: %s", args[0])
+	}
+	rest, err := parseFlags(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	if err := noArguments(rest); err != nil {
+		return err
+	}
+
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+	spec, err := c.serviceSpec(name, envFile, system)
+	if err != nil {
+		return err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to find the home directory: %w", err)
+	}
+	m, err := service.New(service.Options{GOOS: runtime.GOOS, Home: home})
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "install":
+		if dryRun {
+			data, err := m.Render(spec)
+			if err != nil {
+				return skerrors.Typed(err, ExitUsage)
+			}
+			_, err = os.Stdout.Write(data)
+			return err
+		}
+		if err := createEnvFile(spec.EnvFile); err != nil {
+			return err
+		}
+		if err := m.Install(spec); err != nil {
+			return fmt.Errorf("failed to install service %s: %w", spec.Name, err)
+		}
+		c.infof("Installed %s service %s at %s; it runs the daemon of %s\n", m.Kind(), spec.Name, m.Path(spec), spec.ProjectDir)
+		c.infof("Set its environment in %s\n", spec.EnvFile)
+		return nil
+	case "uninstall":
+		if err := m.Uninstall(spec); err != nil {
+			return err
+		}
+		c.infof("Uninstalled service %s\n", spec.Name)
+		return nil
+	default:
+		st, err := m.Status(spec)
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return printJSON(os.Stdout, st)
+		}
+		if !st.Installed {
+			fmt.Printf("Service %s is not installed (no %s)\n", st.Name, st.Path)
+			return nil
+		}
+		fmt.Printf("Service %s (%s): %s\n  %s\n", st.Name, st.Manager, st.State, st.Path)
+		return nil
+	}
+}
+
+// serviceSpec describes the service running the daemon of the project
+func (c *CLI) serviceSpec(name, envFile string, system bool) (service.Spec, error) {
+	configDir := c.config.GetConfig().Environment.ConfigDir
+	projectDir := filepath.Dir(configDir)
+	if name == "" {
+		name = serviceName(projectDir)
+	}
+	if envFile == "" {
+		envFile = filepath.Join(configDir, serviceEnvFile)
+	}
+	envFile, err := filepath.Abs(envFile)
+	if err != nil {
+		return service.Spec{}, err
+	}
+	executable, err := os.Executable()
+	if err == nil {
+		executable, err = filepath.EvalSymlinks(executable)
+	}
+	if err != nil {
+		return service.Spec{}, fmt.Errorf("failed to locate the skai binary: %w", err)
+	}
+
+	spec := service.Spec{
+		Name:               name,
+		Executable:         executable,
+		ProjectDir:         projectDir,
+		ConfigDir:          configDir,
+		EnvFile:            envFile,
+		LogFile:            filepath.Join(configDir, daemonOutput),
+		PermanentExitCodes: []int{ExitConfig.Code(), ExitAuth.Code(), ExitUsage.Code()},
+		System:             system,
+	}
+	if system {
+		// Run as the user installing with sudo rather than as root
+		spec.User = os.Getenv("SUDO_USER")
+		if spec.User == "" {
+			u, err := user.Current()
+			if err != nil {
+				return service.Spec{}, fmt.Errorf("failed to find the current user: %w", err)
+			}
+			spec.User = u.Username
+		}
+	}
+	return spec, nil
+}
+
+// unsafeServiceChars matches what serviceName replaces
+var unsafeServiceChars = regexp.MustCompile(`[^a-z0-9_.-]+`)
+
+// serviceName returns the default service name of the project in dir
+func serviceName(dir string) string {
+	base := strings.Trim(unsafeServiceChars.ReplaceAllString(strings.ToLower(filepath.Base(dir)), "-"), "-.")
+	if base == "" {
+		return "skylark"
+	}
+	return "skylark-" + base
+}
+
+// createEnvFile creates an environment file for the service when there is
+// none, readable by the owner only as it may hold credentials. It starts
+// with the PATH of the installing shell, so tools the assistants run are
+// found as they are from the terminal.
+func createEnvFile(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	content := "# Environment of the skai daemon service, as KEY=VALUE lines\n"
+	if p := os.Getenv("PATH"); p != "" {
+		content += "PATH=" + p + "\n"
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		return fmt.Errorf("failed to create environment file: %w", err)
+	}
+	return nil
+}
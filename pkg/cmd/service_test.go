@@ -0,0 +1,20 @@
+package cmd
+
+import "testing"
+
+func TestServiceName(t *testing.T) {
+	tests := []struct {
+		dir  string
+		want string
+	}{
+		{"/home/ada/notes", "skylark-notes"},
+		{"/home/ada/My Vault (work)", "skylark-my-vault-work"},
+		{"/home/ada/.hidden", "skylark-hidden"},
+		{"/", "skylark"},
+	}
+	for _, tt := range tests {
+		if got := serviceName(tt.dir); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.dir, tt.want, got)
+		}
+	}
+}
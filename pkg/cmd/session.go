@@ -0,0 +1,325 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/daemon"
+	"github.com/butter-bot-machines/skylark/pkg/job"
+	"github.com/butter-bot-machines/skylark/pkg/notify"
+	"github.com/butter-bot-machines/skylark/pkg/offline"
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+	"github.com/butter-bot-machines/skylark/pkg/server"
+	"github.com/butter-bot-machines/skylark/pkg/watcher"
+	wconcrete "github.com/butter-bot-machines/skylark/pkg/watcher/concrete"
+	"github.com/butter-bot-machines/skylark/pkg/worker"
+	wkconcrete "github.com/butter-bot-machines/skylark/pkg/worker/concrete"
+)
+
+// session is the processing pipeline shared by watch and daemon mode: a
+// processor, worker pool, file watcher and optional status server with its
+// job API
+type session struct {
+	cli      *CLI
+	pool     worker.Pool
+	srv      *server.Server
+	jobQueue chan job.Job
+	done     chan struct{} // Closed once the forwarder has handed off all jobs
+	stop     chan struct{} // Closed on shutdown
+	started  time.Time
+	offline  *offline.Monitor
+	draining sync.WaitGroup // Drains of the persisted queue under way
+
+	backlogMu sync.Mutex // Guards the persisted queue while running
+
+	mu       sync.Mutex
+	proc     processor.ProcessManager
+	watcher  watcher.FileWatcher
+	reloaded time.Time
+}
+
+// startSession creates the pipeline from the loaded configuration and
+// starts watching for file changes. While providers cannot be reached,
+// changed files wait in the persisted queue.
+func (c *CLI) startSession() (*session, error) {
+	cfg := c.config.GetConfig()
+	monitor := c.connectivity(cfg)
+	monitor.Start()
+
+	// Create processor
+	proc, err := c.newProcessor(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create processor: %w", err)
+	}
+
+	// Create worker pool
+	c.logger.Debug("creating worker pool",
+		"worker_count", cfg.Workers.Count,
+		"max_workers", cfg.Workers.Max,
+		"queue_size", cfg.Workers.QueueSize)
+
+	pool, err := wkconcrete.NewPool(worker.Options{
+		Config:       c.config,
+		Logger:       c.logger,
+		ProcMgr:      proc.GetProcessManager(),
+		QueueSize:    cfg.Workers.QueueSize,
+		Workers:      cfg.Workers.Count,
+		RetryBackoff: cfg.Workers.RetryBackoff,
+		JobTimeout:   cfg.Workers.JobTimeout,
+		Gates:        []worker.Gate{c.circuitBreakers(cfg), monitor},
+		DeadLetters:  c.deadLetters(),
+
+		MaxWorkers:     cfg.Workers.Max,
+		ScaleThreshold: cfg.Workers.ScaleThreshold,
+		IdleTimeout:    cfg.Workers.IdleTimeout,
+		Concurrency:    cfg.AssistantConcurrency(),
+	})
+	if err != nil {
+		proc.Close()
+		return nil, fmt.Errorf("failed to create worker pool: %w", err)
+	}
+
+	s := &session{
+		cli:      c,
+		pool:     pool,
+		jobQueue: make(chan job.Job, cfg.Workers.QueueSize),
+		done:     make(chan struct{}),
+		stop:     make(chan struct{}),
+		started:  time.Now(),
+		offline:  monitor,
+		proc:     proc,
+	}
+
+	// Serve health and status endpoints, and the job API, when configured
+	srv, err := c.startServer(s)
+	if err != nil {
+		monitor.Stop()
+		pool.Stop()
+		proc.Close()
+		return nil, fmt.Errorf("failed to start status server: %w", err)
+	}
+	s.srv = srv
+	if srv != nil && cfg.Server.API.Enabled {
+		s.streamEvents()
+	}
+
+	// Start file watcher
+	c.logger.Debug("creating file watcher")
+	s.watcher, err = wconcrete.NewWatcher(cfg, s.jobQueue, proc)
+	if err != nil {
+		c.stopServer(srv)
+		monitor.Stop()
+		pool.Stop()
+		proc.Close()
+		return nil, fmt.Errorf("failed to create watcher: %w", err)
+	}
+
+	// Start worker pool consumer, holding jobs back while offline
+	go func() {
+		defer close(s.done)
+		for j := range s.jobQueue {
+			if s.hold(j) {
+				continue
+			}
+			pool.Queue() <- j
+		}
+	}()
+	if monitor.Offline() {
+		c.infof("Offline: queueing commands until providers can be reached\n")
+	}
+	s.draining.Add(1)
+	go s.watchConnectivity()
+
+	c.notifier.Notify(notify.Event{
+		Type: config.NotifyWatchStarted,
+		Data: map[string]interface{}{"project": filepath.Dir(cfg.Environment.ConfigDir)},
+	})
+	go s.summarize()
+	return s, nil
+}
+
+// summarize sends a daily_summary event with the activity of each day
+// that ends while watching
+func (s *session) summarize() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	day := time.Now().Format("2006-01-02")
+	var processed, failed uint64
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			today := now.Format("2006-01-02")
+			if today == day {
+				continue
+			}
+			stats := s.pool.Stats()
+			s.cli.notifier.Notify(notify.Event{
+				Type: config.NotifyDailySummary,
+				Data: map[string]interface{}{
+					"day":       day,
+					"processed": stats.ProcessedJobs - processed,
+					"failed":    stats.FailedJobs - failed,
+					"cost":      s.cli.spentOn(day),
+				},
+			})
+			day, processed, failed = today, stats.ProcessedJobs, stats.FailedJobs
+		}
+	}
+}
+
+// resume replays jobs left over from the previous run. While offline they
+// stay queued until connectivity returns.
+func (s *session) resume(noResume bool) {
+	if !noResume && s.offline.Offline() {
+		return
+	}
+	s.mu.Lock()
+	proc := s.proc
+	s.mu.Unlock()
+
+	if err := s.cli.resumeQueue(s.jobQueue, proc, noResume); err != nil {
+		s.cli.logger.Warn("failed to resume queue", "error", err)
+	}
+}
+
+// Status implements daemon.Controller
+func (s *session) Status() daemon.Status {
+	stats := s.pool.Stats()
+	s.mu.Lock()
+	reloaded := s.reloaded
+	s.mu.Unlock()
+
+	st := daemon.Status{
+		PID:           os.Getpid(),
+		Paused:        s.pool.Paused(),
+		Started:       s.started,
+		Reloaded:      reloaded,
+		QueueDepth:    stats.QueuedJobs,
+		Processed:     stats.ProcessedJobs,
+		Failed:        stats.FailedJobs,
+		ActiveWorkers: stats.ActiveWorkers,
+		LastError:     stats.LastFailure,
+		Offline:       s.offline.Offline(),
+		Backlog:       s.backlog(),
+	}
+	return st
+}
+
+// Pause implements daemon.Controller
+func (s *session) Pause() error {
+	s.pool.Pause()
+	return nil
+}
+
+// Resume implements daemon.Controller
+func (s *session) Resume() error {
+	s.pool.Resume()
+	return nil
+}
+
+// Reload implements daemon.Controller. It re-reads config.yaml and
+// replaces the processor and file watcher, stopping the plugins of the old
+// processor; worker pool, server and logging settings take effect on
+// restart.
+func (s *session) Reload() error {
+	c := s.cli
+	fresh := config.NewManager(c.config.GetConfig().Environment.ConfigDir)
+	if err := fresh.Load(); err != nil {
+		return fmt.Errorf("failed to reload configuration: %w", err)
+	}
+	cfg := fresh.GetConfig()
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("failed to reload configuration: %w", err)
+	}
+
+	proc, err := c.newProcessor(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create processor: %w", err)
+	}
+	w, err := wconcrete.NewWatcher(cfg, s.jobQueue, proc)
+	if err != nil {
+		proc.Close()
+		return fmt.Errorf("failed to create watcher: %w", err)
+	}
+
+	// Start the new watcher before stopping the old one so no change is missed
+	s.mu.Lock()
+	old, oldProc := s.watcher, s.proc
+	s.watcher = w
+	s.proc = proc
+	s.reloaded = time.Now()
+	s.mu.Unlock()
+	old.Stop()
+	if err := oldProc.Close(); err != nil {
+		c.logger.Warn("failed to close previous processor", "error", err)
+	}
+
+	c.config.SetConfig(cfg)
+	c.logger.Info("configuration reloaded")
+	return nil
+}
+
+// shutdown stops watching, gives in-flight jobs the configured grace
+// period, persists what is left and stops the pool and status server
+func (s *session) shutdown() {
+	c := s.cli
+	c.logger.Info("shutting down")
+	close(s.stop)
+
+	// 1. Stop accepting new events and report unhealthy while draining
+	if s.srv != nil {
+		s.srv.SetDraining()
+	}
+	s.mu.Lock()
+	s.watcher.Stop()
+	s.mu.Unlock()
+	c.logger.Debug("stopped file watcher")
+	s.offline.Stop()
+	s.draining.Wait()
+
+	// 2. Stop accepting new jobs
+	close(s.jobQueue)
+	c.logger.Debug("closed job queue")
+
+	// 3. Wait for the forwarder to hand off remaining jobs
+	<-s.done
+	c.logger.Debug("job queue drained")
+
+	// 4. Give in-flight jobs the grace period, then persist what is left
+	grace := c.config.GetConfig().Workers.ShutdownGrace
+	if grace == 0 {
+		grace = defaultShutdownGrace
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	pending := s.pool.Shutdown(ctx)
+	cancel()
+	if err := c.persistQueue(pending); err != nil {
+		c.logger.Error("failed to persist queue", "error", err)
+	}
+
+	s.pool.Stop()
+	c.stopServer(s.srv)
+	s.mu.Lock()
+	if err := s.proc.Close(); err != nil {
+		c.logger.Warn("failed to close processor", "error", err)
+	}
+	s.mu.Unlock()
+
+	stats := s.pool.Stats()
+	c.notifier.Notify(notify.Event{
+		Type: config.NotifyWatchStopped,
+		Data: map[string]interface{}{
+			"processed": stats.ProcessedJobs,
+			"failed":    stats.FailedJobs,
+			"uptime":    time.Since(s.started).Round(time.Second).String(),
+		},
+	})
+}
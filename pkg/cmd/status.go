@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/daemon"
+	"github.com/butter-bot-machines/skylark/pkg/processor/concrete"
+	secconcrete "github.com/butter-bot-machines/skylark/pkg/security/concrete"
+	"github.com/butter-bot-machines/skylark/pkg/security/types"
+	"github.com/butter-bot-machines/skylark/pkg/state"
+)
+
+// Status reports the availability of Skylark's components or, given
+// files, the state of their commands
+func (c *CLI) Status(args []string) error {
+	args, err := parseFlags(newFlagSet("status"), args)
+	if err != nil {
+		return err
+	}
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return c.fileStatus(os.Stdout, args)
+	}
+
+	components := c.componentStatuses()
+
+	// Report the background daemon, if one is running
+	status, err := daemon.Call(c.socketPath(), daemon.CommandStatus)
+	if err != nil && !errors.Is(err, daemon.ErrNotRunning) {
+		return fmt.Errorf("failed to query daemon: %w", err)
+	}
+	if c.json {
+		return printJSON(os.Stdout, statusReport{Components: components, Daemon: status})
+	}
+
+	printStatus(os.Stdout, components)
+	if status != nil {
+		printDaemonStatus(os.Stdout, status)
+	} else {
+		fmt.Println("Daemon: not running")
+	}
+	return nil
+}
+
+// statusReport is what status prints with --json
+type statusReport struct {
+	Components []types.ComponentStatus `json:"components"`
+	Daemon     *daemon.Status          `json:"daemon"` // Null when not running
+}
+
+// componentStatuses probes components that support degraded operation
+func (c *CLI) componentStatuses() []types.ComponentStatus {
+	cfg := c.config.GetConfig()
+
+	auditLog, auditStatus, _ := secconcrete.OpenAuditLogger(cfg)
+	if auditLog != nil {
+		auditLog.Close()
+	}
+
+	// Processing goes on without the command state, which only remembers
+	// what was already answered
+	stateStatus := types.ComponentStatus{Name: "state", State: types.StateOK}
+	if err := state.Check(cfg.Environment.ConfigDir); err != nil {
+		stateStatus.State = types.StateDegraded
+		stateStatus.Reason = err.Error()
+	}
+
+	return []types.ComponentStatus{auditStatus, stateStatus}
+}
+
+// openAuditLog opens the audit log according to its failure policy
+func (c *CLI) openAuditLog() error {
+	auditLog, status, err := secconcrete.OpenAuditLogger(c.config.GetConfig())
+	if err != nil {
+		return fmt.Errorf("audit log unavailable and policy is %s: %w", status.Policy, err)
+	}
+	if status.Degraded() {
+		c.logger.Warn("running in degraded mode",
+			"component", status.Name,
+			"reason", status.Reason)
+		fmt.Fprintf(os.Stderr, "WARNING: %s is degraded: %s\n", status.Name, status.Reason)
+	}
+
+	c.auditLog = auditLog
+	return nil
+}
+
+// closeAuditLog closes the audit log if one is open
+func (c *CLI) closeAuditLog() {
+	if c.auditLog != nil {
+		c.auditLog.Close()
+		c.auditLog = nil
+	}
+}
+
+// printStatus writes a status report, calling out degraded components
+func printStatus(w io.Writer, statuses []types.ComponentStatus) {
+	var degraded []types.ComponentStatus
+
+	fmt.Fprintln(w, "Skylark status")
+	for _, s := range statuses {
+		line := fmt.Sprintf("  %-12s %s", s.Name+":", strings.ToUpper(string(s.State)))
+		if s.Policy != "" && s.State != types.StateDisabled {
+			line += fmt.Sprintf(" (on failure: %s)", s.Policy)
+		}
+		fmt.Fprintln(w, line)
+		if s.Degraded() {
+			degraded = append(degraded, s)
+		}
+	}
+
+	if len(degraded) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "!! DEGRADED MODE !!")
+	for _, s := range degraded {
+		if s.Policy == types.PolicyFailClosed {
+			fmt.Fprintf(w, "  %s is unavailable and fail-closed; processing will not start: %s\n", s.Name, s.Reason)
+		} else {
+			fmt.Fprintf(w, "  %s is unavailable; continuing without it: %s\n", s.Name, s.Reason)
+		}
+	}
+}
+
+// fileStatus prints the pending and processed commands of files
+func (c *CLI) fileStatus(w io.Writer, files []string) error {
+	cfg := c.config.GetConfig()
+	store, err := state.Open(cfg.Environment.ConfigDir)
+	if err != nil {
+		return err
+	}
+	parser := concrete.NewParser(cfg)
+
+	for i, file := range files {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(abs)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		commands, err := parser.ParseCommands(string(content))
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+		originals := make([]string, len(commands))
+		for i, cmd := range commands {
+			originals[i] = cmd.Original
+		}
+
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		printFileStatus(w, file, originals, state.Locate(string(content), originals), store.Records(abs))
+	}
+	return nil
+}
+
+// printFileStatus prints the active commands of a file as pending, with
+// their last attempt, followed by the commands processed earlier
+func printFileStatus(w io.Writer, file string, commands []string, instances []state.Instance, records []state.Record) {
+	byKey := make(map[string]state.Record, len(records))
+	for _, r := range records {
+		byKey[r.Key] = r
+	}
+	active := make(map[string]bool, len(instances))
+
+	fmt.Fprintln(w, file)
+	fmt.Fprintf(w, "  Pending: %d\n", len(commands))
+	for i, original := range commands {
+		active[instances[i].Key] = true
+		line := fmt.Sprintf("    %4d  %s", instances[i].Line, original)
+		if r, ok := byKey[instances[i].Key]; ok {
+			switch r.Outcome {
+			case state.OutcomeFailed:
+				line += fmt.Sprintf("  (failed %s: %s)", r.ProcessedAt.Format(time.DateTime), r.Error)
+			case state.OutcomeAnswered:
+				line += fmt.Sprintf("  (answered %s, response not written yet)", r.ProcessedAt.Format(time.DateTime))
+			case state.OutcomePending:
+				line += fmt.Sprintf("  (answered %s, awaiting review)", r.ProcessedAt.Format(time.DateTime))
+			}
+		}
+		fmt.Fprintln(w, line)
+	}
+
+	var processed []state.Record
+	for _, r := range records {
+		if r.Outcome == state.OutcomeProcessed && !active[r.Key] {
+			processed = append(processed, r)
+		}
+	}
+	fmt.Fprintf(w, "  Processed: %d\n", len(processed))
+	for _, r := range processed {
+		by := r.Assistant
+		if r.Model != "" {
+			by += "/" + r.Model
+		}
+		fmt.Fprintf(w, "    %4d  %s  (%s, %d tokens, %s)\n",
+			r.Line, r.Command, by, r.Tokens.TotalTokens, r.ProcessedAt.Format(time.DateTime))
+	}
+}
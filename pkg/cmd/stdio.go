@@ -0,0 +1,18 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+	slogging "github.com/butter-bot-machines/skylark/pkg/logging/slog"
+)
+
+// reserveStdout hands stdout to a protocol spoken over stdio. Anything else
+// that would write there, such as logs and tool diagnostics, goes to
+// stderr until restore is called.
+func (c *CLI) reserveStdout() (protocolOut *os.File, restore func()) {
+	protocolOut = os.Stdout
+	os.Stdout = os.Stderr
+	c.logger = slogging.NewLogger(logging.LevelInfo, os.Stderr)
+	return protocolOut, func() { os.Stdout = protocolOut }
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/butter-bot-machines/skylark/pkg/template"
+)
+
+// Template lists and creates command templates
+func (c *CLI) Template(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("expected 'list' or 'new' subcommands")
+	}
+
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+	dir := filepath.Join(c.config.GetConfig().Environment.ConfigDir, template.Dir)
+
+	switch args[0] {
+	case "list":
+		templates, err := template.Load(dir)
+		if err != nil {
+			return err
+		}
+		printTemplates(os.Stdout, templates.List())
+		return nil
+	case "new":
+		if len(args) < 2 {
+			return fmt.Errorf("new requires a template name")
+		}
+		path, err := template.Create(dir, args[1])
+		if err != nil {
+			return err
+		}
+		c.infof("Created template %s\n", path)
+		return nil
+	default:
+		return fmt.Errorf("unknown template command: %s", args[0])
+	}
+}
+
+// printTemplates writes a table of templates
+func printTemplates(w io.Writer, templates []*template.Template) {
+	if len(templates) == 0 {
+		fmt.Fprintln(w, "No templates")
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tASSISTANT\tDESCRIPTION")
+	for _, t := range templates {
+		assistant := t.Assistant
+		if assistant == "" {
+			assistant = "default"
+		}
+		fmt.Fprintf(tw, "!%s\t%s\t%s\n", t.Name, assistant, t.Description)
+	}
+	tw.Flush()
+}
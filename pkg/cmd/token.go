@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/access"
+	skerrors "github.com/butter-bot-machines/skylark/pkg/errors"
+)
+
+// tokenFile is the name of the API token store inside the .skai directory
+const tokenFile = "tokens.json"
+
+// tokenInfo is a token as printed by skai token with --json
+type tokenInfo struct {
+	ID      string     `json:"id"`
+	Name    string     `json:"name"`
+	Scopes  []string   `json:"scopes"`
+	Created *time.Time `json:"created,omitempty"`
+	Config  bool       `json:"config,omitempty"` // Set in config.yaml
+	Secret  string     `json:"secret,omitempty"` // Only when created
+}
+
+// tokenStore returns the API tokens created with skai token create,
+// together with those of server.api.tokens, which grant every scope
+// unless they list some
+func (c *CLI) tokenStore() *access.Store {
+	cfg := c.config.GetConfig()
+	fixed := make([]access.Token, 0, len(cfg.Server.API.Tokens))
+	for _, t := range cfg.Server.API.Tokens {
+		scopes, _ := access.ParseScopes(t.Scopes) // Checked when the configuration was loaded
+		if len(scopes) == 0 {
+			scopes = access.Scopes
+		}
+		fixed = append(fixed, access.Fixed(t.Name, t.Token, scopes))
+	}
+	return access.NewStore(filepath.Join(cfg.Environment.ConfigDir, tokenFile), fixed)
+}
+
+// Token creates, lists and revokes the bearer tokens of the server API
+func (c *CLI) Token(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("expected 'create', 'list' or 'revoke' subcommand")
+	}
+
+	switch args[0] {
+	case "create":
+		name, scopes, err := parseTokenCreateArgs(args[1:])
+		if err != nil {
+			return err
+		}
+		if err := c.loadConfig(); err != nil {
+			return err
+		}
+		t, secret, err := c.tokenStore().Create(name, scopes)
+		if err != nil {
+			return err
+		}
+		if c.json {
+			info := newTokenInfo(t)
+			info.Secret = secret
+			return printJSON(os.Stdout, info)
+		}
+		c.infof("Created token %s (%s) with scopes %s. Copy it now; it cannot be shown again:\n", t.Name, t.ID, t.ScopeList())
+		fmt.Println(secret)
+		return nil
+	case "list":
+		if err := noArguments(args[1:]); err != nil {
+			return err
+		}
+		if err := c.loadConfig(); err != nil {
+			return err
+		}
+		tokens, err := c.tokenStore().List()
+		if err != nil {
+			return err
+		}
+		if c.json {
+			infos := make([]tokenInfo, len(tokens))
+			for i, t := range tokens {
+				infos[i] = newTokenInfo(t)
+			}
+			return printJSON(os.Stdout, infos)
+		}
+		printTokens(os.Stdout, tokens)
+		return nil
+	case "revoke":
+		if len(args) != 2 {
+			return skerrors.Typed(fmt.Errorf("expected 'token revoke <name|id>'"), ExitUsage)
+		}
+		if err := c.loadConfig(); err != nil {
+			return err
+		}
+		t, err := c.tokenStore().Revoke(args[1])
+		if err != nil {
+			return err
+		}
+		c.infof("Revoked token %s (%s)\n", t.Name, t.ID)
+		return nil
+	default:
+		return fmt.Errorf("unknown token command: %s", args[0])
+	}
+}
+
+// parseTokenCreateArgs parses `create <name> --scopes <scope,...>`
+func parseTokenCreateArgs(args []string) (string, []access.Scope, error) {
+	var list string
+	fs := newFlagSet("token create")
+	fs.StringVar(&list, "scopes", "", "comma-separated `scopes` granted: read-status, submit-commands, admin-config")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(args) != 1 || list == "" {
+		return "", nil, skerrors.Typed(fmt.Errorf("expected 'token create <name> --scopes <scope,...>'"), ExitUsage)
+	}
+	scopes, err := access.ParseScopes(strings.Split(list, ","))
+	if err != nil {
+		return "", nil, skerrors.Typed(fmt.Errorf("invalid --scopes: %w", err), ExitUsage)
+	}
+	return args[0], scopes, nil
+}
+
+// newTokenInfo returns t without its hash
+func newTokenInfo(t access.Token) tokenInfo {
+	info := tokenInfo{ID: t.ID, Name: t.Name, Config: t.Config}
+	for _, s := range t.Scopes {
+		info.Scopes = append(info.Scopes, string(s))
+	}
+	if !t.Created.IsZero() {
+		created := t.Created
+		info.Created = &created
+	}
+	return info
+}
+
+// printTokens writes a table of tokens
+func printTokens(w io.Writer, tokens []access.Token) {
+	if len(tokens) == 0 {
+		fmt.Fprintln(w, "No tokens")
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tSCOPES\tCREATED")
+	for _, t := range tokens {
+		created := "config.yaml"
+		if !t.Config {
+			created = t.Created.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", t.ID, t.Name, t.ScopeList(), created)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/access"
+)
+
+func TestParseTokenCreateArgs(t *testing.T) {
+	tests := []struct {
+		args       []string
+		wantName   string
+		wantScopes string
+		wantErr    string
+	}{
+		{[]string{"ci", "--scopes", "submit-commands,read-status"}, "ci", "read-status,submit-commands", ""},
+		{[]string{"--scopes=admin-config", "ops"}, "ops", "admin-config", ""},
+		{[]string{"ci"}, "", "", "expected 'token create <name> --scopes"},
+		{[]string{"--scopes", "read-status"}, "", "", "expected 'token create <name> --scopes"},
+		{[]string{"ci", "--scopes", "write-files"}, "", "", `invalid --scopes: unknown scope "write-files"`},
+	}
+	for _, tt := range tests {
+		name, scopes, err := parseTokenCreateArgs(tt.args)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%v: expected error %q, got %v", tt.args, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", tt.args, err)
+			continue
+		}
+		if got := (access.Token{Scopes: scopes}).ScopeList(); name != tt.wantName || got != tt.wantScopes {
+			t.Errorf("%v: expected %s with %s, got %s with %s", tt.args, tt.wantName, tt.wantScopes, name, got)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/butter-bot-machines/skylark/pkg/tool"
+)
+
+// Tool installs and updates the tools of the project
+func (c *CLI) Tool(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("expected 'install' or 'update' subcommands")
+	}
+
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+	dir := c.config.GetConfig().Environment.ConfigDir
+	installer := &tool.Installer{
+		ToolsDir: filepath.Join(dir, "tools"),
+		LockPath: filepath.Join(dir, tool.LockFile),
+	}
+
+	switch args[0] {
+	case "install":
+		spec, name, force, err := parseToolInstallArgs(args[1:])
+		if err != nil {
+			return err
+		}
+		name, entry, err := installer.Install(spec, name, force)
+		if err != nil {
+			return err
+		}
+		c.infof("Installed tool %s %s\n", name, describeLockEntry(entry))
+		return nil
+	case "update":
+		before, after, err := installer.Update(args[1:])
+		printToolUpdates(os.Stdout, before, after)
+		return err
+	default:
+		return fmt.Errorf("unknown tool command: %s", args[0])
+	}
+}
+
+// parseToolInstallArgs parses `install <git-url|path>[@<version>] [--name <name>] [--force]`
+func parseToolInstallArgs(args []string) (spec, name string, force bool, err error) {
+	fs := newFlagSet("tool install")
+	fs.BoolVar(&force, "force", false, "replace an installed tool of the same name")
+	fs.StringVar(&name, "name", "", "install under this name")
+	args, err = parseFlags(fs, args)
+	if err != nil {
+		return "", "", false, err
+	}
+	if len(args) > 0 {
+		spec = args[0]
+		if err := noArguments(args[1:]); err != nil {
+			return "", "", false, err
+		}
+	}
+	if spec == "" {
+		return "", "", false, fmt.Errorf("expected 'tool install <git-url|path>[@<version>] [--name <name>] [--force]'")
+	}
+	return spec, name, force, nil
+}
+
+// describeLockEntry describes where an installed tool came from
+func describeLockEntry(e tool.LockEntry) string {
+	desc := "from " + e.Source
+	if e.Version != "" {
+		desc += "@" + e.Version
+	}
+	if e.Commit != "" {
+		desc += fmt.Sprintf(" (%.12s)", e.Commit)
+	}
+	return desc
+}
+
+// printToolUpdates reports the tools updated, and those left unchanged
+func printToolUpdates(w io.Writer, before, after map[string]tool.LockEntry) {
+	names := make([]string, 0, len(after))
+	for name := range after {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		old, updated := before[name], after[name]
+		if old.Hash == updated.Hash && old.Commit == updated.Commit {
+			fmt.Fprintf(w, "%s is up to date %s\n", name, describeLockEntry(updated))
+			continue
+		}
+		fmt.Fprintf(w, "Updated %s %s\n", name, describeLockEntry(updated))
+	}
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/tracing"
+	"github.com/butter-bot-machines/skylark/pkg/tracing/otlp"
+)
+
+// tracingFlushTimeout bounds how long buffered spans may take to export on exit
+const tracingFlushTimeout = 5 * time.Second
+
+// startTracing installs an OTLP tracer when tracing is enabled in config.
+// The returned function flushes buffered spans and uninstalls the tracer.
+func (c *CLI) startTracing() (func(), error) {
+	cfg := c.config.GetConfig().Tracing
+	if !cfg.Enabled {
+		return func() {}, nil
+	}
+
+	tracer, err := otlp.NewTracer(otlp.Config{
+		Endpoint:    cfg.Endpoint,
+		ServiceName: cfg.ServiceName,
+		Headers:     cfg.Headers,
+		SampleRatio: cfg.SampleRatio,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tracer: %w", err)
+	}
+	tracing.SetTracer(tracer)
+	c.logger.Info("tracing enabled", "endpoint", cfg.Endpoint)
+
+	return func() {
+		tracing.SetTracer(nil)
+		ctx, cancel := context.WithTimeout(context.Background(), tracingFlushTimeout)
+		defer cancel()
+		if err := tracer.Shutdown(ctx); err != nil {
+			c.logger.Warn("failed to flush traces", "error", err)
+		}
+	}, nil
+}
@@ -0,0 +1,332 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/butter-bot-machines/skylark/pkg/assistant"
+	"github.com/butter-bot-machines/skylark/pkg/batch"
+	"github.com/butter-bot-machines/skylark/pkg/diff"
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+	"github.com/butter-bot-machines/skylark/pkg/processor/concrete"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+)
+
+// currentVersion names the prompt.md an assistant has now
+const currentVersion = "current"
+
+// compareWidth is the width of each column of a side-by-side comparison
+const compareWidth = 40
+
+// assistantsDir returns the directory of the project's assistants
+func (c *CLI) assistantsDir() string {
+	return filepath.Join(c.config.GetConfig().Environment.ConfigDir, "assistants")
+}
+
+// promptVersion returns the prompt.md of an assistant as of version, which
+// is v<number> or current
+func promptVersion(dir, name, version string) ([]byte, error) {
+	if version == currentVersion {
+		data, err := os.ReadFile(filepath.Join(dir, name, "prompt.md"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read prompt.md: %w", err)
+		}
+		return data, nil
+	}
+	n, err := assistant.ParseVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	return assistant.ReadVersion(dir, name, n)
+}
+
+// versionedAssistant returns the name commands use for an assistant as of
+// version
+func versionedAssistant(name, version string) (string, error) {
+	if version == currentVersion {
+		return name, nil
+	}
+	n, err := assistant.ParseVersion(version)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s@v%d", name, n), nil
+}
+
+// assistantVersions lists the saved versions of an assistant's prompt.md
+func (c *CLI) assistantVersions(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected 'assistant versions <name>'")
+	}
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+	versions, err := assistant.Versions(c.assistantsDir(), args[0])
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		fmt.Printf("No saved versions of %s\n", args[0])
+		return nil
+	}
+	for _, v := range versions {
+		fmt.Printf("%-6s %s\n", v, v.Created.Format("2006-01-02 15:04:05"))
+	}
+	return nil
+}
+
+// assistantDiff prints the changes between two versions of an assistant's
+// prompt.md as a unified diff. The second version defaults to current.
+func (c *CLI) assistantDiff(args []string) error {
+	if len(args) < 2 || len(args) > 3 {
+		return fmt.Errorf("expected 'assistant diff <name> <version> [<version>]'")
+	}
+	name, from, to := args[0], args[1], currentVersion
+	if len(args) == 3 {
+		to = args[2]
+	}
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+	before, err := promptVersion(c.assistantsDir(), name, from)
+	if err != nil {
+		return err
+	}
+	after, err := promptVersion(c.assistantsDir(), name, to)
+	if err != nil {
+		return err
+	}
+	fmt.Print(diff.Unified(name+"@"+from, name+"@"+to, string(before), string(after)))
+	return nil
+}
+
+// compareOptions holds the parsed arguments of assistant compare
+type compareOptions struct {
+	name   string
+	a, b   string
+	files  []string
+	output string
+}
+
+// parseCompareArgs parses `compare <name> <version> <version> [<file>...] [--output text|json]`
+func parseCompareArgs(args []string) (*compareOptions, error) {
+	opts := &compareOptions{output: outputText}
+	fs := newFlagSet("assistant compare")
+	fs.StringVar(&opts.output, "output", outputText, "text or json")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(positional) < 3 {
+		return nil, fmt.Errorf("expected 'assistant compare <name> <version> <version> [<file>...]'")
+	}
+	opts.name, opts.a, opts.b, opts.files = positional[0], positional[1], positional[2], positional[3:]
+	for _, version := range []string{opts.a, opts.b} {
+		if _, err := versionedAssistant(opts.name, version); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateOutput(opts.output); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// comparison is a command run with two versions of its assistant
+type comparison struct {
+	A batch.CommandResult `json:"a"`
+	B batch.CommandResult `json:"b"`
+}
+
+// compareReport is the result of an A/B run
+type compareReport struct {
+	Assistant string       `json:"assistant"`
+	A         string       `json:"a"`
+	B         string       `json:"b"`
+	Commands  []comparison `json:"commands"`
+}
+
+// assistantCompare runs the assistant's commands in the given files, or
+// the project, with two versions of its prompt.md and prints the
+// responses side by side. Files are not changed.
+func (c *CLI) assistantCompare(args []string) error {
+	opts, err := parseCompareArgs(args)
+	if err != nil {
+		return err
+	}
+	opts.output = c.outputFormat(opts.output)
+
+	out, restore := c.reserveStdout()
+	defer restore()
+
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+	teardown, err := c.setupRuntime()
+	if err != nil {
+		return err
+	}
+	defer teardown()
+
+	files := opts.files
+	if len(files) == 0 {
+		if files, err = c.projectFiles(); err != nil {
+			return err
+		}
+	}
+
+	cfg := c.config.GetConfig()
+	proc, err := c.newProcessor(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create processor: %w", err)
+	}
+	defer proc.Close()
+	p := concrete.NewParser(cfg)
+	a, _ := versionedAssistant(opts.name, opts.a)
+	b, _ := versionedAssistant(opts.name, opts.b)
+
+	report := compareReport{Assistant: opts.name, A: opts.a, B: opts.b, Commands: []comparison{}}
+	for _, file := range files {
+		data, err := readDocument(proc, file)
+		if err != nil {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+		commands, err := p.ParseCommands(string(data))
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		for _, cmd := range commands {
+			if cmd.Assistant != opts.name {
+				continue
+			}
+			report.Commands = append(report.Commands, comparison{
+				A: c.runVersion(proc, p, cmd.Original, a, file, string(data)),
+				B: c.runVersion(proc, p, cmd.Original, b, file, string(data)),
+			})
+		}
+	}
+	c.logger.Info("compared assistant versions",
+		"assistant", opts.name,
+		"a", opts.a,
+		"b", opts.b,
+		"commands", len(report.Commands))
+
+	if opts.output == outputJSON {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode report: %w", err)
+		}
+		fmt.Fprintln(out, string(data))
+		return nil
+	}
+	printComparison(out, &report)
+	return nil
+}
+
+// runVersion runs the command line original of file with the assistant
+// named as
+func (c *CLI) runVersion(proc processor.ProcessManager, p *parser.Parser, original, as, file, content string) batch.CommandResult {
+	result := batch.CommandResult{File: file, Assistant: as, Command: original, Status: batch.StatusOK}
+	cmd, err := p.ParseCommand(original)
+	if err != nil {
+		result.Status, result.Error = batch.StatusFailed, err.Error()
+		return result
+	}
+	cmd.Assistant = as
+	ctx := context.Background()
+	if r, ok := proc.(processor.ReferenceResolver); ok {
+		r.AttachReferences(ctx, cmd, file, content)
+	}
+
+	meter := &provider.UsageMeter{}
+	start := time.Now()
+	response, err := c.processCommand(provider.ContextWithUsageMeter(ctx, meter), proc, cmd)
+	result.DurationMS = time.Since(start).Milliseconds()
+	result.Tokens = meter.Usage()
+	result.Response = response
+	if err != nil {
+		result.Status, result.Error = batch.StatusFailed, err.Error()
+	}
+	return result
+}
+
+// printComparison prints each command with the responses of both versions
+// in columns
+func printComparison(w io.Writer, report *compareReport) {
+	if len(report.Commands) == 0 {
+		fmt.Fprintf(w, "No commands for %s\n", report.Assistant)
+		return
+	}
+	rule := strings.Repeat("-", compareWidth)
+	for i, cmp := range report.Commands {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s  %s\n", cmp.A.File, cmp.A.Command)
+		fmt.Fprint(w, sideBySide(report.A, report.B))
+		fmt.Fprintf(w, "%s-+-%s\n", rule, rule)
+		fmt.Fprint(w, sideBySide(comparedText(cmp.A), comparedText(cmp.B)))
+		fmt.Fprint(w, sideBySide(comparedStats(cmp.A), comparedStats(cmp.B)))
+	}
+}
+
+// comparedText returns the response of a result, or its error
+func comparedText(r batch.CommandResult) string {
+	if r.Error != "" {
+		return "error: " + r.Error
+	}
+	return r.Response
+}
+
+// comparedStats summarizes the cost of a result
+func comparedStats(r batch.CommandResult) string {
+	return fmt.Sprintf("[%d tokens, %dms]", r.Tokens.TotalTokens, r.DurationMS)
+}
+
+// sideBySide lays out left and right in two columns of compareWidth,
+// wrapping longer lines
+func sideBySide(left, right string) string {
+	l, r := wrap(left, compareWidth), wrap(right, compareWidth)
+	var b strings.Builder
+	for i := 0; i < len(l) || i < len(r); i++ {
+		var a, c string
+		if i < len(l) {
+			a = l[i]
+		}
+		if i < len(r) {
+			c = r[i]
+		}
+		fmt.Fprintf(&b, "%s%s | %s\n", a, strings.Repeat(" ", compareWidth-utf8.RuneCountInString(a)), c)
+	}
+	return b.String()
+}
+
+// wrap splits text into lines of at most width runes
+func wrap(text string, width int) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		line = strings.ReplaceAll(line, "\t", "    ")
+		runes := []rune(line)
+		for len(runes) > width {
+			cut := width
+			for i := width; i > width/2; i-- {
+				if runes[i] == ' ' {
+					cut = i
+					break
+				}
+			}
+			lines = append(lines, strings.TrimRight(string(runes[:cut]), " "))
+			runes = []rune(strings.TrimLeft(string(runes[cut:]), " "))
+		}
+		lines = append(lines, string(runes))
+	}
+	return lines
+}
@@ -0,0 +1,13 @@
+package cmd
+
+import "testing"
+
+func TestSideBySide(t *testing.T) {
+	left := "short"
+	right := "a longer response that does not fit in one column of forty"
+	expected := "short                                    | a longer response that does not fit in\n" +
+		"                                         | one column of forty\n"
+	if got := sideBySide(left, right); got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
@@ -2,22 +2,50 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"text/template"
 	"time"
 
+	"github.com/butter-bot-machines/skylark/pkg/access"
 	"github.com/butter-bot-machines/skylark/pkg/security/types"
 	"gopkg.in/yaml.v3"
 )
 
+// Models keys of providers other than OpenAI
+const (
+	AzureOpenAI      = "azure-openai"      // Azure OpenAI deployments
+	OpenAICompatible = "openai-compatible" // Servers implementing the OpenAI API
+)
+
 // Config represents the application configuration
 type Config struct {
-	Version     string                    `yaml:"version"`
-	Environment EnvironmentConfig         `yaml:"environment"`
-	Models      map[string]ModelConfigSet `yaml:"models"`
-	Tools       map[string]ToolConfig     `yaml:"tools"`
-	Workers     WorkerConfig              `yaml:"workers"`
-	FileWatch   FileWatchConfig           `yaml:"file_watch"`
-	WatchPaths  []string                  `yaml:"watch_paths"`
-	Security    types.SecurityConfig      `yaml:"security"`
+	Version       string                     `yaml:"version"`
+	Environment   EnvironmentConfig          `yaml:"environment"`
+	Logging       LoggingConfig              `yaml:"logging"`
+	Models        map[string]ModelConfigSet  `yaml:"models"`
+	Tools         map[string]ToolConfig      `yaml:"tools"`
+	Assistants    map[string]AssistantConfig `yaml:"assistants"`
+	Workers       WorkerConfig               `yaml:"workers"`
+	FileWatch     FileWatchConfig            `yaml:"file_watch"`
+	WatchPaths    []string                   `yaml:"watch_paths"`
+	References    ReferencesConfig           `yaml:"references"`
+	Documents     DocumentsConfig            `yaml:"documents"`
+	Security      types.SecurityConfig       `yaml:"security"`
+	Tracing       TracingConfig              `yaml:"tracing"`
+	Server        ServerConfig               `yaml:"server"`
+	Filters       []FilterConfig             `yaml:"filters"` // Run on every response, after the assistant's own filters
+	Providers     ProvidersConfig            `yaml:"providers"`
+	Budget        BudgetConfig               `yaml:"budget"`
+	Output        OutputConfig               `yaml:"output"`
+	Processing    ProcessingConfig           `yaml:"processing"`
+	Plugins       []PluginConfig             `yaml:"plugins"` // Started with the processor
+	Notifications []NotificationConfig       `yaml:"notifications"`
+	Routing       map[string]RoutingPolicy   `yaml:"routing"`        // By policy name, used by assistants with model: route:<name>
+	ModelMetadata map[string]ModelMetadata   `yaml:"model_metadata"` // By model name prefix, overriding the built-in capabilities and prices
+	Update        UpdateConfig               `yaml:"update"`
 }
 
 // EnvironmentConfig defines environment-specific settings
@@ -27,6 +55,15 @@ type EnvironmentConfig struct {
 	ConfigDir string `yaml:"-"` // Set at runtime
 }
 
+// LoggingConfig defines log output settings. Rotation applies to
+// environment.log_file.
+type LoggingConfig struct {
+	Format     string        `yaml:"format"`      // json (default) or text
+	MaxSize    int           `yaml:"max_size"`    // Megabytes written before the log file is rotated (0 = never)
+	MaxAge     time.Duration `yaml:"max_age"`     // Rotated log files older than this are removed (0 = keep)
+	MaxBackups int           `yaml:"max_backups"` // Rotated log files kept (0 = all)
+}
+
 // ModelConfigSet groups model configurations by provider
 type ModelConfigSet map[string]ModelConfig
 
@@ -36,17 +73,110 @@ type ModelConfig struct {
 	Temperature float64 `yaml:"temperature"`
 	MaxTokens   int     `yaml:"max_tokens"`
 	TopP        float64 `yaml:"top_p"`
+	MaxAttempts int     `yaml:"max_attempts,omitempty"` // Tries per request on rate limits and server errors (0 = 3, 1 = no retries)
+
+	// ContextWindow is the number of tokens the model accepts, prompt and
+	// response together. Zero uses the built-in table of OpenAI models;
+	// prompts to other models are not checked.
+	ContextWindow int `yaml:"context_window,omitempty"`
+
+	// Azure OpenAI deployments, under models.azure-openai, also name
+	// their resource and authenticate with an API key or an Azure AD app
+	Endpoint   string         `yaml:"endpoint,omitempty"`    // Resource URL, e.g. https://example.openai.azure.com
+	APIVersion string         `yaml:"api_version,omitempty"` // REST API version (empty = provider default)
+	AzureAD    *AzureADConfig `yaml:"azure_ad,omitempty"`    // App credentials used instead of the API key
+
+	// OpenAI-compatible servers, under models.openai-compatible, name the
+	// base URL their /chat/completions endpoint is under. OpenAI models may
+	// set one to go through a gateway instead of api.openai.com.
+	BaseURL string `yaml:"base_url,omitempty"` // e.g. http://localhost:8000/v1
+
+	// OpenAI accounts in several organizations or projects name the one
+	// requests are billed to
+	Organization string `yaml:"organization,omitempty"` // Sent as OpenAI-Organization
+	Project      string `yaml:"project,omitempty"`      // Sent as OpenAI-Project
+
+	// Proxy routes requests through an HTTP(S) proxy, e.g.
+	// http://proxy.example.com:8080. Without one the HTTP_PROXY,
+	// HTTPS_PROXY and NO_PROXY environment variables apply.
+	Proxy string `yaml:"proxy,omitempty"`
+
+	// Prices per million tokens, counted against budget.max_cost_per_day
+	PromptCost     float64 `yaml:"prompt_cost,omitempty"`
+	CompletionCost float64 `yaml:"completion_cost,omitempty"`
+}
+
+// ModelMetadata overrides the built-in capabilities and prices of the
+// models whose names start with its key. Unset fields keep the built-in
+// values of the key, if any.
+type ModelMetadata struct {
+	ContextWindow   int      `yaml:"context_window,omitempty"`          // Tokens accepted, prompt and response together
+	SupportsTools   *bool    `yaml:"supports_tools,omitempty"`          // Accepts tool definitions
+	SupportsVision  *bool    `yaml:"supports_vision,omitempty"`         // Accepts images
+	PromptPer1K     *float64 `yaml:"prompt_price_per_1k,omitempty"`     // Price of 1,000 prompt tokens
+	CompletionPer1K *float64 `yaml:"completion_price_per_1k,omitempty"` // Price of 1,000 completion tokens
+}
+
+// AzureADConfig names the Azure AD (Entra ID) app whose tokens
+// authenticate Azure OpenAI requests
+type AzureADConfig struct {
+	TenantID     string `yaml:"tenant_id"`
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
 }
 
 // ToolConfig defines tool-specific settings
 type ToolConfig struct {
-	Env map[string]string `yaml:"env"`
+	Env           map[string]string `yaml:"env"`
+	MaxConcurrent int               `yaml:"max_concurrent"`      // Maximum calls of this tool running at once (0 = unlimited)
+	GoFlags       string            `yaml:"goflags,omitempty"`   // GOFLAGS when compiling the tool, such as -tags=netgo
+	BuildEnv      map[string]string `yaml:"build_env,omitempty"` // Extra environment when compiling the tool, such as CGO_ENABLED
+	Limits        ToolLimits        `yaml:"limits,omitempty"`
+}
+
+// ToolLimits caps how often a tool is called (0 = unlimited)
+type ToolLimits struct {
+	PerCommand int `yaml:"per_command"` // Calls while answering one command
+	PerMinute  int `yaml:"per_minute"`  // Calls in any 60 seconds
+	PerDay     int `yaml:"per_day"`     // Calls in a calendar day, local time
+}
+
+// AssistantConfig defines assistant-specific settings
+type AssistantConfig struct {
+	MaxConcurrent int            `yaml:"max_concurrent"` // Maximum files processed at once for this assistant (0 = unlimited)
+	Filters       []FilterConfig `yaml:"filters"`        // Run on this assistant's responses
+}
+
+// Filter types
+const (
+	FilterStripPreamble = "strip_preamble" // Removes opening pleasantries, apologies and closing offers
+	FilterMaxLength     = "max_length"     // Truncates responses longer than max characters
+	FilterHeadings      = "headings"       // Shifts headings so the top one is at level
+	FilterTool          = "tool"           // Pipes the response through a tool
+)
+
+// FilterConfig declares a filter run on responses before they are
+// inserted into documents
+type FilterConfig struct {
+	Type  string `yaml:"type"`
+	Max   int    `yaml:"max,omitempty"`   // max_length: characters kept
+	Level int    `yaml:"level,omitempty"` // headings: level of the top heading, 1-6
+	Tool  string `yaml:"tool,omitempty"`  // tool: name of the tool run on the response
 }
 
 // WorkerConfig defines worker pool settings
 type WorkerConfig struct {
-	Count     int `yaml:"count"`
-	QueueSize int `yaml:"queue_size"`
+	Count         int           `yaml:"count"`
+	QueueSize     int           `yaml:"queue_size"`
+	ShutdownGrace time.Duration `yaml:"shutdown_grace"` // Time in-flight jobs get to finish on shutdown
+	RetryBackoff  time.Duration `yaml:"retry_backoff"`  // Delay before the first retry of a failed job
+	JobTimeout    time.Duration `yaml:"job_timeout"`    // Time each attempt of a job gets to finish, unlimited when zero
+
+	// Autoscaling: workers are added up to Max while more than
+	// ScaleThreshold jobs stay queued, and retired after IdleTimeout
+	Max            int           `yaml:"max"`
+	ScaleThreshold int           `yaml:"scale_threshold"`
+	IdleTimeout    time.Duration `yaml:"idle_timeout"`
 }
 
 // FileWatchConfig defines file watching settings
@@ -54,8 +184,290 @@ type FileWatchConfig struct {
 	DebounceDelay time.Duration `yaml:"debounce_delay"`
 	MaxDelay      time.Duration `yaml:"max_delay"`
 	Extensions    []string      `yaml:"extensions"`
+	Ignore        []string      `yaml:"ignore"`        // .gitignore patterns, applied after .skylarkignore
+	Backend       WatchBackend  `yaml:"backend"`       // How changes are detected, auto when empty
+	PollInterval  time.Duration `yaml:"poll_interval"` // How often the poll backend scans, 1s when zero
+}
+
+// WatchBackend selects how the file watcher detects changes
+type WatchBackend string
+
+const (
+	// WatchAuto uses fsnotify and falls back to polling where it fails
+	WatchAuto WatchBackend = "auto"
+	// WatchFSNotify uses operating system notifications
+	WatchFSNotify WatchBackend = "fsnotify"
+	// WatchPoll scans watched paths periodically, for file systems without
+	// notifications such as NFS, SMB and WSL mounts
+	WatchPoll WatchBackend = "poll"
+)
+
+// Valid reports whether b is a known backend. Empty means auto.
+func (b WatchBackend) Valid() bool {
+	switch b {
+	case "", WatchAuto, WatchFSNotify, WatchPoll:
+		return true
+	}
+	return false
+}
+
+// UpdateConfig defines where skai self-update looks for releases
+type UpdateConfig struct {
+	Channel   UpdateChannel `yaml:"channel"`    // Release channel, stable when empty
+	URL       string        `yaml:"url"`        // Release endpoint serving <channel>.json and its signature (empty = built-in)
+	PublicKey string        `yaml:"public_key"` // Base64 Ed25519 key releases are signed with (empty = built-in)
+}
+
+// UpdateChannel selects which releases self-update installs
+type UpdateChannel string
+
+const (
+	// UpdateStable installs releases only
+	UpdateStable UpdateChannel = "stable"
+	// UpdateBeta installs pre-releases as well
+	UpdateBeta UpdateChannel = "beta"
+)
+
+// Valid reports whether ch is a known channel. Empty means stable.
+func (ch UpdateChannel) Valid() bool {
+	switch ch {
+	case "", UpdateStable, UpdateBeta:
+		return true
+	}
+	return false
+}
+
+// BudgetConfig limits provider spending. Zero limits are not enforced.
+type BudgetConfig struct {
+	MaxTokensPerRun int     `yaml:"max_tokens_per_run"` // Tokens a process may use
+	MaxCostPerDay   float64 `yaml:"max_cost_per_day"`   // Cost, by the models' prices, of a calendar day
+}
+
+// PluginConfig declares an external program that extends Skylark over
+// stdio, as a provider of models addressed <name>:<model>, a processor of
+// responses, or both
+type PluginConfig struct {
+	Name    string            `yaml:"name"`
+	Command string            `yaml:"command"` // Relative to the configuration directory unless absolute
+	Args    []string          `yaml:"args,omitempty"`
+	Env     map[string]string `yaml:"env,omitempty"` // Added to the environment of skai
+}
+
+// Events notifications are sent for
+const (
+	NotifyFileProcessed  = "file_processed"  // A document's commands were answered
+	NotifyCommandFailed  = "command_failed"  // A command could not be answered
+	NotifyBudgetExceeded = "budget_exceeded" // A spending limit was reached
+	NotifyWatchStarted   = "watch_started"
+	NotifyWatchStopped   = "watch_stopped"
+	NotifyDailySummary   = "daily_summary" // Activity of the previous day, sent while watching
+
+	NotifyProviderUnavailable = "provider_unavailable" // A provider's circuit breaker opened
+	NotifyProviderRecovered   = "provider_recovered"   // A provider answered again
+)
+
+// NotifyEvents lists the events notifications can be sent for
+var NotifyEvents = []string{NotifyFileProcessed, NotifyCommandFailed, NotifyBudgetExceeded, NotifyWatchStarted, NotifyWatchStopped, NotifyDailySummary, NotifyProviderUnavailable, NotifyProviderRecovered}
+
+// NotificationFormat is the payload a webhook notification is sent
+type NotificationFormat string
+
+const (
+	NotifyJSON    NotificationFormat = "json"    // The event itself, the default
+	NotifySlack   NotificationFormat = "slack"   // A message for a Slack incoming webhook
+	NotifyDiscord NotificationFormat = "discord" // A message for a Discord webhook
+)
+
+// Valid reports whether f is a known format, empty meaning json
+func (f NotificationFormat) Valid() bool {
+	switch f {
+	case "", NotifyJSON, NotifySlack, NotifyDiscord:
+		return true
+	}
+	return false
+}
+
+// Chat reports whether f is sent as a chat message
+func (f NotificationFormat) Chat() bool {
+	return f == NotifySlack || f == NotifyDiscord
+}
+
+// NotificationConfig sends events to a webhook or a script. Exactly one of
+// URL and Command is set.
+type NotificationConfig struct {
+	URL         string             `yaml:"url,omitempty"`      // POSTed each event
+	Command     string             `yaml:"command,omitempty"`  // Run with each event as JSON on stdin, relative to the configuration directory unless absolute
+	Format      NotificationFormat `yaml:"format,omitempty"`   // Payload posted to URL
+	Template    string             `yaml:"template,omitempty"` // Go template of chat messages, replacing the built-in ones
+	Secret      string             `yaml:"secret,omitempty"`   // Signs webhook bodies with HMAC-SHA256
+	Events      []string           `yaml:"events,omitempty"`   // Events sent (default: all)
+	MaxAttempts int                `yaml:"max_attempts"`       // Deliveries tried per event (0 = 3)
+}
+
+// RoutingPolicy sends each command to a cheap or an expensive model by how
+// complex it looks. A command is complex when any of the set heuristics
+// says so.
+type RoutingPolicy struct {
+	Cheap      string   `yaml:"cheap"`                // Model of simple commands, e.g. gpt-4o-mini
+	Expensive  string   `yaml:"expensive"`            // Model of complex commands, e.g. gpt-4o
+	MaxWords   int      `yaml:"max_words,omitempty"`  // Commands with more words are complex (0 = length does not count)
+	References bool     `yaml:"references,omitempty"` // Commands referencing sections or notes are complex
+	Keywords   []string `yaml:"keywords,omitempty"`   // Commands containing any of these words are complex, ignoring case
+}
+
+// ProvidersConfig defines how model providers are reached
+type ProvidersConfig struct {
+	Mode    ProviderMode  `yaml:"mode"` // live when empty
+	Breaker BreakerConfig `yaml:"breaker"`
+	Offline OfflineConfig `yaml:"offline"`
+}
+
+// BreakerConfig sets when requests to a failing provider are stopped
+type BreakerConfig struct {
+	Threshold int           `yaml:"threshold"` // Consecutive server errors or rate limits that open the circuit, 5 when zero; negative disables it
+	Cooldown  time.Duration `yaml:"cooldown"`  // Time before a request probes the provider again, 30s when zero
+}
+
+// OfflineConfig sets how connectivity to providers is checked and how the
+// commands queued while offline are processed once it returns
+type OfflineConfig struct {
+	CheckInterval time.Duration `yaml:"check_interval"` // Time between connectivity checks, 30s when zero
+	DrainRate     int           `yaml:"drain_rate"`     // Queued files handed to workers per minute once back online, all at once when zero
 }
 
+// ProviderMode selects whether providers are called, recorded or replayed
+type ProviderMode string
+
+const (
+	// ProviderLive calls providers
+	ProviderLive ProviderMode = "live"
+	// ProviderRecord calls providers and records their responses to
+	// cassettes
+	ProviderRecord ProviderMode = "record"
+	// ProviderReplay answers from recorded cassettes without calling
+	// providers, so no API keys are needed
+	ProviderReplay ProviderMode = "replay"
+)
+
+// Valid reports whether m is a known mode. Empty means live.
+func (m ProviderMode) Valid() bool {
+	switch m {
+	case "", ProviderLive, ProviderRecord, ProviderReplay:
+		return true
+	}
+	return false
+}
+
+// DocumentsConfig defines how documents are updated
+type DocumentsConfig struct {
+	Backup bool `yaml:"backup"` // Keep the previous content of an updated document in <name>.bak
+}
+
+// OutputConfig defines how responses are inserted into documents
+type OutputConfig struct {
+	// IncludeMetadata annotates each response with the assistant, model,
+	// time, tokens and duration that produced it
+	IncludeMetadata bool           `yaml:"include_metadata"`
+	MetadataFormat  MetadataFormat `yaml:"metadata_format"` // comment when empty
+
+	// Placeholder writes a placeholder under each command of a document
+	// as soon as its processing starts, invalidating the command, and
+	// replaces it with the response once the command is answered
+	Placeholder bool `yaml:"placeholder"`
+}
+
+// MetadataFormat selects how response metadata is written
+type MetadataFormat string
+
+const (
+	// MetadataComment writes an HTML comment, hidden when rendered
+	MetadataComment MetadataFormat = "comment"
+	// MetadataFooter writes an italic line readers can see
+	MetadataFooter MetadataFormat = "footer"
+)
+
+// Valid reports whether f is a known format. Empty means comment.
+func (f MetadataFormat) Valid() bool {
+	switch f {
+	case "", MetadataComment, MetadataFooter:
+		return true
+	}
+	return false
+}
+
+// ProcessingConfig defines how responses reach documents
+type ProcessingConfig struct {
+	// RequireApproval holds responses for review with 'skai review'
+	// instead of writing them to documents as they arrive
+	RequireApproval bool `yaml:"require_approval"`
+
+	// CommandsInCode runs command lines inside fenced code blocks and
+	// block quotes, which are otherwise taken as examples and left alone
+	CommandsInCode bool `yaml:"commands_in_code"`
+
+	// Parser selects how documents are split into blocks, lines when empty
+	Parser ParserKind `yaml:"parser,omitempty"`
+}
+
+// ParserKind selects how documents are split into blocks
+type ParserKind string
+
+const (
+	// ParserLines reads documents line by line
+	ParserLines ParserKind = "lines"
+	// ParserAST parses documents as CommonMark, so nested lists, setext
+	// headers and HTML blocks are read as Markdown renders them
+	ParserAST ParserKind = "ast"
+)
+
+// Valid reports whether k is a known parser. Empty means lines.
+func (k ParserKind) Valid() bool {
+	switch k {
+	case "", ParserLines, ParserAST:
+		return true
+	}
+	return false
+}
+
+// ReferencesConfig defines the syntax commands use to reference other content
+type ReferencesConfig struct {
+	WikiLinks bool `yaml:"wikilinks"` // Treat [[WikiLinks]] and ![[embeds]] in commands as references to notes
+}
+
+// TracingConfig defines distributed tracing settings
+type TracingConfig struct {
+	Enabled     bool              `yaml:"enabled"`
+	Endpoint    string            `yaml:"endpoint"`     // OTLP/HTTP collector, e.g. http://localhost:4318
+	ServiceName string            `yaml:"service_name"` // Defaults to "skylark"
+	Headers     map[string]string `yaml:"headers"`      // Extra headers sent with each export
+	SampleRatio float64           `yaml:"sample_ratio"` // Fraction of traces recorded (0 = all)
+}
+
+// ServerConfig defines the embedded HTTP status server
+type ServerConfig struct {
+	ListenAddr string    `yaml:"listen_addr"` // host:port to serve /healthz, /status and /config on (empty = disabled)
+	API        APIConfig `yaml:"api"`
+	Dashboard  bool      `yaml:"dashboard"` // Serve the web dashboard at /dashboard/, signed in to with an API token
+}
+
+// APIConfig enables the job API of the server, through which editors and
+// scripts submit commands against project files
+type APIConfig struct {
+	Enabled bool       `yaml:"enabled"`
+	Tokens  []APIToken `yaml:"tokens"`             // Bearer tokens accepted besides those created with skai token create
+	MaxJobs int        `yaml:"max_jobs,omitempty"` // Jobs kept with their results (0 = 100)
+}
+
+// APIToken is a bearer token of the job API
+type APIToken struct {
+	Name   string   `yaml:"name"` // Recorded as the submitter of its jobs
+	Token  string   `yaml:"token"`
+	Scopes []string `yaml:"scopes,omitempty"` // Scopes granted (empty = all)
+}
+
+// minAPITokenLength is the shortest token the job API accepts
+const minAPITokenLength = 16
+
 // ParseConfig parses a configuration from YAML
 func ParseConfig(data []byte) (*Config, error) {
 	config := &Config{}
@@ -101,6 +513,76 @@ func (c *Config) GetToolEnv(name string) map[string]string {
 	return nil
 }
 
+// ToolEnvs returns the configured environment of each tool that has one
+func (c *Config) ToolEnvs() map[string]map[string]string {
+	envs := make(map[string]map[string]string)
+	for name, t := range c.Tools {
+		if len(t.Env) > 0 {
+			envs[name] = t.Env
+		}
+	}
+	return envs
+}
+
+// KeyStorePath returns the path of the encrypted secret store:
+// security.key_storage_path relative to the configuration directory,
+// secrets.enc there by default
+func (c *Config) KeyStorePath() string {
+	path := c.Security.KeyStoragePath
+	if path == "" {
+		path = "secrets.enc"
+	}
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(c.Environment.ConfigDir, path)
+}
+
+// ToolQuotas returns the call limits of each tool that has any
+func (c *Config) ToolQuotas() map[string]ToolLimits {
+	quotas := make(map[string]ToolLimits)
+	for name, t := range c.Tools {
+		if t.Limits != (ToolLimits{}) {
+			quotas[name] = t.Limits
+		}
+	}
+	return quotas
+}
+
+// AssistantConcurrency returns the concurrency limit of each assistant that has one
+func (c *Config) AssistantConcurrency() map[string]int {
+	limits := make(map[string]int)
+	for name, a := range c.Assistants {
+		if a.MaxConcurrent > 0 {
+			limits[strings.ToLower(name)] = a.MaxConcurrent
+		}
+	}
+	return limits
+}
+
+// ToolConcurrency returns the concurrency limit of each tool that has one
+func (c *Config) ToolConcurrency() map[string]int {
+	limits := make(map[string]int)
+	for name, t := range c.Tools {
+		if t.MaxConcurrent > 0 {
+			limits[name] = t.MaxConcurrent
+		}
+	}
+	return limits
+}
+
+// ResponseFilters returns the filters run on the responses of an
+// assistant: its own, followed by the global ones
+func (c *Config) ResponseFilters(assistant string) []FilterConfig {
+	var filters []FilterConfig
+	for name, a := range c.Assistants {
+		if strings.EqualFold(name, assistant) {
+			filters = append(filters, a.Filters...)
+		}
+	}
+	return append(filters, c.Filters...)
+}
+
 // GetSecurityConfig returns the security configuration
 func (c *Config) GetSecurityConfig() types.SecurityConfig {
 	return c.Security
@@ -112,9 +594,244 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("%w: version required", ErrInvalidConfig)
 	}
 
-	// Validate model configurations
+	// Validate failure policies
+	if !c.Security.AuditLog.OnFailure.Valid() {
+		return fmt.Errorf("%w: invalid audit log failure policy %q", ErrInvalidConfig, c.Security.AuditLog.OnFailure)
+	}
+
+	if !c.Security.FilePermissions.AllowSymlinks.Valid() {
+		return fmt.Errorf("%w: invalid allow_symlinks policy %q, expected never, within-allowed or any", ErrInvalidConfig, c.Security.FilePermissions.AllowSymlinks)
+	}
+
+	if c.Security.AuditLog.CheckpointInterval < 0 {
+		return fmt.Errorf("%w: audit log checkpoint_interval must not be negative", ErrInvalidConfig)
+	}
+
+	if !c.Processing.Parser.Valid() {
+		return fmt.Errorf("%w: processing parser must be lines or ast, got %q", ErrInvalidConfig, c.Processing.Parser)
+	}
+
+	// Validate file watching
+	if !c.FileWatch.Backend.Valid() {
+		return fmt.Errorf("%w: file_watch backend must be fsnotify, poll or auto, got %q", ErrInvalidConfig, c.FileWatch.Backend)
+	}
+	if c.FileWatch.PollInterval < 0 {
+		return fmt.Errorf("%w: file_watch poll_interval must not be negative", ErrInvalidConfig)
+	}
+
+	// Validate content filters
+	for _, f := range c.Security.ContentFilters {
+		if f.Name == "" {
+			return fmt.Errorf("%w: content filter name required", ErrInvalidConfig)
+		}
+		if !f.Action.Valid() {
+			return fmt.Errorf("%w: content filter %s: action must be redact or block, got %q", ErrInvalidConfig, f.Name, f.Action)
+		}
+	}
+
+	// Validate logging settings
+	switch c.Logging.Format {
+	case "", "json", "text":
+	default:
+		return fmt.Errorf("%w: logging format must be json or text, got %q", ErrInvalidConfig, c.Logging.Format)
+	}
+	if c.Logging.MaxSize < 0 || c.Logging.MaxAge < 0 || c.Logging.MaxBackups < 0 {
+		return fmt.Errorf("%w: log rotation limits must not be negative", ErrInvalidConfig)
+	}
+
+	// Validate worker settings
+	if c.Workers.ShutdownGrace < 0 {
+		return fmt.Errorf("%w: shutdown grace period must not be negative", ErrInvalidConfig)
+	}
+	if c.Workers.Max != 0 && c.Workers.Max < c.Workers.Count {
+		return fmt.Errorf("%w: workers.max (%d) must not be less than workers.count (%d)", ErrInvalidConfig, c.Workers.Max, c.Workers.Count)
+	}
+	for name, a := range c.Assistants {
+		if a.MaxConcurrent < 0 {
+			return fmt.Errorf("%w: max_concurrent for assistant %s must not be negative", ErrInvalidConfig, name)
+		}
+		for _, f := range a.Filters {
+			if err := validateFilter(f); err != nil {
+				return fmt.Errorf("%w: assistant %s: %v", ErrInvalidConfig, name, err)
+			}
+		}
+	}
+	for name, t := range c.Tools {
+		if t.MaxConcurrent < 0 {
+			return fmt.Errorf("%w: max_concurrent for tool %s must not be negative", ErrInvalidConfig, name)
+		}
+		if t.Limits.PerCommand < 0 || t.Limits.PerMinute < 0 || t.Limits.PerDay < 0 {
+			return fmt.Errorf("%w: limits for tool %s must not be negative", ErrInvalidConfig, name)
+		}
+	}
+	for _, f := range c.Filters {
+		if err := validateFilter(f); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+		}
+	}
+	if c.Workers.RetryBackoff < 0 {
+		return fmt.Errorf("%w: retry backoff must not be negative", ErrInvalidConfig)
+	}
+	if c.Workers.JobTimeout < 0 {
+		return fmt.Errorf("%w: job timeout must not be negative", ErrInvalidConfig)
+	}
+
+	// Validate server settings
+	if c.Server.ListenAddr != "" {
+		if _, _, err := net.SplitHostPort(c.Server.ListenAddr); err != nil {
+			return fmt.Errorf("%w: invalid server listen_addr %q: %v", ErrInvalidConfig, c.Server.ListenAddr, err)
+		}
+	}
+	if err := c.Server.API.validate(c.Server.ListenAddr); err != nil {
+		return err
+	}
+	if c.Server.Dashboard && !c.Server.API.Enabled {
+		return fmt.Errorf("%w: server dashboard needs server api, whose tokens sign in to it", ErrInvalidConfig)
+	}
+
+	// Validate tracing settings
+	if c.Tracing.Enabled && c.Tracing.Endpoint == "" {
+		return fmt.Errorf("%w: tracing endpoint required when tracing is enabled", ErrInvalidConfig)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		return fmt.Errorf("%w: tracing sample_ratio must be between 0 and 1", ErrInvalidConfig)
+	}
+
+	// Validate output settings
+	if !c.Output.MetadataFormat.Valid() {
+		return fmt.Errorf("%w: output metadata_format must be comment or footer, got %q", ErrInvalidConfig, c.Output.MetadataFormat)
+	}
+
+	// Validate routing policies
+	for name, r := range c.Routing {
+		if r.Cheap == "" || r.Expensive == "" {
+			return fmt.Errorf("%w: routing policy %s needs a cheap and an expensive model", ErrInvalidConfig, name)
+		}
+		if r.MaxWords < 0 {
+			return fmt.Errorf("%w: max_words of routing policy %s must not be negative", ErrInvalidConfig, name)
+		}
+		for _, k := range r.Keywords {
+			if strings.TrimSpace(k) == "" {
+				return fmt.Errorf("%w: routing policy %s has an empty keyword", ErrInvalidConfig, name)
+			}
+		}
+	}
+
+	// Validate budget
+	if c.Budget.MaxTokensPerRun < 0 || c.Budget.MaxCostPerDay < 0 {
+		return fmt.Errorf("%w: budget limits must not be negative", ErrInvalidConfig)
+	}
+
+	// Validate plugins, whose names become provider prefixes
+	plugins := make(map[string]bool)
+	for _, p := range c.Plugins {
+		if p.Name == "" || p.Command == "" {
+			return fmt.Errorf("%w: plugins need a name and a command", ErrInvalidConfig)
+		}
+		if strings.Contains(p.Name, ":") {
+			return fmt.Errorf("%w: plugin name %q must not contain ':'", ErrInvalidConfig, p.Name)
+		}
+		if p.Name == "openai" || p.Name == AzureOpenAI || p.Name == OpenAICompatible {
+			return fmt.Errorf("%w: plugin name %s is a built-in provider", ErrInvalidConfig, p.Name)
+		}
+		if plugins[p.Name] {
+			return fmt.Errorf("%w: duplicate plugin %s", ErrInvalidConfig, p.Name)
+		}
+		plugins[p.Name] = true
+	}
+
+	// Validate notifications
+	for i, n := range c.Notifications {
+		if (n.URL == "") == (n.Command == "") {
+			return fmt.Errorf("%w: notification %d needs either a url or a command", ErrInvalidConfig, i+1)
+		}
+		if n.URL != "" {
+			if u, err := url.Parse(n.URL); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+				return fmt.Errorf("%w: notification url %q must be an http or https URL", ErrInvalidConfig, n.URL)
+			}
+		}
+		if n.MaxAttempts < 0 {
+			return fmt.Errorf("%w: notification max_attempts must not be negative", ErrInvalidConfig)
+		}
+		if !n.Format.Valid() {
+			return fmt.Errorf("%w: notification format must be json, slack or discord, got %q", ErrInvalidConfig, n.Format)
+		}
+		if n.Format.Chat() && n.URL == "" {
+			return fmt.Errorf("%w: %s notifications need a url", ErrInvalidConfig, n.Format)
+		}
+		if n.Template != "" {
+			if !n.Format.Chat() {
+				return fmt.Errorf("%w: notification templates need the slack or discord format", ErrInvalidConfig)
+			}
+			if _, err := template.New("notification").Parse(n.Template); err != nil {
+				return fmt.Errorf("%w: invalid notification template: %v", ErrInvalidConfig, err)
+			}
+		}
+		for _, event := range n.Events {
+			known := false
+			for _, e := range NotifyEvents {
+				known = known || e == event
+			}
+			if !known {
+				return fmt.Errorf("%w: unknown notification event %q, expected one of %s", ErrInvalidConfig, event, strings.Join(NotifyEvents, ", "))
+			}
+		}
+	}
+
+	// Validate model configurations. Replayed models need no credentials.
+	if !c.Providers.Mode.Valid() {
+		return fmt.Errorf("%w: providers mode must be live, record or replay, got %q", ErrInvalidConfig, c.Providers.Mode)
+	}
+	if c.Providers.Breaker.Cooldown < 0 {
+		return fmt.Errorf("%w: providers breaker cooldown must not be negative", ErrInvalidConfig)
+	}
+	for prefix, meta := range c.ModelMetadata {
+		if meta.ContextWindow < 0 ||
+			(meta.PromptPer1K != nil && *meta.PromptPer1K < 0) ||
+			(meta.CompletionPer1K != nil && *meta.CompletionPer1K < 0) {
+			return fmt.Errorf("%w: model_metadata %s must not have a negative context window or price", ErrInvalidConfig, prefix)
+		}
+	}
+	if c.Providers.Offline.CheckInterval < 0 || c.Providers.Offline.DrainRate < 0 {
+		return fmt.Errorf("%w: providers offline check_interval and drain_rate must not be negative", ErrInvalidConfig)
+	}
+	if !c.Update.Channel.Valid() {
+		return fmt.Errorf("%w: update channel must be stable or beta, got %q", ErrInvalidConfig, c.Update.Channel)
+	}
+	if c.Providers.Mode == ProviderReplay {
+		return nil
+	}
 	for provider, models := range c.Models {
 		for model, config := range models {
+			if config.PromptCost < 0 || config.CompletionCost < 0 {
+				return fmt.Errorf("%w: prices of model %s/%s must not be negative", ErrInvalidConfig, provider, model)
+			}
+			if config.MaxAttempts < 0 || config.ContextWindow < 0 {
+				return fmt.Errorf("%w: max_attempts and context_window of model %s/%s must not be negative", ErrInvalidConfig, provider, model)
+			}
+			if config.Proxy != "" {
+				if u, err := url.Parse(config.Proxy); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+					return fmt.Errorf("%w: proxy of model %s/%s must be an http, https or socks5 URL", ErrInvalidConfig, provider, model)
+				}
+			}
+			switch provider {
+			case AzureOpenAI:
+				if err := validateAzureModel(model, config); err != nil {
+					return err
+				}
+				continue
+			case OpenAICompatible:
+				// Local servers often need no API key
+				if u, err := url.Parse(config.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+					return fmt.Errorf("%w: valid base_url required for model %s/%s", ErrInvalidConfig, provider, model)
+				}
+				continue
+			}
+			if config.BaseURL != "" {
+				if u, err := url.Parse(config.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+					return fmt.Errorf("%w: invalid base_url %q for model %s/%s", ErrInvalidConfig, config.BaseURL, provider, model)
+				}
+			}
 			if config.APIKey == "" {
 				return fmt.Errorf("%w: API key required for model %s/%s", ErrInvalidConfig, provider, model)
 			}
@@ -124,6 +841,48 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+// validateAzureModel checks the settings of an Azure OpenAI deployment
+func validateAzureModel(deployment string, config ModelConfig) error {
+	if config.Endpoint == "" {
+		return fmt.Errorf("%w: endpoint required for deployment %s/%s", ErrInvalidConfig, AzureOpenAI, deployment)
+	}
+	if u, err := url.Parse(config.Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("%w: invalid endpoint %q for deployment %s/%s", ErrInvalidConfig, config.Endpoint, AzureOpenAI, deployment)
+	}
+	switch ad := config.AzureAD; {
+	case ad == nil && config.APIKey == "":
+		return fmt.Errorf("%w: API key or azure_ad required for deployment %s/%s", ErrInvalidConfig, AzureOpenAI, deployment)
+	case ad != nil && config.APIKey != "":
+		return fmt.Errorf("%w: deployment %s/%s sets both an API key and azure_ad", ErrInvalidConfig, AzureOpenAI, deployment)
+	case ad != nil && (ad.TenantID == "" || ad.ClientID == "" || ad.ClientSecret == ""):
+		return fmt.Errorf("%w: azure_ad for deployment %s/%s needs tenant_id, client_id and client_secret", ErrInvalidConfig, AzureOpenAI, deployment)
+	}
+	return nil
+}
+
+// validateFilter checks that a filter has a known type and the settings
+// that type needs
+func validateFilter(f FilterConfig) error {
+	switch f.Type {
+	case FilterStripPreamble:
+	case FilterMaxLength:
+		if f.Max <= 0 {
+			return fmt.Errorf("%s filter needs a positive max", f.Type)
+		}
+	case FilterHeadings:
+		if f.Level < 1 || f.Level > 6 {
+			return fmt.Errorf("%s filter needs a level between 1 and 6, got %d", f.Type, f.Level)
+		}
+	case FilterTool:
+		if f.Tool == "" {
+			return fmt.Errorf("%s filter needs a tool name", f.Type)
+		}
+	default:
+		return fmt.Errorf("unknown filter type %q", f.Type)
+	}
+	return nil
+}
+
 // AsMap converts the configuration to a map
 func (c *Config) AsMap() map[string]interface{} {
 	data, _ := yaml.Marshal(c)
@@ -132,6 +891,96 @@ func (c *Config) AsMap() map[string]interface{} {
 	return result
 }
 
+// redactedValue replaces secrets in Redacted output
+const redactedValue = "[REDACTED]"
+
+// Redacted returns the configuration as a map with API keys, tool and
+// plugin environment values and request headers replaced, safe to expose
+func (c *Config) Redacted() map[string]interface{} {
+	m := c.AsMap()
+	redact(m, false)
+	return m
+}
+
+// redact replaces secret values in place. Every value below an env or
+// headers map is treated as secret, and so are the paths of notification
+// URLs, as chat webhooks carry their credentials there. Proxy and base
+// URLs lose their user:password@.
+func redact(m map[string]interface{}, all bool) {
+	for k, v := range m {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			redact(v, all || k == "env" || k == "headers")
+		case []interface{}:
+			for _, item := range v {
+				if item, ok := item.(map[string]interface{}); ok {
+					redact(item, all)
+					if u, ok := item["url"].(string); ok && k == "notifications" && u != "" {
+						item["url"] = redactURLPath(u)
+					}
+				}
+			}
+		case string:
+			if v != "" && (all || isSecretKey(k)) {
+				m[k] = redactedValue
+			} else if k == "proxy" || k == "base_url" {
+				m[k] = stripUserinfo(v)
+			}
+		default:
+			if v != nil && (all || isSecretKey(k)) {
+				m[k] = redactedValue
+			}
+		}
+	}
+}
+
+// redactURLPath keeps the scheme and host of a URL, replacing its
+// credentials, path and query
+func redactURLPath(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return redactedValue
+	}
+	if u.Path == "" && u.RawQuery == "" && u.User == nil {
+		return u.Scheme + "://" + u.Host
+	}
+	return u.Scheme + "://" + u.Host + "/" + redactedValue
+}
+
+// stripUserinfo removes the credentials from a URL, redacting it whole when
+// it cannot be parsed but may hold some
+func stripUserinfo(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || strings.Contains(u.Opaque, "@") {
+		if strings.Contains(s, "@") {
+			return redactedValue
+		}
+		return s
+	}
+	if u.User == nil {
+		return s
+	}
+	u.User = nil
+	return u.String()
+}
+
+// isSecretKey reports whether a setting name suggests a credential
+func isSecretKey(k string) bool {
+	k = strings.ToLower(k)
+	for _, s := range []string{"api_key", "apikey", "secret", "password"} {
+		if strings.Contains(k, s) {
+			return true
+		}
+	}
+	// Match token as a whole word so that e.g. max_tokens is kept
+	for _, word := range strings.FieldsFunc(k, func(r rune) bool { return r == '_' || r == '-' || r == '.' }) {
+		if word == "token" {
+			return true
+		}
+	}
+	return false
+}
+
 // FromMap updates the configuration from a map
 func (c *Config) FromMap(data map[string]interface{}) error {
 	yamlData, err := yaml.Marshal(data)
@@ -144,3 +993,37 @@ func (c *Config) FromMap(data map[string]interface{}) error {
 	}
 	return nil
 }
+
+// validate checks the job API settings; the API needs the server running.
+// Tokens may also be created with skai token create, so none are required.
+func (a APIConfig) validate(listenAddr string) error {
+	if !a.Enabled {
+		return nil
+	}
+	if listenAddr == "" {
+		return fmt.Errorf("%w: server api needs server listen_addr", ErrInvalidConfig)
+	}
+	if a.MaxJobs < 0 {
+		return fmt.Errorf("%w: server api max_jobs cannot be negative", ErrInvalidConfig)
+	}
+	names := make(map[string]bool)
+	tokens := make(map[string]bool)
+	for i, t := range a.Tokens {
+		switch {
+		case t.Name == "":
+			return fmt.Errorf("%w: server api token %d needs a name", ErrInvalidConfig, i+1)
+		case names[t.Name]:
+			return fmt.Errorf("%w: duplicate server api token name %q", ErrInvalidConfig, t.Name)
+		case len(t.Token) < minAPITokenLength:
+			return fmt.Errorf("%w: server api token %q must be at least %d characters", ErrInvalidConfig, t.Name, minAPITokenLength)
+		case tokens[t.Token]:
+			return fmt.Errorf("%w: server api token %q is shared with another name", ErrInvalidConfig, t.Name)
+		}
+		if _, err := access.ParseScopes(t.Scopes); err != nil {
+			return fmt.Errorf("%w: server api token %q: %v", ErrInvalidConfig, t.Name, err)
+		}
+		names[t.Name] = true
+		tokens[t.Token] = true
+	}
+	return nil
+}
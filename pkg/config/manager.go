@@ -2,26 +2,47 @@ package config
 
 import (
 	"fmt"
-	"os"
+	iofs "io/fs"
+	"path"
 	"path/filepath"
 	"strings"
 	"sync"
 
+	"github.com/butter-bot-machines/skylark/pkg/fs"
+	"github.com/butter-bot-machines/skylark/pkg/fs/osfs"
 	"github.com/butter-bot-machines/skylark/pkg/security/types"
 )
 
+// configFile is the name of the configuration file in the config directory
+const configFile = "config.yaml"
+
 // Manager handles configuration loading and management
 type Manager struct {
-	mu     sync.RWMutex
-	config *Config
-	path   string
+	mu        sync.RWMutex
+	config    *Config
+	fs        fs.FS  // Holds the configuration file
+	path      string // Path of the configuration file in fs
+	configDir string // Set as Environment.ConfigDir on load
 }
 
 // NewManager creates a new configuration manager with the config directory path
 func NewManager(configDir string) *Manager {
 	return &Manager{
-		config: &Config{},
-		path:   filepath.Join(configDir, "config.yaml"),
+		config:    &Config{},
+		fs:        osfs.New(configDir, osfs.Options{}),
+		path:      configFile,
+		configDir: filepath.Clean(configDir),
+	}
+}
+
+// NewManagerWithFS creates a configuration manager for the config
+// directory configDir of fsys, given as an io/fs path
+func NewManagerWithFS(fsys fs.FS, configDir string) *Manager {
+	return &Manager{
+		config:    &Config{},
+		fs:        fsys,
+		path:      path.Join(configDir, configFile),
+		configDir: configDir,
 	}
 }
 
@@ -30,7 +51,7 @@ func (m *Manager) Load() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	data, err := os.ReadFile(m.path)
+	data, err := iofs.ReadFile(m.fs, m.path)
 	if err != nil {
 		return fmt.Errorf("failed to read config file: %w", err)
 	}
@@ -41,7 +62,7 @@ func (m *Manager) Load() error {
 	}
 
 	// Set runtime config values
-	config.Environment.ConfigDir = filepath.Dir(m.path)
+	config.Environment.ConfigDir = m.configDir
 
 	m.config = config
 	return nil
@@ -71,11 +92,11 @@ func (m *Manager) Save() error {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
 
-	if err := os.MkdirAll(filepath.Dir(m.path), 0755); err != nil {
+	if err := m.fs.MkdirAll(path.Dir(m.path), 0755); err != nil {
 		return fmt.Errorf("failed to create config directory: %w", err)
 	}
 
-	if err := os.WriteFile(m.path, data, 0644); err != nil {
+	if err := m.fs.WriteFile(m.path, data, 0644); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
 
@@ -0,0 +1,217 @@
+package context
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Priority orders blocks for budgeting. Lower values are kept first.
+type Priority int
+
+// Block priorities
+const (
+	PriorityReferenced Priority = iota // Sections the command names
+	PriorityParent                     // Headers enclosing a referenced section
+	PrioritySibling                    // Sections next to a referenced section
+	PriorityLinked                     // Notes a command links to without embedding
+)
+
+// String returns the priority's name
+func (p Priority) String() string {
+	switch p {
+	case PriorityReferenced:
+		return "referenced"
+	case PriorityParent:
+		return "parent"
+	case PrioritySibling:
+		return "sibling"
+	case PriorityLinked:
+		return "linked"
+	default:
+		return fmt.Sprintf("priority %d", int(p))
+	}
+}
+
+// Block is a section of context competing for the budget
+type Block struct {
+	Header   string
+	Content  string
+	Priority Priority
+}
+
+// Budget is the result of fitting blocks to a token limit
+type Budget struct {
+	Blocks     []Block  // Blocks kept, possibly truncated, in priority order
+	TokenCount int      // Estimated tokens of the kept blocks
+	Warnings   []string // What was truncated or dropped, and why
+}
+
+// DefaultResponseReserve is the part of a model's context window left for
+// the prompt around the context and for the response
+const DefaultResponseReserve = 2000
+
+// minTruncatedTokens is the smallest truncated block worth keeping
+const minTruncatedTokens = 25
+
+// Budgeter fits context blocks into a model's token budget
+type Budgeter struct {
+	encoding Encoding
+	limit    int
+}
+
+// NewBudgeter creates a budgeter for model. A limit of zero uses the
+// model's context window less DefaultResponseReserve.
+func NewBudgeter(model string, limit int) *Budgeter {
+	if limit <= 0 {
+		limit = ContextWindow(model) - DefaultResponseReserve
+	}
+	if limit < 0 {
+		limit = 0
+	}
+	return &Budgeter{
+		encoding: EncodingForModel(model),
+		limit:    limit,
+	}
+}
+
+// Limit returns the token budget
+func (b *Budgeter) Limit() int {
+	return b.limit
+}
+
+// Count estimates the tokens of text with the model's encoding
+func (b *Budgeter) Count(text string) int {
+	return CountTokens(text, b.encoding)
+}
+
+// Fit keeps blocks in priority order, then document order, until the
+// budget runs out. The block that crosses the limit is truncated when a
+// useful part of it fits, and everything after it is dropped.
+func (b *Budgeter) Fit(blocks []Block) *Budget {
+	ordered := make([]Block, len(blocks))
+	copy(ordered, blocks)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Priority < ordered[j].Priority
+	})
+
+	budget := &Budget{}
+	full := false
+	for _, block := range ordered {
+		tokens := b.Count(block.Content)
+		available := b.limit - budget.TokenCount
+
+		if tokens > available || full {
+			if full || available < minTruncatedTokens {
+				full = true
+				budget.Warnings = append(budget.Warnings, fmt.Sprintf(
+					"dropped %s section '%s' (%d tokens) to fit the %d-token budget",
+					block.Priority, block.Header, tokens, b.limit))
+				continue
+			}
+			block.Content = b.truncate(block.Content, available)
+			truncated := b.Count(block.Content)
+			budget.Warnings = append(budget.Warnings, fmt.Sprintf(
+				"truncated %s section '%s' from %d to %d tokens to fit the %d-token budget",
+				block.Priority, block.Header, tokens, truncated, b.limit))
+			tokens = truncated
+			full = true
+		}
+
+		budget.Blocks = append(budget.Blocks, block)
+		budget.TokenCount += tokens
+	}
+	return budget
+}
+
+// truncate cuts content at a sentence or word boundary so that it fits in
+// maxTokens, searching for the longest prefix that does
+func (b *Budgeter) truncate(content string, maxTokens int) string {
+	best := ""
+	lo, hi := 0, len(content)
+	for lo <= hi {
+		mid := (lo + hi) / 2
+		// Never cut inside a multi-byte character
+		size := mid
+		for size > 0 && size < len(content) && !utf8.RuneStart(content[size]) {
+			size--
+		}
+		candidate := strings.TrimRight(truncateContent(content, size), " \n")
+		if b.Count(candidate) <= maxTokens {
+			if len(candidate) > len(best) {
+				best = candidate
+			}
+			lo = mid + 1
+		} else {
+			hi = mid - 1
+		}
+	}
+	return best
+}
+
+// CollectBlocks returns the sections of content that headers name, with
+// their parent and sibling sections, matching headers regardless of case and
+// Unicode normalization. Each section appears once, at the highest priority
+// it qualifies for.
+func CollectBlocks(content string, headers []string) []Block {
+	refs := ParseReferences(content)
+	lines := strings.Split(content, "\n")
+
+	section := func(ref Reference) string {
+		end := ref.EndLine
+		if end >= len(lines) {
+			end = len(lines) - 1
+		}
+		return strings.TrimSpace(strings.Join(lines[ref.StartLine:end+1], "\n"))
+	}
+
+	wanted := make(map[string]bool, len(headers))
+	for _, h := range headers {
+		wanted[FoldHeader(h)] = true
+	}
+
+	// Highest priority per section, keyed by index in refs
+	priority := make(map[int]Priority)
+	claim := func(header string, p Priority) {
+		for i, ref := range refs {
+			if ref.Header != header {
+				continue
+			}
+			if current, ok := priority[i]; !ok || p < current {
+				priority[i] = p
+			}
+			return
+		}
+	}
+
+	for _, ref := range refs {
+		if !wanted[FoldHeader(ref.Header)] {
+			continue
+		}
+		claim(ref.Header, PriorityReferenced)
+		if parent := GetParentHeader(refs, ref.Header); parent != "" {
+			claim(parent, PriorityParent)
+		}
+		prev, next := GetSiblingHeaders(refs, ref.Header)
+		for _, sibling := range []string{prev, next} {
+			if sibling != "" {
+				claim(sibling, PrioritySibling)
+			}
+		}
+	}
+
+	var blocks []Block
+	for i, ref := range refs {
+		p, ok := priority[i]
+		if !ok {
+			continue
+		}
+		content := section(ref)
+		if content == "" {
+			continue
+		}
+		blocks = append(blocks, Block{Header: ref.Header, Content: content, Priority: p})
+	}
+	return blocks
+}
@@ -0,0 +1,132 @@
+package context
+
+import (
+	"strings"
+	"testing"
+)
+
+const budgetDocument = `# Project
+
+Overview of the project.
+
+## Goals
+
+Grow the user base.
+
+## Roadmap
+
+Ship v1 in May.
+
+## Team
+
+Two people.
+
+## Budget
+
+Small.
+`
+
+func TestCollectBlocks(t *testing.T) {
+	blocks := CollectBlocks(budgetDocument, []string{"roadmap"})
+
+	want := []Block{
+		{Header: "Project", Content: "Overview of the project.", Priority: PriorityParent},
+		{Header: "Goals", Content: "Grow the user base.", Priority: PrioritySibling},
+		{Header: "Roadmap", Content: "Ship v1 in May.", Priority: PriorityReferenced},
+		{Header: "Team", Content: "Two people.", Priority: PrioritySibling},
+	}
+	if len(blocks) != len(want) {
+		t.Fatalf("Expected %d blocks, got %+v", len(want), blocks)
+	}
+	for i := range want {
+		if blocks[i] != want[i] {
+			t.Errorf("Block %d: expected %+v, got %+v", i, want[i], blocks[i])
+		}
+	}
+
+	// A section named directly keeps its referenced priority
+	blocks = CollectBlocks(budgetDocument, []string{"Roadmap", "Team"})
+	for _, block := range blocks {
+		if block.Header == "Team" && block.Priority != PriorityReferenced {
+			t.Errorf("Expected Team to be referenced, got %s", block.Priority)
+		}
+	}
+}
+
+func TestCollectBlocksUnicode(t *testing.T) {
+	document := "# München\n\nBavaria.\n\n# 日本語\n\nJapanese.\n\n# Straße\n\nA street.\n"
+
+	tests := []struct {
+		ref     string
+		content string
+	}{
+		{"München", "Bavaria."},
+		{"MÜNCHEN", "Bavaria."},
+		{"Mu\u0308nchen", "Bavaria."}, // Decomposed ü
+		{"日本語", "Japanese."},
+		{"STRASSE", "A street."},
+		{"  straße ", "A street."},
+	}
+	for _, tt := range tests {
+		var found string
+		for _, block := range CollectBlocks(document, []string{tt.ref}) {
+			if block.Priority == PriorityReferenced {
+				found = block.Content
+			}
+		}
+		if found != tt.content {
+			t.Errorf("Expected #%s# to resolve to %q, got %q", tt.ref, tt.content, found)
+		}
+	}
+}
+
+func TestBudgeterFit(t *testing.T) {
+	long := strings.Repeat("This sentence is about the roadmap. ", 20)
+	blocks := []Block{
+		{Header: "Team", Content: "Two people.", Priority: PrioritySibling},
+		{Header: "Project", Content: "Overview of the project.", Priority: PriorityParent},
+		{Header: "Roadmap", Content: long, Priority: PriorityReferenced},
+	}
+	roadmapTokens := CountTokens(long, EncodingCL100K)
+
+	t.Run("everything fits", func(t *testing.T) {
+		budget := NewBudgeter("gpt-4", 0).Fit(blocks)
+		if len(budget.Blocks) != 3 || len(budget.Warnings) != 0 {
+			t.Fatalf("Expected all blocks without warnings, got %+v", budget)
+		}
+		// Kept in priority order
+		if budget.Blocks[0].Header != "Roadmap" || budget.Blocks[1].Header != "Project" || budget.Blocks[2].Header != "Team" {
+			t.Errorf("Unexpected order: %+v", budget.Blocks)
+		}
+	})
+
+	t.Run("lower priorities dropped", func(t *testing.T) {
+		budget := NewBudgeter("gpt-4", roadmapTokens+2).Fit(blocks)
+		if len(budget.Blocks) != 1 || budget.Blocks[0].Content != long {
+			t.Fatalf("Expected only the referenced section, got %+v", budget.Blocks)
+		}
+		if len(budget.Warnings) != 2 || !strings.Contains(budget.Warnings[0], "dropped parent section 'Project'") {
+			t.Errorf("Unexpected warnings: %v", budget.Warnings)
+		}
+		if budget.TokenCount != roadmapTokens {
+			t.Errorf("Expected %d tokens, got %d", roadmapTokens, budget.TokenCount)
+		}
+	})
+
+	t.Run("referenced section truncated", func(t *testing.T) {
+		budget := NewBudgeter("gpt-4", 40).Fit(blocks)
+		if len(budget.Blocks) != 1 {
+			t.Fatalf("Expected only the truncated section, got %+v", budget.Blocks)
+		}
+		content := budget.Blocks[0].Content
+		if !strings.HasSuffix(content, ".") || len(content) >= len(long) {
+			t.Errorf("Expected truncation at a sentence boundary, got %q", content)
+		}
+		if budget.TokenCount > 40 {
+			t.Errorf("Expected at most 40 tokens, got %d", budget.TokenCount)
+		}
+		if !strings.Contains(budget.Warnings[0], "truncated referenced section 'Roadmap'") {
+			t.Errorf("Unexpected warnings: %v", budget.Warnings)
+		}
+	})
+}
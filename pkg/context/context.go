@@ -3,6 +3,9 @@ package context
 import (
 	"regexp"
 	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
 )
 
 // Reference represents a section reference in a document
@@ -23,6 +26,13 @@ type Context struct {
 // HeaderPattern matches Markdown headers with level capture
 var HeaderPattern = regexp.MustCompile(`^(#{1,6})\s+(.+?)(?:\s+#*)?$`)
 
+// FoldHeader returns header in the form headers are compared in: NFC
+// normalized, case folded and with whitespace collapsed, so that
+// "Straße", "STRASSE" and a decomposed "Straße" name the same section
+func FoldHeader(header string) string {
+	return strings.Join(strings.Fields(cases.Fold().String(norm.NFC.String(header))), " ")
+}
+
 // ParseReferences finds all section references in a document
 func ParseReferences(content string) []Reference {
 	var refs []Reference
@@ -67,7 +77,7 @@ func AssembleContext(content string, headers []string, maxSize, maxTokens int) (
 	// Create header map for quick lookup
 	headerMap := make(map[string]bool)
 	for _, h := range headers {
-		headerMap[strings.ToLower(h)] = true
+		headerMap[FoldHeader(h)] = true
 	}
 
 	// Initialize context
@@ -78,7 +88,7 @@ func AssembleContext(content string, headers []string, maxSize, maxTokens int) (
 	// Find matching references
 	var matches []Reference
 	for _, ref := range refs {
-		if headerMap[strings.ToLower(ref.Header)] {
+		if headerMap[FoldHeader(ref.Header)] {
 			matches = append(matches, ref)
 		}
 	}
@@ -0,0 +1,173 @@
+package context
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	skmodels "github.com/butter-bot-machines/skylark/pkg/models"
+)
+
+// Encoding names a tokenizer vocabulary
+type Encoding string
+
+// Encodings used by OpenAI models
+const (
+	EncodingR50K   Encoding = "r50k_base"   // GPT-3
+	EncodingP50K   Encoding = "p50k_base"   // Codex and text-davinci
+	EncodingCL100K Encoding = "cl100k_base" // GPT-3.5 and GPT-4
+	EncodingO200K  Encoding = "o200k_base"  // GPT-4o and later
+)
+
+// defaultContextWindow is assumed for models not listed in models
+const defaultContextWindow = 8192
+
+// modelInfo is the encoding of a model family
+type modelInfo struct {
+	prefix   string
+	encoding Encoding
+}
+
+// models is matched by longest prefix. Context windows are in the models
+// package.
+var models = []modelInfo{
+	{"gpt-4o", EncodingO200K},
+	{"gpt-4.1", EncodingO200K},
+	{"gpt-4.5", EncodingO200K},
+	{"gpt-5", EncodingO200K},
+	{"chatgpt-4o", EncodingO200K},
+	{"o1", EncodingO200K},
+	{"o3", EncodingO200K},
+	{"o4", EncodingO200K},
+	{"gpt-4", EncodingCL100K},
+	{"gpt-3.5-turbo", EncodingCL100K},
+	{"text-embedding", EncodingCL100K},
+	{"text-davinci", EncodingP50K},
+	{"code-davinci", EncodingP50K},
+	{"davinci", EncodingR50K},
+}
+
+func init() {
+	sort.SliceStable(models, func(i, j int) bool {
+		return len(models[i].prefix) > len(models[j].prefix)
+	})
+}
+
+// lookupModel finds the model family for a model name, which may carry a
+// "provider:" prefix
+func lookupModel(model string) (modelInfo, bool) {
+	if _, name, ok := strings.Cut(model, ":"); ok {
+		model = name
+	}
+	model = strings.ToLower(model)
+	for _, m := range models {
+		if strings.HasPrefix(model, m.prefix) {
+			return m, true
+		}
+	}
+	return modelInfo{}, false
+}
+
+// EncodingForModel returns the encoding a model uses, defaulting to
+// cl100k_base for unknown models
+func EncodingForModel(model string) Encoding {
+	if m, ok := lookupModel(model); ok {
+		return m.encoding
+	}
+	return EncodingCL100K
+}
+
+// ContextWindow returns the number of tokens a model accepts, prompt and
+// response together
+func ContextWindow(model string) int {
+	if window, ok := LookupContextWindow(model); ok {
+		return window
+	}
+	return defaultContextWindow
+}
+
+// LookupContextWindow returns the context window of a known model. It
+// reports false for models without built-in metadata, whose window is
+// unknown.
+func LookupContextWindow(model string) (int, bool) {
+	if m, ok := skmodels.Default().Lookup(model); ok && m.ContextWindow > 0 {
+		return m.ContextWindow, true
+	}
+	return 0, false
+}
+
+// pieces splits text the way tiktoken does before applying byte pair
+// merges: contractions, words with an optional leading symbol, runs of up
+// to three digits, punctuation, newlines and other whitespace.
+var pieces = regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\pL\pN]?\pL+|\pN{1,3}| ?[^\s\pL\pN]+[\r\n]*|\s*[\r\n]+|\s+`)
+
+// wordRunes is how many letters of an ASCII word one token covers on
+// average, by encoding. Short common words are a single token.
+var wordRunes = map[Encoding]int{
+	EncodingR50K:   5,
+	EncodingP50K:   5,
+	EncodingCL100K: 6,
+	EncodingO200K:  7,
+}
+
+// CountTokens estimates how many tokens text encodes to. It splits text as
+// tiktoken does and estimates the merges within each piece, which comes
+// close to the real count for English prose and code.
+func CountTokens(text string, enc Encoding) int {
+	perToken, ok := wordRunes[enc]
+	if !ok {
+		perToken = wordRunes[EncodingCL100K]
+	}
+
+	count := 0
+	for _, piece := range pieces.FindAllString(text, -1) {
+		count += pieceTokens(piece, enc, perToken)
+	}
+	return count
+}
+
+// pieceTokens estimates the tokens of one pre-tokenized piece
+func pieceTokens(piece string, enc Encoding, perToken int) int {
+	first, _ := utf8.DecodeRuneInString(piece)
+	switch {
+	case unicode.IsSpace(first) && strings.TrimSpace(piece) == "":
+		return 1
+	case unicode.IsDigit(first):
+		return 1
+	}
+
+	letters, other, wide := 0, 0, 0
+	for _, r := range piece {
+		switch {
+		case r < utf8.RuneSelf && unicode.IsLetter(r):
+			letters++
+		case unicode.IsLetter(r):
+			wide++
+		case r != ' ':
+			other++
+		}
+	}
+
+	tokens := 0
+	if letters > 0 {
+		tokens += (letters + perToken - 1) / perToken
+	}
+	if wide > 0 {
+		// Non-Latin letters mostly take a token each, fewer with o200k
+		if enc == EncodingO200K {
+			tokens += (wide*2 + 2) / 3
+		} else {
+			tokens += wide
+		}
+	}
+	if other > 0 && letters+wide == 0 {
+		// Common punctuation pairs such as ". or ); merge
+		tokens += (other + 1) / 2
+	}
+	if tokens == 0 {
+		tokens = 1
+	}
+	return tokens
+}
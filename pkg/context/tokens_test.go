@@ -0,0 +1,55 @@
+package context
+
+import "testing"
+
+func TestCountTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		enc  Encoding
+		want int
+	}{
+		{"", EncodingCL100K, 0},
+		{"Hello, world!", EncodingCL100K, 4},
+		{"The quick brown fox jumps over the lazy dog.", EncodingCL100K, 10},
+		{"12345678", EncodingCL100K, 3},
+		{"internationalization", EncodingCL100K, 4},
+		{"internationalization", EncodingO200K, 3},
+		{"こんにちは世界", EncodingCL100K, 7},
+		{"こんにちは世界", EncodingO200K, 5},
+	}
+
+	for _, tt := range tests {
+		if got := CountTokens(tt.text, tt.enc); got != tt.want {
+			t.Errorf("CountTokens(%q, %s) = %d, want %d", tt.text, tt.enc, got, tt.want)
+		}
+	}
+}
+
+func TestModelLookup(t *testing.T) {
+	tests := []struct {
+		model    string
+		encoding Encoding
+		window   int
+		known    bool
+	}{
+		{"gpt-4", EncodingCL100K, 8192, true},
+		{"openai:gpt-4-32k-0613", EncodingCL100K, 32768, true},
+		{"gpt-4-turbo-preview", EncodingCL100K, 128000, true},
+		{"GPT-4o-mini", EncodingO200K, 128000, true},
+		{"gpt-3.5-turbo", EncodingCL100K, 16385, true},
+		{"text-davinci-003", EncodingP50K, 4097, true},
+		{"local-llama", EncodingCL100K, defaultContextWindow, false},
+	}
+
+	for _, tt := range tests {
+		if got := EncodingForModel(tt.model); got != tt.encoding {
+			t.Errorf("EncodingForModel(%q) = %s, want %s", tt.model, got, tt.encoding)
+		}
+		if got := ContextWindow(tt.model); got != tt.window {
+			t.Errorf("ContextWindow(%q) = %d, want %d", tt.model, got, tt.window)
+		}
+		if _, ok := LookupContextWindow(tt.model); ok != tt.known {
+			t.Errorf("LookupContextWindow(%q) reported %v, want %v", tt.model, ok, tt.known)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// callTimeout bounds a whole control request, including a reload
+const callTimeout = 30 * time.Second
+
+// Call sends a command to the daemon listening on the socket at path and
+// returns its status afterwards. It returns ErrNotRunning if no daemon is
+// listening.
+func Call(path, command string) (*Status, error) {
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotRunning, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(callTimeout))
+
+	if err := json.NewEncoder(conn).Encode(Request{Command: command}); err != nil {
+		return nil, fmt.Errorf("failed to send command: %w", err)
+	}
+
+	var resp Response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	if resp.Status == nil {
+		return nil, fmt.Errorf("empty response to %s", command)
+	}
+	return resp.Status, nil
+}
@@ -0,0 +1,166 @@
+package daemon
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+	"github.com/butter-bot-machines/skylark/pkg/logging/memory"
+)
+
+// fakeController records control commands
+type fakeController struct {
+	mu        sync.Mutex
+	paused    bool
+	reloads   int
+	reloadErr error
+}
+
+func (f *fakeController) Status() Status {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return Status{PID: 42, Paused: f.paused, QueueDepth: 3}
+}
+
+func (f *fakeController) Pause() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.paused = true
+	return nil
+}
+
+func (f *fakeController) Resume() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.paused = false
+	return nil
+}
+
+func (f *fakeController) Reload() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reloads++
+	return f.reloadErr
+}
+
+func newTestLogger() logging.Logger {
+	return memory.NewLogger(logging.LevelDebug, io.Discard)
+}
+
+func TestControlSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "skylark.sock")
+	ctrl := &fakeController{}
+
+	srv, err := Listen(path, ctrl, newTestLogger())
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer srv.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Control socket missing: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("Expected socket permissions 0600, got %v", perm)
+	}
+
+	tests := []struct {
+		command    string
+		wantPaused bool
+		wantErr    bool
+	}{
+		{command: CommandStatus, wantPaused: false},
+		{command: CommandPause, wantPaused: true},
+		{command: CommandStatus, wantPaused: true},
+		{command: CommandResume, wantPaused: false},
+		{command: CommandReload, wantPaused: false},
+		{command: "explode", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			status, err := Call(path, tt.command)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Call(%s) error = %v, wantErr %v", tt.command, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if status.PID != 42 || status.QueueDepth != 3 {
+				t.Errorf("Unexpected status: %+v", status)
+			}
+			if status.Paused != tt.wantPaused {
+				t.Errorf("Expected paused=%v, got %v", tt.wantPaused, status.Paused)
+			}
+		})
+	}
+
+	ctrl.mu.Lock()
+	if ctrl.reloads != 1 {
+		t.Errorf("Expected 1 reload, got %d", ctrl.reloads)
+	}
+
+	// Errors from the controller reach the client
+	ctrl.reloadErr = errors.New("invalid config")
+	ctrl.mu.Unlock()
+	if _, err := Call(path, CommandReload); err == nil || err.Error() != "invalid config" {
+		t.Errorf("Expected reload error, got %v", err)
+	}
+
+	// A second daemon cannot take over a live socket
+	if _, err := Listen(path, &fakeController{}, newTestLogger()); err == nil {
+		t.Error("Expected error listening on a live socket")
+	}
+
+	// Closing removes the socket
+	srv.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected socket removed on close, got %v", err)
+	}
+	if _, err := Call(path, CommandStatus); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Expected ErrNotRunning after close, got %v", err)
+	}
+}
+
+func TestControlSocketStale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "skylark.sock")
+
+	// Leave a socket file behind with nothing listening
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Failed to create socket: %v", err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+
+	if _, err := Call(path, CommandStatus); !errors.Is(err, ErrNotRunning) {
+		t.Fatalf("Expected ErrNotRunning for stale socket, got %v", err)
+	}
+
+	srv, err := Listen(path, &fakeController{}, newTestLogger())
+	if err != nil {
+		t.Fatalf("Failed to replace stale socket: %v", err)
+	}
+	defer srv.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := Call(path, CommandStatus)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Call failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for status")
+	}
+}
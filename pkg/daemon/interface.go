@@ -0,0 +1,62 @@
+// Package daemon implements the control socket used to manage a Skylark
+// process running in the background.
+package daemon
+
+import (
+	"errors"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/worker"
+)
+
+// Control commands understood by the daemon
+const (
+	CommandStatus = "status"
+	CommandPause  = "pause"
+	CommandResume = "resume"
+	CommandReload = "reload"
+)
+
+// ErrNotRunning is returned by Call when no daemon is listening on the socket
+var ErrNotRunning = errors.New("daemon not running")
+
+// Controller is the running daemon as seen by the control socket
+type Controller interface {
+	// Status reports the daemon's current state
+	Status() Status
+
+	// Pause stops processing new jobs; file changes keep being queued
+	Pause() error
+
+	// Resume continues processing after Pause
+	Resume() error
+
+	// Reload re-reads the configuration and restarts the file watcher
+	Reload() error
+}
+
+// Status describes a running daemon
+type Status struct {
+	PID           int             `json:"pid"`
+	Paused        bool            `json:"paused"`
+	Started       time.Time       `json:"started"`
+	Reloaded      time.Time       `json:"reloaded,omitempty"`
+	QueueDepth    uint64          `json:"queue_depth"`
+	Processed     uint64          `json:"processed"`
+	Failed        uint64          `json:"failed"`
+	ActiveWorkers int             `json:"active_workers"`
+	LastError     *worker.Failure `json:"last_error,omitempty"`
+	Offline       bool            `json:"offline,omitempty"` // Providers cannot be reached
+	Backlog       int             `json:"backlog,omitempty"` // Files waiting in the persisted queue
+}
+
+// Request is a single control command sent over the socket
+type Request struct {
+	Command string `json:"command"`
+}
+
+// Response answers a Request. Status is always filled in on success.
+type Response struct {
+	Error  string  `json:"error,omitempty"`
+	Status *Status `json:"status,omitempty"`
+}
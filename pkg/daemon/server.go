@@ -0,0 +1,121 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+)
+
+// requestTimeout bounds how long a client may take to send its command
+const requestTimeout = 5 * time.Second
+
+// Server accepts control commands on a unix-domain socket
+type Server struct {
+	path     string
+	ctrl     Controller
+	logger   logging.Logger
+	listener net.Listener
+	wg       sync.WaitGroup
+	once     sync.Once
+}
+
+// Listen creates the control socket at path and starts serving commands.
+// A stale socket left by a daemon that exited uncleanly is replaced; a live
+// one is an error.
+func Listen(path string, ctrl Controller, logger logging.Logger) (*Server, error) {
+	if _, err := Call(path, CommandStatus); err == nil {
+		return nil, fmt.Errorf("daemon already running on %s", path)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove stale control socket: %w", err)
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on control socket: %w", err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to restrict control socket: %w", err)
+	}
+
+	s := &Server{
+		path:     path,
+		ctrl:     ctrl,
+		logger:   logger.WithGroup("control"),
+		listener: ln,
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Close stops accepting commands and removes the socket
+func (s *Server) Close() error {
+	var err error
+	s.once.Do(func() {
+		err = s.listener.Close()
+		s.wg.Wait()
+		os.Remove(s.path)
+	})
+	return err
+}
+
+// serve accepts connections until the listener is closed
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				s.logger.Error("control socket failed", "error", err)
+			}
+			return
+		}
+		s.handle(conn)
+	}
+}
+
+// handle answers a single request. Commands are handled one at a time so
+// that, for example, a reload never overlaps a pause.
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(requestTimeout))
+
+	var req Request
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		s.logger.Warn("invalid control request", "error", err)
+		json.NewEncoder(conn).Encode(Response{Error: fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+
+	s.logger.Info("control command", "command", req.Command)
+	var err error
+	switch req.Command {
+	case CommandStatus:
+	case CommandPause:
+		err = s.ctrl.Pause()
+	case CommandResume:
+		err = s.ctrl.Resume()
+	case CommandReload:
+		err = s.ctrl.Reload()
+	default:
+		err = fmt.Errorf("unknown command: %s", req.Command)
+	}
+
+	resp := Response{}
+	if err != nil {
+		s.logger.Error("control command failed", "command", req.Command, "error", err)
+		resp.Error = err.Error()
+	} else {
+		status := s.ctrl.Status()
+		resp.Status = &status
+	}
+	json.NewEncoder(conn).Encode(resp)
+}
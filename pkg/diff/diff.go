@@ -0,0 +1,156 @@
+// Package diff compares texts line by line and formats the differences as
+// unified diffs.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Context is the number of unchanged lines shown around changes
+const Context = 3
+
+// Op is the kind of an edit
+type Op byte
+
+const (
+	Equal  Op = ' '
+	Delete Op = '-'
+	Insert Op = '+'
+)
+
+// Edit is a line kept, removed or added. Text includes the line's newline,
+// unless it is the last line of a text without one.
+type Edit struct {
+	Op   Op
+	Text string
+}
+
+// Lines returns the edits that turn before into after, following their
+// longest common subsequence of lines
+func Lines(before, after string) []Edit {
+	a, b := split(before), split(after)
+
+	// Longest common subsequence lengths of the suffixes
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var edits []Edit
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			edits = append(edits, Edit{Equal, a[i]})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, Edit{Delete, a[i]})
+			i++
+		default:
+			edits = append(edits, Edit{Insert, b[j]})
+			j++
+		}
+	}
+	return edits
+}
+
+// Unified returns the differences between before and after as a unified
+// diff with Context lines of context, or "" when they are equal. from and
+// to name the two versions in the header.
+func Unified(from, to, before, after string) string {
+	edits := Lines(before, after)
+
+	// Mark the edits shown: the changes and their context
+	show := make([]bool, len(edits))
+	changed := false
+	for k, e := range edits {
+		if e.Op == Equal {
+			continue
+		}
+		changed = true
+		for n := max(0, k-Context); n <= k+Context && n < len(edits); n++ {
+			show[n] = true
+		}
+	}
+	if !changed {
+		return ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", from, to)
+	aLine, bLine := 1, 1 // Next line of each version
+	for k := 0; k < len(edits); {
+		if !show[k] {
+			if edits[k].Op != Insert {
+				aLine++
+			}
+			if edits[k].Op != Delete {
+				bLine++
+			}
+			k++
+			continue
+		}
+
+		// A hunk runs until the next edit not shown
+		end := k
+		for end < len(edits) && show[end] {
+			end++
+		}
+		aLen, bLen := 0, 0
+		for _, e := range edits[k:end] {
+			if e.Op != Insert {
+				aLen++
+			}
+			if e.Op != Delete {
+				bLen++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(aLine, aLen), hunkRange(bLine, bLen))
+		for _, e := range edits[k:end] {
+			sb.WriteByte(byte(e.Op))
+			sb.WriteString(e.Text)
+			if !strings.HasSuffix(e.Text, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		aLine += aLen
+		bLine += bLen
+		k = end
+	}
+	return sb.String()
+}
+
+// hunkRange formats the start and length of a hunk's lines in one version.
+// An empty range starts at the line before it.
+func hunkRange(start, length int) string {
+	switch length {
+	case 0:
+		return fmt.Sprintf("%d,0", start-1)
+	case 1:
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, length)
+}
+
+// split returns the lines of s, each with its newline
+func split(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,56 @@
+package diff
+
+import "testing"
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name   string
+		before string
+		after  string
+		want   string
+	}{
+		{
+			name:   "unchanged",
+			before: "a\nb\n",
+			after:  "a\nb\n",
+			want:   "",
+		},
+		{
+			name:   "insertion",
+			before: "a\nb\nc\n",
+			after:  "a\nb\nx\nc\n",
+			want:   "--- old\n+++ new\n@@ -1,3 +1,4 @@\n a\n b\n+x\n c\n",
+		},
+		{
+			name:   "replacement with distant context",
+			before: "1\n2\n3\n4\n5\n6\n7\n8\n!cmd\n",
+			after:  "1\n2\n3\n4\n5\n6\n7\n8\n-!cmd\n\nanswer\n",
+			want:   "--- old\n+++ new\n@@ -6,4 +6,6 @@\n 6\n 7\n 8\n-!cmd\n+-!cmd\n+\n+answer\n",
+		},
+		{
+			name:   "separate hunks",
+			before: "a\n1\n2\n3\n4\n5\n6\n7\nb\n",
+			after:  "A\n1\n2\n3\n4\n5\n6\n7\nB\n",
+			want:   "--- old\n+++ new\n@@ -1,4 +1,4 @@\n-a\n+A\n 1\n 2\n 3\n@@ -6,4 +6,4 @@\n 5\n 6\n 7\n-b\n+B\n",
+		},
+		{
+			name:   "new file",
+			before: "",
+			after:  "# Responses\n",
+			want:   "--- old\n+++ new\n@@ -0,0 +1 @@\n+# Responses\n",
+		},
+		{
+			name:   "missing final newline",
+			before: "a",
+			after:  "a\nb\n",
+			want:   "--- old\n+++ new\n@@ -1 +1,2 @@\n-a\n\\ No newline at end of file\n+a\n+b\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Unified("old", "new", tt.before, tt.after); got != tt.want {
+				t.Errorf("Expected diff:\n%q\nGot:\n%q", tt.want, got)
+			}
+		})
+	}
+}
@@ -229,6 +229,11 @@ func (e *concreteError) Cause() error {
 	return e.cause
 }
 
+// Unwrap returns the cause, for errors.Is and errors.As
+func (e *concreteError) Unwrap() error {
+	return e.cause
+}
+
 type stackFrame struct {
 	file     string
 	line     int
@@ -1,7 +1,9 @@
 package errors
 
 import (
+	stderrors "errors"
 	"fmt"
+	"io"
 	"strings"
 	"testing"
 )
@@ -240,3 +242,26 @@ func TestErrorTypeString(t *testing.T) {
 		}
 	}
 }
+
+func TestTyped(t *testing.T) {
+	cause := fmt.Errorf("outer: %w", io.EOF)
+	err := Typed(cause, NetworkError)
+	if err.Error() != cause.Error() {
+		t.Errorf("Expected message %q, got %q", cause.Error(), err.Error())
+	}
+	if !stderrors.Is(err, io.EOF) {
+		t.Error("Expected the typed error to wrap its cause")
+	}
+
+	// The type is found behind errors that wrap it
+	wrapped := fmt.Errorf("context: %w", err)
+	if GetType(wrapped) != NetworkError {
+		t.Errorf("Expected type %v, got %v", NetworkError, GetType(wrapped))
+	}
+	if GetType(Wrap(err, "untyped")) != NetworkError {
+		t.Error("Expected an untyped wrapper to report the type of its cause")
+	}
+	if GetType(cause) != nil || Typed(nil, NetworkError) != nil {
+		t.Error("Expected no type for plain errors and nil for nil")
+	}
+}
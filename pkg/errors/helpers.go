@@ -1,5 +1,7 @@
 package errors
 
+import stderrors "errors"
+
 // AsError attempts to convert an error to our Error interface
 func AsError(err error) Error {
 	if err == nil {
@@ -14,16 +16,37 @@ func AsError(err error) Error {
 	return nil
 }
 
-// GetType returns the error type if available
+// GetType returns the type of the first typed error in err's chain, or nil
 func GetType(err error) ErrorType {
-	if e := AsError(err); e != nil {
-		if ce, ok := e.(*concreteError); ok {
+	var ce *concreteError
+	for stderrors.As(err, &ce) {
+		if ce.errType != nil {
 			return ce.errType
 		}
+		err = ce.cause
 	}
 	return nil
 }
 
+// Typed returns err as an error of errType, with the same message and err
+// as its cause, so callers can classify errors created with fmt.Errorf
+func Typed(err error, errType ErrorType) error {
+	if err == nil {
+		return nil
+	}
+	t, ok := errType.(*errorType)
+	if !ok {
+		return err
+	}
+	return &concreteError{
+		errType: t,
+		message: err.Error(),
+		cause:   err,
+		stack:   captureStackTrace(2),
+		context: make(map[string]interface{}),
+	}
+}
+
 // GetMessage returns the error message without context
 func GetMessage(err error) string {
 	if e := AsError(err); e != nil {
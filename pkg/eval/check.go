@@ -0,0 +1,103 @@
+package eval
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/butter-bot-machines/skylark/pkg/jsonschema"
+)
+
+// check is one expected property of a response
+type check struct {
+	name string
+	test func(response string) string // Returns why response fails, or ""
+}
+
+// CheckResult reports one check of a response
+type CheckResult struct {
+	Check  string `json:"check"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail,omitempty"` // Why the check failed
+}
+
+// matches checks that response matches re, or does not when want is
+// false
+func matches(re *regexp.Regexp, want bool) check {
+	if want {
+		return check{name: fmt.Sprintf("regex %s", re), test: func(response string) string {
+			if !re.MatchString(response) {
+				return "no match"
+			}
+			return ""
+		}}
+	}
+	return check{name: fmt.Sprintf("not_regex %s", re), test: func(response string) string {
+		if loc := re.FindStringIndex(response); loc != nil {
+			return fmt.Sprintf("matched %q", response[loc[0]:loc[1]])
+		}
+		return ""
+	}}
+}
+
+// contains checks that response contains keyword in any case, or does
+// not when want is false
+func contains(keyword string, want bool) check {
+	lower := strings.ToLower(keyword)
+	if want {
+		return check{name: fmt.Sprintf("keyword %q", keyword), test: func(response string) string {
+			if !strings.Contains(strings.ToLower(response), lower) {
+				return "missing"
+			}
+			return ""
+		}}
+	}
+	return check{name: fmt.Sprintf("absent %q", keyword), test: func(response string) string {
+		if strings.Contains(strings.ToLower(response), lower) {
+			return "present"
+		}
+		return ""
+	}}
+}
+
+// conforms checks that response is JSON conforming to schema. A code
+// fence around the JSON is ignored.
+func conforms(name string, schema *jsonschema.Schema) check {
+	return check{name: fmt.Sprintf("schema %s", name), test: func(response string) string {
+		if _, err := schema.Validate([]byte(unfence(response))); err != nil {
+			return err.Error()
+		}
+		return ""
+	}}
+}
+
+// words checks that response has between min and max words, where 0
+// leaves a bound open
+func words(min, max int) check {
+	name := fmt.Sprintf("words %d-%d", min, max)
+	switch {
+	case max == 0:
+		name = fmt.Sprintf("min_words %d", min)
+	case min == 0:
+		name = fmt.Sprintf("max_words %d", max)
+	}
+	return check{name: name, test: func(response string) string {
+		n := len(strings.Fields(response))
+		if n < min || (max > 0 && n > max) {
+			return fmt.Sprintf("%d words", n)
+		}
+		return ""
+	}}
+}
+
+// unfence returns response without a code fence around it
+func unfence(response string) string {
+	body := strings.TrimSpace(response)
+	if strings.HasPrefix(body, "```") {
+		body = strings.TrimSuffix(body, "```")
+		if i := strings.Index(body, "\n"); i >= 0 {
+			body = body[i+1:]
+		}
+	}
+	return strings.TrimSpace(body)
+}
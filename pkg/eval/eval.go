@@ -0,0 +1,169 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+	"github.com/butter-bot-machines/skylark/pkg/timing"
+)
+
+// logger writes through the default handler installed by the CLI
+var logger = logging.Default()
+
+// CaseResult reports one case run against one model
+type CaseResult struct {
+	Case       string         `json:"case"`
+	Score      float64        `json:"score"` // Share of the checks that passed, from 0 to 1
+	Error      string         `json:"error,omitempty"`
+	Response   string         `json:"response,omitempty"`
+	Checks     []CheckResult  `json:"checks,omitempty"`
+	Tokens     provider.Usage `json:"tokens"`
+	DurationMS int64          `json:"duration_ms"`
+}
+
+// Result reports one spec run against one model
+type Result struct {
+	Spec      string         `json:"spec"`
+	Assistant string         `json:"assistant"`
+	Model     string         `json:"model,omitempty"` // Empty for the assistant's own model
+	Score     float64        `json:"score"`           // Weighted mean of the case scores
+	Threshold float64        `json:"threshold"`
+	Passed    bool           `json:"passed"`
+	Cases     []CaseResult   `json:"cases"`
+	Tokens    provider.Usage `json:"tokens"`
+}
+
+// Report is the outcome of an eval run
+type Report struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Results    []Result  `json:"results"`
+}
+
+// Failed reports whether any spec scored below its threshold on any model
+func (r *Report) Failed() bool {
+	for _, result := range r.Results {
+		if !result.Passed {
+			return true
+		}
+	}
+	return false
+}
+
+// Runner runs eval specs through a processor
+type Runner struct {
+	proc   processor.ProcessManager
+	parser *parser.Parser
+	clock  timing.Clock
+}
+
+// NewRunner creates a runner. Prompts are parsed with p, which may expand
+// templates, and run with proc.
+func NewRunner(proc processor.ProcessManager, p *parser.Parser, clock timing.Clock) *Runner {
+	if clock == nil {
+		clock = timing.New()
+	}
+	return &Runner{proc: proc, parser: p, clock: clock}
+}
+
+// Run runs every case of specs against each of their models, or against
+// models when given, one case at a time
+func (r *Runner) Run(ctx context.Context, specs []*Spec, models []string) *Report {
+	report := &Report{StartedAt: r.clock.Now(), Results: []Result{}}
+	for _, s := range specs {
+		specModels := models
+		if len(specModels) == 0 {
+			specModels = s.Models
+		}
+		if len(specModels) == 0 {
+			specModels = []string{""}
+		}
+		for _, model := range specModels {
+			if ctx.Err() != nil {
+				break
+			}
+			report.Results = append(report.Results, r.runSpec(ctx, s, model))
+		}
+	}
+	report.FinishedAt = r.clock.Now()
+	return report
+}
+
+// runSpec runs the cases of s against model and scores them
+func (r *Runner) runSpec(ctx context.Context, s *Spec, model string) Result {
+	result := Result{
+		Spec:      s.Name,
+		Assistant: s.Assistant,
+		Model:     model,
+		Threshold: s.threshold(),
+	}
+	var total, weights float64
+	for _, c := range s.Cases {
+		cr := r.runCase(ctx, s, c, model)
+		result.Cases = append(result.Cases, cr)
+		result.Tokens.PromptTokens += cr.Tokens.PromptTokens
+		result.Tokens.CompletionTokens += cr.Tokens.CompletionTokens
+		result.Tokens.TotalTokens += cr.Tokens.TotalTokens
+		total += cr.Score * c.Weight
+		weights += c.Weight
+	}
+	result.Score = total / weights
+	result.Passed = result.Score >= result.Threshold
+	logging.FromContext(ctx, logger).Info("eval scored",
+		"spec", s.Name,
+		"model", model,
+		"score", result.Score,
+		"passed", result.Passed)
+	return result
+}
+
+// runCase sends the prompt of c to model and checks the response. A case
+// whose prompt fails scores 0.
+func (r *Runner) runCase(ctx context.Context, s *Spec, c Case, model string) CaseResult {
+	result := CaseResult{Case: c.Name}
+	start := r.clock.Now()
+	defer func() { result.DurationMS = r.clock.Now().Sub(start).Milliseconds() }()
+
+	cmd, err := r.parser.ParseCommand("!" + s.Assistant + " " + strings.TrimSpace(c.Prompt))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	cmd.Model = model
+	if resolver, ok := r.proc.(processor.ReferenceResolver); ok {
+		resolver.AttachReferences(ctx, cmd, s.path, c.Document)
+	}
+
+	meter := &provider.UsageMeter{}
+	cmdCtx := provider.ContextWithUsageMeter(ctx, meter)
+	var response string
+	if p, ok := r.proc.(processor.ContextCommandProcessor); ok {
+		response, err = p.ProcessContext(cmdCtx, cmd)
+	} else {
+		response, err = r.proc.Process(cmd)
+	}
+	result.Tokens = meter.Usage()
+	if err != nil {
+		logging.FromContext(ctx, logger).Warn("eval case failed", "spec", s.Name, "case", c.Name, "error", err)
+		result.Error = fmt.Sprintf("command failed: %v", err)
+		return result
+	}
+	result.Response = response
+
+	passed := 0
+	for _, ch := range c.checks {
+		detail := ch.test(response)
+		result.Checks = append(result.Checks, CheckResult{Check: ch.name, Passed: detail == "", Detail: detail})
+		if detail == "" {
+			passed++
+		}
+	}
+	result.Score = float64(passed) / float64(len(c.checks))
+	return result
+}
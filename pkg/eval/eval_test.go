@@ -0,0 +1,185 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/process"
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+)
+
+// mockProcessor answers with the response set for a model, failing
+// commands whose text contains "fail"
+type mockProcessor struct {
+	responses map[string]string
+	commands  []*parser.Command
+}
+
+func (p *mockProcessor) Process(cmd *parser.Command) (string, error) {
+	p.commands = append(p.commands, cmd)
+	if strings.Contains(cmd.Text, "fail") {
+		return "", fmt.Errorf("provider error")
+	}
+	return p.responses[cmd.Model], nil
+}
+
+func (p *mockProcessor) ProcessContext(ctx context.Context, cmd *parser.Command) (string, error) {
+	provider.RecordUsage(ctx, provider.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15})
+	return p.Process(cmd)
+}
+
+func (p *mockProcessor) ProcessFile(path string) error                                { return nil }
+func (p *mockProcessor) ProcessDirectory(dir string) error                            { return nil }
+func (p *mockProcessor) HandleResponse(cmd *parser.Command, response string) error    { return nil }
+func (p *mockProcessor) UpdateFile(path string, responses []processor.Response) error { return nil }
+func (p *mockProcessor) GetProcessManager() process.Manager                           { return nil }
+func (p *mockProcessor) Close() error                                                 { return nil }
+
+func writeSpec(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestLoadSpec(t *testing.T) {
+	dir := t.TempDir()
+	writeSpec(t, dir, "names.json", `{"type": "object", "required": ["names"]}`)
+
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			spec: "assistant: Writer\ncases:\n  - prompt: list names\n    expect:\n      schema: names.json\n      keywords: [Ana]\n",
+		},
+		{name: "no cases", spec: "assistant: writer\n", wantErr: "no cases"},
+		{name: "no prompt", spec: "cases:\n  - expect: {keywords: [a]}\n", wantErr: "case 1: no prompt"},
+		{name: "nothing expected", spec: "cases:\n  - prompt: hi\n", wantErr: "nothing expected"},
+		{name: "bad regex", spec: "cases:\n  - prompt: hi\n    expect: {regex: ['(']}\n", wantErr: "invalid regex"},
+		{name: "missing schema", spec: "cases:\n  - prompt: hi\n    expect: {schema: gone.json}\n", wantErr: "failed to read schema"},
+		{name: "threshold", spec: "threshold: 2\ncases:\n  - prompt: hi\n    expect: {keywords: [a]}\n", wantErr: "threshold must be between 0 and 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := LoadSpec(writeSpec(t, dir, "spec.yaml", tt.spec))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadSpec() error = %v", err)
+			}
+			if s.Name != "spec" || s.Assistant != "writer" || s.threshold() != DefaultThreshold {
+				t.Errorf("Unexpected spec: %+v", s)
+			}
+			if len(s.Cases[0].checks) != 2 || s.Cases[0].Weight != 1 {
+				t.Errorf("Expected 2 checks of weight 1, got %+v", s.Cases[0])
+			}
+		})
+	}
+}
+
+func TestLoadSpecs(t *testing.T) {
+	dir := t.TempDir()
+	writeSpec(t, dir, "b.yaml", "cases:\n  - prompt: hi\n    expect: {keywords: [a]}\n")
+	writeSpec(t, dir, "a.yml", "name: first\ncases:\n  - prompt: hi\n    expect: {keywords: [a]}\n")
+
+	specs, err := LoadSpecs(dir)
+	if err != nil {
+		t.Fatalf("LoadSpecs() error = %v", err)
+	}
+	if len(specs) != 2 || specs[0].Name != "first" || specs[1].Name != "b" {
+		t.Errorf("Expected specs first and b, got %d", len(specs))
+	}
+
+	if specs, err := LoadSpecs(dir, "b"); err != nil || len(specs) != 1 {
+		t.Errorf("Expected only b, got %d specs: %v", len(specs), err)
+	}
+	if _, err := LoadSpecs(dir, "gone"); err == nil || !strings.Contains(err.Error(), "no eval spec named gone") {
+		t.Errorf("Expected an error for a missing spec, got %v", err)
+	}
+}
+
+func TestRunner(t *testing.T) {
+	dir := t.TempDir()
+	spec := `assistant: writer
+models: [gpt-4, gpt-3.5-turbo]
+threshold: 0.75
+cases:
+  - name: summary
+    prompt: "summarize #Roadmap#"
+    document: "## Roadmap\nShip it.\n"
+    weight: 3
+    expect:
+      keywords: [roadmap]
+      absent: [sorry]
+      regex: ['^\w']
+      max_words: 5
+  - name: broken
+    prompt: please fail
+    expect:
+      keywords: [anything]
+`
+	s, err := LoadSpec(writeSpec(t, dir, "summaries.yaml", spec))
+	if err != nil {
+		t.Fatalf("LoadSpec() error = %v", err)
+	}
+	proc := &mockProcessor{responses: map[string]string{
+		"gpt-4":         "The roadmap ships.",
+		"gpt-3.5-turbo": "Sorry, I cannot summarize the roadmap.",
+		"gpt-4o":        "Roadmap: ship it.",
+	}}
+
+	report := NewRunner(proc, parser.New(), nil).Run(context.Background(), []*Spec{s}, nil)
+	if len(report.Results) != 2 {
+		t.Fatalf("Expected a result per model, got %d", len(report.Results))
+	}
+	tests := []struct {
+		model  string
+		score  float64
+		passed bool
+	}{
+		{"gpt-4", 0.75, true},           // 3 of 4 weights from summary, broken scores 0
+		{"gpt-3.5-turbo", 0.375, false}, // summary passes 2 of 4 checks
+	}
+	for i, tt := range tests {
+		result := report.Results[i]
+		if result.Model != tt.model || result.Score != tt.score || result.Passed != tt.passed {
+			t.Errorf("Expected %s to score %v (passed %v), got %+v", tt.model, tt.score, tt.passed, result)
+		}
+		if result.Tokens.TotalTokens != 30 {
+			t.Errorf("Expected 30 tokens, got %d", result.Tokens.TotalTokens)
+		}
+		if result.Cases[1].Error == "" {
+			t.Errorf("Expected the broken case to fail, got %+v", result.Cases[1])
+		}
+	}
+	if !report.Failed() {
+		t.Error("Expected report to be failed")
+	}
+
+	cmd := proc.commands[0]
+	if cmd.Assistant != "writer" || len(cmd.References) != 1 || cmd.References[0] != "Roadmap" || cmd.Model != "gpt-4" {
+		t.Errorf("Unexpected command: %+v", cmd)
+	}
+
+	// Models given to the run replace those of the spec
+	report = NewRunner(proc, parser.New(), nil).Run(context.Background(), []*Spec{s}, []string{"gpt-4o"})
+	if len(report.Results) != 1 || report.Results[0].Model != "gpt-4o" || report.Results[0].Score != 0.75 {
+		t.Errorf("Expected one result for gpt-4o, got %+v", report.Results)
+	}
+}
@@ -0,0 +1,213 @@
+// Package eval scores assistants against eval specs: prompts with the
+// properties their responses are expected to have, run against one or
+// more models, so that changes to an assistant's prompt.md can be checked
+// before they are relied on.
+package eval
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/butter-bot-machines/skylark/pkg/jsonschema"
+)
+
+// DefaultThreshold is the score a model must reach on a spec unless the
+// spec sets its own
+const DefaultThreshold = 1.0
+
+// Spec is an eval spec, read from .skai/evals/<name>.yaml
+type Spec struct {
+	Name      string   `yaml:"name"`      // Defaults to the file name
+	Assistant string   `yaml:"assistant"` // Assistant the prompts are sent to (default: default)
+	Models    []string `yaml:"models"`    // Models to compare, as in front matter (empty = the assistant's model)
+	Threshold *float64 `yaml:"threshold"` // Lowest passing score, from 0 to 1 (default 1)
+	Cases     []Case   `yaml:"cases"`
+
+	path string // File the spec was read from
+}
+
+// Case is a prompt and what its response is expected to be like
+type Case struct {
+	Name     string  `yaml:"name"`
+	Prompt   string  `yaml:"prompt"`   // Command text, without the leading !assistant
+	Document string  `yaml:"document"` // Markdown the prompt's section references are resolved in
+	Weight   float64 `yaml:"weight"`   // Share of the spec's score (default 1)
+	Expect   Expect  `yaml:"expect"`
+
+	checks []check
+}
+
+// Expect lists the properties of a response. Each one set is a check that
+// passes or fails; a case scores the share of its checks that pass.
+type Expect struct {
+	Regex    []string `yaml:"regex"`     // Patterns the response must match
+	NotRegex []string `yaml:"not_regex"` // Patterns the response must not match
+	Keywords []string `yaml:"keywords"`  // Words the response must contain, in any case
+	Absent   []string `yaml:"absent"`    // Words the response must not contain, in any case
+	Schema   string   `yaml:"schema"`    // JSON schema file, relative to the spec, the response must conform to
+	MinWords int      `yaml:"min_words"`
+	MaxWords int      `yaml:"max_words"`
+}
+
+// LoadSpec reads and validates the spec at path
+func LoadSpec(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read eval spec: %w", err)
+	}
+
+	s := &Spec{path: path}
+	if err := yaml.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("invalid eval spec %s: %w", path, err)
+	}
+	if s.Name == "" {
+		s.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if err := s.compile(); err != nil {
+		return nil, fmt.Errorf("invalid eval spec %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// LoadSpecs reads the specs in dir, in order of their file names. With
+// names, only the specs of those names are read.
+func LoadSpecs(dir string, names ...string) ([]*Spec, error) {
+	var paths []string
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+	sort.Strings(paths)
+
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		wanted[name] = true
+	}
+	var specs []*Spec
+	for _, path := range paths {
+		s, err := LoadSpec(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(wanted) > 0 && !wanted[s.Name] {
+			continue
+		}
+		delete(wanted, s.Name)
+		specs = append(specs, s)
+	}
+	if len(wanted) > 0 {
+		missing := make([]string, 0, len(wanted))
+		for name := range wanted {
+			missing = append(missing, name)
+		}
+		sort.Strings(missing)
+		return nil, fmt.Errorf("no eval spec named %s in %s", strings.Join(missing, ", "), dir)
+	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("no eval specs in %s", dir)
+	}
+	return specs, nil
+}
+
+// threshold returns the lowest passing score
+func (s *Spec) threshold() float64 {
+	if s.Threshold == nil {
+		return DefaultThreshold
+	}
+	return *s.Threshold
+}
+
+// compile validates the spec and prepares the checks of its cases
+func (s *Spec) compile() error {
+	s.Assistant = strings.ToLower(strings.TrimSpace(s.Assistant))
+	if s.Assistant == "" {
+		s.Assistant = "default"
+	}
+	if t := s.threshold(); t < 0 || t > 1 {
+		return fmt.Errorf("threshold must be between 0 and 1, got %v", t)
+	}
+	if len(s.Cases) == 0 {
+		return fmt.Errorf("no cases")
+	}
+	for i := range s.Cases {
+		c := &s.Cases[i]
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("case %d", i+1)
+		}
+		if strings.TrimSpace(c.Prompt) == "" {
+			return fmt.Errorf("%s: no prompt", c.Name)
+		}
+		if c.Weight < 0 {
+			return fmt.Errorf("%s: weight must not be negative", c.Name)
+		}
+		if c.Weight == 0 {
+			c.Weight = 1
+		}
+		checks, err := c.Expect.compile(filepath.Dir(s.path))
+		if err != nil {
+			return fmt.Errorf("%s: %w", c.Name, err)
+		}
+		if len(checks) == 0 {
+			return fmt.Errorf("%s: nothing expected", c.Name)
+		}
+		c.checks = checks
+	}
+	return nil
+}
+
+// compile returns a check for each expected property. Schema files are
+// read relative to dir.
+func (e Expect) compile(dir string) ([]check, error) {
+	var checks []check
+	for _, pattern := range e.Regex {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex %q: %w", pattern, err)
+		}
+		checks = append(checks, matches(re, true))
+	}
+	for _, pattern := range e.NotRegex {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid not_regex %q: %w", pattern, err)
+		}
+		checks = append(checks, matches(re, false))
+	}
+	for _, keyword := range e.Keywords {
+		checks = append(checks, contains(keyword, true))
+	}
+	for _, keyword := range e.Absent {
+		checks = append(checks, contains(keyword, false))
+	}
+	if e.Schema != "" {
+		path := e.Schema
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read schema: %w", err)
+		}
+		schema, err := jsonschema.Parse(data)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, conforms(e.Schema, schema))
+	}
+	if e.MinWords < 0 || e.MaxWords < 0 {
+		return nil, fmt.Errorf("word limits must not be negative")
+	}
+	if e.MinWords > 0 || e.MaxWords > 0 {
+		checks = append(checks, words(e.MinWords, e.MaxWords))
+	}
+	return checks, nil
+}
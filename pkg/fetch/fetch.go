@@ -0,0 +1,166 @@
+// Package fetch retrieves packages of files, such as shared assistants and
+// tools, from local directories or git repositories.
+package fetch
+
+import (
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Package is a fetched package. Close removes any temporary copy.
+type Package struct {
+	Dir    string // Local directory holding the package
+	Name   string // The directory or repository name
+	Commit string // Commit checked out, for git repositories
+
+	cleanup func()
+}
+
+// Fetch returns the package at source, a directory or git URL. version
+// selects a tag, branch or commit of a git repository; empty means its
+// default branch. Repositories are cloned into a temporary directory.
+func Fetch(source, version string) (*Package, error) {
+	if info, err := os.Stat(source); err == nil {
+		if !info.IsDir() {
+			return nil, fmt.Errorf("package %s is not a directory", source)
+		}
+		if version != "" {
+			return nil, fmt.Errorf("package %s is a directory; only git repositories have versions", source)
+		}
+		abs, err := filepath.Abs(source)
+		if err != nil {
+			return nil, err
+		}
+		return &Package{Dir: abs, Name: filepath.Base(abs), cleanup: func() {}}, nil
+	}
+	if !IsGitURL(source) {
+		return nil, fmt.Errorf("package not found: %s", source)
+	}
+
+	tmp, err := os.MkdirTemp("", "skai-package-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	p := &Package{
+		Dir:     filepath.Join(tmp, "package"),
+		Name:    repositoryName(source),
+		cleanup: func() { os.RemoveAll(tmp) },
+	}
+
+	// Shallow clones cannot check out arbitrary commits
+	clone := []string{"clone", "--quiet", source, p.Dir}
+	if version == "" {
+		clone = []string{"clone", "--quiet", "--depth", "1", source, p.Dir}
+	}
+	if _, err := git("", clone...); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("failed to clone %s: %w", source, err)
+	}
+	if version != "" {
+		if _, err := git(p.Dir, "checkout", "--quiet", version); err != nil {
+			p.Close()
+			return nil, fmt.Errorf("failed to check out %s of %s: %w", version, source, err)
+		}
+	}
+	commit, err := git(p.Dir, "rev-parse", "HEAD")
+	if err != nil {
+		p.Close()
+		return nil, fmt.Errorf("failed to resolve commit of %s: %w", source, err)
+	}
+	p.Commit = commit
+	return p, nil
+}
+
+// Close removes the temporary copy of a cloned package
+func (p *Package) Close() error {
+	p.cleanup()
+	return nil
+}
+
+// CopyTo copies the files of the package to dst, as CopyDir does
+func (p *Package) CopyTo(dst string, skip func(name string) bool) error {
+	return CopyDir(p.Dir, dst, skip)
+}
+
+// CopyDir copies the regular files and directories under src to dst,
+// leaving out the top-level entries skip matches (optional) and git
+// metadata
+func CopyDir(src, dst string, skip func(name string) bool) error {
+	return filepath.WalkDir(src, func(file string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, file)
+		if err != nil {
+			return err
+		}
+		if rel != "." && filepath.Dir(rel) == "." && (rel == ".git" || (skip != nil && skip(rel))) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !d.Type().IsRegular() {
+			return fmt.Errorf("cannot copy %s: not a regular file", rel)
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, info.Mode().Perm())
+	})
+}
+
+// IsGitURL reports whether source names a git repository rather than a
+// local path
+func IsGitURL(source string) bool {
+	for _, prefix := range []string{"https://", "http://", "ssh://", "git://", "file://", "git@"} {
+		if strings.HasPrefix(source, prefix) {
+			return true
+		}
+	}
+	return strings.HasSuffix(source, ".git")
+}
+
+// SplitVersion splits a `source@version` spec. An @ before the last path
+// separator, as in git@host:repo, is part of the source.
+func SplitVersion(spec string) (source, version string) {
+	at := strings.LastIndex(spec, "@")
+	if at < 0 || at < strings.LastIndexAny(spec, `/\:`) {
+		return spec, ""
+	}
+	return spec[:at], spec[at+1:]
+}
+
+// repositoryName returns the name of the repository at url, without .git
+func repositoryName(url string) string {
+	name := path.Base(strings.TrimRight(filepath.ToSlash(url), "/"))
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		name = name[i+1:] // git@host:repo.git
+	}
+	return strings.TrimSuffix(name, ".git")
+}
+
+// git runs git in dir, returning its trimmed output
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", strings.TrimSpace(string(output)), err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
@@ -0,0 +1,37 @@
+package fetch
+
+import "testing"
+
+func TestSplitVersion(t *testing.T) {
+	tests := []struct {
+		spec    string
+		source  string
+		version string
+	}{
+		{"https://github.com/example/echo", "https://github.com/example/echo", ""},
+		{"https://github.com/example/echo@v1.2.0", "https://github.com/example/echo", "v1.2.0"},
+		{"git@github.com:example/echo.git", "git@github.com:example/echo.git", ""},
+		{"git@github.com:example/echo.git@3f2c1d0", "git@github.com:example/echo.git", "3f2c1d0"},
+		{"../tools/echo", "../tools/echo", ""},
+	}
+	for _, tt := range tests {
+		source, version := SplitVersion(tt.spec)
+		if source != tt.source || version != tt.version {
+			t.Errorf("Expected %q and %q for %q, got %q and %q", tt.source, tt.version, tt.spec, source, version)
+		}
+	}
+}
+
+func TestRepositoryName(t *testing.T) {
+	tests := map[string]string{
+		"https://github.com/example/echo":      "echo",
+		"https://github.com/example/echo.git/": "echo",
+		"git@github.com:echo.git":              "echo",
+		"file:///srv/git/echo.git":             "echo",
+	}
+	for url, want := range tests {
+		if got := repositoryName(url); got != want {
+			t.Errorf("Expected %q for %s, got %q", want, url, got)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+// Package filter post-processes assistant responses before they are
+// inserted into documents: removing pleasantries, limiting length,
+// adjusting headings or piping the text through a tool.
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+)
+
+// Filter transforms a response
+type Filter interface {
+	Apply(ctx context.Context, response string) (string, error)
+}
+
+// Func adapts a function to the Filter interface
+type Func func(ctx context.Context, response string) (string, error)
+
+// Apply implements Filter
+func (f Func) Apply(ctx context.Context, response string) (string, error) {
+	return f(ctx, response)
+}
+
+// ToolRunner runs a tool with JSON input, as the assistant manager does
+type ToolRunner interface {
+	RunTool(ctx context.Context, name string, input string) (string, error)
+}
+
+// Pipeline runs filters in order, each on the output of the previous one
+type Pipeline []Filter
+
+// Apply implements Filter
+func (p Pipeline) Apply(ctx context.Context, response string) (string, error) {
+	for _, f := range p {
+		var err error
+		if response, err = f.Apply(ctx, response); err != nil {
+			return "", err
+		}
+	}
+	return response, nil
+}
+
+// New builds the pipeline cfgs declare. Tool filters run through tools,
+// which may be nil when no tool filter is declared.
+func New(cfgs []config.FilterConfig, tools ToolRunner) (Pipeline, error) {
+	pipeline := make(Pipeline, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		f, err := newFilter(cfg, tools)
+		if err != nil {
+			return nil, err
+		}
+		pipeline = append(pipeline, f)
+	}
+	return pipeline, nil
+}
+
+// newFilter builds a single filter
+func newFilter(cfg config.FilterConfig, tools ToolRunner) (Filter, error) {
+	switch cfg.Type {
+	case config.FilterStripPreamble:
+		return Func(func(ctx context.Context, response string) (string, error) {
+			return StripPreamble(response), nil
+		}), nil
+	case config.FilterMaxLength:
+		if cfg.Max <= 0 {
+			return nil, fmt.Errorf("max_length filter needs a positive max")
+		}
+		return Func(func(ctx context.Context, response string) (string, error) {
+			return Truncate(response, cfg.Max), nil
+		}), nil
+	case config.FilterHeadings:
+		if cfg.Level < 1 || cfg.Level > 6 {
+			return nil, fmt.Errorf("headings filter needs a level between 1 and 6, got %d", cfg.Level)
+		}
+		return Func(func(ctx context.Context, response string) (string, error) {
+			return ShiftHeadings(response, cfg.Level), nil
+		}), nil
+	case config.FilterTool:
+		if cfg.Tool == "" {
+			return nil, fmt.Errorf("tool filter needs a tool name")
+		}
+		if tools == nil {
+			return nil, fmt.Errorf("tool filter %s: no tools available", cfg.Tool)
+		}
+		return &toolFilter{name: cfg.Tool, tools: tools}, nil
+	default:
+		return nil, fmt.Errorf("unknown filter type %q", cfg.Type)
+	}
+}
+
+var (
+	// openingPatterns match whole lines that only acknowledge the request
+	openingPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)^(sure|certainly|of course|absolutely|okay|ok|great)[!.,]*(\s+(i'd|i would|i'll|i will|i'm|i am)\s+(be )?(happy|glad) to help[^\n]*)?(\s+here(\s+is|'s|\s+are)\b[^\n]*:)?$`),
+		regexp.MustCompile(`(?i)^here(\s+is|'s|\s+are)\b[^\n]*:$`),
+		regexp.MustCompile(`(?i)^(i apologi[sz]e|my apologies|apologies|sorry)\s+for\s+(the|any)\s+(confusion|oversight|error|mistake|misunderstanding)\b[^\n]*[.!]$`),
+	}
+
+	// closingPatterns match whole lines offering further help
+	closingPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)^(let me know if|i hope (this|that) helps|hope (this|that) helps|feel free to (ask|reach out|let me know)|is there anything else)\b[^\n]*$`),
+	}
+)
+
+// StripPreamble removes lines at the start of a response that only
+// acknowledge the request or apologize, such as "Sure! Here is the
+// summary:", and lines at the end that offer further help. A response
+// made only of such lines is returned unchanged.
+func StripPreamble(response string) string {
+	lines := strings.Split(strings.TrimSpace(response), "\n")
+	start, end := 0, len(lines)
+	for start < end && (strings.TrimSpace(lines[start]) == "" || matchesAny(openingPatterns, lines[start])) {
+		start++
+	}
+	for end > start && (strings.TrimSpace(lines[end-1]) == "" || matchesAny(closingPatterns, lines[end-1])) {
+		end--
+	}
+	if start == end {
+		return response
+	}
+	return strings.Join(lines[start:end], "\n")
+}
+
+// matchesAny reports whether the trimmed line matches one of patterns
+func matchesAny(patterns []*regexp.Regexp, line string) bool {
+	line = strings.TrimSpace(line)
+	for _, p := range patterns {
+		if p.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// ellipsis ends truncated responses
+const ellipsis = "…"
+
+// Truncate shortens a response longer than max characters to at most
+// max, cutting at a word boundary where one is close and ending in an
+// ellipsis. A code block left open by the cut is closed.
+func Truncate(response string, max int) string {
+	runes := []rune(response)
+	if len(runes) <= max {
+		return response
+	}
+	cut := string(runes[:max-1])
+	if i := strings.LastIndexFunc(cut, unicode.IsSpace); i > len(cut)/2 {
+		cut = cut[:i]
+	}
+	cut = strings.TrimRightFunc(cut, unicode.IsSpace) + ellipsis
+
+	fences := 0
+	for _, line := range strings.Split(cut, "\n") {
+		if isFence(line) {
+			fences++
+		}
+	}
+	if fences%2 == 1 {
+		cut += "\n```"
+	}
+	return cut
+}
+
+// headingPattern matches ATX headings
+var headingPattern = regexp.MustCompile(`^(#{1,6})(\s|$)`)
+
+// ShiftHeadings moves every heading by the same number of levels so the
+// highest one is at level, keeping levels between 1 and 6. Lines in code
+// blocks are left alone.
+func ShiftHeadings(response string, level int) string {
+	lines := strings.Split(response, "\n")
+
+	top := 0
+	eachHeading(lines, func(i, depth int) {
+		if top == 0 || depth < top {
+			top = depth
+		}
+	})
+	if top == 0 || top == level {
+		return response
+	}
+
+	shift := level - top
+	eachHeading(lines, func(i, depth int) {
+		target := depth + shift
+		if target < 1 {
+			target = 1
+		} else if target > 6 {
+			target = 6
+		}
+		lines[i] = strings.Repeat("#", target) + lines[i][depth:]
+	})
+	return strings.Join(lines, "\n")
+}
+
+// eachHeading calls fn with the index and level of each heading outside
+// code blocks
+func eachHeading(lines []string, fn func(i, depth int)) {
+	inCode := false
+	for i, line := range lines {
+		if isFence(line) {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			continue
+		}
+		if m := headingPattern.FindStringSubmatch(line); m != nil {
+			fn(i, len(m[1]))
+		}
+	}
+}
+
+// isFence reports whether line opens or closes a code block
+func isFence(line string) bool {
+	line = strings.TrimSpace(line)
+	return strings.HasPrefix(line, "```") || strings.HasPrefix(line, "~~~")
+}
+
+// toolFilter pipes responses through a tool. The tool receives
+// {"response": "..."} and replies with either the same shape or the new
+// text as is.
+type toolFilter struct {
+	name  string
+	tools ToolRunner
+}
+
+// Apply implements Filter
+func (f *toolFilter) Apply(ctx context.Context, response string) (string, error) {
+	input, err := json.Marshal(map[string]string{"response": response})
+	if err != nil {
+		return "", fmt.Errorf("tool filter %s: failed to encode input: %w", f.name, err)
+	}
+	output, err := f.tools.RunTool(ctx, f.name, string(input))
+	if err != nil {
+		return "", fmt.Errorf("tool filter %s: %w", f.name, err)
+	}
+
+	var result struct {
+		Response *string `json:"response"`
+	}
+	if err := json.Unmarshal([]byte(output), &result); err == nil && result.Response != nil {
+		output = *result.Response
+	}
+	if strings.TrimSpace(output) == "" {
+		return "", fmt.Errorf("tool filter %s: empty response", f.name)
+	}
+	return strings.TrimSpace(output), nil
+}
@@ -0,0 +1,181 @@
+package filter
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+)
+
+func TestStripPreamble(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     string
+	}{
+		{
+			name:     "opening and closing",
+			response: "Sure! Here is the summary:\n\nThe report covers Q3.\n\nLet me know if you need anything else!",
+			want:     "The report covers Q3.",
+		},
+		{
+			name:     "apology",
+			response: "I apologize for the confusion.\nCertainly, I'd be happy to help.\n\n# Plan\n\n1. Draft",
+			want:     "# Plan\n\n1. Draft",
+		},
+		{
+			name:     "answer starting with sure",
+			response: "Sure, the capital of France is Paris.",
+			want:     "Sure, the capital of France is Paris.",
+		},
+		{
+			name:     "refusal kept",
+			response: "I'm sorry, but I can't access that file.",
+			want:     "I'm sorry, but I can't access that file.",
+		},
+		{
+			name:     "only a preamble",
+			response: "Of course!",
+			want:     "Of course!",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripPreamble(tt.response); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		max      int
+		want     string
+	}{
+		{name: "short", response: "Short answer", max: 20, want: "Short answer"},
+		{name: "word boundary", response: "The quick brown fox jumps", max: 18, want: "The quick brown…"},
+		{name: "multibyte", response: "ééééé", max: 3, want: "éé…"},
+		{name: "open code block", response: "Run:\n```sh\nmake build && make test\n```", max: 20, want: "Run:\n```sh\nmake…\n```"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Truncate(tt.response, tt.max)
+			if got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestShiftHeadings(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		level    int
+		want     string
+	}{
+		{
+			name:     "demote",
+			response: "# Title\n\nText\n\n## Part\n\n```sh\n# comment\n```",
+			level:    3,
+			want:     "### Title\n\nText\n\n#### Part\n\n```sh\n# comment\n```",
+		},
+		{
+			name:     "promote",
+			response: "### Part\n#### Detail",
+			level:    1,
+			want:     "# Part\n## Detail",
+		},
+		{
+			name:     "clamped",
+			response: "# A\n###### B",
+			level:    2,
+			want:     "## A\n###### B",
+		},
+		{
+			name:     "not a heading",
+			response: "#hashtag and text",
+			level:    2,
+			want:     "#hashtag and text",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ShiftHeadings(tt.response, tt.level); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// fakeTools answers tool filters with a fixed output
+type fakeTools struct {
+	output string
+	err    error
+	input  string
+}
+
+func (f *fakeTools) RunTool(ctx context.Context, name string, input string) (string, error) {
+	f.input = input
+	return f.output, f.err
+}
+
+func TestPipeline(t *testing.T) {
+	tools := &fakeTools{output: `{"response": "# Fixed\n\nBody"}`}
+	pipeline, err := New([]config.FilterConfig{
+		{Type: config.FilterStripPreamble},
+		{Type: config.FilterTool, Tool: "spellcheck"},
+		{Type: config.FilterHeadings, Level: 2},
+	}, tools)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	got, err := pipeline.Apply(context.Background(), "Sure!\n\n# Fixd\n\nBody")
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if want := "## Fixed\n\nBody"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if tools.input != `{"response":"# Fixd\n\nBody"}` {
+		t.Errorf("Expected the stripped response as tool input, got %s", tools.input)
+	}
+
+	// Plain output replaces the response as is
+	tools.output = "plain text\n"
+	if got, _ := pipeline.Apply(context.Background(), "text"); got != "plain text" {
+		t.Errorf("Expected the tool output, got %q", got)
+	}
+
+	tools.err = errors.New("tool crashed")
+	if _, err := pipeline.Apply(context.Background(), "text"); err == nil || !strings.Contains(err.Error(), "tool filter spellcheck") {
+		t.Errorf("Expected the tool's error, got %v", err)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	tests := []config.FilterConfig{
+		{Type: "uppercase"},
+		{Type: config.FilterMaxLength},
+		{Type: config.FilterHeadings, Level: 0},
+		{Type: config.FilterTool},
+	}
+	for _, cfg := range tests {
+		if _, err := New([]config.FilterConfig{cfg}, &fakeTools{}); err == nil {
+			t.Errorf("Expected an error for %+v", cfg)
+		}
+	}
+
+	if _, err := New([]config.FilterConfig{{Type: config.FilterTool, Tool: "spellcheck"}}, nil); err == nil {
+		t.Error("Expected an error for a tool filter without tools")
+	}
+}
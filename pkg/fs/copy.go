@@ -0,0 +1,40 @@
+package fs
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+)
+
+// Copy copies the directory dir of src, with everything below it, to the
+// same path in dst. Existing files in dst are replaced.
+func Copy(dst WriteFS, src fs.FS, dir string) error {
+	return fs.WalkDir(src, dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if name == "." {
+				return nil
+			}
+			return dst.MkdirAll(name, info.Mode().Perm())
+		}
+		if !d.Type().IsRegular() {
+			return fmt.Errorf("cannot copy %s: not a regular file", name)
+		}
+		data, err := fs.ReadFile(src, name)
+		if err != nil {
+			return err
+		}
+		if parent := path.Dir(name); parent != "." {
+			if err := dst.MkdirAll(parent, 0755); err != nil {
+				return err
+			}
+		}
+		return dst.WriteFile(name, data, info.Mode().Perm())
+	})
+}
@@ -0,0 +1,53 @@
+package fs_test
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	skfs "github.com/butter-bot-machines/skylark/pkg/fs"
+	"github.com/butter-bot-machines/skylark/pkg/fs/memory"
+)
+
+func TestCopy(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "docs", "notes"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	files := map[string]string{
+		"readme.md":         "readme",
+		"docs/notes/day.md": "day",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, filepath.FromSlash(name)), []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	dst := memory.New()
+	if err := skfs.Copy(dst, os.DirFS(root), "."); err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+	for name, content := range files {
+		data, err := fs.ReadFile(dst, name)
+		if err != nil || string(data) != content {
+			t.Errorf("Expected %s to be %q, got %q (%v)", name, content, data, err)
+		}
+		if info, err := fs.Stat(dst, name); err != nil || info.Mode().Perm() != 0600 {
+			t.Errorf("Expected %s to keep its mode, got %v (%v)", name, info, err)
+		}
+	}
+
+	// Copying a subdirectory keeps its path
+	partial := memory.New()
+	if err := skfs.Copy(partial, dst, "docs"); err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+	if _, err := fs.Stat(partial, "docs/notes/day.md"); err != nil {
+		t.Errorf("Expected docs/notes/day.md to be copied: %v", err)
+	}
+	if _, err := fs.Stat(partial, "readme.md"); err == nil {
+		t.Error("Expected readme.md not to be copied")
+	}
+}
@@ -0,0 +1,171 @@
+package guarded
+
+import (
+	"io/fs"
+
+	"github.com/butter-bot-machines/skylark/pkg/fs/osfs"
+	"github.com/butter-bot-machines/skylark/pkg/security"
+	"github.com/butter-bot-machines/skylark/pkg/security/types"
+)
+
+// FS implements fs.FS over an OS file system, checking every access
+// against a security.FileGuard. Denied accesses are audited by the guard;
+// successful modifications are audited by FS.
+type FS struct {
+	base     *osfs.FS
+	guard    security.FileGuard
+	auditLog security.AuditLogger
+}
+
+// New creates a file system guarding base. auditLog may be nil.
+func New(base *osfs.FS, guard security.FileGuard, auditLog security.AuditLogger) *FS {
+	return &FS{base: base, guard: guard, auditLog: auditLog}
+}
+
+// checkRead verifies read access to name
+func (f *FS) checkRead(op, name string) error {
+	p, err := f.base.Path(op, name)
+	if err != nil {
+		return err
+	}
+	if err := f.guard.CheckRead(p); err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return nil
+}
+
+// checkWrite verifies write access to name for size bytes and returns its
+// OS path
+func (f *FS) checkWrite(op, name string, size int64) (string, error) {
+	p, err := f.base.Path(op, name)
+	if err != nil {
+		return "", err
+	}
+	if err := f.guard.CheckWriteSize(p, size); err != nil {
+		return "", &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return p, nil
+}
+
+// Open implements fs.FS
+func (f *FS) Open(name string) (fs.File, error) {
+	if err := f.checkRead("open", name); err != nil {
+		return nil, err
+	}
+	return f.base.Open(name)
+}
+
+// Stat implements fs.StatFS
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	if err := f.checkRead("stat", name); err != nil {
+		return nil, err
+	}
+	return f.base.Stat(name)
+}
+
+// ReadFile implements fs.ReadFileFS
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	if err := f.checkRead("read", name); err != nil {
+		return nil, err
+	}
+	return f.base.ReadFile(name)
+}
+
+// ReadDir implements fs.ReadDirFS
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if err := f.checkRead("readdir", name); err != nil {
+		return nil, err
+	}
+	return f.base.ReadDir(name)
+}
+
+// Glob implements fs.GlobFS. Matches are listed without checks; reading
+// them is checked.
+func (f *FS) Glob(pattern string) ([]string, error) {
+	return f.base.Glob(pattern)
+}
+
+// Write implements WriteFS
+func (f *FS) Write(name string, data []byte) error {
+	return f.WriteFile(name, data, 0666)
+}
+
+// WriteFile implements WriteFS
+func (f *FS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	p, err := f.checkWrite("write", name, int64(len(data)))
+	if err != nil {
+		return err
+	}
+	if err := f.base.WriteFile(name, data, perm); err != nil {
+		return err
+	}
+	f.logAccess("write", p)
+	return nil
+}
+
+// MkdirAll implements WriteFS
+func (f *FS) MkdirAll(path string, perm fs.FileMode) error {
+	if _, err := f.checkWrite("mkdir", path, 0); err != nil {
+		return err
+	}
+	return f.base.MkdirAll(path, perm)
+}
+
+// Remove implements WriteFS
+func (f *FS) Remove(name string) error {
+	p, err := f.checkWrite("remove", name, 0)
+	if err != nil {
+		return err
+	}
+	if err := f.base.Remove(name); err != nil {
+		return err
+	}
+	f.logAccess("remove", p)
+	return nil
+}
+
+// RemoveAll implements WriteFS
+func (f *FS) RemoveAll(path string) error {
+	p, err := f.checkWrite("removeall", path, 0)
+	if err != nil {
+		return err
+	}
+	if err := f.base.RemoveAll(path); err != nil {
+		return err
+	}
+	f.logAccess("remove", p)
+	return nil
+}
+
+// Rename implements WriteFS
+func (f *FS) Rename(oldpath, newpath string) error {
+	if _, err := f.checkWrite("rename", oldpath, 0); err != nil {
+		return err
+	}
+	to, err := f.checkWrite("rename", newpath, 0)
+	if err != nil {
+		return err
+	}
+	if err := f.base.Rename(oldpath, newpath); err != nil {
+		return err
+	}
+	f.logAccess("rename", to)
+	return nil
+}
+
+// logAccess records a modification of path
+func (f *FS) logAccess(op, path string) {
+	if f.auditLog == nil {
+		return
+	}
+	f.auditLog.Log(
+		types.EventFileAccess,
+		types.SeverityInfo,
+		"guarded_fs",
+		op+" "+path,
+		map[string]interface{}{
+			"path": path,
+			"op":   op,
+		},
+	)
+}
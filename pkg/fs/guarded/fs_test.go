@@ -0,0 +1,130 @@
+package guarded
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/fs/osfs"
+	"github.com/butter-bot-machines/skylark/pkg/security"
+	secconcrete "github.com/butter-bot-machines/skylark/pkg/security/concrete"
+	"github.com/butter-bot-machines/skylark/pkg/security/types"
+)
+
+// recordingLog records the types of logged events
+type recordingLog struct {
+	security.AuditLogger
+	events []types.EventType
+}
+
+func (r *recordingLog) Log(t types.EventType, _ types.Severity, _, _ string, _ map[string]interface{}) error {
+	r.events = append(r.events, t)
+	return nil
+}
+
+func newTestFS(t *testing.T) (*FS, string, *recordingLog) {
+	t.Helper()
+	root := t.TempDir()
+	for _, dir := range []string{"docs", "private"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "docs", "notes.md"), []byte("notes"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	log := &recordingLog{}
+	guard, err := secconcrete.NewFileGuard(&config.Config{
+		Security: types.SecurityConfig{
+			FilePermissions: types.FilePermissionsConfig{
+				AllowedPaths: []string{root},
+				BlockedPaths: []string{filepath.Join(root, "private")},
+				MaxFileSize:  16,
+			},
+		},
+	}, log)
+	if err != nil {
+		t.Fatalf("Failed to create file guard: %v", err)
+	}
+	return New(osfs.New(root, osfs.Options{}), guard, log), root, log
+}
+
+func TestFS_Read(t *testing.T) {
+	fsys, _, _ := newTestFS(t)
+
+	data, err := fs.ReadFile(fsys, "docs/notes.md")
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if string(data) != "notes" {
+		t.Errorf("Expected %q, got %q", "notes", data)
+	}
+
+	f, err := fsys.Open("docs/notes.md")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+	if data, _ := io.ReadAll(f); string(data) != "notes" {
+		t.Errorf("Expected %q, got %q", "notes", data)
+	}
+
+	if _, err := fsys.Open("../outside.md"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("Expected fs.ErrInvalid, got %v", err)
+	}
+}
+
+func TestFS_Write(t *testing.T) {
+	fsys, root, log := newTestFS(t)
+
+	if err := fsys.WriteFile("docs/new.md", []byte("new"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "docs", "new.md")); string(data) != "new" {
+		t.Errorf("Expected %q, got %q", "new", data)
+	}
+	if len(log.events) != 1 || log.events[0] != types.EventFileAccess {
+		t.Errorf("Expected a file access event, got %v", log.events)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		data string
+		want error
+	}{
+		{name: "blocked", path: "private/secret.md", data: "x", want: secconcrete.ErrBlockedPath},
+		{name: "too large", path: "docs/big.md", data: strings.Repeat("x", 17), want: secconcrete.ErrFileTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := fsys.WriteFile(tt.path, []byte(tt.data), 0644)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+			if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(tt.path))); !os.IsNotExist(err) {
+				t.Errorf("Expected %s not to be written", tt.path)
+			}
+		})
+	}
+	if got := log.events[len(log.events)-1]; got != types.EventAccessDenied {
+		t.Errorf("Expected denied writes to be audited, got %v", got)
+	}
+}
+
+func TestFS_Symlink(t *testing.T) {
+	fsys, root, _ := newTestFS(t)
+	if err := os.Symlink(filepath.Join(root, "docs", "notes.md"), filepath.Join(root, "docs", "link.md")); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+
+	if _, err := fs.ReadFile(fsys, "docs/link.md"); !errors.Is(err, secconcrete.ErrSymlinkDenied) {
+		t.Errorf("Expected ErrSymlinkDenied, got %v", err)
+	}
+}
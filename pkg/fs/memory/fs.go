@@ -35,9 +35,15 @@ func (f *FS) Open(name string) (fs.File, error) {
 	f.mu.RLock()
 	defer f.mu.RUnlock()
 
-	// Check if it's a directory
-	if d, ok := f.dirs[name]; ok {
-		return d.clone(), nil
+	// Check if it's a directory; its entries are read when it is opened
+	if d, ok := f.dir(name); ok {
+		handle := d.clone()
+		entries, err := f.readDir(name)
+		if err != nil {
+			return nil, err
+		}
+		handle.entries = entries
+		return handle, nil
 	}
 
 	// Check if it's a file
@@ -48,6 +54,15 @@ func (f *FS) Open(name string) (fs.File, error) {
 	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
 }
 
+// dir returns the directory name, including the root directory "."
+func (f *FS) dir(name string) (*dir, bool) {
+	if name == "." {
+		return &dir{name: ".", mode: fs.ModeDir | 0777}, true
+	}
+	d, ok := f.dirs[name]
+	return d, ok
+}
+
 // Stat implements fs.StatFS
 func (f *FS) Stat(name string) (fs.FileInfo, error) {
 	if !fs.ValidPath(name) {
@@ -58,7 +73,7 @@ func (f *FS) Stat(name string) (fs.FileInfo, error) {
 	defer f.mu.RUnlock()
 
 	// Check if it's a directory
-	if d, ok := f.dirs[name]; ok {
+	if d, ok := f.dir(name); ok {
 		return d, nil
 	}
 
@@ -78,7 +93,11 @@ func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
 
 	f.mu.RLock()
 	defer f.mu.RUnlock()
+	return f.readDir(name)
+}
 
+// readDir lists the directory name, sorted by name. f.mu must be held.
+func (f *FS) readDir(name string) ([]fs.DirEntry, error) {
 	// Check if it's a file
 	if _, ok := f.files[name]; ok {
 		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
@@ -90,7 +109,7 @@ func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
 	}
 
 	// Collect entries
-	var entries []fs.DirEntry
+	entries := []fs.DirEntry{}
 	prefix := name + "/"
 	if name == "." {
 		prefix = ""
@@ -437,11 +456,13 @@ func (f *file) Seek(offset int64, whence int) (int64, error) {
 	return abs, nil
 }
 
-// dir implements fs.File and fs.FileInfo
+// dir implements fs.ReadDirFile and fs.FileInfo
 type dir struct {
 	name    string
 	mode    fs.FileMode
 	modTime time.Time
+	entries []fs.DirEntry // Listed when the directory is opened
+	offset  int           // Entries already returned by ReadDir
 }
 
 func (d *dir) clone() *dir {
@@ -456,6 +477,23 @@ func (d *dir) Read([]byte) (int, error) {
 	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
 }
 
+// ReadDir implements fs.ReadDirFile
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.offset += n
+	return rest[:n], nil
+}
+
 func (d *dir) Close() error               { return nil }
 func (d *dir) Stat() (fs.FileInfo, error) { return d, nil }
 func (d *dir) Name() string               { return d.name }
@@ -1,10 +1,14 @@
 package memory
 
 import (
+	"errors"
 	"io"
+	"io/fs"
 	"path/filepath"
+	"reflect"
 	"sync"
 	"testing"
+	"testing/fstest"
 )
 
 func TestFS_BasicOperations(t *testing.T) {
@@ -280,3 +284,110 @@ func TestFS_ErrorCases(t *testing.T) {
 		}
 	})
 }
+
+func newPopulatedFS(t *testing.T) *FS {
+	t.Helper()
+	fsys := New()
+	if err := fsys.MkdirAll("docs/notes", 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	for name, content := range map[string]string{
+		"readme.md":         "readme",
+		"docs/a.md":         "a",
+		"docs/b.md":         "b",
+		"docs/notes/day.md": "day",
+	} {
+		if err := fsys.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+	return fsys
+}
+
+func TestFS_TestFS(t *testing.T) {
+	fsys := newPopulatedFS(t)
+	if err := fstest.TestFS(fsys, "readme.md", "docs/a.md", "docs/b.md", "docs/notes/day.md"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFS_ReadDirFile(t *testing.T) {
+	fsys := newPopulatedFS(t)
+
+	f, err := fsys.Open("docs")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+	d, ok := f.(fs.ReadDirFile)
+	if !ok {
+		t.Fatal("Expected a directory handle to implement fs.ReadDirFile")
+	}
+
+	var names []string
+	for {
+		entries, err := d.ReadDir(2)
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ReadDir failed: %v", err)
+		}
+	}
+	if want := []string{"a.md", "b.md", "notes"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Expected %v, got %v", want, names)
+	}
+
+	var walked []string
+	err = fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		walked = append(walked, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkDir failed: %v", err)
+	}
+	if len(walked) != 7 {
+		t.Errorf("Expected 7 walked paths, got %v", walked)
+	}
+}
+
+func TestFS_Sub(t *testing.T) {
+	fsys := newPopulatedFS(t)
+
+	sub, err := fs.Sub(fsys, "docs")
+	if err != nil {
+		t.Fatalf("Sub failed: %v", err)
+	}
+	if err := fstest.TestFS(sub, "a.md", "b.md", "notes/day.md"); err != nil {
+		t.Error(err)
+	}
+
+	// Writes go through to the parent
+	w, ok := sub.(interface {
+		WriteFile(name string, data []byte, perm fs.FileMode) error
+	})
+	if !ok {
+		t.Fatal("Expected the sub file system to be writable")
+	}
+	if err := w.WriteFile("c.md", []byte("c"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if data, err := fs.ReadFile(fsys, "docs/c.md"); err != nil || string(data) != "c" {
+		t.Errorf("Expected %q, got %q (%v)", "c", data, err)
+	}
+
+	// Errors name paths relative to the sub file system
+	var pathErr *fs.PathError
+	if _, err := sub.Open("missing.md"); !errors.As(err, &pathErr) || pathErr.Path != "missing.md" {
+		t.Errorf("Expected an error for missing.md, got %v", err)
+	}
+	if _, err := fsys.Sub("../docs"); err == nil {
+		t.Error("Expected an error for an invalid directory")
+	}
+}
@@ -0,0 +1,104 @@
+package memory
+
+import (
+	"bytes"
+	"sort"
+)
+
+// Snapshot is a copy of the state of an FS at one point in time
+type Snapshot struct {
+	files map[string]*file
+	dirs  map[string]*dir
+}
+
+// Changes lists the paths that differ between two snapshots
+type Changes struct {
+	Added    []string
+	Removed  []string
+	Modified []string // Files whose content or mode changed
+}
+
+// Empty reports whether there are no changes
+func (c Changes) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Modified) == 0
+}
+
+// Snapshot captures every file and directory in f. Later changes to f do
+// not affect the snapshot.
+func (f *FS) Snapshot() *Snapshot {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return &Snapshot{files: cloneFiles(f.files), dirs: cloneDirs(f.dirs)}
+}
+
+// Restore replaces the contents of f with the snapshot s. The snapshot can
+// be restored again later.
+func (f *FS) Restore(s *Snapshot) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.files = cloneFiles(s.files)
+	f.dirs = cloneDirs(s.dirs)
+}
+
+// Diff returns the changes from s to other. Paths are sorted.
+func (s *Snapshot) Diff(other *Snapshot) Changes {
+	var c Changes
+	for name, old := range s.files {
+		if nf, ok := other.files[name]; ok {
+			if !bytes.Equal(old.data, nf.data) || old.mode != nf.mode {
+				c.Modified = append(c.Modified, name)
+			}
+		} else if _, ok := other.dirs[name]; ok {
+			c.Modified = append(c.Modified, name)
+		} else {
+			c.Removed = append(c.Removed, name)
+		}
+	}
+	for name := range s.dirs {
+		if _, ok := other.dirs[name]; ok {
+			continue
+		}
+		if _, ok := other.files[name]; ok {
+			c.Modified = append(c.Modified, name)
+		} else {
+			c.Removed = append(c.Removed, name)
+		}
+	}
+	for name := range other.files {
+		if !s.has(name) {
+			c.Added = append(c.Added, name)
+		}
+	}
+	for name := range other.dirs {
+		if !s.has(name) {
+			c.Added = append(c.Added, name)
+		}
+	}
+	sort.Strings(c.Added)
+	sort.Strings(c.Removed)
+	sort.Strings(c.Modified)
+	return c
+}
+
+// has reports whether name is a file or directory in s
+func (s *Snapshot) has(name string) bool {
+	_, isFile := s.files[name]
+	_, isDir := s.dirs[name]
+	return isFile || isDir
+}
+
+func cloneFiles(files map[string]*file) map[string]*file {
+	clone := make(map[string]*file, len(files))
+	for name, f := range files {
+		clone[name] = f.clone()
+	}
+	return clone
+}
+
+func cloneDirs(dirs map[string]*dir) map[string]*dir {
+	clone := make(map[string]*dir, len(dirs))
+	for name, d := range dirs {
+		clone[name] = d.clone()
+	}
+	return clone
+}
@@ -0,0 +1,64 @@
+package memory
+
+import (
+	"io/fs"
+	"reflect"
+	"testing"
+)
+
+func TestSnapshot_Diff(t *testing.T) {
+	fsys := newPopulatedFS(t)
+	before := fsys.Snapshot()
+
+	if err := fsys.WriteFile("docs/a.md", []byte("changed"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := fsys.WriteFile("docs/b.md", []byte("b"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := fsys.RemoveAll("docs/notes"); err != nil {
+		t.Fatalf("RemoveAll failed: %v", err)
+	}
+	if err := fsys.MkdirAll("out", 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	if err := fsys.WriteFile("out/c.md", []byte("c"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	got := before.Diff(fsys.Snapshot())
+	want := Changes{
+		Added:    []string{"out", "out/c.md"},
+		Removed:  []string{"docs/notes", "docs/notes/day.md"},
+		Modified: []string{"docs/a.md", "docs/b.md"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+
+	if changes := before.Diff(before); !changes.Empty() {
+		t.Errorf("Expected no changes, got %+v", changes)
+	}
+}
+
+func TestSnapshot_Restore(t *testing.T) {
+	fsys := newPopulatedFS(t)
+	snap := fsys.Snapshot()
+
+	for i := 0; i < 2; i++ {
+		if err := fsys.WriteFile("readme.md", []byte("changed"), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		if err := fsys.Remove("docs/a.md"); err != nil {
+			t.Fatalf("Remove failed: %v", err)
+		}
+
+		fsys.Restore(snap)
+		if changes := snap.Diff(fsys.Snapshot()); !changes.Empty() {
+			t.Errorf("Expected the snapshot to be restored, got %+v", changes)
+		}
+		if data, err := fs.ReadFile(fsys, "readme.md"); err != nil || string(data) != "readme" {
+			t.Errorf("Expected %q, got %q (%v)", "readme", data, err)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package memory
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// Sub implements fs.SubFS. The returned file system shares its files with
+// f and also implements the write operations of FS.
+func (f *FS) Sub(dir string) (fs.FS, error) {
+	if !fs.ValidPath(dir) {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: fs.ErrInvalid}
+	}
+	if dir == "." {
+		return f, nil
+	}
+	return &subFS{fsys: f, dir: dir}, nil
+}
+
+// subFS is the directory dir of fsys
+type subFS struct {
+	fsys *FS
+	dir  string
+}
+
+// full returns the name in the parent file system
+func (s *subFS) full(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return path.Join(s.dir, name), nil
+}
+
+// shorten rewrites the paths of errors from the parent file system
+// relative to the directory
+func (s *subFS) shorten(err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		rel := strings.TrimPrefix(pathErr.Path, s.dir+"/")
+		if pathErr.Path == s.dir {
+			rel = "."
+		}
+		return &fs.PathError{Op: pathErr.Op, Path: rel, Err: pathErr.Err}
+	}
+	return err
+}
+
+// Open implements fs.FS
+func (s *subFS) Open(name string) (fs.File, error) {
+	full, err := s.full("open", name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := s.fsys.Open(full)
+	return file, s.shorten(err)
+}
+
+// Stat implements fs.StatFS
+func (s *subFS) Stat(name string) (fs.FileInfo, error) {
+	full, err := s.full("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := s.fsys.Stat(full)
+	return info, s.shorten(err)
+}
+
+// ReadDir implements fs.ReadDirFS
+func (s *subFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	full, err := s.full("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.fsys.ReadDir(full)
+	return entries, s.shorten(err)
+}
+
+// Glob implements fs.GlobFS
+func (s *subFS) Glob(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	matches, err := s.fsys.Glob(path.Join(s.dir, pattern))
+	if err != nil {
+		return nil, err
+	}
+	for i, match := range matches {
+		matches[i] = strings.TrimPrefix(match, s.dir+"/")
+	}
+	return matches, nil
+}
+
+// Sub implements fs.SubFS
+func (s *subFS) Sub(dir string) (fs.FS, error) {
+	full, err := s.full("sub", dir)
+	if err != nil {
+		return nil, err
+	}
+	return s.fsys.Sub(full)
+}
+
+// Write implements WriteFS
+func (s *subFS) Write(name string, data []byte) error {
+	return s.WriteFile(name, data, 0666)
+}
+
+// WriteFile implements WriteFS
+func (s *subFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	full, err := s.full("write", name)
+	if err != nil {
+		return err
+	}
+	return s.shorten(s.fsys.WriteFile(full, data, perm))
+}
+
+// MkdirAll implements WriteFS
+func (s *subFS) MkdirAll(name string, perm fs.FileMode) error {
+	full, err := s.full("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return s.shorten(s.fsys.MkdirAll(full, perm))
+}
+
+// Remove implements WriteFS
+func (s *subFS) Remove(name string) error {
+	full, err := s.full("remove", name)
+	if err != nil {
+		return err
+	}
+	return s.shorten(s.fsys.Remove(full))
+}
+
+// RemoveAll implements WriteFS
+func (s *subFS) RemoveAll(name string) error {
+	full, err := s.full("removeall", name)
+	if err != nil {
+		return err
+	}
+	return s.shorten(s.fsys.RemoveAll(full))
+}
+
+// Rename implements WriteFS
+func (s *subFS) Rename(oldpath, newpath string) error {
+	from, err := s.full("rename", oldpath)
+	if err != nil {
+		return err
+	}
+	to, err := s.full("rename", newpath)
+	if err != nil {
+		return err
+	}
+	return s.shorten(s.fsys.Rename(from, to))
+}
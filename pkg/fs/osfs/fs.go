@@ -0,0 +1,218 @@
+package osfs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// BackupSuffix is appended to the name of a file to name its backup
+const BackupSuffix = ".bak"
+
+// Options customizes an FS
+type Options struct {
+	Backup bool // Keep the previous content of a replaced file in <name>.bak
+}
+
+// FS implements fs.FS over a directory of the OS file system. Files are
+// replaced atomically, so a crash leaves either their old or their new
+// content.
+type FS struct {
+	root string
+	opts Options
+}
+
+// New creates a file system rooted at root
+func New(root string, opts Options) *FS {
+	return &FS{root: root, opts: opts}
+}
+
+// Path returns the OS path of name, or an error when name is not a valid
+// io/fs path
+func (f *FS) Path(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(f.root, filepath.FromSlash(name)), nil
+}
+
+// Open implements fs.FS
+func (f *FS) Open(name string) (fs.File, error) {
+	p, err := f.Path("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+// Stat implements fs.StatFS
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	p, err := f.Path("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(p)
+}
+
+// ReadFile implements fs.ReadFileFS
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	p, err := f.Path("read", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(p)
+}
+
+// ReadDir implements fs.ReadDirFS
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	p, err := f.Path("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadDir(p)
+}
+
+// Glob implements fs.GlobFS
+func (f *FS) Glob(pattern string) ([]string, error) {
+	return fs.Glob(os.DirFS(f.root), pattern)
+}
+
+// Write implements WriteFS
+func (f *FS) Write(name string, data []byte) error {
+	return f.WriteFile(name, data, 0666)
+}
+
+// WriteFile implements WriteFS, replacing the file atomically
+func (f *FS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	p, err := f.Path("write", name)
+	if err != nil {
+		return err
+	}
+	return WriteFile(p, data, perm, f.opts.Backup)
+}
+
+// MkdirAll implements WriteFS
+func (f *FS) MkdirAll(path string, perm fs.FileMode) error {
+	p, err := f.Path("mkdir", path)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(p, perm)
+}
+
+// Remove implements WriteFS
+func (f *FS) Remove(name string) error {
+	p, err := f.Path("remove", name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(p)
+}
+
+// RemoveAll implements WriteFS
+func (f *FS) RemoveAll(path string) error {
+	p, err := f.Path("removeall", path)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(p)
+}
+
+// Rename implements WriteFS
+func (f *FS) Rename(oldpath, newpath string) error {
+	from, err := f.Path("rename", oldpath)
+	if err != nil {
+		return err
+	}
+	to, err := f.Path("rename", newpath)
+	if err != nil {
+		return err
+	}
+	return os.Rename(from, to)
+}
+
+// WriteFile replaces the file at path with data atomically: data is
+// written to a temporary file in the same directory, synced to disk and
+// renamed over path. A replaced file keeps its mode; perm applies to new
+// files. With backup, the previous content is kept in path+BackupSuffix.
+func WriteFile(path string, data []byte, perm fs.FileMode, backup bool) error {
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if backup {
+		if err := backupFile(path); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	committed = true
+
+	// Persist the rename; not every platform can sync a directory
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// backupFile keeps the current content of path in path+BackupSuffix,
+// linking it when the file system allows
+func backupFile(path string) error {
+	backup := path + BackupSuffix
+	if err := os.Remove(backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	err := os.Link(path, backup)
+	if err == nil || os.IsNotExist(err) {
+		return nil
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(backup, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
@@ -0,0 +1,93 @@
+package osfs
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// leftovers returns the names in dir other than want
+func leftovers(t *testing.T, dir string, want ...string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	expected := make(map[string]bool)
+	for _, name := range want {
+		expected[name] = true
+	}
+	var extra []string
+	for _, e := range entries {
+		if !expected[e.Name()] {
+			extra = append(extra, e.Name())
+		}
+	}
+	return extra
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes.md")
+	if err := os.WriteFile(path, []byte("old"), 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if err := WriteFile(path, []byte("new"), 0644, false); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new" {
+		t.Errorf("Expected %q, got %q", "new", data)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the mode to be kept, got %v", info.Mode().Perm())
+	}
+	if extra := leftovers(t, dir, "notes.md"); len(extra) != 0 {
+		t.Errorf("Expected no temporary files, got %v", extra)
+	}
+
+	// A failed write leaves nothing behind
+	if err := WriteFile(filepath.Join(dir, "missing", "notes.md"), []byte("new"), 0644, false); err == nil {
+		t.Error("Expected an error writing to a missing directory")
+	}
+	if extra := leftovers(t, dir, "notes.md"); len(extra) != 0 {
+		t.Errorf("Expected no temporary files, got %v", extra)
+	}
+}
+
+func TestWriteFileBackup(t *testing.T) {
+	dir := t.TempDir()
+	fsys := New(dir, Options{Backup: true})
+
+	// A new file has nothing to back up
+	if err := fsys.WriteFile("notes.md", []byte("first"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.md"+BackupSuffix)); !os.IsNotExist(err) {
+		t.Errorf("Expected no backup of a new file, got %v", err)
+	}
+
+	for _, content := range []string{"second", "third"} {
+		if err := fsys.WriteFile("notes.md", []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+	data, err := fs.ReadFile(fsys, "notes.md")
+	if err != nil || string(data) != "third" {
+		t.Errorf("Expected %q, got %q (%v)", "third", data, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "notes.md"+BackupSuffix)); string(data) != "second" {
+		t.Errorf("Expected backup %q, got %q", "second", data)
+	}
+	if extra := leftovers(t, dir, "notes.md", "notes.md"+BackupSuffix); len(extra) != 0 {
+		t.Errorf("Expected no temporary files, got %v", extra)
+	}
+}
+
+func TestFSInvalidPath(t *testing.T) {
+	fsys := New(t.TempDir(), Options{})
+	if err := fsys.WriteFile("../escape.md", []byte("x"), 0644); err == nil {
+		t.Error("Expected an error for a path outside the root")
+	}
+}
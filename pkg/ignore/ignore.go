@@ -0,0 +1,199 @@
+// Package ignore decides which files of a project are left alone, using
+// the pattern syntax of .gitignore files.
+package ignore
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// File is the name of the ignore file at the root of a project
+const File = ".skylarkignore"
+
+// Matcher matches paths of a project against ignore patterns
+type Matcher struct {
+	root  string // Absolute project directory
+	rules []rule
+}
+
+// rule is one parsed pattern
+type rule struct {
+	re      *regexp.Regexp
+	negate  bool // Re-includes matching paths
+	dirOnly bool // Only matches directories
+}
+
+// Load creates a matcher for the project in root from its .skylarkignore
+// file, if there is one, followed by patterns. Later patterns take
+// precedence, so patterns override the file.
+func Load(root string, patterns []string) (*Matcher, error) {
+	var lines []string
+	data, err := os.ReadFile(filepath.Join(root, File))
+	switch {
+	case err == nil:
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, fmt.Errorf("failed to read %s: %w", File, err)
+	}
+	return New(root, append(lines, patterns...))
+}
+
+// New creates a matcher for the project in root from patterns
+func New(root string, patterns []string) (*Matcher, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", root, err)
+	}
+	m := &Matcher{root: abs}
+	for _, p := range patterns {
+		r, ok, err := parse(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ignore pattern %q: %w", p, err)
+		}
+		if ok {
+			m.rules = append(m.rules, r)
+		}
+	}
+	return m, nil
+}
+
+// Ignored reports whether the file or directory at path is ignored. path
+// is an OS path, absolute or relative to the working directory. A path in
+// an ignored directory is ignored too. Paths outside the project are
+// matched by their base name.
+func (m *Matcher) Ignored(path string, isDir bool) bool {
+	if m == nil || len(m.rules) == 0 {
+		return false
+	}
+	rel := filepath.Base(path)
+	if abs, err := filepath.Abs(path); err == nil {
+		if r, err := filepath.Rel(m.root, abs); err == nil && r != ".." && !strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+			rel = r
+		}
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == "." {
+		return false
+	}
+
+	// Check each parent directory before the path itself
+	elems := strings.Split(rel, "/")
+	for i := 1; i < len(elems); i++ {
+		if m.match(strings.Join(elems[:i], "/"), true) {
+			return true
+		}
+	}
+	return m.match(rel, isDir)
+}
+
+// match applies the rules to a slash-separated path relative to the root.
+// The last matching rule decides.
+func (m *Matcher) match(rel string, isDir bool) bool {
+	ignored := false
+	for _, r := range m.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if r.re.MatchString(rel) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// parse parses a pattern line. It reports false for blank lines and
+// comments.
+func parse(line string) (rule, bool, error) {
+	var r rule
+	line = trimTrailingSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return r, false, nil
+	}
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return r, false, nil
+	}
+
+	// Patterns with a slash other than a trailing one are relative to the
+	// root; others match at any depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	expr := translate(line)
+	if !anchored {
+		expr = "(?:.*/)?" + expr
+	}
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return r, false, err
+	}
+	r.re = re
+	return r, true, nil
+}
+
+// translate converts a glob pattern to a regular expression
+func translate(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			// Zero or more directories
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**") && i+2 == len(pattern):
+			// Everything below
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// trimTrailingSpace removes trailing spaces that are not escaped
+func trimTrailingSpace(line string) string {
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	return line
+}
@@ -0,0 +1,106 @@
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatcher(t *testing.T) {
+	root := t.TempDir()
+	m, err := New(root, []string{
+		"# comment",
+		"",
+		"*.tmp",
+		"build/",
+		"/drafts",
+		"docs/**/private",
+		"vendor/**",
+		"!vendor/keep.md",
+		"notes/*.md",
+		"!notes/index.md",
+		"~*",
+		`\#hash.md`,
+		"file[0-9].md",
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{path: "a.md", want: false},
+		{path: "a.tmp", want: true},
+		{path: "deep/dir/a.tmp", want: true},
+		{path: "build", isDir: true, want: true},
+		{path: "build", want: false}, // Directory-only pattern
+		{path: "build/out.md", want: true},
+		{path: "src/build/out.md", want: true},
+		{path: "drafts/a.md", want: true},
+		{path: "src/drafts/a.md", want: false}, // Anchored to the root
+		{path: "docs/private/a.md", want: true},
+		{path: "docs/x/y/private/a.md", want: true},
+		{path: "docs/public/a.md", want: false},
+		{path: "vendor/lib/a.md", want: true},
+		{path: "vendor/keep.md", want: false},
+		{path: "notes/a.md", want: true},
+		{path: "notes/index.md", want: false},
+		{path: "notes/sub/a.md", want: false}, // * does not cross directories
+		{path: "~lock.md", want: true},
+		{path: "#hash.md", want: true},
+		{path: "file1.md", want: true},
+		{path: "fileA.md", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			path := filepath.Join(root, filepath.FromSlash(tt.path))
+			if got := m.Ignored(path, tt.isDir); got != tt.want {
+				t.Errorf("Expected Ignored(%s) = %v, got %v", tt.path, tt.want, got)
+			}
+		})
+	}
+
+	// Paths outside the project match by base name
+	if !m.Ignored(filepath.Join(t.TempDir(), "x.tmp"), false) {
+		t.Error("Expected x.tmp outside the project to be ignored")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, File), []byte("*.log\ngenerated/\n"), 0644); err != nil {
+		t.Fatalf("Failed to write ignore file: %v", err)
+	}
+
+	// Patterns from configuration override the file
+	m, err := Load(root, []string{"!keep.log"})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	for path, want := range map[string]bool{
+		"run.log":          true,
+		"keep.log":         false,
+		"generated/out.md": true,
+		"notes/day.md":     false,
+	} {
+		if got := m.Ignored(filepath.Join(root, path), false); got != want {
+			t.Errorf("Expected Ignored(%s) = %v, got %v", path, want, got)
+		}
+	}
+
+	// A project without an ignore file ignores nothing
+	m, err = Load(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if m.Ignored("a.tmp", false) {
+		t.Error("Expected nothing to be ignored")
+	}
+
+	if _, err := New(root, []string{"[z-a]"}); err == nil {
+		t.Error("Expected an error for an invalid pattern")
+	}
+}
@@ -0,0 +1,102 @@
+// Package index maps note names to the Markdown files of a project, so
+// that [[WikiLinks]] resolve the way Obsidian resolves them.
+package index
+
+import (
+	"fmt"
+	iofs "io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Index holds the Markdown files of a project by name and by path
+type Index struct {
+	byName map[string][]string // Lowercased base name without .md
+	byPath map[string]string   // Lowercased path without .md
+}
+
+// Build indexes the Markdown files in fsys. Hidden directories such as
+// .skai, .obsidian and .git are skipped.
+func Build(fsys iofs.FS) (*Index, error) {
+	idx := &Index{
+		byName: make(map[string][]string),
+		byPath: make(map[string]string),
+	}
+
+	err := iofs.WalkDir(fsys, ".", func(p string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != "." && strings.HasPrefix(d.Name(), ".") {
+				return iofs.SkipDir
+			}
+			return nil
+		}
+		if !strings.EqualFold(path.Ext(p), ".md") {
+			return nil
+		}
+
+		key := strings.ToLower(strings.TrimSuffix(p, path.Ext(p)))
+		idx.byPath[key] = p
+		name := path.Base(key)
+		idx.byName[name] = append(idx.byName[name], p)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to index notes: %w", err)
+	}
+
+	// Prefer the shortest path when names collide, as Obsidian does
+	for _, paths := range idx.byName {
+		sort.Slice(paths, func(i, j int) bool {
+			if len(paths[i]) != len(paths[j]) {
+				return len(paths[i]) < len(paths[j])
+			}
+			return paths[i] < paths[j]
+		})
+	}
+	return idx, nil
+}
+
+// Len returns the number of indexed notes
+func (i *Index) Len() int {
+	return len(i.byPath)
+}
+
+// Resolve returns the path of the note a link target names. Targets are
+// matched case-insensitively, with or without the .md extension, either
+// as a note name or as a path from the project root or ending in the
+// target.
+func (i *Index) Resolve(target string) (string, bool) {
+	key := strings.ToLower(strings.Trim(target, "/ "))
+	key = strings.TrimSuffix(key, ".md")
+	if key == "" {
+		return "", false
+	}
+
+	if !strings.Contains(key, "/") {
+		if paths := i.byName[key]; len(paths) > 0 {
+			return paths[0], true
+		}
+		return "", false
+	}
+
+	if p, ok := i.byPath[key]; ok {
+		return p, true
+	}
+
+	// A partial path such as "projects/plan" matches the shortest path
+	// ending in it
+	var best string
+	for k, p := range i.byPath {
+		if !strings.HasSuffix(k, "/"+key) {
+			continue
+		}
+		if best == "" || len(p) < len(best) || len(p) == len(best) && p < best {
+			best = p
+		}
+	}
+	return best, best != ""
+}
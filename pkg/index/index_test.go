@@ -0,0 +1,50 @@
+package index
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestResolve(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Plan.md":                 {Data: []byte("# Plan")},
+		"projects/Plan.md":        {Data: []byte("# Plan")},
+		"projects/alpha/Notes.md": {Data: []byte("# Notes")},
+		"archive/alpha/Notes.md":  {Data: []byte("# Notes")},
+		"daily/2024-01-01.md":     {Data: []byte("# Day")},
+		"image.png":               {Data: []byte{}},
+		".obsidian/Hidden.md":     {Data: []byte("# Hidden")},
+	}
+
+	idx, err := Build(fsys)
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if idx.Len() != 5 {
+		t.Errorf("Expected 5 notes, got %d", idx.Len())
+	}
+
+	tests := []struct {
+		target string
+		want   string
+		ok     bool
+	}{
+		{"Plan", "Plan.md", true},
+		{"plan.md", "Plan.md", true},
+		{"projects/plan", "projects/Plan.md", true},
+		{"2024-01-01", "daily/2024-01-01.md", true},
+		{"Notes", "archive/alpha/Notes.md", true},
+		{"alpha/Notes", "archive/alpha/Notes.md", true},
+		{"projects/alpha/Notes", "projects/alpha/Notes.md", true},
+		{"Hidden", "", false},
+		{"image", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := idx.Resolve(tt.target)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Resolve(%q) = %q, %v; want %q, %v", tt.target, got, ok, tt.want, tt.ok)
+		}
+	}
+}
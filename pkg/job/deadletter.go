@@ -0,0 +1,154 @@
+package job
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrDeadLetterNotFound is returned when a dead letter ID is unknown
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// DeadLetter records a job that failed permanently
+type DeadLetter struct {
+	ID       string    `json:"id"`
+	Job      Record    `json:"job"`
+	Error    string    `json:"error"`
+	Stack    string    `json:"stack,omitempty"`
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// Retryable reports whether the original job can be recreated
+func (d DeadLetter) Retryable() bool {
+	return d.Job.Path != ""
+}
+
+// DeadLetterStore persists permanently failed jobs in a JSON file
+type DeadLetterStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewDeadLetterStore creates a dead letter store backed by path
+func NewDeadLetterStore(path string) *DeadLetterStore {
+	return &DeadLetterStore{path: path}
+}
+
+// Add records a permanently failed job
+func (s *DeadLetterStore) Add(j Job, err error, stack string, attempts int) error {
+	id, idErr := newDeadLetterID()
+	if idErr != nil {
+		return idErr
+	}
+
+	entry := DeadLetter{
+		ID:       id,
+		Stack:    stack,
+		Attempts: attempts,
+		FailedAt: time.Now().UTC(),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if p, ok := j.(Persistable); ok {
+		entry.Job = p.Record()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, loadErr := s.load()
+	if loadErr != nil {
+		return loadErr
+	}
+	return s.save(append(entries, entry))
+}
+
+// List returns all dead letters, oldest first
+func (s *DeadLetterStore) List() ([]DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+// Get returns the dead letter with the given ID
+func (s *DeadLetterStore) Get(id string) (DeadLetter, error) {
+	entries, err := s.List()
+	if err != nil {
+		return DeadLetter{}, err
+	}
+	for _, e := range entries {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+	return DeadLetter{}, fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+}
+
+// Remove deletes the dead letter with the given ID
+func (s *DeadLetterStore) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := s.load()
+	if err != nil {
+		return err
+	}
+	for i, e := range entries {
+		if e.ID == id {
+			return s.save(append(entries[:i], entries[i+1:]...))
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+}
+
+// load reads all entries. Callers must hold s.mu.
+func (s *DeadLetterStore) load() ([]DeadLetter, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dead letter store: %w", err)
+	}
+
+	var entries []DeadLetter
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse dead letter store: %w", err)
+	}
+	return entries, nil
+}
+
+// save writes all entries. Callers must hold s.mu.
+func (s *DeadLetterStore) save(entries []DeadLetter) error {
+	if entries == nil {
+		entries = []DeadLetter{}
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead letters: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create dead letter directory: %w", err)
+	}
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write dead letter store: %w", err)
+	}
+	return nil
+}
+
+// newDeadLetterID returns a short random identifier
+func newDeadLetterID() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate dead letter id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
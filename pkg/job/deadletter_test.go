@@ -0,0 +1,63 @@
+package job
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeadLetterStore(t *testing.T) {
+	store := NewDeadLetterStore(filepath.Join(t.TempDir(), "dead_letter.json"))
+
+	entries, err := store.List()
+	if err != nil {
+		t.Fatalf("Failed to list empty store: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected empty store, got %d entries", len(entries))
+	}
+
+	j := NewFileChangeJob("notes.md", nil).WithPriority(PriorityInteractive)
+	if err := store.Add(j, errors.New("provider timeout"), "stack", 4); err != nil {
+		t.Fatalf("Failed to add dead letter: %v", err)
+	}
+
+	entries, err = store.List()
+	if err != nil {
+		t.Fatalf("Failed to list store: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(entries))
+	}
+	entry := entries[0]
+	if entry.ID == "" {
+		t.Error("Expected entry to have an ID")
+	}
+	if entry.Job.Path != "notes.md" || entry.Job.Priority != PriorityInteractive {
+		t.Errorf("Expected original payload, got %+v", entry.Job)
+	}
+	if entry.Error != "provider timeout" || entry.Stack != "stack" || entry.Attempts != 4 {
+		t.Errorf("Unexpected entry details: %+v", entry)
+	}
+	if !entry.Retryable() {
+		t.Error("Expected file change job to be retryable")
+	}
+
+	got, err := store.Get(entry.ID)
+	if err != nil {
+		t.Fatalf("Failed to get entry: %v", err)
+	}
+	if got.ID != entry.ID {
+		t.Errorf("Expected ID %s, got %s", entry.ID, got.ID)
+	}
+
+	if err := store.Remove(entry.ID); err != nil {
+		t.Fatalf("Failed to remove entry: %v", err)
+	}
+	if _, err := store.Get(entry.ID); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Errorf("Expected ErrDeadLetterNotFound, got %v", err)
+	}
+	if err := store.Remove(entry.ID); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Errorf("Expected ErrDeadLetterNotFound on second remove, got %v", err)
+	}
+}
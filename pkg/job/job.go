@@ -1,30 +1,149 @@
 package job
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 
 	"github.com/butter-bot-machines/skylark/pkg/logging"
+	"github.com/butter-bot-machines/skylark/pkg/parser"
 	"github.com/butter-bot-machines/skylark/pkg/processor"
+	"github.com/butter-bot-machines/skylark/pkg/tool"
+	"github.com/butter-bot-machines/skylark/pkg/tracing"
 )
 
 // Job represents a unit of work that can be processed
 type Job interface {
-	// Process executes the job
-	Process() error
+	// Process executes the job. The worker pool cancels ctx when the job
+	// times out or is interrupted by shutdown.
+	Process(ctx context.Context) error
 
-	// OnFailure handles job failure
+	// OnFailure handles job failure once all retries are exhausted
 	OnFailure(error)
 
-	// MaxRetries returns the maximum number of retry attempts
+	// MaxRetries returns the maximum number of retry attempts. Retries are
+	// spaced with exponential backoff by the worker pool.
 	MaxRetries() int
 }
 
+// MergeContext returns a context carrying the values of values, such as a
+// trace and a logger, that is done when done is done or by its deadline.
+// Calling cancel releases its resources.
+func MergeContext(values, done context.Context) (ctx context.Context, cancel context.CancelFunc) {
+	ctx, cancelCause := context.WithCancelCause(values)
+	cancelDeadline := context.CancelFunc(func() {})
+	if deadline, ok := done.Deadline(); ok {
+		ctx, cancelDeadline = context.WithDeadline(ctx, deadline)
+	}
+	stop := context.AfterFunc(done, func() {
+		if !errors.Is(done.Err(), context.DeadlineExceeded) {
+			cancelCause(context.Cause(done)) // Deadlines expire on their own
+		}
+	})
+	return ctx, func() {
+		stop()
+		cancelDeadline()
+		cancelCause(context.Canceled)
+	}
+}
+
+// Priority ranks jobs for scheduling; lower values are served first
+type Priority int
+
+const (
+	// PriorityInteractive is used for watch-mode edits the user is waiting on
+	PriorityInteractive Priority = iota
+	// PriorityBatch is used for run-mode batch processing
+	PriorityBatch
+	// PriorityBackground is used for background work such as reindexing
+	PriorityBackground
+)
+
+// Priorities lists all priority levels from highest to lowest
+var Priorities = []Priority{PriorityInteractive, PriorityBatch, PriorityBackground}
+
+// String returns the string representation of a priority
+func (p Priority) String() string {
+	switch p {
+	case PriorityInteractive:
+		return "interactive"
+	case PriorityBatch:
+		return "batch"
+	case PriorityBackground:
+		return "background"
+	default:
+		return "unknown"
+	}
+}
+
+// Prioritized is implemented by jobs that declare a scheduling priority
+type Prioritized interface {
+	// Priority returns the job's scheduling priority
+	Priority() Priority
+}
+
+// PriorityOf returns the priority of a job, defaulting to PriorityBatch
+func PriorityOf(j Job) Priority {
+	if p, ok := j.(Prioritized); ok {
+		prio := p.Priority()
+		if prio >= PriorityInteractive && prio <= PriorityBackground {
+			return prio
+		}
+	}
+	return PriorityBatch
+}
+
+// Limited is implemented by jobs that count against per-key concurrency
+// limits, such as the assistants a file's commands are routed to
+type Limited interface {
+	// ConcurrencyKeys returns the keys the job holds while it runs
+	ConcurrencyKeys() []string
+}
+
+// ConcurrencyKeysOf returns the concurrency keys of a job, if it has any
+func ConcurrencyKeysOf(j Job) []string {
+	if l, ok := j.(Limited); ok {
+		return l.ConcurrencyKeys()
+	}
+	return nil
+}
+
+// Description summarizes a job's work for progress reporting
+type Description struct {
+	File     string   // File the job operates on
+	Commands []string // Commands the job will run
+}
+
+// Described is implemented by jobs that can describe their work
+type Described interface {
+	// Describe returns a summary of the job's work
+	Describe() Description
+}
+
+// DescriptionOf returns the description of a job, or an empty one
+func DescriptionOf(j Job) Description {
+	if d, ok := j.(Described); ok {
+		return d.Describe()
+	}
+	return Description{}
+}
+
+// Reporter is implemented by jobs that report progress while they run,
+// such as the progress of long-running tools
+type Reporter interface {
+	// ReportProgress sets the function the job reports progress to
+	ReportProgress(report func(message string))
+}
+
 // FileChangeJob represents a file change event
 type FileChangeJob struct {
 	Path      string                   // Path to the file to process
 	Processor processor.ProcessManager // Processor instance to use
+	priority  Priority                 // Scheduling priority
 	logger    *slog.Logger             // Logger for this job
+	ctx       context.Context          // Trace context of the originating event
+	report    func(message string)     // Receives the progress of tools (optional)
 }
 
 // NewFileChangeJob creates a new file change job
@@ -32,32 +151,114 @@ func NewFileChangeJob(path string, proc processor.ProcessManager) *FileChangeJob
 	return &FileChangeJob{
 		Path:      path,
 		Processor: proc,
-		logger:    logging.NewLogger(&logging.Options{Level: slog.LevelDebug}),
+		priority:  PriorityBatch,
+		logger:    logging.Default(),
+		ctx:       context.Background(),
+	}
+}
+
+// WithContext sets the trace context the job's spans are recorded under
+func (j *FileChangeJob) WithContext(ctx context.Context) *FileChangeJob {
+	j.ctx = ctx
+	return j
+}
+
+// WithPriority sets the scheduling priority of the job
+func (j *FileChangeJob) WithPriority(p Priority) *FileChangeJob {
+	j.priority = p
+	return j
+}
+
+// Priority implements Prioritized
+func (j *FileChangeJob) Priority() Priority {
+	return j.priority
+}
+
+// scan asks the processor for the file's current commands, so they are
+// read and parsed as it will process them. Files it cannot read or parse,
+// and processors that cannot scan, yield no commands; Process reports the
+// errors.
+func (j *FileChangeJob) scan() []*parser.Command {
+	scanner, ok := j.Processor.(processor.CommandScanner)
+	if !ok {
+		return nil
+	}
+	commands, err := scanner.Commands(j.Path)
+	if err != nil {
+		return nil
 	}
+	return commands
 }
 
-func (j *FileChangeJob) Process() error {
-	j.logger.Debug("processing file",
-		"path", j.Path)
+// ConcurrencyKeys implements Limited, returning the assistants referenced
+// by the file's commands as it is now
+func (j *FileChangeJob) ConcurrencyKeys() []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, cmd := range j.scan() {
+		if !seen[cmd.Assistant] {
+			seen[cmd.Assistant] = true
+			keys = append(keys, cmd.Assistant)
+		}
+	}
+	return keys
+}
 
-	// Process file using processor
-	if err := j.Processor.ProcessFile(j.Path); err != nil {
-		j.logger.Error("processing failed",
-			"path", j.Path,
+// ReportProgress implements Reporter
+func (j *FileChangeJob) ReportProgress(report func(message string)) {
+	j.report = report
+}
+
+// Describe implements Described
+func (j *FileChangeJob) Describe() Description {
+	d := Description{File: j.Path}
+	for _, cmd := range j.scan() {
+		d.Commands = append(d.Commands, cmd.Original)
+	}
+	return d
+}
+
+// Process processes the file under the trace context of the job, stopping
+// when ctx is done
+func (j *FileChangeJob) Process(ctx context.Context) error {
+	logger := logging.FromContext(j.ctx, j.logger).With("file", j.Path)
+	logger.Debug("processing file")
+
+	ctx, cancel := MergeContext(j.ctx, ctx)
+	defer cancel()
+	ctx, span := tracing.Start(ctx, "job.process",
+		tracing.WithAttributes(
+			tracing.String("file.path", j.Path),
+			tracing.String("job.priority", j.priority.String())))
+	defer span.End()
+	ctx = logging.ContextWithLogger(ctx, logger)
+	if report := j.report; report != nil {
+		ctx = tool.ContextWithProgress(ctx, func(p tool.Progress) { report(p.String()) })
+	}
+
+	// Process file using processor, passing the trace context when supported
+	var err error
+	if cp, ok := j.Processor.(processor.ContextFileProcessor); ok {
+		err = cp.ProcessFileContext(ctx, j.Path)
+	} else {
+		err = j.Processor.ProcessFile(j.Path)
+	}
+	if err != nil {
+		span.RecordError(err)
+		logger.Error("processing failed",
 			"error", err)
 		return fmt.Errorf("failed to process file %s: %w", j.Path, err)
 	}
 
-	j.logger.Debug("file processed successfully",
-		"path", j.Path)
+	logger.Debug("file processed successfully")
 	return nil
 }
 
 func (j *FileChangeJob) OnFailure(err error) {
-	j.logger.Error("job failed",
-		"path", j.Path,
+	logging.FromContext(j.ctx, j.logger).Error("job failed permanently",
+		"file", j.Path,
 		"error", err,
-		"retries_remaining", j.MaxRetries())
+		"max_retries", j.MaxRetries())
 }
 
 func (j *FileChangeJob) MaxRetries() int {
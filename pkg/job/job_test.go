@@ -0,0 +1,99 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+)
+
+// scanningProcessor scans documents with the default parser
+type scanningProcessor struct {
+	processor.ProcessManager
+}
+
+func (scanningProcessor) Commands(path string) ([]*parser.Command, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parser.New().ParseCommands(string(content))
+}
+
+func TestFileChangeJobConcurrencyKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.md")
+	content := "# Notes\n!summarize this\n!researcher look this up\n!Researcher and this\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	j := NewFileChangeJob(path, scanningProcessor{})
+	keys := j.ConcurrencyKeys()
+	want := []string{"summarize", "researcher"}
+	if len(keys) != len(want) {
+		t.Fatalf("Expected keys %v, got %v", want, keys)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Errorf("Key %d: expected %s, got %s", i, want[i], keys[i])
+		}
+	}
+
+	// Keys follow edits made while the job waits
+	if err := os.WriteFile(path, []byte("!translate this\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if keys := j.ConcurrencyKeys(); len(keys) != 1 || keys[0] != "translate" {
+		t.Errorf("Expected the keys of the edited file, got %v", keys)
+	}
+
+	if keys := NewFileChangeJob(filepath.Join(t.TempDir(), "missing.md"), scanningProcessor{}).ConcurrencyKeys(); len(keys) != 0 {
+		t.Errorf("Expected no keys for missing file, got %v", keys)
+	}
+	if keys := NewFileChangeJob(path, nil).ConcurrencyKeys(); len(keys) != 0 {
+		t.Errorf("Expected no keys without a scanning processor, got %v", keys)
+	}
+}
+
+func TestMergeContext(t *testing.T) {
+	type key struct{}
+	values := context.WithValue(context.Background(), key{}, "trace")
+
+	done, cancelDone := context.WithCancelCause(context.Background())
+	ctx, cancel := MergeContext(values, done)
+	defer cancel()
+	if ctx.Value(key{}) != "trace" {
+		t.Error("Expected the values of the first context")
+	}
+	if ctx.Err() != nil {
+		t.Fatalf("Expected a running context, got %v", ctx.Err())
+	}
+	interrupted := errors.New("interrupted")
+	cancelDone(interrupted)
+	<-ctx.Done()
+	if !errors.Is(context.Cause(ctx), interrupted) {
+		t.Errorf("Expected the cause of the second context, got %v", context.Cause(ctx))
+	}
+
+	// Deadlines carry over
+	deadline, cancelDeadline := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancelDeadline()
+	ctx, cancel = MergeContext(values, deadline)
+	defer cancel()
+	<-ctx.Done()
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		t.Errorf("Expected the deadline to be exceeded, got %v", ctx.Err())
+	}
+
+	// Cancel releases the merged context alone
+	ctx, cancel = MergeContext(values, context.Background())
+	cancel()
+	if ctx.Err() == nil || values.Err() != nil {
+		t.Error("Expected cancel to end the merged context only")
+	}
+}
@@ -0,0 +1,120 @@
+package job
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+)
+
+// Record is the persisted form of a job
+type Record struct {
+	Path     string   `json:"path"`
+	Priority Priority `json:"priority"`
+}
+
+// Persistable is implemented by jobs that can be saved and replayed later
+type Persistable interface {
+	// Record returns the persisted form of the job
+	Record() Record
+}
+
+// queueFile is the on-disk format of a persisted queue
+type queueFile struct {
+	Jobs []Record `json:"jobs"`
+}
+
+// Record implements Persistable
+func (j *FileChangeJob) Record() Record {
+	return Record{Path: j.Path, Priority: j.priority}
+}
+
+// Records returns the records of all persistable jobs, skipping the rest
+func Records(jobs []Job) []Record {
+	var records []Record
+	for _, j := range jobs {
+		if p, ok := j.(Persistable); ok {
+			records = append(records, p.Record())
+		}
+	}
+	return records
+}
+
+// FromRecords recreates file change jobs from persisted records
+func FromRecords(records []Record, proc processor.ProcessManager) []Job {
+	jobs := make([]Job, 0, len(records))
+	for _, r := range records {
+		jobs = append(jobs, NewFileChangeJob(r.Path, proc).WithPriority(r.Priority))
+	}
+	return jobs
+}
+
+// SaveQueue writes records to path, removing the file when there are none
+func SaveQueue(path string, records []Record) error {
+	if len(records) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove queue file: %w", err)
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(queueFile{Jobs: records}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal queue: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create queue directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write queue file: %w", err)
+	}
+	return nil
+}
+
+// AppendQueue adds records to those saved at path. A file already queued
+// is kept once, at the higher of its priorities.
+func AppendQueue(path string, records []Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	existing, err := LoadQueue(path)
+	if err != nil {
+		return err
+	}
+	index := make(map[string]int, len(existing))
+	for i, r := range existing {
+		index[r.Path] = i
+	}
+	for _, r := range records {
+		i, ok := index[r.Path]
+		if !ok {
+			index[r.Path] = len(existing)
+			existing = append(existing, r)
+			continue
+		}
+		if r.Priority < existing[i].Priority {
+			existing[i].Priority = r.Priority
+		}
+	}
+	return SaveQueue(path, existing)
+}
+
+// LoadQueue reads records from path. A missing file yields no records.
+func LoadQueue(path string) ([]Record, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read queue file: %w", err)
+	}
+
+	var q queueFile
+	if err := json.Unmarshal(data, &q); err != nil {
+		return nil, fmt.Errorf("failed to parse queue file: %w", err)
+	}
+	return q.Jobs, nil
+}
@@ -0,0 +1,98 @@
+package job
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestQueuePersistence(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "queue.json")
+
+	t.Run("missing file", func(t *testing.T) {
+		records, err := LoadQueue(path)
+		if err != nil {
+			t.Fatalf("Expected no error for missing file, got %v", err)
+		}
+		if len(records) != 0 {
+			t.Errorf("Expected no records, got %d", len(records))
+		}
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		jobs := []Job{
+			NewFileChangeJob("a.md", nil).WithPriority(PriorityInteractive),
+			NewFileChangeJob("b.md", nil),
+		}
+		if err := SaveQueue(path, Records(jobs)); err != nil {
+			t.Fatalf("Failed to save queue: %v", err)
+		}
+
+		records, err := LoadQueue(path)
+		if err != nil {
+			t.Fatalf("Failed to load queue: %v", err)
+		}
+		restored := FromRecords(records, nil)
+		if len(restored) != 2 {
+			t.Fatalf("Expected 2 jobs, got %d", len(restored))
+		}
+		first := restored[0].(*FileChangeJob)
+		if first.Path != "a.md" || first.Priority() != PriorityInteractive {
+			t.Errorf("Expected a.md at interactive priority, got %s at %s", first.Path, first.Priority())
+		}
+		second := restored[1].(*FileChangeJob)
+		if second.Path != "b.md" || second.Priority() != PriorityBatch {
+			t.Errorf("Expected b.md at batch priority, got %s at %s", second.Path, second.Priority())
+		}
+	})
+
+	t.Run("empty queue removes file", func(t *testing.T) {
+		if err := SaveQueue(path, nil); err != nil {
+			t.Fatalf("Failed to save empty queue: %v", err)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected queue file to be removed, got %v", err)
+		}
+	})
+
+	t.Run("append", func(t *testing.T) {
+		if err := AppendQueue(path, []Record{{Path: "a.md", Priority: PriorityBatch}}); err != nil {
+			t.Fatalf("Failed to append to queue: %v", err)
+		}
+		err := AppendQueue(path, []Record{
+			{Path: "b.md", Priority: PriorityBackground},
+			{Path: "a.md", Priority: PriorityInteractive},
+		})
+		if err != nil {
+			t.Fatalf("Failed to append to queue: %v", err)
+		}
+
+		records, err := LoadQueue(path)
+		if err != nil {
+			t.Fatalf("Failed to load queue: %v", err)
+		}
+		expected := []Record{
+			{Path: "a.md", Priority: PriorityInteractive},
+			{Path: "b.md", Priority: PriorityBackground},
+		}
+		if len(records) != len(expected) {
+			t.Fatalf("Expected %d records, got %d", len(expected), len(records))
+		}
+		for i, r := range records {
+			if r != expected[i] {
+				t.Errorf("Expected record %d to be %+v, got %+v", i, expected[i], r)
+			}
+		}
+		SaveQueue(path, nil)
+	})
+
+	t.Run("corrupt file", func(t *testing.T) {
+		if err := os.WriteFile(path, []byte("{not json"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadQueue(path); err == nil {
+			t.Error("Expected error for corrupt queue file")
+		}
+	})
+}
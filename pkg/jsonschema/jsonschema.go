@@ -0,0 +1,228 @@
+// Package jsonschema validates JSON values against the subset of JSON
+// Schema that describes structured model output: type, properties,
+// required, additionalProperties, items, enum, and the length and range
+// bounds of strings, numbers and arrays.
+//
+// Keywords outside that subset, such as $ref or oneOf, are ignored.
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is a parsed JSON schema
+type Schema struct {
+	raw  json.RawMessage
+	root map[string]interface{}
+}
+
+// Parse parses a JSON schema
+func Parse(data []byte) (*Schema, error) {
+	var root map[string]interface{}
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	return &Schema{raw: append(json.RawMessage(nil), data...), root: root}, nil
+}
+
+// Raw returns the schema as it was parsed
+func (s *Schema) Raw() json.RawMessage {
+	return s.raw
+}
+
+// Validate decodes data and checks it against the schema. The error names
+// the location of the first violation, such as $.contacts[2].email.
+func (s *Schema) Validate(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("invalid JSON: more than one value")
+	}
+	if err := validate(s.root, value, "$"); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// validate checks value at path against schema
+func validate(schema map[string]interface{}, value interface{}, path string) error {
+	if t, ok := schema["type"]; ok && !matchesType(t, value) {
+		return fmt.Errorf("%s: expected %s, got %s", path, describeType(t), typeOf(value))
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && !inEnum(enum, value) {
+		return fmt.Errorf("%s: %s is not one of the allowed values", path, display(value))
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return validateObject(schema, v, path)
+	case []interface{}:
+		if n, ok := number(schema["minItems"]); ok && float64(len(v)) < n {
+			return fmt.Errorf("%s: expected at least %v items, got %d", path, n, len(v))
+		}
+		if n, ok := number(schema["maxItems"]); ok && float64(len(v)) > n {
+			return fmt.Errorf("%s: expected at most %v items, got %d", path, n, len(v))
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				if err := validate(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		length := float64(utf8.RuneCountInString(v))
+		if n, ok := number(schema["minLength"]); ok && length < n {
+			return fmt.Errorf("%s: expected at least %v characters", path, n)
+		}
+		if n, ok := number(schema["maxLength"]); ok && length > n {
+			return fmt.Errorf("%s: expected at most %v characters", path, n)
+		}
+	case json.Number:
+		f, _ := v.Float64()
+		if n, ok := number(schema["minimum"]); ok && f < n {
+			return fmt.Errorf("%s: %s is less than the minimum %v", path, v, n)
+		}
+		if n, ok := number(schema["maximum"]); ok && f > n {
+			return fmt.Errorf("%s: %s is more than the maximum %v", path, v, n)
+		}
+	}
+	return nil
+}
+
+// validateObject checks the properties of an object at path
+func validateObject(schema map[string]interface{}, object map[string]interface{}, path string) error {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, name := range required {
+			if name, ok := name.(string); ok {
+				if _, present := object[name]; !present {
+					return fmt.Errorf("%s: missing required property %s", path, name)
+				}
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		at := path + "." + name
+		if property, ok := properties[name].(map[string]interface{}); ok {
+			if err := validate(property, object[name], at); err != nil {
+				return err
+			}
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				return fmt.Errorf("%s: unexpected property", at)
+			}
+		case map[string]interface{}:
+			if err := validate(additional, object[name], at); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// matchesType reports whether value is of the type, or one of the types,
+// a schema names
+func matchesType(t interface{}, value interface{}) bool {
+	switch t := t.(type) {
+	case string:
+		return isType(t, value)
+	case []interface{}:
+		for _, name := range t {
+			if name, ok := name.(string); ok && isType(name, value) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// isType reports whether value is of the named JSON schema type
+func isType(name string, value interface{}) bool {
+	switch name {
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		_, err := n.Int64()
+		return err == nil
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	default:
+		return typeOf(value) == name
+	}
+}
+
+// typeOf returns the JSON schema type of a decoded value
+func typeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// describeType returns the type or types a schema names
+func describeType(t interface{}) string {
+	if types, ok := t.([]interface{}); ok {
+		names := make([]string, len(types))
+		for i, name := range types {
+			names[i] = fmt.Sprint(name)
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+// inEnum reports whether value equals one of the allowed values
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, allowed := range enum {
+		if display(allowed) == display(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// display returns value as JSON text
+func display(value interface{}) string {
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// number returns a numeric schema keyword
+func number(v interface{}) (float64, bool) {
+	n, ok := v.(float64)
+	return n, ok
+}
@@ -0,0 +1,106 @@
+package jsonschema
+
+import (
+	"strings"
+	"testing"
+)
+
+const contactsSchema = `{
+	"type": "object",
+	"required": ["contacts"],
+	"additionalProperties": false,
+	"properties": {
+		"contacts": {
+			"type": "array",
+			"maxItems": 3,
+			"items": {
+				"type": "object",
+				"required": ["name"],
+				"properties": {
+					"name": {"type": "string", "minLength": 1},
+					"email": {"type": ["string", "null"]},
+					"role": {"enum": ["owner", "reviewer"]},
+					"age": {"type": "integer", "minimum": 0}
+				}
+			}
+		}
+	}
+}`
+
+func TestValidate(t *testing.T) {
+	schema, err := Parse([]byte(contactsSchema))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			data: `{"contacts": [{"name": "Ana", "email": null, "role": "owner", "age": 41}]}`,
+		},
+		{
+			name:    "not JSON",
+			data:    `Here are the contacts`,
+			wantErr: "invalid JSON",
+		},
+		{
+			name:    "missing required",
+			data:    `{}`,
+			wantErr: "$: missing required property contacts",
+		},
+		{
+			name:    "additional property",
+			data:    `{"contacts": [], "notes": ""}`,
+			wantErr: "$.notes: unexpected property",
+		},
+		{
+			name:    "wrong item type",
+			data:    `{"contacts": [{"name": "Ana"}, {"name": 7}]}`,
+			wantErr: "$.contacts[1].name: expected string, got number",
+		},
+		{
+			name:    "not an integer",
+			data:    `{"contacts": [{"name": "Ana", "age": 4.5}]}`,
+			wantErr: "$.contacts[0].age: expected integer, got number",
+		},
+		{
+			name:    "below minimum",
+			data:    `{"contacts": [{"name": "Ana", "age": -1}]}`,
+			wantErr: "$.contacts[0].age: -1 is less than the minimum 0",
+		},
+		{
+			name:    "not in enum",
+			data:    `{"contacts": [{"name": "Ana", "role": "admin"}]}`,
+			wantErr: `$.contacts[0].role: "admin" is not one of the allowed values`,
+		},
+		{
+			name:    "too many items",
+			data:    `{"contacts": [{"name": "a"}, {"name": "b"}, {"name": "c"}, {"name": "d"}]}`,
+			wantErr: "$.contacts: expected at most 3 items, got 4",
+		},
+		{
+			name:    "empty string",
+			data:    `{"contacts": [{"name": ""}]}`,
+			wantErr: "$.contacts[0].name: expected at least 1 characters",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := schema.Validate([]byte(tt.data))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,312 @@
+// Package knowledge indexes the files in an assistant's knowledge/
+// directory as chunks and finds those most relevant to a command.
+//
+// Chunks are ranked by the words they share with the command, weighted by
+// how rare each word is across the knowledge, so that no embedding model
+// is needed. Refresh re-chunks the files that changed since the last
+// refresh and forgets those that were removed.
+package knowledge
+
+import (
+	"crypto/sha256"
+	"fmt"
+	iofs "io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	maxFileSize  = 1024 * 1024 // Larger files are skipped
+	maxChunkSize = 1200        // Characters after which a chunk ends at the next paragraph
+)
+
+// Chunk is a passage of a knowledge file
+type Chunk struct {
+	Source  string // Path of the file, relative to the knowledge directory
+	Heading string // Nearest Markdown heading above the passage, if any
+	Text    string
+
+	terms map[string]int // Occurrences of each word
+}
+
+// Title names the chunk by its file and heading
+func (c Chunk) Title() string {
+	if c.Heading == "" {
+		return c.Source
+	}
+	return c.Source + " > " + c.Heading
+}
+
+// file is an indexed knowledge file
+type file struct {
+	hash   [sha256.Size]byte
+	chunks []Chunk
+}
+
+// Base is the indexed knowledge of one assistant. A nil Base has no
+// knowledge.
+type Base struct {
+	dir   string
+	mu    sync.RWMutex
+	files map[string]*file // By path relative to dir
+}
+
+// Open indexes the files in dir. A missing directory is an empty base.
+func Open(dir string) (*Base, error) {
+	b := &Base{dir: dir, files: make(map[string]*file)}
+	if _, err := b.Refresh(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Dir returns the knowledge directory
+func (b *Base) Dir() string {
+	if b == nil {
+		return ""
+	}
+	return b.dir
+}
+
+// Refresh re-chunks the files whose content changed since they were last
+// indexed, indexes new files and forgets removed ones. It returns the
+// paths, relative to the knowledge directory, that changed.
+func (b *Base) Refresh() ([]string, error) {
+	if b == nil {
+		return nil, nil
+	}
+	contents := make(map[string][]byte)
+	err := filepath.WalkDir(b.dir, func(path string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == b.dir {
+				return iofs.SkipDir
+			}
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && path != b.dir {
+			if d.IsDir() {
+				return iofs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !info.Mode().IsRegular() || info.Size() > maxFileSize {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read knowledge file: %w", err)
+		}
+		if !utf8.Valid(data) {
+			return nil // Not text
+		}
+		rel, err := filepath.Rel(b.dir, path)
+		if err != nil {
+			return err
+		}
+		contents[filepath.ToSlash(rel)] = data
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to index knowledge: %w", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var changed []string
+	for path, data := range contents {
+		hash := sha256.Sum256(data)
+		if f, ok := b.files[path]; ok && f.hash == hash {
+			continue
+		}
+		b.files[path] = &file{hash: hash, chunks: split(path, string(data))}
+		changed = append(changed, path)
+	}
+	for path := range b.files {
+		if _, ok := contents[path]; !ok {
+			delete(b.files, path)
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// Files returns the paths of the indexed files, relative to the knowledge
+// directory, sorted
+func (b *Base) Files() []string {
+	if b == nil {
+		return nil
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	files := make([]string, 0, len(b.files))
+	for path := range b.files {
+		files = append(files, path)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// Len returns the number of chunks
+func (b *Base) Len() int {
+	if b == nil {
+		return 0
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	n := 0
+	for _, f := range b.files {
+		n += len(f.chunks)
+	}
+	return n
+}
+
+// Search returns up to limit chunks sharing words with query, the most
+// relevant first
+func (b *Base) Search(query string, limit int) []Chunk {
+	if b == nil || limit <= 0 {
+		return nil
+	}
+	words := terms(query)
+	if len(words) == 0 {
+		return nil
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var chunks []Chunk
+	df := make(map[string]int)
+	for _, f := range b.files {
+		for _, c := range f.chunks {
+			chunks = append(chunks, c)
+			for word := range words {
+				if c.terms[word] > 0 {
+					df[word]++
+				}
+			}
+		}
+	}
+
+	type scored struct {
+		chunk Chunk
+		score float64
+	}
+	var ranked []scored
+	for _, c := range chunks {
+		score := 0.0
+		for word := range words {
+			if n := c.terms[word]; n > 0 {
+				idf := math.Log(1 + float64(len(chunks))/float64(df[word]))
+				score += (1 + math.Log(float64(n))) * idf
+			}
+		}
+		if score > 0 {
+			ranked = append(ranked, scored{c, score})
+		}
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].score != ranked[j].score {
+			return ranked[i].score > ranked[j].score
+		}
+		if ranked[i].chunk.Source != ranked[j].chunk.Source {
+			return ranked[i].chunk.Source < ranked[j].chunk.Source
+		}
+		return ranked[i].chunk.Text < ranked[j].chunk.Text
+	})
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	result := make([]Chunk, len(ranked))
+	for i, r := range ranked {
+		result[i] = r.chunk
+	}
+	return result
+}
+
+// split divides the content of a file into chunks at Markdown headings
+// and, within long sections, at blank lines
+func split(source, content string) []Chunk {
+	var chunks []Chunk
+	var current strings.Builder
+	heading := ""
+	flush := func() {
+		if text := strings.TrimSpace(current.String()); text != "" {
+			chunks = append(chunks, Chunk{Source: source, Heading: heading, Text: text, terms: counts(heading + " " + text)})
+		}
+		current.Reset()
+	}
+
+	fenced := false
+	for _, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fenced = !fenced
+		}
+		if title, ok := headingTitle(trimmed); ok && !fenced {
+			flush()
+			heading = title
+			continue
+		}
+		// Long sections end at a paragraph, or anywhere when a single
+		// paragraph is too long
+		if (current.Len() >= maxChunkSize && trimmed == "" && !fenced) || current.Len()+len(line) > 2*maxChunkSize {
+			flush()
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+	}
+	flush()
+	return chunks
+}
+
+// headingTitle returns the title of a Markdown heading line
+func headingTitle(line string) (string, bool) {
+	title := strings.TrimLeft(line, "#")
+	level := len(line) - len(title)
+	if level == 0 || level > 6 || !strings.HasPrefix(title, " ") {
+		return "", false
+	}
+	return strings.TrimSpace(title), true
+}
+
+// stopwords are left out of matching, being in nearly every text
+var stopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true,
+	"by": true, "for": true, "from": true, "in": true, "is": true, "it": true, "of": true,
+	"on": true, "or": true, "that": true, "the": true, "this": true, "to": true, "was": true,
+	"what": true, "with": true, "how": true, "do": true, "does": true, "me": true,
+}
+
+// terms returns the distinct words of text worth matching
+func terms(text string) map[string]bool {
+	words := make(map[string]bool)
+	for word := range counts(text) {
+		words[word] = true
+	}
+	return words
+}
+
+// counts returns the occurrences of each word of text worth matching,
+// lowercased
+func counts(text string) map[string]int {
+	result := make(map[string]int)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if utf8.RuneCountInString(word) < 2 || stopwords[word] {
+			continue
+		}
+		result[word]++
+	}
+	return result
+}
@@ -0,0 +1,109 @@
+package knowledge
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	content := "Intro line.\n\n# Pricing\nPlans start at $10.\n\n```sh\n# not a heading\n```\n\n## Refunds\nWithin 30 days.\n"
+	var got []string
+	for _, c := range split("faq.md", content) {
+		got = append(got, c.Title()+": "+strings.ReplaceAll(c.Text, "\n", " "))
+	}
+	expected := []string{
+		"faq.md: Intro line.",
+		"faq.md > Pricing: Plans start at $10.  ```sh # not a heading ```",
+		"faq.md > Refunds: Within 30 days.",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+
+	long := strings.Repeat("word ", 300) + "\n\n" + strings.Repeat("more ", 300)
+	if chunks := split("long.txt", long); len(chunks) != 2 {
+		t.Errorf("Expected a long section to be split at its paragraph, got %d chunks", len(chunks))
+	}
+}
+
+func TestSearch(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"faq.md":         "# Pricing\nPlans start at $10 a month.\n\n# Refunds\nRefunds are granted within 30 days of purchase.\n",
+		"notes/team.txt": "The support team answers refunds questions on weekdays.",
+		".hidden.md":     "Refunds are secret.",
+		"logo.png":       "\x89PNG\r\n\x1a\n\xff\xfe",
+	})
+	b, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if files := b.Files(); !reflect.DeepEqual(files, []string{"faq.md", "notes/team.txt"}) {
+		t.Errorf("Expected the text files to be indexed, got %v", files)
+	}
+
+	got := b.Search("How do refunds of a purchase work?", 2)
+	if len(got) != 2 || got[0].Title() != "faq.md > Refunds" || got[1].Source != "notes/team.txt" {
+		t.Errorf("Unexpected results: %+v", got)
+	}
+	if got := b.Search("the", 2); len(got) != 0 {
+		t.Errorf("Expected no results for stopwords, got %+v", got)
+	}
+
+	var missing *Base
+	if got := missing.Search("refunds", 2); got != nil {
+		t.Errorf("Expected a nil base to have no knowledge, got %+v", got)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.md": "alpha", "b.md": "beta"})
+	b, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	if changed, err := b.Refresh(); err != nil || len(changed) != 0 {
+		t.Errorf("Expected nothing changed, got %v (%v)", changed, err)
+	}
+
+	writeFiles(t, dir, map[string]string{"a.md": "alpha gamma", "c.md": "delta"})
+	if err := os.Remove(filepath.Join(dir, "b.md")); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := b.Refresh()
+	if err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if !reflect.DeepEqual(changed, []string{"a.md", "b.md", "c.md"}) {
+		t.Errorf("Expected a.md, b.md and c.md to change, got %v", changed)
+	}
+	if got := b.Search("gamma", 1); len(got) != 1 || got[0].Source != "a.md" {
+		t.Errorf("Expected the changed file to be re-chunked, got %+v", got)
+	}
+	if got := b.Search("beta", 1); len(got) != 0 {
+		t.Errorf("Expected the removed file to be forgotten, got %+v", got)
+	}
+
+	// A missing directory is empty
+	if b, err := Open(filepath.Join(dir, "missing")); err != nil || b.Len() != 0 {
+		t.Errorf("Expected an empty base, got %d chunks (%v)", b.Len(), err)
+	}
+}
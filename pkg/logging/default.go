@@ -0,0 +1,52 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Default returns a logger that writes through whichever handler is
+// installed with slog.SetDefault at the time of each call. Package-level
+// loggers created before configuration is loaded use it to pick up the
+// configured format, level and output.
+//
+// The returned logger must not itself be installed with slog.SetDefault.
+func Default() *slog.Logger {
+	return slog.New(defaultHandler{})
+}
+
+// defaultHandler forwards records to the current default handler, replaying
+// the attributes and groups added with With and WithGroup
+type defaultHandler struct {
+	ops []func(slog.Handler) slog.Handler
+}
+
+func (h defaultHandler) handler() slog.Handler {
+	base := slog.Default().Handler()
+	for _, op := range h.ops {
+		base = op(base)
+	}
+	return base
+}
+
+func (h defaultHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return slog.Default().Handler().Enabled(ctx, level)
+}
+
+func (h defaultHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.handler().Handle(ctx, r)
+}
+
+func (h defaultHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(base slog.Handler) slog.Handler { return base.WithAttrs(attrs) })
+}
+
+func (h defaultHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(base slog.Handler) slog.Handler { return base.WithGroup(name) })
+}
+
+func (h defaultHandler) with(op func(slog.Handler) slog.Handler) defaultHandler {
+	ops := make([]func(slog.Handler) slog.Handler, len(h.ops), len(h.ops)+1)
+	copy(ops, h.ops)
+	return defaultHandler{ops: append(ops, op)}
+}
@@ -1,12 +1,50 @@
 package logging
 
 import (
+	"fmt"
 	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
+// Output formats accepted by the logging.format setting
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// ParseLevel parses a level name such as "debug" or "WARN"
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return LevelInfo, fmt.Errorf("%w: %q", ErrInvalidLevel, s)
+	}
+}
+
+// SlogLevel converts l to the equivalent slog level
+func (l Level) SlogLevel() slog.Level {
+	switch l {
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelWarn:
+		return slog.LevelWarn
+	case LevelError:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
 // Options configures the logger
 type Options struct {
 	// Level sets the minimum level to log
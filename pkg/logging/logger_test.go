@@ -233,3 +233,75 @@ func TestShortenedSourcePathsInJSONFormat(t *testing.T) {
 		t.Error("Source path is not shortened")
 	}
 }
+
+func TestDefaultForwarding(t *testing.T) {
+	previous := slog.Default()
+	defer slog.SetDefault(previous)
+
+	logger := Default().With("component", "parser")
+
+	// Handlers installed after the logger was created are honored
+	buf := &bytes.Buffer{}
+	slog.SetDefault(NewLogger(&Options{Level: slog.LevelInfo, Output: buf, JSON: true}).With("run_id", "run-1"))
+
+	logger.Debug("hidden")
+	if buf.Len() > 0 {
+		t.Errorf("Debug message logged below configured level: %s", buf.String())
+	}
+
+	logger.Info("test message", "key", "value")
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	for key, want := range map[string]string{"run_id": "run-1", "component": "parser", "key": "value"} {
+		if entry[key] != want {
+			t.Errorf("Expected %s=%s, got %v", key, want, entry[key])
+		}
+	}
+}
+
+func TestContextCorrelation(t *testing.T) {
+	buf := &bytes.Buffer{}
+	fallback := NewLogger(&Options{Level: slog.LevelInfo, Output: buf})
+
+	if got := FromContext(context.Background(), fallback); got != fallback {
+		t.Error("Expected fallback logger without a logger in context")
+	}
+
+	ctx := ContextWithLogger(context.Background(), fallback.With("command_id", "abc"))
+	FromContext(ctx, nil).Info("test message")
+	if !strings.Contains(buf.String(), "command_id=abc") {
+		t.Errorf("Expected correlation attribute from context logger, got: %s", buf.String())
+	}
+
+	if a, b := NewID(), NewID(); len(a) != 16 || a == b {
+		t.Errorf("Expected distinct 16 character IDs, got %q and %q", a, b)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Level
+		wantErr bool
+	}{
+		{"debug", LevelDebug, false},
+		{"INFO", LevelInfo, false},
+		{"warning", LevelWarn, false},
+		{" error ", LevelError, false},
+		{"verbose", LevelInfo, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseLevel(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseLevel() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseLevel() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat names rotated files so they sort by age
+const backupTimeFormat = "20060102T150405.000"
+
+// RotateOptions limits the size and retention of a log file
+type RotateOptions struct {
+	MaxSize    int64         // Bytes written before the file is rotated (0 = never)
+	MaxAge     time.Duration // Rotated files older than this are removed (0 = keep)
+	MaxBackups int           // Rotated files kept (0 = all)
+}
+
+// RotatingFile is an io.WriteCloser that appends to a log file, moving it
+// aside to <name>-<timestamp><ext> once it reaches MaxSize
+type RotatingFile struct {
+	mu   sync.Mutex
+	path string
+	opts RotateOptions
+	file *os.File
+	size int64
+}
+
+// NewRotatingFile opens path for appending, creating it and its directory
+// if needed, and removes rotated files outside the retention limits
+func NewRotatingFile(path string, opts RotateOptions) (*RotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	r := &RotatingFile{path: path, opts: opts}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	r.prune()
+	return r, nil
+}
+
+// Write implements io.Writer, rotating first if p would exceed MaxSize
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return 0, fmt.Errorf("log file %s is closed", r.path)
+	}
+	if r.opts.MaxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.opts.MaxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Close closes the current log file
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// open opens the log file for appending
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+	r.file = f
+	r.size = info.Size()
+	return nil
+}
+
+// rotate moves the current file aside and starts a new one
+func (r *RotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+	r.file = nil
+
+	ext := filepath.Ext(r.path)
+	backup := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(r.path, ext), time.Now().Format(backupTimeFormat), ext)
+	if err := os.Rename(r.path, backup); err != nil {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	r.prune()
+	return nil
+}
+
+// backups returns rotated files, newest first
+func (r *RotatingFile) backups() []string {
+	ext := filepath.Ext(r.path)
+	prefix := strings.TrimSuffix(r.path, ext) + "-"
+	matches, _ := filepath.Glob(prefix + "*" + ext)
+
+	var backups []string
+	for _, m := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(m, prefix), ext)
+		if _, err := time.Parse(backupTimeFormat, stamp); err == nil {
+			backups = append(backups, m)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	return backups
+}
+
+// prune removes rotated files beyond MaxBackups or older than MaxAge
+func (r *RotatingFile) prune() {
+	if r.opts.MaxBackups <= 0 && r.opts.MaxAge <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-r.opts.MaxAge)
+	for i, backup := range r.backups() {
+		if r.opts.MaxBackups > 0 && i >= r.opts.MaxBackups {
+			os.Remove(backup)
+			continue
+		}
+		if r.opts.MaxAge > 0 {
+			if info, err := os.Stat(backup); err == nil && info.ModTime().Before(cutoff) {
+				os.Remove(backup)
+			}
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "skylark.log")
+
+	f, err := NewRotatingFile(path, RotateOptions{MaxSize: 20, MaxBackups: 2})
+	if err != nil {
+		t.Fatalf("Failed to open log file: %v", err)
+	}
+	defer f.Close()
+
+	// Each line fills the file, so every further write rotates
+	for i := 0; i < 4; i++ {
+		if _, err := f.Write([]byte(strings.Repeat("x", 15) + "\n")); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		time.Sleep(2 * time.Millisecond) // Keep backup names distinct
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	if len(content) != 16 {
+		t.Errorf("Expected only the last line in the current file, got %d bytes", len(content))
+	}
+
+	backups := f.backups()
+	if len(backups) != 2 {
+		t.Errorf("Expected 2 backups kept, got %v", backups)
+	}
+
+	// Unrelated files are never treated as backups
+	other := filepath.Join(dir, "skylark-notes.log")
+	if err := os.WriteFile(other, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f.prune()
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("Unrelated file removed: %v", err)
+	}
+}
+
+func TestRotatingFileMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "skylark.log")
+
+	old := filepath.Join(dir, "skylark-20200101T000000.000.log")
+	recent := filepath.Join(dir, "skylark-"+time.Now().Format(backupTimeFormat)+".log")
+	for _, p := range []string{old, recent} {
+		if err := os.WriteFile(p, []byte("entry\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stale := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(old, stale, stale); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := NewRotatingFile(path, RotateOptions{MaxAge: 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to open log file: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("Expected backup older than max age to be removed, got %v", err)
+	}
+	if _, err := os.Stat(recent); err != nil {
+		t.Errorf("Expected recent backup to be kept: %v", err)
+	}
+
+	// Appends to an existing file and tracks its size
+	if _, err := f.Write([]byte("hello\n")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := f.Write([]byte("late\n")); err == nil {
+		t.Error("Expected error writing to closed log file")
+	}
+}
@@ -14,27 +14,40 @@ type LoggerWrapper struct {
 	*slog.Logger
 	level  logging.Level
 	output io.Writer
+	format string
 }
 
-// NewLogger creates a new logger with the given level and output
+// NewLogger creates a new JSON logger with the given level and output
 func NewLogger(level logging.Level, output io.Writer) logging.Logger {
+	return NewLoggerWithFormat(level, output, logging.FormatJSON)
+}
+
+// NewLoggerWithFormat creates a new logger writing in the given format,
+// logging.FormatJSON or logging.FormatText
+func NewLoggerWithFormat(level logging.Level, output io.Writer, format string) logging.Logger {
 	if output == nil {
 		output = os.Stdout
 	}
 
+	return &LoggerWrapper{
+		Logger: slog.New(newHandler(output, level, format)),
+		level:  level,
+		output: output,
+		format: format,
+	}
+}
+
+// newHandler creates the slog handler for a format
+func newHandler(w io.Writer, level logging.Level, format string) slog.Handler {
 	opts := &slog.HandlerOptions{
 		Level: levelToSlog(level),
 	}
-	handler := slog.NewJSONHandler(output, opts).WithAttrs([]slog.Attr{
+	if format == logging.FormatText {
+		return slog.NewTextHandler(w, opts)
+	}
+	return slog.NewJSONHandler(w, opts).WithAttrs([]slog.Attr{
 		slog.String("level", strings.ToLower(level.String())),
 	})
-	logger := slog.New(handler)
-
-	return &LoggerWrapper{
-		Logger: logger,
-		level:  level,
-		output: output,
-	}
 }
 
 // NewLoggerWrapper creates a new wrapped slog logger
@@ -54,13 +67,7 @@ func (l *LoggerWrapper) GetLevel() logging.Level {
 // SetLevel sets the log level
 func (l *LoggerWrapper) SetLevel(level logging.Level) {
 	l.level = level
-	opts := &slog.HandlerOptions{
-		Level: levelToSlog(l.level),
-	}
-	handler := slog.NewJSONHandler(l.output, opts).WithAttrs([]slog.Attr{
-		slog.String("level", strings.ToLower(level.String())),
-	})
-	l.Logger = slog.New(handler)
+	l.Logger = slog.New(newHandler(l.output, l.level, l.format))
 }
 
 // GetOutput returns the current output writer
@@ -71,13 +78,7 @@ func (l *LoggerWrapper) GetOutput() io.Writer {
 // SetOutput sets the output writer
 func (l *LoggerWrapper) SetOutput(w io.Writer) {
 	l.output = w
-	opts := &slog.HandlerOptions{
-		Level: levelToSlog(l.level),
-	}
-	handler := slog.NewJSONHandler(w, opts).WithAttrs([]slog.Attr{
-		slog.String("level", strings.ToLower(l.level.String())),
-	})
-	l.Logger = slog.New(handler)
+	l.Logger = slog.New(newHandler(l.output, l.level, l.format))
 }
 
 // With returns a new logger with the given attributes
@@ -98,6 +99,7 @@ func (l *LoggerWrapper) With(args ...interface{}) logging.Logger {
 		Logger: l.Logger.With(attrs...),
 		level:  l.level,
 		output: l.output,
+		format: l.format,
 	}
 }
 
@@ -107,6 +109,7 @@ func (l *LoggerWrapper) WithGroup(name string) logging.Logger {
 		Logger: l.Logger.WithGroup(name),
 		level:  l.level,
 		output: l.output,
+		format: l.format,
 	}
 }
 
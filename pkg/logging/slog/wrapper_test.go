@@ -208,3 +208,24 @@ func TestLoggerWrapper_Initialization(t *testing.T) {
 		}
 	})
 }
+
+func TestLoggerWrapper_TextFormat(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := NewLoggerWithFormat(logging.LevelInfo, buf, logging.FormatText).With("run_id", "abc")
+
+	logger.Info("test message", "file", "notes.md")
+	got := buf.String()
+	for _, want := range []string{`msg="test message"`, "run_id=abc", "file=notes.md"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %s in text output, got: %s", want, got)
+		}
+	}
+
+	// Changing the level keeps the format
+	buf.Reset()
+	logger.SetLevel(logging.LevelDebug)
+	logger.Debug("debug message")
+	if strings.HasPrefix(buf.String(), "{") || !strings.Contains(buf.String(), "level=DEBUG") {
+		t.Errorf("Expected text output after SetLevel, got: %s", buf.String())
+	}
+}
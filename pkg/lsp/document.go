@@ -0,0 +1,260 @@
+package lsp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+)
+
+// splitLines splits text into lines without their line endings
+func splitLines(text string) []string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return lines
+}
+
+// isCommand reports whether a line holds a command. Invalidated commands
+// start with "-!" and are not matched.
+func isCommand(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "!")
+}
+
+// column converts a byte offset in line to a UTF-16 character offset
+func column(line string, offset int) int {
+	n := 0
+	for _, r := range line[:offset] {
+		n += runeWidth(r)
+	}
+	return n
+}
+
+// offset converts a UTF-16 character offset in line to a byte offset,
+// clamped to the line
+func offset(line string, character int) int {
+	n := 0
+	for i, r := range line {
+		if n >= character {
+			return i
+		}
+		n += runeWidth(r)
+	}
+	return len(line)
+}
+
+// runeWidth returns the number of UTF-16 code units encoding r
+func runeWidth(r rune) int {
+	if r >= 0x10000 && r <= utf8.MaxRune {
+		return 2
+	}
+	return 1
+}
+
+// lineRange returns the range covering a line's content
+func lineRange(lineNum int, line string) Range {
+	return Range{
+		Start: Position{Line: lineNum},
+		End:   Position{Line: lineNum, Character: column(line, len(line))},
+	}
+}
+
+// spanRange returns the range of line[start:end]
+func spanRange(lineNum int, line string, start, end int) Range {
+	return Range{
+		Start: Position{Line: lineNum, Character: column(line, start)},
+		End:   Position{Line: lineNum, Character: column(line, end)},
+	}
+}
+
+// diagnose reports invalid commands, unknown assistants and references
+// that match no section, parsing the sections of the document with inc. A
+// nil assistants set skips the assistant check.
+func diagnose(inc *parser.Incremental, text string, assistants map[string]bool) []Diagnostic {
+	p := parser.New()
+	blocks := inc.ParseBlocks(withoutCommands(text))
+	diagnostics := []Diagnostic{}
+
+	for lineNum, line := range splitLines(text) {
+		if !isCommand(line) {
+			continue
+		}
+
+		cmd, err := p.ParseCommand(line)
+		if err != nil {
+			diagnostics = append(diagnostics, Diagnostic{
+				Range:    lineRange(lineNum, line),
+				Severity: SeverityError,
+				Source:   "skylark",
+				Message:  err.Error(),
+			})
+			continue
+		}
+
+		if assistants != nil && !assistants[cmd.Assistant] {
+			start, end := assistantSpan(line)
+			diagnostics = append(diagnostics, Diagnostic{
+				Range:    spanRange(lineNum, line, start, end),
+				Severity: SeverityError,
+				Source:   "skylark",
+				Message:  fmt.Sprintf("unknown assistant '%s'", cmd.Assistant),
+			})
+		}
+
+		for _, ref := range cmd.References {
+			// Sections of other files are resolved when the command runs
+			if _, _, ok := parser.SplitReference(ref); ok {
+				continue
+			}
+			p.ClearWarnings()
+			p.MatchBlocks(blocks, ref)
+			warnings := p.GetWarnings()
+			if len(warnings) == 0 {
+				continue
+			}
+			r := lineRange(lineNum, line)
+			if i := strings.Index(line, ref); i >= 0 {
+				r = spanRange(lineNum, line, i, i+len(ref))
+			}
+			for _, w := range warnings {
+				diagnostics = append(diagnostics, Diagnostic{
+					Range:    r,
+					Severity: SeverityWarning,
+					Source:   "skylark",
+					Message:  w,
+				})
+			}
+		}
+	}
+	return diagnostics
+}
+
+// withoutCommands blanks out command lines, so a reference is not matched
+// by the command that contains it
+func withoutCommands(text string) string {
+	lines := splitLines(text)
+	for i, line := range lines {
+		if isCommand(line) {
+			lines[i] = ""
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// assistantSpan returns the byte span of the word after "!", which the
+// parser takes as the assistant name when text follows it
+func assistantSpan(line string) (int, int) {
+	start := strings.Index(line, "!") + 1
+	for start < len(line) && (line[start] == ' ' || line[start] == '\t') {
+		start++
+	}
+	end := start
+	for end < len(line) && line[end] != ' ' && line[end] != '\t' {
+		end++
+	}
+	return start, end
+}
+
+// complete suggests assistant names after "!" and section headers inside
+// an open "#" reference
+func complete(text string, pos Position, assistants []processor.AssistantInfo) []CompletionItem {
+	items := []CompletionItem{}
+	lines := splitLines(text)
+	if pos.Line < 0 || pos.Line >= len(lines) {
+		return items
+	}
+	line := lines[pos.Line]
+	cursor := offset(line, pos.Character)
+	prefix := line[:cursor]
+
+	bang := strings.Index(prefix, "!")
+	if bang < 0 || strings.TrimSpace(prefix[:bang]) != "" {
+		return items
+	}
+	body := prefix[bang+1:]
+
+	// Typing the assistant name
+	word := strings.TrimLeft(body, " \t")
+	if !strings.ContainsAny(word, " \t#") {
+		r := spanRange(pos.Line, line, cursor-len(word), cursor)
+		for _, a := range assistants {
+			items = append(items, CompletionItem{
+				Label:    a.Name,
+				Kind:     KindModule,
+				Detail:   a.Description,
+				TextEdit: &TextEdit{Range: r, NewText: a.Name},
+			})
+		}
+		return items
+	}
+
+	// Inside a reference: an odd number of "#" leaves one open
+	if strings.Count(body, "#")%2 == 0 {
+		return items
+	}
+	partial := prefix[strings.LastIndex(prefix, "#")+1:]
+	r := spanRange(pos.Line, line, cursor-len(partial), cursor)
+	for _, header := range headers(text) {
+		items = append(items, CompletionItem{
+			Label:    header,
+			Kind:     KindReference,
+			Detail:   "section",
+			TextEdit: &TextEdit{Range: r, NewText: header + "#"},
+		})
+	}
+	return items
+}
+
+// headers returns the distinct section headers of a document, sorted
+func headers(text string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, block := range parser.New().ParseBlocks(text) {
+		if block.Type != parser.Header || block.Content == "" || seen[block.Content] {
+			continue
+		}
+		seen[block.Content] = true
+		names = append(names, block.Content)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// responseEdit invalidates the command on lineNum and inserts response
+// after it, laid out as the processor lays out responses in files
+func responseEdit(text string, lineNum int, response string) TextEdit {
+	lines := splitLines(text)
+	line := lines[lineNum]
+
+	var b strings.Builder
+	b.WriteString(strings.Replace(line, "!", "-!", 1))
+	b.WriteString("\n\n")
+	b.WriteString(response)
+	if lineNum+1 < len(lines) {
+		next := strings.TrimSpace(lines[lineNum+1])
+		if next != "" && !strings.HasPrefix(next, "!") {
+			b.WriteString("\n")
+		}
+	}
+
+	return TextEdit{Range: lineRange(lineNum, line), NewText: b.String()}
+}
+
+// findCommand locates the command line original, preferring lineNum in
+// case the document changed while the command ran
+func findCommand(text string, lineNum int, original string) (int, bool) {
+	lines := splitLines(text)
+	if lineNum >= 0 && lineNum < len(lines) && lines[lineNum] == original {
+		return lineNum, true
+	}
+	for i, line := range lines {
+		if line == original {
+			return i, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,146 @@
+package lsp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+)
+
+const testDocument = `# Project Plan
+
+## Goals
+Ship it.
+
+!default summarize #Goals# and #docs/*:Overview#
+!writer draft #Missing#
+!nobody help
+-!default already done
+`
+
+func TestDiagnose(t *testing.T) {
+	diagnostics := diagnose(parser.NewIncremental(parser.New()), testDocument, map[string]bool{"default": true, "writer": true})
+
+	if len(diagnostics) != 2 {
+		t.Fatalf("Expected 2 diagnostics, got %d: %+v", len(diagnostics), diagnostics)
+	}
+
+	missing := diagnostics[0]
+	if missing.Severity != SeverityWarning || missing.Range.Start.Line != 6 {
+		t.Errorf("Expected warning on line 6, got %+v", missing)
+	}
+	if !strings.Contains(missing.Message, "Missing") {
+		t.Errorf("Expected message about the unmatched reference, got %q", missing.Message)
+	}
+	if missing.Range.Start.Character != 15 || missing.Range.End.Character != 22 {
+		t.Errorf("Expected the reference to be highlighted, got %+v", missing.Range)
+	}
+
+	unknown := diagnostics[1]
+	if unknown.Severity != SeverityError || unknown.Range.Start.Line != 7 {
+		t.Errorf("Expected error on line 7, got %+v", unknown)
+	}
+	if unknown.Message != "unknown assistant 'nobody'" {
+		t.Errorf("Unexpected message %q", unknown.Message)
+	}
+	if unknown.Range.Start.Character != 1 || unknown.Range.End.Character != 7 {
+		t.Errorf("Expected the assistant name to be highlighted, got %+v", unknown.Range)
+	}
+
+	// Without an assistant list only parse problems are reported
+	if got := diagnose(parser.NewIncremental(parser.New()), "!nobody help\n", nil); len(got) != 0 {
+		t.Errorf("Expected no diagnostics without assistants, got %+v", got)
+	}
+
+	long := "!default " + strings.Repeat("x", 4001)
+	got := diagnose(parser.NewIncremental(parser.New()), long, nil)
+	if len(got) != 1 || got[0].Severity != SeverityError {
+		t.Errorf("Expected an error for an oversized command, got %+v", got)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	assistants := []processor.AssistantInfo{
+		{Name: "default", Description: "General help"},
+		{Name: "writer"},
+	}
+	doc := "# Project Plan\n## Goals\n!wri\n!default see #Go\n!default see #Goals# and\nplain text #\n"
+
+	tests := []struct {
+		name   string
+		pos    Position
+		labels []string
+		edit   string // Expected text of the first item's edit
+		start  int    // Expected start character of the first item's edit
+	}{
+		{"assistant", Position{Line: 2, Character: 4}, []string{"default", "writer"}, "default", 1},
+		{"reference", Position{Line: 3, Character: 16}, []string{"Goals", "Project Plan"}, "Goals#", 14},
+		{"closed reference", Position{Line: 4, Character: 24}, nil, "", 0},
+		{"not a command", Position{Line: 5, Character: 12}, nil, "", 0},
+		{"out of range", Position{Line: 42, Character: 0}, nil, "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items := complete(doc, tt.pos, assistants)
+			if len(items) != len(tt.labels) {
+				t.Fatalf("Expected %d items, got %+v", len(tt.labels), items)
+			}
+			for i, label := range tt.labels {
+				if items[i].Label != label {
+					t.Errorf("Expected item %d to be %q, got %q", i, label, items[i].Label)
+				}
+			}
+			if len(items) == 0 {
+				return
+			}
+			edit := items[0].TextEdit
+			if edit.NewText != tt.edit || edit.Range.Start.Character != tt.start || edit.Range.End.Character != tt.pos.Character {
+				t.Errorf("Unexpected edit: %+v", edit)
+			}
+		})
+	}
+}
+
+func TestResponseEdit(t *testing.T) {
+	doc := "# Notes\n!default hi\nMore text\n!default again\n"
+
+	edit := responseEdit(doc, 1, "Hello!")
+	if edit.NewText != "-!default hi\n\nHello!\n" {
+		t.Errorf("Unexpected edit text %q", edit.NewText)
+	}
+	if edit.Range.Start != (Position{Line: 1}) || edit.Range.End != (Position{Line: 1, Character: 11}) {
+		t.Errorf("Unexpected edit range %+v", edit.Range)
+	}
+
+	// No extra blank line before the end of the file
+	edit = responseEdit(doc, 3, "Again")
+	if edit.NewText != "-!default again\n\nAgain" {
+		t.Errorf("Unexpected edit text %q", edit.NewText)
+	}
+}
+
+func TestFindCommand(t *testing.T) {
+	doc := "# Notes\ninserted line\n!default hi\n"
+	if line, ok := findCommand(doc, 1, "!default hi"); !ok || line != 2 {
+		t.Errorf("Expected moved command on line 2, got %d, %v", line, ok)
+	}
+	if _, ok := findCommand(doc, 2, "!default bye"); ok {
+		t.Error("Expected edited command not to be found")
+	}
+}
+
+func TestColumns(t *testing.T) {
+	line := "!é 😀 x"
+	// é is one UTF-16 unit in two bytes, 😀 two units in four bytes
+	if got := column(line, len(line)); got != 7 {
+		t.Errorf("Expected 7 UTF-16 units, got %d", got)
+	}
+	if got := offset(line, 5); got != 8 {
+		t.Errorf("Expected byte offset 8, got %d", got)
+	}
+	if got := offset(line, 100); got != len(line) {
+		t.Errorf("Expected offset clamped to %d, got %d", len(line), got)
+	}
+}
@@ -0,0 +1,410 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+)
+
+// Options configures a language server
+type Options struct {
+	Catalog processor.Catalog // Assistants to complete and run commands with
+	Version string            // Server version reported to clients
+	Logger  logging.Logger
+}
+
+// Server answers LSP requests for open Markdown documents
+type Server struct {
+	catalog processor.Catalog
+	version string
+	logger  logging.Logger
+
+	conn   *conn
+	nextID atomic.Int64
+	wg     sync.WaitGroup
+
+	mu          sync.Mutex
+	docs        map[string]string              // Open document text by URI
+	parsed      map[string]*parser.Incremental // Parsed sections of open documents by URI
+	initialized bool
+	shutdown    bool
+}
+
+// New creates a language server
+func New(opts Options) (*Server, error) {
+	if opts.Catalog == nil {
+		return nil, fmt.Errorf("catalog required")
+	}
+	if opts.Logger == nil {
+		return nil, fmt.Errorf("logger required")
+	}
+
+	return &Server{
+		catalog: opts.Catalog,
+		version: opts.Version,
+		logger:  opts.Logger.WithGroup("lsp"),
+		docs:    make(map[string]string),
+		parsed:  make(map[string]*parser.Incremental),
+	}, nil
+}
+
+// Serve handles messages read from r, writing to w, until the client
+// sends exit, r ends or ctx is done. Commands started from code actions
+// run in the background and are waited for before Serve returns.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	// Cancel running commands on the way out, then wait for them
+	defer s.wg.Wait()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s.conn = newConn(r, w)
+	msgs := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		for {
+			body, err := s.conn.read()
+			if err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case msgs <- body:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-readErr:
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		case body := <-msgs:
+			if exit := s.handle(ctx, body); exit {
+				return nil
+			}
+		}
+	}
+}
+
+// handle processes one message, reporting whether the client asked to exit
+func (s *Server) handle(ctx context.Context, body []byte) bool {
+	var msg message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		s.reply(json.RawMessage("null"), nil, &rpcError{Code: codeParseError, Message: "parse error"})
+		return false
+	}
+
+	// Responses to our own requests, such as workspace/applyEdit
+	if msg.Method == "" {
+		if msg.Error != nil {
+			s.logger.Warn("client request failed", "error", msg.Error.Message)
+		}
+		return false
+	}
+
+	if msg.Method == "exit" {
+		return true
+	}
+
+	s.mu.Lock()
+	ready := s.initialized && !s.shutdown
+	s.mu.Unlock()
+	if !ready && msg.Method != "initialize" {
+		if len(msg.ID) > 0 {
+			s.reply(msg.ID, nil, &rpcError{Code: codeNotInitialized, Message: "server not initialized"})
+		}
+		return false
+	}
+
+	s.logger.Debug("received message", "method", msg.Method)
+	result, rerr := s.dispatch(ctx, &msg)
+	if len(msg.ID) > 0 {
+		s.reply(msg.ID, result, rerr)
+	}
+	return false
+}
+
+// dispatch routes a message to its method handler
+func (s *Server) dispatch(ctx context.Context, msg *message) (interface{}, *rpcError) {
+	switch msg.Method {
+	case "initialize":
+		return s.initialize()
+	case "shutdown":
+		s.mu.Lock()
+		s.shutdown = true
+		s.mu.Unlock()
+		return nil, nil
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		s.update(ctx, params.TextDocument.URI, params.TextDocument.Text)
+		return nil, nil
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		// Full sync: the last change holds the whole document
+		if n := len(params.ContentChanges); n > 0 {
+			s.update(ctx, params.TextDocument.URI, params.ContentChanges[n-1].Text)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		s.mu.Lock()
+		delete(s.docs, params.TextDocument.URI)
+		delete(s.parsed, params.TextDocument.URI)
+		s.mu.Unlock()
+		s.publish(params.TextDocument.URI, []Diagnostic{})
+		return nil, nil
+	case "textDocument/completion":
+		var params positionParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.completion(ctx, params)
+	case "textDocument/codeAction":
+		var params codeActionParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.codeActions(params), nil
+	case "workspace/executeCommand":
+		var params executeCommandParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.executeCommand(ctx, params)
+	default:
+		if len(msg.ID) == 0 {
+			return nil, nil // Notifications we don't use, such as initialized
+		}
+		return nil, &rpcError{Code: codeMethodNotFound, Message: fmt.Sprintf("method not found: %s", msg.Method)}
+	}
+}
+
+// initialize advertises the server's capabilities
+func (s *Server) initialize() (interface{}, *rpcError) {
+	s.mu.Lock()
+	s.initialized = true
+	s.mu.Unlock()
+
+	return map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			"textDocumentSync": 1, // Full document on every change
+			"completionProvider": map[string]interface{}{
+				"triggerCharacters": []string{"!", "#"},
+			},
+			"codeActionProvider": true,
+			"executeCommandProvider": map[string]interface{}{
+				"commands": []string{RunCommand},
+			},
+		},
+		"serverInfo": map[string]string{
+			"name":    "skylark",
+			"version": s.version,
+		},
+	}, nil
+}
+
+// update stores a document's text and publishes its diagnostics
+func (s *Server) update(ctx context.Context, uri, text string) {
+	s.mu.Lock()
+	s.docs[uri] = text
+	inc, ok := s.parsed[uri]
+	if !ok {
+		inc = parser.NewIncremental(parser.New())
+		s.parsed[uri] = inc
+	}
+	s.mu.Unlock()
+
+	var known map[string]bool
+	if assistants, err := s.catalog.Assistants(ctx); err != nil {
+		s.logger.Warn("failed to list assistants", "error", err)
+	} else {
+		known = make(map[string]bool, len(assistants))
+		for _, a := range assistants {
+			known[a.Name] = true
+		}
+	}
+	s.publish(uri, diagnose(inc, text, known))
+}
+
+// document returns the text of an open document
+func (s *Server) document(uri string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	text, ok := s.docs[uri]
+	return text, ok
+}
+
+// completion suggests assistants and section references
+func (s *Server) completion(ctx context.Context, params positionParams) (interface{}, *rpcError) {
+	text, ok := s.document(params.TextDocument.URI)
+	if !ok {
+		return []CompletionItem{}, nil
+	}
+	assistants, err := s.catalog.Assistants(ctx)
+	if err != nil {
+		return nil, &rpcError{Code: codeInternalError, Message: err.Error()}
+	}
+	return complete(text, params.Position, assistants), nil
+}
+
+// codeActions offers to run each command line in the range
+func (s *Server) codeActions(params codeActionParams) []CodeAction {
+	actions := []CodeAction{}
+	text, ok := s.document(params.TextDocument.URI)
+	if !ok {
+		return actions
+	}
+
+	lines := splitLines(text)
+	for i := params.Range.Start.Line; i <= params.Range.End.Line && i < len(lines); i++ {
+		if i < 0 || !isCommand(lines[i]) {
+			continue
+		}
+		actions = append(actions, CodeAction{
+			Title: "Run Skylark command",
+			Kind:  "source",
+			Command: &Command{
+				Title:     "Run Skylark command",
+				Command:   RunCommand,
+				Arguments: []interface{}{params.TextDocument.URI, i},
+			},
+		})
+	}
+	return actions
+}
+
+// executeCommand starts a command line running in the background. The
+// response is applied with workspace/applyEdit once the assistant answers.
+func (s *Server) executeCommand(ctx context.Context, params executeCommandParams) (interface{}, *rpcError) {
+	if params.Command != RunCommand {
+		return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("unknown command: %s", params.Command)}
+	}
+	var uri string
+	var lineNum int
+	if len(params.Arguments) != 2 ||
+		json.Unmarshal(params.Arguments[0], &uri) != nil ||
+		json.Unmarshal(params.Arguments[1], &lineNum) != nil {
+		return nil, &rpcError{Code: codeInvalidParams, Message: "expected document URI and line arguments"}
+	}
+
+	text, ok := s.document(uri)
+	if !ok {
+		return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("document not open: %s", uri)}
+	}
+	lines := splitLines(text)
+	if lineNum < 0 || lineNum >= len(lines) || !isCommand(lines[lineNum]) {
+		return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("no command on line %d", lineNum+1)}
+	}
+	original := lines[lineNum]
+	cmd, err := parser.New().ParseCommand(original)
+	if err != nil {
+		return nil, &rpcError{Code: codeInvalidParams, Message: err.Error()}
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.run(ctx, uri, lineNum, original, cmd)
+	}()
+	return nil, nil
+}
+
+// run asks the assistant and inserts its response below the command
+func (s *Server) run(ctx context.Context, uri string, lineNum int, original string, cmd *parser.Command) {
+	logger := s.logger.With("uri", uri, "assistant", cmd.Assistant)
+	logger.Info("running command", "line", lineNum+1)
+
+	response, err := s.catalog.Ask(ctx, cmd.Assistant, cmd.Text)
+	if err != nil {
+		logger.Warn("command failed", "error", err)
+		s.showError(fmt.Sprintf("Skylark command failed: %v", err))
+		return
+	}
+
+	text, ok := s.document(uri)
+	if !ok {
+		logger.Warn("document closed before command finished")
+		return
+	}
+	lineNum, ok = findCommand(text, lineNum, original)
+	if !ok {
+		s.showError("Skylark command changed while running; response discarded")
+		return
+	}
+
+	s.request("workspace/applyEdit", applyEditParams{
+		Label: "Skylark: " + strings.TrimSpace(original),
+		Edit: WorkspaceEdit{
+			Changes: map[string][]TextEdit{uri: {responseEdit(text, lineNum, response)}},
+		},
+	})
+}
+
+// publish sends diagnostics for a document
+func (s *Server) publish(uri string, diagnostics []Diagnostic) {
+	s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: diagnostics,
+	})
+}
+
+// showError displays an error message in the client
+func (s *Server) showError(text string) {
+	s.notify("window/showMessage", showMessageParams{Type: 1, Message: text})
+}
+
+// reply sends a result or, when rerr is set, an error response
+func (s *Server) reply(id json.RawMessage, result interface{}, rerr *rpcError) {
+	var resp interface{} = &response{JSONRPC: "2.0", ID: id, Result: result}
+	if rerr != nil {
+		resp = &errorResponse{JSONRPC: "2.0", ID: id, Error: rerr}
+	}
+	if err := s.conn.write(resp); err != nil {
+		s.logger.Error("failed to write response", "error", err)
+	}
+}
+
+// notify sends a notification to the client
+func (s *Server) notify(method string, params interface{}) {
+	if err := s.conn.write(&outgoing{JSONRPC: "2.0", Method: method, Params: params}); err != nil {
+		s.logger.Error("failed to write notification", "method", method, "error", err)
+	}
+}
+
+// request sends a request to the client. Its response is logged only if
+// it reports an error.
+func (s *Server) request(method string, params interface{}) {
+	id := s.nextID.Add(1)
+	if err := s.conn.write(&outgoing{JSONRPC: "2.0", ID: id, Method: method, Params: params}); err != nil {
+		s.logger.Error("failed to write request", "method", method, "error", err)
+	}
+}
+
+// invalidParams wraps a decoding error
+func invalidParams(err error) *rpcError {
+	return &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("invalid params: %v", err)}
+}
@@ -0,0 +1,265 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+	"github.com/butter-bot-machines/skylark/pkg/logging/memory"
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+)
+
+// fakeCatalog implements processor.Catalog for testing
+type fakeCatalog struct {
+	err error // Returned by Ask
+}
+
+func (c *fakeCatalog) Tools(ctx context.Context) ([]processor.ToolInfo, error) {
+	return nil, nil
+}
+
+func (c *fakeCatalog) Assistants(ctx context.Context) ([]processor.AssistantInfo, error) {
+	return []processor.AssistantInfo{{Name: "default"}}, nil
+}
+
+func (c *fakeCatalog) RunTool(ctx context.Context, name string, input string) (string, error) {
+	return "", errors.New("not supported")
+}
+
+func (c *fakeCatalog) Ask(ctx context.Context, assistant string, prompt string) (string, error) {
+	if c.err != nil {
+		return "", c.err
+	}
+	return "Answer to " + prompt, nil
+}
+
+// client drives a server over in-memory pipes
+type client struct {
+	t      *testing.T
+	conn   *conn
+	nextID int
+	done   chan error
+}
+
+func newClient(t *testing.T, catalog processor.Catalog) *client {
+	t.Helper()
+	s, err := New(Options{
+		Catalog: catalog,
+		Version: "test",
+		Logger:  memory.NewLogger(logging.LevelDebug, io.Discard),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	clientRead, serverWrite := io.Pipe()
+	serverRead, clientWrite := io.Pipe()
+	c := &client{
+		t:    t,
+		conn: newConn(clientRead, clientWrite),
+		done: make(chan error, 1),
+	}
+	go func() {
+		c.done <- s.Serve(context.Background(), serverRead, serverWrite)
+		serverWrite.Close()
+	}()
+	return c
+}
+
+// send writes a request, or a notification when id is false
+func (c *client) send(method string, params interface{}, id bool) int {
+	c.t.Helper()
+	msg := map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params}
+	if id {
+		c.nextID++
+		msg["id"] = c.nextID
+	}
+	if err := c.conn.write(msg); err != nil {
+		c.t.Fatalf("Failed to send %s: %v", method, err)
+	}
+	return c.nextID
+}
+
+// next reads messages until one matches, failing after a timeout
+func (c *client) next(match func(*message) bool) *message {
+	c.t.Helper()
+	msgs := make(chan *message)
+	go func() {
+		for {
+			body, err := c.conn.read()
+			if err != nil {
+				close(msgs)
+				return
+			}
+			var msg message
+			if err := json.Unmarshal(body, &msg); err != nil {
+				continue
+			}
+			if match(&msg) {
+				msgs <- &msg
+				return
+			}
+		}
+	}()
+	select {
+	case msg, ok := <-msgs:
+		if !ok {
+			c.t.Fatal("Connection closed while waiting for message")
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("Timed out waiting for message")
+	}
+	return nil
+}
+
+// call sends a request and returns its response
+func (c *client) call(method string, params interface{}) *message {
+	c.t.Helper()
+	id := c.send(method, params, true)
+	want, _ := json.Marshal(id)
+	return c.next(func(m *message) bool { return m.Method == "" && string(m.ID) == string(want) })
+}
+
+// method waits for a message from the server with the given method
+func (c *client) method(name string) *message {
+	c.t.Helper()
+	return c.next(func(m *message) bool { return m.Method == name })
+}
+
+const uri = "file:///notes.md"
+
+func open(c *client, text string) {
+	c.send("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "version": 1, "languageId": "markdown", "text": text},
+	}, false)
+}
+
+func TestServerSession(t *testing.T) {
+	c := newClient(t, &fakeCatalog{})
+
+	// Requests before initialize are rejected
+	if resp := c.call("textDocument/completion", map[string]interface{}{}); resp.Error == nil || resp.Error.Code != codeNotInitialized {
+		t.Errorf("Expected not initialized error, got %+v", resp.Error)
+	}
+
+	resp := c.call("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}})
+	var init struct {
+		Capabilities struct {
+			TextDocumentSync       int `json:"textDocumentSync"`
+			ExecuteCommandProvider struct {
+				Commands []string `json:"commands"`
+			} `json:"executeCommandProvider"`
+		} `json:"capabilities"`
+	}
+	if err := json.Unmarshal(resp.Result, &init); err != nil {
+		t.Fatalf("Failed to decode initialize result: %v", err)
+	}
+	if init.Capabilities.TextDocumentSync != 1 {
+		t.Errorf("Expected full document sync, got %d", init.Capabilities.TextDocumentSync)
+	}
+	if len(init.Capabilities.ExecuteCommandProvider.Commands) != 1 || init.Capabilities.ExecuteCommandProvider.Commands[0] != RunCommand {
+		t.Errorf("Expected %s command, got %v", RunCommand, init.Capabilities.ExecuteCommandProvider.Commands)
+	}
+	c.send("initialized", map[string]interface{}{}, false)
+
+	// Opening a document publishes its diagnostics
+	open(c, "# Notes\n!nobody help\n!default hello\n")
+	var diags publishDiagnosticsParams
+	if err := json.Unmarshal(c.method("textDocument/publishDiagnostics").Params, &diags); err != nil {
+		t.Fatalf("Failed to decode diagnostics: %v", err)
+	}
+	if diags.URI != uri || len(diags.Diagnostics) != 1 || diags.Diagnostics[0].Range.Start.Line != 1 {
+		t.Errorf("Expected one diagnostic on line 1, got %+v", diags)
+	}
+
+	// Completion
+	resp = c.call("textDocument/completion", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri},
+		"position":     map[string]interface{}{"line": 2, "character": 1},
+	})
+	var items []CompletionItem
+	if err := json.Unmarshal(resp.Result, &items); err != nil {
+		t.Fatalf("Failed to decode completions: %v", err)
+	}
+	if len(items) != 1 || items[0].Label != "default" {
+		t.Errorf("Expected the default assistant, got %+v", items)
+	}
+
+	// Code actions cover each command line in the range
+	resp = c.call("textDocument/codeAction", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri},
+		"range":        map[string]interface{}{"start": map[string]int{"line": 0, "character": 0}, "end": map[string]int{"line": 2, "character": 0}},
+	})
+	var actions []CodeAction
+	if err := json.Unmarshal(resp.Result, &actions); err != nil {
+		t.Fatalf("Failed to decode code actions: %v", err)
+	}
+	if len(actions) != 2 || actions[1].Command.Command != RunCommand {
+		t.Fatalf("Expected 2 run actions, got %+v", actions)
+	}
+
+	// Running a command applies its response as an edit
+	resp = c.call("workspace/executeCommand", map[string]interface{}{
+		"command":   RunCommand,
+		"arguments": []interface{}{uri, 2},
+	})
+	if resp.Error != nil {
+		t.Fatalf("Unexpected error: %v", resp.Error)
+	}
+	var apply applyEditParams
+	if err := json.Unmarshal(c.method("workspace/applyEdit").Params, &apply); err != nil {
+		t.Fatalf("Failed to decode edit: %v", err)
+	}
+	edits := apply.Edit.Changes[uri]
+	if len(edits) != 1 || edits[0].NewText != "-!default hello\n\nAnswer to hello" || edits[0].Range.Start.Line != 2 {
+		t.Errorf("Unexpected edit: %+v", apply.Edit)
+	}
+
+	// Unknown lines are rejected
+	resp = c.call("workspace/executeCommand", map[string]interface{}{
+		"command":   RunCommand,
+		"arguments": []interface{}{uri, 0},
+	})
+	if resp.Error == nil || resp.Error.Code != codeInvalidParams {
+		t.Errorf("Expected invalid params for a non-command line, got %+v", resp.Error)
+	}
+
+	if resp := c.call("textDocument/hover", map[string]interface{}{}); resp.Error == nil || resp.Error.Code != codeMethodNotFound {
+		t.Errorf("Expected method not found, got %+v", resp.Error)
+	}
+
+	c.call("shutdown", nil)
+	c.send("exit", nil, false)
+	select {
+	case err := <-c.done:
+		if err != nil {
+			t.Errorf("Serve returned error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not exit")
+	}
+}
+
+func TestServerRunFailure(t *testing.T) {
+	c := newClient(t, &fakeCatalog{err: errors.New("provider down")})
+	c.call("initialize", map[string]interface{}{})
+	open(c, "!default hello\n")
+	c.method("textDocument/publishDiagnostics")
+
+	c.call("workspace/executeCommand", map[string]interface{}{
+		"command":   RunCommand,
+		"arguments": []interface{}{uri, 0},
+	})
+	var shown showMessageParams
+	if err := json.Unmarshal(c.method("window/showMessage").Params, &shown); err != nil {
+		t.Fatalf("Failed to decode message: %v", err)
+	}
+	if shown.Type != 1 || shown.Message != "Skylark command failed: provider down" {
+		t.Errorf("Unexpected message: %+v", shown)
+	}
+}
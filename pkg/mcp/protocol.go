@@ -0,0 +1,111 @@
+// Package mcp serves a project's tools and assistants over the Model
+// Context Protocol, so MCP clients such as desktop assistants and editors
+// can invoke them. Messages are JSON-RPC 2.0 over either stdio or HTTP with
+// server-sent events.
+package mcp
+
+import "encoding/json"
+
+// ProtocolVersion is the MCP revision the server implements
+const ProtocolVersion = "2024-11-05"
+
+// JSON-RPC error codes
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+)
+
+// request is a JSON-RPC request or notification. Notifications have no ID.
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// isNotification reports whether the sender expects no response
+func (r *request) isNotification() bool {
+	return len(r.ID) == 0
+}
+
+// response is a JSON-RPC response
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcError is a JSON-RPC error object
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error implements error
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+// Implementation names a client or server
+type Implementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// initializeParams is sent by the client to open a session
+type initializeParams struct {
+	ProtocolVersion string         `json:"protocolVersion"`
+	ClientInfo      Implementation `json:"clientInfo"`
+}
+
+// initializeResult describes the server to the client
+type initializeResult struct {
+	ProtocolVersion string                 `json:"protocolVersion"`
+	Capabilities    map[string]interface{} `json:"capabilities"`
+	ServerInfo      Implementation         `json:"serverInfo"`
+	Instructions    string                 `json:"instructions,omitempty"`
+}
+
+// Tool is an MCP tool descriptor
+type Tool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+}
+
+// listToolsResult is the tools/list response
+type listToolsResult struct {
+	Tools []Tool `json:"tools"`
+}
+
+// callToolParams is the tools/call request
+type callToolParams struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+// Content is a piece of tool output
+type Content struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// CallToolResult is the tools/call response. Tool failures are reported
+// in the result with IsError set rather than as protocol errors, so the
+// calling model can see them.
+type CallToolResult struct {
+	Content []Content `json:"content"`
+	IsError bool      `json:"isError,omitempty"`
+}
+
+// textResult wraps text in a tool result
+func textResult(text string, isError bool) *CallToolResult {
+	return &CallToolResult{
+		Content: []Content{{Type: "text", Text: text}},
+		IsError: isError,
+	}
+}
@@ -0,0 +1,337 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+)
+
+// AssistantPrefix prefixes the names of the tools that ask an assistant
+const AssistantPrefix = "assistant_"
+
+// maxMessageSize bounds a single JSON-RPC message
+const maxMessageSize = 4 << 20
+
+// Options configures an MCP server
+type Options struct {
+	Catalog processor.Catalog // Tools and assistants to expose
+	Name    string            // Server name reported to clients
+	Version string            // Server version reported to clients
+	Logger  logging.Logger
+}
+
+// Server answers MCP requests from a catalog of tools and assistants
+type Server struct {
+	catalog processor.Catalog
+	info    Implementation
+	logger  logging.Logger
+}
+
+// New creates an MCP server
+func New(opts Options) (*Server, error) {
+	if opts.Catalog == nil {
+		return nil, fmt.Errorf("catalog required")
+	}
+	if opts.Logger == nil {
+		return nil, fmt.Errorf("logger required")
+	}
+	if opts.Name == "" {
+		opts.Name = "skylark"
+	}
+
+	return &Server{
+		catalog: opts.Catalog,
+		info:    Implementation{Name: opts.Name, Version: opts.Version},
+		logger:  opts.Logger.WithGroup("mcp"),
+	}, nil
+}
+
+// ServeStdio reads newline-delimited messages from r and writes responses
+// to w until r is exhausted or ctx is done. Requests are handled
+// concurrently, so a client can ping while a slow tool runs.
+func (s *Server) ServeStdio(ctx context.Context, r io.Reader, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+		for scanner.Scan() {
+			line := append([]byte(nil), scanner.Bytes()...)
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+		readErr <- scanner.Err()
+	}()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	defer wg.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-readErr:
+			if err != nil {
+				return fmt.Errorf("failed to read message: %w", err)
+			}
+			return nil
+		case line := <-lines:
+			if len(strings.TrimSpace(string(line))) == 0 {
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				out := s.Handle(ctx, line)
+				if out == nil {
+					return
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				if _, err := w.Write(append(out, '\n')); err != nil {
+					s.logger.Error("failed to write response", "error", err)
+				}
+			}()
+		}
+	}
+}
+
+// Handle processes a single JSON-RPC message and returns the encoded
+// response, or nil for notifications
+func (s *Server) Handle(ctx context.Context, msg []byte) []byte {
+	var req request
+	if err := json.Unmarshal(msg, &req); err != nil {
+		return encode(&response{
+			JSONRPC: "2.0",
+			ID:      json.RawMessage("null"),
+			Error:   &rpcError{Code: codeParseError, Message: "parse error"},
+		})
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		if req.isNotification() {
+			return nil
+		}
+		return encode(&response{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error:   &rpcError{Code: codeInvalidRequest, Message: "invalid request"},
+		})
+	}
+
+	s.logger.Debug("received request", "method", req.Method)
+	result, rerr := s.dispatch(ctx, &req)
+	if req.isNotification() {
+		return nil
+	}
+
+	resp := &response{JSONRPC: "2.0", ID: req.ID}
+	if rerr != nil {
+		resp.Error = rerr
+	} else {
+		resp.Result = result
+	}
+	return encode(resp)
+}
+
+// dispatch routes a request to its method handler
+func (s *Server) dispatch(ctx context.Context, req *request) (interface{}, *rpcError) {
+	switch req.Method {
+	case "initialize":
+		return s.initialize(req.Params)
+	case "notifications/initialized", "notifications/cancelled":
+		return nil, nil
+	case "ping":
+		return struct{}{}, nil
+	case "tools/list":
+		tools, err := s.listTools(ctx)
+		if err != nil {
+			return nil, &rpcError{Code: codeInternalError, Message: err.Error()}
+		}
+		return &listToolsResult{Tools: tools}, nil
+	case "tools/call":
+		return s.callTool(ctx, req.Params)
+	default:
+		return nil, &rpcError{Code: codeMethodNotFound, Message: fmt.Sprintf("method not found: %s", req.Method)}
+	}
+}
+
+// initialize negotiates the protocol version and advertises tool support
+func (s *Server) initialize(raw json.RawMessage) (interface{}, *rpcError) {
+	var params initializeParams
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &params); err != nil {
+			return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("invalid params: %v", err)}
+		}
+	}
+	s.logger.Info("client connected",
+		"client", params.ClientInfo.Name,
+		"client_version", params.ClientInfo.Version,
+		"protocol_version", params.ProtocolVersion)
+
+	return &initializeResult{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities: map[string]interface{}{
+			"tools": map[string]interface{}{},
+		},
+		ServerInfo:   s.info,
+		Instructions: "Project tools run in a sandbox. Tools prefixed with " + AssistantPrefix + " send a prompt to a project assistant.",
+	}, nil
+}
+
+// listTools maps the catalog's tools and assistants to MCP descriptors
+func (s *Server) listTools(ctx context.Context) ([]Tool, error) {
+	tools, err := s.catalog.Tools(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tools: %w", err)
+	}
+	assistants, err := s.catalog.Assistants(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list assistants: %w", err)
+	}
+
+	result := make([]Tool, 0, len(tools)+len(assistants))
+	for _, t := range tools {
+		result = append(result, Tool{
+			Name:        t.Name,
+			Description: t.Description,
+			InputSchema: inputSchema(t.Parameters),
+		})
+	}
+	for _, a := range assistants {
+		description := fmt.Sprintf("Ask the %s assistant", a.Name)
+		if a.Description != "" {
+			description += ": " + a.Description
+		}
+		result = append(result, Tool{
+			Name:        AssistantPrefix + a.Name,
+			Description: description,
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"prompt": map[string]interface{}{
+						"type":        "string",
+						"description": "What to ask the assistant",
+					},
+				},
+				"required": []string{"prompt"},
+			},
+		})
+	}
+	return result, nil
+}
+
+// inputSchema returns a tool's parameters as an object schema. MCP
+// requires the input schema to describe a JSON object.
+func inputSchema(params map[string]interface{}) map[string]interface{} {
+	schema := make(map[string]interface{}, len(params)+1)
+	for k, v := range params {
+		schema[k] = v
+	}
+	if _, ok := schema["type"]; !ok {
+		schema["type"] = "object"
+	}
+	return schema
+}
+
+// callTool runs a tool or asks an assistant. Project tools take
+// precedence over assistants when names collide.
+func (s *Server) callTool(ctx context.Context, raw json.RawMessage) (interface{}, *rpcError) {
+	var params callToolParams
+	if err := json.Unmarshal(raw, &params); err != nil || params.Name == "" {
+		return nil, &rpcError{Code: codeInvalidParams, Message: "invalid params: tool name required"}
+	}
+
+	isTool, assistant, err := s.resolve(ctx, params.Name)
+	if err != nil {
+		return nil, &rpcError{Code: codeInternalError, Message: err.Error()}
+	}
+
+	logger := s.logger.With("tool", params.Name)
+	var output string
+	switch {
+	case isTool:
+		input := ""
+		if len(params.Arguments) > 0 && string(params.Arguments) != "null" {
+			input = string(params.Arguments)
+		}
+		output, err = s.catalog.RunTool(ctx, params.Name, input)
+	case assistant != "":
+		var args struct {
+			Prompt string `json:"prompt"`
+		}
+		if len(params.Arguments) > 0 {
+			if err := json.Unmarshal(params.Arguments, &args); err != nil {
+				return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("invalid arguments: %v", err)}
+			}
+		}
+		if strings.TrimSpace(args.Prompt) == "" {
+			return nil, &rpcError{Code: codeInvalidParams, Message: "invalid arguments: prompt required"}
+		}
+		output, err = s.catalog.Ask(ctx, assistant, args.Prompt)
+	default:
+		return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("unknown tool: %s", params.Name)}
+	}
+
+	if err != nil {
+		logger.Warn("tool call failed", "error", err)
+		return textResult(err.Error(), true), nil
+	}
+	logger.Debug("tool call succeeded")
+	return textResult(output, false), nil
+}
+
+// resolve reports whether name is a project tool or, failing that, which
+// assistant it asks. Both are empty for unknown names.
+func (s *Server) resolve(ctx context.Context, name string) (bool, string, error) {
+	tools, err := s.catalog.Tools(ctx)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to list tools: %w", err)
+	}
+	for _, t := range tools {
+		if t.Name == name {
+			return true, "", nil
+		}
+	}
+
+	assistantName, ok := strings.CutPrefix(name, AssistantPrefix)
+	if !ok {
+		return false, "", nil
+	}
+	assistants, err := s.catalog.Assistants(ctx)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to list assistants: %w", err)
+	}
+	for _, a := range assistants {
+		if a.Name == assistantName {
+			return false, assistantName, nil
+		}
+	}
+	return false, "", nil
+}
+
+// encode marshals a response, falling back to an internal error
+func encode(resp *response) []byte {
+	out, err := json.Marshal(resp)
+	if err != nil {
+		out, _ = json.Marshal(&response{
+			JSONRPC: "2.0",
+			ID:      resp.ID,
+			Error:   &rpcError{Code: codeInternalError, Message: fmt.Sprintf("failed to encode response: %v", err)},
+		})
+	}
+	return out
+}
@@ -0,0 +1,365 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+	"github.com/butter-bot-machines/skylark/pkg/logging/memory"
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+)
+
+// fakeCatalog implements processor.Catalog for testing
+type fakeCatalog struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (c *fakeCatalog) Tools(ctx context.Context) ([]processor.ToolInfo, error) {
+	return []processor.ToolInfo{
+		{
+			Name:        "echo",
+			Description: "Echoes its input",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"text": map[string]interface{}{"type": "string"},
+				},
+			},
+		},
+		{Name: "fail", Description: "Always fails"},
+	}, nil
+}
+
+func (c *fakeCatalog) Assistants(ctx context.Context) ([]processor.AssistantInfo, error) {
+	return []processor.AssistantInfo{
+		{Name: "default", Description: "General help", Model: "gpt-4"},
+	}, nil
+}
+
+func (c *fakeCatalog) RunTool(ctx context.Context, name string, input string) (string, error) {
+	c.mu.Lock()
+	c.calls = append(c.calls, name+" "+input)
+	c.mu.Unlock()
+	if name == "fail" {
+		return "", errors.New("tool exploded")
+	}
+	return input, nil
+}
+
+func (c *fakeCatalog) Ask(ctx context.Context, assistant string, prompt string) (string, error) {
+	c.mu.Lock()
+	c.calls = append(c.calls, "ask "+assistant+" "+prompt)
+	c.mu.Unlock()
+	return "answer from " + assistant, nil
+}
+
+func newTestServer(t *testing.T, catalog processor.Catalog) *Server {
+	t.Helper()
+	s, err := New(Options{
+		Catalog: catalog,
+		Version: "test",
+		Logger:  memory.NewLogger(logging.LevelDebug, io.Discard),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	return s
+}
+
+// decoded is a response with its result left raw
+type decoded struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+func call(t *testing.T, s *Server, msg string) decoded {
+	t.Helper()
+	out := s.Handle(context.Background(), []byte(msg))
+	if out == nil {
+		t.Fatalf("Expected a response to %s", msg)
+	}
+	var resp decoded
+	if err := json.Unmarshal(out, &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v\n%s", err, out)
+	}
+	return resp
+}
+
+func TestNewValidatesOptions(t *testing.T) {
+	logger := memory.NewLogger(logging.LevelDebug, io.Discard)
+	if _, err := New(Options{Logger: logger}); err == nil {
+		t.Error("Expected error without catalog")
+	}
+	if _, err := New(Options{Catalog: &fakeCatalog{}}); err == nil {
+		t.Error("Expected error without logger")
+	}
+}
+
+func TestInitialize(t *testing.T) {
+	s := newTestServer(t, &fakeCatalog{})
+	resp := call(t, s, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","clientInfo":{"name":"client","version":"1"}}}`)
+	if resp.Error != nil {
+		t.Fatalf("Unexpected error: %v", resp.Error)
+	}
+	if string(resp.ID) != "1" {
+		t.Errorf("Expected id 1, got %s", resp.ID)
+	}
+
+	var result initializeResult
+	if err := json.Unmarshal(resp.Result, &result); err != nil {
+		t.Fatalf("Failed to decode result: %v", err)
+	}
+	if result.ProtocolVersion != ProtocolVersion {
+		t.Errorf("Expected protocol version %s, got %s", ProtocolVersion, result.ProtocolVersion)
+	}
+	if result.ServerInfo.Name != "skylark" || result.ServerInfo.Version != "test" {
+		t.Errorf("Unexpected server info: %+v", result.ServerInfo)
+	}
+	if _, ok := result.Capabilities["tools"]; !ok {
+		t.Error("Expected tools capability")
+	}
+}
+
+func TestListTools(t *testing.T) {
+	s := newTestServer(t, &fakeCatalog{})
+	resp := call(t, s, `{"jsonrpc":"2.0","id":"a","method":"tools/list"}`)
+	if resp.Error != nil {
+		t.Fatalf("Unexpected error: %v", resp.Error)
+	}
+
+	var result listToolsResult
+	if err := json.Unmarshal(resp.Result, &result); err != nil {
+		t.Fatalf("Failed to decode result: %v", err)
+	}
+	if len(result.Tools) != 3 {
+		t.Fatalf("Expected 3 tools, got %d", len(result.Tools))
+	}
+
+	echo := result.Tools[0]
+	if echo.Name != "echo" || echo.Description != "Echoes its input" {
+		t.Errorf("Unexpected tool: %+v", echo)
+	}
+	if _, ok := echo.InputSchema["properties"]; !ok {
+		t.Error("Expected tool parameters in input schema")
+	}
+	if result.Tools[1].InputSchema["type"] != "object" {
+		t.Errorf("Expected object schema for tool without parameters, got %v", result.Tools[1].InputSchema)
+	}
+
+	ask := result.Tools[2]
+	if ask.Name != AssistantPrefix+"default" {
+		t.Errorf("Expected assistant tool, got %s", ask.Name)
+	}
+	if !strings.Contains(ask.Description, "General help") {
+		t.Errorf("Expected assistant description, got %q", ask.Description)
+	}
+}
+
+func TestCallTool(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     string
+		code    int    // Expected protocol error code, 0 for none
+		text    string // Expected result text
+		isError bool
+	}{
+		{
+			name: "tool",
+			msg:  `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hi"}}}`,
+			text: `{"text":"hi"}`,
+		},
+		{
+			name:    "tool failure",
+			msg:     `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"fail"}}`,
+			text:    "tool exploded",
+			isError: true,
+		},
+		{
+			name: "assistant",
+			msg:  `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"assistant_default","arguments":{"prompt":"hello"}}}`,
+			text: "answer from default",
+		},
+		{
+			name: "assistant without prompt",
+			msg:  `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"assistant_default","arguments":{}}}`,
+			code: codeInvalidParams,
+		},
+		{
+			name: "unknown tool",
+			msg:  `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"missing"}}`,
+			code: codeInvalidParams,
+		},
+		{
+			name: "unknown assistant",
+			msg:  `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"assistant_missing","arguments":{"prompt":"hi"}}}`,
+			code: codeInvalidParams,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, &fakeCatalog{})
+			resp := call(t, s, tt.msg)
+			if tt.code != 0 {
+				if resp.Error == nil || resp.Error.Code != tt.code {
+					t.Fatalf("Expected error code %d, got %+v", tt.code, resp.Error)
+				}
+				return
+			}
+			if resp.Error != nil {
+				t.Fatalf("Unexpected error: %v", resp.Error)
+			}
+
+			var result CallToolResult
+			if err := json.Unmarshal(resp.Result, &result); err != nil {
+				t.Fatalf("Failed to decode result: %v", err)
+			}
+			if result.IsError != tt.isError {
+				t.Errorf("Expected isError %v, got %v", tt.isError, result.IsError)
+			}
+			if len(result.Content) != 1 || result.Content[0].Type != "text" {
+				t.Fatalf("Expected one text content, got %+v", result.Content)
+			}
+			if result.Content[0].Text != tt.text {
+				t.Errorf("Expected text %q, got %q", tt.text, result.Content[0].Text)
+			}
+		})
+	}
+}
+
+func TestHandleProtocolErrors(t *testing.T) {
+	s := newTestServer(t, &fakeCatalog{})
+
+	if resp := call(t, s, `{not json`); resp.Error == nil || resp.Error.Code != codeParseError {
+		t.Errorf("Expected parse error, got %+v", resp.Error)
+	}
+	if resp := call(t, s, `{"jsonrpc":"1.0","id":1,"method":"ping"}`); resp.Error == nil || resp.Error.Code != codeInvalidRequest {
+		t.Errorf("Expected invalid request, got %+v", resp.Error)
+	}
+	if resp := call(t, s, `{"jsonrpc":"2.0","id":1,"method":"resources/list"}`); resp.Error == nil || resp.Error.Code != codeMethodNotFound {
+		t.Errorf("Expected method not found, got %+v", resp.Error)
+	}
+	if resp := call(t, s, `{"jsonrpc":"2.0","id":1,"method":"ping"}`); resp.Error != nil || string(resp.Result) != "{}" {
+		t.Errorf("Expected empty ping result, got %s %+v", resp.Result, resp.Error)
+	}
+	if out := s.Handle(context.Background(), []byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)); out != nil {
+		t.Errorf("Expected no response to a notification, got %s", out)
+	}
+}
+
+func TestServeStdio(t *testing.T) {
+	s := newTestServer(t, &fakeCatalog{})
+	in := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		``,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hi"}}}`,
+	}, "\n") + "\n"
+
+	var out strings.Builder
+	if err := s.ServeStdio(context.Background(), strings.NewReader(in), &out); err != nil {
+		t.Fatalf("ServeStdio failed: %v", err)
+	}
+
+	ids := map[string]bool{}
+	scanner := bufio.NewScanner(strings.NewReader(out.String()))
+	for scanner.Scan() {
+		var resp decoded
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+			t.Fatalf("Invalid response line %q: %v", scanner.Text(), err)
+		}
+		if resp.Error != nil {
+			t.Errorf("Unexpected error: %v", resp.Error)
+		}
+		ids[string(resp.ID)] = true
+	}
+	if len(ids) != 2 || !ids["1"] || !ids["2"] {
+		t.Errorf("Expected responses to requests 1 and 2, got %v", ids)
+	}
+}
+
+func TestServeSSE(t *testing.T) {
+	catalog := &fakeCatalog{}
+	ts := httptest.NewServer(newTestServer(t, catalog).SSEHandler())
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/sse", nil)
+	stream, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	defer stream.Body.Close()
+	if ct := stream.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected event stream, got %q", ct)
+	}
+
+	events := bufio.NewReader(stream.Body)
+	event, data := readEvent(t, events)
+	if event != "endpoint" || !strings.HasPrefix(data, "/message?sessionId=") {
+		t.Fatalf("Expected endpoint event, got %q %q", event, data)
+	}
+
+	resp, err := http.Post(ts.URL+data, "application/json",
+		strings.NewReader(`{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"assistant_default","arguments":{"prompt":"hi"}}}`))
+	if err != nil {
+		t.Fatalf("Failed to post message: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("Expected 202, got %d", resp.StatusCode)
+	}
+
+	event, data = readEvent(t, events)
+	if event != "message" {
+		t.Fatalf("Expected message event, got %q", event)
+	}
+	var msg decoded
+	if err := json.Unmarshal([]byte(data), &msg); err != nil {
+		t.Fatalf("Invalid message %q: %v", data, err)
+	}
+	if string(msg.ID) != "7" || msg.Error != nil {
+		t.Errorf("Unexpected response: %s", data)
+	}
+
+	resp, err = http.Post(ts.URL+"/message?sessionId=unknown", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatalf("Failed to post message: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown session, got %d", resp.StatusCode)
+	}
+}
+
+// readEvent reads one server-sent event
+func readEvent(t *testing.T, r *bufio.Reader) (event, data string) {
+	t.Helper()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read event: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			return event, data
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
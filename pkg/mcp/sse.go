@@ -0,0 +1,123 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+)
+
+// sseSession is an open event stream for one client
+type sseSession struct {
+	ctx context.Context // Ends when the client disconnects
+	out chan []byte
+}
+
+// sseTransport serves the HTTP with server-sent events transport
+type sseTransport struct {
+	server   *Server
+	mu       sync.Mutex
+	sessions map[string]*sseSession
+}
+
+// SSEHandler returns an HTTP handler for the SSE transport. Clients open an
+// event stream with GET /sse, receive an "endpoint" event naming the URL
+// to POST messages to, and read the responses as "message" events.
+func (s *Server) SSEHandler() http.Handler {
+	t := &sseTransport{
+		server:   s,
+		sessions: make(map[string]*sseSession),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sse", t.handleStream)
+	mux.HandleFunc("/message", t.handleMessage)
+	return mux
+}
+
+// handleStream opens a session and relays its responses until the client
+// disconnects
+func (t *sseTransport) handleStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	id := logging.NewID()
+	session := &sseSession{
+		ctx: r.Context(),
+		out: make(chan []byte, 16),
+	}
+	t.mu.Lock()
+	t.sessions[id] = session
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.sessions, id)
+		t.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "event: endpoint\ndata: /message?sessionId=%s\n\n", id)
+	flusher.Flush()
+
+	t.server.logger.Debug("sse session opened", "session", id)
+	for {
+		select {
+		case <-session.ctx.Done():
+			t.server.logger.Debug("sse session closed", "session", id)
+			return
+		case msg := <-session.out:
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", msg)
+			flusher.Flush()
+		}
+	}
+}
+
+// handleMessage accepts a message for a session and answers it on the
+// session's event stream
+func (t *sseTransport) handleMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("sessionId")
+	t.mu.Lock()
+	session, ok := t.sessions[id]
+	t.mu.Unlock()
+	if !ok {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+
+	msg, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxMessageSize))
+	if err != nil {
+		http.Error(w, "failed to read message", http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+
+	// Handle in the background; the response goes out on the stream, which
+	// outlives this request
+	go func() {
+		out := t.server.Handle(session.ctx, msg)
+		if out == nil {
+			return
+		}
+		select {
+		case session.out <- out:
+		case <-session.ctx.Done():
+		}
+	}()
+}
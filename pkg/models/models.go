@@ -0,0 +1,162 @@
+// Package models describes what models can do and what they cost. The
+// built-in metadata covers OpenAI's model families; config.yaml overrides
+// it, or describes other models, under model_metadata.
+package models
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+)
+
+// Metadata is the capabilities and prices of a model
+type Metadata struct {
+	ContextWindow   int     // Tokens accepted, prompt and response together
+	Tools           bool    // Accepts tool definitions
+	Vision          bool    // Accepts images
+	PromptPer1K     float64 // Price of 1,000 prompt tokens
+	CompletionPer1K float64 // Price of 1,000 completion tokens
+}
+
+// Cost returns the price of a request using the given tokens
+func (m Metadata) Cost(promptTokens, completionTokens int) float64 {
+	return (float64(promptTokens)*m.PromptPer1K + float64(completionTokens)*m.CompletionPer1K) / 1000
+}
+
+// entry is the metadata of the models whose names start with prefix
+type entry struct {
+	prefix string
+	meta   Metadata
+}
+
+// builtin is the metadata of OpenAI's model families, matched by longest
+// prefix. Prices are in US dollars.
+var builtin = []entry{
+	{"gpt-5", Metadata{400000, true, true, 0.00125, 0.01}},
+	{"gpt-4.5", Metadata{128000, true, true, 0.075, 0.15}},
+	{"gpt-4.1", Metadata{1047576, true, true, 0.002, 0.008}},
+	{"gpt-4.1-mini", Metadata{1047576, true, true, 0.0004, 0.0016}},
+	{"gpt-4.1-nano", Metadata{1047576, true, true, 0.0001, 0.0004}},
+	{"gpt-4o", Metadata{128000, true, true, 0.0025, 0.01}},
+	{"gpt-4o-mini", Metadata{128000, true, true, 0.00015, 0.0006}},
+	{"chatgpt-4o", Metadata{128000, false, true, 0.005, 0.015}},
+	{"o1", Metadata{200000, true, true, 0.015, 0.06}},
+	{"o1-mini", Metadata{128000, false, false, 0.0011, 0.0044}},
+	{"o1-preview", Metadata{128000, false, false, 0.015, 0.06}},
+	{"o3", Metadata{200000, true, true, 0.002, 0.008}},
+	{"o3-mini", Metadata{200000, true, false, 0.0011, 0.0044}},
+	{"o4", Metadata{200000, true, true, 0.0011, 0.0044}},
+	{"gpt-4-turbo", Metadata{128000, true, true, 0.01, 0.03}},
+	{"gpt-4-turbo-preview", Metadata{128000, true, false, 0.01, 0.03}},
+	{"gpt-4-vision", Metadata{128000, false, true, 0.01, 0.03}},
+	{"gpt-4-1106", Metadata{128000, true, false, 0.01, 0.03}},
+	{"gpt-4-0125", Metadata{128000, true, false, 0.01, 0.03}},
+	{"gpt-4-32k", Metadata{32768, true, false, 0.06, 0.12}},
+	{"gpt-4", Metadata{8192, true, false, 0.03, 0.06}},
+	{"gpt-3.5-turbo-instruct", Metadata{4096, false, false, 0.0015, 0.002}},
+	{"gpt-3.5-turbo", Metadata{16385, true, false, 0.0005, 0.0015}},
+	{"text-embedding", Metadata{8191, false, false, 0, 0}},
+	{"text-davinci", Metadata{4097, false, false, 0.02, 0.02}},
+	{"code-davinci", Metadata{8001, false, false, 0, 0}},
+	{"davinci", Metadata{2049, false, false, 0.002, 0.002}},
+}
+
+// defaults holds the built-in metadata only
+var defaults = New(nil)
+
+// Registry looks up the metadata of models. A nil Registry has the built-in
+// metadata only.
+type Registry struct {
+	entries []entry // Longest prefix first
+}
+
+// New creates a registry of the built-in metadata with overrides applied,
+// keyed by model name prefix
+func New(overrides map[string]config.ModelMetadata) *Registry {
+	byPrefix := make(map[string]Metadata, len(builtin)+len(overrides))
+	for _, e := range builtin {
+		byPrefix[e.prefix] = e.meta
+	}
+	for prefix, o := range overrides {
+		prefix = strings.ToLower(prefix)
+		meta, ok := byPrefix[prefix]
+		if !ok {
+			// A new family starts from the one its name falls in
+			meta, _ = lookup(builtinSorted, prefix)
+		}
+		byPrefix[prefix] = override(meta, o)
+	}
+
+	r := &Registry{entries: make([]entry, 0, len(byPrefix))}
+	for prefix, meta := range byPrefix {
+		r.entries = append(r.entries, entry{prefix, meta})
+	}
+	sortEntries(r.entries)
+	return r
+}
+
+// Default returns the registry of the built-in metadata
+func Default() *Registry {
+	return defaults
+}
+
+// Lookup returns the metadata of a model, whose name may carry a
+// "provider:" prefix. It reports false for models it does not describe.
+func (r *Registry) Lookup(model string) (Metadata, bool) {
+	if r == nil {
+		r = defaults
+	}
+	if _, name, ok := strings.Cut(model, ":"); ok {
+		model = name
+	}
+	return lookup(r.entries, strings.ToLower(model))
+}
+
+// builtinSorted is builtin, longest prefix first
+var builtinSorted = func() []entry {
+	entries := append([]entry(nil), builtin...)
+	sortEntries(entries)
+	return entries
+}()
+
+// lookup returns the metadata of the longest prefix of model in entries,
+// which are sorted longest prefix first
+func lookup(entries []entry, model string) (Metadata, bool) {
+	for _, e := range entries {
+		if strings.HasPrefix(model, e.prefix) {
+			return e.meta, true
+		}
+	}
+	return Metadata{}, false
+}
+
+// sortEntries sorts entries longest prefix first, then by prefix
+func sortEntries(entries []entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if len(entries[i].prefix) != len(entries[j].prefix) {
+			return len(entries[i].prefix) > len(entries[j].prefix)
+		}
+		return entries[i].prefix < entries[j].prefix
+	})
+}
+
+// override applies the fields set in o to meta
+func override(meta Metadata, o config.ModelMetadata) Metadata {
+	if o.ContextWindow > 0 {
+		meta.ContextWindow = o.ContextWindow
+	}
+	if o.SupportsTools != nil {
+		meta.Tools = *o.SupportsTools
+	}
+	if o.SupportsVision != nil {
+		meta.Vision = *o.SupportsVision
+	}
+	if o.PromptPer1K != nil {
+		meta.PromptPer1K = *o.PromptPer1K
+	}
+	if o.CompletionPer1K != nil {
+		meta.CompletionPer1K = *o.CompletionPer1K
+	}
+	return meta
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+)
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		model  string
+		window int
+		tools  bool
+		vision bool
+		known  bool
+	}{
+		{"gpt-4", 8192, true, false, true},
+		{"openai:gpt-4-32k-0613", 32768, true, false, true},
+		{"GPT-4o-mini", 128000, true, true, true},
+		{"gpt-4-turbo-preview", 128000, true, false, true},
+		{"o1-mini", 128000, false, false, true},
+		{"local-llama", 0, false, false, false},
+	}
+	for _, tt := range tests {
+		meta, ok := Default().Lookup(tt.model)
+		if ok != tt.known {
+			t.Errorf("Expected %s known = %v, got %v", tt.model, tt.known, ok)
+		}
+		if meta.ContextWindow != tt.window || meta.Tools != tt.tools || meta.Vision != tt.vision {
+			t.Errorf("Expected %s to have window %d, tools %v, vision %v, got %+v", tt.model, tt.window, tt.tools, tt.vision, meta)
+		}
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	yes, no := true, false
+	free := 0.0
+	price := 0.001
+	r := New(map[string]config.ModelMetadata{
+		"gpt-4o":      {PromptPer1K: &free, CompletionPer1K: &free},
+		"gpt-4o-2099": {ContextWindow: 1000000},
+		"llama3":      {ContextWindow: 8192, SupportsTools: &no, SupportsVision: &yes, PromptPer1K: &price},
+	})
+
+	tests := []struct {
+		model string
+		want  Metadata
+	}{
+		// Overrides keep the built-in values they do not set
+		{"gpt-4o", Metadata{128000, true, true, 0, 0}},
+		{"gpt-4o-mini", Metadata{128000, true, true, 0.00015, 0.0006}},
+		// A new family starts from the built-in one it falls in
+		{"gpt-4o-2099-01-01", Metadata{1000000, true, true, 0.0025, 0.01}},
+		{"openai-compatible:llama3:70b", Metadata{8192, false, true, 0.001, 0}},
+	}
+	for _, tt := range tests {
+		meta, ok := r.Lookup(tt.model)
+		if !ok || meta != tt.want {
+			t.Errorf("Expected %s to be %+v, got %+v (%v)", tt.model, tt.want, meta, ok)
+		}
+	}
+}
+
+func TestCost(t *testing.T) {
+	meta := Metadata{PromptPer1K: 0.01, CompletionPer1K: 0.03}
+	if got := meta.Cost(2000, 1000); got < 0.0499 || got > 0.0501 {
+		t.Errorf("Expected a cost of 0.05, got %v", got)
+	}
+}
+
+func TestNilRegistry(t *testing.T) {
+	var r *Registry
+	if meta, ok := r.Lookup("gpt-4"); !ok || meta.ContextWindow != 8192 {
+		t.Errorf("Expected the built-in metadata of gpt-4, got %+v (%v)", meta, ok)
+	}
+}
@@ -0,0 +1,53 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+)
+
+// discordLimit is the longest message content Discord accepts
+const discordLimit = 2000
+
+// messages are the built-in chat messages of each event, rendered with
+// the Event
+var messages = map[string]string{
+	config.NotifyFileProcessed:  `Processed {{.Data.file}}: {{.Data.responses}} response(s){{if .Data.pending}} held for review{{end}}`,
+	config.NotifyCommandFailed:  "Command failed in {{.Data.document}}: `{{.Data.command}}`\n{{.Data.error}}",
+	config.NotifyBudgetExceeded: `Budget limit {{.Data.limit}} reached: {{.Data.detail}}`,
+	config.NotifyWatchStarted:   `Skylark started watching {{.Data.project}}`,
+	config.NotifyWatchStopped:   `Skylark stopped after {{.Data.uptime}}: {{.Data.processed}} file(s) processed, {{.Data.failed}} failed`,
+	config.NotifyDailySummary:   `Skylark on {{.Data.day}}: {{.Data.processed}} file(s) processed, {{.Data.failed}} failed, {{printf "%.2f" .Data.cost}} spent`,
+
+	config.NotifyProviderUnavailable: `Provider {{.Data.provider}} is unavailable, retrying in {{.Data.cooldown}}: {{.Data.error}}`,
+	config.NotifyProviderRecovered:   `Provider {{.Data.provider}} is answering again`,
+}
+
+// chatPayload renders event as a Slack or Discord message, with the
+// template of target or the built-in message of the event
+func chatPayload(target config.NotificationConfig, event Event) ([]byte, error) {
+	text := target.Template
+	if text == "" {
+		text = messages[event.Type]
+	}
+	tmpl, err := template.New(event.Type).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notification template: %w", err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, event); err != nil {
+		return nil, fmt.Errorf("failed to render notification: %w", err)
+	}
+	message := b.String()
+
+	if target.Format == config.NotifyDiscord {
+		if runes := []rune(message); len(runes) > discordLimit {
+			message = string(runes[:discordLimit-1]) + "…"
+		}
+		return json.Marshal(map[string]string{"content": message})
+	}
+	return json.Marshal(map[string]string{"text": message})
+}
@@ -0,0 +1,275 @@
+// Package notify tells webhooks, chat channels and scripts about
+// processing events, such as a document being processed or a command
+// failing. Events are delivered in the background and retried, so a slow
+// or failing receiver never holds up processing.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+	"github.com/butter-bot-machines/skylark/pkg/timing"
+)
+
+var logger = logging.Default()
+
+// Headers of webhook requests
+const (
+	EventHeader     = "X-Skylark-Event"
+	SignatureHeader = "X-Skylark-Signature" // sha256=<hex HMAC-SHA256 of the body>
+)
+
+// DefaultMaxAttempts is how often an event is delivered before giving up,
+// unless a notification sets max_attempts
+const DefaultMaxAttempts = 3
+
+// DefaultTimeout bounds a single delivery
+const DefaultTimeout = 10 * time.Second
+
+// Event is a processing event, sent as JSON
+type Event struct {
+	Type string                 `json:"event"` // One of config.NotifyEvents
+	Time time.Time              `json:"time"`
+	Data map[string]interface{} `json:"data,omitempty"`
+}
+
+// Options configures a Notifier. The zero value works.
+type Options struct {
+	Client    *http.Client  // Sends webhooks (default: one with DefaultTimeout)
+	ConfigDir string        // Relative commands are run from here
+	Backoff   time.Duration // Delay before the first retry, doubled for each further one (default: a second)
+	Clock     timing.Clock  // Waits out retry delays (default: the system clock)
+}
+
+// Notifier delivers events to the configured notifications. A nil
+// Notifier delivers nothing. It is safe for concurrent use.
+type Notifier struct {
+	opts Options
+
+	mu      sync.Mutex
+	targets []config.NotificationConfig
+	subs    map[chan Event]struct{}
+
+	wg sync.WaitGroup // Deliveries in flight
+}
+
+// subscriberBuffer is how many events a subscriber may fall behind by
+// before further events are dropped for it
+const subscriberBuffer = 64
+
+// New creates a notifier delivering to targets
+func New(targets []config.NotificationConfig, opts Options) *Notifier {
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: DefaultTimeout}
+	}
+	if opts.Backoff == 0 {
+		opts.Backoff = time.Second
+	}
+	if opts.Clock == nil {
+		opts.Clock = timing.New()
+	}
+	return &Notifier{opts: opts, targets: targets, subs: make(map[chan Event]struct{})}
+}
+
+// Subscribe returns a channel receiving every event, whether or not a
+// notification subscribes to it, and a function that ends the
+// subscription. Events are dropped rather than holding up processing when
+// the subscriber falls behind. A nil Notifier returns a nil channel.
+func (n *Notifier) Subscribe() (<-chan Event, func()) {
+	if n == nil {
+		return nil, func() {}
+	}
+	ch := make(chan Event, subscriberBuffer)
+	n.mu.Lock()
+	n.subs[ch] = struct{}{}
+	n.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			n.mu.Lock()
+			delete(n.subs, ch)
+			n.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// SetTargets replaces the notifications events are delivered to, such as
+// after the configuration was reloaded
+func (n *Notifier) SetTargets(targets []config.NotificationConfig) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.targets = targets
+}
+
+// Notify delivers event in the background to every notification that
+// subscribes to its type
+func (n *Notifier) Notify(event Event) {
+	if n == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = n.opts.Clock.Now()
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		logger.Warn("failed to encode notification", "event", event.Type, "error", err)
+		return
+	}
+
+	n.mu.Lock()
+	targets := n.targets
+	for ch := range n.subs {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+	n.mu.Unlock()
+	for _, target := range targets {
+		if !subscribed(target, event.Type) {
+			continue
+		}
+		body := body
+		if target.Format.Chat() {
+			if body, err = chatPayload(target, event); err != nil {
+				logger.Warn("failed to build notification", "event", event.Type, "target", describe(target), "error", err)
+				continue
+			}
+		}
+		n.wg.Add(1)
+		go func(target config.NotificationConfig) {
+			defer n.wg.Done()
+			n.deliver(target, event.Type, body)
+		}(target)
+	}
+}
+
+// Close waits for the deliveries in flight, including their retries
+func (n *Notifier) Close() error {
+	if n == nil {
+		return nil
+	}
+	n.wg.Wait()
+	return nil
+}
+
+// deliver sends body to target, retrying with backoff
+func (n *Notifier) deliver(target config.NotificationConfig, eventType string, body []byte) {
+	attempts := target.MaxAttempts
+	if attempts == 0 {
+		attempts = DefaultMaxAttempts
+	}
+	delay := n.opts.Backoff
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if target.URL != "" {
+			err = n.post(target, eventType, body)
+		} else {
+			err = n.run(target, eventType, body)
+		}
+		if err == nil {
+			return
+		}
+		if attempt < attempts {
+			n.opts.Clock.Sleep(delay)
+			delay *= 2
+		}
+	}
+	logger.Warn("failed to deliver notification",
+		"event", eventType,
+		"target", describe(target),
+		"attempts", attempts,
+		"error", err)
+}
+
+// post sends body to a webhook, signed when it has a secret
+func (n *Notifier) post(target config.NotificationConfig, eventType string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, target.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, eventType)
+	if target.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(target.Secret, body))
+	}
+
+	resp, err := n.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+// run runs a script with body on its stdin and the event type in
+// SKYLARK_EVENT
+func (n *Notifier) run(target config.NotificationConfig, eventType string, body []byte) error {
+	command := target.Command
+	if !filepath.IsAbs(command) && n.opts.ConfigDir != "" {
+		command = filepath.Join(n.opts.ConfigDir, command)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command)
+	cmd.Dir = n.opts.ConfigDir
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(cmd.Environ(), "SKYLARK_EVENT="+eventType)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+// Sign returns the signature header value of body: sha256= followed by
+// the hex HMAC-SHA256 of body keyed with secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// subscribed reports whether target wants events of eventType
+func subscribed(target config.NotificationConfig, eventType string) bool {
+	if len(target.Events) == 0 {
+		return true
+	}
+	for _, e := range target.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// describe names target in logs without its secret
+func describe(target config.NotificationConfig) string {
+	if target.URL != "" {
+		return target.URL
+	}
+	return target.Command
+}
@@ -0,0 +1,237 @@
+package notify
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+)
+
+// receiver records the webhook requests it gets, failing the first
+// failures of them
+type receiver struct {
+	mu       sync.Mutex
+	failures int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	if r.failures > 0 {
+		r.failures--
+		w.WriteHeader(http.StatusBadGateway)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	recv := &receiver{failures: 1}
+	srv := httptest.NewServer(recv)
+	defer srv.Close()
+
+	n := New([]config.NotificationConfig{
+		{URL: srv.URL, Secret: "s3cret", Events: []string{config.NotifyCommandFailed}},
+	}, Options{Backoff: time.Millisecond})
+	n.Notify(Event{Type: config.NotifyFileProcessed}) // Not subscribed
+	n.Notify(Event{Type: config.NotifyCommandFailed, Data: map[string]interface{}{"command": "!default hi"}})
+	n.Close()
+
+	// The first delivery fails and is retried
+	if len(recv.requests) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(recv.requests))
+	}
+	req, body := recv.requests[1], recv.bodies[1]
+	if got := req.Header.Get(EventHeader); got != config.NotifyCommandFailed {
+		t.Errorf("Expected event header %s, got %q", config.NotifyCommandFailed, got)
+	}
+	if got, want := req.Header.Get(SignatureHeader), Sign("s3cret", body); got != want {
+		t.Errorf("Expected signature %s, got %q", want, got)
+	}
+
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		t.Fatalf("Invalid body %s: %v", body, err)
+	}
+	if event.Type != config.NotifyCommandFailed || event.Data["command"] != "!default hi" || event.Time.IsZero() {
+		t.Errorf("Unexpected event %+v", event)
+	}
+}
+
+func TestWebhookGivesUp(t *testing.T) {
+	recv := &receiver{failures: 10}
+	srv := httptest.NewServer(recv)
+	defer srv.Close()
+
+	n := New([]config.NotificationConfig{{URL: srv.URL, MaxAttempts: 2}}, Options{Backoff: time.Millisecond})
+	n.Notify(Event{Type: config.NotifyWatchStarted})
+	n.Close()
+
+	if len(recv.requests) != 2 {
+		t.Errorf("Expected 2 attempts, got %d", len(recv.requests))
+	}
+	if got := recv.requests[0].Header.Get(SignatureHeader); got != "" {
+		t.Errorf("Expected no signature without a secret, got %q", got)
+	}
+}
+
+func TestChat(t *testing.T) {
+	recv := &receiver{}
+	srv := httptest.NewServer(recv)
+	defer srv.Close()
+
+	n := New([]config.NotificationConfig{
+		{URL: srv.URL + "/slack", Format: config.NotifySlack},
+		{URL: srv.URL + "/discord", Format: config.NotifyDiscord, Template: "{{.Type}} {{.Data.file}}"},
+	}, Options{})
+	n.Notify(Event{Type: config.NotifyFileProcessed, Data: map[string]interface{}{"file": "notes.md", "responses": 2, "pending": false}})
+	n.Close()
+
+	got := make(map[string]map[string]string)
+	for i, req := range recv.requests {
+		var payload map[string]string
+		if err := json.Unmarshal(recv.bodies[i], &payload); err != nil {
+			t.Fatalf("Invalid payload %s: %v", recv.bodies[i], err)
+		}
+		got[req.URL.Path] = payload
+	}
+	if want := "Processed notes.md: 2 response(s)"; got["/slack"]["text"] != want {
+		t.Errorf("Expected Slack text %q, got %v", want, got["/slack"])
+	}
+	if want := "file_processed notes.md"; got["/discord"]["content"] != want {
+		t.Errorf("Expected Discord content %q, got %v", want, got["/discord"])
+	}
+}
+
+func TestChatPayload(t *testing.T) {
+	tests := []struct {
+		name   string
+		target config.NotificationConfig
+		event  Event
+		want   string
+	}{
+		{
+			name:   "daily summary",
+			target: config.NotificationConfig{Format: config.NotifySlack},
+			event: Event{Type: config.NotifyDailySummary, Data: map[string]interface{}{
+				"day": "2024-03-01", "processed": uint64(12), "failed": uint64(1), "cost": 0.5,
+			}},
+			want: `{"text":"Skylark on 2024-03-01: 12 file(s) processed, 1 failed, 0.50 spent"}`,
+		},
+		{
+			name:   "held for review",
+			target: config.NotificationConfig{Format: config.NotifyDiscord},
+			event: Event{Type: config.NotifyFileProcessed, Data: map[string]interface{}{
+				"file": "a.md", "responses": 1, "pending": true,
+			}},
+			want: `{"content":"Processed a.md: 1 response(s) held for review"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := chatPayload(tt.target, tt.event)
+			if err != nil {
+				t.Fatalf("chatPayload() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	// Discord messages are cut to its limit
+	long := Event{Type: config.NotifyCommandFailed, Data: map[string]interface{}{"error": strings.Repeat("x", 3000)}}
+	got, err := chatPayload(config.NotificationConfig{Format: config.NotifyDiscord}, long)
+	if err != nil {
+		t.Fatalf("chatPayload() error = %v", err)
+	}
+	var payload map[string]string
+	json.Unmarshal(got, &payload)
+	if n := len([]rune(payload["content"])); n != discordLimit {
+		t.Errorf("Expected %d characters, got %d", discordLimit, n)
+	}
+}
+
+func TestCommand(t *testing.T) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho \"$SKYLARK_EVENT\" > event.txt\ncat > body.json\n"
+	if err := os.WriteFile(filepath.Join(dir, "notify.sh"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	n := New([]config.NotificationConfig{{Command: "notify.sh"}}, Options{ConfigDir: dir, Backoff: time.Millisecond})
+	n.Notify(Event{Type: config.NotifyBudgetExceeded, Data: map[string]interface{}{"limit": "max_cost_per_day"}})
+	n.Close()
+
+	event, err := os.ReadFile(filepath.Join(dir, "event.txt"))
+	if err != nil || string(event) != config.NotifyBudgetExceeded+"\n" {
+		t.Errorf("Expected SKYLARK_EVENT=%s, got %q, %v", config.NotifyBudgetExceeded, event, err)
+	}
+	body, err := os.ReadFile(filepath.Join(dir, "body.json"))
+	if err != nil {
+		t.Fatalf("Failed to read body: %v", err)
+	}
+	var got Event
+	if err := json.Unmarshal(body, &got); err != nil || got.Data["limit"] != "max_cost_per_day" {
+		t.Errorf("Unexpected body %s: %v", body, err)
+	}
+}
+
+func TestNilNotifier(t *testing.T) {
+	var n *Notifier
+	n.SetTargets([]config.NotificationConfig{{URL: "http://localhost"}})
+	n.Notify(Event{Type: config.NotifyWatchStopped})
+	if err := n.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	// Subscribers get events no notification subscribes to
+	n := New([]config.NotificationConfig{{URL: "http://localhost", Events: []string{config.NotifyBudgetExceeded}}}, Options{})
+	n.SetTargets(nil)
+	events, unsubscribe := n.Subscribe()
+	n.Notify(Event{Type: config.NotifyFileProcessed, Data: map[string]interface{}{"file": "notes.md"}})
+
+	select {
+	case e := <-events:
+		if e.Type != config.NotifyFileProcessed || e.Data["file"] != "notes.md" || e.Time.IsZero() {
+			t.Errorf("Unexpected event %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the event to reach the subscriber")
+	}
+
+	unsubscribe()
+	unsubscribe()
+	n.Notify(Event{Type: config.NotifyFileProcessed})
+	if _, ok := <-events; ok {
+		t.Error("Expected the channel to be closed after unsubscribing")
+	}
+
+	var nilNotifier *Notifier
+	if ch, stop := nilNotifier.Subscribe(); ch != nil {
+		t.Error("Expected a nil channel from a nil notifier")
+	} else {
+		stop()
+	}
+}
+
+func TestSign(t *testing.T) {
+	// printf '{}' | openssl dgst -sha256 -hmac key
+	want := "sha256=a777724d943eb48dc69bca8a4a6d57a04db3f9ec7e1de4e581e860265bdf3032"
+	if got := Sign("key", []byte("{}")); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,178 @@
+// Package offline tells whether providers can be reached. A Monitor dials
+// the providers' hosts periodically and reports the project offline while
+// none of them answers, or for good when offline mode is forced. While
+// offline, the worker pool holds its jobs and new ones wait in the
+// persisted queue until connectivity returns.
+package offline
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+	"github.com/butter-bot-machines/skylark/pkg/timing"
+)
+
+var logger = logging.Default()
+
+const (
+	defaultInterval = 30 * time.Second
+	dialTimeout     = 5 * time.Second
+)
+
+// Options configures a Monitor
+type Options struct {
+	Hosts    []string      // host:port addresses dialed to check connectivity
+	Interval time.Duration // Time between checks, 30s when zero
+	Forced   bool          // Stay offline whatever the checks find
+	Clock    timing.Clock  // Optional clock, defaults to the system clock
+
+	// Dial connects to an address, net.Dialer when nil
+	Dial func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Monitor tracks whether providers can be reached. A nil Monitor is always
+// online. It is safe for concurrent use.
+type Monitor struct {
+	opts Options
+	stop chan struct{}
+	once sync.Once
+
+	mu      sync.Mutex
+	offline bool
+	changed chan struct{} // Closed and replaced when offline changes
+}
+
+// New creates a monitor. It starts online, or offline when forced, until
+// the first check.
+func New(opts Options) *Monitor {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultInterval
+	}
+	if opts.Clock == nil {
+		opts.Clock = timing.New()
+	}
+	if opts.Dial == nil {
+		opts.Dial = (&net.Dialer{}).DialContext
+	}
+	return &Monitor{
+		opts:    opts,
+		stop:    make(chan struct{}),
+		offline: opts.Forced,
+		changed: make(chan struct{}),
+	}
+}
+
+// Start checks connectivity once, then every interval until Stop. A forced
+// monitor never checks.
+func (m *Monitor) Start() {
+	if m == nil || m.opts.Forced {
+		return
+	}
+	m.Check(context.Background())
+	ticker := m.opts.Clock.NewTicker(m.opts.Interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C():
+				m.Check(context.Background())
+			}
+		}
+	}()
+}
+
+// Stop ends the periodic checks
+func (m *Monitor) Stop() {
+	if m == nil {
+		return
+	}
+	m.once.Do(func() { close(m.stop) })
+}
+
+// Check dials the hosts and updates the state, returning whether any of
+// them answered. Without hosts there is nothing to reach and the project
+// is online. A forced monitor stays offline.
+func (m *Monitor) Check(ctx context.Context) bool {
+	if m == nil {
+		return true
+	}
+	if m.opts.Forced {
+		return false
+	}
+	online := len(m.opts.Hosts) == 0
+	for _, host := range m.opts.Hosts {
+		if m.reach(ctx, host) {
+			online = true
+			break
+		}
+	}
+	m.set(!online)
+	return online
+}
+
+// reach reports whether a connection to host succeeds
+func (m *Monitor) reach(ctx context.Context, host string) bool {
+	ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+	conn, err := m.opts.Dial(ctx, "tcp", host)
+	if err != nil {
+		logger.Debug("connectivity check failed", "host", host, "error", err)
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// set records the state, waking those waiting on Changed if it changed
+func (m *Monitor) set(offline bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.offline == offline {
+		return
+	}
+	m.offline = offline
+	close(m.changed)
+	m.changed = make(chan struct{})
+	if offline {
+		logger.Warn("providers unreachable, going offline", "hosts", m.opts.Hosts)
+	} else {
+		logger.Info("connectivity restored")
+	}
+}
+
+// Offline reports whether providers are out of reach
+func (m *Monitor) Offline() bool {
+	if m == nil {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.offline
+}
+
+// Forced reports whether offline mode was forced
+func (m *Monitor) Forced() bool {
+	return m != nil && m.opts.Forced
+}
+
+// Holding implements worker.Gate, holding jobs while offline
+func (m *Monitor) Holding() bool {
+	return m.Offline()
+}
+
+// Changed implements worker.Gate. The channel is closed once the state
+// changes, so every caller waiting on it wakes; call Changed again for the
+// next change.
+func (m *Monitor) Changed() <-chan struct{} {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.changed
+}
@@ -0,0 +1,116 @@
+package offline
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/timing"
+)
+
+// fakeNetwork answers dials while up
+type fakeNetwork struct {
+	up    int32
+	dials int32
+}
+
+func (n *fakeNetwork) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	atomic.AddInt32(&n.dials, 1)
+	if atomic.LoadInt32(&n.up) == 0 {
+		return nil, errors.New("network is unreachable")
+	}
+	client, server := net.Pipe()
+	server.Close()
+	return client, nil
+}
+
+// changed reports whether ch is closed
+func changed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	network := &fakeNetwork{up: 1}
+	m := New(Options{Hosts: []string{"api.openai.com:443"}, Dial: network.dial})
+
+	if !m.Check(context.Background()) || m.Offline() || m.Holding() {
+		t.Fatal("Expected the monitor to be online")
+	}
+
+	ch := m.Changed()
+	atomic.StoreInt32(&network.up, 0)
+	if m.Check(context.Background()) || !m.Offline() || !m.Holding() {
+		t.Fatal("Expected the monitor to be offline")
+	}
+	if !changed(ch) {
+		t.Error("Expected Changed to fire when going offline")
+	}
+
+	ch = m.Changed()
+	m.Check(context.Background())
+	if changed(ch) {
+		t.Error("Expected no change while staying offline")
+	}
+
+	atomic.StoreInt32(&network.up, 1)
+	if !m.Check(context.Background()) || m.Offline() {
+		t.Fatal("Expected the monitor to be online again")
+	}
+	if !changed(ch) {
+		t.Error("Expected Changed to fire when connectivity returns")
+	}
+}
+
+func TestMonitorStart(t *testing.T) {
+	mock := timing.NewMock()
+	network := &fakeNetwork{}
+	m := New(Options{Hosts: []string{"a:443", "b:443"}, Interval: time.Minute, Clock: mock, Dial: network.dial})
+	m.Start()
+	defer m.Stop()
+
+	if !m.Offline() {
+		t.Fatal("Expected the first check to find the monitor offline")
+	}
+	ch := m.Changed()
+	atomic.StoreInt32(&network.up, 1)
+	mock.Add(time.Minute)
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the next check to find connectivity")
+	}
+	if m.Offline() {
+		t.Error("Expected the monitor to be online")
+	}
+}
+
+func TestMonitorForced(t *testing.T) {
+	network := &fakeNetwork{up: 1}
+	m := New(Options{Hosts: []string{"api.openai.com:443"}, Forced: true, Dial: network.dial})
+	m.Start()
+	defer m.Stop()
+
+	if m.Check(context.Background()) || !m.Offline() || !m.Forced() {
+		t.Error("Expected a forced monitor to stay offline")
+	}
+	if n := atomic.LoadInt32(&network.dials); n != 0 {
+		t.Errorf("Expected a forced monitor not to dial, got %d dials", n)
+	}
+}
+
+func TestMonitorNil(t *testing.T) {
+	var m *Monitor
+	m.Start()
+	m.Stop()
+	if m.Offline() || m.Holding() || m.Forced() || !m.Check(context.Background()) {
+		t.Error("Expected a nil monitor to be online")
+	}
+}
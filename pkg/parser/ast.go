@@ -0,0 +1,191 @@
+package parser
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// markdown parses CommonMark with GitHub tables
+var markdown = goldmark.New(goldmark.WithExtensions(extension.Table))
+
+// astSource maps byte offsets of a document to its lines
+type astSource struct {
+	source []byte
+	lines  []string
+	starts []int // Byte offset of each line
+}
+
+func newASTSource(content string) *astSource {
+	s := &astSource{source: []byte(content), lines: strings.Split(content, "\n")}
+	offset := 0
+	for _, line := range s.lines {
+		s.starts = append(s.starts, offset)
+		offset += len(line) + 1
+	}
+	return s
+}
+
+// lineOf returns the line containing the byte at offset
+func (s *astSource) lineOf(offset int) int {
+	return sort.Search(len(s.starts), func(i int) bool { return s.starts[i] > offset }) - 1
+}
+
+// span returns the first and last source lines of a block and its
+// children, including the fences of fenced code blocks
+func (s *astSource) span(node ast.Node) (first, last int, ok bool) {
+	first, last = len(s.lines), -1
+	add := func(seg text.Segment) {
+		if seg.Stop <= seg.Start {
+			return
+		}
+		if l := s.lineOf(seg.Start); l < first {
+			first = l
+		}
+		if l := s.lineOf(seg.Stop - 1); l > last {
+			last = l
+		}
+	}
+
+	_ = ast.Walk(node, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering || n.Type() != ast.TypeBlock {
+			return ast.WalkContinue, nil
+		}
+		lines := n.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			add(lines.At(i))
+		}
+
+		switch b := n.(type) {
+		case *ast.FencedCodeBlock:
+			if b.Info != nil {
+				add(b.Info.Segment)
+			} else if lines.Len() > 0 {
+				// The opening fence is the line above the code
+				open := s.lineOf(lines.At(0).Start) - 1
+				if open >= 0 && open < first {
+					first = open
+				}
+			}
+			if lines.Len() > 0 {
+				closing := s.lineOf(lines.At(lines.Len()-1).Stop-1) + 1
+				if closing < len(s.lines) && isFence(s.lines[closing]) && closing > last {
+					last = closing
+				}
+			}
+		case *ast.HTMLBlock:
+			if b.HasClosure() {
+				add(b.ClosureLine)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	return first, last, last >= first
+}
+
+// text returns the source lines of a block, without trailing blank lines
+func (s *astSource) text(node ast.Node) []string {
+	first, last, ok := s.span(node)
+	if !ok {
+		return nil
+	}
+	lines := make([]string, 0, last-first+1)
+	for _, line := range s.lines[first : last+1] {
+		lines = append(lines, strings.TrimRight(line, " \t"))
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// value returns the text of a leaf block's lines
+func (s *astSource) value(node ast.Node) string {
+	var b strings.Builder
+	lines := node.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		seg := lines.At(i)
+		b.Write(seg.Value(s.source))
+	}
+	return b.String()
+}
+
+// isFence reports whether a line, inside any block quotes, is a code fence
+func isFence(line string) bool {
+	line = strings.TrimLeft(line, " \t>")
+	return strings.HasPrefix(line, "```") || strings.HasPrefix(line, "~~~")
+}
+
+// parseBlocksAST parses content with goldmark into the same blocks as
+// ParseBlocks. Nested lists keep their indentation, setext headers are
+// headers, HTML blocks are kept whole, and front matter and thematic
+// breaks are skipped.
+func parseBlocksAST(content string) []Block {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	s := newASTSource(stripFrontMatter(content))
+	doc := markdown.Parser().Parse(text.NewReader(s.source))
+
+	var blocks []Block
+	for node := doc.FirstChild(); node != nil; node = node.NextSibling() {
+		switch n := node.(type) {
+		case *ast.Heading:
+			title := strings.Join(strings.Fields(s.value(n)), " ")
+			blocks = append(blocks, Block{Type: Header, Level: n.Level, Content: title})
+
+		case *ast.Paragraph, *ast.TextBlock:
+			blocks = append(blocks, Block{Type: Paragraph, Content: strings.Join(s.text(n), "\n")})
+
+		case *ast.List:
+			blocks = append(blocks, Block{Type: List, Content: strings.Join(s.text(n), "\n")})
+
+		case *ast.Blockquote:
+			lines := s.text(n)
+			for i, line := range lines {
+				line = strings.TrimLeft(line, " \t")
+				line = strings.TrimPrefix(line, ">")
+				lines[i] = strings.TrimPrefix(line, " ")
+			}
+			blocks = append(blocks, Block{Type: Quote, Content: strings.Join(lines, "\n")})
+
+		case *ast.FencedCodeBlock, *ast.CodeBlock:
+			code := strings.TrimSuffix(s.value(n), "\n")
+			blocks = append(blocks, Block{Type: Code, Content: code})
+
+		case *extast.Table:
+			lines := s.text(n)
+			first, _, _ := s.span(n)
+			if len(lines) == 1 && first+1 < len(s.lines) {
+				// A table with only a header row still has its delimiter row
+				lines = append(lines, s.lines[first+1])
+			}
+			for i, line := range lines {
+				lines[i] = strings.TrimSpace(line)
+			}
+			blocks = append(blocks, Block{Type: Table, Content: strings.Join(lines, "\n")})
+
+		case *ast.HTMLBlock:
+			blocks = append(blocks, Block{Type: HTML, Content: strings.Join(s.text(n), "\n")})
+		}
+	}
+	return blocks
+}
+
+// stripFrontMatter removes a leading YAML front matter block, closed by a
+// line of --- or ...
+func stripFrontMatter(content string) string {
+	if !strings.HasPrefix(content, "---\n") {
+		return content
+	}
+	lines := strings.Split(content, "\n")
+	for i := 1; i < len(lines); i++ {
+		if line := strings.TrimRight(lines[i], " \t"); line == "---" || line == "..." {
+			return strings.Join(lines[i+1:], "\n")
+		}
+	}
+	return content
+}
@@ -0,0 +1,125 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Flags a command may give after its assistant and before its text, as in
+// !summarize --model gpt-4o-mini --max-words 200 --no-tools text
+const (
+	FlagModel       = "model"       // Model the command is sent to
+	FlagMaxWords    = "max-words"   // Longest response in words
+	FlagNoTools     = "no-tools"    // Answer without tools
+	FlagTemperature = "temperature" // Sampling temperature, 0 to 2
+	FlagMaxTokens   = "max-tokens"  // Longest response in tokens
+)
+
+// flag describes a command flag. Flags without a check take no value.
+type flag struct {
+	check func(value string) error
+}
+
+// flags are the known command flags by name
+var flags = map[string]flag{
+	FlagModel:       {check: nonEmpty},
+	FlagMaxWords:    {check: positiveInt},
+	FlagNoTools:     {},
+	FlagTemperature: {check: temperature},
+	FlagMaxTokens:   {check: positiveInt},
+}
+
+// Option returns the value of a flag given to the command
+func (c *Command) Option(name string) (string, bool) {
+	value, ok := c.Options[name]
+	return value, ok
+}
+
+// Flag reports whether the command was given a flag
+func (c *Command) Flag(name string) bool {
+	_, ok := c.Options[name]
+	return ok
+}
+
+// parseFlags takes the flags from the start of text, up to the first word
+// that is not a flag or a bare --, and returns them with the rest of the
+// text. Values follow their flag after a space or =. --schema and
+// --format are left in the text.
+func parseFlags(text string) (map[string]string, string, error) {
+	var options map[string]string
+	for strings.HasPrefix(text, "--") {
+		token, rest := cutWord(text)
+		if token == "--" {
+			return options, rest, nil
+		}
+		name, value, hasValue := strings.Cut(token[2:], "=")
+		if name == "schema" || name == "format" {
+			break
+		}
+		f, ok := flags[name]
+		if !ok {
+			return nil, "", fmt.Errorf("unknown flag --%s, expected one of %s", name, knownFlags())
+		}
+		switch {
+		case f.check == nil && hasValue:
+			return nil, "", fmt.Errorf("flag --%s takes no value", name)
+		case f.check != nil && !hasValue:
+			value, rest = cutWord(rest)
+		}
+		if f.check != nil {
+			if err := f.check(value); err != nil {
+				return nil, "", fmt.Errorf("flag --%s: %w", name, err)
+			}
+		}
+		if options == nil {
+			options = make(map[string]string)
+		}
+		options[name] = value
+		text = rest
+	}
+	return options, text, nil
+}
+
+// cutWord splits the first word off text, which may end in a space or a
+// line break
+func cutWord(text string) (string, string) {
+	i := strings.IndexFunc(text, unicode.IsSpace)
+	if i < 0 {
+		return text, ""
+	}
+	return text[:i], strings.TrimSpace(text[i:])
+}
+
+// knownFlags lists the flag names for error messages
+func knownFlags() string {
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		names = append(names, "--"+name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func nonEmpty(value string) error {
+	if value == "" {
+		return fmt.Errorf("value required")
+	}
+	return nil
+}
+
+func positiveInt(value string) error {
+	if n, err := strconv.Atoi(value); err != nil || n < 1 {
+		return fmt.Errorf("expected a positive whole number, got %q", value)
+	}
+	return nil
+}
+
+func temperature(value string) error {
+	if t, err := strconv.ParseFloat(value, 64); err != nil || t < 0 || t > 2 {
+		return fmt.Errorf("expected a number from 0 to 2, got %q", value)
+	}
+	return nil
+}
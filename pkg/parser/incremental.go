@@ -0,0 +1,163 @@
+package parser
+
+import (
+	"strings"
+	"sync"
+)
+
+// parsedCommands are the commands of a section, or the error parsing them
+type parsedCommands struct {
+	commands []*Command
+	err      error
+}
+
+// Incremental parses successive versions of a document, re-parsing only
+// the sections that changed since the previous version. A document is
+// split into sections at the headings outside code blocks, and the blocks
+// and commands of each section are cached by its content, so an edit
+// re-parses the section it falls in only. Results are those of
+// the wrapped parser. An Incremental is safe for concurrent use.
+type Incremental struct {
+	parser *Parser
+
+	mu       sync.Mutex
+	blocks   map[string][]Block        // Of the sections of the last version parsed
+	commands map[string]parsedCommands // Of the sections of the last version parsed
+}
+
+// NewIncremental creates an incremental parser of one document, parsing
+// with p
+func NewIncremental(p *Parser) *Incremental {
+	return &Incremental{
+		parser:   p,
+		blocks:   make(map[string][]Block),
+		commands: make(map[string]parsedCommands),
+	}
+}
+
+// ParseBlocks parses content into blocks as Parser.ParseBlocks does. With
+// the AST option, a changed document is parsed whole.
+func (inc *Incremental) ParseBlocks(content string) []Block {
+	sections := []string{content}
+	if !inc.parser.ast {
+		sections = splitSections(content)
+	}
+
+	inc.mu.Lock()
+	defer inc.mu.Unlock()
+	cached := make(map[string][]Block, len(sections))
+	n := 0
+	for _, section := range sections {
+		parsed, ok := inc.blocks[section]
+		if !ok {
+			parsed = inc.parser.ParseBlocks(section)
+		}
+		cached[section] = parsed
+		n += len(parsed)
+	}
+	inc.blocks = cached
+
+	var blocks []Block
+	if n > 0 {
+		blocks = make([]Block, 0, n)
+	}
+	for _, section := range sections {
+		blocks = append(blocks, cached[section]...)
+	}
+	return blocks
+}
+
+// ParseCommands parses the commands of content as Parser.ParseCommands
+// does. The commands returned are the caller's to change.
+func (inc *Incremental) ParseCommands(content string) ([]*Command, error) {
+	sections := splitSections(content)
+
+	inc.mu.Lock()
+	defer inc.mu.Unlock()
+	var commands []*Command
+	cached := make(map[string]parsedCommands, len(sections))
+	for _, section := range sections {
+		parsed, ok := inc.commands[section]
+		if !ok {
+			parsed.commands, parsed.err = inc.parser.ParseCommands(section)
+		}
+		cached[section] = parsed
+		if parsed.err != nil {
+			inc.commands = cached
+			return nil, parsed.err
+		}
+		for _, cmd := range parsed.commands {
+			commands = append(commands, cmd.clone())
+		}
+	}
+	inc.commands = cached
+	return commands, nil
+}
+
+// splitSections splits content into sections that parse as they do
+// within content, and join with newlines into it again. A section starts
+// at each line beginning with # outside code blocks, unless the line above
+// continues a command onto it. Sections share the memory of content.
+func splitSections(content string) []string {
+	var sections []string
+	start := 0
+	code := false // In a code block of ParseBlocks
+	fence := ""   // Opening fence of the code block of CommandLines
+	previous := ""
+	for pos := 0; pos <= len(content); {
+		end := strings.IndexByte(content[pos:], '\n')
+		if end < 0 {
+			end = len(content)
+		} else {
+			end += pos
+		}
+		line := content[pos:end]
+		if pos > start && !code && fence == "" && strings.HasPrefix(line, "#") &&
+			!strings.HasSuffix(strings.TrimSpace(previous), "\\") {
+			sections = append(sections, content[start:pos-1])
+			start = pos
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			code = !code || trimmed != "```"
+		}
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+			}
+		} else {
+			fence = fenceOf(trimmed)
+		}
+		previous = line
+		pos = end + 1
+	}
+	return append(sections, content[start:])
+}
+
+// clone returns a copy of the command sharing nothing the processor fills
+// in or changes
+func (c *Command) clone() *Command {
+	cmd := *c
+	cmd.References = append([]string(nil), c.References...)
+	cmd.Links = append([]Link(nil), c.Links...)
+	cmd.Images = append([]Image(nil), c.Images...)
+	cmd.History = append([]Exchange(nil), c.History...)
+	if c.Context != nil {
+		cmd.Context = make(map[string]Block, len(c.Context))
+		for k, v := range c.Context {
+			cmd.Context[k] = v
+		}
+	}
+	if c.Options != nil {
+		cmd.Options = make(map[string]string, len(c.Options))
+		for k, v := range c.Options {
+			cmd.Options[k] = v
+		}
+	}
+	if c.Schema != nil {
+		schema := *c.Schema
+		cmd.Schema = &schema
+	}
+	return &cmd
+}
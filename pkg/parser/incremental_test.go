@@ -0,0 +1,151 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// largeDocument returns a document of n sections, each with a command,
+// a list, a quote, a table and a code block
+func largeDocument(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "## Section %d\n\nSome text about section %d.\nMore text.\n\n", i, i)
+		fmt.Fprintf(&b, "!writer summarize #Section %d# \\\n  in two lines\n\n", i)
+		b.WriteString("- one\n- two\n\n> quoted\n\n| a | b |\n|---|---|\n| 1 | 2 |\n\n")
+		b.WriteString("```go\n# not a heading\n!not a command\n```\n\n")
+	}
+	return b.String()
+}
+
+func TestSplitSections(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    int
+	}{
+		{"no headings", "text\n\nmore", 1},
+		{"headings", "intro\n# One\ntext\n## Two\ntext", 3},
+		{"heading first", "# One\ntext\n# Two", 2},
+		{"in code", "# One\n```\n# code\n```\n# Two", 2},
+		{"in tilde fence", "# One\n~~~\n# code\n~~~\n# Two", 2},
+		{"indented", "# One\n  # indented\n# Two", 2},
+		{"after continued command", "!writer draft \\\n# title\n# Two", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sections := splitSections(tt.content)
+			if len(sections) != tt.want {
+				t.Errorf("Expected %d sections, got %q", tt.want, sections)
+			}
+			if joined := strings.Join(sections, "\n"); joined != tt.content {
+				t.Errorf("Expected sections to join to the content, got %q", joined)
+			}
+		})
+	}
+}
+
+func TestIncremental(t *testing.T) {
+	p := New()
+	inc := NewIncremental(p)
+	versions := []string{
+		largeDocument(5),
+		strings.Replace(largeDocument(5), "More text.", "Edited text.", 1),
+		strings.Replace(largeDocument(5), "## Section 3", "## Section three\n\n!review #Section 2#", 1),
+		strings.Replace(largeDocument(5), "```go\n# not", "```go\n```\n# not", 1),
+		"",
+	}
+
+	for i, content := range versions {
+		if got, want := inc.ParseBlocks(content), p.ParseBlocks(content); !reflect.DeepEqual(got, want) {
+			t.Errorf("Version %d: expected blocks %+v, got %+v", i, want, got)
+		}
+		got, err := inc.ParseCommands(content)
+		if err != nil {
+			t.Fatalf("Version %d: ParseCommands() error = %v", i, err)
+		}
+		want, _ := p.ParseCommands(content)
+		if len(got) != len(want) {
+			t.Fatalf("Version %d: expected %d commands, got %d", i, len(want), len(got))
+		}
+		for j := range want {
+			if got[j].Original != want[j].Original || got[j].Text != want[j].Text ||
+				!reflect.DeepEqual(got[j].References, want[j].References) {
+				t.Errorf("Version %d: expected command %+v, got %+v", i, want[j], got[j])
+			}
+		}
+	}
+
+	// Only the sections of the last version are kept
+	content := largeDocument(5)
+	inc.ParseBlocks(content)
+	if n := len(splitSections(content)); len(inc.blocks) != n {
+		t.Errorf("Expected %d cached sections, got %d", n, len(inc.blocks))
+	}
+
+	// Commands handed out are copies
+	commands, _ := inc.ParseCommands(content)
+	commands[0].Context["Section 0"] = Block{Content: "changed"}
+	commands[0].References[0] = "changed"
+	again, _ := inc.ParseCommands(content)
+	if len(again[0].Context) != 0 || again[0].References[0] != "Section 0" {
+		t.Errorf("Expected a fresh command, got %+v", again[0])
+	}
+
+	// Errors are those of the parser
+	if _, err := inc.ParseCommands("# One\n!writer --bogus text"); err == nil || !strings.Contains(err.Error(), "unknown flag") {
+		t.Errorf("Expected an unknown flag error, got %v", err)
+	}
+}
+
+// benchmarkDocument is about 1MB
+var benchmarkDocument = largeDocument(4000)
+
+// benchmarkEdits alternates between two versions of the benchmark
+// document differing in one section, as successive saves of an edit do
+var benchmarkEdits = []string{
+	benchmarkDocument,
+	strings.Replace(benchmarkDocument, "Some text about section 2000.", "Some edited text about section 2000.", 1),
+}
+
+func BenchmarkParseBlocks(b *testing.B) {
+	p := New()
+	b.SetBytes(int64(len(benchmarkDocument)))
+	for i := 0; i < b.N; i++ {
+		p.ParseBlocks(benchmarkEdits[i%2])
+	}
+}
+
+func BenchmarkIncrementalParseBlocks(b *testing.B) {
+	inc := NewIncremental(New())
+	inc.ParseBlocks(benchmarkEdits[1])
+	b.SetBytes(int64(len(benchmarkDocument)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		inc.ParseBlocks(benchmarkEdits[i%2])
+	}
+}
+
+func BenchmarkParseCommands(b *testing.B) {
+	p := New()
+	b.SetBytes(int64(len(benchmarkDocument)))
+	for i := 0; i < b.N; i++ {
+		if _, err := p.ParseCommands(benchmarkEdits[i%2]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkIncrementalParseCommands(b *testing.B) {
+	inc := NewIncremental(New())
+	inc.ParseCommands(benchmarkEdits[1])
+	b.SetBytes(int64(len(benchmarkDocument)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := inc.ParseCommands(benchmarkEdits[i%2]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -2,21 +2,16 @@ package parser
 
 import (
 	"fmt"
-	"log/slog"
 	"regexp"
 	"strings"
 
 	"github.com/butter-bot-machines/skylark/pkg/logging"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
 )
 
-var logger *slog.Logger
-
-func init() {
-	logger = logging.NewLogger(&logging.Options{
-		Level:     slog.LevelDebug,
-		AddSource: true,
-	})
-}
+// logger writes through the default handler installed by the CLI
+var logger = logging.Default()
 
 const (
 	maxCommandSize = 4000 // Maximum size for a single command
@@ -33,36 +28,148 @@ const (
 	Quote
 	Table
 	Code
+	HTML
 )
 
 // Block represents a markdown content block
 type Block struct {
 	Type    BlockType
-	Level   int    // For headers
-	Content string // Block content
+	Level   int        // For headers
+	Content string     // Block content
+	Table   *TableData // Rows and columns, for sections holding a table
 }
 
 // Command represents a parsed command
 type Command struct {
-	Assistant  string           // Assistant name (default if not specified)
-	Text       string           // Command text
-	Original   string           // Original command line
-	References []string         // Referenced sections
-	Context    map[string]Block // Section content by reference
+	Assistant  string            // Assistant name (default if not specified)
+	Text       string            // Command text
+	Original   string            // Original command line
+	References []string          // Referenced sections
+	Links      []Link            // Linked notes, when wikilinks are enabled
+	Images     []Image           // Local images shown in the command
+	Context    map[string]Block  // Section content by reference
+	History    []Exchange        // Earlier exchanges of an interactive session
+	Model      string            // Overrides the assistant's model when set
+	Output     string            // Where the response goes, from a trailing output:<mode> (empty = the assistant's choice)
+	Schema     *Schema           // JSON schema the response must conform to, from --schema <file>
+	Format     string            // How the response is written, from --format <table|json|text> (empty = the assistant's format)
+	Options    map[string]string // Flags given before the text, by name without dashes; flags without a value map to ""
+}
+
+// Schema is a JSON schema file a command's response must conform to
+type Schema struct {
+	Path string // Path relative to the document
+	Data []byte // Schema content, loaded by the processor
+}
+
+// Output modes say where a command's response is written
+const (
+	OutputInline  = "inline"  // Below the command (default)
+	OutputReplace = "replace" // In place of the command
+	OutputCallout = "callout" // Below the command, as a callout blockquote
+	OutputSection = "section" // At the end of the document's Responses section
+	OutputFile    = "file"    // In a sibling <name>.skylark.md file
+)
+
+// ValidOutput reports whether mode is a known output mode. Empty means
+// inline.
+func ValidOutput(mode string) bool {
+	switch mode {
+	case "", OutputInline, OutputReplace, OutputCallout, OutputSection, OutputFile:
+		return true
+	}
+	return false
+}
+
+// outputPattern matches a trailing output:<mode> option
+var outputPattern = regexp.MustCompile(`\s+output:(inline|replace|callout|section|file)$`)
+
+// Command options that may appear anywhere in the text
+var (
+	schemaPattern = regexp.MustCompile(`(?:^|\s+)--schema[ =](\S+)`)
+	formatPattern = regexp.MustCompile(`(?:^|\s+)--format[ =](table|json|text)\b`)
+)
+
+// Exchange is a prompt and the response it got earlier in a conversation
+type Exchange struct {
+	Prompt   string
+	Response string
+}
+
+// Image is a local image a command shows with ![alt](path). The parser
+// sets Alt and Path; the processor loads the data.
+type Image struct {
+	Alt       string // Alternative text
+	Path      string // Path relative to the document
+	MediaType string // MIME type, e.g. image/png
+	Data      []byte // Image content
+}
+
+// Link is an Obsidian-style [[WikiLink]] or ![[embed]] to another note
+type Link struct {
+	Target  string // Note name or path, without the .md extension
+	Heading string // Section after #, or a block ID starting with ^
+	Alias   string // Display text after |
+	Embed   bool   // Written as ![[...]]
+}
+
+// Key returns the link as written between the brackets, without its alias
+func (l Link) Key() string {
+	if l.Heading == "" {
+		return l.Target
+	}
+	return l.Target + "#" + l.Heading
+}
+
+// Expander expands command aliases such as !summarize into the commands
+// they stand for
+type Expander interface {
+	// Expand returns the assistant and command text for the alias name
+	// followed by text. ok is false when name is not an alias. An empty
+	// assistant means the default one.
+	Expand(name string, text string) (assistant string, expanded string, ok bool)
+}
+
+// Options configures a parser
+type Options struct {
+	WikiLinks bool     // Parse [[WikiLinks]] and ![[embeds]] in command text
+	AST       bool     // Parse blocks with a CommonMark parser instead of line by line
+	Templates Expander // Expands aliases before a command is dispatched
+
+	// CommandsInCode parses command lines inside fenced code blocks and
+	// block quotes too, which are otherwise taken as examples
+	CommandsInCode bool
 }
 
 // Parser handles command parsing
 type Parser struct {
 	commandPattern *regexp.Regexp
 	refPattern     *regexp.Regexp
+	linkPattern    *regexp.Regexp
+	imagePattern   *regexp.Regexp
+	wikiLinks      bool
+	ast            bool
+	templates      Expander
+	commandsInCode bool
 	warnings       []string // Accumulated warnings
 }
 
 // New creates a new parser
 func New() *Parser {
+	return NewWithOptions(Options{})
+}
+
+// NewWithOptions creates a new parser configured by opts
+func NewWithOptions(opts Options) *Parser {
 	return &Parser{
-		commandPattern: regexp.MustCompile(`^!(?:\s*(\S+)\s+)?(.+)$`), // Allow whitespace after !
+		commandPattern: regexp.MustCompile(`(?s)^!(?:\s*(\S+)\s+)?(.+)$`), // Allow whitespace after !
 		refPattern:     regexp.MustCompile(`#\s*([^#\n]+?)(?:\s*#|$)`),
+		linkPattern:    regexp.MustCompile(`(!?)\[\[([^\[\]|#\n]*)(?:#([^\[\]|\n]+))?(?:\|([^\[\]\n]+))?\]\]`),
+		imagePattern:   regexp.MustCompile(`!\[([^\[\]\n]*)\]\(\s*([^()\s]+)(?:\s+"[^"\n]*")?\s*\)`),
+		wikiLinks:      opts.WikiLinks,
+		ast:            opts.AST,
+		templates:      opts.Templates,
+		commandsInCode: opts.CommandsInCode,
 		warnings:       make([]string, 0),
 	}
 }
@@ -88,23 +195,142 @@ func (p *Parser) addWarning(format string, args ...interface{}) {
 func (p *Parser) ParseCommands(content string) ([]*Command, error) {
 	var commands []*Command
 	lines := strings.Split(content, "\n")
+	commandLines := p.CommandLines(content)
 
-	for _, line := range lines {
-		if strings.HasPrefix(strings.TrimSpace(line), "!") {
-			cmd, err := p.ParseCommand(line)
+	for i := 0; i < len(lines); i++ {
+		if !commandLines[i] {
+			continue // An example in code or a quote
+		}
+		trimmed := strings.TrimSpace(lines[i])
+		if p.wikiLinks && strings.HasPrefix(trimmed, "![[") {
+			continue // An embed, not a command
+		}
+		if loc := p.imagePattern.FindStringIndex(trimmed); loc != nil && loc[0] == 0 {
+			continue // An image, not a command
+		}
+		if strings.HasPrefix(trimmed, "!") {
+			span := commandSpan(lines, i)
+			cmd, err := p.ParseCommand(strings.Join(lines[i:i+span], "\n"))
 			if err != nil {
 				return nil, fmt.Errorf("failed to parse command: %w", err)
 			}
 			commands = append(commands, cmd)
+			i += span - 1
 		}
 	}
 
 	return commands, nil
 }
 
-// ParseCommand parses a single command line
+// commandSpan returns how many lines the command starting at lines[i]
+// spans. A line ending in a backslash is continued by the next one, and
+// lines indented deeper than the command, with blank lines between them,
+// continue it too.
+func commandSpan(lines []string, i int) int {
+	end := i
+	for end+1 < len(lines) && strings.HasSuffix(strings.TrimSpace(lines[end]), "\\") {
+		end++
+	}
+	indent := indentOf(lines[i])
+	for j := end + 1; j < len(lines); j++ {
+		if strings.TrimSpace(lines[j]) == "" {
+			continue
+		}
+		if indentOf(lines[j]) <= indent {
+			break
+		}
+		end = j
+	}
+	return end - i + 1
+}
+
+// indentOf returns the width of the indentation of line, a tab counting
+// as four spaces
+func indentOf(line string) int {
+	width := 0
+	for _, c := range line {
+		switch c {
+		case ' ':
+			width++
+		case '\t':
+			width += 4
+		default:
+			return width
+		}
+	}
+	return width
+}
+
+// MatchesAt reports whether lines hold, from index i, the command whose
+// Original is original, over as many lines as the command spans
+func MatchesAt(lines []string, i int, original string) bool {
+	span := strings.Split(original, "\n")
+	if i < 0 || i+len(span) > len(lines) {
+		return false
+	}
+	for j, want := range span {
+		if strings.TrimSpace(lines[i+j]) != want {
+			return false
+		}
+	}
+	return true
+}
+
+// CommandLines reports for each line of content whether it may hold a
+// command. Lines of fenced code blocks, their fences included, and of
+// block quotes may not, unless the parser takes commands in code.
+func (p *Parser) CommandLines(content string) []bool {
+	lines := strings.Split(content, "\n")
+	result := make([]bool, len(lines))
+	fence := "" // Opening fence of the code block the line is in
+	for i, line := range lines {
+		if p.commandsInCode {
+			result[i] = true
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			// A fence closes with at least as many of the same character
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+			}
+			continue
+		}
+		if open := fenceOf(trimmed); open != "" {
+			fence = open
+			continue
+		}
+		result[i] = !strings.HasPrefix(trimmed, ">")
+	}
+	return result
+}
+
+// fenceOf returns the run of backticks or tildes opening a fenced code
+// block on line, or "" when it opens none
+func fenceOf(line string) string {
+	for _, c := range []string{"`", "~"} {
+		n := len(line) - len(strings.TrimLeft(line, c))
+		if n >= 3 {
+			return line[:n]
+		}
+	}
+	return ""
+}
+
+// ParseCommand parses a single command, which may continue over several
+// lines
 func (p *Parser) ParseCommand(line string) (*Command, error) {
-	trimmed := strings.TrimSpace(line)
+	// Original keeps each line of the command, trimmed; the text joins
+	// them without the backslashes that continue them
+	spanned := strings.Split(strings.TrimSpace(line), "\n")
+	for i := range spanned {
+		spanned[i] = strings.TrimSpace(spanned[i])
+	}
+	original := strings.Join(spanned, "\n")
+	for i := range spanned[:len(spanned)-1] {
+		spanned[i] = strings.TrimSpace(strings.TrimSuffix(spanned[i], "\\"))
+	}
+	trimmed := strings.Join(spanned, "\n")
 
 	// Check command size
 	if len(trimmed) > maxCommandSize {
@@ -116,6 +342,24 @@ func (p *Parser) ParseCommand(line string) (*Command, error) {
 		return nil, fmt.Errorf("invalid command format: %s", line)
 	}
 
+	// A command without an assistant may start with flags
+	if strings.HasPrefix(matches[1], "--") {
+		matches[1], matches[2] = "", matches[1]+" "+matches[2]
+	}
+	options, rest, err := parseFlags(matches[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid command %s: %w", trimmed, err)
+	}
+	switch {
+	case rest != "":
+		matches[2] = rest
+	case matches[1] != "":
+		// Flags alone after one word, as in !summarize --no-tools
+		matches[1], matches[2] = "", matches[1]
+	default:
+		return nil, fmt.Errorf("invalid command format: %s", line)
+	}
+
 	// Extract assistant name and text
 	var assistant, text string
 	if matches[1] == "" {
@@ -133,15 +377,67 @@ func (p *Parser) ParseCommand(line string) (*Command, error) {
 			"text", text)
 	}
 
-	original := strings.TrimSpace(line)
-	references := p.ParseReferences(text)
+	if alias, expanded, ok := p.expand(matches[1], matches[2]); ok {
+		assistant, text = alias, expanded
+		logger.Debug("expanded command template",
+			"assistant", assistant,
+			"text", text)
+	}
+
+	// A trailing output:<mode> chooses where the response goes
+	var output string
+	if m := outputPattern.FindStringSubmatch(text); m != nil {
+		output = m[1]
+		text = strings.TrimSpace(text[:len(text)-len(m[0])])
+	}
+
+	// --schema and --format ask for a structured response
+	var schema *Schema
+	if m := schemaPattern.FindStringSubmatch(text); m != nil {
+		schema = &Schema{Path: m[1]}
+		text = strings.TrimSpace(schemaPattern.ReplaceAllString(text, ""))
+	}
+	var format string
+	if m := formatPattern.FindStringSubmatch(text); m != nil {
+		format = m[1]
+		text = strings.TrimSpace(formatPattern.ReplaceAllString(text, ""))
+	}
+
+	var links []Link
+	refText := text
+	if p.wikiLinks {
+		// Headings inside links are not section references
+		links = p.ParseLinks(text)
+		refText = p.linkPattern.ReplaceAllString(text, "")
+	}
+	references := p.ParseReferences(refText)
+	images := p.ParseImages(text)
+
+	// [[#Heading]] links to a section of the same note
+	var notes []Link
+	for _, link := range links {
+		if link.Target == "" {
+			references = append(references, link.Heading)
+			continue
+		}
+		notes = append(notes, link)
+	}
 
 	cmd := &Command{
 		Assistant:  assistant,
 		Text:       text,
 		Original:   original,
 		References: references,
+		Links:      notes,
+		Images:     images,
 		Context:    make(map[string]Block),
+		Output:     output,
+		Schema:     schema,
+		Format:     format,
+		Options:    options,
+	}
+	if model, ok := options[FlagModel]; ok {
+		cmd.Model = model
 	}
 
 	logger.Debug("created command",
@@ -153,6 +449,30 @@ func (p *Parser) ParseCommand(line string) (*Command, error) {
 	return cmd, nil
 }
 
+// expand expands a command whose first word is a template alias. The
+// alias is either the assistant position or, alone, the whole command.
+func (p *Parser) expand(first, rest string) (string, string, bool) {
+	if p.templates == nil {
+		return "", "", false
+	}
+	name := first
+	if name == "" {
+		if strings.ContainsAny(rest, " \t") {
+			return "", "", false
+		}
+		name, rest = rest, ""
+	}
+
+	assistant, text, ok := p.templates.Expand(strings.ToLower(name), rest)
+	if !ok {
+		return "", "", false
+	}
+	if assistant == "" {
+		assistant = "default"
+	}
+	return strings.ToLower(assistant), text, true
+}
+
 // ParseReferences extracts section references from text
 func (p *Parser) ParseReferences(text string) []string {
 	var refs []string
@@ -163,8 +483,63 @@ func (p *Parser) ParseReferences(text string) []string {
 	return refs
 }
 
+// ParseLinks extracts [[WikiLinks]] and ![[embeds]] from text
+func (p *Parser) ParseLinks(text string) []Link {
+	var links []Link
+	for _, match := range p.linkPattern.FindAllStringSubmatch(text, -1) {
+		link := Link{
+			Target:  strings.TrimSuffix(strings.TrimSpace(match[2]), ".md"),
+			Heading: strings.TrimSpace(match[3]),
+			Alias:   strings.TrimSpace(match[4]),
+			Embed:   match[1] == "!",
+		}
+		if link.Target == "" && link.Heading == "" {
+			continue
+		}
+		links = append(links, link)
+	}
+	return links
+}
+
+// ParseImages extracts the local images shown in text as ![alt](path).
+// Remote and inline images are left out.
+func (p *Parser) ParseImages(text string) []Image {
+	var images []Image
+	for _, match := range p.imagePattern.FindAllStringSubmatch(text, -1) {
+		path := match[2]
+		if strings.Contains(path, "://") || strings.HasPrefix(path, "data:") {
+			continue
+		}
+		images = append(images, Image{Alt: strings.TrimSpace(match[1]), Path: path})
+	}
+	return images
+}
+
+// SplitReference splits a cross-file reference such as "notes.md:Goals" or
+// "docs/*:Overview" into its file pattern and heading. ok is false for
+// references to sections of the same file, including headings that merely
+// contain a colon.
+func SplitReference(ref string) (pattern, heading string, ok bool) {
+	pattern, heading, found := strings.Cut(ref, ":")
+	if !found {
+		return "", ref, false
+	}
+	pattern, heading = strings.TrimSpace(pattern), strings.TrimSpace(heading)
+	if pattern == "" || heading == "" {
+		return "", ref, false
+	}
+	if !strings.HasSuffix(strings.ToLower(pattern), ".md") && !strings.ContainsAny(pattern, "/*?[") {
+		return "", ref, false
+	}
+	return pattern, heading, true
+}
+
 // ParseBlocks parses markdown content into blocks
 func (p *Parser) ParseBlocks(content string) []Block {
+	if p.ast {
+		return parseBlocksAST(content)
+	}
+
 	var blocks []Block
 	lines := strings.Split(content, "\n")
 
@@ -361,14 +736,21 @@ func (p *Parser) AssembleContext(blocks []Block, currentIndex int) []Block {
 	return context
 }
 
+// Patterns of normalizeText. Letters, marks and digits of any script are
+// kept, so that headings in non-Latin scripts can be matched.
+var (
+	punctuationPattern = regexp.MustCompile(`[^\p{L}\p{M}\p{N}_\s]`)
+	spacePattern       = regexp.MustCompile(`\s+`)
+)
+
 // normalizeText prepares text for matching
 func normalizeText(text string) string {
-	// Convert to lowercase
-	text = strings.ToLower(text)
+	// NFC normalize and fold case
+	text = cases.Fold().String(norm.NFC.String(text))
 	// Replace punctuation with spaces
-	text = regexp.MustCompile(`[^\w\s]`).ReplaceAllString(text, " ")
+	text = punctuationPattern.ReplaceAllString(text, " ")
 	// Collapse whitespace
-	text = regexp.MustCompile(`\s+`).ReplaceAllString(text, " ")
+	text = spacePattern.ReplaceAllString(text, " ")
 	// Trim
 	return strings.TrimSpace(text)
 }
@@ -54,11 +54,57 @@ func TestParseCommand(t *testing.T) {
 				Context:    make(map[string]Block),
 			},
 		},
+		{
+			name:  "with output mode",
+			input: "!assistant summarize # Notes # output:callout",
+			want: &Command{
+				Assistant:  "assistant",
+				Text:       "summarize # Notes #",
+				Original:   "!assistant summarize # Notes # output:callout",
+				References: []string{"Notes"},
+				Context:    make(map[string]Block),
+				Output:     OutputCallout,
+			},
+		},
+		{
+			name:  "with schema and format",
+			input: "!extract --schema schemas/contacts.json the contacts of #Team# --format table",
+			want: &Command{
+				Assistant:  "extract",
+				Text:       "the contacts of #Team#",
+				Original:   "!extract --schema schemas/contacts.json the contacts of #Team# --format table",
+				References: []string{"Team"},
+				Context:    make(map[string]Block),
+				Schema:     &Schema{Path: "schemas/contacts.json"},
+				Format:     "table",
+			},
+		},
+		{
+			name:  "unknown output mode",
+			input: "!assistant explain output:verbose",
+			want: &Command{
+				Assistant: "assistant",
+				Text:      "explain output:verbose",
+				Original:  "!assistant explain output:verbose",
+				Context:   make(map[string]Block),
+			},
+		},
 		{
 			name:      "missing prefix",
 			input:     "command text",
 			wantError: true,
 		},
+		{
+			name:  "references in other scripts",
+			input: "!summarize #München# and #日本語#",
+			want: &Command{
+				Assistant:  "summarize",
+				Text:       "#München# and #日本語#",
+				Original:   "!summarize #München# and #日本語#",
+				References: []string{"München", "日本語"},
+				Context:    make(map[string]Block),
+			},
+		},
 		{
 			name:      "! after text",
 			input:     "hello !command",
@@ -172,6 +218,103 @@ code
 	}
 }
 
+func TestParseBlocksAST(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []Block
+	}{
+		{
+			name:    "headers",
+			content: "# Header 1\nContent 1\n## Header 2\nContent 2",
+			want: []Block{
+				{Type: Header, Level: 1, Content: "Header 1"},
+				{Type: Paragraph, Content: "Content 1"},
+				{Type: Header, Level: 2, Content: "Header 2"},
+				{Type: Paragraph, Content: "Content 2"},
+			},
+		},
+		{
+			name:    "setext headers",
+			content: "Title\n=====\n\nSubtitle\n--------\nText",
+			want: []Block{
+				{Type: Header, Level: 1, Content: "Title"},
+				{Type: Header, Level: 2, Content: "Subtitle"},
+				{Type: Paragraph, Content: "Text"},
+			},
+		},
+		{
+			name:    "hash inside header",
+			content: "## C# tips ##",
+			want: []Block{
+				{Type: Header, Level: 2, Content: "C# tips"},
+			},
+		},
+		{
+			name:    "nested lists",
+			content: "- Item 1\n  - Nested 1\n  - Nested 2\n- Item 2",
+			want: []Block{
+				{Type: List, Content: "- Item 1\n  - Nested 1\n  - Nested 2\n- Item 2"},
+			},
+		},
+		{
+			name:    "list with code",
+			content: "1. Run\n\n   ```\n   make\n   ```\n\nAfter",
+			want: []Block{
+				{Type: List, Content: "1. Run\n\n   ```\n   make\n   ```"},
+				{Type: Paragraph, Content: "After"},
+			},
+		},
+		{
+			name:    "quotes",
+			content: "> Quote 1\n> Quote 2\nlazy",
+			want: []Block{
+				{Type: Quote, Content: "Quote 1\nQuote 2\nlazy"},
+			},
+		},
+		{
+			name:    "code blocks",
+			content: "```go\nfunc main() {}\n\n# not a header\n```",
+			want: []Block{
+				{Type: Code, Content: "func main() {}\n\n# not a header"},
+			},
+		},
+		{
+			name:    "tables",
+			content: "| A | B |\n|-|-|\n|1|2|",
+			want: []Block{
+				{Type: Table, Content: "| A | B |\n|-|-|\n|1|2|"},
+			},
+		},
+		{
+			name:    "html blocks",
+			content: "<details>\n<summary>More</summary>\n</details>\n\nText",
+			want: []Block{
+				{Type: HTML, Content: "<details>\n<summary>More</summary>\n</details>"},
+				{Type: Paragraph, Content: "Text"},
+			},
+		},
+		{
+			name:    "front matter and breaks",
+			content: "---\ntitle: Notes\ntags: [a]\n---\n# Notes\n\n***\n\nBody",
+			want: []Block{
+				{Type: Header, Level: 1, Content: "Notes"},
+				{Type: Paragraph, Content: "Body"},
+			},
+		},
+	}
+
+	p := NewWithOptions(Options{AST: true})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := p.ParseBlocks(tt.content)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseBlocks() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestAssembleContext(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -291,6 +434,41 @@ func TestMatchBlocks(t *testing.T) {
 			},
 			wantWarns: []string{},
 		},
+		{
+			name: "non-Latin script",
+			blocks: []Block{
+				{Type: Header, Content: "Section One"},
+				{Type: Header, Content: "日本語の概要"},
+			},
+			ref: "日本語",
+			want: []Block{
+				{Type: Header, Content: "日本語の概要"},
+			},
+			wantWarns: []string{},
+		},
+		{
+			name: "accents and normalization",
+			blocks: []Block{
+				{Type: Header, Content: "Munich"},
+				{Type: Header, Content: "Ausflüge in München"},
+			},
+			ref: "MU\u0308NCHEN",
+			want: []Block{
+				{Type: Header, Content: "Ausflüge in München"},
+			},
+			wantWarns: []string{},
+		},
+		{
+			name: "emoji",
+			blocks: []Block{
+				{Type: Header, Content: "🚀 Launch plan"},
+			},
+			ref: "launch",
+			want: []Block{
+				{Type: Header, Content: "🚀 Launch plan"},
+			},
+			wantWarns: []string{},
+		},
 		{
 			name: "multiple matches",
 			blocks: []Block{
@@ -329,3 +507,392 @@ func TestMatchBlocks(t *testing.T) {
 		})
 	}
 }
+
+func TestSplitReference(t *testing.T) {
+	tests := []struct {
+		ref     string
+		pattern string
+		heading string
+		ok      bool
+	}{
+		{"Goals", "", "Goals", false},
+		{"notes.md:Goals", "notes.md", "Goals", true},
+		{"docs/*:Overview", "docs/*", "Overview", true},
+		{"docs/guide.MD : Setup", "docs/guide.MD", "Setup", true},
+		{"Q1: Goals", "", "Q1: Goals", false},
+		{"notes.md:", "", "notes.md:", false},
+	}
+
+	for _, tt := range tests {
+		pattern, heading, ok := SplitReference(tt.ref)
+		if pattern != tt.pattern || heading != tt.heading || ok != tt.ok {
+			t.Errorf("SplitReference(%q) = %q, %q, %v; want %q, %q, %v",
+				tt.ref, pattern, heading, ok, tt.pattern, tt.heading, tt.ok)
+		}
+	}
+}
+
+func TestParseLinks(t *testing.T) {
+	p := NewWithOptions(Options{WikiLinks: true})
+
+	cmd, err := p.ParseCommand("!research compare [[Plan]] with ![[projects/Alpha.md#Goals|goals]], [[Log#^abc]] and [[#Intro]] #Budget#")
+	if err != nil {
+		t.Fatalf("ParseCommand() error = %v", err)
+	}
+
+	expected := []Link{
+		{Target: "Plan"},
+		{Target: "projects/Alpha", Heading: "Goals", Alias: "goals", Embed: true},
+		{Target: "Log", Heading: "^abc"},
+	}
+	if !reflect.DeepEqual(cmd.Links, expected) {
+		t.Errorf("Expected links %+v, got %+v", expected, cmd.Links)
+	}
+	if cmd.Links[1].Key() != "projects/Alpha#Goals" {
+		t.Errorf("Unexpected key %q", cmd.Links[1].Key())
+	}
+	// Headings inside links are not references, but [[#Intro]] is
+	if !reflect.DeepEqual(cmd.References, []string{"Budget", "Intro"}) {
+		t.Errorf("Expected references [Budget Intro], got %v", cmd.References)
+	}
+
+	// Without the option links are left alone
+	cmd, err = New().ParseCommand("!research compare [[Plan]]")
+	if err != nil {
+		t.Fatalf("ParseCommand() error = %v", err)
+	}
+	if len(cmd.Links) != 0 {
+		t.Errorf("Expected no links, got %+v", cmd.Links)
+	}
+
+	// Lines starting with an embed are not commands
+	commands, err := p.ParseCommands("![[Diagram]]\n!research explain ![[Diagram]]\n")
+	if err != nil {
+		t.Fatalf("ParseCommands() error = %v", err)
+	}
+	if len(commands) != 1 || commands[0].Assistant != "research" {
+		t.Errorf("Expected only the research command, got %+v", commands)
+	}
+}
+
+func TestParseImages(t *testing.T) {
+	p := New()
+
+	cmd, err := p.ParseCommand(`!describe ![diagram](assets/arch.png) next to ![ ](../shots/before.jpg "Before"), not ![logo](https://example.com/logo.png)`)
+	if err != nil {
+		t.Fatalf("ParseCommand() error = %v", err)
+	}
+
+	expected := []Image{
+		{Alt: "diagram", Path: "assets/arch.png"},
+		{Alt: "", Path: "../shots/before.jpg"},
+	}
+	if !reflect.DeepEqual(cmd.Images, expected) {
+		t.Errorf("Expected images %+v, got %+v", expected, cmd.Images)
+	}
+	if cmd.Assistant != "describe" {
+		t.Errorf("Expected assistant describe, got %s", cmd.Assistant)
+	}
+
+	// Lines starting with an image are not commands
+	commands, err := p.ParseCommands("![diagram](assets/arch.png)\n!describe ![diagram](assets/arch.png)\n")
+	if err != nil {
+		t.Fatalf("ParseCommands() error = %v", err)
+	}
+	if len(commands) != 1 || commands[0].Assistant != "describe" {
+		t.Errorf("Expected only the describe command, got %+v", commands)
+	}
+}
+
+func TestParseTable(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    *TableData
+	}{
+		{
+			name:    "table after text",
+			content: "Prices as of May.\n\n| Plan | Price |\n|:-----|------:|\n| Free | 0 |\n| Pro | 10 |\n\nMore text.",
+			want: &TableData{
+				Columns:    []string{"Plan", "Price"},
+				Rows:       [][]string{{"Free", "0"}, {"Pro", "10"}},
+				Alignments: []Alignment{AlignLeft, AlignRight},
+			},
+		},
+		{
+			name:    "escaped pipes and short rows",
+			content: "A | B | C\n:-:|---|---\na \\| b | c",
+			want: &TableData{
+				Columns:    []string{"A", "B", "C"},
+				Rows:       [][]string{{"a | b", "c", ""}},
+				Alignments: []Alignment{AlignCenter, AlignNone, AlignNone},
+			},
+		},
+		{
+			name:    "no delimiter row",
+			content: "| A | B |\n| 1 | 2 |",
+		},
+		{
+			name:    "column count mismatch",
+			content: "| A | B |\n|---|\n| 1 | 2 |",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseTable(tt.content)
+			if ok != (tt.want != nil) {
+				t.Fatalf("ParseTable() ok = %v, want %v", ok, tt.want != nil)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseTable() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTableMarkdown(t *testing.T) {
+	table := &TableData{
+		Columns:    []string{"Plan", "Price", "Note"},
+		Rows:       [][]string{{"Free", "0", "a|b"}, {"Enterprise", "1000"}},
+		Alignments: []Alignment{AlignNone, AlignRight, AlignCenter},
+	}
+	expected := "| Plan       | Price | Note |\n" +
+		"| ---------- | ----: | :--: |\n" +
+		"| Free       |     0 | a\\|b |\n" +
+		"| Enterprise |  1000 |      |"
+	if got := table.Markdown(); got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	// A rendered table parses back to the same cells
+	parsed, ok := ParseTable(table.Markdown())
+	if !ok {
+		t.Fatal("Expected rendered table to parse")
+	}
+	if !reflect.DeepEqual(parsed.Rows, [][]string{{"Free", "0", "a|b"}, {"Enterprise", "1000", ""}}) {
+		t.Errorf("Expected round-trip rows, got %v", parsed.Rows)
+	}
+}
+
+// staticTemplates expands aliases from a map of name to assistant and body
+type staticTemplates map[string][2]string
+
+func (s staticTemplates) Expand(name, text string) (string, string, bool) {
+	t, ok := s[name]
+	if !ok {
+		return "", "", false
+	}
+	return t[0], strings.ReplaceAll(t[1], "{selection}", text), true
+}
+
+func TestParseCommandTemplates(t *testing.T) {
+	p := NewWithOptions(Options{Templates: staticTemplates{
+		"summarize": {"Writer", "Summarize {selection} in three bullets"},
+		"standup":   {"", "Draft my standup"},
+	}})
+
+	tests := []struct {
+		input      string
+		assistant  string
+		text       string
+		references []string
+	}{
+		{"!summarize #Roadmap#", "writer", "Summarize #Roadmap# in three bullets", []string{"Roadmap"}},
+		{"!Standup", "default", "Draft my standup", nil},
+		{"!standup now please", "default", "Draft my standup", nil},
+		{"!writer summarize this", "writer", "summarize this", nil},
+		{"!summarize", "writer", "Summarize  in three bullets", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			cmd, err := p.ParseCommand(tt.input)
+			if err != nil {
+				t.Fatalf("ParseCommand() error = %v", err)
+			}
+			if cmd.Assistant != tt.assistant || cmd.Text != tt.text {
+				t.Errorf("Expected %s: %q, got %s: %q", tt.assistant, tt.text, cmd.Assistant, cmd.Text)
+			}
+			if !reflect.DeepEqual(cmd.References, tt.references) {
+				t.Errorf("Expected references %v, got %v", tt.references, cmd.References)
+			}
+			if cmd.Original != tt.input {
+				t.Errorf("Expected original %q, got %q", tt.input, cmd.Original)
+			}
+		})
+	}
+}
+
+func TestParseCommandsInCode(t *testing.T) {
+	content := strings.Join([]string{
+		"!one first",
+		"````markdown",
+		"!two example",
+		"```",
+		"!three still code",
+		"````",
+		"> !four quoted",
+		"~~~",
+		"!five tilde",
+		"```",
+		"!six still tilde",
+		"~~~~",
+		"!seven last",
+	}, "\n")
+
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{name: "examples skipped", want: []string{"one", "seven"}},
+		{name: "commands in code", opts: Options{CommandsInCode: true}, want: []string{"one", "two", "three", "five", "six", "seven"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commands, err := NewWithOptions(tt.opts).ParseCommands(content)
+			if err != nil {
+				t.Fatalf("ParseCommands() error = %v", err)
+			}
+			var got []string
+			for _, cmd := range commands {
+				got = append(got, cmd.Assistant)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseCommandFlags(t *testing.T) {
+	p := NewWithOptions(Options{Templates: staticTemplates{
+		"summarize": {"Writer", "Summarize {selection}"},
+	}})
+
+	tests := []struct {
+		input     string
+		assistant string
+		text      string
+		options   map[string]string
+		model     string
+		wantErr   string
+	}{
+		{
+			input:     "!summarize --model gpt-3.5-turbo --max-words 200 --no-tools #Notes#",
+			assistant: "writer",
+			text:      "Summarize #Notes#",
+			options:   map[string]string{"model": "gpt-3.5-turbo", "max-words": "200", "no-tools": ""},
+			model:     "gpt-3.5-turbo",
+		},
+		{
+			input:     "!writer --temperature=0.2 --max-tokens 500 draft an intro",
+			assistant: "writer",
+			text:      "draft an intro",
+			options:   map[string]string{"temperature": "0.2", "max-tokens": "500"},
+		},
+		{input: "!--no-tools what is 2+2", assistant: "default", text: "what is 2+2", options: map[string]string{"no-tools": ""}},
+		{input: "!writer -- --verbose is a flag", assistant: "writer", text: "--verbose is a flag"},
+		{input: "!writer --format json list names", assistant: "writer", text: "list names"},
+		{input: "!writer text with --model in it", assistant: "writer", text: "text with --model in it"},
+		{input: "!writer --fast draft", wantErr: "unknown flag --fast"},
+		{input: "!writer --max-words many draft", wantErr: "flag --max-words: expected a positive whole number"},
+		{input: "!writer --temperature 3 draft", wantErr: "expected a number from 0 to 2"},
+		{input: "!writer --no-tools=yes draft", wantErr: "flag --no-tools takes no value"},
+		{input: "!--no-tools", wantErr: "invalid command format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			cmd, err := p.ParseCommand(tt.input)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseCommand() error = %v", err)
+			}
+			if cmd.Assistant != tt.assistant || cmd.Text != tt.text {
+				t.Errorf("Expected %s: %q, got %s: %q", tt.assistant, tt.text, cmd.Assistant, cmd.Text)
+			}
+			if !reflect.DeepEqual(cmd.Options, tt.options) {
+				t.Errorf("Expected options %v, got %v", tt.options, cmd.Options)
+			}
+			if cmd.Model != tt.model {
+				t.Errorf("Expected model %q, got %q", tt.model, cmd.Model)
+			}
+		})
+	}
+}
+
+func TestParseCommandsContinued(t *testing.T) {
+	content := strings.Join([]string{
+		"# Plan",
+		"!writer draft the launch email \\",
+		"for #Plan# \\",
+		"in a friendly tone",
+		"Plain text",
+		"!researcher compare the options:",
+		"  first by cost,",
+		"",
+		"  then by risk.",
+		"",
+		"Not part of it",
+		"!default one line",
+		"  !nested continues it",
+	}, "\n")
+
+	commands, err := New().ParseCommands(content)
+	if err != nil {
+		t.Fatalf("ParseCommands() error = %v", err)
+	}
+	tests := []struct {
+		assistant  string
+		text       string
+		original   string
+		references []string
+	}{
+		{
+			assistant:  "writer",
+			text:       "draft the launch email\nfor #Plan#\nin a friendly tone",
+			original:   "!writer draft the launch email \\\nfor #Plan# \\\nin a friendly tone",
+			references: []string{"Plan"},
+		},
+		{
+			assistant: "researcher",
+			text:      "compare the options:\nfirst by cost,\n\nthen by risk.",
+			original:  "!researcher compare the options:\nfirst by cost,\n\nthen by risk.",
+		},
+		{
+			assistant: "default",
+			text:      "one line\n!nested continues it",
+			original:  "!default one line\n!nested continues it",
+		},
+	}
+	if len(commands) != len(tests) {
+		t.Fatalf("Expected %d commands, got %d", len(tests), len(commands))
+	}
+	lines := strings.Split(content, "\n")
+	for i, tt := range tests {
+		cmd := commands[i]
+		if cmd.Assistant != tt.assistant || cmd.Text != tt.text {
+			t.Errorf("Expected %s: %q, got %s: %q", tt.assistant, tt.text, cmd.Assistant, cmd.Text)
+		}
+		if cmd.Original != tt.original {
+			t.Errorf("Expected original %q, got %q", tt.original, cmd.Original)
+		}
+		if !reflect.DeepEqual(cmd.References, tt.references) {
+			t.Errorf("Expected references %v, got %v", tt.references, cmd.References)
+		}
+		found := false
+		for j := range lines {
+			found = found || MatchesAt(lines, j, cmd.Original)
+		}
+		if !found {
+			t.Errorf("Expected %q to match the document", cmd.Original)
+		}
+	}
+}
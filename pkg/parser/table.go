@@ -0,0 +1,195 @@
+package parser
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Alignment is the alignment of a table column
+type Alignment int
+
+const (
+	AlignNone Alignment = iota
+	AlignLeft
+	AlignCenter
+	AlignRight
+)
+
+// TableData is a Markdown table split into cells
+type TableData struct {
+	Columns    []string    `json:"columns"`
+	Rows       [][]string  `json:"rows"`
+	Alignments []Alignment `json:"-"`
+}
+
+// ParseTable returns the first pipe table in content. Rows are padded or
+// cut to the number of columns.
+func ParseTable(content string) (*TableData, bool) {
+	lines := strings.Split(content, "\n")
+	for i := 0; i+1 < len(lines); i++ {
+		header := strings.TrimSpace(lines[i])
+		if !strings.Contains(header, "|") {
+			continue
+		}
+		alignments, ok := parseDelimiterRow(lines[i+1])
+		if !ok {
+			continue
+		}
+		columns := splitRow(header)
+		if len(columns) != len(alignments) {
+			continue
+		}
+
+		table := &TableData{Columns: columns, Alignments: alignments}
+		for _, line := range lines[i+2:] {
+			line = strings.TrimSpace(line)
+			if line == "" || !strings.Contains(line, "|") {
+				break
+			}
+			table.Rows = append(table.Rows, fitRow(splitRow(line), len(columns)))
+		}
+		return table, true
+	}
+	return nil, false
+}
+
+// parseDelimiterRow parses a row such as |:---|---:| into alignments
+func parseDelimiterRow(line string) ([]Alignment, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.Contains(line, "-") {
+		return nil, false
+	}
+	var alignments []Alignment
+	for _, cell := range splitRow(line) {
+		left := strings.HasPrefix(cell, ":")
+		right := strings.HasSuffix(cell, ":")
+		dashes := strings.Trim(cell, ":")
+		if dashes == "" || strings.Trim(dashes, "-") != "" {
+			return nil, false
+		}
+		switch {
+		case left && right:
+			alignments = append(alignments, AlignCenter)
+		case left:
+			alignments = append(alignments, AlignLeft)
+		case right:
+			alignments = append(alignments, AlignRight)
+		default:
+			alignments = append(alignments, AlignNone)
+		}
+	}
+	return alignments, len(alignments) > 0
+}
+
+// splitRow splits a table row into trimmed cells, honoring \| escapes
+func splitRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// fitRow pads or cuts row to n cells
+func fitRow(row []string, n int) []string {
+	if len(row) > n {
+		return row[:n]
+	}
+	for len(row) < n {
+		row = append(row, "")
+	}
+	return row
+}
+
+// Markdown renders the table with its columns padded to equal width
+func (t *TableData) Markdown() string {
+	n := len(t.Columns)
+	escape := func(cell string) string {
+		cell = strings.ReplaceAll(cell, "\n", " ")
+		return strings.ReplaceAll(cell, "|", `\|`)
+	}
+
+	header := make([]string, n)
+	widths := make([]int, n)
+	for i, column := range t.Columns {
+		header[i] = escape(column)
+		widths[i] = max(3, utf8.RuneCountInString(header[i]))
+	}
+	rows := make([][]string, len(t.Rows))
+	for r, row := range t.Rows {
+		rows[r] = fitRow(append([]string(nil), row...), n)
+		for i, cell := range rows[r] {
+			rows[r][i] = escape(cell)
+			widths[i] = max(widths[i], utf8.RuneCountInString(rows[r][i]))
+		}
+	}
+
+	var b strings.Builder
+	writeRow := func(cells []string) {
+		b.WriteString("|")
+		for i, cell := range cells {
+			b.WriteString(" ")
+			b.WriteString(t.pad(cell, widths[i], i))
+			b.WriteString(" |")
+		}
+		b.WriteString("\n")
+	}
+
+	writeRow(header)
+	b.WriteString("|")
+	for i, width := range widths {
+		dashes := strings.Repeat("-", width)
+		switch t.alignment(i) {
+		case AlignLeft:
+			dashes = ":" + dashes[1:]
+		case AlignCenter:
+			dashes = ":" + dashes[2:] + ":"
+		case AlignRight:
+			dashes = dashes[1:] + ":"
+		}
+		b.WriteString(" " + dashes + " |")
+	}
+	b.WriteString("\n")
+	for _, row := range rows {
+		writeRow(row)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// alignment returns the alignment of column i
+func (t *TableData) alignment(i int) Alignment {
+	if i < len(t.Alignments) {
+		return t.Alignments[i]
+	}
+	return AlignNone
+}
+
+// pad fills cell to width following the alignment of column i
+func (t *TableData) pad(cell string, width int, i int) string {
+	gap := width - utf8.RuneCountInString(cell)
+	switch t.alignment(i) {
+	case AlignRight:
+		return strings.Repeat(" ", gap) + cell
+	case AlignCenter:
+		left := gap / 2
+		return strings.Repeat(" ", left) + cell + strings.Repeat(" ", gap-left)
+	default:
+		return cell + strings.Repeat(" ", gap)
+	}
+}
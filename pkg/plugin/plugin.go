@@ -0,0 +1,253 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+)
+
+// StartTimeout bounds how long a plugin may take to answer initialize
+const StartTimeout = 10 * time.Second
+
+// maxMessageSize bounds a single message from a plugin
+const maxMessageSize = 16 << 20
+
+// ErrClosed is returned for calls to a plugin that exited or was closed
+var ErrClosed = errors.New("plugin closed")
+
+// Plugin is a running plugin program. It is safe for concurrent use;
+// calls are answered in whatever order the plugin completes them.
+type Plugin struct {
+	Info Info
+
+	name  string
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+
+	writeMu sync.Mutex // Serializes requests on stdin
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan response
+	done    chan struct{} // Closed once the plugin's stdout ends
+	err     error         // Why it ended
+}
+
+// Start starts the plugin cfg declares, relative to configDir, and asks
+// it what it provides
+func Start(cfg config.PluginConfig, configDir string) (*Plugin, error) {
+	command := cfg.Command
+	if !filepath.IsAbs(command) && configDir != "" {
+		command = filepath.Join(configDir, command)
+	}
+	cmd := exec.Command(command, cfg.Args...)
+	cmd.Dir = configDir
+	cmd.Env = os.Environ()
+	for k, v := range cfg.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start plugin %s: %w", cfg.Name, err)
+	}
+
+	p := &Plugin{
+		name:    cfg.Name,
+		cmd:     cmd,
+		stdin:   stdin,
+		pending: make(map[int64]chan response),
+		done:    make(chan struct{}),
+	}
+	go p.read(stdout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), StartTimeout)
+	defer cancel()
+	if err := p.Call(ctx, MethodInitialize, nil, &p.Info); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("failed to initialize plugin %s: %w", cfg.Name, err)
+	}
+	if !p.Info.Provider && !p.Info.Processor {
+		p.Close()
+		return nil, fmt.Errorf("plugin %s provides neither a provider nor a processor", cfg.Name)
+	}
+	return p, nil
+}
+
+// Call sends a request and decodes its result into result, waiting until
+// the plugin answers or ctx is done
+func (p *Plugin) Call(ctx context.Context, method string, params, result interface{}) error {
+	p.mu.Lock()
+	if p.pending == nil {
+		p.mu.Unlock()
+		return fmt.Errorf("plugin %s: %w", p.name, ErrClosed)
+	}
+	p.nextID++
+	id := p.nextID
+	answer := make(chan response, 1)
+	p.pending[id] = answer
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.pending, id)
+		p.mu.Unlock()
+	}()
+
+	data, err := json.Marshal(request{JSONRPC: "2.0", ID: id, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	p.writeMu.Lock()
+	_, err = p.stdin.Write(append(data, '\n'))
+	p.writeMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("plugin %s: %w: %v", p.name, ErrClosed, err)
+	}
+
+	select {
+	case resp := <-answer:
+		if resp.Error != nil {
+			return fmt.Errorf("plugin %s: %s", p.name, resp.Error.Message)
+		}
+		if result == nil {
+			return nil
+		}
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("plugin %s: invalid %s result: %w", p.name, method, err)
+		}
+		return nil
+	case <-p.done:
+		return fmt.Errorf("plugin %s: %w: %v", p.name, ErrClosed, p.err)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// read hands the plugin's responses to the calls waiting for them until
+// its stdout ends
+func (p *Plugin) read(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+	for scanner.Scan() {
+		var resp response
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+			continue // Not a response, such as stray output
+		}
+		p.mu.Lock()
+		answer := p.pending[resp.ID]
+		p.mu.Unlock()
+		if answer != nil {
+			select {
+			case answer <- resp:
+			default: // Answered already
+			}
+		}
+	}
+
+	p.mu.Lock()
+	p.err = scanner.Err()
+	if p.err == nil {
+		p.err = io.EOF
+	}
+	p.pending = nil
+	p.mu.Unlock()
+	close(p.done)
+}
+
+// Close closes the plugin's stdin and waits for it to exit
+func (p *Plugin) Close() error {
+	p.stdin.Close()
+	select {
+	case <-p.done:
+	case <-time.After(StartTimeout):
+		p.cmd.Process.Kill()
+	}
+	return p.cmd.Wait()
+}
+
+// Provider returns a provider sending requests for model to the plugin,
+// for use as a registry.Factory
+func (p *Plugin) Provider(model string) (provider.Provider, error) {
+	if !p.Info.Provider {
+		return nil, fmt.Errorf("plugin %s is not a provider", p.name)
+	}
+	return &pluginProvider{plugin: p, model: model}, nil
+}
+
+// Hooks returns hooks passing each response through the plugin
+func (p *Plugin) Hooks() processor.Hooks {
+	return processor.Hooks{
+		OnResponse: func(ctx context.Context, cmd *parser.Command, response string) (string, error) {
+			var result ResponseResult
+			err := p.Call(ctx, MethodResponse, ResponseParams{
+				Assistant: cmd.Assistant,
+				Command:   cmd.Text,
+				Response:  response,
+			}, &result)
+			if err != nil {
+				return "", err
+			}
+			return result.Response, nil
+		},
+	}
+}
+
+// pluginProvider implements provider.Provider for a model of a plugin
+type pluginProvider struct {
+	plugin *Plugin
+	model  string
+}
+
+// Send implements provider.Provider
+func (pp *pluginProvider) Send(ctx context.Context, messages []provider.Message, opts *provider.RequestOptions) (*provider.Response, error) {
+	params := SendParams{Model: pp.model}
+	if opts != nil {
+		params.Temperature, params.MaxTokens, params.Schema = opts.Temperature, opts.MaxTokens, opts.Schema
+	}
+	for _, m := range messages {
+		msg := Message{Role: m.Role, Content: m.Content, ToolCallID: m.ToolCallID}
+		for _, call := range m.ToolCalls {
+			msg.ToolCalls = append(msg.ToolCalls, ToolCall{ID: call.ID, Name: call.Function.Name, Arguments: call.Function.Arguments})
+		}
+		params.Messages = append(params.Messages, msg)
+	}
+
+	var result SendResult
+	if err := pp.plugin.Call(ctx, MethodSend, params, &result); err != nil {
+		return nil, &provider.Error{Code: provider.ErrServerError, Message: err.Error()}
+	}
+	resp := &provider.Response{Content: result.Content, Usage: result.Usage}
+	for _, call := range result.ToolCalls {
+		resp.ToolCalls = append(resp.ToolCalls, provider.ToolCall{
+			ID:       call.ID,
+			Function: provider.Function{Name: call.Name, Arguments: call.Arguments},
+		})
+	}
+	return resp, nil
+}
+
+// Close implements provider.Provider. The plugin keeps running for other
+// requests.
+func (pp *pluginProvider) Close() error {
+	return nil
+}
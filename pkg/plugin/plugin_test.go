@@ -0,0 +1,149 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+)
+
+// pluginSource is a plugin that provides models answering with the last
+// message reversed, and shouts responses
+const pluginSource = `package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+func main() {
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var req struct {
+			ID     int64           ` + "`json:\"id\"`" + `
+			Method string          ` + "`json:\"method\"`" + `
+			Params json.RawMessage ` + "`json:\"params\"`" + `
+		}
+		json.Unmarshal(scanner.Bytes(), &req)
+		var params struct {
+			Model    string
+			Messages []struct{ Role, Content string }
+			Response string
+		}
+		json.Unmarshal(req.Params, &params)
+
+		var result interface{}
+		switch req.Method {
+		case "initialize":
+			result = map[string]interface{}{"name": "test", "provider": true, "processor": true}
+		case "provider/send":
+			if params.Model == "broken" {
+				fmt.Printf("{\"id\": %d, \"error\": {\"code\": -32603, \"message\": \"model unavailable\"}}\n", req.ID)
+				continue
+			}
+			last := []rune(params.Messages[len(params.Messages)-1].Content)
+			for i, j := 0, len(last)-1; i < j; i, j = i+1, j-1 {
+				last[i], last[j] = last[j], last[i]
+			}
+			result = map[string]interface{}{
+				"content": params.Model + ": " + string(last),
+				"usage":   map[string]int{"total_tokens": 3},
+			}
+		case "processor/response":
+			result = map[string]string{"response": strings.ToUpper(params.Response)}
+		}
+		data, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+		fmt.Println(string(data))
+	}
+}
+`
+
+// buildPlugin compiles pluginSource into dir
+func buildPlugin(t *testing.T, dir string) string {
+	t.Helper()
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not available")
+	}
+	src := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(src, []byte(pluginSource), 0644); err != nil {
+		t.Fatalf("Failed to write plugin: %v", err)
+	}
+	bin := filepath.Join(dir, "test-plugin")
+	if output, err := exec.Command("go", "build", "-o", bin, src).CombinedOutput(); err != nil {
+		t.Fatalf("Failed to build plugin: %s: %v", output, err)
+	}
+	return bin
+}
+
+func TestPlugin(t *testing.T) {
+	dir := t.TempDir()
+	buildPlugin(t, dir)
+
+	p, err := Start(config.PluginConfig{Name: "test", Command: "test-plugin"}, dir)
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer p.Close()
+	if !p.Info.Provider || !p.Info.Processor {
+		t.Errorf("Expected a provider and processor, got %+v", p.Info)
+	}
+
+	// Provider
+	prov, err := p.Provider("tiny")
+	if err != nil {
+		t.Fatalf("Provider() error = %v", err)
+	}
+	resp, err := prov.Send(context.Background(), provider.Prompt("hello"), provider.DefaultRequestOptions)
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if resp.Content != "tiny: olleh" || resp.Usage.TotalTokens != 3 {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+
+	broken, _ := p.Provider("broken")
+	if _, err := broken.Send(context.Background(), provider.Prompt("hello"), nil); err == nil || !strings.Contains(err.Error(), "model unavailable") {
+		t.Errorf("Expected the plugin's error, got %v", err)
+	}
+
+	// Processor
+	response, err := p.Hooks().OnResponse(context.Background(), &parser.Command{Assistant: "default", Text: "hi"}, "quiet")
+	if err != nil || response != "QUIET" {
+		t.Errorf("Expected the processed response, got %q, %v", response, err)
+	}
+
+	// Calls after the plugin exits fail
+	if err := p.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if _, err := prov.Send(context.Background(), provider.Prompt("hello"), nil); !strings.Contains(err.Error(), ErrClosed.Error()) {
+		t.Errorf("Expected closed plugin error, got %v", err)
+	}
+}
+
+func TestStartFailures(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := Start(config.PluginConfig{Name: "missing", Command: "missing"}, dir); err == nil {
+		t.Error("Expected error for a missing plugin")
+	}
+
+	// A program that exits without initializing
+	script := filepath.Join(dir, "quits")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nexit 0\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Start(config.PluginConfig{Name: "quits", Command: script}, dir)
+	if err == nil || !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected the plugin to be closed, got %v", err)
+	}
+}
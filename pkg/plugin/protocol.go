@@ -0,0 +1,109 @@
+// Package plugin runs external programs that extend Skylark: providers of
+// models for custom backends, and processors that rewrite responses.
+//
+// A plugin is started once and talks JSON-RPC 2.0 over its stdin and
+// stdout, one message per line. Skylark sends requests; the plugin answers
+// each with a response carrying the same ID, in any order. The plugin
+// should exit when its stdin is closed and may log to stderr.
+//
+// Methods:
+//
+//   - initialize: sent first, without parameters. The result names the
+//     plugin and what it provides, e.g.
+//     {"name": "local-llm", "provider": true, "processor": false}.
+//   - provider/send: a conversation for one of its models, as
+//     {"model": "...", "messages": [...], "temperature": 0.7,
+//     "max_tokens": 2000}. Messages have a role, content, and the
+//     tool_calls or tool_call_id of tool turns. Commands asking for
+//     structured output add the JSON schema of the response as "schema".
+//     The result is {"content": "...", "usage": {...}, "tool_calls": [...]}.
+//   - processor/response: a response on its way to a document, as
+//     {"assistant": "...", "command": "...", "response": "..."}. The
+//     result is {"response": "..."}, the response to write instead.
+//
+// Errors are reported as JSON-RPC errors with a message.
+package plugin
+
+import (
+	"encoding/json"
+
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+)
+
+// Methods plugins answer
+const (
+	MethodInitialize = "initialize"
+	MethodSend       = "provider/send"
+	MethodResponse   = "processor/response"
+)
+
+// request is a JSON-RPC request
+type request struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      int64       `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+// response is a JSON-RPC response
+type response struct {
+	ID     int64           `json:"id"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *rpcError       `json:"error,omitempty"`
+}
+
+// rpcError is a JSON-RPC error object
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Info is what a plugin reports it provides
+type Info struct {
+	Name      string `json:"name"`
+	Provider  bool   `json:"provider"`  // Answers provider/send
+	Processor bool   `json:"processor"` // Answers processor/response
+}
+
+// SendParams are the parameters of provider/send
+type SendParams struct {
+	Model       string          `json:"model"`
+	Messages    []Message       `json:"messages"`
+	Temperature float64         `json:"temperature"`
+	MaxTokens   int             `json:"max_tokens"`
+	Schema      json.RawMessage `json:"schema,omitempty"` // JSON schema the response must conform to
+}
+
+// Message is a message of a conversation sent to a provider plugin
+type Message struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+// ToolCall is a model's request to call a tool
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"` // JSON
+}
+
+// SendResult is the result of provider/send
+type SendResult struct {
+	Content   string         `json:"content"`
+	Usage     provider.Usage `json:"usage"`
+	ToolCalls []ToolCall     `json:"tool_calls,omitempty"`
+}
+
+// ResponseParams are the parameters of processor/response
+type ResponseParams struct {
+	Assistant string `json:"assistant"`
+	Command   string `json:"command"`
+	Response  string `json:"response"`
+}
+
+// ResponseResult is the result of processor/response
+type ResponseResult struct {
+	Response string `json:"response"`
+}
@@ -2,6 +2,11 @@ package os
 
 import "github.com/butter-bot-machines/skylark/pkg/process"
 
+// CheckCgroups reports that memory limits cannot be enforced on Darwin
+func CheckCgroups() error {
+	return process.Error{Message: "memory limits not supported on Darwin"}
+}
+
 // applyMemoryLimit is a no-op on Darwin
 func applyMemoryLimit(p *Process) error {
 	// Memory limits not supported on Darwin
@@ -39,6 +39,20 @@ func newCgroupsController() (*cgroupsController, error) {
 	return nil, fmt.Errorf("cgroups not available")
 }
 
+// CheckCgroups reports whether tool memory limits can be enforced: cgroups
+// must be mounted and this process allowed to create groups in them
+func CheckCgroups() error {
+	controller, err := newCgroupsController()
+	if err != nil {
+		return err
+	}
+	probe := filepath.Join(controller.basePath, fmt.Sprintf("skylark-probe-%d", os.Getpid()))
+	if err := os.Mkdir(probe, 0755); err != nil {
+		return fmt.Errorf("cannot create cgroups in %s: %w", controller.basePath, err)
+	}
+	return os.Remove(probe)
+}
+
 // setupMemoryLimit creates a cgroup and sets memory limit
 func (c *cgroupsController) setupMemoryLimit(pid int, limitMB int64) error {
 	cgroupPath := filepath.Join(c.basePath, fmt.Sprintf("skylark-%d", pid))
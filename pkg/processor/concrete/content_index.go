@@ -0,0 +1,101 @@
+package concrete
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/butter-bot-machines/skylark/pkg/fs/osfs"
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/state"
+)
+
+// stateFile holds the content index, relative to the configuration
+// directory
+var stateFile = filepath.Join(state.Dir, "content.json")
+
+// contentIndex records the hash of each document as of its last successful
+// processing, so saves that change nothing are not processed again
+type contentIndex struct {
+	path   string // Persisted here when set
+	mu     sync.Mutex
+	hashes map[string]string
+}
+
+// loadContentIndex loads the index persisted at path. An empty path keeps
+// the index in memory only; a missing or unreadable file starts empty.
+func loadContentIndex(path string) *contentIndex {
+	idx := &contentIndex{path: path, hashes: make(map[string]string)}
+	if path == "" {
+		return idx
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, iofs.ErrNotExist) {
+			logger.Warn("failed to read content index", "path", path, "error", err)
+		}
+		return idx
+	}
+	if err := json.Unmarshal(data, &idx.hashes); err != nil {
+		logger.Warn("ignoring invalid content index", "path", path, "error", err)
+		idx.hashes = make(map[string]string)
+	}
+	return idx
+}
+
+// unchanged reports whether document was last processed with hash
+func (c *contentIndex) unchanged(document, hash string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hashes[document] == hash
+}
+
+// record stores the hash of document and persists the index
+func (c *contentIndex) record(document, hash string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hashes[document] = hash
+	return c.save()
+}
+
+// forget removes document from the index, so it is processed again even
+// if unchanged
+func (c *contentIndex) forget(document string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.hashes, document)
+	return c.save()
+}
+
+// save persists the index. The caller holds c.mu.
+func (c *contentIndex) save() error {
+	if c.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(c.hashes, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	return osfs.WriteFile(c.path, data, 0644, false)
+}
+
+// contentHash hashes a document's content together with the commands
+// parsed from it, so changes to templates also count as changes
+func contentHash(content []byte, commands []*parser.Command) string {
+	h := sha256.New()
+	h.Write(content)
+	for _, cmd := range commands {
+		fmt.Fprintf(h, "\x00%s\x00%s", cmd.Assistant, cmd.Text)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,204 @@
+package concrete
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/assistant"
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+)
+
+// formatResponse renders a response in the format of its command or
+// assistant. Tables are built from a columns and rows object or from a
+// list of records. Responses that do not match the format are returned
+// unchanged.
+func formatResponse(ctx context.Context, format string, response string) string {
+	switch format {
+	case assistant.FormatTable:
+		table, err := parseTableResponse(response)
+		if err != nil {
+			table, err = parseRecords(response)
+		}
+		if err != nil {
+			logging.FromContext(ctx, logger).Warn("response is not a table", "error", err)
+			return response
+		}
+		return table.Markdown()
+	case assistant.FormatJSON:
+		return fenceJSON(response)
+	}
+	return response
+}
+
+// fenceJSON returns a JSON response indented in a fenced json block.
+// Other responses are returned unchanged.
+func fenceJSON(response string) string {
+	body := unfence(response)
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, []byte(body), "", "  "); err != nil {
+		return response
+	}
+	return "```json\n" + indented.String() + "\n```"
+}
+
+// unfence returns response without the code fence around it, if any
+func unfence(response string) string {
+	body := strings.TrimSpace(response)
+	if strings.HasPrefix(body, "```") {
+		body = strings.TrimSuffix(body, "```")
+		if i := strings.Index(body, "\n"); i >= 0 {
+			body = body[i+1:]
+		}
+	}
+	return strings.TrimSpace(body)
+}
+
+// responseMetadata describes how a response was produced
+type responseMetadata struct {
+	Assistant string
+	Model     string
+	At        time.Time
+	Tokens    provider.Usage
+	Duration  time.Duration
+}
+
+// annotateResponse appends the metadata of a response in format, an HTML
+// comment unless the format is footer
+func annotateResponse(response string, format config.MetadataFormat, m responseMetadata) string {
+	at := m.At.UTC().Format(time.RFC3339)
+	duration := m.Duration.Round(100 * time.Millisecond)
+	model := ""
+	if m.Model != "" {
+		model = " (" + m.Model + ")"
+	}
+
+	var note string
+	if format == config.MetadataFooter {
+		note = fmt.Sprintf("*Generated by %s%s at %s · %d tokens (%d prompt, %d completion) · %s*",
+			m.Assistant, model, at, m.Tokens.TotalTokens, m.Tokens.PromptTokens, m.Tokens.CompletionTokens, duration)
+	} else {
+		note = fmt.Sprintf("<!-- skai: assistant=%s model=%s at=%s tokens=%d prompt_tokens=%d completion_tokens=%d duration=%s -->",
+			m.Assistant, m.Model, at, m.Tokens.TotalTokens, m.Tokens.PromptTokens, m.Tokens.CompletionTokens, duration)
+	}
+	return strings.TrimRight(response, "\n") + "\n\n" + note
+}
+
+// parseTableResponse reads a JSON table such as
+// {"columns": ["A"], "rows": [["1"]]}, optionally inside a code fence.
+// Cells may be strings, numbers, booleans or null.
+func parseTableResponse(response string) (*parser.TableData, error) {
+	body := unfence(response)
+
+	var raw struct {
+		Columns []string        `json:"columns"`
+		Rows    [][]interface{} `json:"rows"`
+	}
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("invalid table JSON: %w", err)
+	}
+	if len(raw.Columns) == 0 {
+		return nil, fmt.Errorf("table has no columns")
+	}
+
+	table := &parser.TableData{Columns: raw.Columns}
+	for _, row := range raw.Rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			if cell != nil {
+				cells[i] = fmt.Sprint(cell)
+			}
+		}
+		table.Rows = append(table.Rows, cells)
+	}
+	return table, nil
+}
+
+// parseRecords parses a JSON list of objects, or an object holding just
+// such a list, as a table with a column for each property in the order
+// they first appear. Nested values are written as JSON.
+func parseRecords(response string) (*parser.TableData, error) {
+	body := json.RawMessage(unfence(response))
+	var wrapper map[string]json.RawMessage
+	if json.Unmarshal(body, &wrapper) == nil && len(wrapper) == 1 {
+		for _, list := range wrapper {
+			body = list
+		}
+	}
+	var records []json.RawMessage
+	if err := json.Unmarshal(body, &records); err != nil {
+		return nil, fmt.Errorf("not a list of records: %w", err)
+	}
+
+	table := &parser.TableData{}
+	index := make(map[string]int)
+	var rows []map[string]string
+	for _, record := range records {
+		keys, values, err := orderedObject(record)
+		if err != nil {
+			return nil, fmt.Errorf("not a list of records: %w", err)
+		}
+		for _, key := range keys {
+			if _, ok := index[key]; !ok {
+				index[key] = len(table.Columns)
+				table.Columns = append(table.Columns, key)
+			}
+		}
+		rows = append(rows, values)
+	}
+	if len(table.Columns) == 0 {
+		return nil, fmt.Errorf("records have no properties")
+	}
+	for _, values := range rows {
+		cells := make([]string, len(table.Columns))
+		for key, value := range values {
+			cells[index[key]] = value
+		}
+		table.Rows = append(table.Rows, cells)
+	}
+	return table, nil
+}
+
+// orderedObject returns the keys of a JSON object in order and its values
+// as cell text
+func orderedObject(data json.RawMessage) ([]string, map[string]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if t, err := decoder.Token(); err != nil || t != json.Delim('{') {
+		return nil, nil, fmt.Errorf("expected an object")
+	}
+	var keys []string
+	values := make(map[string]string)
+	for decoder.More() {
+		t, err := decoder.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		key := t.(string)
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, key)
+		switch v := value.(type) {
+		case nil:
+			values[key] = ""
+		case string:
+			values[key] = v
+		case json.Number, bool:
+			values[key] = fmt.Sprint(v)
+		default:
+			nested, _ := json.Marshal(v)
+			values[key] = string(nested)
+		}
+	}
+	return keys, values, nil
+}
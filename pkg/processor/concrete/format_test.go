@@ -0,0 +1,114 @@
+package concrete
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/assistant"
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+)
+
+func TestFormatResponse(t *testing.T) {
+	table := "| Plan | Price |\n| ---- | ----- |\n| Free | 0     |\n| Team | 12.5  |"
+
+	tests := []struct {
+		name     string
+		format   string
+		response string
+		want     string
+	}{
+		{
+			name:     "text",
+			format:   assistant.FormatText,
+			response: `{"columns": ["Plan"], "rows": []}`,
+			want:     `{"columns": ["Plan"], "rows": []}`,
+		},
+		{
+			name:     "table",
+			format:   assistant.FormatTable,
+			response: `{"columns": ["Plan", "Price"], "rows": [["Free", 0], ["Team", 12.5]]}`,
+			want:     table,
+		},
+		{
+			name:     "fenced table",
+			format:   assistant.FormatTable,
+			response: "```json\n{\"columns\": [\"Plan\", \"Price\"], \"rows\": [[\"Free\", \"0\"], [\"Team\", \"12.5\"]]}\n```",
+			want:     table,
+		},
+		{
+			name:     "null cells",
+			format:   assistant.FormatTable,
+			response: `{"columns": ["A", "B"], "rows": [[null, true]]}`,
+			want:     "| A   | B    |\n| --- | ---- |\n|     | true |",
+		},
+		{
+			name:     "not JSON",
+			format:   assistant.FormatTable,
+			response: "Sorry, I cannot make a table.",
+			want:     "Sorry, I cannot make a table.",
+		},
+		{
+			name:     "records",
+			format:   assistant.FormatTable,
+			response: `{"contacts": [{"name": "Ana", "email": "ana@example.com"}, {"name": "Bo", "tags": ["x"]}]}`,
+			want:     "| name | email           | tags  |\n| ---- | --------------- | ----- |\n| Ana  | ana@example.com |       |\n| Bo   |                 | [\"x\"] |",
+		},
+		{
+			name:     "json",
+			format:   assistant.FormatJSON,
+			response: `{"name":"Ana","age":41}`,
+			want:     "```json\n{\n  \"name\": \"Ana\",\n  \"age\": 41\n}\n```",
+		},
+		{
+			name:     "json not valid",
+			format:   assistant.FormatJSON,
+			response: "No contacts found.",
+			want:     "No contacts found.",
+		},
+		{
+			name:     "no columns",
+			format:   assistant.FormatTable,
+			response: `{"rows": [["a"]]}`,
+			want:     `{"rows": [["a"]]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatResponse(context.Background(), tt.format, tt.response); got != tt.want {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAnnotateResponse(t *testing.T) {
+	meta := responseMetadata{
+		Assistant: "researcher",
+		Model:     "gpt-4",
+		At:        time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC),
+		Tokens:    provider.Usage{PromptTokens: 120, CompletionTokens: 30, TotalTokens: 150},
+		Duration:  1234 * time.Millisecond,
+	}
+
+	tests := []struct {
+		format config.MetadataFormat
+		want   string
+	}{
+		{
+			format: "",
+			want:   "Answer\n\n<!-- skai: assistant=researcher model=gpt-4 at=2024-03-01T12:30:00Z tokens=150 prompt_tokens=120 completion_tokens=30 duration=1.2s -->",
+		},
+		{
+			format: config.MetadataFooter,
+			want:   "Answer\n\n*Generated by researcher (gpt-4) at 2024-03-01T12:30:00Z · 150 tokens (120 prompt, 30 completion) · 1.2s*",
+		},
+	}
+	for _, tt := range tests {
+		if got := annotateResponse("Answer\n", tt.format, meta); got != tt.want {
+			t.Errorf("Expected %q for format %q, got %q", tt.want, tt.format, got)
+		}
+	}
+}
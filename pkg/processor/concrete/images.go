@@ -0,0 +1,93 @@
+package concrete
+
+import (
+	"context"
+	"fmt"
+	iofs "io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+)
+
+// maxImageSize bounds an image sent to a provider, whatever the file
+// guard allows
+const maxImageSize = 20 * 1024 * 1024
+
+// maxSchemaSize bounds the JSON schema of a structured response
+const maxSchemaSize = 1024 * 1024
+
+// imageTypes are the media types providers accept for images
+var imageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// attachImages loads the images cmd shows, relative to the directory of
+// the document at from. Images that cannot be read, are too large or are
+// not PNG, JPEG, GIF or WebP are logged and left without data.
+func (p *processorImpl) attachImages(ctx context.Context, cmd *parser.Command, from string) {
+	log := logging.FromContext(ctx, logger)
+	for i := range cmd.Images {
+		image := &cmd.Images[i]
+		data, err := p.readBeside(from, image.Path, maxImageSize)
+		if err != nil {
+			log.Warn("image not attached", "image", image.Path, "error", err)
+			continue
+		}
+		mediaType := http.DetectContentType(data)
+		if !imageTypes[mediaType] {
+			log.Warn("image not attached", "image", image.Path, "error", fmt.Sprintf("unsupported image type %s", mediaType))
+			continue
+		}
+		image.MediaType, image.Data = mediaType, data
+	}
+}
+
+// attachSchema loads the JSON schema cmd asks its response to conform to,
+// relative to the directory of the document at from. A schema that cannot
+// be read is logged and left without data, which fails the command.
+func (p *processorImpl) attachSchema(ctx context.Context, cmd *parser.Command, from string) {
+	if cmd.Schema == nil {
+		return
+	}
+	data, err := p.readBeside(from, cmd.Schema.Path, maxSchemaSize)
+	if err != nil {
+		logging.FromContext(ctx, logger).Warn("schema not attached", "schema", cmd.Schema.Path, "error", err)
+		return
+	}
+	cmd.Schema.Data = data
+}
+
+// readBeside reads the file at name relative to the directory of from,
+// checking it against the file guard and limit
+func (p *processorImpl) readBeside(from, name string, limit int64) ([]byte, error) {
+	var file string
+	var info iofs.FileInfo
+	var err error
+	if p.fs != nil {
+		file = path.Join(path.Dir(fsPath(from)), filepath.ToSlash(name))
+		info, err = iofs.Stat(p.fs, file)
+	} else {
+		file = name
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(from), filepath.FromSlash(name))
+		}
+		if err := p.guard.CheckRead(file); err != nil {
+			return nil, err
+		}
+		info, err = os.Stat(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > limit {
+		return nil, fmt.Errorf("file of %d bytes exceeds the limit of %d", info.Size(), limit)
+	}
+	return p.readFile(file)
+}
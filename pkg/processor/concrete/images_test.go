@@ -0,0 +1,93 @@
+package concrete
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/fs/memory"
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+)
+
+// pngHeader is enough of a PNG file for its type to be detected
+const pngHeader = "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+
+func TestAttachImages(t *testing.T) {
+	projectDir := t.TempDir()
+	writeFiles(t, projectDir, map[string]string{
+		"assets/arch.png":     pngHeader,
+		"assets/notes.txt":    "not an image",
+		"private/secret.png":  pngHeader,
+		"notes/diagrams.md":   "",
+		"notes/assets/up.png": pngHeader,
+	})
+	resolver := newReferenceProcessor(t, projectDir, Options{})
+
+	cmd, err := parser.New().ParseCommand("!default describe ![arch](../assets/arch.png), ![up](assets/up.png), ![text](../assets/notes.txt), ![gone](gone.png) and ![secret](../private/secret.png)")
+	if err != nil {
+		t.Fatalf("Failed to parse command: %v", err)
+	}
+	resolver.AttachReferences(context.Background(), cmd, filepath.Join(projectDir, "notes", "diagrams.md"), "")
+
+	loaded := map[string]bool{"arch": true, "up": true}
+	for _, image := range cmd.Images {
+		if loaded[image.Alt] {
+			if image.MediaType != "image/png" || string(image.Data) != pngHeader {
+				t.Errorf("Expected %s to be loaded as a PNG, got %q (%d bytes)", image.Alt, image.MediaType, len(image.Data))
+			}
+			continue
+		}
+		if image.Data != nil {
+			t.Errorf("Expected %s to be left out, got %d bytes", image.Alt, len(image.Data))
+		}
+	}
+}
+
+func TestAttachImagesFS(t *testing.T) {
+	fsys := memory.New()
+	if err := fsys.MkdirAll("docs/img", 0755); err != nil {
+		t.Fatalf("MkdirAll() error = %v", err)
+	}
+	if err := fsys.WriteFile("docs/img/chart.png", []byte(pngHeader), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	resolver := newReferenceProcessor(t, t.TempDir(), Options{FS: fsys})
+
+	cmd, err := parser.New().ParseCommand("!default explain ![chart](img/chart.png)")
+	if err != nil {
+		t.Fatalf("Failed to parse command: %v", err)
+	}
+	resolver.AttachReferences(context.Background(), cmd, "docs/index.md", "")
+
+	if len(cmd.Images) != 1 || cmd.Images[0].MediaType != "image/png" {
+		t.Errorf("Expected the chart to be loaded, got %+v", cmd.Images)
+	}
+}
+
+func TestAttachSchema(t *testing.T) {
+	projectDir := t.TempDir()
+	writeFiles(t, projectDir, map[string]string{
+		"notes/contacts.json": `{"type": "object"}`,
+		"notes/meeting.md":    "",
+	})
+	resolver := newReferenceProcessor(t, projectDir, Options{})
+	from := filepath.Join(projectDir, "notes", "meeting.md")
+
+	cmd, err := parser.New().ParseCommand("!default list the attendees --schema contacts.json")
+	if err != nil {
+		t.Fatalf("Failed to parse command: %v", err)
+	}
+	resolver.AttachReferences(context.Background(), cmd, from, "")
+	if cmd.Schema == nil || string(cmd.Schema.Data) != `{"type": "object"}` {
+		t.Errorf("Expected the schema to be loaded, got %+v", cmd.Schema)
+	}
+
+	cmd, err = parser.New().ParseCommand("!default list the attendees --schema gone.json")
+	if err != nil {
+		t.Fatalf("Failed to parse command: %v", err)
+	}
+	resolver.AttachReferences(context.Background(), cmd, from, "")
+	if cmd.Schema == nil || cmd.Schema.Data != nil {
+		t.Errorf("Expected a missing schema to be left without data, got %+v", cmd.Schema)
+	}
+}
@@ -0,0 +1,31 @@
+package concrete
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+)
+
+// RefreshKnowledge re-indexes the knowledge files of an assistant that
+// changed. Responses recorded but not yet written for the assistant drew
+// on the old knowledge, so they are dropped and asked again.
+func (p *processorImpl) RefreshKnowledge(ctx context.Context, assistant string) error {
+	changed, err := p.assistants.RefreshKnowledge(assistant)
+	if err != nil {
+		return fmt.Errorf("failed to refresh knowledge of %s: %w", assistant, err)
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	dropped, err := p.state.DropAnswered(assistant)
+	if err != nil {
+		return fmt.Errorf("failed to drop stale responses: %w", err)
+	}
+	if dropped > 0 {
+		logging.FromContext(ctx, logger).Info("dropped responses based on stale knowledge",
+			"assistant", assistant,
+			"responses", dropped)
+	}
+	return nil
+}
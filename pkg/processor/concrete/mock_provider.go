@@ -11,7 +11,7 @@ type mockProvider struct {
 	response string
 }
 
-func (p *mockProvider) Send(ctx context.Context, prompt string, opts *provider.RequestOptions) (*provider.Response, error) {
+func (p *mockProvider) Send(ctx context.Context, messages []provider.Message, opts *provider.RequestOptions) (*provider.Response, error) {
 	return &provider.Response{
 		Content: p.response,
 		Usage: provider.Usage{
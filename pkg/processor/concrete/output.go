@@ -0,0 +1,224 @@
+package concrete
+
+import (
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+)
+
+// responseFileSuffix names the sibling file of a document that receives
+// responses in file mode
+const responseFileSuffix = ".skylark.md"
+
+// responsesHeading is the section that receives responses in section mode
+const responsesHeading = "## Responses"
+
+// responseFile returns the sibling file receiving the responses of the
+// document at path
+func responseFile(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + responseFileSuffix
+}
+
+// isResponseFile reports whether path is a sibling response file, which
+// is not processed as a document
+func isResponseFile(path string) bool {
+	return strings.HasSuffix(path, responseFileSuffix)
+}
+
+// outputMode returns where the response to cmd goes: the command's own
+// mode, the assistant's, or inline
+func (p *processorImpl) outputMode(cmd *parser.Command) string {
+	if cmd.Output != "" {
+		return cmd.Output
+	}
+	if a, err := p.assistants.Get(cmd.Assistant); err == nil && a.Output != "" {
+		return a.Output
+	}
+	return parser.OutputInline
+}
+
+// mergeResponses writes each response to content as its command's output
+// mode says and invalidates the command, except in replace mode where the
+// response takes its place. Responses in file mode are linked to
+// responseFile, which UpdateFile writes. Only the lines commandLines
+// allows are matched against commands, all of them when it is nil. Every
+// command must still be in content.
+func mergeResponses(content string, responses []processor.Response, responseFile string, commandLines []bool) (string, error) {
+	// Split content into lines
+	lines := strings.Split(content, "\n")
+	var newLines []string
+	var sectioned []processor.Response
+	commandsFound := make(map[string]bool)
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		// Check if the command that was processed starts on this line
+		var match *processor.Response
+		for j := range responses {
+			if commandLines != nil && !commandLines[i] {
+				break
+			}
+			if parser.MatchesAt(lines, i, responses[j].Command.Original) {
+				commandsFound[responses[j].Command.Original] = true
+				match = &responses[j]
+				break
+			}
+		}
+		if match == nil {
+			newLines = append(newLines, line)
+			continue
+		}
+
+		// Invalidate the command since it was processed, keeping the lines
+		// that continue it
+		mode := match.Command.Output
+		last := i + strings.Count(match.Command.Original, "\n")
+		if mode != parser.OutputReplace {
+			newLines = append(newLines, strings.Replace(line, "!", "-!", 1))
+			newLines = append(newLines, lines[i+1:last+1]...)
+		}
+		i = last
+
+		var response string
+		switch mode {
+		case parser.OutputSection:
+			sectioned = append(sectioned, *match)
+			continue
+		case parser.OutputFile:
+			response = fmt.Sprintf("[Response](%s)", responseFile)
+		case parser.OutputCallout:
+			response = callout(match.Command.Assistant, match.Response)
+		default:
+			response = match.Response
+		}
+
+		// Add blank line before response if needed
+		if len(newLines) > 0 && strings.TrimSpace(newLines[len(newLines)-1]) != "" {
+			newLines = append(newLines, "")
+		}
+
+		// Add response
+		newLines = append(newLines, response)
+
+		// Add blank line after response if next line is not blank and not a command
+		if i+1 < len(lines) {
+			nextLine := strings.TrimSpace(lines[i+1])
+			if nextLine != "" && !strings.HasPrefix(nextLine, "!") {
+				newLines = append(newLines, "")
+			}
+		}
+	}
+
+	// Verify all commands were found
+	for _, r := range responses {
+		if !commandsFound[r.Command.Original] {
+			return "", fmt.Errorf("%w: command not found in file: %s", processor.ErrConflict, r.Command.Original)
+		}
+	}
+
+	newLines = appendToSection(newLines, sectioned)
+
+	// Ensure single blank line at end
+	for len(newLines) > 0 && strings.TrimSpace(newLines[len(newLines)-1]) == "" {
+		newLines = newLines[:len(newLines)-1]
+	}
+	newLines = append(newLines, "")
+
+	return strings.Join(newLines, "\n"), nil
+}
+
+// callout renders a response as an Obsidian callout, which other Markdown
+// renderers show as a blockquote
+func callout(assistant, response string) string {
+	lines := []string{"> [!note] " + assistant}
+	for _, line := range strings.Split(strings.TrimRight(response, "\n"), "\n") {
+		lines = append(lines, strings.TrimRight("> "+line, " "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// responseEntry renders a response under a heading naming its command
+func responseEntry(level string, r processor.Response) []string {
+	return []string{level + " " + r.Command.Text, "", strings.TrimRight(r.Response, "\n"), ""}
+}
+
+// appendToSection adds responses at the end of the Responses section of
+// lines, creating the section at the end of the document when there is
+// none
+func appendToSection(lines []string, responses []processor.Response) []string {
+	if len(responses) == 0 {
+		return lines
+	}
+	var entries []string
+	for _, r := range responses {
+		entries = append(entries, responseEntry("###", r)...)
+	}
+
+	// The section ends at the next heading of the same or a higher level
+	start := -1
+	for i, line := range lines {
+		if strings.EqualFold(strings.TrimSpace(line), responsesHeading) {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+			lines = lines[:len(lines)-1]
+		}
+		lines = append(lines, "", responsesHeading, "")
+		return append(lines, entries...)
+	}
+	end := len(lines)
+	for i := start + 1; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(trimmed, "# ") || strings.HasPrefix(trimmed, "## ") {
+			end = i
+			break
+		}
+	}
+	body := lines[:end]
+	for len(body) > start+1 && strings.TrimSpace(body[len(body)-1]) == "" {
+		body = body[:len(body)-1]
+	}
+
+	merged := append([]string(nil), body...)
+	merged = append(merged, "")
+	merged = append(merged, entries...)
+	return append(merged, lines[end:]...)
+}
+
+// writeResponseFile appends the responses in file mode to the sibling
+// response file of the document at path
+func (p *processorImpl) writeResponseFile(path string, responses []processor.Response) error {
+	var entries []string
+	for _, r := range responses {
+		if r.Command.Output == parser.OutputFile {
+			entries = append(entries, responseEntry("##", r)...)
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	target := responseFile(path)
+	existing, err := p.readFile(target)
+	if errors.Is(err, iofs.ErrNotExist) {
+		name := filepath.Base(path)
+		existing = []byte(fmt.Sprintf("# Responses to [%s](%s)\n", strings.TrimSuffix(name, filepath.Ext(name)), name))
+	} else if err != nil {
+		return fmt.Errorf("failed to read response file: %w", err)
+	}
+
+	content := strings.TrimRight(string(existing), "\n") + "\n\n" + strings.Join(entries, "\n")
+	if err := p.writeFile(target, []byte(content)); err != nil {
+		return fmt.Errorf("failed to write response file: %w", err)
+	}
+	return nil
+}
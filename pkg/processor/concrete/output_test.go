@@ -0,0 +1,145 @@
+package concrete
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+)
+
+func TestMergeResponsesOutputModes(t *testing.T) {
+	response := func(output string) []processor.Response {
+		return []processor.Response{{
+			Command:  &parser.Command{Original: "!test summarize", Assistant: "test", Text: "summarize", Output: output},
+			Response: "Line one\n\nLine two",
+		}}
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		output  string
+		want    string
+	}{
+		{
+			name:    "inline",
+			content: "# Notes\n!test summarize\nMore text\n",
+			output:  parser.OutputInline,
+			want:    "# Notes\n-!test summarize\n\nLine one\n\nLine two\n\nMore text\n",
+		},
+		{
+			name:    "replace",
+			content: "# Notes\n\n!test summarize\nMore text\n",
+			output:  parser.OutputReplace,
+			want:    "# Notes\n\nLine one\n\nLine two\n\nMore text\n",
+		},
+		{
+			name:    "callout",
+			content: "# Notes\n!test summarize\n",
+			output:  parser.OutputCallout,
+			want:    "# Notes\n-!test summarize\n\n> [!note] test\n> Line one\n>\n> Line two\n",
+		},
+		{
+			name:    "new section",
+			content: "# Notes\n!test summarize\n",
+			output:  parser.OutputSection,
+			want:    "# Notes\n-!test summarize\n\n## Responses\n\n### summarize\n\nLine one\n\nLine two\n",
+		},
+		{
+			name:    "existing section",
+			content: "# Notes\n!test summarize\n\n## Responses\n\n### earlier\n\nOld\n\n## Appendix\nEnd\n",
+			output:  parser.OutputSection,
+			want:    "# Notes\n-!test summarize\n\n## Responses\n\n### earlier\n\nOld\n\n### summarize\n\nLine one\n\nLine two\n\n## Appendix\nEnd\n",
+		},
+		{
+			name:    "file",
+			content: "# Notes\n!test summarize\n",
+			output:  parser.OutputFile,
+			want:    "# Notes\n-!test summarize\n\n[Response](notes.skylark.md)\n",
+		},
+		{
+			name:    "example in code",
+			content: "# Notes\n```\n!test summarize\n```\n> !test summarize\n!test summarize\n",
+			output:  parser.OutputInline,
+			want:    "# Notes\n```\n!test summarize\n```\n> !test summarize\n-!test summarize\n\nLine one\n\nLine two\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mergeResponses(tt.content, response(tt.output), "notes.skylark.md", parser.New().CommandLines(tt.content))
+			if err != nil {
+				t.Fatalf("Failed to merge responses: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Content mismatch\nExpected:\n%s\nGot:\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMergeResponsesContinued(t *testing.T) {
+	content := "# Notes\n!test summarize \\\nbriefly\n  in French\nMore text\n"
+	cmd, err := parser.New().ParseCommand("!test summarize \\\nbriefly\n  in French")
+	if err != nil {
+		t.Fatalf("ParseCommand() error = %v", err)
+	}
+
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{parser.OutputInline, "# Notes\n-!test summarize \\\nbriefly\n  in French\n\nRésumé\n\nMore text\n"},
+		{parser.OutputReplace, "# Notes\n\nRésumé\n\nMore text\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.output, func(t *testing.T) {
+			c := *cmd
+			c.Output = tt.output
+			got, err := mergeResponses(content, []processor.Response{{Command: &c, Response: "Résumé"}}, "notes.skylark.md", nil)
+			if err != nil {
+				t.Fatalf("Failed to merge responses: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Content mismatch\nExpected:\n%s\nGot:\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestProcessorResponseFile(t *testing.T) {
+	projectDir := t.TempDir()
+	calls := 0
+	proc := newCountingProcessor(t, projectDir, "An answer", &calls)
+
+	testFile := filepath.Join(projectDir, "notes.md")
+	if err := os.WriteFile(testFile, []byte("# Notes\n!test first output:file\n!test second output:file\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := proc.ProcessFile(testFile); err != nil {
+		t.Fatalf("Failed to process file: %v", err)
+	}
+
+	siblingFile := filepath.Join(projectDir, "notes.skylark.md")
+	sibling, err := os.ReadFile(siblingFile)
+	if err != nil {
+		t.Fatalf("Failed to read response file: %v", err)
+	}
+	expected := "# Responses to [notes](notes.md)\n\n## first\n\nAn answer\n\n## second\n\nAn answer\n"
+	if string(sibling) != expected {
+		t.Errorf("Response file mismatch\nExpected:\n%s\nGot:\n%s", expected, sibling)
+	}
+
+	// The response file is not processed as a document
+	if err := os.WriteFile(siblingFile, append(sibling, []byte("!test ignored\n")...), 0644); err != nil {
+		t.Fatalf("Failed to update response file: %v", err)
+	}
+	if err := proc.ProcessFile(siblingFile); err != nil {
+		t.Fatalf("Failed to process response file: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Expected 2 requests, got %d", calls)
+	}
+}
@@ -0,0 +1,151 @@
+package concrete
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/butter-bot-machines/skylark/pkg/assistant"
+	"github.com/butter-bot-machines/skylark/pkg/filter"
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+	"github.com/butter-bot-machines/skylark/pkg/state"
+	"github.com/butter-bot-machines/skylark/pkg/tracing"
+)
+
+// A document goes through these stages:
+//
+//  1. parse: its commands are parsed (parseDocument)
+//  2. context: each command gets the sections it references
+//     (AttachReferences)
+//  3. provider and tools: the command is sent to its assistant, whose
+//     model may call tools and is asked again when the response breaks
+//     the assistant's constraints (ask), after the OnCommandStart hooks
+//  4. post-process: the response is formatted and filtered, then passed
+//     to the OnResponse hooks (postProcess)
+//  5. write: the responses are merged into the document (UpdateFile),
+//     whose content passes the OnFileWrite hooks (writeFile)
+//
+// ProcessContext runs stages 3 and 4 for a single command.
+
+// parseDocument reads the document at path and parses its commands
+func (p *processorImpl) parseDocument(ctx context.Context, path string) ([]byte, []*parser.Command, error) {
+	content, err := p.readFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	_, span := tracing.Start(ctx, "file.parse",
+		tracing.WithAttributes(tracing.String("file.path", path)))
+	commands, err := p.parseCommands(path, string(content))
+	span.SetAttributes(tracing.Int("command.count", len(commands)))
+	span.RecordError(err)
+	span.End()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse commands: %w", err)
+	}
+	return content, commands, nil
+}
+
+// incrementalSize is the size from which a document's commands are
+// parsed incrementally, re-parsing only the sections that changed since it
+// was last parsed
+const incrementalSize = 64 * 1024
+
+// parseCommands parses the commands of content, the document at path
+func (p *processorImpl) parseCommands(path, content string) ([]*parser.Command, error) {
+	if len(content) < incrementalSize {
+		return p.parser.ParseCommands(content)
+	}
+	p.mu.Lock()
+	inc, ok := p.parsed[path]
+	if !ok {
+		inc = parser.NewIncremental(p.parser)
+		p.parsed[path] = inc
+	}
+	p.mu.Unlock()
+	return inc.ParseCommands(content)
+}
+
+// answerCommands gives each command of the document at path its context
+// and runs it, returning the responses to write
+func (p *processorImpl) answerCommands(ctx context.Context, path, document string, content []byte, commands []*parser.Command, instances []state.Instance) ([]processor.Response, error) {
+	var responses []processor.Response
+	for i, cmd := range commands {
+		p.AttachReferences(ctx, cmd, path, string(content))
+		response, err := p.runCommand(ctx, document, instances[i], cmd)
+		if err != nil {
+			return nil, err
+		}
+		if response != "" {
+			cmd.Output = p.outputMode(cmd)
+			responses = append(responses, processor.Response{
+				Command:  cmd,
+				Response: response,
+			})
+		}
+	}
+	return responses, nil
+}
+
+// ask runs the OnCommandStart hooks, then sends cmd to its assistant,
+// which answers the tool calls of its model
+func (p *processorImpl) ask(ctx context.Context, cmd *parser.Command) (*assistant.Assistant, string, error) {
+	for _, h := range p.hooks {
+		if h.OnCommandStart == nil {
+			continue
+		}
+		if err := h.OnCommandStart(ctx, cmd); err != nil {
+			return nil, "", fmt.Errorf("command start hook failed: %w", err)
+		}
+	}
+
+	a, err := p.assistants.Get(cmd.Assistant)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get assistant: %w", err)
+	}
+	response, err := a.ProcessContext(ctx, cmd)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to process command: %w", err)
+	}
+	return a, response, nil
+}
+
+// postProcess formats the response of a as cmd asks, runs the configured filters
+// before it reaches a document, then the OnResponse hooks
+func (p *processorImpl) postProcess(ctx context.Context, cmd *parser.Command, a *assistant.Assistant, response string) (string, error) {
+	response = formatResponse(ctx, a.ResponseFormat(cmd), response)
+
+	filters, err := filter.New(p.config.ResponseFilters(cmd.Assistant), p.assistants)
+	if err != nil {
+		return "", fmt.Errorf("invalid response filters: %w", err)
+	}
+	response, err = filters.Apply(ctx, response)
+	if err != nil {
+		return "", fmt.Errorf("failed to filter response: %w", err)
+	}
+
+	for _, h := range p.hooks {
+		if h.OnResponse == nil {
+			continue
+		}
+		if response, err = h.OnResponse(ctx, cmd, response); err != nil {
+			return "", fmt.Errorf("response hook failed: %w", err)
+		}
+	}
+	return response, nil
+}
+
+// beforeWrite passes the content about to be written to path through the
+// OnFileWrite hooks
+func (p *processorImpl) beforeWrite(path string, data []byte) ([]byte, error) {
+	for _, h := range p.hooks {
+		if h.OnFileWrite == nil {
+			continue
+		}
+		var err error
+		if data, err = h.OnFileWrite(path, data); err != nil {
+			return nil, fmt.Errorf("file write hook failed: %w", err)
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,157 @@
+package concrete
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+)
+
+// placeholder stands under a command while it is processed, when
+// output.placeholder is set
+const placeholder = "⏳ processing..."
+
+// insertPlaceholders invalidates each of commands in content and writes
+// the placeholder below it, between blank lines. Only the lines
+// commandLines allows are matched against commands.
+func insertPlaceholders(content string, commands []*parser.Command, commandLines []bool) string {
+	lines := strings.Split(content, "\n")
+	var newLines []string
+	for i := 0; i < len(lines); i++ {
+		last := -1
+		if commandLines[i] {
+			for _, cmd := range commands {
+				if parser.MatchesAt(lines, i, cmd.Original) {
+					last = i + strings.Count(cmd.Original, "\n")
+					break
+				}
+			}
+		}
+		if last < 0 {
+			newLines = append(newLines, lines[i])
+			continue
+		}
+		newLines = append(newLines, strings.Replace(lines[i], "!", "-!", 1))
+		newLines = append(newLines, lines[i+1:last+1]...)
+		newLines = append(newLines, "", placeholder, "")
+		i = last
+	}
+	return strings.Join(newLines, "\n")
+}
+
+// removePlaceholders undoes insertPlaceholders for those of commands
+// whose placeholder is still in content, making them commands again
+func removePlaceholders(content string, commands []*parser.Command) string {
+	lines := strings.Split(content, "\n")
+	var newLines []string
+	for i := 0; i < len(lines); i++ {
+		last := -1
+		for _, cmd := range commands {
+			end := i + strings.Count(cmd.Original, "\n")
+			if parser.MatchesAt(lines, i, "-"+cmd.Original) && end+3 < len(lines) &&
+				lines[end+1] == "" && lines[end+2] == placeholder && lines[end+3] == "" {
+				last = end
+				break
+			}
+		}
+		if last < 0 {
+			newLines = append(newLines, lines[i])
+			continue
+		}
+		newLines = append(newLines, strings.Replace(lines[i], "-!", "!", 1))
+		newLines = append(newLines, lines[i+1:last+1]...)
+		i = last + 3
+	}
+	return strings.Join(newLines, "\n")
+}
+
+// setPlaceheld records whether the document at path has placeholders
+// written by a run in progress
+func (p *processorImpl) setPlaceheld(path string, placeheld bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if placeheld {
+		p.placeheld[path] = true
+	} else {
+		delete(p.placeheld, path)
+	}
+}
+
+// writePlaceholders writes the placeholder under each of commands in the
+// document at path and returns the content written. The document is left
+// alone if it changes meanwhile.
+func (p *processorImpl) writePlaceholders(path string, commands []*parser.Command) ([]byte, error) {
+	content, err := p.readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	placeheld := []byte(insertPlaceholders(string(content), commands, p.parser.CommandLines(string(content))))
+	current, err := p.readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(current, content) {
+		return nil, fmt.Errorf("%s changed while placeholders were written", path)
+	}
+	p.setPlaceheld(path, true)
+	if err := p.writeFile(path, placeheld); err != nil {
+		p.setPlaceheld(path, false)
+		return nil, err
+	}
+	return placeheld, nil
+}
+
+// clearPlaceholders makes the commands whose placeholder is still in the
+// document at path commands again, after processing them failed
+func (p *processorImpl) clearPlaceholders(ctx context.Context, path string, commands []*parser.Command) {
+	if len(commands) == 0 {
+		return
+	}
+	content, err := p.readFile(path)
+	if err == nil {
+		if restored := removePlaceholders(string(content), commands); restored != string(content) {
+			err = p.writeFile(path, []byte(restored))
+		}
+	}
+	if err != nil {
+		logging.FromContext(ctx, logger).Warn("failed to remove placeholders", "file", path, "error", err)
+	}
+}
+
+// recoverPlaceholders makes the commands left with placeholders in the
+// document at path by a run that was interrupted commands again. The
+// placeholders of a run in progress are left alone.
+func (p *processorImpl) recoverPlaceholders(ctx context.Context, path string) {
+	p.mu.Lock()
+	running := p.placeheld[path]
+	p.mu.Unlock()
+	if running {
+		return
+	}
+	content, err := p.readFile(path)
+	if err != nil || !bytes.Contains(content, []byte(placeholder)) {
+		return
+	}
+
+	// Parse the invalidated commands as if they were not
+	lines := strings.Split(string(content), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "-!") {
+			lines[i] = strings.Replace(line, "-!", "!", 1)
+		}
+	}
+	commands, err := p.parser.ParseCommands(strings.Join(lines, "\n"))
+	if err != nil {
+		logging.FromContext(ctx, logger).Debug("placeholders not recovered", "file", path, "error", err)
+		return
+	}
+	if restored := removePlaceholders(string(content), commands); restored != string(content) {
+		logging.FromContext(ctx, logger).Info("recovering commands of an interrupted run", "file", path)
+		if err := p.writeFile(path, []byte(restored)); err != nil {
+			logging.FromContext(ctx, logger).Warn("failed to remove placeholders", "file", path, "error", err)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package concrete
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/state"
+)
+
+func TestPlaceholders(t *testing.T) {
+	p := parser.New()
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "single command",
+			content: "# Notes\n!test draft\nMore.\n",
+			want:    "# Notes\n-!test draft\n\n" + placeholder + "\n\nMore.\n",
+		},
+		{
+			name:    "continued command at the end",
+			content: "!test draft \\\nin two lines",
+			want:    "-!test draft \\\nin two lines\n\n" + placeholder + "\n",
+		},
+		{
+			name:    "example in code",
+			content: "```\n!test draft\n```\n!test draft\n",
+			want:    "```\n!test draft\n```\n-!test draft\n\n" + placeholder + "\n\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commands, err := p.ParseCommands(tt.content)
+			if err != nil {
+				t.Fatalf("ParseCommands() error = %v", err)
+			}
+			got := insertPlaceholders(tt.content, commands, p.CommandLines(tt.content))
+			if got != tt.want {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.want, got)
+			}
+			if restored := removePlaceholders(got, commands); restored != tt.content {
+				t.Errorf("Expected the content restored, got:\n%q", restored)
+			}
+		})
+	}
+
+	// A placeholder edited away leaves its command invalidated
+	content := "-!test draft\n\nedited\n\n"
+	commands, _ := p.ParseCommands("!test draft")
+	if got := removePlaceholders(content, commands); got != content {
+		t.Errorf("Expected content unchanged, got %q", got)
+	}
+}
+
+func TestProcessorPlaceholder(t *testing.T) {
+	projectDir := t.TempDir()
+	testFile := filepath.Join(projectDir, "notes.md")
+	original := "# Notes\n!test first\n!test second output:replace\n"
+	if err := os.WriteFile(testFile, []byte(original), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	cfg := &config.Config{Output: config.OutputConfig{Placeholder: true}}
+	calls := 0
+	var during []string
+	proc := newConfiguredProcessor(t, projectDir, cfg, Options{}, "An answer", &calls, func() {
+		content, _ := os.ReadFile(testFile)
+		during = append(during, string(content))
+	})
+	if err := proc.ProcessFile(testFile); err != nil {
+		t.Fatalf("Failed to process file: %v", err)
+	}
+
+	// Both commands show the placeholder while the first is answered
+	if len(during) == 0 || strings.Count(during[0], placeholder) != 2 || strings.Contains(during[0], "\n!test") {
+		t.Errorf("Expected placeholders under invalidated commands, got:\n%v", during)
+	}
+
+	// The responses replace the placeholders as if there were none
+	withoutDir := t.TempDir()
+	withoutFile := filepath.Join(withoutDir, "notes.md")
+	if err := os.WriteFile(withoutFile, []byte(original), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := newCountingProcessor(t, withoutDir, "An answer", &calls).ProcessFile(withoutFile); err != nil {
+		t.Fatalf("Failed to process file: %v", err)
+	}
+	got, _ := os.ReadFile(testFile)
+	want, _ := os.ReadFile(withoutFile)
+	if string(got) != string(want) {
+		t.Errorf("Expected:\n%s\nGot:\n%s", want, got)
+	}
+
+	// A failed command is a command again
+	failing := "# Notes\n!nobody help\n"
+	if err := os.WriteFile(testFile, []byte(failing), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if err := proc.ProcessFile(testFile); err == nil {
+		t.Error("Expected an error for an unknown assistant")
+	}
+	if content, _ := os.ReadFile(testFile); string(content) != failing {
+		t.Errorf("Expected the document restored, got:\n%s", content)
+	}
+}
+
+func TestProcessorRecoversPlaceholders(t *testing.T) {
+	projectDir := t.TempDir()
+	testFile := filepath.Join(projectDir, "notes.md")
+	calls := 0
+	proc := newCountingProcessor(t, projectDir, "fresh", &calls)
+
+	// A run was interrupted after the assistant answered the command
+	store, err := state.Open(filepath.Join(projectDir, ".skai"))
+	if err != nil {
+		t.Fatalf("Failed to open state: %v", err)
+	}
+	err = store.Put(testFile, state.Record{
+		Key:      state.Key("!test draft", 0),
+		Command:  "!test draft",
+		Outcome:  state.OutcomeAnswered,
+		Response: "recorded",
+	})
+	if err != nil {
+		t.Fatalf("Failed to record state: %v", err)
+	}
+	interrupted := "# Notes\n-!test draft\n\n" + placeholder + "\n\n-!test done\n\nAn answer.\n"
+	if err := os.WriteFile(testFile, []byte(interrupted), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	proc = newCountingProcessor(t, projectDir, "fresh", &calls)
+	if err := proc.ProcessFile(testFile); err != nil {
+		t.Fatalf("Failed to process file: %v", err)
+	}
+	if calls != 0 {
+		t.Errorf("Expected the recorded response to be written, got %d requests", calls)
+	}
+	want := "# Notes\n-!test draft\n\nrecorded\n\n-!test done\n\nAn answer.\n"
+	if content, _ := os.ReadFile(testFile); string(content) != want {
+		t.Errorf("Expected:\n%q\nGot:\n%q", want, content)
+	}
+}
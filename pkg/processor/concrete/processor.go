@@ -1,46 +1,102 @@
 package concrete
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"log/slog"
+	iofs "io/fs"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/butter-bot-machines/skylark/pkg/assistant"
+	"github.com/butter-bot-machines/skylark/pkg/breaker"
+	"github.com/butter-bot-machines/skylark/pkg/budget"
 	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/fs"
+	"github.com/butter-bot-machines/skylark/pkg/fs/guarded"
+	"github.com/butter-bot-machines/skylark/pkg/fs/osfs"
 	"github.com/butter-bot-machines/skylark/pkg/logging"
+	"github.com/butter-bot-machines/skylark/pkg/models"
+	"github.com/butter-bot-machines/skylark/pkg/notify"
 	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/plugin"
 	"github.com/butter-bot-machines/skylark/pkg/process"
 	procesos "github.com/butter-bot-machines/skylark/pkg/process/os"
 	"github.com/butter-bot-machines/skylark/pkg/processor"
 	"github.com/butter-bot-machines/skylark/pkg/provider"
+	"github.com/butter-bot-machines/skylark/pkg/provider/azure"
+	"github.com/butter-bot-machines/skylark/pkg/provider/compatible"
 	"github.com/butter-bot-machines/skylark/pkg/provider/openai"
 	"github.com/butter-bot-machines/skylark/pkg/provider/registry"
+	"github.com/butter-bot-machines/skylark/pkg/provider/replay"
 	"github.com/butter-bot-machines/skylark/pkg/sandbox"
+	"github.com/butter-bot-machines/skylark/pkg/security"
+	secconcrete "github.com/butter-bot-machines/skylark/pkg/security/concrete"
+	"github.com/butter-bot-machines/skylark/pkg/state"
+	"github.com/butter-bot-machines/skylark/pkg/template"
 	"github.com/butter-bot-machines/skylark/pkg/timing"
 	"github.com/butter-bot-machines/skylark/pkg/tool"
+	"github.com/butter-bot-machines/skylark/pkg/tracing"
 )
 
-var logger *slog.Logger
-
-func init() {
-	logger = logging.NewLogger(&logging.Options{
-		Level:     slog.LevelDebug,
-		AddSource: true,
-	})
-}
+// logger writes through the default handler installed by the CLI
+var logger = logging.Default()
 
 // processorImpl implements processor.ProcessManager
 type processorImpl struct {
 	config     *config.Config
 	assistants *assistant.Manager
+	tools      *tool.Manager
 	parser     *parser.Parser
 	procMgr    process.Manager
+	fs         fs.FS              // Documents are read and written through fs when set
+	disk       *guarded.FS        // Documents on the OS file system otherwise, under root
+	root       string             // Absolute project directory disk is rooted at
+	guard      security.FileGuard // Checks documents and the files they reference
+	index      *contentIndex      // Hashes of processed documents
+	state      *state.Store       // Outcome of each processed command
+	clock      timing.Clock
+	dryRun     func(path, before, after string)
+	hooks      []processor.Hooks // Run in order at the stages of processing
+	notifier   *notify.Notifier  // Told about processed files and failed commands
+	models     *models.Registry  // Context windows of models
+	plugins    []*plugin.Plugin  // Started for this processor, stopped by Close
+
+	mu        sync.Mutex
+	parsed    map[string]*parser.Incremental // Sections of large documents parsed, by path
+	placeheld map[string]bool                // Documents with placeholders of this processor, by path
+}
+
+// Options customizes a processor. The zero value gives the behaviour of
+// NewProcessor.
+type Options struct {
+	Providers       *registry.Registry   // Replaces the OpenAI provider registry
+	DefaultProvider string               // Provider for models without a prefix, defaults to "openai"
+	Tools           []tool.Definition    // In-process tools, registered alongside compiled ones
+	FS              fs.FS                // Documents are read and written here instead of the OS
+	Clock           timing.Clock         // Clock for process management, defaults to the system clock
+	AuditLog        security.AuditLogger // Records content filter matches (optional)
+	Hooks           []processor.Hooks    // Customize the stages of processing, run in order
+	Notifier        *notify.Notifier     // Sends processing events to the configured notifications (optional)
+	Breakers        *breaker.Set         // Circuit breakers of the providers, shared across processors (optional)
+
+	// DryRun, when set, receives every document change instead of it
+	// being written. Responses stay recorded as answered, so a later run
+	// writes them without asking again.
+	DryRun func(path, before, after string)
 }
 
 // NewProcessor creates a new processor
 func NewProcessor(cfg *config.Config) (processor.ProcessManager, error) {
+	return NewProcessorWithOptions(cfg, Options{})
+}
+
+// NewProcessorWithOptions creates a new processor customized by opts. The
+// processor must be closed to stop its plugins.
+func NewProcessorWithOptions(cfg *config.Config, opts Options) (_ processor.ProcessManager, err error) {
 	if cfg == nil {
 		return nil, fmt.Errorf("config is required")
 	}
@@ -51,30 +107,132 @@ func NewProcessor(cfg *config.Config) (processor.ProcessManager, error) {
 		return nil, fmt.Errorf("failed to create tool manager: %w", err)
 	}
 
+	for name, t := range cfg.Tools {
+		if t.GoFlags != "" || len(t.BuildEnv) > 0 {
+			toolMgr.SetBuildOptions(name, tool.BuildOptions{GoFlags: t.GoFlags, Env: t.BuildEnv})
+		}
+	}
+
+	// Resolve secret:// tool environment values from the key store
+	if cfg.Security.EncryptionKey != "" {
+		keys, err := secconcrete.NewKeyStore(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open secret store: %w", err)
+		}
+		toolMgr.SetSecrets(keys)
+	}
+
 	// Initialize builtin tools
 	if err := toolMgr.InitBuiltinTools(); err != nil {
 		return nil, fmt.Errorf("failed to initialize builtin tools: %w", err)
 	}
 
-	// Create provider registry
-	reg := registry.New()
+	// Register in-process tools
+	for _, def := range opts.Tools {
+		if err := toolMgr.Register(def); err != nil {
+			return nil, fmt.Errorf("failed to register tool: %w", err)
+		}
+	}
+
+	// Capabilities and prices of models, as configured
+	meta := models.New(cfg.ModelMetadata)
 
-	// Register provider factory
-	if cfg.Models["openai"]["gpt-4"].APIKey == "test-key" {
-		// Use mock provider in tests
-		reg.Register("openai", func(model string) (provider.Provider, error) {
-			return newMockProvider(), nil
-		})
-	} else {
-		// Use real OpenAI provider
-		reg.Register("openai", func(model string) (provider.Provider, error) {
-			modelConfig, ok := cfg.GetModelConfig("openai", model)
-			if !ok {
-				return nil, fmt.Errorf("OpenAI configuration not found for model: %s", model)
-			}
+	// Create provider registry, unless the caller supplied one
+	reg := opts.Providers
+	if reg == nil {
+		reg = registry.New()
 
-			return openai.New(model, modelConfig, openai.Options{})
-		})
+		// Register provider factory
+		if cfg.Models["openai"]["gpt-4"].APIKey == "test-key" {
+			// Use mock provider in tests
+			reg.Register("openai", func(model string) (provider.Provider, error) {
+				return newMockProvider(), nil
+			})
+		} else {
+			// Use real OpenAI provider
+			reg.Register("openai", func(model string) (provider.Provider, error) {
+				modelConfig, ok := cfg.GetModelConfig("openai", model)
+				if !ok {
+					return nil, fmt.Errorf("OpenAI configuration not found for model: %s", model)
+				}
+
+				return openai.New(model, modelConfig, openai.Options{Models: meta})
+			})
+		}
+
+		// Azure OpenAI deployments are addressed as azure-openai:<deployment>
+		if _, ok := cfg.Models[config.AzureOpenAI]; ok {
+			reg.Register(config.AzureOpenAI, func(deployment string) (provider.Provider, error) {
+				modelConfig, ok := cfg.GetModelConfig(config.AzureOpenAI, deployment)
+				if !ok {
+					return nil, fmt.Errorf("Azure OpenAI configuration not found for deployment: %s", deployment)
+				}
+				return azure.New(deployment, modelConfig, azure.Options{Models: meta})
+			})
+		}
+
+		// Models of OpenAI-compatible servers are addressed as
+		// openai-compatible:<model>
+		if _, ok := cfg.Models[config.OpenAICompatible]; ok {
+			reg.Register(config.OpenAICompatible, func(model string) (provider.Provider, error) {
+				modelConfig, ok := cfg.GetModelConfig(config.OpenAICompatible, model)
+				if !ok {
+					return nil, fmt.Errorf("OpenAI-compatible configuration not found for model: %s", model)
+				}
+				return compatible.New(model, modelConfig, compatible.Options{Models: meta})
+			})
+		}
+	}
+
+	// Start plugins, registering their providers and response hooks. They
+	// are stopped again when a later step fails.
+	var plugins []*plugin.Plugin
+	defer func() {
+		if err != nil {
+			closePlugins(plugins)
+		}
+	}()
+	var hooks []processor.Hooks
+	for _, pc := range cfg.Plugins {
+		pl, err := plugin.Start(pc, cfg.Environment.ConfigDir)
+		if err != nil {
+			return nil, err
+		}
+		plugins = append(plugins, pl)
+		if pl.Info.Provider {
+			reg.Register(pc.Name, pl.Provider)
+		}
+		if pl.Info.Processor {
+			hooks = append(hooks, pl.Hooks())
+		}
+	}
+	hooks = append(hooks, opts.Hooks...)
+
+	// Enforce the budget, with the system clock unless one was given
+	clock := opts.Clock
+	if clock == nil {
+		clock = timing.New()
+	}
+	// Stop sending requests to providers that are down
+	breakers := opts.Breakers
+	if breakers == nil {
+		breakers = breaker.New(cfg.Providers.Breaker, clock)
+		breakers.SetNotifier(opts.Notifier)
+	}
+	reg.Wrap(breakers.Wrap)
+
+	spending, err := budget.New(cfg, opts.AuditLog, clock)
+	if err != nil {
+		return nil, err
+	}
+	spending.SetNotifier(opts.Notifier)
+	reg.Wrap(spending.Wrap)
+
+	// Record or replay provider responses when configured. Replayed
+	// responses cost nothing, so they are not counted against the budget.
+	switch cfg.Providers.Mode {
+	case config.ProviderRecord, config.ProviderReplay:
+		reg.Wrap(replay.Wrap(filepath.Join(cfg.Environment.ConfigDir, replay.Dir), cfg.Providers.Mode))
 	}
 
 	// Create network policy
@@ -89,91 +247,504 @@ func NewProcessor(cfg *config.Config) (processor.ProcessManager, error) {
 		},
 	}
 
+	defaultProvider := opts.DefaultProvider
+	if defaultProvider == "" {
+		defaultProvider = "openai"
+	}
+
 	// Create assistant manager with provider registry
 	assistantMgr, err := assistant.NewManager(
 		filepath.Join(cfg.Environment.ConfigDir, "assistants"),
 		toolMgr,
 		reg,
 		networkPolicy,
-		"openai", // Default provider
+		defaultProvider,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create assistant manager: %w", err)
 	}
+	assistantMgr.SetToolConcurrency(cfg.ToolConcurrency())
+	if err := assistantMgr.SetToolQuotas(cfg.ToolQuotas(), assistant.QuotaOptions{
+		ConfigDir: cfg.Environment.ConfigDir,
+		AuditLog:  opts.AuditLog,
+		Clock:     clock,
+	}); err != nil {
+		return nil, err
+	}
+	assistantMgr.SetToolEnv(cfg.ToolEnvs())
+	assistantMgr.SetRouting(cfg.Routing)
+	assistantMgr.SetModels(meta)
+	if len(cfg.Security.ContentFilters) > 0 {
+		content, err := secconcrete.NewContentFilter(cfg.Security.ContentFilters, opts.AuditLog)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create content filter: %w", err)
+		}
+		assistantMgr.SetContentFilter(content)
+	}
+
+	guard, err := newFileGuard(cfg, opts.AuditLog)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file guard: %w", err)
+	}
+	// Documents on disk are confined to the project directory, with the
+	// guard checking what is allowed within it
+	root, err := filepath.Abs(filepath.Dir(cfg.Environment.ConfigDir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve project directory: %w", err)
+	}
 
-	// Create process manager with system clock
-	procMgr := procesos.NewManager(timing.New())
+	// Create process manager
+	procMgr := procesos.NewManager(clock)
+
+	// Remember processed documents and commands across runs when there is
+	// a configuration directory
+	statePath := ""
+	if cfg.Environment.ConfigDir != "" {
+		statePath = filepath.Join(cfg.Environment.ConfigDir, stateFile)
+	}
+	store, err := state.Open(cfg.Environment.ConfigDir)
+	if err != nil {
+		return nil, err
+	}
 
 	return &processorImpl{
 		config:     cfg,
+		models:     meta,
 		assistants: assistantMgr,
-		parser:     parser.New(),
+		tools:      toolMgr,
+		parser:     NewParser(cfg),
 		procMgr:    procMgr,
+		fs:         opts.FS,
+		disk:       guarded.New(osfs.New(root, osfs.Options{Backup: cfg.Documents.Backup}), guard, opts.AuditLog),
+		root:       root,
+		guard:      guard,
+		index:      loadContentIndex(statePath),
+		state:      store,
+		clock:      clock,
+		dryRun:     opts.DryRun,
+		hooks:      hooks,
+		notifier:   opts.Notifier,
+		plugins:    plugins,
+		parsed:     make(map[string]*parser.Incremental),
+		placeheld:  make(map[string]bool),
 	}, nil
 }
 
+// closePlugins stops plugins, returning their errors
+func closePlugins(plugins []*plugin.Plugin) error {
+	var errs []error
+	for _, pl := range plugins {
+		if err := pl.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// NewParser creates the command parser cfg describes, expanding the
+// templates in the templates directory of the configuration. When the
+// templates fail to load, the error is logged and no alias is expanded.
+func NewParser(cfg *config.Config) *parser.Parser {
+	opts := parser.Options{
+		WikiLinks:      cfg.References.WikiLinks,
+		AST:            cfg.Processing.Parser == config.ParserAST,
+		CommandsInCode: cfg.Processing.CommandsInCode,
+	}
+	if cfg.Environment.ConfigDir != "" {
+		templates, err := template.Load(filepath.Join(cfg.Environment.ConfigDir, template.Dir))
+		if err != nil {
+			logger.Warn("failed to load templates", "error", err)
+		} else {
+			opts.Templates = templates
+		}
+	}
+	return parser.NewWithOptions(opts)
+}
+
 // Process processes a single command and returns its response
 func (p *processorImpl) Process(cmd *parser.Command) (string, error) {
-	logger.Debug("processing command",
-		"assistant", cmd.Assistant,
+	return p.ProcessContext(context.Background(), cmd)
+}
+
+// ProcessContext processes a single command within ctx
+func (p *processorImpl) ProcessContext(ctx context.Context, cmd *parser.Command) (string, error) {
+	ctx, span := tracing.Start(ctx, "command.process",
+		tracing.WithAttributes(tracing.String("assistant.name", cmd.Assistant)))
+	defer span.End()
+
+	cmdLogger := logging.FromContext(ctx, logger).With(
+		"command_id", logging.NewID(),
+		"assistant", cmd.Assistant)
+	ctx = logging.ContextWithLogger(ctx, cmdLogger)
+
+	cmdLogger.Debug("processing command",
 		"text", cmd.Text,
 		"original", cmd.Original)
 
-	// Get assistant
-	assistant, err := p.assistants.Get(cmd.Assistant)
+	a, response, err := p.ask(ctx, cmd)
 	if err != nil {
-		return "", fmt.Errorf("failed to get assistant: %w", err)
+		span.RecordError(err)
+		return "", err
 	}
+	response, err = p.postProcess(ctx, cmd, a, response)
+	if err != nil {
+		span.RecordError(err)
+		return "", err
+	}
+	return response, nil
+}
 
-	// Process command
-	response, err := assistant.Process(cmd)
+// Tools returns the tools that loaded successfully. Tools that fail to
+// compile or report unhealthy are logged and left out.
+func (p *processorImpl) Tools(ctx context.Context) ([]processor.ToolInfo, error) {
+	names, err := p.tools.List()
 	if err != nil {
-		return "", fmt.Errorf("failed to process command: %w", err)
+		return nil, err
 	}
 
-	return response, nil
+	tools := make([]processor.ToolInfo, 0, len(names))
+	for _, name := range names {
+		t, err := p.tools.LoadTool(name)
+		if err != nil {
+			logging.FromContext(ctx, logger).Warn("skipping tool",
+				"tool", name,
+				"error", err)
+			continue
+		}
+		description := t.Schema.Schema.Description
+		if description == "" {
+			description = t.Description
+		}
+		tools = append(tools, processor.ToolInfo{
+			Name:        name,
+			Description: description,
+			Parameters:  t.Schema.Schema.Parameters,
+		})
+	}
+	return tools, nil
+}
+
+// Assistants returns the configured assistants. Assistants whose prompt.md
+// cannot be loaded are logged and left out.
+func (p *processorImpl) Assistants(ctx context.Context) ([]processor.AssistantInfo, error) {
+	names, err := p.assistants.List()
+	if err != nil {
+		return nil, err
+	}
+
+	assistants := make([]processor.AssistantInfo, 0, len(names))
+	for _, name := range names {
+		a, err := p.assistants.Get(name)
+		if err != nil {
+			logging.FromContext(ctx, logger).Warn("skipping assistant",
+				"assistant", name,
+				"error", err)
+			continue
+		}
+		assistants = append(assistants, processor.AssistantInfo{
+			Name:        name,
+			Description: a.Description,
+			Model:       a.Model,
+		})
+	}
+	return assistants, nil
+}
+
+// RunTool executes a tool in the sandbox with JSON input
+func (p *processorImpl) RunTool(ctx context.Context, name string, input string) (string, error) {
+	return p.assistants.RunTool(ctx, name, input)
+}
+
+// Ask sends a prompt to an assistant and returns its response
+func (p *processorImpl) Ask(ctx context.Context, assistantName string, prompt string) (string, error) {
+	if assistantName == "" {
+		assistantName = "default"
+	}
+	return p.ProcessContext(ctx, &parser.Command{
+		Assistant: assistantName,
+		Text:      prompt,
+		Original:  "!" + assistantName + " " + prompt,
+		Context:   make(map[string]parser.Block),
+	})
 }
 
 // ProcessFile processes a single file
 func (p *processorImpl) ProcessFile(path string) error {
-	// Read file content
-	content, err := os.ReadFile(path)
-	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
+	return p.ProcessFileContext(context.Background(), path)
+}
+
+// ProcessFileContext processes a single file within ctx
+func (p *processorImpl) ProcessFileContext(ctx context.Context, path string) error {
+	// Responses written beside a document are not documents themselves
+	if isResponseFile(path) {
+		logging.FromContext(ctx, logger).Debug("skipping response file", "file", path)
+		return nil
 	}
 
-	// Parse commands
-	commands, err := p.parser.ParseCommands(string(content))
+	// Commands left with placeholders by an interrupted run are commands
+	// again, and written with their recorded responses
+	p.recoverPlaceholders(ctx, path)
+
+	content, commands, err := p.parseDocument(ctx, path)
 	if err != nil {
-		return fmt.Errorf("failed to parse commands: %w", err)
+		return err
+	}
+
+	// Skip documents unchanged since they were last processed
+	document := p.documentKey(path)
+	if p.index.unchanged(document, contentHash(content, commands)) {
+		logging.FromContext(ctx, logger).Debug("skipping unchanged file", "file", path)
+		return nil
+	}
+
+	// Show that the commands are being processed, unless responses are
+	// held for review or only previewed
+	written := content
+	var placeheld []*parser.Command
+	if p.config.Output.Placeholder && p.dryRun == nil && !p.config.Processing.RequireApproval && len(commands) > 0 {
+		if written, err = p.writePlaceholders(path, commands); err != nil {
+			logging.FromContext(ctx, logger).Warn("failed to write placeholders", "file", path, "error", err)
+			written = content
+		} else {
+			placeheld = commands
+			defer p.setPlaceheld(path, false)
+		}
 	}
 
 	// Process all commands first
-	var responses []processor.Response
+	instances := state.Locate(string(content), originals(commands))
+	responses, err := p.answerCommands(ctx, path, document, content, commands, instances)
+	if err != nil {
+		p.clearPlaceholders(ctx, path, placeheld)
+		return err
+	}
 
-	for _, cmd := range commands {
-		response, err := p.Process(cmd)
-		if err != nil {
-			return err
+	// Detect edits made while the commands were processed; UpdateFile
+	// merges the responses into the edited content
+	if current, err := p.readFile(path); err == nil && !bytes.Equal(current, written) {
+		logging.FromContext(ctx, logger).Info("file changed during processing, merging responses", "file", path)
+	}
+
+	// Hold the responses for review instead of writing them
+	if p.config.Processing.RequireApproval {
+		p.markPending(ctx, document, instances)
+		if len(responses) > 0 {
+			logging.FromContext(ctx, logger).Info("responses held for review",
+				"file", path,
+				"count", len(responses))
 		}
-		if response != "" {
-			responses = append(responses, processor.Response{
-				Command:  cmd,
-				Response: response,
-			})
+		if err := p.index.record(document, contentHash(content, commands)); err != nil {
+			logging.FromContext(ctx, logger).Warn("failed to record processed file",
+				"file", path,
+				"error", err)
 		}
+		p.notifyProcessed(path, len(responses), true)
+		return nil
 	}
 
 	// Update file with all responses
-	if err := p.UpdateFile(path, responses); err != nil {
+	_, updateSpan := tracing.Start(ctx, "file.update",
+		tracing.WithAttributes(
+			tracing.String("file.path", path),
+			tracing.Int("response.count", len(responses))))
+	err = p.updateFile(path, responses, placeheld)
+	updateSpan.RecordError(err)
+	updateSpan.End()
+	if err != nil {
+		p.clearPlaceholders(ctx, path, placeheld)
+	}
+	if errors.Is(err, processor.ErrConflict) {
+		// The responses stay recorded as answered, so the retry writes them
+		// without asking again
+		logging.FromContext(ctx, logger).Warn("responses could not be merged, file left unchanged",
+			"file", path,
+			"error", err)
+	}
+	if err != nil {
 		return fmt.Errorf("failed to update file: %w", err)
 	}
+	if p.dryRun != nil {
+		return nil
+	}
+
+	// The responses are in the document now
+	p.markProcessed(ctx, document, instances)
+
+	// Record the content as processed, including the responses just added
+	if err := p.recordProcessed(path, document); err != nil {
+		logging.FromContext(ctx, logger).Warn("failed to record processed file",
+			"file", path,
+			"error", err)
+	}
 
+	p.notifyProcessed(path, len(responses), false)
 	return nil
 }
 
+// notifyProcessed sends a file_processed event for the document at path.
+// pending tells whether its responses were held for review.
+func (p *processorImpl) notifyProcessed(path string, responses int, pending bool) {
+	p.notifier.Notify(notify.Event{
+		Type: config.NotifyFileProcessed,
+		Data: map[string]interface{}{
+			"file":      path,
+			"responses": responses,
+			"pending":   pending,
+		},
+	})
+}
+
+// runCommand processes cmd and records its outcome. A response an earlier
+// run received but could not write to the document, or that awaits
+// review, is reused instead of asking the assistant again. The tokens
+// used are also recorded to the usage meter of ctx, if any.
+func (p *processorImpl) runCommand(ctx context.Context, document string, inst state.Instance, cmd *parser.Command) (string, error) {
+	log := logging.FromContext(ctx, logger)
+	if rec, ok := p.state.Lookup(document, inst.Key); ok && (rec.Outcome == state.OutcomeAnswered || rec.Outcome == state.OutcomePending) {
+		log.Debug("reusing recorded response", "command", cmd.Original)
+		if rec.Outcome == state.OutcomePending {
+			// Pending responses are written through Approve only
+			return "", nil
+		}
+		return rec.Response, nil
+	}
+
+	model := cmd.Model
+	if a, getErr := p.assistants.Get(cmd.Assistant); getErr == nil {
+		model = a.ModelFor(cmd)
+	}
+
+	meter := &provider.UsageMeter{}
+	start := p.clock.Now()
+	response, err := p.ProcessContext(provider.ContextWithUsageMeter(ctx, meter), cmd)
+	end := p.clock.Now()
+	provider.RecordUsage(ctx, meter.Usage())
+	if err == nil && response != "" && p.config.Output.IncludeMetadata {
+		response = annotateResponse(response, p.config.Output.MetadataFormat, responseMetadata{
+			Assistant: cmd.Assistant,
+			Model:     model,
+			At:        end,
+			Tokens:    meter.Usage(),
+			Duration:  end.Sub(start),
+		})
+	}
+
+	rec := state.Record{
+		Key:         inst.Key,
+		Line:        inst.Line,
+		Command:     cmd.Original,
+		Assistant:   cmd.Assistant,
+		Model:       model,
+		ProcessedAt: end,
+		Tokens:      meter.Usage(),
+		Outcome:     state.OutcomeAnswered,
+		Response:    response,
+	}
+	if err != nil {
+		rec.Outcome, rec.Error, rec.Response = state.OutcomeFailed, err.Error(), ""
+		p.notifier.Notify(notify.Event{
+			Type: config.NotifyCommandFailed,
+			Data: map[string]interface{}{
+				"document":  document,
+				"command":   cmd.Original,
+				"assistant": cmd.Assistant,
+				"error":     err.Error(),
+			},
+		})
+	}
+	if putErr := p.state.Put(document, rec); putErr != nil {
+		log.Warn("failed to record command state", "command", cmd.Original, "error", putErr)
+	}
+	return response, err
+}
+
+// ProcessInstance implements processor.InstanceProcessor
+func (p *processorImpl) ProcessInstance(ctx context.Context, path string, inst state.Instance, cmd *parser.Command) (string, error) {
+	return p.runCommand(ctx, p.documentKey(path), inst, cmd)
+}
+
+// MarkWritten implements processor.InstanceProcessor
+func (p *processorImpl) MarkWritten(ctx context.Context, path string, instances []state.Instance) {
+	p.markProcessed(ctx, p.documentKey(path), instances)
+}
+
+// markProcessed records the answered commands of document as processed
+func (p *processorImpl) markProcessed(ctx context.Context, document string, instances []state.Instance) {
+	p.markAnswered(ctx, document, instances, state.OutcomeProcessed)
+}
+
+// markPending records the answered commands of document as held for review
+func (p *processorImpl) markPending(ctx context.Context, document string, instances []state.Instance) {
+	p.markAnswered(ctx, document, instances, state.OutcomePending)
+}
+
+// markAnswered moves the answered commands of document to outcome. Only
+// pending records keep their response.
+func (p *processorImpl) markAnswered(ctx context.Context, document string, instances []state.Instance, outcome state.Outcome) {
+	for _, inst := range instances {
+		rec, ok := p.state.Lookup(document, inst.Key)
+		if !ok || rec.Outcome != state.OutcomeAnswered {
+			continue
+		}
+		rec.Line, rec.Outcome = inst.Line, outcome
+		if outcome != state.OutcomePending {
+			rec.Response = ""
+		}
+		if err := p.state.Put(document, rec); err != nil {
+			logging.FromContext(ctx, logger).Warn("failed to record command state",
+				"command", rec.Command,
+				"error", err)
+		}
+	}
+}
+
+// originals returns the original text of commands
+func originals(commands []*parser.Command) []string {
+	lines := make([]string, len(commands))
+	for i, cmd := range commands {
+		lines[i] = cmd.Original
+	}
+	return lines
+}
+
+// recordProcessed stores the hash of the current content of the document
+// at path in the content index
+func (p *processorImpl) recordProcessed(path, document string) error {
+	content, err := p.readFile(path)
+	if err != nil {
+		return err
+	}
+	commands, err := p.parseCommands(path, string(content))
+	if err != nil {
+		return err
+	}
+	return p.index.record(document, contentHash(content, commands))
+}
+
+// documentKey identifies the document at path in the content index
+func (p *processorImpl) documentKey(path string) string {
+	if p.fs != nil {
+		return fsPath(path)
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
 // ProcessDirectory processes all markdown files in a directory
 func (p *processorImpl) ProcessDirectory(dir string) error {
+	if p.fs != nil {
+		return iofs.WalkDir(p.fs, fsPath(dir), func(path string, d iofs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || filepath.Ext(path) != ".md" {
+				return nil
+			}
+			return p.ProcessFile(path)
+		})
+	}
 	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -197,82 +768,153 @@ func (p *processorImpl) HandleResponse(cmd *parser.Command, response string) err
 	return nil
 }
 
-// UpdateFile updates a file with command responses
+// maxMergeAttempts bounds how often UpdateFile merges responses into a
+// document that keeps changing while it is being updated
+const maxMergeAttempts = 3
+
+// UpdateFile updates a file with command responses. The responses are
+// merged into the current content, and the result is only written if the
+// file did not change in the meantime; otherwise the merge is repeated, so
+// edits made while commands were processed are kept.
 func (p *processorImpl) UpdateFile(path string, responses []processor.Response) error {
-	// Read current content
-	content, err := os.ReadFile(path)
-	if err != nil {
-		return err
-	}
+	return p.updateFile(path, responses, nil)
+}
 
-	// Split content into lines
-	lines := strings.Split(string(content), "\n")
-	var newLines []string
-	commandsFound := make(map[string]bool)
-
-	for i, line := range lines {
-		trimmed := strings.TrimSpace(line)
-
-		// Check if this line is a command that was processed
-		var isCommand bool
-		var response string
-		for _, r := range responses {
-			if trimmed == r.Command.Original {
-				commandsFound[r.Command.Original] = true
-				isCommand = true
-				response = r.Response
-				// Invalidate the command since it was processed
-				line = strings.Replace(line, "!", "-!", 1)
-				break
-			}
+// updateFile is UpdateFile for a document whose placeheld commands have
+// placeholders, which the responses replace
+func (p *processorImpl) updateFile(path string, responses []processor.Response, placeheld []*parser.Command) error {
+	for attempt := 0; attempt < maxMergeAttempts; attempt++ {
+		// Read current content
+		content, err := p.readFile(path)
+		if err != nil {
+			return err
 		}
 
-		if isCommand {
-			// Add the invalidated command
-			newLines = append(newLines, line)
-
-			// Add blank line before response if needed
-			if len(newLines) > 0 && strings.TrimSpace(newLines[len(newLines)-1]) != "" {
-				newLines = append(newLines, "")
-			}
+		merged := string(content)
+		if len(placeheld) > 0 {
+			merged = removePlaceholders(merged, placeheld)
+		}
+		newContent, err := mergeResponses(merged, responses, filepath.Base(responseFile(path)), p.parser.CommandLines(merged))
+		if err != nil {
+			return err
+		}
 
-			// Add response
-			newLines = append(newLines, response)
+		// Only write back if content changed
+		if string(content) == newContent {
+			return nil
+		}
 
-			// Add blank line after response if next line is not blank and not a command
-			if i+1 < len(lines) {
-				nextLine := strings.TrimSpace(lines[i+1])
-				if nextLine != "" && !strings.HasPrefix(nextLine, "!") {
-					newLines = append(newLines, "")
-				}
-			}
-		} else {
-			newLines = append(newLines, line)
+		// Check for edits made while merging
+		current, err := p.readFile(path)
+		if err != nil {
+			return err
 		}
+		if !bytes.Equal(current, content) {
+			logger.Info("file changed while updating, merging again", "file", path)
+			continue
+		}
+		if err := p.writeFile(path, []byte(newContent)); err != nil {
+			return err
+		}
+		return p.writeResponseFile(path, responses)
 	}
+	return fmt.Errorf("%w: %s kept changing while it was updated", processor.ErrConflict, path)
+}
 
-	// Verify all commands were found
-	for _, r := range responses {
-		if !commandsFound[r.Command.Original] {
-			return fmt.Errorf("command not found in file: %s", r.Command.Original)
+// ReadFile implements processor.DocumentStore
+func (p *processorImpl) ReadFile(path string) ([]byte, error) {
+	return p.readFile(path)
+}
+
+// Commands implements processor.CommandScanner
+func (p *processorImpl) Commands(path string) ([]*parser.Command, error) {
+	content, err := p.readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return p.parser.ParseCommands(string(content))
+}
+
+// WriteFile implements processor.DocumentStore
+func (p *processorImpl) WriteFile(path string, data []byte) error {
+	return p.writeFile(path, data)
+}
+
+// readFile reads a document from the processor's file system
+func (p *processorImpl) readFile(path string) ([]byte, error) {
+	if p.fs != nil {
+		return iofs.ReadFile(p.fs, fsPath(path))
+	}
+	name, err := p.diskPath("read", path)
+	if err != nil {
+		return nil, err
+	}
+	return p.disk.ReadFile(name)
+}
+
+// writeFile writes a document to the processor's file system, or hands
+// the change to the dry run callback, once the write hooks passed it
+func (p *processorImpl) writeFile(path string, data []byte) error {
+	data, err := p.beforeWrite(path, data)
+	if err != nil {
+		return err
+	}
+	if p.dryRun != nil {
+		before, err := p.readFile(path)
+		if err != nil && !errors.Is(err, iofs.ErrNotExist) {
+			return err
 		}
+		p.dryRun(path, string(before), string(data))
+		return nil
+	}
+	if p.fs != nil {
+		return p.fs.WriteFile(fsPath(path), data, 0644)
 	}
+	name, err := p.diskPath("write", path)
+	if err != nil {
+		return err
+	}
+	return p.disk.WriteFile(name, data, 0644)
+}
 
-	// Ensure single blank line at end
-	for len(newLines) > 0 && strings.TrimSpace(newLines[len(newLines)-1]) == "" {
-		newLines = newLines[:len(newLines)-1]
+// diskPath returns the path of a document on disk relative to the project
+// directory, refusing documents outside it
+func (p *processorImpl) diskPath(op, path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
 	}
-	newLines = append(newLines, "")
+	rel, err := filepath.Rel(p.root, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", &iofs.PathError{Op: op, Path: path, Err: fmt.Errorf("%w: outside the project directory %s", secconcrete.ErrAccessDenied, p.root)}
+	}
+	return fsPath(rel), nil
+}
 
-	// Only write back if content changed
-	newContent := strings.Join(newLines, "\n")
-	if string(content) != newContent {
-		return os.WriteFile(path, []byte(newContent), 0644)
+// fsPath converts an OS path to the unrooted, slash-separated form io/fs
+// expects
+func fsPath(path string) string {
+	path = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(path)), "/")
+	if path == "" {
+		return "."
 	}
-	return nil
+	return path
 }
 
 // GetProcessManager returns the process manager for worker pool integration
 func (p *processorImpl) GetProcessManager() process.Manager {
 	return p.procMgr
 }
+
+// Close stops the plugins of the processor. It may be called more than
+// once.
+func (p *processorImpl) Close() error {
+	p.mu.Lock()
+	plugins := p.plugins
+	p.plugins = nil
+	p.mu.Unlock()
+	if err := closePlugins(plugins); err != nil {
+		return fmt.Errorf("failed to stop plugins: %w", err)
+	}
+	return nil
+}
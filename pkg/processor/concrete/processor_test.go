@@ -1,18 +1,29 @@
 package concrete
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/butter-bot-machines/skylark/pkg/config"
 	"github.com/butter-bot-machines/skylark/pkg/parser"
 	"github.com/butter-bot-machines/skylark/pkg/processor"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+	"github.com/butter-bot-machines/skylark/pkg/provider/registry"
+	secconcrete "github.com/butter-bot-machines/skylark/pkg/security/concrete"
+	"github.com/butter-bot-machines/skylark/pkg/security/types"
+	"github.com/butter-bot-machines/skylark/pkg/state"
 )
 
 func TestProcessor(t *testing.T) {
-	// Create test directories
-	configDir := t.TempDir()
+	// Create test directories; documents must be inside the project
+	projectDir := t.TempDir()
+	configDir := filepath.Join(projectDir, ".skai")
 	assistantDir := filepath.Join(configDir, "assistants", "test")
 	if err := os.MkdirAll(assistantDir, 0755); err != nil {
 		t.Fatalf("Failed to create assistant directory: %v", err)
@@ -73,7 +84,7 @@ Test prompt`
 
 	t.Run("process file", func(t *testing.T) {
 		// Create test file
-		testFile := filepath.Join(t.TempDir(), "test.md")
+		testFile := filepath.Join(projectDir, "process.md")
 		content := "# Test\n!test command\n"
 		if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
 			t.Fatalf("Failed to create test file: %v", err)
@@ -99,7 +110,10 @@ Test prompt`
 
 	t.Run("process directory", func(t *testing.T) {
 		// Create test directory
-		testDir := t.TempDir()
+		testDir := filepath.Join(projectDir, "docs")
+		if err := os.Mkdir(testDir, 0755); err != nil {
+			t.Fatalf("Failed to create test directory: %v", err)
+		}
 
 		// Create test files
 		files := []struct {
@@ -172,9 +186,20 @@ Test prompt`
 		}
 	})
 
+	t.Run("file outside project", func(t *testing.T) {
+		testFile := filepath.Join(t.TempDir(), "outside.md")
+		if err := os.WriteFile(testFile, []byte("-!test command\n"), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		if err := proc.ProcessFile(testFile); !errors.Is(err, secconcrete.ErrAccessDenied) {
+			t.Errorf("Expected ErrAccessDenied, got %v", err)
+		}
+	})
+
 	t.Run("update file", func(t *testing.T) {
 		// Create test file
-		testFile := filepath.Join(t.TempDir(), "test.md")
+		testFile := filepath.Join(projectDir, "update.md")
 		content := "# Test\n!test command\nSome text\n!another command\n"
 		if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
 			t.Fatalf("Failed to create test file: %v", err)
@@ -218,6 +243,42 @@ Test prompt`
 		}
 	})
 
+	t.Run("catalog", func(t *testing.T) {
+		catalog, ok := proc.(processor.Catalog)
+		if !ok {
+			t.Fatal("Expected processor to implement processor.Catalog")
+		}
+		ctx := context.Background()
+
+		assistants, err := catalog.Assistants(ctx)
+		if err != nil {
+			t.Fatalf("Failed to list assistants: %v", err)
+		}
+		if len(assistants) != 1 || assistants[0].Name != "test" || assistants[0].Description != "Assistant for testing" {
+			t.Errorf("Unexpected assistants: %+v", assistants)
+		}
+
+		tools, err := catalog.Tools(ctx)
+		if err != nil {
+			t.Fatalf("Failed to list tools: %v", err)
+		}
+		if len(tools) != 1 || tools[0].Name != "currentdatetime" {
+			t.Errorf("Expected the builtin tool, got %+v", tools)
+		}
+
+		response, err := catalog.Ask(ctx, "test", "hello")
+		if err != nil {
+			t.Errorf("Failed to ask assistant: %v", err)
+		}
+		if response != "command" {
+			t.Errorf("Expected response %q, got %q", "command", response)
+		}
+
+		if _, err := catalog.RunTool(ctx, "missing", ""); err == nil {
+			t.Error("Expected error running unknown tool")
+		}
+	})
+
 	t.Run("get process manager", func(t *testing.T) {
 		mgr := proc.GetProcessManager()
 		if mgr == nil {
@@ -226,6 +287,48 @@ Test prompt`
 	})
 }
 
+func TestProcessorFilters(t *testing.T) {
+	configDir := t.TempDir()
+	assistantDir := filepath.Join(configDir, "assistants", "test")
+	if err := os.MkdirAll(assistantDir, 0755); err != nil {
+		t.Fatalf("Failed to create assistant directory: %v", err)
+	}
+	prompt := "---\nname: Test Assistant\nmodel: gpt-4\n---\n\nTest prompt"
+	if err := os.WriteFile(filepath.Join(assistantDir, "prompt.md"), []byte(prompt), 0644); err != nil {
+		t.Fatalf("Failed to create prompt file: %v", err)
+	}
+
+	cfg := &config.Config{
+		Environment: config.EnvironmentConfig{ConfigDir: configDir},
+		Models: map[string]config.ModelConfigSet{
+			"openai": {"gpt-4": config.ModelConfig{APIKey: "test-key"}},
+		},
+		Filters: []config.FilterConfig{{Type: config.FilterMaxLength, Max: 4}},
+		Assistants: map[string]config.AssistantConfig{
+			"test": {Filters: []config.FilterConfig{{Type: config.FilterTool, Tool: "missing"}}},
+		},
+	}
+	proc, err := NewProcessor(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	// The assistant's tool filter runs first and fails
+	if _, err := proc.Process(&parser.Command{Original: "!test command", Assistant: "test", Text: "command"}); err == nil {
+		t.Error("Expected the missing filter tool to fail the command")
+	}
+
+	// Global filters apply to every assistant
+	cfg.Assistants = nil
+	response, err := proc.Process(&parser.Command{Original: "!test command", Assistant: "test", Text: "command"})
+	if err != nil {
+		t.Fatalf("Failed to process command: %v", err)
+	}
+	if response != "com…" {
+		t.Errorf("Expected the truncated response, got %q", response)
+	}
+}
+
 func TestProcessorErrors(t *testing.T) {
 	t.Run("nil config", func(t *testing.T) {
 		_, err := NewProcessor(nil)
@@ -290,3 +393,447 @@ func TestProcessorErrors(t *testing.T) {
 		}
 	})
 }
+
+// stoppingPlugin is a plugin script answering initialize as a processor
+// and writing "stopped" to the file stopped once its stdin is closed
+const stoppingPlugin = `#!/bin/sh
+read request
+echo '{"jsonrpc":"2.0","id":1,"result":{"name":"stopping","processor":true}}'
+cat > /dev/null
+echo stopped > stopped
+`
+
+func TestProcessorClosesPlugins(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	newConfig := func(t *testing.T) *config.Config {
+		configDir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(configDir, "plugin.sh"), []byte(stoppingPlugin), 0755); err != nil {
+			t.Fatal(err)
+		}
+		return &config.Config{
+			Environment: config.EnvironmentConfig{ConfigDir: configDir},
+			Plugins:     []config.PluginConfig{{Name: "stopping", Command: "plugin.sh"}},
+		}
+	}
+	stopped := func(cfg *config.Config) bool {
+		_, err := os.Stat(filepath.Join(cfg.Environment.ConfigDir, "stopped"))
+		return err == nil
+	}
+
+	t.Run("close", func(t *testing.T) {
+		cfg := newConfig(t)
+		proc, err := NewProcessor(cfg)
+		if err != nil {
+			t.Fatalf("Failed to create processor: %v", err)
+		}
+		if stopped(cfg) {
+			t.Fatal("Expected the plugin running")
+		}
+		if err := proc.Close(); err != nil {
+			t.Errorf("Close() error = %v", err)
+		}
+		if !stopped(cfg) {
+			t.Error("Expected Close to stop the plugin")
+		}
+		if err := proc.Close(); err != nil {
+			t.Errorf("Expected a second Close to do nothing, got %v", err)
+		}
+	})
+
+	t.Run("later failure", func(t *testing.T) {
+		cfg := newConfig(t)
+		cfg.Security.ContentFilters = []types.ContentFilterConfig{{Name: "broken", Pattern: "("}}
+		if _, err := NewProcessor(cfg); err == nil {
+			t.Fatal("Expected the content filter to fail")
+		}
+		if !stopped(cfg) {
+			t.Error("Expected the plugin stopped when the processor fails")
+		}
+	})
+}
+
+func TestNewParserTemplates(t *testing.T) {
+	configDir := t.TempDir()
+	writeFiles(t, configDir, map[string]string{
+		"templates/summarize.md": "---\nassistant: writer\n---\nSummarize {selection} briefly.\n",
+	})
+	cfg := &config.Config{Environment: config.EnvironmentConfig{ConfigDir: configDir}}
+
+	cmd, err := NewParser(cfg).ParseCommand("!summarize #Roadmap#")
+	if err != nil {
+		t.Fatalf("ParseCommand() error = %v", err)
+	}
+	if cmd.Assistant != "writer" || cmd.Text != "Summarize #Roadmap# briefly." {
+		t.Errorf("Expected the expanded template, got %s: %q", cmd.Assistant, cmd.Text)
+	}
+	if len(cmd.References) != 1 || cmd.References[0] != "Roadmap" {
+		t.Errorf("Expected reference Roadmap, got %v", cmd.References)
+	}
+
+	// A broken template leaves commands unexpanded
+	writeFiles(t, configDir, map[string]string{"templates/empty.md": ""})
+	cmd, err = NewParser(cfg).ParseCommand("!summarize #Roadmap#")
+	if err != nil {
+		t.Fatalf("ParseCommand() error = %v", err)
+	}
+	if cmd.Assistant != "summarize" {
+		t.Errorf("Expected no expansion, got %s: %q", cmd.Assistant, cmd.Text)
+	}
+}
+
+func TestProcessorCommands(t *testing.T) {
+	projectDir := t.TempDir()
+	configDir := filepath.Join(projectDir, ".skai")
+	writeFiles(t, projectDir, map[string]string{
+		".skai/templates/summarize.md": "---\nassistant: writer\n---\nSummarize {selection} briefly.\n",
+		"notes.md":                     "# Notes\n!summarize #Roadmap#\n!researcher look this up\n",
+	})
+	proc, err := NewProcessor(&config.Config{Environment: config.EnvironmentConfig{ConfigDir: configDir}})
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+	defer proc.Close()
+
+	// Commands are parsed as processing parses them, templates expanded
+	commands, err := proc.(processor.CommandScanner).Commands(filepath.Join(projectDir, "notes.md"))
+	if err != nil {
+		t.Fatalf("Commands() error = %v", err)
+	}
+	if len(commands) != 2 || commands[0].Assistant != "writer" || commands[1].Assistant != "researcher" {
+		t.Errorf("Expected the writer and researcher commands, got %v", commands)
+	}
+	if _, err := proc.(processor.CommandScanner).Commands(filepath.Join(projectDir, "missing.md")); err == nil {
+		t.Error("Expected error for a missing document")
+	}
+}
+
+func TestProcessorConfinedToProject(t *testing.T) {
+	projectDir, outside := t.TempDir(), t.TempDir()
+	writeFiles(t, outside, map[string]string{"notes.md": "!default hi\n"})
+	cfg := &config.Config{Environment: config.EnvironmentConfig{ConfigDir: filepath.Join(projectDir, ".skai")}}
+	// Even a guard allowing the directory does not open the disk beyond
+	// the project
+	cfg.Security.FilePermissions.AllowedPaths = []string{projectDir, outside}
+	proc, err := NewProcessor(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+	defer proc.Close()
+
+	store := proc.(processor.DocumentStore)
+	if _, err := store.ReadFile(filepath.Join(outside, "notes.md")); !errors.Is(err, secconcrete.ErrAccessDenied) {
+		t.Errorf("Expected reads outside the project denied, got %v", err)
+	}
+	if err := store.WriteFile(filepath.Join(projectDir, "..", filepath.Base(outside), "notes.md"), []byte("x")); !errors.Is(err, secconcrete.ErrAccessDenied) {
+		t.Errorf("Expected writes outside the project denied, got %v", err)
+	}
+	if err := store.WriteFile(filepath.Join(projectDir, "notes.md"), []byte("x")); err != nil {
+		t.Errorf("Expected writes in the project allowed, got %v", err)
+	}
+}
+
+func TestNewParserAST(t *testing.T) {
+	content := "Title\n=====\n\nText"
+	if blocks := NewParser(&config.Config{}).ParseBlocks(content); len(blocks) > 0 && blocks[0].Type == parser.Header {
+		t.Errorf("Expected setext headers to be paragraphs line by line, got %v", blocks)
+	}
+
+	cfg := &config.Config{Processing: config.ProcessingConfig{Parser: config.ParserAST}}
+	blocks := NewParser(cfg).ParseBlocks(content)
+	if len(blocks) != 2 || blocks[0].Type != parser.Header || blocks[0].Content != "Title" {
+		t.Errorf("Expected a setext header with the ast parser, got %v", blocks)
+	}
+}
+
+// countingProvider counts requests and responds with its response
+type countingProvider struct {
+	mockProvider
+	calls  *int
+	onSend func() // Runs during each request
+}
+
+func (p *countingProvider) Send(ctx context.Context, messages []provider.Message, opts *provider.RequestOptions) (*provider.Response, error) {
+	*p.calls++
+	if p.onSend != nil {
+		p.onSend()
+	}
+	return &provider.Response{Content: p.response, Usage: provider.Usage{TotalTokens: 7}}, nil
+}
+
+// newCountingProcessor creates a processor for a project with a test
+// assistant, whose provider responds with response and counts requests
+func newCountingProcessor(t *testing.T, projectDir, response string, calls *int) processor.ProcessManager {
+	return newHookedProcessor(t, projectDir, response, calls, nil)
+}
+
+// newHookedProcessor is newCountingProcessor with onSend run during each
+// request
+func newHookedProcessor(t *testing.T, projectDir, response string, calls *int, onSend func()) processor.ProcessManager {
+	t.Helper()
+	return newConfiguredProcessor(t, projectDir, &config.Config{}, Options{}, response, calls, onSend)
+}
+
+// newConfiguredProcessor is newHookedProcessor with the settings of cfg
+// and opts
+func newConfiguredProcessor(t *testing.T, projectDir string, cfg *config.Config, opts Options, response string, calls *int, onSend func()) processor.ProcessManager {
+	t.Helper()
+	configDir := filepath.Join(projectDir, ".skai")
+	assistantDir := filepath.Join(configDir, "assistants", "test")
+	if err := os.MkdirAll(assistantDir, 0755); err != nil {
+		t.Fatalf("Failed to create assistant directory: %v", err)
+	}
+	prompt := "---\nname: Test Assistant\nmodel: gpt-4\n---\n\nTest prompt"
+	if err := os.WriteFile(filepath.Join(assistantDir, "prompt.md"), []byte(prompt), 0644); err != nil {
+		t.Fatalf("Failed to create prompt file: %v", err)
+	}
+
+	reg := registry.New()
+	reg.Register("openai", func(model string) (provider.Provider, error) {
+		return &countingProvider{mockProvider: mockProvider{response: response}, calls: calls, onSend: onSend}, nil
+	})
+	cfg.Environment.ConfigDir = configDir
+	opts.Providers = reg
+	proc, err := NewProcessorWithOptions(cfg, opts)
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+	return proc
+}
+
+func TestProcessorSkipsUnchangedFiles(t *testing.T) {
+	projectDir := t.TempDir()
+	configDir := filepath.Join(projectDir, ".skai")
+	calls := 0
+
+	// An empty response leaves the command in place
+	testFile := filepath.Join(projectDir, "notes.md")
+	if err := os.WriteFile(testFile, []byte("# Notes\n!test command\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	proc := newCountingProcessor(t, projectDir, "", &calls)
+	if err := proc.ProcessFile(testFile); err != nil {
+		t.Fatalf("Failed to process file: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("Expected 1 request, got %d", calls)
+	}
+
+	// Saving the same content again is skipped, also by a later run
+	if err := proc.ProcessFile(testFile); err != nil {
+		t.Fatalf("Failed to process file: %v", err)
+	}
+	if err := newCountingProcessor(t, projectDir, "", &calls).ProcessFile(testFile); err != nil {
+		t.Fatalf("Failed to process file: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected unchanged files to be skipped, got %d requests", calls)
+	}
+	if _, err := os.Stat(filepath.Join(configDir, stateFile)); err != nil {
+		t.Errorf("Expected the content index to be persisted: %v", err)
+	}
+
+	// Changed content is processed
+	if err := os.WriteFile(testFile, []byte("# Notes\n\n!test command\n"), 0644); err != nil {
+		t.Fatalf("Failed to update test file: %v", err)
+	}
+	if err := proc.ProcessFile(testFile); err != nil {
+		t.Fatalf("Failed to process file: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Expected changed files to be processed, got %d requests", calls)
+	}
+}
+
+func TestProcessorCommandState(t *testing.T) {
+	projectDir := t.TempDir()
+	configDir := filepath.Join(projectDir, ".skai")
+	calls := 0
+	proc := newCountingProcessor(t, projectDir, "fresh", &calls)
+
+	testFile := filepath.Join(projectDir, "notes.md")
+	if err := os.WriteFile(testFile, []byte("# Notes\n!test first\n!test second\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// A response received by an earlier run is written without asking again
+	store, err := state.Open(configDir)
+	if err != nil {
+		t.Fatalf("Failed to open state: %v", err)
+	}
+	err = store.Put(testFile, state.Record{
+		Key:      state.Key("!test second", 0),
+		Command:  "!test second",
+		Outcome:  state.OutcomeAnswered,
+		Response: "recorded",
+	})
+	if err != nil {
+		t.Fatalf("Failed to record state: %v", err)
+	}
+	proc = newCountingProcessor(t, projectDir, "fresh", &calls)
+	if err := proc.ProcessFile(testFile); err != nil {
+		t.Fatalf("Failed to process file: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected only the first command to be sent, got %d requests", calls)
+	}
+	updated, _ := os.ReadFile(testFile)
+	if !strings.Contains(string(updated), "fresh") || !strings.Contains(string(updated), "recorded") {
+		t.Errorf("Expected both responses in the file, got:\n%s", updated)
+	}
+
+	store, err = state.Open(configDir)
+	if err != nil {
+		t.Fatalf("Failed to open state: %v", err)
+	}
+	records := store.Records(testFile)
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %+v", records)
+	}
+	first := records[0]
+	if first.Command != "!test first" || first.Line != 2 || first.Model != "gpt-4" || first.Tokens.TotalTokens != 7 {
+		t.Errorf("Unexpected record %+v", first)
+	}
+	for _, r := range records {
+		if r.Outcome != state.OutcomeProcessed || r.Response != "" {
+			t.Errorf("Expected %s to be processed without a kept response, got %+v", r.Command, r)
+		}
+	}
+}
+
+func TestProcessInstance(t *testing.T) {
+	projectDir := t.TempDir()
+	testFile := filepath.Join(projectDir, "notes.md")
+	calls := 0
+	proc := newCountingProcessor(t, projectDir, "fresh", &calls)
+	store, err := state.Open(filepath.Join(projectDir, ".skai"))
+	if err != nil {
+		t.Fatalf("Failed to open state: %v", err)
+	}
+	inst := state.Instance{Key: state.Key("!test draft", 0), Line: 1}
+	if err := store.Put(testFile, state.Record{Key: inst.Key, Command: "!test draft", Outcome: state.OutcomeAnswered, Response: "recorded"}); err != nil {
+		t.Fatalf("Failed to record state: %v", err)
+	}
+
+	proc = newCountingProcessor(t, projectDir, "fresh", &calls)
+	p, ok := proc.(processor.InstanceProcessor)
+	if !ok {
+		t.Fatal("Expected the processor to process command instances")
+	}
+	cmd, _ := parser.New().ParseCommand("!test draft")
+	meter := &provider.UsageMeter{}
+	ctx := provider.ContextWithUsageMeter(context.Background(), meter)
+
+	// The recorded response is reused until it is written
+	if response, err := p.ProcessInstance(ctx, testFile, inst, cmd); err != nil || response != "recorded" || calls != 0 {
+		t.Errorf("Expected the recorded response without a request, got %q (%d requests): %v", response, calls, err)
+	}
+	p.MarkWritten(ctx, testFile, []state.Instance{inst})
+	if response, err := p.ProcessInstance(ctx, testFile, inst, cmd); err != nil || response != "fresh" || calls != 1 {
+		t.Errorf("Expected a fresh response, got %q (%d requests): %v", response, calls, err)
+	}
+	if usage := meter.Usage(); usage.TotalTokens != 7 {
+		t.Errorf("Expected the caller's meter to record 7 tokens, got %d", usage.TotalTokens)
+	}
+}
+
+func TestProcessorConcurrentEdits(t *testing.T) {
+	tests := []struct {
+		name     string
+		edit     string // Content written while the command is processed
+		wantErr  bool
+		contains []string
+	}{
+		{
+			name:     "edit elsewhere is kept",
+			edit:     "# Notes\n\nA paragraph typed meanwhile.\n!test command\n",
+			contains: []string{"A paragraph typed meanwhile.", "-!test command", "response"},
+		},
+		{
+			name:     "edited command conflicts",
+			edit:     "# Notes\n!test changed command\n",
+			wantErr:  true,
+			contains: []string{"!test changed command"},
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			projectDir := t.TempDir()
+			testFile := filepath.Join(projectDir, fmt.Sprintf("notes%d.md", i))
+			if err := os.WriteFile(testFile, []byte("# Notes\n!test command\n"), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+
+			calls := 0
+			proc := newHookedProcessor(t, projectDir, "response", &calls, func() {
+				if err := os.WriteFile(testFile, []byte(tt.edit), 0644); err != nil {
+					t.Errorf("Failed to edit test file: %v", err)
+				}
+			})
+			err := proc.ProcessFile(testFile)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr && !errors.Is(err, processor.ErrConflict) {
+				t.Errorf("Expected ErrConflict, got %v", err)
+			}
+
+			updated, _ := os.ReadFile(testFile)
+			for _, want := range tt.contains {
+				if !strings.Contains(string(updated), want) {
+					t.Errorf("Expected %q in:\n%s", want, updated)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessorDryRun(t *testing.T) {
+	projectDir := t.TempDir()
+	calls := 0
+	type change struct{ path, before, after string }
+	var changes []change
+	proc := newConfiguredProcessor(t, projectDir, &config.Config{}, Options{
+		DryRun: func(path, before, after string) {
+			changes = append(changes, change{path, before, after})
+		},
+	}, "An answer", &calls, nil)
+
+	testFile := filepath.Join(projectDir, "notes.md")
+	original := "# Notes\n!test first\n!test second output:file\n"
+	if err := os.WriteFile(testFile, []byte(original), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := proc.ProcessFile(testFile); err != nil {
+		t.Fatalf("Failed to process file: %v", err)
+	}
+
+	// The changes are reported, not written
+	if len(changes) != 2 {
+		t.Fatalf("Expected 2 changes, got %d", len(changes))
+	}
+	if changes[0].path != testFile || changes[0].before != original {
+		t.Errorf("Expected the document's change first, got %+v", changes[0])
+	}
+	if changes[1].path != filepath.Join(projectDir, "notes.skylark.md") || changes[1].before != "" {
+		t.Errorf("Expected the new response file second, got %+v", changes[1])
+	}
+	if content, _ := os.ReadFile(testFile); string(content) != original {
+		t.Errorf("Expected the document unchanged, got:\n%s", content)
+	}
+	if _, err := os.Stat(filepath.Join(projectDir, "notes.skylark.md")); !os.IsNotExist(err) {
+		t.Errorf("Expected no response file, got %v", err)
+	}
+
+	// A real run writes the same responses without asking again
+	if err := newCountingProcessor(t, projectDir, "Another answer", &calls).ProcessFile(testFile); err != nil {
+		t.Fatalf("Failed to process file: %v", err)
+	}
+	if content, _ := os.ReadFile(testFile); string(content) != changes[0].after {
+		t.Errorf("Expected the previewed content\nExpected:\n%s\nGot:\n%s", changes[0].after, content)
+	}
+	if calls != 2 {
+		t.Errorf("Expected 2 requests, got %d", calls)
+	}
+}
@@ -0,0 +1,364 @@
+package concrete
+
+import (
+	"context"
+	"fmt"
+	iofs "io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	doccontext "github.com/butter-bot-machines/skylark/pkg/context"
+	"github.com/butter-bot-machines/skylark/pkg/fs/osfs"
+	"github.com/butter-bot-machines/skylark/pkg/index"
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/provider/registry"
+	"github.com/butter-bot-machines/skylark/pkg/security"
+	secconcrete "github.com/butter-bot-machines/skylark/pkg/security/concrete"
+)
+
+const (
+	// maxReferenceFiles bounds how many files one globbed reference reads
+	maxReferenceFiles = 20
+
+	// defaultMaxFileSize applies when security.file_permissions sets no
+	// max_file_size
+	defaultMaxFileSize = 1024 * 1024
+)
+
+// newFileGuard creates the guard for documents and the files they
+// reference. Without configured allowed paths, the project directory
+// containing the config directory is allowed.
+func newFileGuard(cfg *config.Config, auditLog security.AuditLogger) (security.FileGuard, error) {
+	guarded := *cfg
+	perms := cfg.Security.FilePermissions
+	if len(perms.AllowedPaths) == 0 {
+		perms.AllowedPaths = []string{filepath.Dir(cfg.Environment.ConfigDir)}
+	}
+	if perms.MaxFileSize == 0 {
+		perms.MaxFileSize = defaultMaxFileSize
+	}
+	guarded.Security.FilePermissions = perms
+	return secconcrete.NewFileGuard(&guarded, auditLog)
+}
+
+// AttachReferences fills cmd.Context with the sections the command
+// references, their parent and sibling sections in the same document, and
+// sections of other files named by cross-file references. Everything is
+// trimmed by priority to fit the assistant model's context window.
+// Sections that cannot be found, read or fitted are logged and left out.
+// The images the command shows and the schema it asks for are loaded as
+// well.
+func (p *processorImpl) AttachReferences(ctx context.Context, cmd *parser.Command, path string, content string) {
+	p.attachImages(ctx, cmd, path)
+	p.attachSchema(ctx, cmd, path)
+	if len(cmd.References) == 0 && len(cmd.Links) == 0 {
+		return
+	}
+	log := logging.FromContext(ctx, logger)
+
+	var local []string
+	var external []doccontext.Block
+	for _, ref := range cmd.References {
+		pattern, heading, ok := parser.SplitReference(ref)
+		if !ok {
+			local = append(local, ref)
+			continue
+		}
+		if block, ok := p.externalSection(ctx, path, pattern, heading); ok {
+			block.Header = ref
+			external = append(external, block)
+		} else {
+			log.Warn("referenced section not found", "reference", ref)
+		}
+	}
+
+	blocks := doccontext.CollectBlocks(content, local)
+	found := make(map[string]bool)
+	for _, block := range blocks {
+		if block.Priority == doccontext.PriorityReferenced {
+			found[doccontext.FoldHeader(block.Header)] = true
+		}
+	}
+	for _, ref := range local {
+		if !found[doccontext.FoldHeader(ref)] {
+			log.Warn("referenced section not found", "reference", ref)
+		}
+	}
+	blocks = append(blocks, external...)
+	blocks = append(blocks, p.linkedBlocks(ctx, cmd.Links)...)
+
+	model := cmd.Model
+	if a, err := p.assistants.Get(cmd.Assistant); err == nil {
+		model = a.ModelFor(cmd)
+	}
+	budget := doccontext.NewBudgeter(model, p.contextLimit(model)).Fit(blocks)
+	for _, warning := range budget.Warnings {
+		log.Warn("context trimmed", "model", model, "detail", warning)
+	}
+
+	// Referenced sections are keyed as the command names them, others by
+	// their header as written in the file
+	refs := make(map[string]string, len(cmd.References))
+	for _, ref := range cmd.References {
+		refs[doccontext.FoldHeader(ref)] = ref
+	}
+	for _, block := range budget.Blocks {
+		key := block.Header
+		if ref, ok := refs[doccontext.FoldHeader(block.Header)]; ok && block.Priority == doccontext.PriorityReferenced {
+			key = ref
+		}
+		cmd.Context[key] = sectionBlock(block.Content)
+	}
+}
+
+// contextLimit returns the tokens of context a command to model may
+// reference when its configuration or model_metadata sets a context
+// window, and 0 to use the built-in window otherwise
+func (p *processorImpl) contextLimit(model string) int {
+	name, spec := registry.ParseModelSpec(model)
+	if name == "" {
+		name = "openai"
+	}
+	mc, _ := p.config.GetModelConfig(name, spec)
+	window := mc.ContextWindow
+	if window <= 0 {
+		meta, _ := p.models.Lookup(spec)
+		window = meta.ContextWindow
+	}
+	if window <= 0 {
+		return 0
+	}
+	return max(window-doccontext.DefaultResponseReserve, 1)
+}
+
+// sectionBlock wraps the content of a section, with the rows and columns
+// of the first table it holds, so a table can be referenced by the header
+// above it
+func sectionBlock(content string) parser.Block {
+	if table, ok := parser.ParseTable(content); ok {
+		return parser.Block{Type: parser.Table, Content: content, Table: table}
+	}
+	return parser.Block{Type: parser.Paragraph, Content: content}
+}
+
+// linkedBlocks reads the notes that links name, resolved through an index
+// of the project's Markdown files. Embedded notes are treated as
+// referenced sections, plain links as lower priority context.
+func (p *processorImpl) linkedBlocks(ctx context.Context, links []parser.Link) []doccontext.Block {
+	if len(links) == 0 {
+		return nil
+	}
+	log := logging.FromContext(ctx, logger)
+
+	projectDir := filepath.Dir(p.config.Environment.ConfigDir)
+	var root iofs.FS = p.fs
+	if root == nil {
+		root = osfs.New(projectDir, osfs.Options{})
+	}
+	idx, err := index.Build(root)
+	if err != nil {
+		log.Warn("failed to index notes", "error", err)
+		return nil
+	}
+
+	var blocks []doccontext.Block
+	for _, link := range links {
+		note, ok := idx.Resolve(link.Target)
+		if !ok {
+			log.Warn("linked note not found", "link", link.Key())
+			continue
+		}
+
+		file := note
+		if p.fs == nil {
+			file = filepath.Join(projectDir, filepath.FromSlash(note))
+			if err := p.guard.CheckRead(file); err != nil {
+				log.Warn("linked note denied", "file", file, "error", err)
+				continue
+			}
+		}
+		data, err := p.readFile(file)
+		if err != nil {
+			log.Warn("failed to read linked note", "file", file, "error", err)
+			continue
+		}
+
+		content, ok := linkedContent(string(data), link.Heading)
+		if !ok {
+			log.Warn("linked section not found", "link", link.Key())
+			continue
+		}
+		priority := doccontext.PriorityLinked
+		if link.Embed {
+			priority = doccontext.PriorityReferenced
+		}
+		blocks = append(blocks, doccontext.Block{Header: link.Key(), Content: content, Priority: priority})
+	}
+	return blocks
+}
+
+// linkedContent returns the part of a note a link points at: the whole
+// note without its front matter, a section for #Heading, or the block
+// marked with ^id for #^id
+func linkedContent(note string, heading string) (string, bool) {
+	switch {
+	case heading == "":
+		content := strings.TrimSpace(stripFrontMatter(note))
+		return content, content != ""
+	case strings.HasPrefix(heading, "^"):
+		return blockByID(note, heading)
+	}
+	for _, block := range doccontext.CollectBlocks(note, []string{heading}) {
+		if block.Priority == doccontext.PriorityReferenced {
+			return block.Content, true
+		}
+	}
+	return "", false
+}
+
+// stripFrontMatter removes a leading YAML front matter block
+func stripFrontMatter(note string) string {
+	if !strings.HasPrefix(note, "---\n") {
+		return note
+	}
+	if end := strings.Index(note[4:], "\n---"); end >= 0 {
+		rest := note[4+end+4:]
+		return strings.TrimPrefix(rest, "\n")
+	}
+	return note
+}
+
+// blockByID returns the paragraph or list item ending with the block ID
+// marker, without the marker
+func blockByID(note string, id string) (string, bool) {
+	lines := strings.Split(note, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasSuffix(trimmed, " "+id) && trimmed != id {
+			continue
+		}
+
+		// A marker on its own line labels the paragraph above it, and one
+		// on a list item labels just that item
+		end := i
+		if trimmed == id {
+			end = i - 1
+		}
+		start := end
+		if !isListItem(trimmed) {
+			for start > 0 && strings.TrimSpace(lines[start-1]) != "" {
+				start--
+			}
+		}
+		if end < start {
+			return "", false
+		}
+		block := strings.Join(lines[start:end+1], "\n")
+		block = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(block), id))
+		return block, block != ""
+	}
+	return "", false
+}
+
+// externalSection reads the section named heading from each Markdown file
+// matching pattern, relative to the directory of the document at from.
+// Sections from several files are joined under their file names.
+func (p *processorImpl) externalSection(ctx context.Context, from, pattern, heading string) (doccontext.Block, bool) {
+	log := logging.FromContext(ctx, logger)
+
+	files, err := p.globReferences(from, pattern)
+	if err != nil {
+		log.Warn("invalid reference pattern", "pattern", pattern, "error", err)
+		return doccontext.Block{}, false
+	}
+	if len(files) > maxReferenceFiles {
+		log.Warn("reference matches too many files",
+			"pattern", pattern,
+			"matches", len(files),
+			"limit", maxReferenceFiles)
+		files = files[:maxReferenceFiles]
+	}
+
+	var sections []string
+	for _, file := range files {
+		if p.fs == nil {
+			if err := p.guard.CheckRead(file); err != nil {
+				log.Warn("reference file denied", "file", file, "error", err)
+				continue
+			}
+		}
+		data, err := p.readFile(file)
+		if err != nil {
+			log.Warn("failed to read reference file", "file", file, "error", err)
+			continue
+		}
+		for _, block := range doccontext.CollectBlocks(string(data), []string{heading}) {
+			if block.Priority != doccontext.PriorityReferenced {
+				continue
+			}
+			if len(files) == 1 {
+				sections = append(sections, block.Content)
+			} else {
+				rel, err := filepath.Rel(filepath.Dir(from), file)
+				if err != nil {
+					rel = file
+				}
+				sections = append(sections, fmt.Sprintf("From %s:\n%s", filepath.ToSlash(rel), block.Content))
+			}
+			break
+		}
+	}
+	if len(sections) == 0 {
+		return doccontext.Block{}, false
+	}
+	return doccontext.Block{
+		Content:  strings.Join(sections, "\n\n"),
+		Priority: doccontext.PriorityReferenced,
+	}, true
+}
+
+// globReferences returns the Markdown files matching pattern relative to
+// the directory of from, sorted and excluding from itself
+func (p *processorImpl) globReferences(from, pattern string) ([]string, error) {
+	var matches []string
+	if p.fs != nil {
+		found, err := iofs.Glob(p.fs, path.Join(path.Dir(fsPath(from)), filepath.ToSlash(pattern)))
+		if err != nil {
+			return nil, err
+		}
+		matches = found
+	} else {
+		found, err := filepath.Glob(filepath.Join(filepath.Dir(from), filepath.FromSlash(pattern)))
+		if err != nil {
+			return nil, err
+		}
+		matches = found
+	}
+
+	self := filepath.Clean(from)
+	if p.fs != nil {
+		self = fsPath(from)
+	}
+	var files []string
+	for _, match := range matches {
+		if match == self || strings.ToLower(filepath.Ext(match)) != ".md" {
+			continue
+		}
+		files = append(files, match)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// isListItem reports whether a trimmed line starts a list item
+func isListItem(line string) bool {
+	if strings.HasPrefix(line, "- ") || strings.HasPrefix(line, "* ") || strings.HasPrefix(line, "+ ") {
+		return true
+	}
+	digits := strings.TrimLeft(line, "0123456789")
+	return len(digits) < len(line) && strings.HasPrefix(digits, ". ")
+}
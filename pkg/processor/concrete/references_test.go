@@ -0,0 +1,165 @@
+package concrete
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/fs/memory"
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+)
+
+// writeFiles creates files under dir, keyed by slash-separated path
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func newReferenceProcessor(t *testing.T, projectDir string, opts Options) processor.ReferenceResolver {
+	t.Helper()
+	cfg := &config.Config{
+		References: config.ReferencesConfig{WikiLinks: true},
+		Environment: config.EnvironmentConfig{
+			ConfigDir: filepath.Join(projectDir, ".skai"),
+		},
+		Models: map[string]config.ModelConfigSet{
+			"openai": {"gpt-4": config.ModelConfig{APIKey: "test-key"}},
+		},
+	}
+	cfg.Security.FilePermissions.BlockedPaths = []string{filepath.Join(projectDir, "private")}
+
+	proc, err := NewProcessorWithOptions(cfg, opts)
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+	resolver, ok := proc.(processor.ReferenceResolver)
+	if !ok {
+		t.Fatal("Expected processor to implement processor.ReferenceResolver")
+	}
+	return resolver
+}
+
+func TestAttachReferences(t *testing.T) {
+	projectDir := t.TempDir()
+	writeFiles(t, projectDir, map[string]string{
+		"notes.md":          "# Plan\n\n## Roadmap\nShip v1 in May.\n\n## Team\nTwo people.\n",
+		"goals.md":          "# Goals\nGrow.\n",
+		"docs/api.md":       "# Overview\nThe API.\n",
+		"docs/cli.md":       "# Overview\nThe CLI.\n",
+		"docs/empty.md":     "# Other\nNothing here.\n",
+		"docs/notes.txt":    "# Overview\nNot Markdown.\n",
+		"private/secret.md": "# Keys\nHidden.\n",
+	})
+	resolver := newReferenceProcessor(t, projectDir, Options{})
+	notes := filepath.Join(projectDir, "notes.md")
+
+	cmd, err := parser.New().ParseCommand("!default compare #roadmap# with #goals.md:Goals#, #docs/*:Overview# and #private/secret.md:Keys#")
+	if err != nil {
+		t.Fatalf("Failed to parse command: %v", err)
+	}
+	resolver.AttachReferences(context.Background(), cmd, notes, "# Plan\n\n## Roadmap\nShip v1 in May.\n\n## Team\nTwo people.\n")
+
+	expected := map[string]string{
+		"roadmap":         "Ship v1 in May.",
+		"Team":            "Two people.",
+		"goals.md:Goals":  "Grow.",
+		"docs/*:Overview": "From docs/api.md:\nThe API.\n\nFrom docs/cli.md:\nThe CLI.",
+	}
+	if len(cmd.Context) != len(expected) {
+		t.Errorf("Expected %d sections, got %+v", len(expected), cmd.Context)
+	}
+	for key, content := range expected {
+		if got := cmd.Context[key].Content; got != content {
+			t.Errorf("Section %q: expected %q, got %q", key, content, got)
+		}
+	}
+	if _, ok := cmd.Context["private/secret.md:Keys"]; ok {
+		t.Error("Expected blocked file to be left out")
+	}
+}
+
+func TestAttachReferencesTable(t *testing.T) {
+	resolver := newReferenceProcessor(t, t.TempDir(), Options{})
+	content := "# Pricing\nAs of May.\n\n| Plan | Price |\n|------|------:|\n| Free | 0 |\n"
+
+	cmd, err := parser.New().ParseCommand("!default add a Team plan to #Pricing#")
+	if err != nil {
+		t.Fatalf("Failed to parse command: %v", err)
+	}
+	resolver.AttachReferences(context.Background(), cmd, "notes.md", content)
+
+	block := cmd.Context["Pricing"]
+	if block.Type != parser.Table || block.Table == nil {
+		t.Fatalf("Expected a table block, got %+v", block)
+	}
+	if len(block.Table.Columns) != 2 || len(block.Table.Rows) != 1 || block.Table.Rows[0][1] != "0" {
+		t.Errorf("Expected the Pricing table, got %+v", block.Table)
+	}
+}
+
+func TestAttachReferencesFS(t *testing.T) {
+	fsys := memory.New()
+	if err := fsys.MkdirAll("docs", 0755); err != nil {
+		t.Fatalf("MkdirAll() error = %v", err)
+	}
+	if err := fsys.WriteFile("docs/guide.md", []byte("# Setup\nRun init.\n"), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	resolver := newReferenceProcessor(t, t.TempDir(), Options{FS: fsys})
+
+	cmd, err := parser.New().ParseCommand("!default explain #guide.md:setup#")
+	if err != nil {
+		t.Fatalf("Failed to parse command: %v", err)
+	}
+	resolver.AttachReferences(context.Background(), cmd, "docs/index.md", "")
+
+	if got := cmd.Context["guide.md:setup"].Content; got != "Run init." {
+		t.Errorf("Expected the Setup section, got %+v", cmd.Context)
+	}
+}
+
+func TestAttachLinks(t *testing.T) {
+	projectDir := t.TempDir()
+	writeFiles(t, projectDir, map[string]string{
+		"index.md":               "!default compare\n",
+		"notes/Plan.md":          "---\ntags: [plan]\n---\n# Plan\nShip it.\n",
+		"projects/Alpha.md":      "# Alpha\n\n## Goals\nGrow.\n\n## Risks\nTime.\n",
+		"daily/Log.md":           "Met the team.\nAgreed on scope. ^scope\n\n- one\n- two ^item\n",
+		"private/Secret.md":      "# Keys\nHidden.\n",
+		".obsidian/workspace.md": "# Hidden\n",
+	})
+	resolver := newReferenceProcessor(t, projectDir, Options{})
+
+	cmd, err := parser.NewWithOptions(parser.Options{WikiLinks: true}).ParseCommand(
+		"!default compare [[plan]] with ![[Alpha#Goals]], [[Log#^scope]], [[Log#^item]], [[Secret]] and [[Missing]]")
+	if err != nil {
+		t.Fatalf("Failed to parse command: %v", err)
+	}
+	resolver.AttachReferences(context.Background(), cmd, filepath.Join(projectDir, "index.md"), "!default compare\n")
+
+	expected := map[string]string{
+		"plan":        "# Plan\nShip it.",
+		"Alpha#Goals": "Grow.",
+		"Log#^scope":  "Met the team.\nAgreed on scope.",
+		"Log#^item":   "- two",
+	}
+	if len(cmd.Context) != len(expected) {
+		t.Errorf("Expected %d sections, got %+v", len(expected), cmd.Context)
+	}
+	for key, content := range expected {
+		if got := cmd.Context[key].Content; got != content {
+			t.Errorf("Section %q: expected %q, got %q", key, content, got)
+		}
+	}
+}
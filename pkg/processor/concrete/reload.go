@@ -0,0 +1,30 @@
+package concrete
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+)
+
+// ReloadAssistant loads an assistant whose prompt.md changed again, with
+// the assistants that extend it. Responses recorded but not yet written
+// for them came from the old prompt, so they are dropped and asked again.
+func (p *processorImpl) ReloadAssistant(ctx context.Context, assistant string) error {
+	reloaded, err := p.assistants.Reload(assistant)
+	for _, name := range reloaded {
+		dropped, dropErr := p.state.DropAnswered(name)
+		if dropErr != nil {
+			return fmt.Errorf("failed to drop stale responses: %w", dropErr)
+		}
+		if dropped > 0 {
+			logging.FromContext(ctx, logger).Info("dropped responses of a changed prompt",
+				"assistant", name,
+				"responses", dropped)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to reload assistant %s: %w", assistant, err)
+	}
+	return nil
+}
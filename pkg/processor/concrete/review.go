@@ -0,0 +1,84 @@
+package concrete
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+	"github.com/butter-bot-machines/skylark/pkg/state"
+)
+
+// Pending implements processor.Reviewer
+func (p *processorImpl) Pending(path string) ([]processor.PendingResponse, error) {
+	content, err := p.readFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	commands, err := p.parser.ParseCommands(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse commands: %w", err)
+	}
+
+	document := p.documentKey(path)
+	var pending []processor.PendingResponse
+	for i, inst := range state.Locate(string(content), originals(commands)) {
+		rec, ok := p.state.Lookup(document, inst.Key)
+		if !ok || rec.Outcome != state.OutcomePending {
+			continue
+		}
+		cmd := commands[i]
+		cmd.Output = p.outputMode(cmd)
+		pending = append(pending, processor.PendingResponse{
+			Response: processor.Response{Command: cmd, Response: rec.Response},
+			Key:      inst.Key,
+			Line:     inst.Line,
+		})
+	}
+	return pending, nil
+}
+
+// Preview implements processor.Reviewer
+func (p *processorImpl) Preview(path string, r processor.PendingResponse) (string, string, error) {
+	content, err := p.readFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read file: %w", err)
+	}
+	after, err := mergeResponses(string(content), []processor.Response{r.Response}, filepath.Base(responseFile(path)), p.parser.CommandLines(string(content)))
+	if err != nil {
+		return "", "", err
+	}
+	return string(content), after, nil
+}
+
+// Approve implements processor.Reviewer
+func (p *processorImpl) Approve(path string, r processor.PendingResponse) error {
+	if err := p.UpdateFile(path, []processor.Response{r.Response}); err != nil {
+		return fmt.Errorf("failed to update file: %w", err)
+	}
+
+	document := p.documentKey(path)
+	if rec, ok := p.state.Lookup(document, r.Key); ok {
+		rec.Line, rec.Outcome, rec.Response = r.Line, state.OutcomeProcessed, ""
+		if err := p.state.Put(document, rec); err != nil {
+			return err
+		}
+	}
+	// Record the content including the response, so the write does not
+	// trigger processing
+	return p.recordProcessed(path, document)
+}
+
+// Reject implements processor.Reviewer
+func (p *processorImpl) Reject(path string, r processor.PendingResponse) error {
+	document := p.documentKey(path)
+	if rec, ok := p.state.Lookup(document, r.Key); ok {
+		rec.Outcome, rec.Error, rec.Response = state.OutcomeFailed, "response rejected in review", ""
+		if err := p.state.Put(document, rec); err != nil {
+			return err
+		}
+	}
+	if err := p.index.forget(document); err != nil {
+		logger.Warn("failed to update content index", "file", path, "error", err)
+	}
+	return nil
+}
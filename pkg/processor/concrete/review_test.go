@@ -0,0 +1,78 @@
+package concrete
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+)
+
+func TestProcessorRequireApproval(t *testing.T) {
+	projectDir := t.TempDir()
+	calls := 0
+	cfg := &config.Config{Processing: config.ProcessingConfig{RequireApproval: true}}
+	proc := newConfiguredProcessor(t, projectDir, cfg, Options{}, "An answer", &calls, nil)
+	reviewer := proc.(processor.Reviewer)
+
+	testFile := filepath.Join(projectDir, "notes.md")
+	original := "# Notes\n!test first\n!test second\n"
+	if err := os.WriteFile(testFile, []byte(original), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := proc.ProcessFile(testFile); err != nil {
+		t.Fatalf("Failed to process file: %v", err)
+	}
+
+	// The document is left alone until responses are approved
+	content, _ := os.ReadFile(testFile)
+	if string(content) != original {
+		t.Errorf("Expected the document unchanged, got:\n%s", content)
+	}
+	pending, err := reviewer.Pending(testFile)
+	if err != nil {
+		t.Fatalf("Failed to list pending responses: %v", err)
+	}
+	if len(pending) != 2 {
+		t.Fatalf("Expected 2 pending responses, got %d", len(pending))
+	}
+
+	before, after, err := reviewer.Preview(testFile, pending[0])
+	if err != nil {
+		t.Fatalf("Failed to preview: %v", err)
+	}
+	if before != original {
+		t.Errorf("Expected preview of the current content, got:\n%s", before)
+	}
+	if expected := "# Notes\n-!test first\n\nAn answer\n!test second\n"; after != expected {
+		t.Errorf("Preview mismatch\nExpected:\n%s\nGot:\n%s", expected, after)
+	}
+
+	// Approve the first, with an edit, and reject the second
+	pending[0].Response.Response = "An edited answer"
+	if err := reviewer.Approve(testFile, pending[0]); err != nil {
+		t.Fatalf("Failed to approve: %v", err)
+	}
+	if err := reviewer.Reject(testFile, pending[1]); err != nil {
+		t.Fatalf("Failed to reject: %v", err)
+	}
+	content, _ = os.ReadFile(testFile)
+	if expected := "# Notes\n-!test first\n\nAn edited answer\n!test second\n"; string(content) != expected {
+		t.Errorf("Content mismatch\nExpected:\n%s\nGot:\n%s", expected, content)
+	}
+	if pending, _ := reviewer.Pending(testFile); len(pending) != 0 {
+		t.Errorf("Expected no pending responses, got %d", len(pending))
+	}
+
+	// The rejected command is asked again
+	if err := proc.ProcessFile(testFile); err != nil {
+		t.Fatalf("Failed to process file: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 requests, got %d", calls)
+	}
+	if pending, _ := reviewer.Pending(testFile); len(pending) != 1 {
+		t.Errorf("Expected 1 pending response, got %d", len(pending))
+	}
+}
@@ -0,0 +1,30 @@
+package processor
+
+import (
+	"context"
+
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+)
+
+// Hooks customize processing at the stages of the pipeline a document goes
+// through: its commands are parsed, given the context they reference, sent
+// to their assistant's model, which may call tools, and their responses are
+// post-processed and written to the document. Any hook may be nil. A hook
+// returning an error stops the command or write it was called for, and the
+// error is returned wrapped.
+//
+// Several Hooks may be registered; they run in the order they were
+// registered, each seeing the changes of the ones before.
+type Hooks struct {
+	// OnCommandStart is called before a command is sent to its assistant,
+	// with its referenced context attached. It may change the command.
+	OnCommandStart func(ctx context.Context, cmd *parser.Command) error
+
+	// OnResponse is called with the response to a command once it was
+	// formatted and filtered, and returns the response to use
+	OnResponse func(ctx context.Context, cmd *parser.Command, response string) (string, error)
+
+	// OnFileWrite is called before a document or response file at path
+	// is written, and returns the content to write
+	OnFileWrite func(path string, data []byte) ([]byte, error)
+}
@@ -1,16 +1,32 @@
 package processor
 
 import (
+	"context"
+	"errors"
+
 	"github.com/butter-bot-machines/skylark/pkg/parser"
 	"github.com/butter-bot-machines/skylark/pkg/process"
+	"github.com/butter-bot-machines/skylark/pkg/state"
 )
 
+// ErrConflict is returned when a document changed during processing in a
+// way the responses cannot be merged into, such as a command being edited
+// or removed. Retrying processes the document as it is now.
+var ErrConflict = errors.New("document changed during processing")
+
 // CommandProcessor handles individual command processing
 type CommandProcessor interface {
 	// Process processes a single command and returns its response
 	Process(cmd *parser.Command) (string, error)
 }
 
+// ContextCommandProcessor is implemented by command processors that accept
+// a context, used to record trace spans under the caller's span
+type ContextCommandProcessor interface {
+	// ProcessContext processes a single command within ctx
+	ProcessContext(ctx context.Context, cmd *parser.Command) (string, error)
+}
+
 // FileProcessor handles file-level processing
 type FileProcessor interface {
 	// ProcessFile processes a single file
@@ -20,6 +36,128 @@ type FileProcessor interface {
 	ProcessDirectory(dir string) error
 }
 
+// ContextFileProcessor is implemented by file processors that accept a
+// context, used to record trace spans under the originating file event
+type ContextFileProcessor interface {
+	// ProcessFileContext processes a single file within ctx
+	ProcessFileContext(ctx context.Context, path string) error
+}
+
+// DocumentStore is implemented by processors that read and write documents
+// through their own file system, applying its access checks
+type DocumentStore interface {
+	// ReadFile returns the content of the document at path
+	ReadFile(path string) ([]byte, error)
+
+	// WriteFile replaces the content of the document at path
+	WriteFile(path string, data []byte) error
+}
+
+// CommandScanner is implemented by processors that list the commands of a
+// document as they would process them: read through their own file system,
+// with its access checks, and parsed with their configured parser
+type CommandScanner interface {
+	// Commands returns the commands of the document at path
+	Commands(path string) ([]*parser.Command, error)
+}
+
+// ReferenceResolver is implemented by processors that can fill a command's
+// context with the sections it references
+type ReferenceResolver interface {
+	// AttachReferences fills cmd.Context with the sections it references,
+	// read from content for the document at path or from the other files
+	// that cross-file references such as #notes.md:Goals# name
+	AttachReferences(ctx context.Context, cmd *parser.Command, path string, content string)
+}
+
+// Catalog is implemented by processors that can describe and invoke their
+// tools and assistants directly, outside of a Markdown file
+type Catalog interface {
+	// Tools returns the tools that loaded successfully
+	Tools(ctx context.Context) ([]ToolInfo, error)
+
+	// Assistants returns the configured assistants
+	Assistants(ctx context.Context) ([]AssistantInfo, error)
+
+	// RunTool executes a tool in the sandbox with JSON input
+	RunTool(ctx context.Context, name string, input string) (string, error)
+
+	// Ask sends a prompt to an assistant and returns its response
+	Ask(ctx context.Context, assistant string, prompt string) (string, error)
+}
+
+// Reviewer is implemented by processors that can hold responses for
+// approval before they are written to documents
+type Reviewer interface {
+	// Pending returns the responses held for the commands of the document
+	// at path, in document order
+	Pending(path string) ([]PendingResponse, error)
+
+	// Preview returns the current content of the document at path and the
+	// content it would have with r written to it
+	Preview(path string, r PendingResponse) (before, after string, err error)
+
+	// Approve writes r to the document at path. Its Response may have been
+	// edited since it was returned by Pending.
+	Approve(path string, r PendingResponse) error
+
+	// Reject discards r; the command is asked again the next time the
+	// document is processed
+	Reject(path string, r PendingResponse) error
+}
+
+// KnowledgeRefresher is implemented by processors whose assistants draw
+// on the files of their knowledge directories
+type KnowledgeRefresher interface {
+	// RefreshKnowledge re-indexes the changed knowledge files of an
+	// assistant and drops the recorded responses that drew on the old ones
+	RefreshKnowledge(ctx context.Context, assistant string) error
+}
+
+// AssistantReloader is implemented by processors that cache the
+// assistants they load
+type AssistantReloader interface {
+	// ReloadAssistant loads an assistant, and those extending it, again
+	// from their prompt.md files
+	ReloadAssistant(ctx context.Context, assistant string) error
+}
+
+// InstanceProcessor is implemented by processors that record the response
+// to each command instance of a document under its state key, so that a
+// response received before a crash is written by the next run instead of
+// being asked for again
+type InstanceProcessor interface {
+	// ProcessInstance processes cmd, the instance inst of the document at
+	// path. A response recorded for inst and not yet written is returned
+	// without asking the assistant again.
+	ProcessInstance(ctx context.Context, path string, inst state.Instance, cmd *parser.Command) (string, error)
+
+	// MarkWritten records that the responses to instances are in the
+	// document at path, so they are not reused
+	MarkWritten(ctx context.Context, path string, instances []state.Instance)
+}
+
+// PendingResponse is a response held for approval
+type PendingResponse struct {
+	Response
+	Key  string // Identifies the command instance in the document
+	Line int    // 1-based line of the command
+}
+
+// ToolInfo describes a tool and its input schema
+type ToolInfo struct {
+	Name        string
+	Description string
+	Parameters  map[string]interface{} // JSON schema of the tool input
+}
+
+// AssistantInfo describes an assistant
+type AssistantInfo struct {
+	Name        string
+	Description string
+	Model       string
+}
+
 // ResponseHandler manages command responses
 type ResponseHandler interface {
 	// HandleResponse processes a command response
@@ -43,6 +181,9 @@ type ProcessManager interface {
 
 	// GetProcessManager returns the process manager for worker pool integration
 	GetProcessManager() process.Manager
+
+	// Close stops the plugins the processor started
+	Close() error
 }
 
 // Factory creates new processors
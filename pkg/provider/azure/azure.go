@@ -0,0 +1,135 @@
+// Package azure sends chat completions to Azure OpenAI deployments. The
+// API matches OpenAI's, so requests go through the OpenAI provider with
+// Azure's endpoints and credentials.
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/models"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+	"github.com/butter-bot-machines/skylark/pkg/provider/openai"
+)
+
+// DefaultAPIVersion is the REST API version used when a deployment sets
+// none
+const DefaultAPIVersion = "2024-10-21"
+
+// TokenSource supplies Azure AD access tokens
+type TokenSource interface {
+	// Token returns a valid access token
+	Token(ctx context.Context) (string, error)
+}
+
+// Options configures the Azure OpenAI provider
+type Options struct {
+	// HTTPClient for making requests (optional)
+	HTTPClient provider.HTTPClient
+	// RateLimiter for controlling request rates (optional)
+	RateLimiter openai.RateLimiting
+	// Monitor for tracking metrics (optional)
+	Monitor provider.Monitor
+	// ToolLoop limits the rounds and tokens spent answering calls to
+	// registered tools (optional)
+	ToolLoop provider.ToolLoop
+	// TokenSource supplies Azure AD tokens (optional, defaults to the
+	// client credentials of the deployment's azure_ad settings)
+	TokenSource TokenSource
+	// Models describes the context windows and capabilities of models
+	// (optional, defaults to the built-in metadata)
+	Models *models.Registry
+}
+
+// New creates a provider for the deployment cfg configures. Requests are
+// authenticated with an Azure AD token when opts or cfg supply a source,
+// and with the API key otherwise.
+func New(deployment string, cfg config.ModelConfig, opts Options) (*openai.Provider, error) {
+	if cfg.Endpoint == "" {
+		return nil, &provider.Error{
+			Code:    provider.ErrInvalidInput,
+			Message: "Azure OpenAI endpoint is required",
+		}
+	}
+	endpoint, err := DeploymentURL(cfg.Endpoint, deployment, cfg.APIVersion)
+	if err != nil {
+		return nil, &provider.Error{
+			Code:    provider.ErrInvalidInput,
+			Message: err.Error(),
+		}
+	}
+
+	tokens := opts.TokenSource
+	if tokens == nil && cfg.AzureAD != nil {
+		tokens = &ClientCredentials{
+			TenantID:     cfg.AzureAD.TenantID,
+			ClientID:     cfg.AzureAD.ClientID,
+			ClientSecret: cfg.AzureAD.ClientSecret,
+			HTTPClient:   opts.HTTPClient,
+		}
+	}
+	if tokens == nil && cfg.APIKey == "" {
+		return nil, &provider.Error{
+			Code:    provider.ErrAuthentication,
+			Message: "Azure OpenAI API key or Azure AD credentials are required",
+		}
+	}
+
+	return openai.New(deployment, cfg, openai.Options{
+		HTTPClient:  opts.HTTPClient,
+		RateLimiter: opts.RateLimiter,
+		Monitor:     opts.Monitor,
+		ToolLoop:    opts.ToolLoop,
+		URL:         endpoint,
+		Authorize:   authorizer(cfg.APIKey, tokens),
+		Models:      opts.Models,
+		// The model behind a deployment is not known from its name, so
+		// the service decides whether it takes images unless the
+		// deployment is described
+		AcceptsImages: func(deployment string) bool {
+			meta, ok := opts.Models.Lookup(deployment)
+			return !ok || meta.Vision
+		},
+	})
+}
+
+// DeploymentURL returns the chat completions URL of a deployment of the
+// resource at endpoint
+func DeploymentURL(endpoint, deployment, apiVersion string) (string, error) {
+	u, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid Azure OpenAI endpoint: %s", endpoint)
+	}
+	if deployment == "" {
+		return "", fmt.Errorf("Azure OpenAI deployment is required")
+	}
+	if apiVersion == "" {
+		apiVersion = DefaultAPIVersion
+	}
+	u = u.JoinPath("openai", "deployments", deployment, "chat", "completions")
+	u.RawQuery = url.Values{"api-version": {apiVersion}}.Encode()
+	return u.String(), nil
+}
+
+// authorizer returns a function setting a bearer token from tokens on
+// each request, or the api-key header when tokens is nil
+func authorizer(apiKey string, tokens TokenSource) func(ctx context.Context, req *http.Request) error {
+	if tokens == nil {
+		return func(ctx context.Context, req *http.Request) error {
+			req.Header.Set("api-key", apiKey)
+			return nil
+		}
+	}
+	return func(ctx context.Context, req *http.Request) error {
+		token, err := tokens.Token(ctx)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+}
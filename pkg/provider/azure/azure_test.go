@@ -0,0 +1,184 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+)
+
+const completion = `{
+  "choices": [{"message": {"role": "assistant", "content": "Hello from Azure"}}],
+  "usage": {"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15}
+}`
+
+// fakeClient answers token requests and chat completions, recording the
+// requests it receives
+type fakeClient struct {
+	requests []*http.Request
+	forms    []url.Values
+}
+
+func (c *fakeClient) Do(req *http.Request) (*http.Response, error) {
+	c.requests = append(c.requests, req)
+	body := completion
+	if strings.HasSuffix(req.URL.Path, "/oauth2/v2.0/token") {
+		data, _ := io.ReadAll(req.Body)
+		form, _ := url.ParseQuery(string(data))
+		c.forms = append(c.forms, form)
+		body = `{"token_type": "Bearer", "expires_in": 3599, "access_token": "ad-token"}`
+		if form.Get("client_secret") != "secret" {
+			return respond(http.StatusUnauthorized, `{"error": "invalid_client", "error_description": "bad secret"}`), nil
+		}
+	}
+	return respond(http.StatusOK, body), nil
+}
+
+func (c *fakeClient) CloseIdleConnections() {}
+
+func respond(status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+// noLimit lets every request through
+type noLimit struct{}
+
+func (noLimit) Wait(ctx context.Context) error { return nil }
+func (noLimit) AddTokens(count int) error      { return nil }
+
+func TestDeploymentURL(t *testing.T) {
+	tests := []struct {
+		endpoint   string
+		deployment string
+		apiVersion string
+		want       string
+		wantErr    bool
+	}{
+		{
+			endpoint:   "https://example.openai.azure.com/",
+			deployment: "gpt4o-prod",
+			want:       "https://example.openai.azure.com/openai/deployments/gpt4o-prod/chat/completions?api-version=" + DefaultAPIVersion,
+		},
+		{
+			endpoint:   "https://example.openai.azure.com",
+			deployment: "chat model",
+			apiVersion: "2025-01-01-preview",
+			want:       "https://example.openai.azure.com/openai/deployments/chat%20model/chat/completions?api-version=2025-01-01-preview",
+		},
+		{endpoint: "example.openai.azure.com", deployment: "gpt4o", wantErr: true},
+		{endpoint: "https://example.openai.azure.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := DeploymentURL(tt.endpoint, tt.deployment, tt.apiVersion)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("DeploymentURL(%q, %q) error = %v, wantErr %v", tt.endpoint, tt.deployment, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("DeploymentURL(%q, %q) = %q, want %q", tt.endpoint, tt.deployment, got, tt.want)
+		}
+	}
+}
+
+func TestSendWithAPIKey(t *testing.T) {
+	client := &fakeClient{}
+	p, err := New("gpt4o-prod", config.ModelConfig{
+		APIKey:   "azure-key",
+		Endpoint: "https://example.openai.azure.com",
+	}, Options{HTTPClient: client, RateLimiter: noLimit{}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	resp, err := p.Send(context.Background(), provider.Prompt("hi"), nil)
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if resp.Content != "Hello from Azure" {
+		t.Errorf("Expected the completion, got %q", resp.Content)
+	}
+
+	req := client.requests[0]
+	if req.URL.Path != "/openai/deployments/gpt4o-prod/chat/completions" || req.URL.Query().Get("api-version") != DefaultAPIVersion {
+		t.Errorf("Expected the deployment URL, got %s", req.URL)
+	}
+	if req.Header.Get("api-key") != "azure-key" || req.Header.Get("Authorization") != "" {
+		t.Errorf("Expected the api-key header only, got %v", req.Header)
+	}
+}
+
+func TestSendWithAzureAD(t *testing.T) {
+	client := &fakeClient{}
+	p, err := New("gpt4o-prod", config.ModelConfig{
+		Endpoint: "https://example.openai.azure.com",
+		AzureAD:  &config.AzureADConfig{TenantID: "tenant", ClientID: "app", ClientSecret: "secret"},
+	}, Options{HTTPClient: client, RateLimiter: noLimit{}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// The token is requested once and reused
+	for i := 0; i < 2; i++ {
+		if _, err := p.Send(context.Background(), provider.Prompt("hi"), nil); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+	if len(client.requests) != 3 || len(client.forms) != 1 {
+		t.Fatalf("Expected one token request and two completions, got %d requests", len(client.requests))
+	}
+	token := client.requests[0]
+	if token.URL.String() != DefaultAuthority+"/tenant/oauth2/v2.0/token" {
+		t.Errorf("Expected the tenant's token endpoint, got %s", token.URL)
+	}
+	if form := client.forms[0]; form.Get("client_id") != "app" || form.Get("scope") != Scope || form.Get("grant_type") != "client_credentials" {
+		t.Errorf("Unexpected token request %v", form)
+	}
+	for _, req := range client.requests[1:] {
+		if req.Header.Get("Authorization") != "Bearer ad-token" || req.Header.Get("api-key") != "" {
+			t.Errorf("Expected the Azure AD token, got %v", req.Header)
+		}
+	}
+}
+
+func TestSendTokenDenied(t *testing.T) {
+	client := &fakeClient{}
+	p, err := New("gpt4o-prod", config.ModelConfig{
+		Endpoint: "https://example.openai.azure.com",
+		AzureAD:  &config.AzureADConfig{TenantID: "tenant", ClientID: "app", ClientSecret: "wrong"},
+	}, Options{HTTPClient: client, RateLimiter: noLimit{}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	_, err = p.Send(context.Background(), provider.Prompt("hi"), nil)
+	var perr *provider.Error
+	if !errors.As(err, &perr) || perr.Code != provider.ErrAuthentication || !strings.Contains(perr.Message, "invalid_client: bad secret") {
+		t.Errorf("Expected an authentication error, got %v", err)
+	}
+	if len(client.requests) != 1 {
+		t.Errorf("Expected no completion request, got %d requests", len(client.requests))
+	}
+}
+
+func TestNewRequiresCredentials(t *testing.T) {
+	_, err := New("gpt4o-prod", config.ModelConfig{Endpoint: "https://example.openai.azure.com"}, Options{})
+	var perr *provider.Error
+	if !errors.As(err, &perr) || perr.Code != provider.ErrAuthentication {
+		t.Errorf("Expected an authentication error, got %v", err)
+	}
+
+	if _, err := New("gpt4o-prod", config.ModelConfig{APIKey: "azure-key"}, Options{}); err == nil {
+		t.Error("Expected an error without an endpoint")
+	}
+}
@@ -0,0 +1,108 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+)
+
+const (
+	// DefaultAuthority is the Azure AD endpoint tokens are requested from
+	DefaultAuthority = "https://login.microsoftonline.com"
+
+	// Scope is the scope of tokens for Azure OpenAI
+	Scope = "https://cognitiveservices.azure.com/.default"
+
+	// refreshMargin is how long before it expires a token is replaced
+	refreshMargin = 5 * time.Minute
+)
+
+// ClientCredentials is a TokenSource for an Azure AD app, authenticated
+// with its client secret. Tokens are cached until shortly before they
+// expire.
+type ClientCredentials struct {
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+	HTTPClient   provider.HTTPClient // Optional, defaults to http.DefaultClient
+	Authority    string              // Optional, defaults to DefaultAuthority
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// Token implements TokenSource
+func (c *ClientCredentials) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Now().Add(refreshMargin).Before(c.expires) {
+		return c.token, nil
+	}
+
+	token, lifetime, err := c.request(ctx)
+	if err != nil {
+		return "", err
+	}
+	c.token, c.expires = token, time.Now().Add(lifetime)
+	return c.token, nil
+}
+
+// request fetches a new token and its lifetime
+func (c *ClientCredentials) request(ctx context.Context) (string, time.Duration, error) {
+	authority := c.Authority
+	if authority == "" {
+		authority = DefaultAuthority
+	}
+	tokenURL := strings.TrimSuffix(authority, "/") + "/" + url.PathEscape(c.TenantID) + "/oauth2/v2.0/token"
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {c.ClientID},
+		"client_secret": {c.ClientSecret},
+		"scope":         {Scope},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read token response: %w", err)
+	}
+
+	var result struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", 0, fmt.Errorf("failed to parse token response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || result.AccessToken == "" {
+		if result.Error != "" {
+			return "", 0, fmt.Errorf("token request denied: %s: %s", result.Error, result.ErrorDescription)
+		}
+		return "", 0, fmt.Errorf("token request failed with status %d", resp.StatusCode)
+	}
+	return result.AccessToken, time.Duration(result.ExpiresIn) * time.Second, nil
+}
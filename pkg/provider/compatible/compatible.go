@@ -0,0 +1,92 @@
+// Package compatible sends chat completions to servers implementing the
+// OpenAI API, such as vLLM, LM Studio, Ollama or Together, through the
+// OpenAI provider pointed at the server's base URL.
+package compatible
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/models"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+	"github.com/butter-bot-machines/skylark/pkg/provider/openai"
+)
+
+// Options configures the provider
+type Options struct {
+	// HTTPClient for making requests (optional)
+	HTTPClient provider.HTTPClient
+	// RateLimiter for controlling request rates (optional, defaults to
+	// none since self-hosted servers have no quota)
+	RateLimiter openai.RateLimiting
+	// Monitor for tracking metrics (optional)
+	Monitor provider.Monitor
+	// ToolLoop limits the rounds and tokens spent answering calls to
+	// registered tools (optional)
+	ToolLoop provider.ToolLoop
+	// Models describes the context windows and capabilities of models
+	// (optional, defaults to the built-in metadata)
+	Models *models.Registry
+}
+
+// New creates a provider for model on the server at cfg.BaseURL. The API
+// key, when set, is sent as a bearer token; servers without
+// authentication need none.
+func New(model string, cfg config.ModelConfig, opts Options) (*openai.Provider, error) {
+	endpoint, err := CompletionsURL(cfg.BaseURL)
+	if err != nil {
+		return nil, &provider.Error{
+			Code:    provider.ErrInvalidInput,
+			Message: err.Error(),
+		}
+	}
+
+	rateLimiter := opts.RateLimiter
+	if rateLimiter == nil {
+		rateLimiter = unlimited{}
+	}
+
+	return openai.New(model, cfg, openai.Options{
+		HTTPClient:  opts.HTTPClient,
+		RateLimiter: rateLimiter,
+		Monitor:     opts.Monitor,
+		ToolLoop:    opts.ToolLoop,
+		URL:         endpoint,
+		Authorize: func(ctx context.Context, req *http.Request) error {
+			if cfg.APIKey != "" {
+				req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+			}
+			return nil
+		},
+		Models: opts.Models,
+		// Which served models take images is up to the server, unless
+		// model_metadata describes them
+		AcceptsImages: func(model string) bool {
+			meta, ok := opts.Models.Lookup(model)
+			return !ok || meta.Vision
+		},
+	})
+}
+
+// CompletionsURL returns the chat completions endpoint under baseURL,
+// which usually ends in /v1
+func CompletionsURL(baseURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid base URL: %q", baseURL)
+	}
+	return u.JoinPath("chat", "completions").String(), nil
+}
+
+// unlimited is a rate limiter that lets every request through
+type unlimited struct{}
+
+// Wait implements openai.RateLimiting
+func (unlimited) Wait(ctx context.Context) error { return nil }
+
+// AddTokens implements openai.RateLimiting
+func (unlimited) AddTokens(count int) error { return nil }
@@ -0,0 +1,109 @@
+package compatible
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+)
+
+func TestCompletionsURL(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		want    string
+		wantErr bool
+	}{
+		{baseURL: "http://localhost:8000/v1", want: "http://localhost:8000/v1/chat/completions"},
+		{baseURL: "https://api.together.xyz/v1/", want: "https://api.together.xyz/v1/chat/completions"},
+		{baseURL: "localhost:1234", wantErr: true},
+		{baseURL: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := CompletionsURL(tt.baseURL)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("CompletionsURL(%q) error = %v, wantErr %v", tt.baseURL, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("CompletionsURL(%q) = %q, want %q", tt.baseURL, got, tt.want)
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	var auth string
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["model"] == "missing" {
+			// vLLM's error shape
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"object": "error", "message": "The model missing does not exist.", "type": "NotFoundError", "code": 404}`))
+			return
+		}
+		// No total tokens and no finish details, as some servers reply
+		w.Write([]byte(`{"choices": [{"message": {"content": "local reply"}}], "usage": {"prompt_tokens": 7, "completion_tokens": 3}}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		model    string
+		apiKey   string
+		wantAuth string
+		wantErr  string
+	}{
+		{name: "without api key", model: "llama3:8b"},
+		{name: "with api key", model: "meta-llama/Llama-3-8b", apiKey: "together-key", wantAuth: "Bearer together-key"},
+		{name: "unknown model", model: "missing", wantErr: provider.ErrInvalidInput},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, body = "", nil
+			p, err := New(tt.model, config.ModelConfig{BaseURL: server.URL + "/v1", APIKey: tt.apiKey}, Options{})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			resp, err := p.Send(context.Background(), provider.Prompt("hi"), nil)
+			if tt.wantErr != "" {
+				var perr *provider.Error
+				if !errors.As(err, &perr) || perr.Code != tt.wantErr || perr.Message != "The model missing does not exist." {
+					t.Errorf("Expected %s error, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+
+			if resp.Content != "local reply" || resp.Usage.TotalTokens != 10 {
+				t.Errorf("Expected the reply with 10 tokens, got %q with %d", resp.Content, resp.Usage.TotalTokens)
+			}
+			if body["model"] != tt.model {
+				t.Errorf("Expected model %s, got %v", tt.model, body["model"])
+			}
+			if auth != tt.wantAuth {
+				t.Errorf("Expected Authorization %q, got %q", tt.wantAuth, auth)
+			}
+		})
+	}
+}
+
+func TestNewRequiresBaseURL(t *testing.T) {
+	if _, err := New("llama3", config.ModelConfig{}, Options{}); err == nil {
+		t.Error("Expected an error without a base URL")
+	}
+}
@@ -88,7 +88,7 @@ func TestProviderMonitoring(t *testing.T) {
 		}
 
 		// Send request with default options
-		_, err = p.Send(context.Background(), "test", provider.DefaultRequestOptions)
+		_, err = p.Send(context.Background(), provider.Prompt("test"), provider.DefaultRequestOptions)
 		if err != nil {
 			t.Fatalf("Send failed: %v", err)
 		}
@@ -139,9 +139,10 @@ func TestProviderMonitoring(t *testing.T) {
 			},
 		}
 
-		// Create provider
+		// Create provider, without retries
 		p, err := New("gpt-4", config.ModelConfig{
-			APIKey: "test-key",
+			APIKey:      "test-key",
+			MaxAttempts: 1,
 		}, Options{
 			HTTPClient: client,
 			Monitor:    monitor,
@@ -151,7 +152,7 @@ func TestProviderMonitoring(t *testing.T) {
 		}
 
 		// Send request (expect error) with default options
-		_, err = p.Send(context.Background(), "test", provider.DefaultRequestOptions)
+		_, err = p.Send(context.Background(), provider.Prompt("test"), provider.DefaultRequestOptions)
 		if err == nil {
 			t.Fatal("Expected error but got none")
 		}
@@ -242,7 +243,7 @@ func TestProviderMonitoring(t *testing.T) {
 		p.RegisterTool("test_tool", &testTool{schema: schema})
 
 		// Send request with default options
-		_, err = p.Send(context.Background(), "test", provider.DefaultRequestOptions)
+		_, err = p.Send(context.Background(), provider.Prompt("test"), provider.DefaultRequestOptions)
 		if err != nil {
 			t.Fatalf("Send failed: %v", err)
 		}
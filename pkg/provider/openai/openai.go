@@ -3,15 +3,24 @@ package openai
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/butter-bot-machines/skylark/pkg/config"
+	doccontext "github.com/butter-bot-machines/skylark/pkg/context"
+	"github.com/butter-bot-machines/skylark/pkg/models"
 	"github.com/butter-bot-machines/skylark/pkg/provider"
+	"github.com/butter-bot-machines/skylark/pkg/timing"
 	"github.com/butter-bot-machines/skylark/pkg/tool"
 )
 
@@ -31,8 +40,23 @@ type Tool interface {
 	Execute(args []byte, env map[string]string) ([]byte, error)
 }
 
+// ContextTool is implemented by tools that stop when the request that
+// called them is cancelled
+type ContextTool interface {
+	Tool
+	// ExecuteContext runs the tool like Execute until ctx is done
+	ExecuteContext(ctx context.Context, args []byte, env map[string]string) ([]byte, error)
+}
+
 const apiTimeout = 30 * time.Second
 
+// Retries of rate limited and failed requests
+const (
+	defaultMaxAttempts  = 3
+	defaultRetryBackoff = time.Second      // Delay before the first retry
+	maxRetryBackoff     = 30 * time.Second // Longest delay of the exponential backoff
+)
+
 var apiURL = "https://api.openai.com/v1/chat/completions"
 
 // Response types for parsing OpenAI API responses
@@ -56,6 +80,94 @@ type Response struct {
 	} `json:"usage"`
 }
 
+// chatMessage is a message of a chat completion request. Content is text,
+// or parts when the message holds images.
+type chatMessage struct {
+	Role       string         `json:"role"`
+	Content    any            `json:"content"`
+	ToolCalls  []chatToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string         `json:"tool_call_id,omitempty"`
+}
+
+// chatPart is a text or image part of a message's content
+type chatPart struct {
+	Type     string        `json:"type"`
+	Text     string        `json:"text,omitempty"`
+	ImageURL *chatImageURL `json:"image_url,omitempty"`
+}
+
+// chatImageURL locates the image of an image part
+type chatImageURL struct {
+	URL string `json:"url"`
+}
+
+// chatToolCall is a tool call of an assistant message
+type chatToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// chatMessages converts a conversation to request messages
+func chatMessages(messages []provider.Message) []chatMessage {
+	result := make([]chatMessage, 0, len(messages))
+	for _, m := range messages {
+		msg := chatMessage{Role: m.Role, Content: m.Content, ToolCallID: m.ToolCallID}
+		if len(m.Images) > 0 {
+			msg.Content = contentParts(m)
+		}
+		for _, call := range m.ToolCalls {
+			c := chatToolCall{ID: call.ID, Type: "function"}
+			c.Function.Name = call.Function.Name
+			c.Function.Arguments = call.Function.Arguments
+			msg.ToolCalls = append(msg.ToolCalls, c)
+		}
+		result = append(result, msg)
+	}
+	return result
+}
+
+// contentParts returns the text of m followed by its images, inlined as
+// data URLs
+func contentParts(m provider.Message) []chatPart {
+	parts := []chatPart{{Type: "text", Text: m.Content}}
+	for _, image := range m.Images {
+		url := "data:" + image.MediaType + ";base64," + base64.StdEncoding.EncodeToString(image.Data)
+		parts = append(parts, chatPart{Type: "image_url", ImageURL: &chatImageURL{URL: url}})
+	}
+	return parts
+}
+
+// acceptsImages reports whether the built-in metadata says model takes
+// images as input
+func acceptsImages(model string) bool {
+	meta, ok := models.Default().Lookup(model)
+	return ok && meta.Vision
+}
+
+// hasImages reports whether any message holds images
+func hasImages(messages []provider.Message) bool {
+	for _, m := range messages {
+		if len(m.Images) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// toolArguments returns the arguments of a tool call as JSON text. The API
+// sends them as a JSON string holding the arguments object.
+func toolArguments(raw json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+	return string(raw)
+}
+
 // Options configures the OpenAI provider
 type Options struct {
 	// HTTPClient for making requests (optional)
@@ -64,6 +176,27 @@ type Options struct {
 	RateLimiter RateLimiting
 	// Monitor for tracking metrics (optional)
 	Monitor provider.Monitor
+	// ToolLoop limits the rounds and tokens spent answering calls to
+	// registered tools (optional)
+	ToolLoop provider.ToolLoop
+	// URL of the chat completions endpoint (optional, defaults to the
+	// model's base URL or OpenAI's)
+	URL string
+	// Authorize sets the credentials of each request (optional, defaults
+	// to the API key as a bearer token). The API key is not required when
+	// set.
+	Authorize func(ctx context.Context, req *http.Request) error
+	// AcceptsImages reports whether a model takes images (optional,
+	// defaults to the models Models says support vision)
+	AcceptsImages func(model string) bool
+	// Models describes the context windows and capabilities of models
+	// (optional, defaults to the built-in metadata)
+	Models *models.Registry
+	// RetryBackoff is the delay before the first retry, doubled for each
+	// further one (optional, defaults to a second)
+	RetryBackoff time.Duration
+	// Clock waits out retry delays (optional, defaults to the system clock)
+	Clock timing.Clock
 }
 
 // Provider implements the provider interface for OpenAI
@@ -74,12 +207,20 @@ type Provider struct {
 	tools      map[string]Tool
 	rateLimits RateLimiting
 	monitor    provider.Monitor
+	toolLoop   provider.ToolLoop
+	url        string
+	authorize  func(ctx context.Context, req *http.Request) error
+	images     func(model string) bool
+	models     *models.Registry
+	attempts   int
+	backoff    time.Duration
+	clock      timing.Clock
 	mu         sync.RWMutex
 }
 
 // New creates a new OpenAI provider
 func New(model string, cfg config.ModelConfig, opts Options) (*Provider, error) {
-	if cfg.APIKey == "" {
+	if cfg.APIKey == "" && opts.Authorize == nil {
 		return nil, &provider.Error{
 			Code:    provider.ErrAuthentication,
 			Message: "OpenAI API key is required",
@@ -89,8 +230,13 @@ func New(model string, cfg config.ModelConfig, opts Options) (*Provider, error)
 	// Use provided client or create default
 	client := opts.HTTPClient
 	if client == nil {
+		transport, err := proxyTransport(cfg.Proxy)
+		if err != nil {
+			return nil, err
+		}
 		client = &http.Client{
-			Timeout: apiTimeout,
+			Transport: transport,
+			Timeout:   apiTimeout,
 		}
 	}
 
@@ -103,6 +249,40 @@ func New(model string, cfg config.ModelConfig, opts Options) (*Provider, error)
 		})
 	}
 
+	url := opts.URL
+	if url == "" && cfg.BaseURL != "" {
+		url = strings.TrimSuffix(cfg.BaseURL, "/") + "/chat/completions"
+	}
+	if url == "" {
+		url = apiURL
+	}
+	authorize := opts.Authorize
+	if authorize == nil {
+		authorize = func(ctx context.Context, req *http.Request) error {
+			req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+			return nil
+		}
+	}
+	images := opts.AcceptsImages
+	if images == nil {
+		images = func(model string) bool {
+			meta, ok := opts.Models.Lookup(model)
+			return ok && meta.Vision
+		}
+	}
+	attempts := cfg.MaxAttempts
+	if attempts <= 0 {
+		attempts = defaultMaxAttempts
+	}
+	backoff := opts.RetryBackoff
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+	clock := opts.Clock
+	if clock == nil {
+		clock = timing.New()
+	}
+
 	return &Provider{
 		client:     client,
 		config:     cfg,
@@ -110,35 +290,33 @@ func New(model string, cfg config.ModelConfig, opts Options) (*Provider, error)
 		tools:      make(map[string]Tool),
 		rateLimits: rateLimiter,
 		monitor:    opts.Monitor,
+		toolLoop:   opts.ToolLoop,
+		url:        url,
+		authorize:  authorize,
+		images:     images,
+		models:     opts.Models,
+		attempts:   attempts,
+		backoff:    backoff,
+		clock:      clock,
 	}, nil
 }
 
-// Send sends a prompt to OpenAI and returns the response
-func (p *Provider) Send(ctx context.Context, prompt string, opts *provider.RequestOptions) (*provider.Response, error) {
-	start := time.Now()
-	success := false
-	defer func() {
-		if p.monitor != nil {
-			p.monitor.RecordRequest(success)
-			p.monitor.RecordLatency(time.Since(start).Seconds())
-		}
-	}()
-
-	// Check context and rate limits
+// Send sends a conversation to OpenAI and returns the response. Calls to
+// registered tools are answered and the conversation resent, up to the
+// limits of the provider's tool loop.
+func (p *Provider) Send(ctx context.Context, messages []provider.Message, opts *provider.RequestOptions) (*provider.Response, error) {
+	// Check context
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	default:
 	}
 
-	if err := p.rateLimits.Wait(ctx); err != nil {
-		return nil, err
-	}
-
 	// Build request with options or defaults
 	model := p.model
 	temperature := p.config.Temperature
 	maxTokens := p.config.MaxTokens
+	var schema json.RawMessage
 
 	if opts != nil {
 		if opts.Model != "" {
@@ -150,71 +328,85 @@ func (p *Provider) Send(ctx context.Context, prompt string, opts *provider.Reque
 		if opts.MaxTokens != 0 {
 			maxTokens = opts.MaxTokens
 		}
+		schema = opts.Schema
 	}
 
-	req := map[string]any{
-		"model": model,
-		"messages": []map[string]any{{
-			"role":    "user",
-			"content": prompt,
-		}},
-		"temperature": temperature,
-		"max_tokens":  maxTokens,
+	if hasImages(messages) && !p.images(model) {
+		return nil, &provider.Error{
+			Code:    provider.ErrInvalidInput,
+			Message: fmt.Sprintf("model %s does not accept images", model),
+		}
 	}
 
-	// Add tools if available
-	p.mu.RLock()
-	tools := make([]map[string]any, 0, len(p.tools))
-	for name, t := range p.tools {
-		schema := t.Schema()
-		tools = append(tools, map[string]any{
-			"type": "function",
-			"function": map[string]any{
-				"name":        name,
-				"description": schema.Schema.Description,
-				"parameters":  schema.Schema.Parameters,
-			},
-		})
-	}
+	tools := p.toolDefinitions()
 	if len(tools) > 0 {
-		req["tools"] = tools
+		if meta, ok := p.models.Lookup(model); ok && !meta.Tools {
+			return nil, &provider.Error{
+				Code:    provider.ErrInvalidInput,
+				Message: fmt.Sprintf("model %s does not support tools", model),
+			}
+		}
 	}
-	p.mu.RUnlock()
-
-	// Send request
-	resp, err := p.doRequest(ctx, req)
-	if err != nil {
-		return nil, err
+	send := func(ctx context.Context, messages []provider.Message) (*provider.Response, error) {
+		if err := p.checkContextWindow(model, messages, maxTokens); err != nil {
+			return nil, err
+		}
+		req := map[string]any{
+			"model":       model,
+			"messages":    chatMessages(messages),
+			"temperature": temperature,
+			"max_tokens":  maxTokens,
+		}
+		if len(tools) > 0 {
+			req["tools"] = tools
+		}
+		if len(schema) > 0 {
+			req["response_format"] = map[string]any{
+				"type": "json_schema",
+				"json_schema": map[string]any{
+					"name":   "response",
+					"schema": schema,
+				},
+			}
+		}
+		return p.complete(ctx, req)
 	}
+	return p.toolLoop.Run(ctx, messages, send, p.runTool)
+}
 
-	// Update rate limits and metrics for initial response
-	if err := p.rateLimits.AddTokens(resp.Usage.TotalTokens); err != nil {
-		return nil, err
+// messageOverhead is the tokens the API adds around each message for its
+// role and delimiters
+const messageOverhead = 4
+
+// checkContextWindow fails requests whose estimated prompt and response
+// tokens exceed the model's context window, rather than sending a request
+// bound to be rejected. Models without a known window are not checked.
+func (p *Provider) checkContextWindow(model string, messages []provider.Message, maxTokens int) error {
+	window := p.config.ContextWindow
+	if window <= 0 {
+		meta, ok := p.models.Lookup(model)
+		if !ok || meta.ContextWindow <= 0 {
+			return nil
+		}
+		window = meta.ContextWindow
 	}
 
-	if p.monitor != nil {
-		p.monitor.RecordTokens(
-			resp.Usage.PromptTokens,
-			resp.Usage.CompletionTokens,
-			resp.Usage.TotalTokens,
-		)
+	enc := doccontext.EncodingForModel(model)
+	prompt := 0
+	for _, m := range messages {
+		prompt += messageOverhead + doccontext.CountTokens(m.Content, enc)
+		for _, call := range m.ToolCalls {
+			prompt += doccontext.CountTokens(call.Function.Name+call.Function.Arguments, enc)
+		}
 	}
-
-	// Handle tool calls if present
-	if len(resp.Choices[0].Message.ToolCalls) > 0 {
-		success = true // Mark initial request as successful
-		return p.handleToolCalls(ctx, resp, req)
+	if prompt+maxTokens <= window {
+		return nil
+	}
+	return &provider.Error{
+		Code: provider.ErrInvalidInput,
+		Message: fmt.Sprintf("prompt of about %d tokens plus %d response tokens exceeds the %d-token context window of %s; reference less context, lower max_tokens or use a model with a larger window",
+			prompt, maxTokens, window, model),
 	}
-
-	success = true // Mark request as successful
-	return &provider.Response{
-		Content: resp.Choices[0].Message.Content,
-		Usage: provider.Usage{
-			PromptTokens:     resp.Usage.PromptTokens,
-			CompletionTokens: resp.Usage.CompletionTokens,
-			TotalTokens:      resp.Usage.TotalTokens,
-		},
-	}, nil
 }
 
 // Close implements provider.Provider
@@ -232,30 +424,10 @@ func (p *Provider) RegisterTool(name string, t Tool) {
 	p.tools[name] = t
 }
 
-// handleToolCalls processes tool calls in the response
-func (p *Provider) handleToolCalls(
-	ctx context.Context,
-	resp *Response,
-	req map[string]any,
-) (*provider.Response, error) {
-	start := time.Now()
-	success := false
-	defer func() {
-		if p.monitor != nil {
-			p.monitor.RecordRequest(success)
-			p.monitor.RecordLatency(time.Since(start).Seconds())
-		}
-	}()
-	// Build new request with updated messages and tools
-	newReq := map[string]any{
-		"model":       req["model"],
-		"messages":    req["messages"],
-		"temperature": req["temperature"],
-		"max_tokens":  req["max_tokens"],
-	}
-
-	// Add tools if available
+// toolDefinitions returns the registered tools as request functions
+func (p *Provider) toolDefinitions() []map[string]any {
 	p.mu.RLock()
+	defer p.mu.RUnlock()
 	tools := make([]map[string]any, 0, len(p.tools))
 	for name, t := range p.tools {
 		schema := t.Schema()
@@ -268,55 +440,64 @@ func (p *Provider) handleToolCalls(
 			},
 		})
 	}
-	if len(tools) > 0 {
-		newReq["tools"] = tools
-	}
-	p.mu.RUnlock()
+	return tools
+}
 
-	// Add assistant's message with tool calls
-	messages := newReq["messages"].([]map[string]any)
-	messages = append(messages, map[string]any{
-		"role":       "assistant",
-		"content":    resp.Choices[0].Message.Content,
-		"tool_calls": resp.Choices[0].Message.ToolCalls,
-	})
-
-	// Process each tool call
-	for _, call := range resp.Choices[0].Message.ToolCalls {
-		// Get tool
-		p.mu.RLock()
-		tool, ok := p.tools[call.Function.Name]
-		p.mu.RUnlock()
-		if !ok {
-			return nil, &provider.Error{
-				Code:    provider.ErrInvalidInput,
-				Message: fmt.Sprintf("unknown tool: %s", call.Function.Name),
-			}
+// runTool executes a registered tool for a tool call
+func (p *Provider) runTool(ctx context.Context, call provider.ToolCall) (string, error) {
+	p.mu.RLock()
+	tool, ok := p.tools[call.Function.Name]
+	p.mu.RUnlock()
+	if !ok {
+		return "", &provider.Error{
+			Code:    provider.ErrInvalidInput,
+			Message: fmt.Sprintf("unknown tool: %s", call.Function.Name),
 		}
+	}
 
-		// Execute tool
-		result, err := tool.Execute([]byte(call.Function.Arguments), nil)
-		if err != nil {
-			return nil, &provider.Error{
-				Code:    provider.ErrServerError,
-				Message: fmt.Sprintf("tool execution failed: %v", err),
-			}
+	var result []byte
+	var err error
+	if ct, ok := tool.(ContextTool); ok {
+		result, err = ct.ExecuteContext(ctx, []byte(call.Function.Arguments), nil)
+	} else {
+		result, err = tool.Execute([]byte(call.Function.Arguments), nil)
+	}
+	if err != nil {
+		return "", &provider.Error{
+			Code:    provider.ErrServerError,
+			Message: fmt.Sprintf("tool execution failed: %v", err),
 		}
-
-		// Add tool result
-		messages = append(messages, map[string]any{
-			"role":         "tool",
-			"content":      string(result),
-			"tool_call_id": call.ID,
-		})
 	}
-	newReq["messages"] = messages
+	return string(result), nil
+}
 
-	// Get final response
-	resp, err := p.doRequest(ctx, newReq)
+// complete sends one chat completion request, recording its metrics and
+// token usage
+func (p *Provider) complete(ctx context.Context, req map[string]any) (*provider.Response, error) {
+	start := time.Now()
+	success := false
+	defer func() {
+		if p.monitor != nil {
+			p.monitor.RecordRequest(success)
+			p.monitor.RecordLatency(time.Since(start).Seconds())
+		}
+	}()
+
+	resp, err := p.send(ctx, req)
 	if err != nil {
 		return nil, err
 	}
+	if len(resp.Choices) == 0 {
+		return nil, &provider.Error{
+			Code:    provider.ErrServerError,
+			Message: "response has no choices",
+		}
+	}
+
+	// Some compatible servers leave out the total
+	if resp.Usage.TotalTokens == 0 {
+		resp.Usage.TotalTokens = resp.Usage.PromptTokens + resp.Usage.CompletionTokens
+	}
 
 	// Update rate limits and metrics
 	if err := p.rateLimits.AddTokens(resp.Usage.TotalTokens); err != nil {
@@ -331,15 +512,68 @@ func (p *Provider) handleToolCalls(
 		)
 	}
 
-	success = true // Mark tool call request as successful
-	return &provider.Response{
-		Content: resp.Choices[0].Message.Content,
+	success = true
+	message := resp.Choices[0].Message
+	result := &provider.Response{
+		Content: message.Content,
 		Usage: provider.Usage{
 			PromptTokens:     resp.Usage.PromptTokens,
 			CompletionTokens: resp.Usage.CompletionTokens,
 			TotalTokens:      resp.Usage.TotalTokens,
 		},
-	}, nil
+	}
+	for i, call := range message.ToolCalls {
+		// Some compatible servers leave out call IDs, which the results
+		// sent back must name
+		id := call.ID
+		if id == "" {
+			id = fmt.Sprintf("call_%d", i)
+		}
+		result.ToolCalls = append(result.ToolCalls, provider.ToolCall{
+			ID: id,
+			Function: provider.Function{
+				Name:      call.Function.Name,
+				Arguments: toolArguments(call.Function.Arguments),
+			},
+		})
+	}
+	return result, nil
+}
+
+// send sends a request within the rate limits, retrying rate limited and
+// failed requests up to the configured attempts. Retries wait the delay
+// the server asked for, or an exponential backoff with jitter.
+func (p *Provider) send(ctx context.Context, req map[string]any) (*Response, error) {
+	for attempt := 1; ; attempt++ {
+		if err := p.rateLimits.Wait(ctx); err != nil {
+			return nil, err
+		}
+		resp, err := p.doRequest(ctx, req)
+		if err == nil || attempt >= p.attempts || !provider.Retryable(err) || ctx.Err() != nil {
+			return resp, err
+		}
+
+		select {
+		case <-p.clock.After(p.retryDelay(attempt, err)):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// retryDelay returns the wait before retrying a request that failed with
+// err on the given attempt
+func (p *Provider) retryDelay(attempt int, err error) time.Duration {
+	var perr *provider.Error
+	if errors.As(err, &perr) && perr.RetryAfter > 0 {
+		return perr.RetryAfter
+	}
+	delay := p.backoff << (attempt - 1)
+	if delay > maxRetryBackoff || delay <= 0 {
+		delay = maxRetryBackoff
+	}
+	// Spread retries of concurrent requests over the upper half
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
 }
 
 // doRequest sends a request to the OpenAI API
@@ -354,7 +588,7 @@ func (p *Provider) doRequest(ctx context.Context, req map[string]any) (*Response
 	}
 
 	// Create request
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewReader(body))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.url, bytes.NewReader(body))
 	if err != nil {
 		return nil, &provider.Error{
 			Code:    provider.ErrServerError,
@@ -364,7 +598,18 @@ func (p *Provider) doRequest(ctx context.Context, req map[string]any) (*Response
 
 	// Set headers
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+p.config.APIKey)
+	if p.config.Organization != "" {
+		httpReq.Header.Set("OpenAI-Organization", p.config.Organization)
+	}
+	if p.config.Project != "" {
+		httpReq.Header.Set("OpenAI-Project", p.config.Project)
+	}
+	if err := p.authorize(ctx, httpReq); err != nil {
+		return nil, &provider.Error{
+			Code:    provider.ErrAuthentication,
+			Message: fmt.Sprintf("failed to authorize request: %v", err),
+		}
+	}
 
 	// Send request
 	httpResp, err := p.client.Do(httpReq)
@@ -387,23 +632,9 @@ func (p *Provider) doRequest(ctx context.Context, req map[string]any) (*Response
 
 	// Check status code
 	if httpResp.StatusCode != http.StatusOK {
-		var errResp struct {
-			Error struct {
-				Message string `json:"message"`
-				Type    string `json:"type"`
-				Code    string `json:"code"`
-			} `json:"error"`
-		}
-		if err := json.Unmarshal(respBody, &errResp); err != nil {
-			return nil, &provider.Error{
-				Code:    provider.ErrServerError,
-				Message: fmt.Sprintf("request failed with status %d", httpResp.StatusCode),
-			}
-		}
-		return nil, &provider.Error{
-			Code:    p.mapErrorCode(errResp.Error.Code),
-			Message: errResp.Error.Message,
-		}
+		perr := p.responseError(httpResp.StatusCode, respBody)
+		perr.RetryAfter = retryAfter(httpResp.Header.Get("Retry-After"), p.clock.Now())
+		return nil, perr
 	}
 
 	// Parse response
@@ -418,6 +649,113 @@ func (p *Provider) doRequest(ctx context.Context, req map[string]any) (*Response
 	return &resp, nil
 }
 
+// responseError converts an error response to a provider error. Besides
+// OpenAI's {"error": {...}}, the shapes OpenAI-compatible servers use are
+// understood: an error string, a top-level message or detail, and numeric
+// codes. Without a known code, the status code decides.
+func (p *Provider) responseError(status int, body []byte) *provider.Error {
+	var shape struct {
+		Error   json.RawMessage `json:"error"`
+		Message string          `json:"message"`
+		Detail  any             `json:"detail"`
+		Type    string          `json:"type"`
+		Code    any             `json:"code"`
+	}
+	var message, code, kind string
+	if err := json.Unmarshal(body, &shape); err == nil {
+		message, kind, code = shape.Message, shape.Type, codeString(shape.Code)
+		var nested struct {
+			Message string `json:"message"`
+			Type    string `json:"type"`
+			Code    any    `json:"code"`
+		}
+		var text string
+		switch {
+		case json.Unmarshal(shape.Error, &nested) == nil && nested.Message != "":
+			message, kind, code = nested.Message, nested.Type, codeString(nested.Code)
+		case json.Unmarshal(shape.Error, &text) == nil && text != "":
+			message = text
+		case message == "" && shape.Detail != nil:
+			message = fmt.Sprint(shape.Detail)
+		}
+	}
+	if message == "" {
+		message = fmt.Sprintf("request failed with status %d", status)
+		if text := strings.TrimSpace(string(body)); text != "" && len(text) < 200 && !strings.HasPrefix(text, "{") {
+			message += ": " + text
+		}
+	}
+
+	errCode := p.mapErrorCode(code)
+	if errCode == provider.ErrServerError {
+		errCode = p.mapErrorCode(kind)
+	}
+	if errCode == provider.ErrServerError {
+		errCode = statusErrorCode(status)
+	}
+	return &provider.Error{Code: errCode, Message: message}
+}
+
+// proxyTransport returns a transport sending requests through proxy, or
+// nil to use the default transport, which honors the proxy environment
+// variables
+func proxyTransport(proxy string) (http.RoundTripper, error) {
+	if proxy == "" {
+		return nil, nil
+	}
+	u, err := neturl.Parse(proxy)
+	if err != nil || u.Host == "" {
+		return nil, &provider.Error{
+			Code:    provider.ErrInvalidInput,
+			Message: fmt.Sprintf("invalid proxy URL %q", proxy),
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(u)
+	return transport, nil
+}
+
+// retryAfter parses a Retry-After header, given in seconds or as an HTTP
+// date. It returns 0 when the header is missing or invalid.
+func retryAfter(header string, now time.Time) time.Duration {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// codeString returns an error code sent as a string or a number
+func codeString(code any) string {
+	if code == nil {
+		return ""
+	}
+	return fmt.Sprint(code)
+}
+
+// statusErrorCode maps an HTTP status code to a provider error code
+func statusErrorCode(status int) string {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return provider.ErrAuthentication
+	case status == http.StatusTooManyRequests:
+		return provider.ErrRateLimit
+	case status >= 400 && status < 500:
+		return provider.ErrInvalidInput
+	default:
+		return provider.ErrServerError
+	}
+}
+
 // mapErrorCode maps OpenAI error codes to provider error codes
 func (p *Provider) mapErrorCode(code string) string {
 	switch code {
@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/butter-bot-machines/skylark/pkg/config"
@@ -41,6 +44,7 @@ type mockHTTPClient struct {
 type mockResponse struct {
 	body       string
 	statusCode int
+	header     http.Header
 }
 
 func newMockClient(responses []mockResponse) *http.Client {
@@ -55,10 +59,14 @@ func newMockClient(responses []mockResponse) *http.Client {
 func (m *mockHTTPClient) RoundTrip(req *http.Request) (*http.Response, error) {
 	m.requests = append(m.requests, req)
 	resp := m.responses[len(m.requests)-1]
+	header := resp.header
+	if header == nil {
+		header = make(http.Header)
+	}
 	return &http.Response{
 		StatusCode: resp.statusCode,
 		Body:       io.NopCloser(bytes.NewBufferString(resp.body)),
-		Header:     make(http.Header),
+		Header:     header,
 		Request:    req,
 	}, nil
 }
@@ -80,6 +88,17 @@ func (t *testTool) Execute(args []byte, env map[string]string) ([]byte, error) {
 	return []byte("test result"), nil
 }
 
+// contextTool is a testTool that records the context it ran with
+type contextTool struct {
+	testTool
+	ctx context.Context
+}
+
+func (t *contextTool) ExecuteContext(ctx context.Context, args []byte, env map[string]string) ([]byte, error) {
+	t.ctx = ctx
+	return t.Execute(args, env)
+}
+
 // loadTestData loads a JSON file from testdata directory
 func loadTestData(t *testing.T, path string) string {
 	t.Helper()
@@ -99,6 +118,8 @@ func TestProviderContract(t *testing.T) {
 		name     string
 		setup    func(*Provider)
 		prompt   string
+		messages []provider.Message       // Sent instead of prompt when set
+		opts     *provider.RequestOptions // Defaults to provider.DefaultRequestOptions
 		reqFile  string
 		respFile string
 	}{
@@ -109,6 +130,39 @@ func TestProviderContract(t *testing.T) {
 			reqFile:  "requests/basic.json",
 			respFile: "responses/completion.json",
 		},
+		{
+			name:  "messages",
+			setup: func(*Provider) {},
+			messages: []provider.Message{
+				{Role: provider.RoleSystem, Content: "You help."},
+				{Role: provider.RoleDeveloper, Content: "Answer in one line."},
+				{Role: provider.RoleUser, Content: "Example question"},
+				{Role: provider.RoleAssistant, Content: "Example answer"},
+				{Role: provider.RoleUser, Content: "Test prompt"},
+			},
+			reqFile:  "requests/messages.json",
+			respFile: "responses/completion.json",
+		},
+		{
+			name:  "with image",
+			setup: func(*Provider) {},
+			messages: []provider.Message{
+				{Role: provider.RoleUser, Content: "Describe the diagram", Images: []provider.Image{
+					{MediaType: "image/png", Data: []byte("png")},
+				}},
+			},
+			opts:     &provider.RequestOptions{Model: "gpt-4o", Temperature: 0.7, MaxTokens: 100},
+			reqFile:  "requests/image.json",
+			respFile: "responses/completion.json",
+		},
+		{
+			name:     "structured output",
+			setup:    func(*Provider) {},
+			prompt:   "Test prompt",
+			opts:     &provider.RequestOptions{Model: "gpt-4", Temperature: 0.7, MaxTokens: 100, Schema: []byte(`{"type":"object","properties":{"name":{"type":"string"}}}`)},
+			reqFile:  "requests/json_schema.json",
+			respFile: "responses/completion.json",
+		},
 		{
 			name: "with tools",
 			setup: func(p *Provider) {
@@ -126,7 +180,7 @@ func TestProviderContract(t *testing.T) {
 			},
 			prompt:   "Test prompt",
 			reqFile:  "requests/with_tools.json",
-			respFile: "responses/tool_call.json",
+			respFile: "responses/completion.json",
 		},
 	}
 
@@ -139,8 +193,8 @@ func TestProviderContract(t *testing.T) {
 			var responses []mockResponse
 			if tt.name == "with tools" {
 				responses = []mockResponse{
-					{body: loadTestData(t, tt.respFile), statusCode: http.StatusOK},
-					{body: loadTestData(t, tt.respFile), statusCode: http.StatusOK}, // Use same response for tool completion
+					{body: loadTestData(t, "responses/tool_call.json"), statusCode: http.StatusOK},
+					{body: loadTestData(t, tt.respFile), statusCode: http.StatusOK}, // Final response after the tool call
 				}
 			} else {
 				responses = []mockResponse{
@@ -173,7 +227,15 @@ func TestProviderContract(t *testing.T) {
 			tt.setup(p)
 
 			// Send prompt with default options
-			resp, err := p.Send(context.Background(), tt.prompt, provider.DefaultRequestOptions)
+			messages := tt.messages
+			if messages == nil {
+				messages = provider.Prompt(tt.prompt)
+			}
+			opts := tt.opts
+			if opts == nil {
+				opts = provider.DefaultRequestOptions
+			}
+			resp, err := p.Send(context.Background(), messages, opts)
 			if err != nil {
 				t.Fatalf("Send failed: %v", err)
 			}
@@ -206,6 +268,21 @@ func TestProviderContract(t *testing.T) {
 				t.Errorf("\nExpected request: %s\nActual request: %s", expectedReq, actualJSON)
 			}
 
+			// The tool result goes back as a tool message answering the call
+			if tt.name == "with tools" {
+				var followUp, expectedFollowUp map[string]any
+				if err := json.NewDecoder(mock.requests[1].Body).Decode(&followUp); err != nil {
+					t.Fatalf("Failed to decode request body: %v", err)
+				}
+				if err := json.Unmarshal([]byte(loadTestData(t, "requests/tool_result.json")), &expectedFollowUp); err != nil {
+					t.Fatalf("Failed to decode expected request: %v", err)
+				}
+				if !jsonEqual(expectedFollowUp, followUp) {
+					actualJSON, _ := json.Marshal(followUp)
+					t.Errorf("\nExpected tool result request: %s\nActual request: %s", loadTestData(t, "requests/tool_result.json"), actualJSON)
+				}
+			}
+
 			// Verify response parsing
 			expectedResp := loadTestData(t, tt.respFile)
 			var expectedRespMap map[string]any
@@ -213,6 +290,17 @@ func TestProviderContract(t *testing.T) {
 				t.Fatalf("Failed to decode expected response: %v", err)
 			}
 
+			// The usage covers both requests of the tool call, whose
+			// responses report the same counts
+			usage := resp.Usage
+			if tt.name == "with tools" {
+				usage = provider.Usage{
+					PromptTokens:     usage.PromptTokens / 2,
+					CompletionTokens: usage.CompletionTokens / 2,
+					TotalTokens:      usage.TotalTokens / 2,
+				}
+			}
+
 			// Convert provider.Response to map for comparison
 			actualResp := map[string]any{
 				"finish_reason": expectedRespMap["finish_reason"],
@@ -225,9 +313,9 @@ func TestProviderContract(t *testing.T) {
 					},
 				},
 				"usage": map[string]any{
-					"prompt_tokens":     resp.Usage.PromptTokens,
-					"completion_tokens": resp.Usage.CompletionTokens,
-					"total_tokens":      resp.Usage.TotalTokens,
+					"prompt_tokens":     usage.PromptTokens,
+					"completion_tokens": usage.CompletionTokens,
+					"total_tokens":      usage.TotalTokens,
 					"prompt_tokens_details": map[string]any{
 						"cached_tokens": 0,
 						"audio_tokens":  0,
@@ -241,21 +329,6 @@ func TestProviderContract(t *testing.T) {
 				},
 			}
 
-			// Add tool calls if present
-			if tt.name == "with tools" {
-				message := actualResp["choices"].([]any)[0].(map[string]any)["message"].(map[string]any)
-				message["tool_calls"] = []map[string]any{
-					{
-						"id":   "call_123",
-						"type": "function",
-						"function": map[string]any{
-							"name":      "test_tool",
-							"arguments": `{"input":"test"}`,
-						},
-					},
-				}
-			}
-
 			// Normalize and compare JSON
 			expectedJSON, _ := json.Marshal(expectedRespMap)
 			actualJSON, _ := json.Marshal(actualResp)
@@ -273,6 +346,219 @@ func TestProviderContract(t *testing.T) {
 	}
 }
 
+func TestProviderImagesNeedVisionModel(t *testing.T) {
+	mock := &mockHTTPClient{}
+	p, err := New("gpt-4", config.ModelConfig{APIKey: "test-key"}, Options{
+		HTTPClient:  &http.Client{Transport: mock},
+		RateLimiter: &mockRateLimiter{},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+
+	messages := []provider.Message{{Role: provider.RoleUser, Content: "Describe", Images: []provider.Image{
+		{MediaType: "image/png", Data: []byte("png")},
+	}}}
+	_, err = p.Send(context.Background(), messages, &provider.RequestOptions{Model: "gpt-3.5-turbo"})
+	var perr *provider.Error
+	if !errors.As(err, &perr) || perr.Code != provider.ErrInvalidInput {
+		t.Errorf("Expected an invalid input error, got %v", err)
+	}
+	if len(mock.requests) != 0 {
+		t.Errorf("Expected no request, got %d", len(mock.requests))
+	}
+
+	for model, want := range map[string]bool{
+		"gpt-4o-mini":         true,
+		"gpt-4-turbo":         true,
+		"gpt-4-turbo-preview": false,
+		"o1-mini":             false,
+		"gpt-4":               false,
+	} {
+		if got := acceptsImages(model); got != want {
+			t.Errorf("acceptsImages(%q) = %v, want %v", model, got, want)
+		}
+	}
+}
+
+func TestProviderToolsNeedToolModel(t *testing.T) {
+	mock := &mockHTTPClient{responses: []mockResponse{
+		{body: `{"choices": [{"message": {"content": "ok"}}]}`, statusCode: http.StatusOK},
+	}}
+	p, err := New("o1-mini", config.ModelConfig{APIKey: "test-key"}, Options{
+		HTTPClient:  &http.Client{Transport: mock},
+		RateLimiter: &mockRateLimiter{},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	p.RegisterTool("test_tool", &testTool{})
+
+	_, err = p.Send(context.Background(), provider.Prompt("hi"), nil)
+	var perr *provider.Error
+	if !errors.As(err, &perr) || perr.Code != provider.ErrInvalidInput || !strings.Contains(perr.Message, "tools") {
+		t.Errorf("Expected a tools error, got %v", err)
+	}
+	if len(mock.requests) != 0 {
+		t.Errorf("Expected no request, got %d", len(mock.requests))
+	}
+
+	// Models without metadata are assumed to take tools
+	if _, err := p.Send(context.Background(), provider.Prompt("hi"), &provider.RequestOptions{Model: "unknown-model"}); err != nil {
+		t.Errorf("Expected an unknown model to be sent tools, got %v", err)
+	}
+}
+
+func TestProviderChecksContextWindow(t *testing.T) {
+	long := strings.Repeat("note ", 6000) // About 6000 tokens
+	success := mockResponse{body: `{"choices": [{"message": {"content": "ok"}}]}`, statusCode: http.StatusOK}
+
+	tests := []struct {
+		name      string
+		model     string
+		cfg       config.ModelConfig
+		maxTokens int
+		wantSent  bool
+	}{
+		{"fits", "gpt-4", config.ModelConfig{}, 1000, true},
+		{"response does not fit", "gpt-4", config.ModelConfig{}, 4000, false},
+		{"larger window", "gpt-4-turbo", config.ModelConfig{}, 4000, true},
+		{"configured window", "gpt-4-turbo", config.ModelConfig{ContextWindow: 4096}, 100, false},
+		{"unknown model", "local-llama", config.ModelConfig{}, 4000, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockHTTPClient{responses: []mockResponse{success}}
+			tt.cfg.APIKey = "test-key"
+			p, err := New(tt.model, tt.cfg, Options{
+				HTTPClient:  &http.Client{Transport: mock},
+				RateLimiter: &mockRateLimiter{},
+			})
+			if err != nil {
+				t.Fatalf("Failed to create provider: %v", err)
+			}
+
+			_, err = p.Send(context.Background(), provider.Prompt(long), &provider.RequestOptions{MaxTokens: tt.maxTokens})
+			if sent := len(mock.requests) == 1; sent != tt.wantSent {
+				t.Errorf("Expected request sent = %v, got %v (%v)", tt.wantSent, sent, err)
+			}
+			if !tt.wantSent {
+				var perr *provider.Error
+				if !errors.As(err, &perr) || perr.Code != provider.ErrInvalidInput || !strings.Contains(perr.Message, "context window") {
+					t.Errorf("Expected a context window error, got %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestProviderGatewaySettings(t *testing.T) {
+	// The proxy receives requests for the gateway and answers them itself
+	var got *http.Request
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		w.Write([]byte(`{"choices": [{"message": {"content": "ok"}}]}`))
+	}))
+	defer proxy.Close()
+
+	p, err := New("gpt-4", config.ModelConfig{
+		APIKey:       "test-key",
+		BaseURL:      "http://gateway.example.com/openai/v1/",
+		Organization: "org-123",
+		Project:      "proj-456",
+		Proxy:        proxy.URL,
+	}, Options{RateLimiter: &mockRateLimiter{}})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	if _, err := p.Send(context.Background(), provider.Prompt("test"), nil); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	if got == nil {
+		t.Fatal("Expected the request to go through the proxy")
+	}
+	if url := got.URL.String(); url != "http://gateway.example.com/openai/v1/chat/completions" {
+		t.Errorf("Expected the gateway's completions URL, got %s", url)
+	}
+	for header, want := range map[string]string{
+		"OpenAI-Organization": "org-123",
+		"OpenAI-Project":      "proj-456",
+		"Authorization":       "Bearer test-key",
+	} {
+		if v := got.Header.Get(header); v != want {
+			t.Errorf("Expected %s %q, got %q", header, want, v)
+		}
+	}
+
+	if _, err := New("gpt-4", config.ModelConfig{APIKey: "test-key", Proxy: "::bad"}, Options{}); err == nil {
+		t.Error("Expected an error for an invalid proxy URL")
+	}
+}
+
+func TestResponseError(t *testing.T) {
+	p := &Provider{}
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		wantCode string
+		wantMsg  string
+	}{
+		{
+			name:     "openai",
+			status:   http.StatusTooManyRequests,
+			body:     `{"error": {"message": "slow down", "type": "requests", "code": "rate_limit_exceeded"}}`,
+			wantCode: provider.ErrRateLimit,
+			wantMsg:  "slow down",
+		},
+		{
+			name:     "type without code",
+			status:   http.StatusBadRequest,
+			body:     `{"error": {"message": "bad field", "type": "invalid_request_error", "code": null}}`,
+			wantCode: provider.ErrInvalidInput,
+			wantMsg:  "bad field",
+		},
+		{
+			name:     "vllm",
+			status:   http.StatusNotFound,
+			body:     `{"object": "error", "message": "The model llama does not exist.", "type": "NotFoundError", "code": 404}`,
+			wantCode: provider.ErrInvalidInput,
+			wantMsg:  "The model llama does not exist.",
+		},
+		{
+			name:     "error string",
+			status:   http.StatusUnauthorized,
+			body:     `{"error": "invalid api key"}`,
+			wantCode: provider.ErrAuthentication,
+			wantMsg:  "invalid api key",
+		},
+		{
+			name:     "detail",
+			status:   http.StatusUnprocessableEntity,
+			body:     `{"detail": "messages: field required"}`,
+			wantCode: provider.ErrInvalidInput,
+			wantMsg:  "messages: field required",
+		},
+		{
+			name:     "plain text",
+			status:   http.StatusBadGateway,
+			body:     "upstream unavailable",
+			wantCode: provider.ErrServerError,
+			wantMsg:  "request failed with status 502: upstream unavailable",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.responseError(tt.status, []byte(tt.body))
+			if err.Code != tt.wantCode || err.Message != tt.wantMsg {
+				t.Errorf("Expected %s %q, got %s %q", tt.wantCode, tt.wantMsg, err.Code, err.Message)
+			}
+		})
+	}
+}
+
 // Helper functions
 
 func jsonEqual(a, b map[string]any) bool {
@@ -313,3 +599,31 @@ func valueEqual(a, b any) bool {
 		return a == b
 	}
 }
+
+func TestRunToolContext(t *testing.T) {
+	p, err := New("gpt-4", config.ModelConfig{APIKey: "test-key"}, Options{
+		HTTPClient:  &http.Client{Transport: &mockHTTPClient{}},
+		RateLimiter: &mockRateLimiter{},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	plain, withContext := &testTool{}, &contextTool{}
+	p.RegisterTool("plain", plain)
+	p.RegisterTool("context", withContext)
+
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "request")
+	for _, name := range []string{"plain", "context"} {
+		result, err := p.runTool(ctx, provider.ToolCall{Function: provider.Function{Name: name, Arguments: "{}"}})
+		if err != nil || result != "test result" {
+			t.Errorf("%s: expected the tool result, got %q, %v", name, result, err)
+		}
+	}
+	if !plain.executed {
+		t.Error("Expected the plain tool to run")
+	}
+	if withContext.ctx == nil || withContext.ctx.Value(key{}) != "request" {
+		t.Error("Expected the context tool to run with the request context")
+	}
+}
@@ -0,0 +1,143 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+	"github.com/butter-bot-machines/skylark/pkg/timing"
+)
+
+// waitRecorder is a clock whose waits return at once, recording their
+// durations
+type waitRecorder struct {
+	timing.Clock
+	waits []time.Duration
+}
+
+func (c *waitRecorder) After(d time.Duration) <-chan time.Time {
+	c.waits = append(c.waits, d)
+	ch := make(chan time.Time, 1)
+	ch <- c.Now()
+	return ch
+}
+
+func TestProviderRetries(t *testing.T) {
+	const success = `{"choices": [{"message": {"content": "ok"}}], "usage": {"total_tokens": 3}}`
+	rateLimited := mockResponse{
+		body:       `{"error": {"message": "slow down", "code": "rate_limit_exceeded"}}`,
+		statusCode: http.StatusTooManyRequests,
+		header:     http.Header{"Retry-After": []string{"7"}},
+	}
+	unavailable := mockResponse{body: `{"error": {"message": "overloaded"}}`, statusCode: http.StatusServiceUnavailable}
+	invalid := mockResponse{body: `{"error": {"message": "bad", "type": "invalid_request_error"}}`, statusCode: http.StatusBadRequest}
+
+	tests := []struct {
+		name         string
+		maxAttempts  int
+		responses    []mockResponse
+		wantRequests int
+		wantCode     string // Empty when the request succeeds
+		check        func(t *testing.T, waits []time.Duration)
+	}{
+		{
+			name:         "retry after header",
+			responses:    []mockResponse{rateLimited, {body: success, statusCode: http.StatusOK}},
+			wantRequests: 2,
+			check: func(t *testing.T, waits []time.Duration) {
+				if len(waits) != 1 || waits[0] != 7*time.Second {
+					t.Errorf("Expected a 7s wait, got %v", waits)
+				}
+			},
+		},
+		{
+			name:         "exponential backoff with jitter",
+			responses:    []mockResponse{unavailable, unavailable, {body: success, statusCode: http.StatusOK}},
+			wantRequests: 3,
+			check: func(t *testing.T, waits []time.Duration) {
+				if len(waits) != 2 {
+					t.Fatalf("Expected 2 waits, got %v", waits)
+				}
+				for i, base := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond} {
+					if waits[i] < base/2 || waits[i] > base {
+						t.Errorf("Expected wait %d between %v and %v, got %v", i+1, base/2, base, waits[i])
+					}
+				}
+			},
+		},
+		{
+			name:         "gives up after max attempts",
+			maxAttempts:  2,
+			responses:    []mockResponse{unavailable, unavailable},
+			wantRequests: 2,
+			wantCode:     provider.ErrServerError,
+		},
+		{
+			name:         "fatal errors are not retried",
+			responses:    []mockResponse{invalid},
+			wantRequests: 1,
+			wantCode:     provider.ErrInvalidInput,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockHTTPClient{responses: tt.responses}
+			clock := &waitRecorder{Clock: timing.New()}
+			p, err := New("gpt-4", config.ModelConfig{APIKey: "test-key", MaxAttempts: tt.maxAttempts}, Options{
+				HTTPClient:   &http.Client{Transport: mock},
+				RateLimiter:  &mockRateLimiter{},
+				RetryBackoff: 100 * time.Millisecond,
+				Clock:        clock,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create provider: %v", err)
+			}
+
+			resp, err := p.Send(context.Background(), provider.Prompt("test"), nil)
+			if len(mock.requests) != tt.wantRequests {
+				t.Errorf("Expected %d requests, got %d", tt.wantRequests, len(mock.requests))
+			}
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("Send failed: %v", err)
+				}
+				if resp.Content != "ok" {
+					t.Errorf("Expected content ok, got %q", resp.Content)
+				}
+			} else {
+				var perr *provider.Error
+				if !errors.As(err, &perr) || perr.Code != tt.wantCode {
+					t.Errorf("Expected %s error, got %v", tt.wantCode, err)
+				}
+			}
+			if tt.check != nil {
+				tt.check(t, clock.waits)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", 0},
+		{"30", 30 * time.Second},
+		{"-1", 0},
+		{"soon", 0},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+	}
+	for _, tt := range tests {
+		if got := retryAfter(tt.header, now); got != tt.want {
+			t.Errorf("Expected %v for %q, got %v", tt.want, tt.header, got)
+		}
+	}
+}
@@ -1,12 +1,22 @@
 package provider
 
-import "context"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
 
 // RequestOptions contains configuration options for a single request
 type RequestOptions struct {
 	Model       string  // Model to use for this request
 	Temperature float64 // Temperature setting for this request
 	MaxTokens   int     // Max tokens for this request
+
+	// Schema, when set, asks for a JSON response conforming to this JSON
+	// schema. Providers without structured output ignore it. Left out of
+	// JSON when empty, so recorded requests keep their hash.
+	Schema json.RawMessage `json:",omitempty"`
 }
 
 // DefaultRequestOptions provides commonly used request settings for testing
@@ -16,12 +26,43 @@ var DefaultRequestOptions = &RequestOptions{
 	MaxTokens:   100,
 }
 
-// Provider defines the interface for model providers
+// Provider defines the interface for model providers. Send takes the
+// whole conversation, so a provider can build its native request from the
+// roles of the messages.
 type Provider interface {
-	Send(ctx context.Context, prompt string, opts *RequestOptions) (*Response, error)
+	Send(ctx context.Context, messages []Message, opts *RequestOptions) (*Response, error)
 	Close() error
 }
 
+// Roles of the messages in a conversation
+const (
+	RoleSystem    = "system"    // Instructions that define the assistant
+	RoleDeveloper = "developer" // Instructions from the assistant's author
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool" // The result of a tool call
+)
+
+// Message is one role-tagged message of a conversation
+type Message struct {
+	Role       string
+	Content    string
+	ToolCalls  []ToolCall // Tools an assistant message asks to call
+	ToolCallID string     // Call a tool message answers
+	Images     []Image    // Images shown with a user message
+}
+
+// Image is an image sent with a message to models that accept images
+type Image struct {
+	MediaType string // MIME type, e.g. image/png
+	Data      []byte
+}
+
+// Prompt returns a conversation of a single user message
+func Prompt(text string) []Message {
+	return []Message{{Role: RoleUser, Content: text}}
+}
+
 // Response represents a model's response
 type Response struct {
 	Content   string
@@ -44,15 +85,16 @@ type Function struct {
 
 // Usage represents token usage information
 type Usage struct {
-	PromptTokens     int
-	CompletionTokens int
-	TotalTokens      int
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
 }
 
 // Error represents a provider error
 type Error struct {
-	Code    string
-	Message string
+	Code       string
+	Message    string
+	RetryAfter time.Duration // Wait the server asked for before retrying (0 = none given)
 }
 
 func (e *Error) Error() string {
@@ -66,8 +108,25 @@ const (
 	ErrServerError    = "server_error"
 	ErrTimeout        = "timeout"
 	ErrAuthentication = "authentication_error"
+	ErrToolLimit      = "tool_limit_exceeded"
 )
 
+// Retryable reports whether a request that failed with err may succeed
+// when sent again: rate limits, server errors and timeouts are transient,
+// while invalid input, authentication and tool limit errors are not.
+// Errors other than *Error are not retried.
+func Retryable(err error) bool {
+	var perr *Error
+	if !errors.As(err, &perr) {
+		return false
+	}
+	switch perr.Code {
+	case ErrRateLimit, ErrServerError, ErrTimeout:
+		return true
+	}
+	return false
+}
+
 // Factory creates a new provider instance
 type Factory interface {
 	Create() (Provider, error)
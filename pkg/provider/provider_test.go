@@ -3,6 +3,7 @@ package provider
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
 	"time"
 )
@@ -13,7 +14,7 @@ type mockProvider struct {
 	delay    time.Duration
 }
 
-func (m *mockProvider) Send(ctx context.Context, prompt string, opts *RequestOptions) (*Response, error) {
+func (m *mockProvider) Send(ctx context.Context, messages []Message, opts *RequestOptions) (*Response, error) {
 	if m.delay > 0 {
 		select {
 		case <-ctx.Done():
@@ -78,7 +79,7 @@ func TestProviderInterface(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			ctx := context.Background()
-			got, err := tt.provider.Send(ctx, tt.prompt, DefaultRequestOptions)
+			got, err := tt.provider.Send(ctx, Prompt(tt.prompt), DefaultRequestOptions)
 
 			if tt.wantErr != nil {
 				if err == nil {
@@ -114,7 +115,7 @@ func TestContextCancellation(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel() // Cancel immediately
 
-	_, err := provider.Send(ctx, "test", DefaultRequestOptions)
+	_, err := provider.Send(ctx, Prompt("test"), DefaultRequestOptions)
 	if !errors.Is(err, context.Canceled) {
 		t.Errorf("expected context.Canceled error, got %v", err)
 	}
@@ -129,8 +130,45 @@ func TestContextTimeout(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
 	defer cancel()
 
-	_, err := provider.Send(ctx, "test", DefaultRequestOptions)
+	_, err := provider.Send(ctx, Prompt("test"), DefaultRequestOptions)
 	if !errors.Is(err, context.DeadlineExceeded) {
 		t.Errorf("expected context.DeadlineExceeded error, got %v", err)
 	}
 }
+
+func TestUsageMeter(t *testing.T) {
+	// Without a meter, usage is dropped
+	RecordUsage(context.Background(), Usage{TotalTokens: 1})
+
+	meter := &UsageMeter{}
+	ctx := ContextWithUsageMeter(context.Background(), meter)
+	RecordUsage(ctx, Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15})
+	RecordUsage(ctx, Usage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5})
+
+	expected := Usage{PromptTokens: 13, CompletionTokens: 7, TotalTokens: 20}
+	if got := meter.Usage(); got != expected {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&Error{Code: ErrRateLimit}, true},
+		{&Error{Code: ErrServerError}, true},
+		{&Error{Code: ErrTimeout}, true},
+		{&Error{Code: ErrInvalidInput}, false},
+		{&Error{Code: ErrAuthentication}, false},
+		{&Error{Code: ErrToolLimit}, false},
+		{fmt.Errorf("send: %w", &Error{Code: ErrRateLimit}), true},
+		{errors.New("plain"), false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := Retryable(tt.err); got != tt.want {
+			t.Errorf("Expected Retryable(%v) = %v, got %v", tt.err, tt.want, got)
+		}
+	}
+}
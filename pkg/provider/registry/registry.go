@@ -31,6 +31,16 @@ func (r *Registry) Register(name string, factory Factory) {
 	r.factories[name] = factory
 }
 
+// Wrap replaces each registered factory with wrap(name, factory), e.g. to
+// record or replay the providers it creates
+func (r *Registry) Wrap(wrap func(name string, factory Factory) Factory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, factory := range r.factories {
+		r.factories[name] = wrap(name, factory)
+	}
+}
+
 // CreateForModel creates a provider for a model specification
 // Model spec can be either:
 // - "model-name" (uses default provider)
@@ -11,7 +11,7 @@ type mockProvider struct {
 	model string
 }
 
-func (m *mockProvider) Send(ctx context.Context, prompt string, opts *provider.RequestOptions) (*provider.Response, error) {
+func (m *mockProvider) Send(ctx context.Context, messages []provider.Message, opts *provider.RequestOptions) (*provider.Response, error) {
 	return &provider.Response{Content: "mock response"}, nil
 }
 
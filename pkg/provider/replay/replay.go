@@ -0,0 +1,160 @@
+// Package replay records the responses of a provider to cassettes and
+// answers later requests from them, for deterministic tests and for demos
+// without API keys.
+package replay
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/fs/osfs"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+	"github.com/butter-bot-machines/skylark/pkg/provider/registry"
+)
+
+// Dir is the directory holding cassettes, relative to the configuration
+// directory
+const Dir = "cassettes"
+
+// ErrNoCassette is returned in replay mode for requests that were never
+// recorded
+var ErrNoCassette = errors.New("no recorded response")
+
+// Cassette is a recorded response, stored as <hash>.json
+type Cassette struct {
+	Provider  string              `json:"provider"`
+	Model     string              `json:"model"`
+	Content   string              `json:"content"`
+	Usage     provider.Usage      `json:"usage"`
+	ToolCalls []provider.ToolCall `json:"tool_calls,omitempty"`
+}
+
+// Provider implements provider.Provider by recording or replaying the
+// responses of another provider
+type Provider struct {
+	inner provider.Provider // nil when replaying
+	dir   string
+	name  string // Provider name, part of the request hash
+	model string
+	mode  config.ProviderMode
+}
+
+// New creates a provider for model of the named provider. In record mode
+// requests are sent to inner and the responses saved in dir; in replay
+// mode they are answered from dir and inner may be nil.
+func New(inner provider.Provider, dir, name, model string, mode config.ProviderMode) *Provider {
+	return &Provider{inner: inner, dir: dir, name: name, model: model, mode: mode}
+}
+
+// Wrap returns a factory creating replay providers in dir for the
+// providers of factory. Replay mode never calls factory, so providers
+// without credentials can be replayed. Live mode returns factory as is.
+func Wrap(dir string, mode config.ProviderMode) func(string, registry.Factory) registry.Factory {
+	return func(name string, factory registry.Factory) registry.Factory {
+		switch mode {
+		case config.ProviderReplay:
+			return func(model string) (provider.Provider, error) {
+				return New(nil, dir, name, model, mode), nil
+			}
+		case config.ProviderRecord:
+			return func(model string) (provider.Provider, error) {
+				inner, err := factory(model)
+				if err != nil {
+					return nil, err
+				}
+				return New(inner, dir, name, model, mode), nil
+			}
+		}
+		return factory
+	}
+}
+
+// Send implements provider.Provider
+func (p *Provider) Send(ctx context.Context, messages []provider.Message, opts *provider.RequestOptions) (*provider.Response, error) {
+	hash, err := p.hash(messages, opts)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(p.dir, hash+".json")
+
+	if p.mode == config.ProviderReplay {
+		c, err := load(path)
+		if errors.Is(err, iofs.ErrNotExist) {
+			return nil, fmt.Errorf("%w for %s:%s (%s)", ErrNoCassette, p.name, p.model, hash)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &provider.Response{Content: c.Content, Usage: c.Usage, ToolCalls: c.ToolCalls}, nil
+	}
+
+	resp, err := p.inner.Send(ctx, messages, opts)
+	if err != nil || resp.Error != nil {
+		return resp, err
+	}
+	c := Cassette{Provider: p.name, Model: p.model, Content: resp.Content, Usage: resp.Usage, ToolCalls: resp.ToolCalls}
+	if err := save(path, c); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Close implements provider.Provider
+func (p *Provider) Close() error {
+	if p.inner == nil {
+		return nil
+	}
+	return p.inner.Close()
+}
+
+// hash identifies a request by the provider, model, options and
+// conversation
+func (p *Provider) hash(messages []provider.Message, opts *provider.RequestOptions) (string, error) {
+	data, err := json.Marshal(struct {
+		Provider string
+		Model    string
+		Options  *provider.RequestOptions
+		Messages []provider.Message
+	}{p.name, p.model, opts, messages})
+	if err != nil {
+		return "", fmt.Errorf("failed to hash request: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// load reads the cassette at path
+func load(path string) (Cassette, error) {
+	var c Cassette
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// save writes c to path
+func save(path string, c Cassette) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create cassette directory: %w", err)
+	}
+	if err := osfs.WriteFile(path, data, 0644, false); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
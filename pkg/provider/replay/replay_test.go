@@ -0,0 +1,119 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+	"github.com/butter-bot-machines/skylark/pkg/provider/registry"
+)
+
+type countingProvider struct {
+	calls int
+}
+
+func (p *countingProvider) Send(ctx context.Context, messages []provider.Message, opts *provider.RequestOptions) (*provider.Response, error) {
+	p.calls++
+	return &provider.Response{
+		Content: "answer to " + messages[len(messages)-1].Content,
+		Usage:   provider.Usage{PromptTokens: 3, CompletionTokens: 4, TotalTokens: 7},
+	}, nil
+}
+
+func (p *countingProvider) Close() error {
+	return nil
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	inner := &countingProvider{}
+
+	recorder := New(inner, dir, "openai", "gpt-4", config.ProviderRecord)
+	recorded, err := recorder.Send(ctx, provider.Prompt("hello"), provider.DefaultRequestOptions)
+	if err != nil {
+		t.Fatalf("Failed to record: %v", err)
+	}
+	if inner.calls != 1 {
+		t.Errorf("Expected 1 call to the provider, got %d", inner.calls)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Expected 1 cassette, got %d (%v)", len(entries), err)
+	}
+
+	player := New(nil, dir, "openai", "gpt-4", config.ProviderReplay)
+	replayed, err := player.Send(ctx, provider.Prompt("hello"), provider.DefaultRequestOptions)
+	if err != nil {
+		t.Fatalf("Failed to replay: %v", err)
+	}
+	if replayed.Content != recorded.Content {
+		t.Errorf("Expected content %q, got %q", recorded.Content, replayed.Content)
+	}
+	if replayed.Usage != recorded.Usage {
+		t.Errorf("Expected usage %+v, got %+v", recorded.Usage, replayed.Usage)
+	}
+
+	// Different requests miss
+	misses := []struct {
+		name     string
+		provider *Provider
+		prompt   string
+	}{
+		{"other prompt", player, "goodbye"},
+		{"other model", New(nil, dir, "openai", "gpt-3.5-turbo", config.ProviderReplay), "hello"},
+		{"other provider", New(nil, dir, "azure-openai", "gpt-4", config.ProviderReplay), "hello"},
+	}
+	for _, tt := range misses {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.provider.Send(ctx, provider.Prompt(tt.prompt), provider.DefaultRequestOptions)
+			if !errors.Is(err, ErrNoCassette) {
+				t.Errorf("Expected ErrNoCassette, got %v", err)
+			}
+		})
+	}
+}
+
+func TestWrap(t *testing.T) {
+	dir := t.TempDir()
+	inner := &countingProvider{}
+	created := 0
+	factory := func(model string) (provider.Provider, error) {
+		created++
+		return inner, nil
+	}
+
+	tests := []struct {
+		mode        config.ProviderMode
+		wantCreated int
+		wantCalls   int
+	}{
+		{config.ProviderLive, 1, 1},
+		{config.ProviderRecord, 2, 2},
+		{config.ProviderReplay, 2, 2}, // Answered from the recording
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			r := registry.New()
+			r.Register("openai", factory)
+			r.Wrap(Wrap(dir, tt.mode))
+
+			p, err := r.CreateForModel("gpt-4", "openai")
+			if err != nil {
+				t.Fatalf("Failed to create provider: %v", err)
+			}
+			if _, err := p.Send(context.Background(), provider.Prompt("hello"), nil); err != nil {
+				t.Fatalf("Failed to send: %v", err)
+			}
+			if created != tt.wantCreated {
+				t.Errorf("Expected %d providers created, got %d", tt.wantCreated, created)
+			}
+			if inner.calls != tt.wantCalls {
+				t.Errorf("Expected %d calls, got %d", tt.wantCalls, inner.calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// DefaultMaxToolRounds is the number of tool call rounds a ToolLoop allows
+// when MaxRounds is not set
+const DefaultMaxToolRounds = 5
+
+// SendFunc sends a conversation and returns the model's response
+type SendFunc func(ctx context.Context, messages []Message) (*Response, error)
+
+// ToolFunc runs a tool call and returns its result. It may be called for
+// several calls at once.
+type ToolFunc func(ctx context.Context, call ToolCall) (string, error)
+
+// ToolLoop answers a model's tool calls until it responds without any,
+// guarding against models that keep calling tools
+type ToolLoop struct {
+	MaxRounds   int // Rounds of tool calls answered (0 = DefaultMaxToolRounds)
+	MaxTokens   int // Tokens all requests of the loop may use together (0 = unlimited)
+	MaxParallel int // Calls of a round run at once (0 = all of them)
+}
+
+// Run sends messages and, while the response calls tools, appends the
+// calls and their results to the conversation and sends it again. The
+// final response carries the usage of all requests. A response with an
+// Error is returned as is. The calls of a round run concurrently and
+// their results follow the calls in the order the model made them. Errors
+// from send and runTool are returned unchanged; when several calls fail,
+// the error of the first is returned.
+func (l ToolLoop) Run(ctx context.Context, messages []Message, send SendFunc, runTool ToolFunc) (*Response, error) {
+	maxRounds := l.MaxRounds
+	if maxRounds <= 0 {
+		maxRounds = DefaultMaxToolRounds
+	}
+
+	var usage Usage
+	for round := 0; ; round++ {
+		resp, err := send(ctx, messages)
+		if err != nil {
+			return nil, err
+		}
+		usage.PromptTokens += resp.Usage.PromptTokens
+		usage.CompletionTokens += resp.Usage.CompletionTokens
+		usage.TotalTokens += resp.Usage.TotalTokens
+		resp.Usage = usage
+
+		if resp.Error != nil || len(resp.ToolCalls) == 0 {
+			return resp, nil
+		}
+		if round >= maxRounds {
+			return nil, &Error{
+				Code:    ErrToolLimit,
+				Message: fmt.Sprintf("model still calling tools after %d rounds", maxRounds),
+			}
+		}
+		if l.MaxTokens > 0 && usage.TotalTokens >= l.MaxTokens {
+			return nil, &Error{
+				Code:    ErrToolLimit,
+				Message: fmt.Sprintf("tool calls used %d tokens, over the budget of %d", usage.TotalTokens, l.MaxTokens),
+			}
+		}
+
+		// Answer each call with a tool message after the call
+		messages = append(messages[:len(messages):len(messages)], Message{
+			Role:      RoleAssistant,
+			Content:   resp.Content,
+			ToolCalls: resp.ToolCalls,
+		})
+		results, err := l.runCalls(ctx, resp.ToolCalls, runTool)
+		if err != nil {
+			return nil, err
+		}
+		for i, call := range resp.ToolCalls {
+			messages = append(messages, Message{
+				Role:       RoleTool,
+				Content:    results[i],
+				ToolCallID: call.ID,
+			})
+		}
+	}
+}
+
+// runCalls runs calls concurrently, at most MaxParallel at a time, and
+// returns their results in call order
+func (l ToolLoop) runCalls(ctx context.Context, calls []ToolCall, runTool ToolFunc) ([]string, error) {
+	parallel := l.MaxParallel
+	if parallel <= 0 || parallel > len(calls) {
+		parallel = len(calls)
+	}
+
+	results := make([]string, len(calls))
+	errs := make([]error, len(calls))
+	slots := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, call := range calls {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(i int, call ToolCall) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			results[i], errs[i] = runTool(ctx, call)
+		}(i, call)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,221 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestToolLoop(t *testing.T) {
+	call := func(id string) *Response {
+		return &Response{
+			ToolCalls: []ToolCall{{ID: id, Function: Function{Name: "echo", Arguments: `{}`}}},
+			Usage:     Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+		}
+	}
+	answer := &Response{Content: "done", Usage: Usage{PromptTokens: 20, CompletionTokens: 5, TotalTokens: 25}}
+
+	tests := []struct {
+		name       string
+		loop       ToolLoop
+		responses  []*Response
+		toolErr    error
+		wantSends  int
+		wantTokens int
+		wantErr    string
+	}{
+		{
+			name:       "no tool calls",
+			responses:  []*Response{answer},
+			wantSends:  1,
+			wantTokens: 25,
+		},
+		{
+			name:       "several rounds",
+			responses:  []*Response{call("1"), call("2"), answer},
+			wantSends:  3,
+			wantTokens: 55,
+		},
+		{
+			name:      "round limit",
+			loop:      ToolLoop{MaxRounds: 1},
+			responses: []*Response{call("1"), call("2"), answer},
+			wantSends: 2,
+			wantErr:   "still calling tools after 1 rounds",
+		},
+		{
+			name:      "token budget",
+			loop:      ToolLoop{MaxTokens: 30},
+			responses: []*Response{call("1"), call("2"), answer},
+			wantSends: 2,
+			wantErr:   "used 30 tokens, over the budget of 30",
+		},
+		{
+			name:      "tool error",
+			responses: []*Response{call("1"), answer},
+			toolErr:   errors.New("tool exploded"),
+			wantSends: 1,
+			wantErr:   "tool exploded",
+		},
+		{
+			name:       "response error",
+			responses:  []*Response{{Error: &Error{Code: ErrServerError, Message: "down"}}},
+			wantSends:  1,
+			wantTokens: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent [][]Message
+			send := func(ctx context.Context, messages []Message) (*Response, error) {
+				sent = append(sent, messages)
+				resp := *tt.responses[len(sent)-1]
+				return &resp, nil
+			}
+			runTool := func(ctx context.Context, call ToolCall) (string, error) {
+				if tt.toolErr != nil {
+					return "", tt.toolErr
+				}
+				return fmt.Sprintf("result %s", call.ID), nil
+			}
+
+			resp, err := tt.loop.Run(context.Background(), Prompt("hi"), send, runTool)
+			if len(sent) != tt.wantSends {
+				t.Errorf("Expected %d requests, got %d", tt.wantSends, len(sent))
+			}
+			if tt.wantErr != "" {
+				if err == nil || !contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if resp.Usage.TotalTokens != tt.wantTokens {
+				t.Errorf("Expected %d tokens, got %d", tt.wantTokens, resp.Usage.TotalTokens)
+			}
+		})
+	}
+}
+
+func TestToolLoopMessages(t *testing.T) {
+	responses := []*Response{
+		{Content: "checking", ToolCalls: []ToolCall{{ID: "a"}, {ID: "b"}}},
+		{Content: "done"},
+	}
+	var sent [][]Message
+	send := func(ctx context.Context, messages []Message) (*Response, error) {
+		sent = append(sent, messages)
+		return responses[len(sent)-1], nil
+	}
+	runTool := func(ctx context.Context, call ToolCall) (string, error) {
+		return "result " + call.ID, nil
+	}
+
+	if _, err := (ToolLoop{}).Run(context.Background(), Prompt("hi"), send, runTool); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(sent[0]) != 1 {
+		t.Errorf("Expected the first request to hold only the prompt, got %+v", sent[0])
+	}
+
+	// The second request carries the calls and one result per call
+	followUp := sent[1]
+	if len(followUp) != 4 {
+		t.Fatalf("Expected 4 messages, got %+v", followUp)
+	}
+	if followUp[1].Role != RoleAssistant || followUp[1].Content != "checking" || len(followUp[1].ToolCalls) != 2 {
+		t.Errorf("Expected the assistant's calls, got %+v", followUp[1])
+	}
+	for i, id := range []string{"a", "b"} {
+		if m := followUp[2+i]; m.Role != RoleTool || m.ToolCallID != id || m.Content != "result "+id {
+			t.Errorf("Expected the result of %s, got %+v", id, m)
+		}
+	}
+}
+
+func TestToolLoopParallel(t *testing.T) {
+	calls := []ToolCall{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+	for _, maxParallel := range []int{0, 1, 2} {
+		t.Run(fmt.Sprintf("max %d", maxParallel), func(t *testing.T) {
+			responses := []*Response{{ToolCalls: calls}, {Content: "done"}}
+			var sent [][]Message
+			send := func(ctx context.Context, messages []Message) (*Response, error) {
+				sent = append(sent, messages)
+				return responses[len(sent)-1], nil
+			}
+
+			var mu sync.Mutex
+			running, peak := 0, 0
+			runTool := func(ctx context.Context, call ToolCall) (string, error) {
+				mu.Lock()
+				running++
+				if running > peak {
+					peak = running
+				}
+				mu.Unlock()
+
+				// Later calls finish first
+				time.Sleep(time.Duration(3-int(call.ID[0]-'a')) * 10 * time.Millisecond)
+
+				mu.Lock()
+				running--
+				mu.Unlock()
+				return "result " + call.ID, nil
+			}
+
+			loop := ToolLoop{MaxParallel: maxParallel}
+			if _, err := loop.Run(context.Background(), Prompt("hi"), send, runTool); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			want := maxParallel
+			if want == 0 {
+				want = len(calls)
+			}
+			if peak != want {
+				t.Errorf("Expected %d calls at once, got %d", want, peak)
+			}
+			for i, call := range calls {
+				if m := sent[1][2+i]; m.ToolCallID != call.ID || m.Content != "result "+call.ID {
+					t.Errorf("Expected the result of %s at %d, got %+v", call.ID, i, m)
+				}
+			}
+		})
+	}
+}
+
+func TestToolLoopParallelErrors(t *testing.T) {
+	send := func(ctx context.Context, messages []Message) (*Response, error) {
+		return &Response{ToolCalls: []ToolCall{{ID: "a"}, {ID: "b"}, {ID: "c"}}}, nil
+	}
+	runTool := func(ctx context.Context, call ToolCall) (string, error) {
+		if call.ID == "a" {
+			// The first call fails last
+			time.Sleep(20 * time.Millisecond)
+		}
+		if call.ID != "c" {
+			return "", fmt.Errorf("%s failed", call.ID)
+		}
+		return "ok", nil
+	}
+
+	_, err := (ToolLoop{}).Run(context.Background(), Prompt("hi"), send, runTool)
+	if err == nil || err.Error() != "a failed" {
+		t.Errorf("Expected the first call's error, got %v", err)
+	}
+}
+
+func contains(s, substr string) bool {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if s[i:i+len(substr)] == substr {
+			return true
+		}
+	}
+	return false
+}
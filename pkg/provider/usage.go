@@ -0,0 +1,46 @@
+package provider
+
+import (
+	"context"
+	"sync"
+)
+
+type meterKey struct{}
+
+// UsageMeter adds up the token usage of the requests made within a context
+type UsageMeter struct {
+	mu    sync.Mutex
+	usage Usage
+}
+
+// Add records the usage of one request
+func (m *UsageMeter) Add(u Usage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.usage.PromptTokens += u.PromptTokens
+	m.usage.CompletionTokens += u.CompletionTokens
+	m.usage.TotalTokens += u.TotalTokens
+}
+
+// Usage returns the usage recorded so far
+func (m *UsageMeter) Usage() Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.usage
+}
+
+// ContextWithUsageMeter returns a copy of ctx whose requests are recorded
+// in meter
+func ContextWithUsageMeter(ctx context.Context, meter *UsageMeter) context.Context {
+	return context.WithValue(ctx, meterKey{}, meter)
+}
+
+// RecordUsage adds u to the meter carried by ctx, if there is one
+func RecordUsage(ctx context.Context, u Usage) {
+	if ctx == nil {
+		return
+	}
+	if meter, ok := ctx.Value(meterKey{}).(*UsageMeter); ok {
+		meter.Add(u)
+	}
+}
@@ -0,0 +1,233 @@
+// Package repl runs an interactive conversation with an assistant. Each
+// prompt is sent with the exchanges before it, and lines starting with /
+// control the session.
+package repl
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/butter-bot-machines/skylark/pkg/fs/osfs"
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+)
+
+// maxLineSize bounds a single line of input
+const maxLineSize = 1 << 20
+
+// help lists the session commands
+const help = `Commands:
+  /tools         list the tools; run one with "use <tool> <json input>"
+  /model [name]  show the model, or switch to another one
+  /reset         forget the conversation so far
+  /save <file>   write the conversation to a Markdown file
+  /help          show this help
+  /exit          end the session (or Ctrl-D)
+`
+
+// Options configures a session
+type Options struct {
+	Catalog   processor.Catalog                 // Tools and assistants of the project
+	Processor processor.ContextCommandProcessor // Runs each prompt
+	Assistant string                            // Defaults to "default"
+}
+
+// Session is a conversation with one assistant
+type Session struct {
+	catalog   processor.Catalog
+	processor processor.ContextCommandProcessor
+	assistant string
+	model     string // Model of the assistant
+	override  string // Model chosen with /model, when set
+	history   []parser.Exchange
+}
+
+// New creates a session with the assistant opts names, which must exist
+func New(ctx context.Context, opts Options) (*Session, error) {
+	if opts.Catalog == nil {
+		return nil, fmt.Errorf("catalog required")
+	}
+	if opts.Processor == nil {
+		return nil, fmt.Errorf("processor required")
+	}
+	if opts.Assistant == "" {
+		opts.Assistant = "default"
+	}
+	name := strings.ToLower(opts.Assistant)
+
+	assistants, err := opts.Catalog.Assistants(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list assistants: %w", err)
+	}
+	for _, a := range assistants {
+		if a.Name == name {
+			return &Session{
+				catalog:   opts.Catalog,
+				processor: opts.Processor,
+				assistant: name,
+				model:     a.Model,
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown assistant: %s", opts.Assistant)
+}
+
+// Run reads prompts and commands from r and writes responses to w until r
+// is exhausted, /exit is entered or ctx is done. A failed prompt is
+// reported and left out of the conversation.
+func (s *Session) Run(ctx context.Context, r io.Reader, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	lines := make(chan string)
+	readErr := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+		readErr <- scanner.Err()
+	}()
+
+	fmt.Fprintf(w, "Talking to %s (%s). Type /help for commands.\n", s.assistant, s.Model())
+	for {
+		fmt.Fprintf(w, "%s> ", s.assistant)
+
+		var line string
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(w)
+			return ctx.Err()
+		case err := <-readErr:
+			fmt.Fprintln(w)
+			if err != nil {
+				return fmt.Errorf("failed to read input: %w", err)
+			}
+			return nil
+		case line = <-lines:
+		}
+
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "/"):
+			if done := s.command(ctx, w, line); done {
+				return nil
+			}
+		default:
+			response, err := s.Send(ctx, line)
+			if err != nil {
+				fmt.Fprintf(w, "Error: %v\n", err)
+				continue
+			}
+			fmt.Fprintln(w, response)
+		}
+	}
+}
+
+// Send sends prompt with the conversation so far and records the exchange
+func (s *Session) Send(ctx context.Context, prompt string) (string, error) {
+	cmd := &parser.Command{
+		Assistant: s.assistant,
+		Text:      prompt,
+		Original:  "!" + s.assistant + " " + prompt,
+		Context:   make(map[string]parser.Block),
+		History:   append([]parser.Exchange(nil), s.history...),
+		Model:     s.override,
+	}
+	response, err := s.processor.ProcessContext(ctx, cmd)
+	if err != nil {
+		return "", err
+	}
+	s.history = append(s.history, parser.Exchange{Prompt: prompt, Response: response})
+	return response, nil
+}
+
+// command runs a session command and reports whether the session ends
+func (s *Session) command(ctx context.Context, w io.Writer, line string) bool {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case "/exit", "/quit":
+		return true
+	case "/help":
+		fmt.Fprint(w, help)
+	case "/tools":
+		if err := s.printTools(ctx, w); err != nil {
+			fmt.Fprintf(w, "Error: %v\n", err)
+		}
+	case "/model":
+		if arg != "" {
+			s.override = arg
+		}
+		fmt.Fprintf(w, "Model: %s\n", s.Model())
+	case "/reset":
+		s.history = nil
+		fmt.Fprintln(w, "Conversation cleared")
+	case "/save":
+		if arg == "" {
+			fmt.Fprintln(w, "Error: /save requires a file")
+			break
+		}
+		if err := osfs.WriteFile(arg, []byte(s.Transcript()), 0644, false); err != nil {
+			fmt.Fprintf(w, "Error: failed to save transcript: %v\n", err)
+			break
+		}
+		fmt.Fprintf(w, "Saved transcript to %s\n", arg)
+	default:
+		fmt.Fprintf(w, "Unknown command %s; type /help for commands\n", name)
+	}
+	return false
+}
+
+// printTools lists the tools of the project
+func (s *Session) printTools(ctx context.Context, w io.Writer) error {
+	tools, err := s.catalog.Tools(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list tools: %w", err)
+	}
+	if len(tools) == 0 {
+		fmt.Fprintln(w, "No tools")
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, t := range tools {
+		fmt.Fprintf(tw, "%s\t%s\n", t.Name, t.Description)
+	}
+	return tw.Flush()
+}
+
+// Model returns the model prompts are sent to
+func (s *Session) Model() string {
+	if s.override != "" {
+		return s.override
+	}
+	return s.model
+}
+
+// History returns the exchanges of the conversation so far
+func (s *Session) History() []parser.Exchange {
+	return append([]parser.Exchange(nil), s.history...)
+}
+
+// Transcript renders the conversation so far as Markdown
+func (s *Session) Transcript() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Conversation with %s\n\n", s.assistant)
+	fmt.Fprintf(&b, "Model: %s\n", s.Model())
+	for _, exchange := range s.history {
+		fmt.Fprintf(&b, "\n## You\n\n%s\n\n## %s\n\n%s\n", exchange.Prompt, s.assistant, exchange.Response)
+	}
+	return b.String()
+}
@@ -0,0 +1,143 @@
+package repl
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+)
+
+// fakeCatalog implements processor.Catalog and records the commands it
+// processes
+type fakeCatalog struct {
+	commands []*parser.Command
+}
+
+func (c *fakeCatalog) Tools(ctx context.Context) ([]processor.ToolInfo, error) {
+	return []processor.ToolInfo{{Name: "currentdatetime", Description: "Current date and time"}}, nil
+}
+
+func (c *fakeCatalog) Assistants(ctx context.Context) ([]processor.AssistantInfo, error) {
+	return []processor.AssistantInfo{{Name: "research", Model: "gpt-4"}}, nil
+}
+
+func (c *fakeCatalog) RunTool(ctx context.Context, name string, input string) (string, error) {
+	return input, nil
+}
+
+func (c *fakeCatalog) Ask(ctx context.Context, assistant string, prompt string) (string, error) {
+	return "", errors.New("not used")
+}
+
+func (c *fakeCatalog) ProcessContext(ctx context.Context, cmd *parser.Command) (string, error) {
+	c.commands = append(c.commands, cmd)
+	if cmd.Text == "fail" {
+		return "", errors.New("provider down")
+	}
+	return "re: " + cmd.Text, nil
+}
+
+func TestNew(t *testing.T) {
+	catalog := &fakeCatalog{}
+	if _, err := New(context.Background(), Options{Catalog: catalog, Processor: catalog, Assistant: "Research"}); err != nil {
+		t.Errorf("Expected research to be found, got %v", err)
+	}
+	if _, err := New(context.Background(), Options{Catalog: catalog, Processor: catalog}); err == nil || !strings.Contains(err.Error(), "unknown assistant: default") {
+		t.Errorf("Expected unknown assistant error, got %v", err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	catalog := &fakeCatalog{}
+	s, err := New(context.Background(), Options{Catalog: catalog, Processor: catalog, Assistant: "research"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	transcript := filepath.Join(t.TempDir(), "session.md")
+	input := strings.Join([]string{
+		"what ships in May?",
+		"",
+		"fail",
+		"/model gpt-3.5-turbo",
+		"and in June?",
+		"/tools",
+		"/nope",
+		"/save " + transcript,
+		"/exit",
+		"never sent",
+	}, "\n")
+
+	var out strings.Builder
+	if err := s.Run(context.Background(), strings.NewReader(input), &out); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	for _, want := range []string{
+		"Talking to research (gpt-4)",
+		"research> re: what ships in May?\n",
+		"Error: provider down\n",
+		"Model: gpt-3.5-turbo\n",
+		"currentdatetime  Current date and time\n",
+		"Unknown command /nope",
+		"Saved transcript to " + transcript,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out.String())
+		}
+	}
+
+	// The failed prompt is left out of the conversation
+	if len(catalog.commands) != 3 {
+		t.Fatalf("Expected 3 prompts sent, got %d", len(catalog.commands))
+	}
+	last := catalog.commands[2]
+	if len(last.History) != 1 || last.History[0].Prompt != "what ships in May?" || last.History[0].Response != "re: what ships in May?" {
+		t.Errorf("Expected the first exchange as history, got %+v", last.History)
+	}
+	if last.Model != "gpt-3.5-turbo" || last.Assistant != "research" {
+		t.Errorf("Expected research on gpt-3.5-turbo, got %s on %s", last.Assistant, last.Model)
+	}
+
+	saved, err := os.ReadFile(transcript)
+	if err != nil {
+		t.Fatalf("Failed to read transcript: %v", err)
+	}
+	expected := "# Conversation with research\n\nModel: gpt-3.5-turbo\n" +
+		"\n## You\n\nwhat ships in May?\n\n## research\n\nre: what ships in May?\n" +
+		"\n## You\n\nand in June?\n\n## research\n\nre: and in June?\n"
+	if string(saved) != expected {
+		t.Errorf("Expected transcript:\n%q\ngot:\n%q", expected, saved)
+	}
+
+	// Reset forgets the conversation
+	if err := s.Run(context.Background(), strings.NewReader("/reset\n"), &out); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(s.History()) != 0 {
+		t.Errorf("Expected empty history after /reset, got %+v", s.History())
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	catalog := &fakeCatalog{}
+	s, err := New(context.Background(), Options{Catalog: catalog, Processor: catalog, Assistant: "research"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// A reader that never returns stands for an idle terminal
+	r, w := io.Pipe()
+	defer w.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Run(ctx, r, io.Discard); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
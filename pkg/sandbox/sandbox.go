@@ -1,6 +1,7 @@
 package sandbox
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -78,6 +79,62 @@ func NewSandbox(workDir string, limits *ResourceLimits, network *NetworkPolicy)
 
 // Execute runs a command in the sandbox with the specified limits
 func (s *Sandbox) Execute(cmd *exec.Cmd) error {
+	s.prepare(cmd)
+
+	// Start the command
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start command: %w", err)
+	}
+
+	// Apply CPU time limit
+	if s.Limits.MaxCPUTime > 0 {
+		timer := time.AfterFunc(s.Limits.MaxCPUTime, func() {
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		})
+		defer timer.Stop()
+	}
+
+	// Wait for command to complete
+	return cmd.Wait()
+}
+
+// ExecuteStreaming runs a long-running command in the sandbox. Instead of
+// the CPU time limit, the command is killed once heartbeat passes without
+// a value on beats, or when ctx is done.
+func (s *Sandbox) ExecuteStreaming(ctx context.Context, cmd *exec.Cmd, heartbeat time.Duration, beats <-chan struct{}) error {
+	s.prepare(cmd)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start command: %w", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	timer := time.NewTimer(heartbeat)
+	defer timer.Stop()
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-beats:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(heartbeat)
+		case <-timer.C:
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			<-done
+			return fmt.Errorf("no heartbeat for %s", heartbeat)
+		case <-ctx.Done():
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			<-done
+			return ctx.Err()
+		}
+	}
+}
+
+// prepare sets up cmd to run in the sandbox's directory, process group and
+// environment
+func (s *Sandbox) prepare(cmd *exec.Cmd) {
 	// Set working directory
 	cmd.Dir = s.WorkDir
 
@@ -94,12 +151,13 @@ func (s *Sandbox) Execute(cmd *exec.Cmd) error {
 
 	// Add filtered system environment
 	if len(s.EnvWhitelist) > 0 {
-		// Always include PATH and basic environment
+		// Always include PATH and basic environment. The whitelist is
+		// copied since tools may run in the sandbox concurrently.
 		basicEnv := []string{"PATH", "HOME", "USER", "SHELL"}
-		s.EnvWhitelist = append(s.EnvWhitelist, basicEnv...)
+		whitelist := append(append([]string(nil), s.EnvWhitelist...), basicEnv...)
 
 		for _, env := range os.Environ() {
-			for _, allowed := range s.EnvWhitelist {
+			for _, allowed := range whitelist {
 				if strings.HasPrefix(env, allowed+"=") {
 					toolEnv = append(toolEnv, env)
 					break
@@ -109,22 +167,6 @@ func (s *Sandbox) Execute(cmd *exec.Cmd) error {
 	}
 
 	cmd.Env = toolEnv
-
-	// Start the command
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start command: %w", err)
-	}
-
-	// Apply CPU time limit
-	if s.Limits.MaxCPUTime > 0 {
-		timer := time.AfterFunc(s.Limits.MaxCPUTime, func() {
-			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
-		})
-		defer timer.Stop()
-	}
-
-	// Wait for command to complete
-	return cmd.Wait()
 }
 
 // Cleanup performs cleanup after sandbox execution
@@ -187,27 +229,28 @@ func (s *Sandbox) VerifyToolVersion(minVersion string) bool {
 		return true // Skip version check if either version is not specified
 	}
 
-	// Parse versions (assuming semantic versioning)
-	current := parseVersion(s.ToolVersion)
-	minimum := parseVersion(minVersion)
+	return VersionAtLeast(s.ToolVersion, minVersion)
+}
 
-	// Compare versions
+// VersionAtLeast reports whether the semantic version is minimum or later,
+// comparing major, minor and patch numbers. A leading v is ignored.
+func VersionAtLeast(version, minimum string) bool {
+	current, min := parseVersion(version), parseVersion(minimum)
 	for i := 0; i < 3; i++ {
-		if current[i] < minimum[i] {
+		if current[i] < min[i] {
 			return false
 		}
-		if current[i] > minimum[i] {
+		if current[i] > min[i] {
 			return true
 		}
 	}
-
 	return true
 }
 
 // parseVersion parses a semantic version string into components
 func parseVersion(version string) [3]int {
 	var components [3]int
-	fmt.Sscanf(version, "%d.%d.%d", &components[0], &components[1], &components[2])
+	fmt.Sscanf(strings.TrimPrefix(version, "v"), "%d.%d.%d", &components[0], &components[1], &components[2])
 	return components
 }
 
@@ -162,6 +162,11 @@ func TestVersionChecking(t *testing.T) {
 			minVersion: "",
 			want:       true,
 		},
+		{
+			name:       "v prefix",
+			minVersion: "v1.3.0",
+			want:       false,
+		},
 	}
 
 	for _, tt := range tests {
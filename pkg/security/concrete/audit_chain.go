@@ -0,0 +1,250 @@
+package concrete
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/security/types"
+)
+
+// DefaultCheckpointInterval is the number of events between signed
+// checkpoints when the configuration sets none
+const DefaultCheckpointInterval = 100
+
+// ErrAuditTampered is returned when an audit log fails verification
+var ErrAuditTampered = errors.New("audit log failed verification")
+
+// headSuffix names the file recording the latest checkpoint of a log
+const headSuffix = ".head"
+
+// auditHead is the latest checkpoint of a log, kept beside it so that
+// truncation past the checkpoint can be detected
+type auditHead struct {
+	Seq       uint64 `json:"seq"`
+	PrevHash  string `json:"prev_hash"`
+	Hash      string `json:"hash"`
+	Signature string `json:"signature"`
+}
+
+// chainHash returns the hash linking an event, encoded without its hash
+// as body, to the event before it
+func chainHash(prev string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(prev))
+	h.Write([]byte{'\n'})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// signCheckpoint returns the signature of a checkpoint at seq following
+// the event with hash prev
+func signCheckpoint(secret string, seq uint64, prev string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatUint(seq, 10) + ":" + prev))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// chain links event to the last logged event and computes its hash
+func (a *auditLogger) chain(event *types.Event) error {
+	event.Seq = a.seq + 1
+	event.PrevHash = a.lastHash
+	event.Hash = ""
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	event.Hash = chainHash(event.PrevHash, body)
+	a.seq, a.lastHash = event.Seq, event.Hash
+	return nil
+}
+
+// checkpoint returns a signed checkpoint event when one is due
+func (a *auditLogger) checkpoint(force bool) (*types.Event, error) {
+	if a.config.CheckpointSecret == "" || a.sinceCheckpoint == 0 {
+		return nil, nil
+	}
+	interval := a.config.CheckpointInterval
+	if interval <= 0 {
+		interval = DefaultCheckpointInterval
+	}
+	if !force && a.sinceCheckpoint < interval {
+		return nil, nil
+	}
+
+	event := &types.Event{
+		ID:        generateEventID(),
+		Timestamp: time.Now(),
+		Type:      types.EventAuditCheckpoint,
+		Severity:  types.SeverityInfo,
+		Source:    "audit_log",
+		Details:   fmt.Sprintf("checkpoint after event %d", a.seq),
+		Metadata: map[string]interface{}{
+			"signature": signCheckpoint(a.config.CheckpointSecret, a.seq+1, a.lastHash),
+		},
+	}
+	if err := a.chain(event); err != nil {
+		return nil, err
+	}
+	a.sinceCheckpoint = 0
+	return event, nil
+}
+
+// resumeChain continues the hash chain from the last event in the log
+func (a *auditLogger) resumeChain() error {
+	events, err := ReadAuditLog(a.config.Path, nil)
+	if err != nil {
+		return err
+	}
+	for i := len(events) - 1; i >= 0; i-- {
+		if events[i].Hash != "" {
+			a.seq, a.lastHash = events[i].Seq, events[i].Hash
+			break
+		}
+	}
+	return nil
+}
+
+// writeHead records the checkpoint event as the head of the log
+func writeHead(path string, event *types.Event) error {
+	signature, _ := event.Metadata["signature"].(string)
+	data, err := json.Marshal(auditHead{
+		Seq:       event.Seq,
+		PrevHash:  event.PrevHash,
+		Hash:      event.Hash,
+		Signature: signature,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint: %w", err)
+	}
+	tmp := path + headSuffix + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, path+headSuffix); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
+
+// VerifyReport summarizes a verified audit log
+type VerifyReport struct {
+	Events      int // Chained events, checkpoints included
+	Checkpoints int // Checkpoints whose signatures were checked
+	Unsigned    int // Events after the last checkpoint
+	Unchained   int // Events written before hash chaining, at the start of the log
+}
+
+// VerifyAuditLog checks the hash chain of the audit log at path and its
+// rotated files, and with secret the signatures of its checkpoints. An
+// error wrapping ErrAuditTampered names the first event that was
+// modified, removed or reordered, or reports a log truncated before its
+// latest checkpoint. Events pruned for retention from the start of the
+// log are not reported.
+func VerifyAuditLog(path, secret string) (*VerifyReport, error) {
+	files, err := rotatedLogs(path)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, path)
+
+	report := &VerifyReport{}
+	var last *types.Event
+	hashes := make(map[uint64]string)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read audit log: %w", err)
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			raw := scanner.Bytes()
+			if len(bytes.TrimSpace(raw)) == 0 {
+				continue
+			}
+			where := fmt.Sprintf("%s line %d", file, line)
+
+			var event types.Event
+			if err := json.Unmarshal(raw, &event); err != nil {
+				return report, fmt.Errorf("%w: %s is not an event: %v", ErrAuditTampered, where, err)
+			}
+			if event.Hash == "" {
+				if last != nil {
+					return report, fmt.Errorf("%w: %s has no hash", ErrAuditTampered, where)
+				}
+				report.Unchained++
+				continue
+			}
+
+			// The hash covers the line as written, without the hash itself
+			suffix := []byte(`,"hash":"` + event.Hash + `"}`)
+			if !bytes.HasSuffix(raw, suffix) {
+				return report, fmt.Errorf("%w: %s was re-encoded", ErrAuditTampered, where)
+			}
+			body := append(bytes.Clone(bytes.TrimSuffix(raw, suffix)), '}')
+			if chainHash(event.PrevHash, body) != event.Hash {
+				return report, fmt.Errorf("%w: %s was modified", ErrAuditTampered, where)
+			}
+			if last != nil && (event.PrevHash != last.Hash || event.Seq != last.Seq+1) {
+				return report, fmt.Errorf("%w: events before %s were removed or reordered", ErrAuditTampered, where)
+			}
+
+			if event.Type == types.EventAuditCheckpoint {
+				signature, _ := event.Metadata["signature"].(string)
+				if secret != "" {
+					if !hmac.Equal([]byte(signature), []byte(signCheckpoint(secret, event.Seq, event.PrevHash))) {
+						return report, fmt.Errorf("%w: %s has an invalid checkpoint signature", ErrAuditTampered, where)
+					}
+					report.Checkpoints++
+				}
+				report.Unsigned = 0
+			} else {
+				report.Unsigned++
+			}
+
+			report.Events++
+			hashes[event.Seq] = event.Hash
+			last = &event
+		}
+		if err := scanner.Err(); err != nil {
+			return report, fmt.Errorf("failed to read audit log: %w", err)
+		}
+	}
+
+	// The latest checkpoint must still be in the log
+	data, err := os.ReadFile(path + headSuffix)
+	if os.IsNotExist(err) {
+		return report, nil
+	}
+	if err != nil {
+		return report, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	var head auditHead
+	if err := json.Unmarshal(data, &head); err != nil {
+		return report, fmt.Errorf("%w: invalid checkpoint file: %v", ErrAuditTampered, err)
+	}
+	if secret != "" && !hmac.Equal([]byte(head.Signature), []byte(signCheckpoint(secret, head.Seq, head.PrevHash))) {
+		return report, fmt.Errorf("%w: checkpoint file has an invalid signature", ErrAuditTampered)
+	}
+	if last == nil || last.Seq < head.Seq {
+		return report, fmt.Errorf("%w: log was truncated before checkpoint at event %d", ErrAuditTampered, head.Seq)
+	}
+	if hash, ok := hashes[head.Seq]; ok && hash != head.Hash {
+		return report, fmt.Errorf("%w: checkpoint at event %d does not match the log", ErrAuditTampered, head.Seq)
+	}
+	return report, nil
+}
@@ -0,0 +1,125 @@
+package concrete
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/security"
+	"github.com/butter-bot-machines/skylark/pkg/security/types"
+)
+
+// openChainedLog opens an audit log signing a checkpoint every 2 events
+func openChainedLog(t *testing.T, path string) security.AuditLogger {
+	t.Helper()
+	auditLog, err := NewAuditLogger(&config.Config{
+		Security: types.SecurityConfig{
+			AuditLog: types.AuditLogConfig{
+				Enabled:            true,
+				Path:               path,
+				CheckpointSecret:   "s3cret",
+				CheckpointInterval: 2,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create audit log: %v", err)
+	}
+	return auditLog
+}
+
+// logEvents writes n file access events
+func logEvents(t *testing.T, auditLog security.AuditLogger, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := auditLog.Log(types.EventFileAccess, types.SeverityInfo, "test", "read notes.md", map[string]interface{}{"path": "notes.md", "size": 42}); err != nil {
+			t.Fatalf("Failed to log event: %v", err)
+		}
+	}
+}
+
+func TestVerifyAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	// The chain continues across restarts and rotation
+	auditLog := openChainedLog(t, path)
+	logEvents(t, auditLog, 3)
+	if err := auditLog.Rotate(); err != nil {
+		t.Fatalf("Failed to rotate: %v", err)
+	}
+	auditLog.Close()
+	auditLog = openChainedLog(t, path)
+	logEvents(t, auditLog, 2)
+	auditLog.Close()
+
+	report, err := VerifyAuditLog(path, "s3cret")
+	if err != nil {
+		t.Fatalf("VerifyAuditLog() error = %v", err)
+	}
+	// 5 events, a checkpoint after every 2 and one on close
+	if report.Events != 8 || report.Checkpoints != 3 || report.Unsigned != 0 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+
+	if _, err := VerifyAuditLog(path, "guess"); !errors.Is(err, ErrAuditTampered) || !strings.Contains(err.Error(), "signature") {
+		t.Errorf("Expected an invalid signature, got %v", err)
+	}
+}
+
+func TestVerifyAuditLogTampering(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(lines [][]byte) [][]byte
+		wantErr string
+	}{
+		{
+			name: "modified event",
+			tamper: func(lines [][]byte) [][]byte {
+				lines[1] = bytes.Replace(lines[1], []byte("notes.md"), []byte("other.md"), 1)
+				return lines
+			},
+			wantErr: "line 2 was modified",
+		},
+		{
+			name: "removed event",
+			tamper: func(lines [][]byte) [][]byte {
+				return append(lines[:1], lines[2:]...)
+			},
+			wantErr: "were removed or reordered",
+		},
+		{
+			name: "truncated log",
+			tamper: func(lines [][]byte) [][]byte {
+				return lines[:2]
+			},
+			wantErr: "truncated before checkpoint",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.log")
+			auditLog := openChainedLog(t, path)
+			logEvents(t, auditLog, 4)
+			auditLog.Close()
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read log: %v", err)
+			}
+			lines := tt.tamper(bytes.Split(bytes.TrimSpace(data), []byte("\n")))
+			if err := os.WriteFile(path, append(bytes.Join(lines, []byte("\n")), '\n'), 0600); err != nil {
+				t.Fatalf("Failed to write log: %v", err)
+			}
+
+			_, err = VerifyAuditLog(path, "s3cret")
+			if !errors.Is(err, ErrAuditTampered) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"sync"
@@ -21,6 +22,12 @@ type auditLogger struct {
 	file      *os.File
 	buffer    []*types.Event
 	lastFlush time.Time
+	degraded  string // Reason the logger is degraded, empty when healthy
+	dropped   uint64 // Events discarded while degraded
+
+	seq             uint64 // Sequence number of the last chained event
+	lastHash        string // Hash of the last chained event
+	sinceCheckpoint int    // Events chained since the last checkpoint
 }
 
 // NewAuditLogger creates a new audit logger
@@ -35,6 +42,14 @@ func NewAuditLogger(cfg *config.Config) (security.AuditLogger, error) {
 		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
 	}
 
+	// Drop events past their retention before appending
+	retention := retentionPeriod(cfg.Security.AuditLog)
+	if err := PruneAuditLog(cfg.Security.AuditLog.Path, retention, time.Now()); err != nil {
+		slog.Warn("failed to enforce audit log retention",
+			"path", cfg.Security.AuditLog.Path,
+			"error", err)
+	}
+
 	// Open log file in append mode
 	file, err := os.OpenFile(
 		cfg.Security.AuditLog.Path,
@@ -45,12 +60,20 @@ func NewAuditLogger(cfg *config.Config) (security.AuditLogger, error) {
 		return nil, fmt.Errorf("failed to open audit log: %w", err)
 	}
 
-	return &auditLogger{
+	logger := &auditLogger{
 		config:    cfg.Security.AuditLog,
 		file:      file,
 		buffer:    make([]*types.Event, 0, 100),
 		lastFlush: time.Now(),
-	}, nil
+	}
+
+	// Continue the hash chain of the existing log
+	if err := logger.resumeChain(); err != nil {
+		slog.Warn("failed to resume audit log hash chain, starting a new one",
+			"path", cfg.Security.AuditLog.Path,
+			"error", err)
+	}
+	return logger, nil
 }
 
 // Log implements security.AuditLogger
@@ -77,17 +100,58 @@ func (a *auditLogger) Log(eventType types.EventType, severity types.Severity, so
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	// Add to buffer
+	// Discard events once degraded under the warn policy
+	if a.degraded != "" {
+		a.dropped++
+		return nil
+	}
+
+	// Link the event to the previous one and add it to the buffer,
+	// followed by a checkpoint when one is due
+	if err := a.chain(event); err != nil {
+		return err
+	}
 	a.buffer = append(a.buffer, event)
+	a.sinceCheckpoint++
+	checkpoint, err := a.checkpoint(false)
+	if err != nil {
+		return err
+	}
+	if checkpoint != nil {
+		a.buffer = append(a.buffer, checkpoint)
+	}
 
 	// Flush if buffer is full or enough time has passed
 	if len(a.buffer) >= 100 || time.Since(a.lastFlush) > 5*time.Second {
-		return a.flush()
+		if err := a.flush(); err != nil {
+			return a.handleFailure(err)
+		}
 	}
 
 	return nil
 }
 
+// Status implements security.StatusReporter
+func (a *auditLogger) Status() types.ComponentStatus {
+	if a == nil {
+		return types.ComponentStatus{Name: "audit_log", State: types.StateDisabled}
+	}
+
+	status := types.ComponentStatus{
+		Name:   "audit_log",
+		State:  types.StateOK,
+		Policy: a.config.OnFailure.Resolve(),
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.degraded != "" {
+		status.State = types.StateDegraded
+		status.Reason = fmt.Sprintf("%s (%d events dropped)", a.degraded, a.dropped)
+	}
+	return status
+}
+
 // Query implements security.AuditLogger
 func (a *auditLogger) Query(filter security.EventFilter) ([]*types.Event, error) {
 	if a == nil {
@@ -102,23 +166,7 @@ func (a *auditLogger) Query(filter security.EventFilter) ([]*types.Event, error)
 		return nil, err
 	}
 
-	// Read all events from file
-	var events []*types.Event
-	decoder := json.NewDecoder(a.file)
-	for {
-		var event types.Event
-		if err := decoder.Decode(&event); err == io.EOF {
-			break
-		} else if err != nil {
-			return nil, fmt.Errorf("failed to decode event: %w", err)
-		}
-
-		if filter == nil || filter.MatchEvent(&event) {
-			events = append(events, &event)
-		}
-	}
-
-	return events, nil
+	return ReadAuditLog(a.config.Path, filter)
 }
 
 // Export implements security.AuditLogger
@@ -135,12 +183,14 @@ func (a *auditLogger) Export(w io.Writer) error {
 		return err
 	}
 
-	// Copy log file to writer
-	if _, err := a.file.Seek(0, 0); err != nil {
-		return fmt.Errorf("failed to seek log file: %w", err)
+	// Copy log file to writer; the logger's own handle is write-only
+	file, err := os.Open(a.config.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
 	}
+	defer file.Close()
 
-	if _, err := io.Copy(w, a.file); err != nil {
+	if _, err := io.Copy(w, file); err != nil {
 		return fmt.Errorf("failed to export log: %w", err)
 	}
 
@@ -184,6 +234,12 @@ func (a *auditLogger) Rotate() error {
 	}
 
 	a.file = file
+
+	if err := PruneAuditLog(a.config.Path, retentionPeriod(a.config), time.Now()); err != nil {
+		slog.Warn("failed to enforce audit log retention",
+			"path", a.config.Path,
+			"error", err)
+	}
 	return nil
 }
 
@@ -196,6 +252,17 @@ func (a *auditLogger) Close() error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	// Sign the events logged since the last checkpoint
+	if a.degraded == "" {
+		checkpoint, err := a.checkpoint(true)
+		if err != nil {
+			return err
+		}
+		if checkpoint != nil {
+			a.buffer = append(a.buffer, checkpoint)
+		}
+	}
+
 	if err := a.flush(); err != nil {
 		return err
 	}
@@ -222,6 +289,7 @@ func (a *auditLogger) flush() error {
 	}
 
 	// Convert events to JSON lines
+	var checkpoint *types.Event
 	for _, event := range a.buffer {
 		data, err := json.Marshal(event)
 		if err != nil {
@@ -230,13 +298,44 @@ func (a *auditLogger) flush() error {
 		if _, err := a.file.Write(append(data, '\n')); err != nil {
 			return fmt.Errorf("failed to write event: %w", err)
 		}
+		if event.Type == types.EventAuditCheckpoint {
+			checkpoint = event
+		}
 	}
 
 	// Clear buffer and update flush time
 	a.buffer = a.buffer[:0]
 	a.lastFlush = time.Now()
 
-	return a.file.Sync()
+	if err := a.file.Sync(); err != nil {
+		return err
+	}
+	if checkpoint != nil {
+		return writeHead(a.config.Path, checkpoint)
+	}
+	return nil
+}
+
+// handleFailure applies the failure policy to a write error. Under the warn
+// policy the logger degrades and discards buffered events; under fail-closed
+// the error is returned to the caller.
+func (a *auditLogger) handleFailure(err error) error {
+	if a.config.OnFailure.Resolve() == types.PolicyFailClosed {
+		return err
+	}
+
+	a.degraded = err.Error()
+	a.dropped += uint64(len(a.buffer))
+	a.buffer = a.buffer[:0]
+	slog.Warn("audit logging degraded, security events will be dropped",
+		"path", a.config.Path,
+		"error", err)
+	return nil
+}
+
+// retentionPeriod returns how long events are kept, zero for forever
+func retentionPeriod(cfg types.AuditLogConfig) time.Duration {
+	return time.Duration(cfg.RetentionDays) * 24 * time.Hour
 }
 
 // generateEventID generates a unique event ID
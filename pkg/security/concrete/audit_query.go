@@ -0,0 +1,264 @@
+package concrete
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/security"
+	"github.com/butter-bot-machines/skylark/pkg/security/types"
+)
+
+// rotatedSuffix is the time format Rotate appends to rotated log files
+const rotatedSuffix = "20060102-150405"
+
+// Export formats
+const (
+	ExportJSON = "json"
+	ExportCSV  = "csv"
+)
+
+// EventQuery selects audit events. Empty fields match every event.
+type EventQuery struct {
+	Since      time.Time // Events at or after this time
+	Until      time.Time // Events before this time
+	Types      []types.EventType
+	Sources    []string
+	Severities []types.Severity
+}
+
+// MatchEvent implements security.EventFilter
+func (q EventQuery) MatchEvent(e *types.Event) bool {
+	if !q.Since.IsZero() && e.Timestamp.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !e.Timestamp.Before(q.Until) {
+		return false
+	}
+	return matchesAnyOf(q.Types, e.Type) && matchesAnyOf(q.Sources, e.Source) && matchesAnyOf(q.Severities, e.Severity)
+}
+
+// matchesAnyOf reports whether values is empty or contains v
+func matchesAnyOf[T comparable](values []T, v T) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadAuditLog returns the events matching filter, which may be nil, from
+// the audit log at path and the files it was rotated into, oldest first
+func ReadAuditLog(path string, filter security.EventFilter) ([]*types.Event, error) {
+	files, err := rotatedLogs(path)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, path)
+
+	var events []*types.Event
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read audit log: %w", err)
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		for {
+			var event types.Event
+			if err := decoder.Decode(&event); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("failed to decode event in %s: %w", file, err)
+			}
+			if filter == nil || filter.MatchEvent(&event) {
+				events = append(events, &event)
+			}
+		}
+	}
+	return events, nil
+}
+
+// rotatedLogs returns the files the log at path was rotated into, oldest
+// first
+func rotatedLogs(path string) ([]string, error) {
+	matches, err := filepath.Glob(escapeGlob(path) + ".*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rotated audit logs: %w", err)
+	}
+
+	var files []string
+	for _, match := range matches {
+		if _, ok := rotatedAt(path, match); ok {
+			files = append(files, match)
+		}
+	}
+	// The suffix sorts chronologically
+	sort.Strings(files)
+	return files, nil
+}
+
+// rotatedAt returns the time a rotated file of the log at path was rotated
+func rotatedAt(path, file string) (time.Time, bool) {
+	suffix := strings.TrimPrefix(file, path+".")
+	t, err := time.ParseInLocation(rotatedSuffix, suffix, time.Local)
+	return t, err == nil
+}
+
+// escapeGlob quotes the characters filepath.Match treats specially
+func escapeGlob(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if strings.ContainsRune(`*?[\`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// ExportEvents writes events to w as a JSON array or as CSV with a header
+// row. Metadata is written as a JSON object in CSV.
+func ExportEvents(w io.Writer, events []*types.Event, format string) error {
+	switch format {
+	case ExportJSON:
+		if events == nil {
+			events = []*types.Event{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(events)
+	case ExportCSV:
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"id", "timestamp", "type", "severity", "source", "details", "metadata"})
+		for _, e := range events {
+			metadata := ""
+			if len(e.Metadata) > 0 {
+				data, err := json.Marshal(e.Metadata)
+				if err != nil {
+					return fmt.Errorf("failed to encode metadata of event %s: %w", e.ID, err)
+				}
+				metadata = string(data)
+			}
+			cw.Write([]string{
+				e.ID,
+				e.Timestamp.Format(time.RFC3339Nano),
+				string(e.Type),
+				string(e.Severity),
+				e.Source,
+				e.Details,
+				metadata,
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("unknown export format %q, expected %s or %s", format, ExportJSON, ExportCSV)
+	}
+}
+
+// PruneAuditLog removes events older than retention from the audit log at
+// path and its rotated files. Rotated files left without events are
+// deleted. Lines that are not events are kept.
+func PruneAuditLog(path string, retention time.Duration, now time.Time) error {
+	if retention <= 0 {
+		return nil
+	}
+	cutoff := now.Add(-retention)
+
+	files, err := rotatedLogs(path)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		// Everything in a file rotated before the cutoff has expired
+		if t, _ := rotatedAt(path, file); t.Before(cutoff) {
+			if err := os.Remove(file); err != nil {
+				return fmt.Errorf("failed to remove expired audit log: %w", err)
+			}
+			continue
+		}
+		if err := pruneFile(file, cutoff, true); err != nil {
+			return err
+		}
+	}
+	if err := pruneFile(path, cutoff, false); err != nil {
+		return err
+	}
+
+	// A checkpoint whose events have all expired no longer describes the log
+	if events, err := ReadAuditLog(path, nil); err == nil && len(events) == 0 {
+		if err := os.Remove(path + headSuffix); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove expired checkpoint: %w", err)
+		}
+	}
+	return nil
+}
+
+// pruneFile rewrites file without the events before cutoff, removing it
+// when nothing is left and removeEmpty is set
+func pruneFile(file string, cutoff time.Time, removeEmpty bool) error {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	var kept bytes.Buffer
+	expired := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var event struct {
+			Timestamp time.Time `json:"timestamp"`
+		}
+		if err := json.Unmarshal(line, &event); err == nil && event.Timestamp.Before(cutoff) {
+			expired++
+			continue
+		}
+		kept.Write(line)
+		kept.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	if expired == 0 {
+		return nil
+	}
+	if kept.Len() == 0 && removeEmpty {
+		if err := os.Remove(file); err != nil {
+			return fmt.Errorf("failed to remove expired audit log: %w", err)
+		}
+		return nil
+	}
+
+	// Replace the file atomically so a crash never loses kept events
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, kept.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to write pruned audit log: %w", err)
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace audit log: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package concrete
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/security/types"
+)
+
+// writeEvents writes events to path as the audit logger does
+func writeEvents(t *testing.T, path string, events ...types.Event) {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, e := range events {
+		data, err := json.Marshal(e)
+		if err != nil {
+			t.Fatalf("Failed to marshal event: %v", err)
+		}
+		buf.Write(append(data, '\n'))
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatalf("Failed to write events: %v", err)
+	}
+}
+
+// eventIDs returns the IDs of events in order
+func eventIDs(events []*types.Event) []string {
+	ids := []string{}
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func TestReadAuditLog(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.Local)
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeEvents(t, path+"."+now.Add(-48*time.Hour).Format(rotatedSuffix),
+		types.Event{ID: "1", Timestamp: now.Add(-72 * time.Hour), Type: types.EventAccessDenied, Source: "file_guard", Severity: types.SeverityWarning},
+	)
+	writeEvents(t, path,
+		types.Event{ID: "2", Timestamp: now.Add(-2 * time.Hour), Type: types.EventAccessDenied, Source: "file_guard", Severity: types.SeverityWarning},
+		types.Event{ID: "3", Timestamp: now.Add(-time.Hour), Type: types.EventContentFiltered, Source: "content_filter", Severity: types.SeverityError},
+	)
+
+	tests := []struct {
+		name  string
+		query EventQuery
+		want  []string
+	}{
+		{name: "all", want: []string{"1", "2", "3"}},
+		{name: "since", query: EventQuery{Since: now.Add(-24 * time.Hour)}, want: []string{"2", "3"}},
+		{name: "until", query: EventQuery{Until: now.Add(-time.Hour)}, want: []string{"1", "2"}},
+		{name: "type", query: EventQuery{Types: []types.EventType{types.EventAccessDenied}}, want: []string{"1", "2"}},
+		{name: "source and severity", query: EventQuery{Sources: []string{"content_filter"}, Severities: []types.Severity{types.SeverityError}}, want: []string{"3"}},
+		{name: "no match", query: EventQuery{Sources: []string{"key_store"}}, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := ReadAuditLog(path, tt.query)
+			if err != nil {
+				t.Fatalf("ReadAuditLog() error = %v", err)
+			}
+			if got := eventIDs(events); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected events %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestExportEvents(t *testing.T) {
+	events := []*types.Event{{
+		ID:        "1",
+		Timestamp: time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC),
+		Type:      types.EventAccessDenied,
+		Severity:  types.SeverityWarning,
+		Source:    "file_guard",
+		Details:   "Access denied to notes, \"private\"",
+		Metadata:  map[string]interface{}{"path": "notes"},
+	}}
+
+	var csvOut bytes.Buffer
+	if err := ExportEvents(&csvOut, events, ExportCSV); err != nil {
+		t.Fatalf("ExportEvents(csv) error = %v", err)
+	}
+	want := "id,timestamp,type,severity,source,details,metadata\n" +
+		`1,2026-10-16T12:00:00Z,access_denied,warning,file_guard,"Access denied to notes, ""private""","{""path"":""notes""}"` + "\n"
+	if csvOut.String() != want {
+		t.Errorf("Expected CSV\n%s\ngot\n%s", want, csvOut.String())
+	}
+
+	var jsonOut bytes.Buffer
+	if err := ExportEvents(&jsonOut, nil, ExportJSON); err != nil {
+		t.Fatalf("ExportEvents(json) error = %v", err)
+	}
+	if strings.TrimSpace(jsonOut.String()) != "[]" {
+		t.Errorf("Expected an empty array, got %s", jsonOut.String())
+	}
+
+	if err := ExportEvents(&jsonOut, events, "xml"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestPruneAuditLog(t *testing.T) {
+	now := time.Now()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+	expired := path + "." + now.Add(-40*24*time.Hour).Format(rotatedSuffix)
+	recent := path + "." + now.Add(-24*time.Hour).Format(rotatedSuffix)
+	writeEvents(t, expired, types.Event{ID: "1", Timestamp: now.Add(-41 * 24 * time.Hour)})
+	writeEvents(t, recent,
+		types.Event{ID: "2", Timestamp: now.Add(-31 * 24 * time.Hour)},
+		types.Event{ID: "3", Timestamp: now.Add(-2 * 24 * time.Hour)},
+	)
+	writeEvents(t, path,
+		types.Event{ID: "4", Timestamp: now.Add(-35 * 24 * time.Hour)},
+		types.Event{ID: "5", Timestamp: now.Add(-time.Hour)},
+	)
+
+	// Opening the log enforces its retention
+	auditLog, err := NewAuditLogger(&config.Config{
+		Security: types.SecurityConfig{
+			AuditLog: types.AuditLogConfig{Enabled: true, Path: path, RetentionDays: 30},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create audit log: %v", err)
+	}
+	defer auditLog.Close()
+
+	if _, err := os.Stat(expired); !os.IsNotExist(err) {
+		t.Errorf("Expected the expired rotated log to be removed, got %v", err)
+	}
+	events, err := auditLog.Query(nil)
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if got, want := eventIDs(events), []string{"3", "5"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected events %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,164 @@
+package concrete
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/butter-bot-machines/skylark/pkg/security"
+	"github.com/butter-bot-machines/skylark/pkg/security/types"
+)
+
+// ErrContentBlocked is returned when text matches a blocking content filter
+var ErrContentBlocked = errors.New("content blocked")
+
+// Built-in content detectors
+const (
+	DetectorSecrets      = "secrets"
+	DetectorEmails       = "emails"
+	DetectorPhoneNumbers = "phone_numbers"
+)
+
+// detectors are the built-in patterns, by name
+var detectors = map[string]string{
+	// API keys and tokens with well-known prefixes, and private keys
+	DetectorSecrets: `sk-(?:proj-)?[A-Za-z0-9_-]{20,}` +
+		`|AKIA[0-9A-Z]{16}` +
+		`|gh[pousr]_[A-Za-z0-9]{36,}` +
+		`|github_pat_[A-Za-z0-9_]{22,}` +
+		`|xox[abprs]-[A-Za-z0-9-]{10,}` +
+		`|AIza[0-9A-Za-z_-]{35}` +
+		`|-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`,
+	DetectorEmails: `[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`,
+	// Separated groups of digits, optionally with a country code
+	DetectorPhoneNumbers: `(?:\+\d{1,3}[ .-]?)?(?:\(\d{2,4}\)|\b\d{2,4})[ .-]\d{3,4}[ .-]\d{3,4}\b`,
+}
+
+// contentRule is a compiled content filter rule
+type contentRule struct {
+	name    string
+	pattern *regexp.Regexp
+	action  types.ContentAction
+	scope   types.ContentScope
+}
+
+// contentFilter implements security.ContentFilter
+type contentFilter struct {
+	rules    []contentRule
+	auditLog security.AuditLogger
+}
+
+// NewContentFilter creates a content filter applying rules in order.
+// Matches are recorded in auditLog, which may be nil.
+func NewContentFilter(rules []types.ContentFilterConfig, auditLog security.AuditLogger) (security.ContentFilter, error) {
+	f := &contentFilter{auditLog: auditLog}
+	for _, r := range rules {
+		rule, err := compileRule(r)
+		if err != nil {
+			return nil, err
+		}
+		f.rules = append(f.rules, rule)
+	}
+	return f, nil
+}
+
+// compileRule validates a rule and compiles its pattern
+func compileRule(r types.ContentFilterConfig) (contentRule, error) {
+	if r.Name == "" {
+		return contentRule{}, fmt.Errorf("content filter name is required")
+	}
+	if !r.Action.Valid() {
+		return contentRule{}, fmt.Errorf("content filter %s: unknown action %q", r.Name, r.Action)
+	}
+	switch r.Scope {
+	case types.ScopeAll, types.ScopePrompts, types.ScopeResponses:
+	default:
+		return contentRule{}, fmt.Errorf("content filter %s: unknown scope %q", r.Name, r.Scope)
+	}
+
+	expr := r.Pattern
+	if expr == "" {
+		var ok bool
+		if expr, ok = detectors[r.Name]; !ok {
+			return contentRule{}, fmt.Errorf("content filter %s: unknown detector and no pattern", r.Name)
+		}
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return contentRule{}, fmt.Errorf("content filter %s: invalid pattern: %w", r.Name, err)
+	}
+
+	action := r.Action
+	if action == "" {
+		action = types.ActionRedact
+	}
+	return contentRule{name: r.Name, pattern: pattern, action: action, scope: r.Scope}, nil
+}
+
+// ScreenPrompt implements security.ContentFilter
+func (f *contentFilter) ScreenPrompt(text string) (string, error) {
+	return f.screen(types.ScopePrompts, "prompt", text)
+}
+
+// ScreenResponse implements security.ContentFilter
+func (f *contentFilter) ScreenResponse(text string) (string, error) {
+	return f.screen(types.ScopeResponses, "response", text)
+}
+
+// screen applies the rules covering scope to text. Blocking rules are
+// checked first so that nothing is redacted from text that is refused.
+func (f *contentFilter) screen(scope types.ContentScope, direction string, text string) (string, error) {
+	for _, rule := range f.rules {
+		if rule.action != types.ActionBlock || !rule.covers(scope) {
+			continue
+		}
+		if matches := len(rule.pattern.FindAllStringIndex(text, -1)); matches > 0 {
+			f.audit(rule, direction, matches)
+			return "", fmt.Errorf("%w: %s matched %s filter", ErrContentBlocked, direction, rule.name)
+		}
+	}
+
+	for _, rule := range f.rules {
+		if rule.action != types.ActionRedact || !rule.covers(scope) {
+			continue
+		}
+		matches := 0
+		text = rule.pattern.ReplaceAllStringFunc(text, func(string) string {
+			matches++
+			return "[REDACTED:" + rule.name + "]"
+		})
+		if matches > 0 {
+			f.audit(rule, direction, matches)
+		}
+	}
+	return text, nil
+}
+
+// covers reports whether the rule scans text of scope
+func (r contentRule) covers(scope types.ContentScope) bool {
+	return r.scope == types.ScopeAll || r.scope == scope
+}
+
+// audit records a rule's matches, without the matched text
+func (f *contentFilter) audit(rule contentRule, direction string, matches int) {
+	if f.auditLog == nil {
+		return
+	}
+
+	severity := types.SeverityWarning
+	if rule.action == types.ActionBlock {
+		severity = types.SeverityError
+	}
+	f.auditLog.Log(
+		types.EventContentFiltered,
+		severity,
+		"content_filter",
+		fmt.Sprintf("%s filter matched %d times in %s, action %s", rule.name, matches, direction, rule.action),
+		map[string]interface{}{
+			"filter":    rule.name,
+			"direction": direction,
+			"matches":   matches,
+			"action":    string(rule.action),
+		},
+	)
+}
@@ -0,0 +1,93 @@
+package concrete
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/security"
+	"github.com/butter-bot-machines/skylark/pkg/security/types"
+)
+
+// OpenAuditLogger creates an audit logger honoring the configured failure
+// policy. When the log cannot be opened, fail-closed returns the error while
+// warn returns a degraded logger that discards events. The returned status
+// describes the outcome; the logger is nil when audit logging is disabled.
+func OpenAuditLogger(cfg *config.Config) (security.AuditLogger, types.ComponentStatus, error) {
+	policy := cfg.Security.AuditLog.OnFailure.Resolve()
+	status := types.ComponentStatus{
+		Name:   "audit_log",
+		State:  types.StateDisabled,
+		Policy: policy,
+	}
+	if !cfg.Security.AuditLog.Enabled {
+		return nil, status, nil
+	}
+
+	logger, err := NewAuditLogger(cfg)
+	if err != nil {
+		if policy == types.PolicyFailClosed {
+			status.State = types.StateDegraded
+			status.Reason = err.Error()
+			return nil, status, err
+		}
+
+		slog.Warn("audit log unavailable, continuing without security logging",
+			"path", cfg.Security.AuditLog.Path,
+			"error", err)
+		degraded := &degradedAuditLogger{reason: err.Error()}
+		return degraded, degraded.Status(), nil
+	}
+
+	return logger, logger.(security.StatusReporter).Status(), nil
+}
+
+// degradedAuditLogger implements security.AuditLogger when the audit log is
+// unavailable under the warn policy. Events are counted and discarded.
+type degradedAuditLogger struct {
+	mu      sync.Mutex
+	reason  string
+	dropped uint64
+}
+
+// Log implements security.AuditLogger
+func (d *degradedAuditLogger) Log(types.EventType, types.Severity, string, string, map[string]interface{}) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dropped++
+	return nil
+}
+
+// Query implements security.AuditLogger
+func (d *degradedAuditLogger) Query(security.EventFilter) ([]*types.Event, error) {
+	return nil, nil
+}
+
+// Export implements security.AuditLogger
+func (d *degradedAuditLogger) Export(io.Writer) error {
+	return nil
+}
+
+// Rotate implements security.AuditLogger
+func (d *degradedAuditLogger) Rotate() error {
+	return nil
+}
+
+// Close implements security.AuditLogger
+func (d *degradedAuditLogger) Close() error {
+	return nil
+}
+
+// Status implements security.StatusReporter
+func (d *degradedAuditLogger) Status() types.ComponentStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return types.ComponentStatus{
+		Name:   "audit_log",
+		State:  types.StateDegraded,
+		Policy: types.PolicyWarn,
+		Reason: fmt.Sprintf("%s (%d events dropped)", d.reason, d.dropped),
+	}
+}
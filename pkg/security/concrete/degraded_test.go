@@ -0,0 +1,145 @@
+package concrete
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/security"
+	"github.com/butter-bot-machines/skylark/pkg/security/types"
+)
+
+func TestOpenAuditLogger(t *testing.T) {
+	// A regular file used as a parent directory makes the log unopenable
+	tmpDir := t.TempDir()
+	blocker := filepath.Join(tmpDir, "blocker")
+	if err := os.WriteFile(blocker, []byte("x"), 0644); err != nil {
+		t.Fatalf("Failed to create blocker file: %v", err)
+	}
+	unwritable := filepath.Join(blocker, "audit.log")
+
+	t.Run("disabled", func(t *testing.T) {
+		cfg := &config.Config{}
+		log, status, err := OpenAuditLogger(cfg)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if log != nil {
+			t.Error("Expected nil logger when disabled")
+		}
+		if status.State != types.StateDisabled {
+			t.Errorf("Expected disabled state, got %s", status.State)
+		}
+	})
+
+	t.Run("healthy", func(t *testing.T) {
+		cfg := &config.Config{
+			Security: types.SecurityConfig{
+				AuditLog: types.AuditLogConfig{
+					Enabled: true,
+					Path:    filepath.Join(tmpDir, "audit.log"),
+				},
+			},
+		}
+		log, status, err := OpenAuditLogger(cfg)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer log.Close()
+		if status.State != types.StateOK {
+			t.Errorf("Expected ok state, got %s", status.State)
+		}
+	})
+
+	t.Run("warn policy degrades", func(t *testing.T) {
+		cfg := &config.Config{
+			Security: types.SecurityConfig{
+				AuditLog: types.AuditLogConfig{
+					Enabled: true,
+					Path:    unwritable,
+				},
+			},
+		}
+		log, status, err := OpenAuditLogger(cfg)
+		if err != nil {
+			t.Fatalf("Expected warn policy to continue, got error: %v", err)
+		}
+		if log == nil {
+			t.Fatal("Expected degraded logger")
+		}
+		if !status.Degraded() || status.Policy != types.PolicyWarn {
+			t.Errorf("Expected degraded status with warn policy, got %+v", status)
+		}
+		if err := log.Log(types.EventAccessDenied, types.SeverityWarning, "test", "dropped", nil); err != nil {
+			t.Errorf("Degraded logger should not fail: %v", err)
+		}
+	})
+
+	t.Run("fail-closed policy errors", func(t *testing.T) {
+		cfg := &config.Config{
+			Security: types.SecurityConfig{
+				AuditLog: types.AuditLogConfig{
+					Enabled:   true,
+					Path:      unwritable,
+					OnFailure: types.PolicyFailClosed,
+				},
+			},
+		}
+		log, status, err := OpenAuditLogger(cfg)
+		if err == nil {
+			t.Fatal("Expected error with fail-closed policy")
+		}
+		if log != nil {
+			t.Error("Expected no logger with fail-closed policy")
+		}
+		if !status.Degraded() {
+			t.Errorf("Expected degraded status, got %s", status.State)
+		}
+	})
+}
+
+func TestAuditLoggerRuntimeFailure(t *testing.T) {
+	newLogger := func(t *testing.T, policy types.FailurePolicy) *auditLogger {
+		cfg := &config.Config{
+			Security: types.SecurityConfig{
+				AuditLog: types.AuditLogConfig{
+					Enabled:   true,
+					Path:      filepath.Join(t.TempDir(), "audit.log"),
+					OnFailure: policy,
+				},
+			},
+		}
+		log, err := NewAuditLogger(cfg)
+		if err != nil {
+			t.Fatalf("Failed to create audit log: %v", err)
+		}
+		a := log.(*auditLogger)
+		// Break the underlying file and force the next Log to flush
+		a.file.Close()
+		a.lastFlush = time.Now().Add(-time.Minute)
+		return a
+	}
+
+	t.Run("warn", func(t *testing.T) {
+		a := newLogger(t, types.PolicyWarn)
+		if err := a.Log(types.EventFileAccess, types.SeverityInfo, "test", "event", nil); err != nil {
+			t.Errorf("Expected warn policy to swallow write error, got %v", err)
+		}
+		var reporter security.StatusReporter = a
+		if !reporter.Status().Degraded() {
+			t.Error("Expected logger to be degraded after write failure")
+		}
+	})
+
+	t.Run("fail-closed", func(t *testing.T) {
+		a := newLogger(t, types.PolicyFailClosed)
+		if err := a.Log(types.EventFileAccess, types.SeverityInfo, "test", "event", nil); err == nil {
+			t.Error("Expected fail-closed policy to return write error")
+		}
+		if a.Status().Degraded() {
+			t.Error("Fail-closed logger should report errors rather than degrade")
+		}
+	})
+}
@@ -23,22 +23,22 @@ var (
 
 // fileGuard implements security.FileGuard
 type fileGuard struct {
-	mu            sync.RWMutex
-	config        types.FilePermissionsConfig
-	auditLog      security.AuditLogger
-	allowedPaths  []string // Normalized absolute paths
-	blockedPaths  []string // Normalized absolute paths
-	maxFileSize   int64
-	allowSymlinks bool
+	mu           sync.RWMutex
+	config       types.FilePermissionsConfig
+	auditLog     security.AuditLogger
+	allowedPaths []string // Normalized absolute paths
+	blockedPaths []string // Normalized absolute paths
+	maxFileSize  int64
+	symlinks     types.SymlinkPolicy
 }
 
 // NewFileGuard creates a new file access controller
 func NewFileGuard(cfg *config.Config, auditLog security.AuditLogger) (security.FileGuard, error) {
 	guard := &fileGuard{
-		auditLog:      auditLog,
-		config:        cfg.Security.FilePermissions,
-		maxFileSize:   cfg.Security.FilePermissions.MaxFileSize,
-		allowSymlinks: cfg.Security.FilePermissions.AllowSymlinks,
+		auditLog:    auditLog,
+		config:      cfg.Security.FilePermissions,
+		maxFileSize: cfg.Security.FilePermissions.MaxFileSize,
+		symlinks:    cfg.Security.FilePermissions.AllowSymlinks.Resolve(),
 	}
 
 	// Normalize and validate allowed paths
@@ -51,7 +51,7 @@ func NewFileGuard(cfg *config.Config, auditLog security.AuditLogger) (security.F
 		if err != nil {
 			return nil, fmt.Errorf("invalid allowed path %s: %w", path, err)
 		}
-		guard.allowedPaths = append(guard.allowedPaths, filepath.Clean(absPath))
+		guard.allowedPaths = append(guard.allowedPaths, resolvePath(absPath))
 	}
 
 	// Normalize and validate blocked paths
@@ -64,7 +64,7 @@ func NewFileGuard(cfg *config.Config, auditLog security.AuditLogger) (security.F
 		if err != nil {
 			return nil, fmt.Errorf("invalid blocked path %s: %w", path, err)
 		}
-		guard.blockedPaths = append(guard.blockedPaths, filepath.Clean(absPath))
+		guard.blockedPaths = append(guard.blockedPaths, resolvePath(absPath))
 	}
 
 	return guard, nil
@@ -91,13 +91,21 @@ func (g *fileGuard) CheckWrite(path string) error {
 	return g.validateWrite(path, 0)
 }
 
+// CheckWriteSize implements security.FileGuard
+func (g *fileGuard) CheckWriteSize(path string, size int64) error {
+	if err := g.CheckWrite(path); err != nil {
+		return err
+	}
+	return g.validateWrite(path, size)
+}
+
 // AddAllowedPath implements security.FileGuard
 func (g *fileGuard) AddAllowedPath(path string) error {
 	absPath, err := filepath.Abs(path)
 	if err != nil {
 		return fmt.Errorf("invalid path: %w", err)
 	}
-	cleanPath := filepath.Clean(absPath)
+	cleanPath := resolvePath(absPath)
 
 	g.mu.Lock()
 	defer g.mu.Unlock()
@@ -119,13 +127,13 @@ func (g *fileGuard) RemoveAllowedPath(path string) {
 	if err != nil {
 		return
 	}
-	cleanPath := filepath.Clean(absPath)
+	cleanPath := resolvePath(absPath)
 
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
 	for i, allowed := range g.allowedPaths {
-		if allowed == cleanPath {
+		if hostPathStyle.same(allowed, cleanPath) {
 			g.allowedPaths = append(g.allowedPaths[:i], g.allowedPaths[i+1:]...)
 			return
 		}
@@ -149,34 +157,33 @@ func (g *fileGuard) validateAccess(path string, info os.FileInfo) error {
 		return fmt.Errorf("%w: %v", ErrInvalidPath, err)
 	}
 	cleanPath := filepath.Clean(absPath)
+	// Links in the path are followed before comparing it
+	realPath := resolvePath(cleanPath)
 
 	// Check if path is blocked
 	for _, blocked := range g.blockedPaths {
-		if isSubPath(cleanPath, blocked) {
+		if isSubPath(cleanPath, blocked) || isSubPath(realPath, blocked) {
 			g.logAccessDenied(cleanPath, "path is blocked")
 			return fmt.Errorf("%w: path is blocked", ErrBlockedPath)
 		}
 	}
 
 	// Check if path is allowed
-	allowed := false
-	for _, allowedPath := range g.allowedPaths {
-		if isSubPath(cleanPath, allowedPath) {
-			allowed = true
-			break
-		}
-	}
-	if !allowed {
-		g.logAccessDenied(cleanPath, "path not in allowed list")
-		return fmt.Errorf("%w: path not in allowed list", ErrAccessDenied)
+	if err := g.checkAllowed(cleanPath, realPath); err != nil {
+		return err
 	}
 
 	// Check symlinks
-	if !g.allowSymlinks {
+	if g.symlinks == types.SymlinksNever {
 		isLink, err := isSymlink(cleanPath, info)
 		if err != nil {
 			return fmt.Errorf("failed to check symlink: %w", err)
 		}
+		if !isLink {
+			if isLink, err = g.linkedParent(cleanPath); err != nil {
+				return fmt.Errorf("failed to check symlink: %w", err)
+			}
+		}
 		if isLink {
 			g.logAccessDenied(cleanPath, "symlinks not allowed")
 			return fmt.Errorf("%w: symlinks not allowed", ErrSymlinkDenied)
@@ -202,26 +209,32 @@ func (g *fileGuard) validateWrite(path string, size int64) error {
 		return fmt.Errorf("%w: %v", ErrInvalidPath, err)
 	}
 	cleanPath := filepath.Clean(absPath)
+	// Links in the path are followed before comparing it
+	realPath := resolvePath(cleanPath)
 
 	// Check if path is blocked
 	for _, blocked := range g.blockedPaths {
-		if isSubPath(cleanPath, blocked) {
+		if isSubPath(cleanPath, blocked) || isSubPath(realPath, blocked) {
 			g.logAccessDenied(cleanPath, "path is blocked")
 			return fmt.Errorf("%w: path is blocked", ErrBlockedPath)
 		}
 	}
 
 	// Check if path is allowed
-	allowed := false
-	for _, allowedPath := range g.allowedPaths {
-		if isSubPath(cleanPath, allowedPath) {
-			allowed = true
-			break
-		}
+	if err := g.checkAllowed(cleanPath, realPath); err != nil {
+		return err
 	}
-	if !allowed {
-		g.logAccessDenied(cleanPath, "path not in allowed list")
-		return fmt.Errorf("%w: path not in allowed list", ErrAccessDenied)
+
+	// Check symlinks in the directories the file goes in
+	if g.symlinks == types.SymlinksNever {
+		isLink, err := g.linkedParent(cleanPath)
+		if err != nil {
+			return fmt.Errorf("failed to check symlink: %w", err)
+		}
+		if isLink {
+			g.logAccessDenied(cleanPath, "symlinks not allowed")
+			return fmt.Errorf("%w: symlinks not allowed", ErrSymlinkDenied)
+		}
 	}
 
 	// Check file size
@@ -233,23 +246,36 @@ func (g *fileGuard) validateWrite(path string, size int64) error {
 	return nil
 }
 
-// Helper functions
-
-func isSubPath(child, parent string) bool {
-	childParts := strings.Split(filepath.Clean(child), string(filepath.Separator))
-	parentParts := strings.Split(filepath.Clean(parent), string(filepath.Separator))
-
-	if len(childParts) < len(parentParts) {
-		return false
+// checkAllowed verifies that a path, and unless symlinks may lead anywhere
+// the real path it resolves to, are in allowed paths
+func (g *fileGuard) checkAllowed(cleanPath, realPath string) error {
+	if !g.inAllowedPaths(cleanPath) && !g.inAllowedPaths(realPath) {
+		g.logAccessDenied(cleanPath, "path not in allowed list")
+		return fmt.Errorf("%w: path not in allowed list", ErrAccessDenied)
+	}
+	if g.symlinks != types.SymlinksAny && !g.inAllowedPaths(realPath) {
+		g.logAccessDenied(cleanPath, fmt.Sprintf("symlink target %s not in allowed list", realPath))
+		return fmt.Errorf("%w: symlink target not in allowed list", ErrSymlinkDenied)
 	}
+	return nil
+}
 
-	for i := range parentParts {
-		if childParts[i] != parentParts[i] {
-			return false
+// inAllowedPaths reports whether path is inside an allowed path
+func (g *fileGuard) inAllowedPaths(path string) bool {
+	for _, allowed := range g.allowedPaths {
+		if isSubPath(path, allowed) {
+			return true
 		}
 	}
+	return false
+}
 
-	return true
+// Helper functions
+
+// isSubPath reports whether child is parent or inside it, comparing paths
+// as the platform does
+func isSubPath(child, parent string) bool {
+	return hostPathStyle.contains(parent, child)
 }
 
 func isSymlink(path string, info os.FileInfo) (bool, error) {
@@ -263,6 +289,34 @@ func isSymlink(path string, info os.FileInfo) (bool, error) {
 	return info.Mode()&os.ModeSymlink != 0, nil
 }
 
+// linkedParent reports whether a directory path is in is a symlink, up to
+// the allowed path containing it. Links above allowed paths, such as those
+// of the system's temporary directory, are left to the host.
+func (g *fileGuard) linkedParent(path string) (bool, error) {
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		info, err := os.Lstat(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+		if info != nil && info.Mode()&os.ModeSymlink != 0 {
+			return true, nil
+		}
+		if g.isAllowedPath(resolvePath(dir)) || filepath.Dir(dir) == dir {
+			return false, nil
+		}
+	}
+}
+
+// isAllowedPath reports whether path is one of the allowed paths
+func (g *fileGuard) isAllowedPath(path string) bool {
+	for _, allowed := range g.allowedPaths {
+		if hostPathStyle.same(allowed, path) {
+			return true
+		}
+	}
+	return false
+}
+
 func (g *fileGuard) logAccessDenied(path, reason string) {
 	if g.auditLog == nil {
 		return
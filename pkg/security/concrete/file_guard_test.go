@@ -48,7 +48,7 @@ func TestFileGuard(t *testing.T) {
 			FilePermissions: types.FilePermissionsConfig{
 				AllowedPaths:  []string{allowedDir},
 				BlockedPaths:  []string{blockedDir},
-				AllowSymlinks: false,
+				AllowSymlinks: types.SymlinksNever,
 				MaxFileSize:   1024,
 			},
 			AuditLog: types.AuditLogConfig{
@@ -102,7 +102,7 @@ func TestFileGuard(t *testing.T) {
 		}
 
 		// Test with symlinks allowed
-		cfg.Security.FilePermissions.AllowSymlinks = true
+		cfg.Security.FilePermissions.AllowSymlinks = types.SymlinksWithinAllowed
 		fg, err = NewFileGuard(cfg, auditLog)
 		if err != nil {
 			t.Fatalf("Failed to create file guard: %v", err)
@@ -147,6 +147,14 @@ func TestFileGuard(t *testing.T) {
 		} else if !errors.Is(err, ErrBlockedPath) {
 			t.Errorf("Expected ErrBlockedPath, got: %v", err)
 		}
+
+		// Test oversized write
+		err = guard.CheckWriteSize(filepath.Join(allowedDir, "new.txt"), 2048)
+		if err == nil {
+			t.Error("Expected oversized write to be denied")
+		} else if !errors.Is(err, ErrFileTooLarge) {
+			t.Errorf("Expected ErrFileTooLarge, got: %v", err)
+		}
 	})
 
 	// Test adding allowed paths
@@ -250,3 +258,77 @@ func TestFileGuardErrors(t *testing.T) {
 		}
 	})
 }
+
+func TestFileGuardSymlinkPolicy(t *testing.T) {
+	tmpDir := t.TempDir()
+	allowedDir := filepath.Join(tmpDir, "allowed")
+	outsideDir := filepath.Join(tmpDir, "outside")
+	for _, dir := range []string{allowedDir, outsideDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create test directories: %v", err)
+		}
+	}
+	inside := filepath.Join(allowedDir, "notes.txt")
+	outside := filepath.Join(outsideDir, "notes.txt")
+	for _, file := range []string{inside, outside} {
+		if err := os.WriteFile(file, []byte("notes"), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	insideLink := filepath.Join(allowedDir, "inside.txt")
+	outsideLink := filepath.Join(allowedDir, "outside.txt")
+	if err := os.Symlink(inside, insideLink); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+	if err := os.Symlink(outside, outsideLink); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	// A linked directory leads to files that are not links themselves
+	linkedDir := filepath.Join(allowedDir, "linked")
+	if err := os.Symlink(allowedDir, linkedDir); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	throughDir := filepath.Join(linkedDir, "notes.txt")
+
+	tests := []struct {
+		policy     types.SymlinkPolicy
+		wantInside error
+		wantEscape error
+		wantParent error
+	}{
+		{policy: "", wantInside: ErrSymlinkDenied, wantEscape: ErrSymlinkDenied, wantParent: ErrSymlinkDenied},
+		{policy: types.SymlinksNever, wantInside: ErrSymlinkDenied, wantEscape: ErrSymlinkDenied, wantParent: ErrSymlinkDenied},
+		{policy: types.SymlinksWithinAllowed, wantInside: nil, wantEscape: ErrSymlinkDenied, wantParent: nil},
+		{policy: types.SymlinksAny, wantInside: nil, wantEscape: nil, wantParent: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			guard, err := NewFileGuard(&config.Config{
+				Security: types.SecurityConfig{
+					FilePermissions: types.FilePermissionsConfig{
+						AllowedPaths:  []string{allowedDir},
+						AllowSymlinks: tt.policy,
+						MaxFileSize:   1024,
+					},
+				},
+			}, nil)
+			if err != nil {
+				t.Fatalf("Failed to create file guard: %v", err)
+			}
+
+			if err := guard.CheckRead(insideLink); !errors.Is(err, tt.wantInside) {
+				t.Errorf("Expected %v for a link within allowed paths, got: %v", tt.wantInside, err)
+			}
+			if err := guard.CheckRead(outsideLink); !errors.Is(err, tt.wantEscape) {
+				t.Errorf("Expected %v for a link leaving allowed paths, got: %v", tt.wantEscape, err)
+			}
+			if err := guard.CheckRead(throughDir); !errors.Is(err, tt.wantParent) {
+				t.Errorf("Expected %v for a file in a linked directory, got: %v", tt.wantParent, err)
+			}
+			if err := guard.CheckWrite(filepath.Join(linkedDir, "new.txt")); !errors.Is(err, tt.wantParent) {
+				t.Errorf("Expected %v for a new file in a linked directory, got: %v", tt.wantParent, err)
+			}
+		})
+	}
+}
@@ -73,14 +73,14 @@ func NewKeyStore(cfg *config.Config) (security.KeyStore, error) {
 	}
 
 	// Create storage directory if needed
-	storageDir := filepath.Dir(cfg.Security.KeyStoragePath)
+	storageDir := filepath.Dir(cfg.KeyStorePath())
 	if err := os.MkdirAll(storageDir, 0700); err != nil {
 		return nil, fmt.Errorf("failed to create storage directory: %w", err)
 	}
 
 	ks := &keyStore{
 		keys:     make(map[string]Key),
-		filepath: cfg.Security.KeyStoragePath,
+		filepath: cfg.KeyStorePath(),
 		cipher:   gcm,
 	}
 
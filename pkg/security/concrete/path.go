@@ -0,0 +1,147 @@
+package concrete
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// pathStyle describes how a platform names and compares file paths
+type pathStyle struct {
+	windows  bool // Backslash separators, drive letters and UNC volumes
+	foldCase bool // Names differing only in case refer to the same file
+}
+
+// hostPathStyle is the path style of the running platform. macOS volumes
+// are case-insensitive unless formatted otherwise.
+var hostPathStyle = pathStyleFor(runtime.GOOS)
+
+// pathStyleFor returns the path style of the platform goos
+func pathStyleFor(goos string) pathStyle {
+	switch goos {
+	case "windows":
+		return pathStyle{windows: true, foldCase: true}
+	case "darwin", "ios":
+		return pathStyle{foldCase: true}
+	default:
+		return pathStyle{}
+	}
+}
+
+// contains reports whether child is parent or a path inside it. Both must
+// be absolute; relative, drive-relative and drive-less rooted Windows paths
+// are never contained.
+func (s pathStyle) contains(parent, child string) bool {
+	parentVolume, parentElems, ok := s.split(parent)
+	if !ok {
+		return false
+	}
+	childVolume, childElems, ok := s.split(child)
+	if !ok || !s.equal(parentVolume, childVolume) || len(childElems) < len(parentElems) {
+		return false
+	}
+	for i := range parentElems {
+		if !s.equal(parentElems[i], childElems[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// same reports whether a and b name the same absolute path
+func (s pathStyle) same(a, b string) bool {
+	return s.contains(a, b) && s.contains(b, a)
+}
+
+// equal compares two path elements
+func (s pathStyle) equal(a, b string) bool {
+	if s.foldCase {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// split returns the volume of an absolute path and its elements with "."
+// and ".." resolved, or false when path is not absolute
+func (s pathStyle) split(path string) (volume string, elems []string, ok bool) {
+	if !s.windows {
+		if !strings.HasPrefix(path, "/") {
+			return "", nil, false
+		}
+		return "", cleanElems(strings.Split(path, "/")), true
+	}
+
+	path = strings.ReplaceAll(path, "/", `\`)
+	var rest []string
+	switch {
+	case strings.HasPrefix(path, `\\`):
+		parts := strings.Split(path[2:], `\`)
+		// \\?\ and \\.\ prefix a drive path or \UNC\server\share
+		if len(parts) > 1 && (parts[0] == "?" || parts[0] == ".") {
+			if isDrive(parts[1]) {
+				return parts[1], cleanElems(parts[2:]), true
+			}
+			if !strings.EqualFold(parts[1], "UNC") {
+				return "", nil, false
+			}
+			parts = parts[2:]
+		}
+		if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+			return "", nil, false
+		}
+		volume, rest = `\\`+parts[0]+`\`+parts[1], parts[2:]
+	case len(path) >= 2 && isDrive(path[:2]):
+		// C:notes is relative to the current directory of drive C
+		if len(path) == 2 || path[2] != '\\' {
+			return "", nil, false
+		}
+		volume, rest = path[:2], strings.Split(path[3:], `\`)
+	default:
+		return "", nil, false
+	}
+	return volume, cleanElems(rest), true
+}
+
+// isDrive reports whether s is a drive letter followed by a colon
+func isDrive(s string) bool {
+	if len(s) != 2 || s[1] != ':' {
+		return false
+	}
+	c := s[0] | 0x20
+	return c >= 'a' && c <= 'z'
+}
+
+// cleanElems drops empty and "." elements and applies ".." elements,
+// which stop at the root
+func cleanElems(parts []string) []string {
+	elems := []string{}
+	for _, part := range parts {
+		switch part {
+		case "", ".":
+		case "..":
+			if len(elems) > 0 {
+				elems = elems[:len(elems)-1]
+			}
+		default:
+			elems = append(elems, part)
+		}
+	}
+	return elems
+}
+
+// resolvePath returns the absolute path with the symlinks of its existing
+// part evaluated, so that links cannot lead outside allowed paths
+func resolvePath(path string) string {
+	var rest []string
+	for p := path; ; {
+		if resolved, err := filepath.EvalSymlinks(p); err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...)
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return path
+		}
+		rest = append([]string{filepath.Base(p)}, rest...)
+		p = parent
+	}
+}
@@ -0,0 +1,93 @@
+package concrete
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/security/types"
+)
+
+func TestPathStyleContains(t *testing.T) {
+	windows := pathStyleFor("windows")
+	darwin := pathStyleFor("darwin")
+	linux := pathStyleFor("linux")
+
+	tests := []struct {
+		name   string
+		style  pathStyle
+		parent string
+		child  string
+		want   bool
+	}{
+		{name: "windows case", style: windows, parent: `c:\users\ME`, child: `C:\Users\me\notes.md`, want: true},
+		{name: "windows separators", style: windows, parent: `C:\Users`, child: `C:/Users/me`, want: true},
+		{name: "windows drive root", style: windows, parent: `C:\`, child: `c:\Windows`, want: true},
+		{name: "windows other drive", style: windows, parent: `C:\Users`, child: `D:\Users\me`, want: false},
+		{name: "windows drive-relative", style: windows, parent: `C:\Users`, child: `C:Users\me`, want: false},
+		{name: "windows drive-relative parent", style: windows, parent: `C:`, child: `C:\Users`, want: false},
+		{name: "windows rooted without drive", style: windows, parent: `C:\Users`, child: `\Users\me`, want: false},
+		{name: "windows traversal", style: windows, parent: `C:\Users`, child: `C:\Users\me\..\..\Windows`, want: false},
+		{name: "windows prefix", style: windows, parent: `C:\Users`, child: `C:\Users2`, want: false},
+		{name: "UNC", style: windows, parent: `\\SERVER\share\docs`, child: `\\server\Share\docs\a.md`, want: true},
+		{name: "UNC other share", style: windows, parent: `\\server\share`, child: `\\server\other\docs`, want: false},
+		{name: "UNC traversal", style: windows, parent: `\\server\share\docs`, child: `\\server\share\docs\..\..\other`, want: false},
+		{name: "UNC without share", style: windows, parent: `\\server`, child: `\\server\share`, want: false},
+		{name: "extended drive path", style: windows, parent: `C:\Users`, child: `\\?\C:\Users\me`, want: true},
+		{name: "extended UNC path", style: windows, parent: `\\server\share`, child: `\\?\UNC\server\share\a.md`, want: true},
+		{name: "UNC is not a drive", style: windows, parent: `C:\share`, child: `\\C:\share`, want: false},
+		{name: "darwin case", style: darwin, parent: "/users/me", child: "/Users/Me/Notes", want: true},
+		{name: "linux case", style: linux, parent: "/home/me", child: "/home/Me", want: false},
+		{name: "linux relative", style: linux, parent: "/home/me", child: "home/me", want: false},
+		{name: "linux traversal", style: linux, parent: "/home/me", child: "/home/me/../other", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.style.contains(tt.parent, tt.child); got != tt.want {
+				t.Errorf("Expected contains(%q, %q) = %v, got %v", tt.parent, tt.child, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFileGuardResolvesSymlinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	allowedDir := filepath.Join(tmpDir, "allowed")
+	blockedDir := filepath.Join(tmpDir, "allowed", "private")
+	if err := os.MkdirAll(blockedDir, 0755); err != nil {
+		t.Fatalf("Failed to create test directories: %v", err)
+	}
+	secret := filepath.Join(blockedDir, "secret.txt")
+	if err := os.WriteFile(secret, []byte("secret"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	link := filepath.Join(allowedDir, "public")
+	if err := os.Symlink(blockedDir, link); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+
+	guard, err := NewFileGuard(&config.Config{
+		Security: types.SecurityConfig{
+			FilePermissions: types.FilePermissionsConfig{
+				AllowedPaths:  []string{allowedDir},
+				BlockedPaths:  []string{blockedDir},
+				AllowSymlinks: types.SymlinksWithinAllowed,
+				MaxFileSize:   1024,
+			},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create file guard: %v", err)
+	}
+
+	// A linked directory leads into the blocked path
+	if err := guard.CheckRead(filepath.Join(link, "secret.txt")); !errors.Is(err, ErrBlockedPath) {
+		t.Errorf("Expected ErrBlockedPath, got: %v", err)
+	}
+	if err := guard.CheckWrite(filepath.Join(link, "new.txt")); !errors.Is(err, ErrBlockedPath) {
+		t.Errorf("Expected ErrBlockedPath for write, got: %v", err)
+	}
+}
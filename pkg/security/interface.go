@@ -48,6 +48,12 @@ type AuditLogger interface {
 	Close() error
 }
 
+// StatusReporter reports the availability of a component
+type StatusReporter interface {
+	// Status returns the component's current status
+	Status() types.ComponentStatus
+}
+
 // KeyStore manages security keys
 type KeyStore interface {
 	// Get retrieves a key by name
@@ -74,6 +80,9 @@ type FileGuard interface {
 	// CheckWrite verifies write access to a path
 	CheckWrite(path string) error
 
+	// CheckWriteSize verifies write access to a path for size bytes
+	CheckWriteSize(path string, size int64) error
+
 	// AddAllowedPath adds a path to allowed paths
 	AddAllowedPath(path string) error
 
@@ -84,6 +93,18 @@ type FileGuard interface {
 	Close() error
 }
 
+// ContentFilter screens text exchanged with model providers for secrets
+// and personal data
+type ContentFilter interface {
+	// ScreenPrompt returns text to be sent with matches redacted, or an
+	// error when a blocking rule matches
+	ScreenPrompt(text string) (string, error)
+
+	// ScreenResponse returns a received response with matches redacted,
+	// or an error when a blocking rule matches
+	ScreenResponse(text string) (string, error)
+}
+
 // ResourceGuard controls resource usage
 type ResourceGuard interface {
 	// Check verifies resource usage
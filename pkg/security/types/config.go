@@ -1,24 +1,80 @@
 package types
 
+import "gopkg.in/yaml.v3"
+
 // FilePermissionsConfig defines file permission settings
 type FilePermissionsConfig struct {
-	Default       int      `yaml:"default"`
-	Private       int      `yaml:"private"`
-	Public        int      `yaml:"public"`
-	AllowedPaths  []string `yaml:"allowed_paths"`
-	BlockedPaths  []string `yaml:"blocked_paths"`
-	AllowSymlinks bool     `yaml:"allow_symlinks"`
-	MaxFileSize   int64    `yaml:"max_file_size"`
+	Default       int           `yaml:"default"`
+	Private       int           `yaml:"private"`
+	Public        int           `yaml:"public"`
+	AllowedPaths  []string      `yaml:"allowed_paths"`
+	BlockedPaths  []string      `yaml:"blocked_paths"`
+	AllowSymlinks SymlinkPolicy `yaml:"allow_symlinks"` // never (default), within-allowed or any
+	MaxFileSize   int64         `yaml:"max_file_size"`
+}
+
+// SymlinkPolicy defines which symlinks the file guard follows
+type SymlinkPolicy string
+
+const (
+	// SymlinksNever refuses paths that are symlinks
+	SymlinksNever SymlinkPolicy = "never"
+	// SymlinksWithinAllowed follows symlinks whose targets are in allowed paths
+	SymlinksWithinAllowed SymlinkPolicy = "within-allowed"
+	// SymlinksAny follows symlinks wherever they lead, except into blocked paths
+	SymlinksAny SymlinkPolicy = "any"
+)
+
+// Resolve returns the effective policy, defaulting to SymlinksNever
+func (p SymlinkPolicy) Resolve() SymlinkPolicy {
+	if p == "" {
+		return SymlinksNever
+	}
+	return p
+}
+
+// Valid reports whether the policy is empty or a known value
+func (p SymlinkPolicy) Valid() bool {
+	return p == "" || p == SymlinksNever || p == SymlinksWithinAllowed || p == SymlinksAny
+}
+
+// UnmarshalYAML accepts a policy name, or a boolean as written by earlier
+// configurations: true follows symlinks within allowed paths, false never
+func (p *SymlinkPolicy) UnmarshalYAML(value *yaml.Node) error {
+	if value.Tag == "!!bool" {
+		var allow bool
+		if err := value.Decode(&allow); err != nil {
+			return err
+		}
+		*p = SymlinksNever
+		if allow {
+			*p = SymlinksWithinAllowed
+		}
+		return nil
+	}
+	var name string
+	if err := value.Decode(&name); err != nil {
+		return err
+	}
+	*p = SymlinkPolicy(name)
+	return nil
 }
 
 // AuditLogConfig defines audit logging settings
 type AuditLogConfig struct {
-	Enabled       bool     `yaml:"enabled"`
-	Path          string   `yaml:"path"`
-	MaxSize       int64    `yaml:"max_size"`
-	Compress      bool     `yaml:"compress"`
-	RetentionDays int      `yaml:"retention_days"`
-	Events        []string `yaml:"events"`
+	Enabled       bool          `yaml:"enabled"`
+	Path          string        `yaml:"path"`
+	MaxSize       int64         `yaml:"max_size"`
+	Compress      bool          `yaml:"compress"`
+	RetentionDays int           `yaml:"retention_days"`
+	Events        []string      `yaml:"events"`
+	OnFailure     FailurePolicy `yaml:"on_failure"` // fail-closed or warn (default)
+
+	// CheckpointSecret signs a checkpoint of the hash chain every
+	// CheckpointInterval events (default 100). No checkpoints are written
+	// without a secret.
+	CheckpointSecret   string `yaml:"checkpoint_secret"`
+	CheckpointInterval int    `yaml:"checkpoint_interval"`
 }
 
 // SecurityConfig defines security settings
@@ -29,4 +85,38 @@ type SecurityConfig struct {
 	EncryptionKey   string                `yaml:"encryption_key"`
 	KeyStoragePath  string                `yaml:"key_storage_path"`
 	AuditLog        AuditLogConfig        `yaml:"audit_log"`
+	ContentFilters  []ContentFilterConfig `yaml:"content_filters"`
+}
+
+// ContentAction defines what happens to text a content filter matches
+type ContentAction string
+
+const (
+	// ActionRedact replaces matches with a placeholder
+	ActionRedact ContentAction = "redact"
+	// ActionBlock refuses to send or insert the text
+	ActionBlock ContentAction = "block"
+)
+
+// Valid reports whether the action is empty or a known value
+func (a ContentAction) Valid() bool {
+	return a == "" || a == ActionRedact || a == ActionBlock
+}
+
+// ContentScope defines which text a content filter scans
+type ContentScope string
+
+const (
+	ScopeAll       ContentScope = ""          // Prompts and responses
+	ScopePrompts   ContentScope = "prompts"   // Text sent to providers
+	ScopeResponses ContentScope = "responses" // Text received from providers
+)
+
+// ContentFilterConfig defines a rule scanning text exchanged with model
+// providers. Without a pattern, Name selects a built-in detector.
+type ContentFilterConfig struct {
+	Name    string        `yaml:"name"`
+	Pattern string        `yaml:"pattern,omitempty"` // Regular expression of a custom rule
+	Action  ContentAction `yaml:"action,omitempty"`  // redact (default) or block
+	Scope   ContentScope  `yaml:"scope,omitempty"`   // prompts, responses or both (default)
 }
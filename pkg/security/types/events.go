@@ -24,10 +24,25 @@ const (
 	EventCPULimit    EventType = "cpu_limit"
 	EventDiskLimit   EventType = "disk_limit"
 
+	// EventBudgetExceeded is logged when provider requests are blocked by
+	// a spending limit
+	EventBudgetExceeded EventType = "budget_exceeded"
+
+	// EventToolQuotaExceeded is logged when a tool call is refused by the
+	// tool's call limits
+	EventToolQuotaExceeded EventType = "tool_quota_exceeded"
+
 	// Security events
-	EventAuthFailure    EventType = "auth_failure"
-	EventAccessDenied   EventType = "access_denied"
-	EventThreatDetected EventType = "threat_detected"
+	EventAuthFailure     EventType = "auth_failure"
+	EventAccessDenied    EventType = "access_denied"
+	EventThreatDetected  EventType = "threat_detected"
+	EventContentFiltered EventType = "content_filtered"
+
+	// EventAPICall is logged for each authenticated call to the server API
+	EventAPICall EventType = "api_call"
+
+	// Audit log events
+	EventAuditCheckpoint EventType = "audit_checkpoint"
 )
 
 // Severity represents the severity level of a security event
@@ -49,6 +64,12 @@ type Event struct {
 	Source    string                 `json:"source"`
 	Details   string                 `json:"details"`
 	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+
+	// Hash chain linking each event to the one logged before it. Hash is
+	// written last and covers the encoded event without it.
+	Seq      uint64 `json:"seq,omitempty"`
+	PrevHash string `json:"prev_hash,omitempty"`
+	Hash     string `json:"hash,omitempty"`
 }
 
 // ResourceUsage represents resource consumption
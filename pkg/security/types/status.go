@@ -0,0 +1,46 @@
+package types
+
+// FailurePolicy defines how a component reacts when it becomes unavailable
+type FailurePolicy string
+
+const (
+	// PolicyFailClosed refuses to continue when the component is unavailable
+	PolicyFailClosed FailurePolicy = "fail-closed"
+	// PolicyWarn logs a warning and continues in degraded mode
+	PolicyWarn FailurePolicy = "warn"
+)
+
+// Resolve returns the effective policy, defaulting to PolicyWarn
+func (p FailurePolicy) Resolve() FailurePolicy {
+	if p == PolicyFailClosed {
+		return PolicyFailClosed
+	}
+	return PolicyWarn
+}
+
+// Valid reports whether the policy is empty or a known value
+func (p FailurePolicy) Valid() bool {
+	return p == "" || p == PolicyFailClosed || p == PolicyWarn
+}
+
+// ComponentState describes the availability of a component
+type ComponentState string
+
+const (
+	StateOK       ComponentState = "ok"
+	StateDegraded ComponentState = "degraded"
+	StateDisabled ComponentState = "disabled"
+)
+
+// ComponentStatus reports the availability of a component
+type ComponentStatus struct {
+	Name   string         `json:"name"`
+	State  ComponentState `json:"state"`
+	Policy FailurePolicy  `json:"policy,omitempty"`
+	Reason string         `json:"reason,omitempty"`
+}
+
+// Degraded reports whether the component is running in degraded mode
+func (s ComponentStatus) Degraded() bool {
+	return s.State == StateDegraded
+}
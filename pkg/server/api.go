@@ -0,0 +1,370 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/access"
+)
+
+const (
+	apiPrefix      = "/api/v1/jobs"
+	defaultMaxJobs = 100
+	maxWait        = time.Minute // Longest ?wait a job request may block for
+	maxSubmission  = 64 << 10    // Bytes of a submission body
+	defaultWorkers = 1
+)
+
+// JobStatus is the state of a job submitted through the API
+type JobStatus string
+
+const (
+	JobQueued  JobStatus = "queued"
+	JobRunning JobStatus = "running"
+	JobDone    JobStatus = "done"
+	JobFailed  JobStatus = "failed"
+)
+
+// finished reports whether the job has a result
+func (s JobStatus) finished() bool {
+	return s == JobDone || s == JobFailed
+}
+
+// Submission is a command submitted through the API
+type Submission struct {
+	Command string `json:"command"`
+	File    string `json:"file,omitempty"`  // Project file the command references or applies to, relative to the project root
+	Apply   bool   `json:"apply,omitempty"` // Write the response into File below the command
+}
+
+// Runner runs a submission and returns the response
+type Runner func(ctx context.Context, s Submission) (string, error)
+
+// APIOptions enables the job API
+type APIOptions struct {
+	Tokens  *access.Store // Bearer tokens accepted; jobs are recorded as submitted by their names
+	Run     Runner
+	Workers int // Jobs run at once (0 = 1)
+	MaxJobs int // Jobs kept with their results (0 = 100)
+}
+
+// Job is a submitted command and, once finished, its result
+type Job struct {
+	ID        string     `json:"id"`
+	Submitter string     `json:"submitter"`
+	Status    JobStatus  `json:"status"`
+	Command   string     `json:"command"`
+	File      string     `json:"file,omitempty"`
+	Apply     bool       `json:"apply,omitempty"`
+	Response  string     `json:"response,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	Submitted time.Time  `json:"submitted"`
+	Started   *time.Time `json:"started,omitempty"`
+	Finished  *time.Time `json:"finished,omitempty"`
+}
+
+// errTooManyJobs is returned when every kept job is still unfinished
+var errTooManyJobs = errors.New("too many unfinished jobs")
+
+// api serves the job endpoints, running jobs in the background
+type api struct {
+	tokens  *access.Store
+	run     Runner
+	slots   chan struct{} // One per job allowed to run at once
+	maxJobs int
+	server  *Server
+
+	ctx    context.Context // Cancelled by Shutdown
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	stream stream
+
+	mu    sync.Mutex
+	jobs  map[string]*Job
+	order []string                 // IDs, oldest first
+	done  map[string]chan struct{} // Closed when the job finishes
+}
+
+func newAPI(opts *APIOptions, s *Server) (*api, error) {
+	if opts.Tokens == nil {
+		return nil, fmt.Errorf("api tokens required")
+	}
+	if opts.Run == nil {
+		return nil, fmt.Errorf("api runner required")
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	maxJobs := opts.MaxJobs
+	if maxJobs <= 0 {
+		maxJobs = defaultMaxJobs
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &api{
+		tokens:  opts.Tokens,
+		run:     opts.Run,
+		slots:   make(chan struct{}, workers),
+		maxJobs: maxJobs,
+		server:  s,
+		ctx:     ctx,
+		cancel:  cancel,
+		jobs:    make(map[string]*Job),
+		done:    make(map[string]chan struct{}),
+	}, nil
+}
+
+// notAllowed answers 405 for a method an endpoint does not support
+func notAllowed(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("%s %s not supported", r.Method, r.URL.Path))
+}
+
+// serveJobs routes /api/v1/jobs and /api/v1/jobs/<id>
+func (a *api) serveJobs(w http.ResponseWriter, r *http.Request, token access.Token) {
+	submitter := token.Name
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, apiPrefix), "/")
+	switch {
+	case id == "" && r.Method == http.MethodPost:
+		a.handleSubmit(w, r, submitter)
+	case id == "" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, a.list(submitter))
+	case id != "" && !strings.Contains(id, "/") && r.Method == http.MethodGet:
+		a.handleJob(w, r, submitter, id)
+	default:
+		notAllowed(w, r)
+	}
+}
+
+func (a *api) handleSubmit(w http.ResponseWriter, r *http.Request, submitter string) {
+	var sub Submission
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSubmission))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&sub); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid submission: %v", err))
+		return
+	}
+	if err := checkSubmission(&sub); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	job, err := a.submit(submitter, sub)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	w.Header().Set("Location", apiPrefix+"/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// handleJob returns a job, waiting up to ?wait for it to finish
+func (a *api) handleJob(w http.ResponseWriter, r *http.Request, submitter, id string) {
+	var wait time.Duration
+	if v := r.URL.Query().Get("wait"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid wait: %q", v))
+			return
+		}
+		wait = min(d, maxWait)
+	}
+
+	job, done := a.get(submitter, id)
+	if job == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("job %s not found", id))
+		return
+	}
+	if wait > 0 && !job.Status.finished() {
+		timer := time.NewTimer(wait)
+		select {
+		case <-done:
+		case <-timer.C:
+		case <-r.Context().Done():
+		}
+		timer.Stop()
+		job, _ = a.get(submitter, id)
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// checkSubmission requires a command and keeps File inside the project
+func checkSubmission(s *Submission) error {
+	s.Command = strings.TrimSpace(s.Command)
+	if s.Command == "" {
+		return fmt.Errorf("command required")
+	}
+	if s.Apply && s.File == "" {
+		return fmt.Errorf("apply requires file")
+	}
+	if s.File != "" {
+		file := path.Clean(filepath.ToSlash(s.File))
+		if path.IsAbs(file) || file == ".." || strings.HasPrefix(file, "../") {
+			return fmt.Errorf("file must be relative to the project root: %s", s.File)
+		}
+		s.File = file
+	}
+	return nil
+}
+
+// submit records a queued job and runs it in the background
+func (a *api) submit(submitter string, sub Submission) (*Job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+	job := &Job{
+		ID:        id,
+		Submitter: submitter,
+		Status:    JobQueued,
+		Command:   sub.Command,
+		File:      sub.File,
+		Apply:     sub.Apply,
+		Submitted: a.server.clock.Now(),
+	}
+
+	a.mu.Lock()
+	if a.ctx.Err() != nil {
+		a.mu.Unlock()
+		return nil, fmt.Errorf("server shutting down")
+	}
+	if err := a.evict(); err != nil {
+		a.mu.Unlock()
+		return nil, err
+	}
+	done := make(chan struct{})
+	a.jobs[id] = job
+	a.order = append(a.order, id)
+	a.done[id] = done
+	snapshot := *job
+	a.wg.Add(1)
+	a.mu.Unlock()
+
+	a.server.logger.Info("job submitted", "id", id, "submitter", submitter, "file", sub.File)
+	a.publishJob(snapshot)
+	go a.execute(job, sub, done)
+	return &snapshot, nil
+}
+
+// evict makes room for a job by dropping the oldest finished ones. It is
+// called with a.mu held.
+func (a *api) evict() error {
+	for len(a.order) >= a.maxJobs {
+		i := 0
+		for i < len(a.order) && !a.jobs[a.order[i]].Status.finished() {
+			i++
+		}
+		if i == len(a.order) {
+			return errTooManyJobs
+		}
+		delete(a.jobs, a.order[i])
+		delete(a.done, a.order[i])
+		a.order = append(a.order[:i], a.order[i+1:]...)
+	}
+	return nil
+}
+
+// execute waits for a free slot, runs the job and records its result
+func (a *api) execute(job *Job, sub Submission, done chan struct{}) {
+	defer a.wg.Done()
+	defer close(done)
+
+	select {
+	case a.slots <- struct{}{}:
+		defer func() { <-a.slots }()
+	case <-a.ctx.Done():
+		a.finish(job, "", fmt.Errorf("server shut down before the job started"))
+		return
+	}
+
+	started := a.server.clock.Now()
+	a.mu.Lock()
+	job.Status = JobRunning
+	job.Started = &started
+	snapshot := *job
+	a.mu.Unlock()
+	a.publishJob(snapshot)
+
+	response, err := a.run(a.ctx, sub)
+	a.finish(job, response, err)
+}
+
+// finish records the result of job
+func (a *api) finish(job *Job, response string, err error) {
+	finished := a.server.clock.Now()
+	a.mu.Lock()
+	job.Finished = &finished
+	job.Response = response
+	job.Status = JobDone
+	if err != nil {
+		job.Status = JobFailed
+		job.Error = err.Error()
+	}
+	snapshot := *job
+	a.mu.Unlock()
+	a.publishJob(snapshot)
+
+	if err != nil {
+		a.server.logger.Warn("job failed", "id", job.ID, "submitter", job.Submitter, "error", err)
+	} else {
+		a.server.logger.Info("job finished", "id", job.ID, "submitter", job.Submitter)
+	}
+}
+
+// get returns a copy of the job if it was submitted by submitter, and the
+// channel closed when it finishes
+func (a *api) get(submitter, id string) (*Job, <-chan struct{}) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	job, ok := a.jobs[id]
+	if !ok || job.Submitter != submitter {
+		return nil, nil
+	}
+	snapshot := *job
+	return &snapshot, a.done[id]
+}
+
+// list returns the jobs of submitter, newest first
+func (a *api) list(submitter string) []Job {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	jobs := []Job{}
+	for i := len(a.order) - 1; i >= 0; i-- {
+		if job := a.jobs[a.order[i]]; job.Submitter == submitter {
+			jobs = append(jobs, *job)
+		}
+	}
+	return jobs
+}
+
+// shutdown ends event streams, cancels running jobs, fails queued ones
+// and waits for the jobs
+func (a *api) shutdown() {
+	a.mu.Lock()
+	a.cancel()
+	a.mu.Unlock()
+	a.wg.Wait()
+}
+
+// newJobID returns a random job ID
+func newJobID() (string, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate job id: %w", err)
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// writeError writes an {"error": msg} response
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
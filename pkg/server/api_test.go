@@ -0,0 +1,220 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/access"
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+	"github.com/butter-bot-machines/skylark/pkg/logging/memory"
+	"github.com/butter-bot-machines/skylark/pkg/worker"
+)
+
+const (
+	aliceToken = "alice-0123456789abcdef"
+	bobToken   = "bob-0123456789abcdef"
+	carolToken = "carol-0123456789abcdef" // Allowed to read status only
+)
+
+// testTokens returns a token store in which alice and bob hold every
+// scope and carol may only read status
+func testTokens(t *testing.T) *access.Store {
+	t.Helper()
+	return access.NewStore(filepath.Join(t.TempDir(), "tokens.json"), []access.Token{
+		access.Fixed("alice", aliceToken, access.Scopes),
+		access.Fixed("bob", bobToken, access.Scopes),
+		access.Fixed("carol", carolToken, []access.Scope{access.ReadStatus}),
+	})
+}
+
+// newAPIServer creates a server whose job API answers with run
+func newAPIServer(t *testing.T, run Runner, maxJobs int) *Server {
+	t.Helper()
+	srv, err := New(Options{
+		Addr:   "127.0.0.1:0",
+		Stats:  func() worker.Stats { return worker.Stats{} },
+		Logger: memory.NewLogger(logging.LevelDebug, io.Discard),
+		API: &APIOptions{
+			Tokens:  testTokens(t),
+			Run:     run,
+			MaxJobs: maxJobs,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+	return srv
+}
+
+// call performs an authenticated request against h and decodes the JSON
+// response into v
+func call(t *testing.T, h http.Handler, method, path, token, body string, v interface{}) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if v != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("Failed to decode %s %s response: %v\n%s", method, path, err, rec.Body.String())
+		}
+	}
+	return rec.Code
+}
+
+func TestAPIJobs(t *testing.T) {
+	var got Submission
+	srv := newAPIServer(t, func(ctx context.Context, s Submission) (string, error) {
+		got = s
+		if strings.Contains(s.Command, "fail") {
+			return "", fmt.Errorf("assistant unavailable")
+		}
+		return "response to " + s.Command, nil
+	}, 0)
+	h := srv.Handler()
+
+	var job Job
+	code := call(t, h, http.MethodPost, "/api/v1/jobs", aliceToken, `{"command":"!summarize #Notes","file":"./notes/today.md","apply":true}`, &job)
+	if code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", code)
+	}
+	if job.Submitter != "alice" || job.Status != JobQueued || job.File != "notes/today.md" {
+		t.Errorf("Expected a queued job of alice for notes/today.md, got %+v", job)
+	}
+
+	code = call(t, h, http.MethodGet, "/api/v1/jobs/"+job.ID+"?wait=5s", aliceToken, "", &job)
+	if code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", code)
+	}
+	if job.Status != JobDone || job.Response != "response to !summarize #Notes" || job.Finished == nil {
+		t.Errorf("Expected the finished job with its response, got %+v", job)
+	}
+	if !got.Apply || got.File != "notes/today.md" {
+		t.Errorf("Expected the runner to get the submission, got %+v", got)
+	}
+
+	call(t, h, http.MethodPost, "/api/v1/jobs", aliceToken, `{"command":"!fail"}`, &job)
+	call(t, h, http.MethodGet, "/api/v1/jobs/"+job.ID+"?wait=5s", aliceToken, "", &job)
+	if job.Status != JobFailed || job.Error != "assistant unavailable" {
+		t.Errorf("Expected the failed job with its error, got %+v", job)
+	}
+
+	var jobs []Job
+	call(t, h, http.MethodGet, "/api/v1/jobs", aliceToken, "", &jobs)
+	if len(jobs) != 2 || jobs[0].ID != job.ID {
+		t.Errorf("Expected alice's 2 jobs, newest first, got %+v", jobs)
+	}
+
+	// Jobs are only visible to their submitter
+	call(t, h, http.MethodGet, "/api/v1/jobs", bobToken, "", &jobs)
+	if len(jobs) != 0 {
+		t.Errorf("Expected bob to see no jobs, got %d", len(jobs))
+	}
+	if code := call(t, h, http.MethodGet, "/api/v1/jobs/"+job.ID, bobToken, "", nil); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for another user's job, got %d", code)
+	}
+}
+
+func TestAPIRejects(t *testing.T) {
+	srv := newAPIServer(t, func(ctx context.Context, s Submission) (string, error) {
+		return "ok", nil
+	}, 0)
+	h := srv.Handler()
+
+	tests := []struct {
+		name   string
+		method string
+		token  string
+		body   string
+		want   int
+	}{
+		{"no token", http.MethodGet, "", "", http.StatusUnauthorized},
+		{"wrong token", http.MethodGet, "not-a-valid-token-at-all", "", http.StatusUnauthorized},
+		{"no command", http.MethodPost, aliceToken, `{"file":"notes.md"}`, http.StatusBadRequest},
+		{"unknown field", http.MethodPost, aliceToken, `{"command":"!a","priority":1}`, http.StatusBadRequest},
+		{"outside project", http.MethodPost, aliceToken, `{"command":"!a","file":"../secrets.md"}`, http.StatusBadRequest},
+		{"absolute path", http.MethodPost, aliceToken, `{"command":"!a","file":"/etc/passwd"}`, http.StatusBadRequest},
+		{"apply without file", http.MethodPost, aliceToken, `{"command":"!a","apply":true}`, http.StatusBadRequest},
+		{"method", http.MethodDelete, aliceToken, "", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		var resp map[string]string
+		if code := call(t, h, tt.method, "/api/v1/jobs", tt.token, tt.body, &resp); code != tt.want {
+			t.Errorf("%s: expected status %d, got %d (%v)", tt.name, tt.want, code, resp)
+		}
+		if resp["error"] == "" {
+			t.Errorf("%s: expected an error message", tt.name)
+		}
+	}
+}
+
+func TestAPIJobLimit(t *testing.T) {
+	release := make(chan struct{})
+	srv := newAPIServer(t, func(ctx context.Context, s Submission) (string, error) {
+		select {
+		case <-release:
+			return "ok", nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}, 2)
+	h := srv.Handler()
+
+	var a, b Job
+	call(t, h, http.MethodPost, "/api/v1/jobs", aliceToken, `{"command":"!a"}`, &a)
+	call(t, h, http.MethodPost, "/api/v1/jobs", aliceToken, `{"command":"!b"}`, &b)
+	if code := call(t, h, http.MethodPost, "/api/v1/jobs", aliceToken, `{"command":"!c"}`, nil); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 while every kept job is unfinished, got %d", code)
+	}
+
+	// A finished job makes room for the next. Either job may have run first.
+	release <- struct{}{}
+	finished := ""
+	for deadline := time.Now().Add(5 * time.Second); finished == "" && time.Now().Before(deadline); {
+		for _, job := range []*Job{&a, &b} {
+			call(t, h, http.MethodGet, "/api/v1/jobs/"+job.ID, aliceToken, "", job)
+			if job.Status == JobDone {
+				finished = job.ID
+			}
+		}
+	}
+	if finished == "" {
+		t.Fatal("Expected a job to finish")
+	}
+	if code := call(t, h, http.MethodPost, "/api/v1/jobs", aliceToken, `{"command":"!c"}`, nil); code != http.StatusAccepted {
+		t.Errorf("Expected status 202 once a job finished, got %d", code)
+	}
+	if code := call(t, h, http.MethodGet, "/api/v1/jobs/"+finished, aliceToken, "", nil); code != http.StatusNotFound {
+		t.Errorf("Expected the finished job to be dropped, got %d", code)
+	}
+
+	// Shutdown cancels the running job and fails the queued one
+	done := make(chan struct{})
+	go func() {
+		srv.Shutdown(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Shutdown to return once jobs were cancelled")
+	}
+	var jobs []Job
+	call(t, h, http.MethodGet, "/api/v1/jobs", aliceToken, "", &jobs)
+	for _, job := range jobs {
+		if job.Status != JobFailed {
+			t.Errorf("Expected job %s to fail on shutdown, got %s", job.Command, job.Status)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/butter-bot-machines/skylark/pkg/access"
+	"github.com/butter-bot-machines/skylark/pkg/security/types"
+)
+
+// authenticated handles a request made with token
+type authenticated func(w http.ResponseWriter, r *http.Request, token access.Token)
+
+// require passes requests to next when their bearer token grants scope,
+// answering 401 for a missing or unknown token and 403 for one without
+// scope. Every call is recorded in the audit log. query names a URL
+// parameter the token may be given in instead, for clients that cannot
+// set headers ("" for none).
+func (a *api) require(scope access.Scope, query string, next authenticated) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok && query != "" {
+			secret = r.URL.Query().Get(query)
+		}
+		if secret == "" {
+			unauthorized(w)
+			return
+		}
+
+		call := r.Method + " " + r.URL.Path
+		meta := map[string]interface{}{
+			"method": r.Method,
+			"path":   r.URL.Path,
+			"remote": r.RemoteAddr,
+			"scope":  string(scope),
+		}
+		token, err := a.tokens.Verify(secret)
+		if errors.Is(err, access.ErrInvalidToken) {
+			a.audit(types.EventAuthFailure, types.SeverityWarning, "invalid token for "+call, meta)
+			unauthorized(w)
+			return
+		}
+		if err != nil {
+			a.server.logger.Error("failed to verify token", "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to verify token")
+			return
+		}
+
+		meta["token"] = token.Name
+		meta["token_id"] = token.ID
+		if !token.Allows(scope) {
+			a.audit(types.EventAccessDenied, types.SeverityWarning, fmt.Sprintf("%s denied to token %s", call, token.Name), meta)
+			writeError(w, http.StatusForbidden, fmt.Sprintf("token %s lacks the %s scope", token.Name, scope))
+			return
+		}
+		a.audit(types.EventAPICall, types.SeverityInfo, fmt.Sprintf("%s by token %s", call, token.Name), meta)
+		next(w, r, token)
+	}
+}
+
+// audit records an event in the audit log, if one is set
+func (a *api) audit(event types.EventType, severity types.Severity, details string, meta map[string]interface{}) {
+	if a.server.audit != nil {
+		a.server.audit.Log(event, severity, "api", details, meta)
+	}
+}
+
+// unauthorized answers 401 for a missing or unknown token
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="skylark"`)
+	writeError(w, http.StatusUnauthorized, "missing or invalid token")
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+	"github.com/butter-bot-machines/skylark/pkg/logging/memory"
+	"github.com/butter-bot-machines/skylark/pkg/security"
+	"github.com/butter-bot-machines/skylark/pkg/security/types"
+	"github.com/butter-bot-machines/skylark/pkg/worker"
+)
+
+// recordingLog records the logged events
+type recordingLog struct {
+	security.AuditLogger
+	events []types.Event
+}
+
+func (r *recordingLog) Log(t types.EventType, s types.Severity, source, details string, meta map[string]interface{}) error {
+	r.events = append(r.events, types.Event{Type: t, Severity: s, Source: source, Details: details, Metadata: meta})
+	return nil
+}
+
+func TestRequireScopes(t *testing.T) {
+	audit := &recordingLog{}
+	srv, err := New(Options{
+		Addr:   "127.0.0.1:0",
+		Stats:  func() worker.Stats { return worker.Stats{} },
+		Logger: memory.NewLogger(logging.LevelDebug, io.Discard),
+		Audit:  audit,
+		API: &APIOptions{
+			Tokens: testTokens(t),
+			Run:    func(ctx context.Context, s Submission) (string, error) { return "", nil },
+		},
+		Dashboard: &DashboardOptions{
+			Control:  &fakeControl{},
+			Activity: func() (*Activity, error) { return &Activity{}, nil },
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+	h := srv.Handler()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+		event  types.EventType
+	}{
+		{"read status", http.MethodGet, "/api/v1/dashboard", carolToken, http.StatusOK, types.EventAPICall},
+		{"submit without scope", http.MethodPost, "/api/v1/jobs", carolToken, http.StatusForbidden, types.EventAccessDenied},
+		{"list jobs read-only", http.MethodGet, "/api/v1/jobs", carolToken, http.StatusOK, types.EventAPICall},
+		{"get job read-only", http.MethodGet, "/api/v1/jobs/job-1", carolToken, http.StatusNotFound, types.EventAPICall},
+		{"pause without scope", http.MethodPost, "/api/v1/pause", carolToken, http.StatusForbidden, types.EventAccessDenied},
+		{"reload", http.MethodPost, "/api/v1/reload", aliceToken, http.StatusOK, types.EventAPICall},
+		{"unknown token", http.MethodGet, "/api/v1/dashboard", "skai_unknown", http.StatusUnauthorized, types.EventAuthFailure},
+		{"no token", http.MethodGet, "/api/v1/dashboard", "", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		audit.events = nil
+		if code := call(t, h, tt.method, tt.path, tt.token, "", nil); code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.want, code)
+		}
+		if tt.event == "" {
+			if len(audit.events) != 0 {
+				t.Errorf("%s: expected nothing audited, got %+v", tt.name, audit.events)
+			}
+			continue
+		}
+		if len(audit.events) != 1 || audit.events[0].Type != tt.event || audit.events[0].Metadata["path"] != tt.path {
+			t.Errorf("%s: expected a %s event for %s, got %+v", tt.name, tt.event, tt.path, audit.events)
+		}
+	}
+
+	audit.events = nil
+	call(t, h, http.MethodPost, "/api/v1/jobs", bobToken, "", nil)
+	if len(audit.events) != 1 || audit.events[0].Metadata["token"] != "bob" || audit.events[0].Metadata["scope"] != "submit-commands" {
+		t.Errorf("Expected the call audited with bob's token and its scope, got %+v", audit.events)
+	}
+}
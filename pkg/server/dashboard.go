@@ -0,0 +1,125 @@
+package server
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/access"
+	"github.com/butter-bot-machines/skylark/pkg/daemon"
+	"github.com/butter-bot-machines/skylark/pkg/notify"
+)
+
+const (
+	dashboardPath = "/dashboard/"
+	snapshotPath  = "/api/v1/dashboard"
+	pausePath     = "/api/v1/pause"
+	resumePath    = "/api/v1/resume"
+	reloadPath    = "/api/v1/reload"
+)
+
+// dashboardFiles are the static assets of the dashboard. They hold no
+// data; the page reads it from the API with the token it is signed in with.
+//
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// DashboardOptions enables the web dashboard. It needs the job API, whose
+// tokens sign in to it.
+type DashboardOptions struct {
+	Control  daemon.Controller         // Status shown, and paused, resumed and reloaded, by the dashboard
+	Activity func() (*Activity, error) // Recent files, failures and spending
+}
+
+// Activity is the recent history of a project shown by the dashboard
+type Activity struct {
+	Files    []FileActivity  `json:"files"`    // Files processed most recently, newest first
+	Failures []FailureDetail `json:"failures"` // Newest first
+	Spend    []DailySpend    `json:"spend"`    // One entry per day, oldest first
+}
+
+// FileActivity summarizes the last processing of a file
+type FileActivity struct {
+	File        string    `json:"file"`
+	ProcessedAt time.Time `json:"processed_at"`
+	Commands    int       `json:"commands"`
+	Failed      int       `json:"failed"`
+	Tokens      int       `json:"tokens"`
+}
+
+// FailureDetail is a failed command, or a job that failed for good
+type FailureDetail struct {
+	Source   string    `json:"source"` // "command" or "job"
+	File     string    `json:"file,omitempty"`
+	Command  string    `json:"command,omitempty"`
+	Error    string    `json:"error"`
+	Stack    string    `json:"stack,omitempty"`
+	Attempts int       `json:"attempts,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// DailySpend is the tokens used and their estimated cost on a day
+type DailySpend struct {
+	Day    string  `json:"day"` // YYYY-MM-DD, local time
+	Tokens int     `json:"tokens"`
+	Cost   float64 `json:"cost"`
+}
+
+// Snapshot is the /api/v1/dashboard response
+type Snapshot struct {
+	Status   daemon.Status `json:"status"`
+	Activity *Activity     `json:"activity"`
+}
+
+// handleDashboard registers the dashboard's page and endpoints on mux
+func (s *Server) handleDashboard(mux *http.ServeMux) {
+	assets, _ := fs.Sub(dashboardFiles, "dashboard")
+	mux.Handle(dashboardPath, http.StripPrefix(dashboardPath, http.FileServer(http.FS(assets))))
+	mux.Handle(snapshotPath, s.api.require(access.ReadStatus, "", s.handleSnapshot))
+	control := s.api.require(access.AdminConfig, "", s.handleControl)
+	mux.Handle(pausePath, control)
+	mux.Handle(resumePath, control)
+	mux.Handle(reloadPath, control)
+}
+
+func (s *Server) handleSnapshot(w http.ResponseWriter, r *http.Request, _ access.Token) {
+	if r.Method != http.MethodGet {
+		notAllowed(w, r)
+		return
+	}
+	activity, err := s.dashboard.Activity()
+	if err != nil {
+		s.logger.Warn("failed to read activity", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to read activity")
+		return
+	}
+	writeJSON(w, http.StatusOK, Snapshot{Status: s.dashboard.Control.Status(), Activity: activity})
+}
+
+// handleControl pauses, resumes or reloads processing and returns the new
+// status
+func (s *Server) handleControl(w http.ResponseWriter, r *http.Request, token access.Token) {
+	if r.Method != http.MethodPost {
+		notAllowed(w, r)
+		return
+	}
+
+	var control func() error
+	var event string
+	switch r.URL.Path {
+	case pausePath:
+		control, event = s.dashboard.Control.Pause, "processing_paused"
+	case resumePath:
+		control, event = s.dashboard.Control.Resume, "processing_resumed"
+	default:
+		control, event = s.dashboard.Control.Reload, "config_reloaded"
+	}
+	if err := control(); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.logger.Info(event, "by", token.Name)
+	s.Publish(notify.Event{Type: event, Data: map[string]interface{}{"by": token.Name}})
+	writeJSON(w, http.StatusOK, s.dashboard.Control.Status())
+}
@@ -0,0 +1,171 @@
+// Skylark dashboard. Data comes from the job API with the token the page is
+// signed in with; the event stream triggers a refresh when something happens.
+"use strict";
+
+const tokenKey = "skylark-token";
+const refreshInterval = 15000;
+const $ = (id) => document.getElementById(id);
+
+let token = localStorage.getItem(tokenKey) || "";
+let paused = false;
+let events = null;
+let pending = null;
+
+async function api(path, method = "GET") {
+  const resp = await fetch(path, { method, headers: { Authorization: "Bearer " + token } });
+  if (resp.status === 401) {
+    signOut("The token was not accepted.");
+    throw new Error("unauthorized");
+  }
+  const body = await resp.json();
+  if (!resp.ok) {
+    throw Object.assign(new Error(body.error || resp.statusText), { status: resp.status });
+  }
+  return body;
+}
+
+function text(tag, value, className) {
+  const el = document.createElement(tag);
+  el.textContent = value;
+  if (className) el.className = className;
+  return el;
+}
+
+function when(time) {
+  return time ? new Date(time).toLocaleString() : "–";
+}
+
+function renderStatus(st) {
+  paused = st.paused;
+  const state = st.offline ? "offline" : st.paused ? "paused" : "running";
+  $("state").textContent = state;
+  $("state").className = "badge " + state;
+  $("toggle").textContent = st.paused ? "Resume" : "Pause";
+  $("toggle").disabled = false;
+  $("queue").textContent = st.queue_depth;
+  $("processed").textContent = st.processed;
+  $("failed").textContent = st.failed;
+  $("workers").textContent = st.active_workers;
+  $("backlog").textContent = st.backlog || 0;
+  $("started").textContent = when(st.started);
+}
+
+function renderSpend(spend) {
+  const chart = $("spend");
+  chart.replaceChildren();
+  const max = Math.max(1, ...spend.map((d) => d.tokens));
+  for (const d of spend) {
+    const bar = document.createElement("div");
+    bar.className = "bar";
+    bar.style.height = (100 * d.tokens) / max + "%";
+    bar.title = `${d.day}: ${d.tokens.toLocaleString()} tokens, $${d.cost.toFixed(2)}`;
+    bar.append(text("span", d.day.slice(5)));
+    chart.append(bar);
+  }
+}
+
+function renderFiles(files) {
+  const rows = files.map((f) => {
+    const tr = document.createElement("tr");
+    tr.append(
+      text("td", f.file),
+      text("td", when(f.processed_at)),
+      text("td", f.commands, "num"),
+      text("td", f.failed, "num"),
+      text("td", f.tokens.toLocaleString(), "num"),
+    );
+    return tr;
+  });
+  if (rows.length === 0) {
+    const tr = document.createElement("tr");
+    const td = text("td", "Nothing processed yet.", "empty");
+    td.colSpan = 5;
+    tr.append(td);
+    rows.push(tr);
+  }
+  $("files").replaceChildren(...rows);
+}
+
+function renderFailures(failures) {
+  const items = failures.map((f) => {
+    const details = document.createElement("details");
+    const what = f.command ? `${f.file}: ${f.command}` : f.file || f.source;
+    details.append(text("summary", `${when(f.time)} · ${what}`));
+    let detail = f.error;
+    if (f.attempts) detail += `\n\nAttempts: ${f.attempts}`;
+    if (f.stack) detail += `\n\n${f.stack}`;
+    details.append(text("pre", detail));
+    return details;
+  });
+  if (items.length === 0) items.push(text("p", "No failures.", "empty"));
+  $("failures").replaceChildren(...items);
+}
+
+async function refresh() {
+  pending = null;
+  try {
+    const snap = await api("/api/v1/dashboard");
+    renderStatus(snap.status);
+    renderSpend(snap.activity.spend);
+    renderFiles(snap.activity.files);
+    renderFailures(snap.activity.failures);
+  } catch (err) {
+    // A token without the read-status scope cannot show anything
+    if (err.status === 403) signOut(err.message);
+    else console.error(err);
+  }
+}
+
+// scheduleRefresh coalesces the refreshes asked for by bursts of events
+function scheduleRefresh() {
+  if (!pending) pending = setTimeout(refresh, 1000);
+}
+
+function listen() {
+  if (events) events.close();
+  events = new EventSource("/api/v1/events?access_token=" + encodeURIComponent(token));
+  events.onopen = () => $("live").classList.add("on");
+  events.onerror = () => $("live").classList.remove("on");
+  for (const type of ["job_queued", "job_completed", "job_failed", "file_processed", "command_failed", "processing_paused", "processing_resumed", "provider_unavailable", "provider_recovered"]) {
+    events.addEventListener(type, scheduleRefresh);
+  }
+}
+
+function signOut(message) {
+  localStorage.removeItem(tokenKey);
+  token = "";
+  if (events) events.close();
+  $("main").hidden = true;
+  $("signin").hidden = false;
+  $("signin-error").textContent = message || "";
+}
+
+function start() {
+  $("signin").hidden = true;
+  $("main").hidden = false;
+  refresh();
+  listen();
+}
+
+$("signin").addEventListener("submit", (e) => {
+  e.preventDefault();
+  token = $("token").value.trim();
+  localStorage.setItem(tokenKey, token);
+  start();
+});
+
+$("signout").addEventListener("click", () => signOut());
+
+$("toggle").addEventListener("click", async () => {
+  $("toggle").disabled = true;
+  try {
+    renderStatus(await api(paused ? "/api/v1/resume" : "/api/v1/pause", "POST"));
+  } catch (err) {
+    alert(err.message);
+    $("toggle").disabled = false;
+  }
+});
+
+setInterval(() => token && refresh(), refreshInterval);
+if (token) start();
+else signOut();
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/daemon"
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+	"github.com/butter-bot-machines/skylark/pkg/logging/memory"
+	"github.com/butter-bot-machines/skylark/pkg/worker"
+)
+
+// fakeControl is a daemon.Controller recording pauses
+type fakeControl struct {
+	paused bool
+}
+
+func (f *fakeControl) Status() daemon.Status { return daemon.Status{Paused: f.paused, QueueDepth: 3} }
+func (f *fakeControl) Pause() error          { f.paused = true; return nil }
+func (f *fakeControl) Resume() error         { f.paused = false; return nil }
+func (f *fakeControl) Reload() error         { return nil }
+
+func newDashboardServer(t *testing.T, control *fakeControl) *Server {
+	t.Helper()
+	srv, err := New(Options{
+		Addr:   "127.0.0.1:0",
+		Stats:  func() worker.Stats { return worker.Stats{} },
+		Logger: memory.NewLogger(logging.LevelDebug, io.Discard),
+		API: &APIOptions{
+			Tokens: testTokens(t),
+			Run:    func(ctx context.Context, s Submission) (string, error) { return "", nil },
+		},
+		Dashboard: &DashboardOptions{
+			Control: control,
+			Activity: func() (*Activity, error) {
+				return &Activity{Files: []FileActivity{{File: "notes.md", Commands: 2, Tokens: 120}}}, nil
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+	return srv
+}
+
+func TestDashboardAssets(t *testing.T) {
+	h := newDashboardServer(t, &fakeControl{}).Handler()
+	for path, want := range map[string]string{
+		"/dashboard/":          "<title>Skylark</title>",
+		"/dashboard/app.js":    "/api/v1/dashboard",
+		"/dashboard/style.css": ".chart",
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("Expected %s to serve %q, got %d", path, want, rec.Code)
+		}
+	}
+}
+
+func TestDashboardSnapshot(t *testing.T) {
+	h := newDashboardServer(t, &fakeControl{}).Handler()
+
+	if code := call(t, h, http.MethodGet, "/api/v1/dashboard", "", "", nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without a token, got %d", code)
+	}
+	var snap Snapshot
+	if code := call(t, h, http.MethodGet, "/api/v1/dashboard", aliceToken, "", &snap); code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", code)
+	}
+	if snap.Status.QueueDepth != 3 || len(snap.Activity.Files) != 1 || snap.Activity.Files[0].Tokens != 120 {
+		t.Errorf("Unexpected snapshot %+v", snap)
+	}
+}
+
+func TestDashboardPause(t *testing.T) {
+	control := &fakeControl{}
+	srv := newDashboardServer(t, control)
+	h := srv.Handler()
+	events, unsubscribe := srv.api.stream.subscribe()
+	defer unsubscribe()
+
+	if code := call(t, h, http.MethodGet, "/api/v1/pause", aliceToken, "", nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405 for GET, got %d", code)
+	}
+
+	var st daemon.Status
+	call(t, h, http.MethodPost, "/api/v1/pause", aliceToken, "", &st)
+	if !control.paused || !st.Paused {
+		t.Error("Expected processing to be paused")
+	}
+	if e := <-events; e.event.Type != "processing_paused" || e.event.Data["by"] != "alice" {
+		t.Errorf("Expected a processing_paused event by alice, got %+v", e.event)
+	}
+
+	call(t, h, http.MethodPost, "/api/v1/resume", aliceToken, "", &st)
+	if control.paused || st.Paused {
+		t.Error("Expected processing to be resumed")
+	}
+}
+
+func TestDashboardNeedsAPI(t *testing.T) {
+	_, err := New(Options{
+		Addr:      "127.0.0.1:0",
+		Stats:     func() worker.Stats { return worker.Stats{} },
+		Logger:    memory.NewLogger(logging.LevelDebug, io.Discard),
+		Dashboard: &DashboardOptions{Control: &fakeControl{}, Activity: func() (*Activity, error) { return &Activity{}, nil }},
+	})
+	if err == nil {
+		t.Error("Expected the dashboard to require the job API")
+	}
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/access"
+	"github.com/butter-bot-machines/skylark/pkg/notify"
+	"github.com/butter-bot-machines/skylark/pkg/worker"
+)
+
+const (
+	eventsPath   = "/api/v1/events"
+	streamBuffer = 64               // Events a client may fall behind by before events are dropped for it
+	keepAlive    = 15 * time.Second // Comment sent on an idle stream so proxies keep it open
+)
+
+// stream broadcasts events to the clients of /api/v1/events
+type stream struct {
+	mu      sync.Mutex
+	seq     uint64
+	clients map[chan streamed]struct{}
+}
+
+// streamed is an event with its sequence number, sent as the SSE id
+type streamed struct {
+	id    uint64
+	event notify.Event
+}
+
+// Publish sends e to the clients of the event stream. Clients that fall
+// behind miss events rather than holding up the caller. It does nothing
+// unless the job API is enabled.
+func (s *Server) Publish(e notify.Event) {
+	if s.api == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = s.clock.Now()
+	}
+	st := &s.api.stream
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.seq++
+	for ch := range st.clients {
+		select {
+		case ch <- streamed{id: st.seq, event: e}:
+		default:
+		}
+	}
+}
+
+// subscribe adds a client to the stream
+func (st *stream) subscribe() (<-chan streamed, func()) {
+	ch := make(chan streamed, streamBuffer)
+	st.mu.Lock()
+	if st.clients == nil {
+		st.clients = make(map[chan streamed]struct{})
+	}
+	st.clients[ch] = struct{}{}
+	st.mu.Unlock()
+	return ch, func() {
+		st.mu.Lock()
+		delete(st.clients, ch)
+		st.mu.Unlock()
+	}
+}
+
+// handleEvents streams events as Server-Sent Events until the client
+// disconnects or the server shuts down. ?events=a,b selects event types.
+// Browsers cannot set headers on an EventSource, so the token may also be
+// given as ?access_token.
+func (a *api) handleEvents(w http.ResponseWriter, r *http.Request, _ access.Token) {
+	if r.Method != http.MethodGet {
+		notAllowed(w, r)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+	var types map[string]bool
+	if v := r.URL.Query().Get("events"); v != "" {
+		types = make(map[string]bool)
+		for _, t := range strings.Split(v, ",") {
+			types[strings.TrimSpace(t)] = true
+		}
+	}
+
+	events, unsubscribe := a.stream.subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Keep nginx from buffering the stream
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case e := <-events:
+			if types != nil && !types[e.event.Type] {
+				continue
+			}
+			data, err := json.Marshal(e.event)
+			if err != nil {
+				a.server.logger.Warn("failed to encode event", "event", e.event.Type, "error", err)
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.id, e.event.Type, data)
+		}
+		flusher.Flush()
+	}
+}
+
+// JobEvent converts a job event of the worker pool for the event stream,
+// as job_queued, job_started, job_progress, job_retrying, job_completed or
+// job_failed
+func JobEvent(e worker.Event) notify.Event {
+	data := map[string]interface{}{"attempt": e.Attempt}
+	if e.File != "" {
+		data["file"] = e.File
+	}
+	if len(e.Commands) > 0 {
+		data["commands"] = e.Commands
+	}
+	if e.Message != "" {
+		data["message"] = e.Message
+	}
+	if e.Err != nil {
+		data["error"] = e.Err.Error()
+	}
+	if e.Duration > 0 {
+		data["duration_ms"] = e.Duration.Milliseconds()
+	}
+	return notify.Event{Type: "job_" + string(e.Type), Time: e.Time, Data: data}
+}
+
+// publishJob streams the state of a job submitted through the API as
+// api_job_queued, api_job_running, api_job_done or api_job_failed
+func (a *api) publishJob(job Job) {
+	data := map[string]interface{}{
+		"id":        job.ID,
+		"submitter": job.Submitter,
+		"command":   job.Command,
+	}
+	if job.File != "" {
+		data["file"] = job.File
+	}
+	if job.Error != "" {
+		data["error"] = job.Error
+	}
+	a.server.Publish(notify.Event{Type: "api_job_" + string(job.Status), Data: data})
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/notify"
+	"github.com/butter-bot-machines/skylark/pkg/worker"
+)
+
+// openStream connects to the event stream at path and returns its events
+// as they arrive
+func openStream(t *testing.T, ts *httptest.Server, path string) <-chan notify.Event {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open event stream: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %s %q", resp.Status, resp.Header.Get("Content-Type"))
+	}
+
+	events := make(chan notify.Event, 16)
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Scan() // ": connected", sent once subscribed
+	go func() {
+		defer resp.Body.Close()
+		defer close(events)
+		for scanner.Scan() {
+			if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+				var e notify.Event
+				if err := json.Unmarshal([]byte(data), &e); err == nil {
+					events <- e
+				}
+			}
+		}
+	}()
+	return events
+}
+
+// next returns the next event of events
+func next(t *testing.T, events <-chan notify.Event) notify.Event {
+	t.Helper()
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for an event")
+	}
+	return notify.Event{}
+}
+
+func TestEventStream(t *testing.T) {
+	release := make(chan struct{})
+	srv := newAPIServer(t, func(ctx context.Context, s Submission) (string, error) {
+		<-release
+		return "ok", nil
+	}, 0)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	all := openStream(t, ts, "/api/v1/events?access_token="+aliceToken)
+	processed := openStream(t, ts, "/api/v1/events?events=file_processed&access_token="+bobToken)
+
+	srv.Publish(notify.Event{Type: "file_processed", Data: map[string]interface{}{"file": "notes.md"}})
+	if e := next(t, all); e.Type != "file_processed" || e.Data["file"] != "notes.md" || e.Time.IsZero() {
+		t.Errorf("Unexpected event %+v", e)
+	}
+
+	call(t, srv.Handler(), http.MethodPost, "/api/v1/jobs", aliceToken, `{"command":"!summarize"}`, nil)
+	for _, want := range []string{"api_job_queued", "api_job_running"} {
+		if e := next(t, all); e.Type != want || e.Data["submitter"] != "alice" {
+			t.Errorf("Expected %s of alice, got %+v", want, e)
+		}
+	}
+	close(release)
+	if e := next(t, all); e.Type != "api_job_done" {
+		t.Errorf("Expected api_job_done, got %+v", e)
+	}
+
+	// Filtered streams only get the selected events
+	srv.Publish(notify.Event{Type: "file_processed", Data: map[string]interface{}{"file": "todo.md"}})
+	if e := next(t, processed); e.Data["file"] != "notes.md" {
+		t.Errorf("Expected the first file_processed event, got %+v", e)
+	}
+	if e := next(t, processed); e.Data["file"] != "todo.md" {
+		t.Errorf("Expected the second file_processed event, got %+v", e)
+	}
+
+	// Shutdown ends the streams
+	srv.Shutdown(context.Background())
+	for range all {
+	}
+}
+
+func TestEventStreamAuth(t *testing.T) {
+	srv := newAPIServer(t, func(ctx context.Context, s Submission) (string, error) { return "", nil }, 0)
+	for _, path := range []string{"/api/v1/events", "/api/v1/events?access_token=wrong-token-0123456789"} {
+		var resp map[string]string
+		if code := call(t, srv.Handler(), http.MethodGet, path, "", "", &resp); code != http.StatusUnauthorized {
+			t.Errorf("Expected status 401 for %s, got %d", path, code)
+		}
+	}
+}
+
+func TestJobEvent(t *testing.T) {
+	now := time.Now()
+	e := JobEvent(worker.Event{
+		Type:     worker.EventFailed,
+		File:     "notes.md",
+		Commands: []string{"!summarize"},
+		Attempt:  3,
+		Err:      errors.New("provider timeout"),
+		Duration: 1500 * time.Millisecond,
+		Time:     now,
+	})
+	if e.Type != "job_failed" || !e.Time.Equal(now) {
+		t.Errorf("Expected job_failed at %v, got %s at %v", now, e.Type, e.Time)
+	}
+	want := map[string]interface{}{
+		"file":        "notes.md",
+		"attempt":     3,
+		"error":       "provider timeout",
+		"duration_ms": int64(1500),
+	}
+	for k, v := range want {
+		if e.Data[k] != v {
+			t.Errorf("Expected %s %v, got %v", k, v, e.Data[k])
+		}
+	}
+}
@@ -0,0 +1,263 @@
+// Package server provides an embedded HTTP server exposing health, status
+// and configuration endpoints for supervising a running watch process, and
+// optionally an authenticated job API for submitting commands remotely
+// with a stream of processing events.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/access"
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+	"github.com/butter-bot-machines/skylark/pkg/security"
+	"github.com/butter-bot-machines/skylark/pkg/timing"
+	"github.com/butter-bot-machines/skylark/pkg/worker"
+)
+
+// Options configures a status server
+type Options struct {
+	Addr   string              // host:port to listen on
+	Stats  func() worker.Stats // Snapshots the worker pool statistics reported by /status
+	Config *config.Config      // Configuration served, redacted, by /config (to admin-config tokens with API)
+	Logger logging.Logger
+	Clock  timing.Clock         // Optional clock, defaults to the system clock
+	API    *APIOptions          // Optional job API under /api/v1/jobs
+	Audit  security.AuditLogger // Optional audit log recording each call to the API
+
+	// Dashboard optionally serves the web dashboard at /dashboard/. It
+	// needs API.
+	Dashboard *DashboardOptions
+}
+
+// Server serves /healthz, /status and /config, and the job API and
+// dashboard when enabled
+type Server struct {
+	addr      string
+	stats     func() worker.Stats
+	config    *config.Config
+	logger    logging.Logger
+	audit     security.AuditLogger
+	clock     timing.Clock
+	started   time.Time
+	api       *api
+	dashboard *DashboardOptions
+
+	draining atomic.Bool
+	mu       sync.Mutex
+	listener net.Listener
+	srv      *http.Server
+	done     chan struct{}
+}
+
+// Health is the /healthz response
+type Health struct {
+	Status string `json:"status"` // "ok" or "draining"
+}
+
+// Status is the /status response
+type Status struct {
+	Status        string          `json:"status"`
+	Uptime        string          `json:"uptime"`
+	UptimeSeconds float64         `json:"uptime_seconds"`
+	QueueDepth    uint64          `json:"queue_depth"`
+	Processed     uint64          `json:"processed"`
+	Failed        uint64          `json:"failed"`
+	ActiveWorkers int             `json:"active_workers"`
+	LastError     *worker.Failure `json:"last_error,omitempty"`
+}
+
+// New creates a status server. It does not listen until Start is called.
+func New(opts Options) (*Server, error) {
+	if opts.Addr == "" {
+		return nil, fmt.Errorf("listen address required")
+	}
+	if opts.Stats == nil {
+		return nil, fmt.Errorf("stats required")
+	}
+	if opts.Logger == nil {
+		return nil, fmt.Errorf("logger required")
+	}
+	if opts.Clock == nil {
+		opts.Clock = timing.New()
+	}
+
+	s := &Server{
+		addr:    opts.Addr,
+		stats:   opts.Stats,
+		config:  opts.Config,
+		logger:  opts.Logger.WithGroup("server"),
+		audit:   opts.Audit,
+		clock:   opts.Clock,
+		started: opts.Clock.Now(),
+		done:    make(chan struct{}),
+	}
+	if opts.API != nil {
+		a, err := newAPI(opts.API, s)
+		if err != nil {
+			return nil, err
+		}
+		s.api = a
+	}
+	if opts.Dashboard != nil {
+		switch {
+		case s.api == nil:
+			return nil, fmt.Errorf("dashboard needs the job API")
+		case opts.Dashboard.Control == nil || opts.Dashboard.Activity == nil:
+			return nil, fmt.Errorf("dashboard control and activity required")
+		}
+		s.dashboard = opts.Dashboard
+	}
+	return s, nil
+}
+
+// Handler returns the HTTP handler serving the endpoints
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.handleHealth)
+	mux.HandleFunc("/status", s.handleStatus)
+	if s.api != nil {
+		// With tokens to check, the configuration is for administrators only
+		mux.Handle("/config", s.api.require(access.AdminConfig, "", func(w http.ResponseWriter, r *http.Request, _ access.Token) {
+			s.handleConfig(w, r)
+		}))
+		// Reading jobs only needs the status scope; anything else submits
+		read := s.api.require(access.ReadStatus, "", s.api.serveJobs)
+		submit := s.api.require(access.SubmitCommands, "", s.api.serveJobs)
+		jobs := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet {
+				read(w, r)
+				return
+			}
+			submit(w, r)
+		})
+		mux.Handle(apiPrefix, jobs)
+		mux.Handle(apiPrefix+"/", jobs)
+		mux.Handle(eventsPath, s.api.require(access.ReadStatus, "access_token", s.api.handleEvents))
+	} else {
+		mux.HandleFunc("/config", s.handleConfig)
+	}
+	if s.dashboard != nil {
+		s.handleDashboard(mux)
+	}
+	return mux
+}
+
+// Start begins listening and serving in the background
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.addr, err)
+	}
+
+	s.mu.Lock()
+	s.listener = ln
+	s.srv = &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	srv := s.srv
+	s.mu.Unlock()
+
+	s.logger.Info("status server listening", "addr", ln.Addr().String())
+	go func() {
+		defer close(s.done)
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("status server failed", "error", err)
+		}
+	}()
+	return nil
+}
+
+// Addr returns the address the server is listening on, or the configured
+// address before Start
+func (s *Server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener != nil {
+		return s.listener.Addr().String()
+	}
+	return s.addr
+}
+
+// SetDraining makes /healthz report the process as unhealthy while it
+// finishes in-flight work before exiting
+func (s *Server) SetDraining() {
+	s.draining.Store(true)
+}
+
+// Shutdown stops the server, waiting until ctx is done for open requests.
+// Event streams end, jobs submitted through the API are cancelled and
+// those still queued fail.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	srv := s.srv
+	s.mu.Unlock()
+	if s.api != nil {
+		s.api.shutdown()
+	}
+	if srv == nil {
+		return nil
+	}
+
+	err := srv.Shutdown(ctx)
+	<-s.done
+	return err
+}
+
+// state returns the current health state
+func (s *Server) state() string {
+	if s.draining.Load() {
+		return "draining"
+	}
+	return "ok"
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+	if s.draining.Load() {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, Health{Status: s.state()})
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	uptime := s.clock.Now().Sub(s.started)
+	stats := s.stats()
+	st := Status{
+		Status:        s.state(),
+		Uptime:        uptime.Round(time.Second).String(),
+		UptimeSeconds: uptime.Seconds(),
+		QueueDepth:    stats.QueuedJobs,
+		Processed:     stats.ProcessedJobs,
+		Failed:        stats.FailedJobs,
+		ActiveWorkers: stats.ActiveWorkers,
+		LastError:     stats.LastFailure,
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if s.config == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "configuration unavailable"})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.config.Redacted())
+}
+
+// writeJSON writes v as an indented JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
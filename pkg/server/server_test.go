@@ -0,0 +1,191 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+	"github.com/butter-bot-machines/skylark/pkg/logging/memory"
+	"github.com/butter-bot-machines/skylark/pkg/timing"
+	"github.com/butter-bot-machines/skylark/pkg/worker"
+)
+
+// get performs a request against h and decodes the JSON response into v
+func get(t *testing.T, h http.Handler, path string, v interface{}) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected JSON content type for %s, got %q", path, ct)
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("Failed to decode %s response: %v\n%s", path, err, rec.Body.String())
+	}
+	return rec.Code
+}
+
+func TestServerEndpoints(t *testing.T) {
+	clock := timing.NewMock()
+	failedAt := clock.Now()
+	stats := worker.Stats{
+		ProcessedJobs: 7,
+		FailedJobs:    2,
+		QueuedJobs:    3,
+		ActiveWorkers: 4,
+		LastFailure:   &worker.Failure{File: "notes.md", Error: "provider timeout", Time: failedAt},
+	}
+	cfg := &config.Config{
+		Version: "1.0",
+		Models: map[string]config.ModelConfigSet{
+			"openai": {"gpt-4": {APIKey: "sk-secret", MaxTokens: 100}},
+		},
+		Server: config.ServerConfig{ListenAddr: "127.0.0.1:0"},
+	}
+
+	srv, err := New(Options{
+		Addr:   "127.0.0.1:0",
+		Stats:  func() worker.Stats { return stats },
+		Config: cfg,
+		Logger: memory.NewLogger(logging.LevelDebug, io.Discard),
+		Clock:  clock,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	h := srv.Handler()
+	clock.Add(90 * time.Second)
+
+	t.Run("healthz", func(t *testing.T) {
+		var health Health
+		if code := get(t, h, "/healthz", &health); code != http.StatusOK || health.Status != "ok" {
+			t.Errorf("Expected 200 ok, got %d %q", code, health.Status)
+		}
+	})
+
+	t.Run("status", func(t *testing.T) {
+		var st Status
+		if code := get(t, h, "/status", &st); code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", code)
+		}
+		if st.QueueDepth != 3 || st.Processed != 7 || st.Failed != 2 || st.ActiveWorkers != 4 {
+			t.Errorf("Unexpected counts: %+v", st)
+		}
+		if st.Uptime != "1m30s" || st.UptimeSeconds != 90 {
+			t.Errorf("Expected uptime 1m30s, got %s (%v)", st.Uptime, st.UptimeSeconds)
+		}
+		if st.LastError == nil || st.LastError.File != "notes.md" || st.LastError.Error != "provider timeout" {
+			t.Errorf("Expected last error for notes.md, got %+v", st.LastError)
+		}
+	})
+
+	t.Run("config is redacted", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/config", nil))
+		body := rec.Body.String()
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", rec.Code)
+		}
+		if strings.Contains(body, "sk-secret") {
+			t.Errorf("API key leaked in /config:\n%s", body)
+		}
+		if !strings.Contains(body, "[REDACTED]") || !strings.Contains(body, `"max_tokens": 100`) {
+			t.Errorf("Expected redacted key and other settings in /config:\n%s", body)
+		}
+	})
+
+	t.Run("draining", func(t *testing.T) {
+		srv.SetDraining()
+		var health Health
+		if code := get(t, h, "/healthz", &health); code != http.StatusServiceUnavailable || health.Status != "draining" {
+			t.Errorf("Expected 503 draining, got %d %q", code, health.Status)
+		}
+	})
+}
+
+func TestServerLifecycle(t *testing.T) {
+	noStats := func() worker.Stats { return worker.Stats{} }
+	if _, err := New(Options{Stats: noStats}); err == nil {
+		t.Error("Expected error without listen address")
+	}
+
+	srv, err := New(Options{
+		Addr:   "127.0.0.1:0",
+		Stats:  noStats,
+		Logger: memory.NewLogger(logging.LevelDebug, io.Discard),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+
+	resp, err := http.Get("http://" + srv.Addr() + "/healthz")
+	if err != nil {
+		t.Fatalf("Health check failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200, got %d", resp.StatusCode)
+	}
+
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/config", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 without configuration, got %d", rec.Code)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown failed: %v", err)
+	}
+	if _, err := http.Get("http://" + srv.Addr() + "/healthz"); err == nil {
+		t.Error("Expected requests to fail after shutdown")
+	}
+}
+
+func TestConfigNeedsAdmin(t *testing.T) {
+	audit := &recordingLog{}
+	srv, err := New(Options{
+		Addr:   "127.0.0.1:0",
+		Stats:  func() worker.Stats { return worker.Stats{} },
+		Config: &config.Config{Version: "1.0"},
+		Logger: memory.NewLogger(logging.LevelDebug, io.Discard),
+		Audit:  audit,
+		API: &APIOptions{
+			Tokens: testTokens(t),
+			Run:    func(ctx context.Context, s Submission) (string, error) { return "", nil },
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+	h := srv.Handler()
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"read-status token", carolToken, http.StatusForbidden},
+		{"admin-config token", aliceToken, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if code := call(t, h, http.MethodGet, "/config", tt.token, "", nil); code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.want, code)
+		}
+	}
+	if len(audit.events) != 2 || audit.events[1].Metadata["path"] != "/config" || audit.events[1].Metadata["token"] != "alice" {
+		t.Errorf("Expected the denied and allowed reads of /config audited, got %+v", audit.events)
+	}
+}
@@ -0,0 +1,440 @@
+// Package service installs skai daemon as a service of the operating
+// system: a systemd unit on Linux and a launchd agent on macOS, started at
+// boot or login and restarted when it fails.
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Service managers
+const (
+	Systemd = "systemd"
+	Launchd = "launchd"
+)
+
+// ErrUnsupported is returned by New on systems without a supported
+// service manager
+var ErrUnsupported = errors.New("no supported service manager")
+
+// Spec describes the daemon a service runs
+type Spec struct {
+	Name       string // systemd unit or launchd label, such as skylark-notes
+	Executable string // Absolute path of skai
+	ProjectDir string // Project root, the daemon's working directory
+	ConfigDir  string // .skai directory of the project
+	EnvFile    string // Environment of the daemon, as KEY=VALUE lines
+	LogFile    string // Output of a launchd agent; systemd keeps it in the journal
+
+	// PermanentExitCodes are exit statuses that restarting does not fix,
+	// such as configuration errors. systemd does not restart on them.
+	PermanentExitCodes []int
+
+	// System installs a systemd unit for the whole system, running as
+	// User, rather than for the current user
+	System bool
+	User   string
+}
+
+// Status is the state of a service
+type Status struct {
+	Name      string `json:"name"`
+	Manager   string `json:"manager"` // systemd or launchd
+	Path      string `json:"path"`    // Unit or property list file
+	Installed bool   `json:"installed"`
+	State     string `json:"state,omitempty"` // As the service manager reports it, such as active or failed
+}
+
+// Runner runs a service manager command and returns its combined output
+type Runner func(name string, args ...string) ([]byte, error)
+
+// Options configures a Manager
+type Options struct {
+	GOOS string // Operating system, such as runtime.GOOS
+	Home string // Home directory of the current user
+	Run  Runner // Optional, runs commands with os/exec by default
+}
+
+// Manager installs services with the service manager of the system
+type Manager struct {
+	kind string
+	home string
+	run  Runner
+}
+
+// New returns the manager for opts.GOOS
+func New(opts Options) (*Manager, error) {
+	m := &Manager{home: opts.Home, run: opts.Run}
+	switch opts.GOOS {
+	case "linux":
+		m.kind = Systemd
+	case "darwin":
+		m.kind = Launchd
+	default:
+		return nil, fmt.Errorf("%w on %s", ErrUnsupported, opts.GOOS)
+	}
+	if m.home == "" {
+		return nil, fmt.Errorf("home directory required")
+	}
+	if m.run == nil {
+		m.run = func(name string, args ...string) ([]byte, error) {
+			return exec.Command(name, args...).CombinedOutput()
+		}
+	}
+	return m, nil
+}
+
+// Kind returns the name of the service manager, systemd or launchd
+func (m *Manager) Kind() string {
+	return m.kind
+}
+
+// Path returns the file describing the service of spec
+func (m *Manager) Path(spec Spec) string {
+	switch {
+	case m.kind == Launchd:
+		return filepath.Join(m.home, "Library", "LaunchAgents", spec.Name+".plist")
+	case spec.System:
+		return filepath.Join("/etc", "systemd", "system", spec.Name+".service")
+	default:
+		return filepath.Join(m.home, ".config", "systemd", "user", spec.Name+".service")
+	}
+}
+
+// validName matches service names that are safe as unit names and labels
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// check validates spec for the manager
+func (m *Manager) check(spec Spec) error {
+	if !validName.MatchString(spec.Name) {
+		return fmt.Errorf("invalid service name %q: use letters, digits, '-', '_' and '.'", spec.Name)
+	}
+	if spec.System && m.kind != Systemd {
+		return fmt.Errorf("system services are only supported with systemd")
+	}
+	if spec.System && spec.User == "" {
+		return fmt.Errorf("system service %s needs a user to run as", spec.Name)
+	}
+	return nil
+}
+
+// Render returns the unit or property list of spec
+func (m *Manager) Render(spec Spec) ([]byte, error) {
+	if err := m.check(spec); err != nil {
+		return nil, err
+	}
+	if m.kind == Launchd {
+		env, err := readEnvFile(spec.EnvFile)
+		if err != nil {
+			return nil, err
+		}
+		return render(plistTemplate, struct {
+			Spec
+			Env []envVar
+		}{spec, env})
+	}
+	return render(unitTemplate, spec)
+}
+
+// Install writes the service of spec, then enables and starts it
+func (m *Manager) Install(spec Spec) error {
+	data, err := m.Render(spec)
+	if err != nil {
+		return err
+	}
+	path := m.Path(spec)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	if m.kind == Launchd {
+		// Replace an agent already loaded from an earlier install
+		m.run("launchctl", "unload", path)
+		return m.command("launchctl", "load", "-w", path)
+	}
+	if err := m.systemctl(spec, "daemon-reload"); err != nil {
+		return err
+	}
+	if err := m.systemctl(spec, "enable", spec.Name); err != nil {
+		return err
+	}
+	return m.systemctl(spec, "restart", spec.Name)
+}
+
+// Uninstall stops and disables the service of spec and removes its file
+func (m *Manager) Uninstall(spec Spec) error {
+	if err := m.check(spec); err != nil {
+		return err
+	}
+	path := m.Path(spec)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("service %s is not installed (no %s)", spec.Name, path)
+	}
+
+	if m.kind == Launchd {
+		if err := m.command("launchctl", "unload", "-w", path); err != nil {
+			return err
+		}
+	} else if err := m.systemctl(spec, "disable", "--now", spec.Name); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	if m.kind == Systemd {
+		return m.systemctl(spec, "daemon-reload")
+	}
+	return nil
+}
+
+// Status reports whether the service of spec is installed and its state
+func (m *Manager) Status(spec Spec) (Status, error) {
+	if err := m.check(spec); err != nil {
+		return Status{}, err
+	}
+	st := Status{Name: spec.Name, Manager: m.kind, Path: m.Path(spec)}
+	if _, err := os.Stat(st.Path); errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	} else if err != nil {
+		return st, fmt.Errorf("failed to read %s: %w", st.Path, err)
+	}
+	st.Installed = true
+
+	if m.kind == Launchd {
+		out, err := m.run("launchctl", "list", spec.Name)
+		switch {
+		case err != nil:
+			st.State = "not loaded"
+		case bytes.Contains(out, []byte(`"PID" =`)):
+			st.State = "running"
+		default:
+			st.State = "loaded"
+		}
+		return st, nil
+	}
+	// is-active exits non-zero unless the unit is active but still prints
+	// its state
+	out, err := m.run("systemctl", systemctlArgs(spec, "is-active", spec.Name)...)
+	st.State = strings.TrimSpace(string(out))
+	if st.State == "" && err != nil {
+		return st, fmt.Errorf("systemctl is-active %s failed: %w", spec.Name, err)
+	}
+	return st, nil
+}
+
+// systemctl runs systemctl for the user's or the system's manager
+func (m *Manager) systemctl(spec Spec, args ...string) error {
+	return m.command("systemctl", systemctlArgs(spec, args...)...)
+}
+
+func systemctlArgs(spec Spec, args ...string) []string {
+	if spec.System {
+		return args
+	}
+	return append([]string{"--user"}, args...)
+}
+
+// command runs a service manager command, failing with its output
+func (m *Manager) command(name string, args ...string) error {
+	out, err := m.run(name, args...)
+	if err != nil {
+		msg := strings.TrimSpace(string(out))
+		if msg == "" {
+			msg = err.Error()
+		}
+		return fmt.Errorf("%s %s failed: %s", name, strings.Join(args, " "), msg)
+	}
+	return nil
+}
+
+// envVar is a variable of an environment file
+type envVar struct {
+	Key, Value string
+}
+
+// readEnvFile reads KEY=VALUE lines, as systemd's EnvironmentFile does:
+// blank lines and lines starting with # are skipped, and values may be
+// quoted. A missing file has no variables.
+func readEnvFile(path string) ([]envVar, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read environment file: %w", err)
+	}
+
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, n)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			if value[0] == '"' {
+				if unquoted, err := strconv.Unquote(value); err == nil {
+					value = unquoted
+				} else {
+					value = value[1 : len(value)-1]
+				}
+			} else {
+				value = value[1 : len(value)-1]
+			}
+		}
+		vars[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read environment file: %w", err)
+	}
+
+	env := make([]envVar, 0, len(vars))
+	for k, v := range vars {
+		env = append(env, envVar{k, v})
+	}
+	sort.Slice(env, func(i, j int) bool { return env[i].Key < env[j].Key })
+	return env, nil
+}
+
+// render executes a service file template
+func render(tmpl *template.Template, data any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render service: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// systemdArg quotes a command line argument for ExecStart
+func systemdArg(s string) string {
+	s = strings.ReplaceAll(s, "%", "%%")
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\;$") {
+		return s
+	}
+	return strconv.Quote(s)
+}
+
+// systemdPath escapes the specifiers in a path setting
+func systemdPath(s string) string {
+	return strings.ReplaceAll(s, "%", "%%")
+}
+
+// xmlText escapes s for a property list
+func xmlText(s string) string {
+	var buf bytes.Buffer
+	for _, r := range s {
+		switch r {
+		case '&':
+			buf.WriteString("&amp;")
+		case '<':
+			buf.WriteString("&lt;")
+		case '>':
+			buf.WriteString("&gt;")
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
+
+func joinInts(codes []int) string {
+	s := make([]string, len(codes))
+	for i, c := range codes {
+		s[i] = strconv.Itoa(c)
+	}
+	return strings.Join(s, " ")
+}
+
+var funcs = template.FuncMap{"arg": systemdArg, "path": systemdPath, "xml": xmlText, "codes": joinInts}
+
+var unitTemplate = template.Must(template.New("unit").Funcs(funcs).Parse(`# Generated by skai service install
+[Unit]
+Description=Skylark daemon for {{path .ProjectDir}}
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=simple
+{{- if .System}}
+User={{.User}}
+{{- end}}
+WorkingDirectory={{path .ProjectDir}}
+EnvironmentFile=-{{path .EnvFile}}
+ExecStart={{arg .Executable}} --config {{arg .ConfigDir}} daemon --foreground
+Restart=on-failure
+RestartSec=5
+{{- if .PermanentExitCodes}}
+RestartPreventExitStatus={{codes .PermanentExitCodes}}
+{{- end}}
+
+[Install]
+WantedBy={{if .System}}multi-user.target{{else}}default.target{{end}}
+`))
+
+var plistTemplate = template.Must(template.New("plist").Funcs(funcs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<!-- Generated by skai service install -->
+<plist version="1.0">
+<dict>
+  <key>Label</key>
+  <string>{{xml .Name}}</string>
+  <key>ProgramArguments</key>
+  <array>
+    <string>{{xml .Executable}}</string>
+    <string>--config</string>
+    <string>{{xml .ConfigDir}}</string>
+    <string>daemon</string>
+    <string>--foreground</string>
+  </array>
+  <key>WorkingDirectory</key>
+  <string>{{xml .ProjectDir}}</string>
+{{- if .Env}}
+  <key>EnvironmentVariables</key>
+  <dict>
+{{- range .Env}}
+    <key>{{xml .Key}}</key>
+    <string>{{xml .Value}}</string>
+{{- end}}
+  </dict>
+{{- end}}
+  <key>RunAtLoad</key>
+  <true/>
+  <key>KeepAlive</key>
+  <dict>
+    <key>SuccessfulExit</key>
+    <false/>
+  </dict>
+  <key>ThrottleInterval</key>
+  <integer>5</integer>
+{{- if .LogFile}}
+  <key>StandardOutPath</key>
+  <string>{{xml .LogFile}}</string>
+  <key>StandardErrorPath</key>
+  <string>{{xml .LogFile}}</string>
+{{- end}}
+</dict>
+</plist>
+`))
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// recorder is a Runner recording the commands it is asked to run
+type recorder struct {
+	commands []string
+	outputs  map[string]string // Output by command
+	fail     map[string]bool   // Commands that exit non-zero
+}
+
+func (r *recorder) run(name string, args ...string) ([]byte, error) {
+	cmd := strings.Join(append([]string{name}, args...), " ")
+	r.commands = append(r.commands, cmd)
+	var err error
+	if r.fail[cmd] {
+		err = errors.New("exit status 3")
+	}
+	return []byte(r.outputs[cmd]), err
+}
+
+func testSpec(dir string) Spec {
+	return Spec{
+		Name:               "skylark-notes",
+		Executable:         "/usr/local/bin/skai",
+		ProjectDir:         filepath.Join(dir, "My Notes"),
+		ConfigDir:          filepath.Join(dir, "My Notes", ".skai"),
+		EnvFile:            filepath.Join(dir, "My Notes", ".skai", "service.env"),
+		LogFile:            filepath.Join(dir, "My Notes", ".skai", "daemon.out"),
+		PermanentExitCodes: []int{2, 7},
+	}
+}
+
+func TestRenderSystemd(t *testing.T) {
+	m, err := New(Options{GOOS: "linux", Home: "/home/ada"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := testSpec("/srv")
+
+	unit, err := m.Render(spec)
+	if err != nil {
+		t.Fatalf("Failed to render unit: %v", err)
+	}
+	for _, want := range []string{
+		"WorkingDirectory=/srv/My Notes\n",
+		"EnvironmentFile=-/srv/My Notes/.skai/service.env\n",
+		`ExecStart=/usr/local/bin/skai --config "/srv/My Notes/.skai" daemon --foreground` + "\n",
+		"Restart=on-failure\n",
+		"RestartPreventExitStatus=2 7\n",
+		"WantedBy=default.target\n",
+	} {
+		if !strings.Contains(string(unit), want) {
+			t.Errorf("Expected unit to contain %q, got:\n%s", want, unit)
+		}
+	}
+	if strings.Contains(string(unit), "User=") {
+		t.Error("Expected no User= in a user unit")
+	}
+	if path := m.Path(spec); path != "/home/ada/.config/systemd/user/skylark-notes.service" {
+		t.Errorf("Unexpected user unit path %s", path)
+	}
+
+	spec.System, spec.User = true, "ada"
+	unit, _ = m.Render(spec)
+	if !strings.Contains(string(unit), "User=ada\n") || !strings.Contains(string(unit), "WantedBy=multi-user.target") {
+		t.Errorf("Expected a system unit running as ada, got:\n%s", unit)
+	}
+	if path := m.Path(spec); path != "/etc/systemd/system/skylark-notes.service" {
+		t.Errorf("Unexpected system unit path %s", path)
+	}
+
+	spec.Name = "../evil"
+	if _, err := m.Render(spec); err == nil {
+		t.Error("Expected an invalid name to be rejected")
+	}
+}
+
+func TestRenderLaunchd(t *testing.T) {
+	dir := t.TempDir()
+	spec := testSpec(dir)
+	os.MkdirAll(spec.ConfigDir, 0755)
+	env := "# Provider settings\nexport HTTPS_PROXY=http://proxy:3128\nGREETING=\"a & b\"\n\n"
+	if err := os.WriteFile(spec.EnvFile, []byte(env), 0600); err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(Options{GOOS: "darwin", Home: "/Users/ada"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plist, err := m.Render(spec)
+	if err != nil {
+		t.Fatalf("Failed to render plist: %v", err)
+	}
+	for _, want := range []string{
+		"<string>skylark-notes</string>",
+		"<string>" + spec.ConfigDir + "</string>",
+		"<key>GREETING</key>\n    <string>a &amp; b</string>",
+		"<key>HTTPS_PROXY</key>\n    <string>http://proxy:3128</string>",
+		"<key>SuccessfulExit</key>\n    <false/>",
+		"<key>StandardErrorPath</key>",
+	} {
+		if !strings.Contains(string(plist), want) {
+			t.Errorf("Expected plist to contain %q, got:\n%s", want, plist)
+		}
+	}
+	if path := m.Path(spec); path != "/Users/ada/Library/LaunchAgents/skylark-notes.plist" {
+		t.Errorf("Unexpected plist path %s", path)
+	}
+
+	spec.System, spec.User = true, "ada"
+	if _, err := m.Render(spec); err == nil {
+		t.Error("Expected system services to be refused with launchd")
+	}
+}
+
+func TestReadEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service.env")
+	if env, err := readEnvFile(path); err != nil || len(env) != 0 {
+		t.Errorf("Expected a missing file to be empty, got %v, %v", env, err)
+	}
+	os.WriteFile(path, []byte("A='single'\nB=\"tab\\there\"\nB=2\nnot a variable\n"), 0600)
+	if _, err := readEnvFile(path); err == nil || !strings.Contains(err.Error(), ":4:") {
+		t.Errorf("Expected an error on line 4, got %v", err)
+	}
+	os.WriteFile(path, []byte("A='single'\nB=\"tab\\there\"\nC=\n"), 0600)
+	env, err := readEnvFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []envVar{{"A", "single"}, {"B", "tab\there"}, {"C", ""}}
+	if len(env) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, env)
+	}
+	for i := range want {
+		if env[i] != want[i] {
+			t.Errorf("Expected %v, got %v", want[i], env[i])
+		}
+	}
+}
+
+func TestInstallSystemd(t *testing.T) {
+	home := t.TempDir()
+	rec := &recorder{
+		outputs: map[string]string{"systemctl --user is-active skylark-notes": "failed\n"},
+		fail:    map[string]bool{"systemctl --user is-active skylark-notes": true},
+	}
+	m, err := New(Options{GOOS: "linux", Home: home, Run: rec.run})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := testSpec(home)
+
+	if st, err := m.Status(spec); err != nil || st.Installed {
+		t.Errorf("Expected the service not installed, got %+v, %v", st, err)
+	}
+	if err := m.Uninstall(spec); err == nil {
+		t.Error("Expected error uninstalling a service that is not installed")
+	}
+
+	if err := m.Install(spec); err != nil {
+		t.Fatalf("Failed to install: %v", err)
+	}
+	if _, err := os.Stat(m.Path(spec)); err != nil {
+		t.Errorf("Expected the unit written: %v", err)
+	}
+	want := "systemctl --user daemon-reload|systemctl --user enable skylark-notes|systemctl --user restart skylark-notes"
+	if got := strings.Join(rec.commands, "|"); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	st, err := m.Status(spec)
+	if err != nil || !st.Installed || st.State != "failed" || st.Manager != Systemd {
+		t.Errorf("Expected an installed, failed systemd service, got %+v, %v", st, err)
+	}
+
+	rec.commands = nil
+	if err := m.Uninstall(spec); err != nil {
+		t.Fatalf("Failed to uninstall: %v", err)
+	}
+	want = "systemctl --user disable --now skylark-notes|systemctl --user daemon-reload"
+	if got := strings.Join(rec.commands, "|"); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if _, err := os.Stat(m.Path(spec)); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected the unit removed")
+	}
+}
+
+func TestInstallFailure(t *testing.T) {
+	home := t.TempDir()
+	rec := &recorder{
+		outputs: map[string]string{"systemctl --user daemon-reload": "Failed to connect to bus: No medium found\n"},
+		fail:    map[string]bool{"systemctl --user daemon-reload": true},
+	}
+	m, _ := New(Options{GOOS: "linux", Home: home, Run: rec.run})
+	err := m.Install(testSpec(home))
+	if err == nil || !strings.Contains(err.Error(), "Failed to connect to bus") {
+		t.Errorf("Expected the systemctl output in the error, got %v", err)
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	if _, err := New(Options{GOOS: "windows", Home: "C:\\Users\\ada"}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported, got %v", err)
+	}
+}
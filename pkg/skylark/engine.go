@@ -0,0 +1,216 @@
+// Package skylark embeds Skylark in other Go programs. An Engine wires
+// configuration, the processor, the worker pool and the file watcher the
+// same way the skai command does, with options to supply providers,
+// tools, a file system and a clock.
+package skylark
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/job"
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+	slogging "github.com/butter-bot-machines/skylark/pkg/logging/slog"
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+	"github.com/butter-bot-machines/skylark/pkg/processor/concrete"
+	"github.com/butter-bot-machines/skylark/pkg/provider/registry"
+	wconcrete "github.com/butter-bot-machines/skylark/pkg/watcher/concrete"
+	"github.com/butter-bot-machines/skylark/pkg/worker"
+	wkconcrete "github.com/butter-bot-machines/skylark/pkg/worker/concrete"
+)
+
+// defaultShutdownGrace is how long in-flight jobs get to finish when
+// Watch returns and workers.shutdown_grace is not set
+const defaultShutdownGrace = 10 * time.Second
+
+// Engine processes Skylark commands and documents
+type Engine struct {
+	config *config.Manager
+	proc   processor.ProcessManager
+	parser *parser.Parser
+	opts   options
+}
+
+// NewEngine creates an engine. Without WithConfig, configuration is
+// loaded from .skai/config.yaml in the working directory.
+func NewEngine(opts ...Option) (*Engine, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.logger == nil {
+		o.logger = slogging.NewLogger(logging.LevelInfo, os.Stderr)
+	}
+
+	mgr, err := loadConfig(&o)
+	if err != nil {
+		return nil, err
+	}
+
+	procOpts := concrete.Options{
+		DefaultProvider: o.defaultProvider,
+		Tools:           o.tools,
+		FS:              o.fs,
+		Clock:           o.clock,
+		Hooks:           o.hooks,
+	}
+	if len(o.providers) > 0 {
+		procOpts.Providers = registry.New()
+		for name, factory := range o.providers {
+			procOpts.Providers.Register(name, factory)
+		}
+	}
+
+	proc, err := concrete.NewProcessorWithOptions(mgr.GetConfig(), procOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create processor: %w", err)
+	}
+
+	return &Engine{
+		config: mgr,
+		proc:   proc,
+		parser: concrete.NewParser(mgr.GetConfig()),
+		opts:   o,
+	}, nil
+}
+
+// loadConfig returns a config manager holding the configured or loaded
+// configuration
+func loadConfig(o *options) (*config.Manager, error) {
+	if o.config != nil {
+		mgr := config.NewManager(o.config.Environment.ConfigDir)
+		mgr.SetConfig(o.config)
+		return mgr, nil
+	}
+
+	dir := o.configDir
+	if dir == "" {
+		dir = ".skai"
+	}
+	mgr := config.NewManager(dir)
+	if err := mgr.Load(); err != nil {
+		return nil, err
+	}
+	return mgr, nil
+}
+
+// Close stops the plugins the engine started
+func (e *Engine) Close() error {
+	return e.proc.Close()
+}
+
+// Config returns the engine's configuration
+func (e *Engine) Config() *config.Config {
+	return e.config.GetConfig()
+}
+
+// ProcessFile runs the commands in the document at path and writes their
+// responses back into it
+func (e *Engine) ProcessFile(ctx context.Context, path string) error {
+	if p, ok := e.proc.(processor.ContextFileProcessor); ok {
+		return p.ProcessFileContext(ctx, path)
+	}
+	return e.proc.ProcessFile(path)
+}
+
+// ProcessCommand runs a single command such as "!default summarize this"
+// and returns the response. The leading "!" is optional.
+func (e *Engine) ProcessCommand(ctx context.Context, command string) (string, error) {
+	command = strings.TrimSpace(command)
+	if !strings.HasPrefix(command, "!") {
+		command = "!" + command
+	}
+
+	cmd, err := e.parser.ParseCommand(command)
+	if err != nil {
+		return "", err
+	}
+	if p, ok := e.proc.(processor.ContextCommandProcessor); ok {
+		return p.ProcessContext(ctx, cmd)
+	}
+	return e.proc.Process(cmd)
+}
+
+// Watch processes documents under the configured watch paths as they
+// change until ctx is cancelled. Jobs still running are given the
+// configured shutdown grace before Watch returns. Watching needs the OS
+// file system and fails when WithFS was given.
+func (e *Engine) Watch(ctx context.Context) error {
+	if e.opts.fs != nil {
+		return fmt.Errorf("watch is not supported with a custom file system")
+	}
+	cfg := e.config.GetConfig()
+
+	pool, err := wkconcrete.NewPool(worker.Options{
+		Config:       e.config,
+		Logger:       e.opts.logger,
+		ProcMgr:      e.proc.GetProcessManager(),
+		QueueSize:    cfg.Workers.QueueSize,
+		Workers:      cfg.Workers.Count,
+		RetryBackoff: cfg.Workers.RetryBackoff,
+		JobTimeout:   cfg.Workers.JobTimeout,
+		Clock:        e.opts.clock,
+
+		MaxWorkers:     cfg.Workers.Max,
+		ScaleThreshold: cfg.Workers.ScaleThreshold,
+		IdleTimeout:    cfg.Workers.IdleTimeout,
+		Concurrency:    cfg.AssistantConcurrency(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create worker pool: %w", err)
+	}
+	defer pool.Stop()
+
+	jobQueue := make(chan job.Job, cfg.Workers.QueueSize)
+	watcher, err := wconcrete.NewWatcher(watchConfig(cfg), jobQueue, e.proc)
+	if err != nil {
+		return fmt.Errorf("failed to create watcher: %w", err)
+	}
+
+	// Hand jobs from the watcher to the pool
+	forwarded := make(chan struct{})
+	go func() {
+		defer close(forwarded)
+		for j := range jobQueue {
+			pool.Queue() <- j
+		}
+	}()
+
+	<-ctx.Done()
+
+	watcher.Stop()
+	close(jobQueue)
+	<-forwarded
+
+	grace := cfg.Workers.ShutdownGrace
+	if grace == 0 {
+		grace = defaultShutdownGrace
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	if pending := pool.Shutdown(shutdownCtx); len(pending) > 0 {
+		e.opts.logger.Warn("jobs left unfinished", "count", len(pending))
+	}
+	return nil
+}
+
+// watchConfig resolves relative watch paths against the project directory,
+// the parent of the config directory, rather than the working directory
+func watchConfig(cfg *config.Config) *config.Config {
+	projectDir := filepath.Dir(cfg.Environment.ConfigDir)
+	resolved := *cfg
+	resolved.WatchPaths = nil
+	for _, path := range cfg.WatchPaths {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(projectDir, path)
+		}
+		resolved.WatchPaths = append(resolved.WatchPaths, path)
+	}
+	return &resolved
+}
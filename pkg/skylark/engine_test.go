@@ -0,0 +1,235 @@
+package skylark
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/fs/memory"
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+	logmemory "github.com/butter-bot-machines/skylark/pkg/logging/memory"
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+	"github.com/butter-bot-machines/skylark/pkg/timing"
+	"github.com/butter-bot-machines/skylark/pkg/tool"
+)
+
+// fakeProvider asks for the echo tool, then answers with its result
+type fakeProvider struct{}
+
+func (p *fakeProvider) Send(ctx context.Context, messages []provider.Message, opts *provider.RequestOptions) (*provider.Response, error) {
+	if last := messages[len(messages)-1]; last.Role == provider.RoleTool && last.ToolCallID == "call-1" {
+		result := strings.TrimSpace(last.Content)
+		return &provider.Response{Content: "echoed " + strings.SplitN(result, "\n", 2)[0]}, nil
+	}
+	return &provider.Response{ToolCalls: []provider.ToolCall{{
+		ID:       "call-1",
+		Function: provider.Function{Name: "echo", Arguments: `{"text":"hi"}`},
+	}}}, nil
+}
+
+func (p *fakeProvider) Close() error {
+	return nil
+}
+
+// newTestEngine creates an engine for a config directory holding a single
+// default assistant
+func newTestEngine(t *testing.T, opts ...Option) *Engine {
+	t.Helper()
+	configDir := filepath.Join(t.TempDir(), ".skai")
+	assistantDir := filepath.Join(configDir, "assistants", "default")
+	if err := os.MkdirAll(assistantDir, 0755); err != nil {
+		t.Fatalf("Failed to create test directories: %v", err)
+	}
+	prompt := "---\nname: default\ndescription: Test assistant\nmodel: fake-model\ntools:\n  - echo\n---\nYou help.\n"
+	if err := os.WriteFile(filepath.Join(assistantDir, "prompt.md"), []byte(prompt), 0644); err != nil {
+		t.Fatalf("Failed to create prompt.md: %v", err)
+	}
+
+	cfg := &config.Config{Version: "1.0"}
+	cfg.Environment.ConfigDir = configDir
+
+	echo := tool.Definition{
+		Name:        "echo",
+		Description: "Echoes its text",
+		Func: func(input []byte) ([]byte, error) {
+			var in struct{ Text string }
+			if err := json.Unmarshal(input, &in); err != nil {
+				return nil, err
+			}
+			return []byte(in.Text), nil
+		},
+	}
+
+	engine, err := NewEngine(append([]Option{
+		WithConfig(cfg),
+		WithProvider("fake", func(model string) (provider.Provider, error) {
+			return &fakeProvider{}, nil
+		}),
+		WithDefaultProvider("fake"),
+		WithTool(echo),
+		WithClock(timing.NewMock()),
+		WithLogger(logmemory.NewLogger(logging.LevelDebug, io.Discard)),
+	}, opts...)...)
+	if err != nil {
+		t.Fatalf("NewEngine() error = %v", err)
+	}
+	return engine
+}
+
+func TestEngineProcessCommand(t *testing.T) {
+	engine := newTestEngine(t)
+
+	for _, command := range []string{"!default say hi", "default say hi"} {
+		response, err := engine.ProcessCommand(context.Background(), command)
+		if err != nil {
+			t.Fatalf("ProcessCommand(%q) error = %v", command, err)
+		}
+		if response != "echoed hi" {
+			t.Errorf("Expected the tool result in the response, got %q", response)
+		}
+	}
+
+	if _, err := engine.ProcessCommand(context.Background(), "!nobody help"); err == nil {
+		t.Error("Expected error for unknown assistant")
+	}
+}
+
+func TestEngineProcessFile(t *testing.T) {
+	fsys := memory.New()
+	if err := fsys.MkdirAll("docs", 0755); err != nil {
+		t.Fatalf("MkdirAll() error = %v", err)
+	}
+	if err := fsys.WriteFile("docs/notes.md", []byte("# Notes\n!default say hi\n"), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	engine := newTestEngine(t, WithFS(fsys))
+	if err := engine.ProcessFile(context.Background(), "docs/notes.md"); err != nil {
+		t.Fatalf("ProcessFile() error = %v", err)
+	}
+
+	updated, err := iofs.ReadFile(fsys, "docs/notes.md")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	expected := "# Notes\n-!default say hi\n\nechoed hi\n"
+	if string(updated) != expected {
+		t.Errorf("Expected file:\n%q\ngot:\n%q", expected, updated)
+	}
+
+	if err := engine.Watch(context.Background()); err == nil {
+		t.Error("Expected Watch to fail with a custom file system")
+	}
+}
+
+func TestEngineWatch(t *testing.T) {
+	engine := newTestEngine(t)
+	docsDir := filepath.Join(filepath.Dir(engine.Config().Environment.ConfigDir), "docs")
+	if err := os.MkdirAll(docsDir, 0755); err != nil {
+		t.Fatalf("Failed to create docs directory: %v", err)
+	}
+	engine.Config().WatchPaths = []string{"docs"}
+	engine.Config().Workers.Count = 1
+	engine.Config().Workers.QueueSize = 10
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- engine.Watch(ctx) }()
+
+	// Give the watcher time to start before writing
+	time.Sleep(100 * time.Millisecond)
+	notes := filepath.Join(docsDir, "notes.md")
+	if err := os.WriteFile(notes, []byte("!default say hi\n"), 0644); err != nil {
+		t.Fatalf("Failed to write notes.md: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(notes)
+		if strings.Contains(string(data), "echoed hi") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for response, file is %q", data)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Watch() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch did not return after cancel")
+	}
+}
+
+func TestNewEngineConfigDir(t *testing.T) {
+	if _, err := NewEngine(WithConfigDir(filepath.Join(t.TempDir(), "missing"))); err == nil {
+		t.Error("Expected error for a missing config directory")
+	}
+}
+
+func TestEngineHooks(t *testing.T) {
+	fsys := memory.New()
+	if err := fsys.WriteFile("notes.md", []byte("!default say hi\n"), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	var stages []string
+	engine := newTestEngine(t, WithFS(fsys),
+		WithHooks(processor.Hooks{
+			OnCommandStart: func(ctx context.Context, cmd *parser.Command) error {
+				stages = append(stages, "start "+cmd.Text)
+				return nil
+			},
+			OnResponse: func(ctx context.Context, cmd *parser.Command, response string) (string, error) {
+				stages = append(stages, "response "+response)
+				return strings.ToUpper(response), nil
+			},
+			OnFileWrite: func(path string, data []byte) ([]byte, error) {
+				stages = append(stages, "write "+path)
+				return data, nil
+			},
+		}),
+		// Later hooks see the changes of earlier ones
+		WithHooks(processor.Hooks{
+			OnResponse: func(ctx context.Context, cmd *parser.Command, response string) (string, error) {
+				return response + "!", nil
+			},
+		}))
+
+	if err := engine.ProcessFile(context.Background(), "notes.md"); err != nil {
+		t.Fatalf("ProcessFile() error = %v", err)
+	}
+	updated, _ := iofs.ReadFile(fsys, "notes.md")
+	if string(updated) != "-!default say hi\n\nECHOED HI!\n" {
+		t.Errorf("Expected the hooked response, got %q", updated)
+	}
+	expected := []string{"start say hi", "response echoed hi", "write notes.md"}
+	if strings.Join(stages, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected stages %v, got %v", expected, stages)
+	}
+
+	// A failing hook stops the command
+	engine = newTestEngine(t, WithHooks(processor.Hooks{
+		OnCommandStart: func(ctx context.Context, cmd *parser.Command) error {
+			return errors.New("not today")
+		},
+	}))
+	if _, err := engine.ProcessCommand(context.Background(), "!default say hi"); err == nil || !strings.Contains(err.Error(), "not today") {
+		t.Errorf("Expected the hook error, got %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package skylark
+
+import (
+	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/fs"
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+	"github.com/butter-bot-machines/skylark/pkg/processor"
+	"github.com/butter-bot-machines/skylark/pkg/provider/registry"
+	"github.com/butter-bot-machines/skylark/pkg/timing"
+	"github.com/butter-bot-machines/skylark/pkg/tool"
+)
+
+// Option configures an Engine
+type Option func(*options)
+
+// options collects the settings applied by Options
+type options struct {
+	config          *config.Config
+	configDir       string
+	providers       map[string]registry.Factory
+	defaultProvider string
+	tools           []tool.Definition
+	fs              fs.FS
+	clock           timing.Clock
+	logger          logging.Logger
+	hooks           []processor.Hooks
+}
+
+// WithConfig uses cfg instead of loading config.yaml. Assistants and
+// compiled tools are still read from cfg.Environment.ConfigDir.
+func WithConfig(cfg *config.Config) Option {
+	return func(o *options) {
+		o.config = cfg
+	}
+}
+
+// WithConfigDir loads config.yaml from dir instead of ./.skai
+func WithConfigDir(dir string) Option {
+	return func(o *options) {
+		o.configDir = dir
+	}
+}
+
+// WithProvider registers a model provider under name. Once any provider
+// is given, the built-in OpenAI provider is no longer registered.
+func WithProvider(name string, factory registry.Factory) Option {
+	return func(o *options) {
+		if o.providers == nil {
+			o.providers = make(map[string]registry.Factory)
+		}
+		o.providers[name] = factory
+	}
+}
+
+// WithDefaultProvider sets the provider for models named without a
+// "provider:" prefix. The default is "openai".
+func WithDefaultProvider(name string) Option {
+	return func(o *options) {
+		o.defaultProvider = name
+	}
+}
+
+// WithTool registers a tool implemented in Go. Assistants call it like a
+// compiled tool, but it runs in process rather than in the sandbox.
+func WithTool(def tool.Definition) Option {
+	return func(o *options) {
+		o.tools = append(o.tools, def)
+	}
+}
+
+// WithFS reads and writes documents through fsys instead of the OS file
+// system. Paths are given to fsys unrooted and slash-separated.
+func WithFS(fsys fs.FS) Option {
+	return func(o *options) {
+		o.fs = fsys
+	}
+}
+
+// WithClock sets the clock used for process management and job timing
+func WithClock(clock timing.Clock) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// WithLogger sets the logger used by Watch
+func WithLogger(logger logging.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithHooks registers hooks called at the stages of processing: when a
+// command starts, on each response and before each document write. Hooks
+// registered by several WithHooks run in order.
+func WithHooks(hooks processor.Hooks) Option {
+	return func(o *options) {
+		o.hooks = append(o.hooks, hooks)
+	}
+}
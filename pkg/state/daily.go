@@ -0,0 +1,89 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/fs/osfs"
+)
+
+// Daily holds named counts that start over each day, persisted to a file
+// so that they survive restarts. It is not safe for concurrent use.
+type Daily struct {
+	path string // Counts are persisted here when set
+	data dailyCounts
+}
+
+// dailyCounts is the persisted form of Daily
+type dailyCounts struct {
+	Day    string             `json:"day"` // YYYY-MM-DD, local time
+	Counts map[string]float64 `json:"counts,omitempty"`
+}
+
+// LoadDaily loads the counts persisted at path, starting empty when there
+// are none. An empty path keeps the counts in memory only.
+func LoadDaily(path string) (*Daily, error) {
+	d := &Daily{path: path}
+	if path == "" {
+		return d, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, iofs.ErrNotExist) {
+		return d, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read daily counts: %w", err)
+	}
+	if err := json.Unmarshal(data, &d.data); err != nil {
+		return nil, fmt.Errorf("failed to parse daily counts: %w", err)
+	}
+	return d, nil
+}
+
+// Roll starts a new day when now falls on another day than the counts,
+// reporting whether it did. The new day is persisted with its first Add.
+func (d *Daily) Roll(now time.Time) bool {
+	today := now.Format("2006-01-02")
+	if d.data.Day == today {
+		return false
+	}
+	d.data = dailyCounts{Day: today}
+	return true
+}
+
+// Day returns the day the counts are for, "" before the first
+func (d *Daily) Day() string {
+	return d.data.Day
+}
+
+// Get returns the count of name
+func (d *Daily) Get(name string) float64 {
+	return d.data.Counts[name]
+}
+
+// Add adds n to the count of name and persists the counts
+func (d *Daily) Add(name string, n float64) error {
+	if d.data.Counts == nil {
+		d.data.Counts = make(map[string]float64)
+	}
+	d.data.Counts[name] += n
+	if d.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(d.data)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(d.path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	if err := osfs.WriteFile(d.path, data, 0644, false); err != nil {
+		return fmt.Errorf("failed to write daily counts: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDaily(t *testing.T) {
+	path := filepath.Join(t.TempDir(), Dir, "counts.json")
+	d, err := LoadDaily(path)
+	if err != nil {
+		t.Fatalf("LoadDaily failed: %v", err)
+	}
+
+	morning := time.Date(2026, 10, 16, 9, 0, 0, 0, time.Local)
+	if !d.Roll(morning) || d.Day() != "2026-10-16" {
+		t.Errorf("Expected the first roll to start 2026-10-16, got %q", d.Day())
+	}
+	for _, n := range []float64{1, 0.5} {
+		if err := d.Add("cost", n); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	d.Add("calls", 1)
+	if d.Roll(morning.Add(time.Hour)) {
+		t.Error("Expected no new day within the same day")
+	}
+
+	// Counts persist across loads
+	reloaded, err := LoadDaily(path)
+	if err != nil {
+		t.Fatalf("LoadDaily failed: %v", err)
+	}
+	if reloaded.Day() != "2026-10-16" || reloaded.Get("cost") != 1.5 || reloaded.Get("calls") != 1 {
+		t.Errorf("Expected the counts of 2026-10-16 reloaded, got %q %v %v", reloaded.Day(), reloaded.Get("cost"), reloaded.Get("calls"))
+	}
+
+	// The next day starts from zero
+	if !reloaded.Roll(morning.Add(24*time.Hour)) || reloaded.Get("cost") != 0 || reloaded.Day() != "2026-10-17" {
+		t.Errorf("Expected a new day with no counts, got %q %v", reloaded.Day(), reloaded.Get("cost"))
+	}
+
+	// Without a path nothing is written
+	memory, _ := LoadDaily("")
+	memory.Roll(morning)
+	if err := memory.Add("cost", 1); err != nil || memory.Get("cost") != 1 {
+		t.Errorf("Expected an in-memory count of 1, got %v, %v", memory.Get("cost"), err)
+	}
+
+	os.WriteFile(path, []byte("{"), 0644)
+	if _, err := LoadDaily(path); err == nil {
+		t.Error("Expected error for a corrupt file")
+	}
+}
@@ -0,0 +1,260 @@
+// Package state records what happened to each command of a project's
+// documents: when it was processed, by which assistant and model, the
+// tokens it used and its outcome.
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/fs/osfs"
+	"github.com/butter-bot-machines/skylark/pkg/logging"
+	"github.com/butter-bot-machines/skylark/pkg/parser"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+)
+
+// Dir is the directory holding state, relative to the configuration
+// directory
+const Dir = "state"
+
+// commandsFile holds the command records, relative to Dir
+const commandsFile = "commands.json"
+
+// brokenSuffix names where a commands file that could not be loaded is
+// set aside
+const brokenSuffix = ".broken"
+
+var logger = logging.Default()
+
+// Outcome is the result of processing a command
+type Outcome string
+
+const (
+	// OutcomeAnswered means the assistant responded but the response is
+	// not in the document yet. A re-run inserts the recorded response
+	// instead of asking again.
+	OutcomeAnswered Outcome = "answered"
+	// OutcomePending means the response is held for review and is only
+	// written to the document once approved
+	OutcomePending Outcome = "pending"
+	// OutcomeProcessed means the response was written to the document
+	OutcomeProcessed Outcome = "processed"
+	// OutcomeFailed means processing failed; the command is still pending
+	OutcomeFailed Outcome = "failed"
+)
+
+// Record describes the last processing of one command instance
+type Record struct {
+	Key         string         `json:"key"`
+	Line        int            `json:"line"` // 1-based line of the command when it was processed
+	Command     string         `json:"command"`
+	Assistant   string         `json:"assistant"`
+	Model       string         `json:"model,omitempty"`
+	ProcessedAt time.Time      `json:"processed_at"`
+	Tokens      provider.Usage `json:"tokens"`
+	Outcome     Outcome        `json:"outcome"`
+	Error       string         `json:"error,omitempty"`
+	Response    string         `json:"response,omitempty"` // Kept while the outcome is answered or pending
+}
+
+// Key identifies a command instance within a document by the hash of its
+// line and, for repeated lines, the occurrence (0 for the first)
+func Key(line string, occurrence int) string {
+	sum := sha256.Sum256([]byte(line))
+	return fmt.Sprintf("%s:%d", hex.EncodeToString(sum[:8]), occurrence)
+}
+
+// Store holds the command records of a project's documents
+type Store struct {
+	path    string // Persisted here when set
+	mu      sync.Mutex
+	records map[string]map[string]Record // By document, then key
+}
+
+// Open loads the store persisted in the state directory under configDir.
+// An empty configDir keeps the records in memory only.
+//
+// The records are a cache of what was processed, so a file that cannot be
+// read or parsed does not stop processing: it is logged and set aside as
+// commands.json.broken, and the store starts empty. Commands it recorded
+// may then run again. When the file cannot be set aside either, the store
+// keeps its records in memory rather than overwrite it.
+func Open(configDir string) (*Store, error) {
+	s := &Store{records: make(map[string]map[string]Record)}
+	if configDir == "" {
+		return s, nil
+	}
+	s.path = filepath.Join(configDir, Dir, commandsFile)
+
+	err := load(s.path, &s.records)
+	if err == nil || errors.Is(err, iofs.ErrNotExist) {
+		return s, nil
+	}
+	s.records = make(map[string]map[string]Record)
+	if renameErr := os.Rename(s.path, s.path+brokenSuffix); renameErr != nil {
+		logger.Error("command state is unreadable; keeping records in memory", "path", s.path, "error", err, "rename_error", renameErr)
+		s.path = ""
+		return s, nil
+	}
+	logger.Warn("command state is unreadable; set aside and starting empty", "path", s.path+brokenSuffix, "error", err)
+	return s, nil
+}
+
+// load reads the records persisted at path
+func load(path string, records *map[string]map[string]Record) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, records); err != nil {
+		return fmt.Errorf("failed to parse command state: %w", err)
+	}
+	return nil
+}
+
+// Check reports why the store under configDir is degraded: its file cannot
+// be loaded, or an earlier one was set aside by Open. It returns nil for a
+// healthy store.
+func Check(configDir string) error {
+	if configDir == "" {
+		return nil
+	}
+	path := filepath.Join(configDir, Dir, commandsFile)
+	var records map[string]map[string]Record
+	if err := load(path, &records); err != nil && !errors.Is(err, iofs.ErrNotExist) {
+		return fmt.Errorf("%s is unreadable: %w", path, err)
+	}
+	if _, err := os.Stat(path + brokenSuffix); err == nil {
+		return fmt.Errorf("unreadable command state was set aside in %s; commands it recorded may run again", path+brokenSuffix)
+	}
+	return nil
+}
+
+// Lookup returns the record of the command with key in document
+func (s *Store) Lookup(document, key string) (Record, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.records[document][key]
+	return r, ok
+}
+
+// Records returns the records of document, ordered by line
+func (s *Store) Records(document string) []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records := make([]Record, 0, len(s.records[document]))
+	for _, r := range s.records[document] {
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Line != records[j].Line {
+			return records[i].Line < records[j].Line
+		}
+		return records[i].Key < records[j].Key
+	})
+	return records
+}
+
+// Documents returns the documents with records, sorted
+func (s *Store) Documents() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	documents := make([]string, 0, len(s.records))
+	for document := range s.records {
+		documents = append(documents, document)
+	}
+	sort.Strings(documents)
+	return documents
+}
+
+// Put replaces the record of a command in document and persists the store
+func (s *Store) Put(document string, r Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.records[document] == nil {
+		s.records[document] = make(map[string]Record)
+	}
+	s.records[document][r.Key] = r
+	return s.save()
+}
+
+// DropAnswered removes the answered records of commands run by assistant
+// or by one of its versions, so that their recorded responses are not
+// reused, and returns how many were removed
+func (s *Store) DropAnswered(assistant string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dropped := 0
+	for _, records := range s.records {
+		for key, r := range records {
+			if r.Outcome != OutcomeAnswered {
+				continue
+			}
+			if r.Assistant == assistant || strings.HasPrefix(r.Assistant, assistant+"@") {
+				delete(records, key)
+				dropped++
+			}
+		}
+	}
+	if dropped == 0 {
+		return 0, nil
+	}
+	return dropped, s.save()
+}
+
+// save writes the records to disk, replacing the file atomically through a
+// temporary file so that a crash never leaves it half written. The caller
+// holds s.mu.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.records, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	if err := osfs.WriteFile(s.path, data, 0644, false); err != nil {
+		return fmt.Errorf("failed to write command state: %w", err)
+	}
+	return nil
+}
+
+// Instance locates a command in a document
+type Instance struct {
+	Key  string
+	Line int // 1-based, 0 when the line was not found
+}
+
+// Locate returns the instance of each command in content, given the
+// original text of the commands in document order
+func Locate(content string, commands []string) []Instance {
+	lines := strings.Split(content, "\n")
+	instances := make([]Instance, len(commands))
+	seen := make(map[string]int)
+	next := 0
+	for i, original := range commands {
+		instances[i].Key = Key(original, seen[original])
+		seen[original]++
+		for j := next; j < len(lines); j++ {
+			if parser.MatchesAt(lines, j, original) {
+				instances[i].Line = j + 1
+				next = j + 1
+				break
+			}
+		}
+	}
+	return instances
+}
@@ -0,0 +1,136 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+)
+
+func TestStore(t *testing.T) {
+	configDir := t.TempDir()
+	store, err := Open(configDir)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	processedAt := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	records := []Record{
+		{Key: Key("!default later", 0), Line: 5, Command: "!default later", Outcome: OutcomeFailed, Error: "timeout"},
+		{Key: Key("!default first", 0), Line: 2, Command: "!default first", Assistant: "default", Model: "gpt-4",
+			ProcessedAt: processedAt, Tokens: provider.Usage{TotalTokens: 15}, Outcome: OutcomeProcessed},
+	}
+	for _, r := range records {
+		if err := store.Put("/project/notes.md", r); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	// Records persist across opens
+	reopened, err := Open(configDir)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	got := reopened.Records("/project/notes.md")
+	if len(got) != 2 || got[0].Line != 2 || got[1].Line != 5 {
+		t.Fatalf("Expected records ordered by line, got %+v", got)
+	}
+	if got[0].Model != "gpt-4" || got[0].Tokens.TotalTokens != 15 || !got[0].ProcessedAt.Equal(processedAt) {
+		t.Errorf("Expected the record to round-trip, got %+v", got[0])
+	}
+	if r, ok := reopened.Lookup("/project/notes.md", Key("!default later", 0)); !ok || r.Error != "timeout" {
+		t.Errorf("Expected to find the failed record, got %+v (%v)", r, ok)
+	}
+	if _, ok := reopened.Lookup("/project/other.md", Key("!default later", 0)); ok {
+		t.Error("Expected records to be kept per document")
+	}
+
+	if err := Check(configDir); err != nil {
+		t.Errorf("Expected a healthy store, got %v", err)
+	}
+}
+
+func TestOpenCorrupt(t *testing.T) {
+	configDir := t.TempDir()
+	path := filepath.Join(configDir, Dir, commandsFile)
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := os.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatalf("Failed to write state: %v", err)
+	}
+	if err := Check(configDir); err == nil || !strings.Contains(err.Error(), "unreadable") {
+		t.Errorf("Expected the corrupt file reported, got %v", err)
+	}
+
+	// The corrupt file is set aside and the store starts empty
+	store, err := Open(configDir)
+	if err != nil {
+		t.Fatalf("Expected a corrupt state file to be set aside, got %v", err)
+	}
+	if len(store.Documents()) != 0 {
+		t.Errorf("Expected an empty store, got %v", store.Documents())
+	}
+	if data, err := os.ReadFile(path + brokenSuffix); err != nil || string(data) != "{" {
+		t.Errorf("Expected the corrupt file kept in %s, got %q, %v", brokenSuffix, data, err)
+	}
+	if err := store.Put("notes.md", Record{Key: "a", Outcome: OutcomeProcessed}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if reopened, _ := Open(configDir); len(reopened.Records("notes.md")) != 1 {
+		t.Error("Expected the new store persisted")
+	}
+	if err := Check(configDir); err == nil || !strings.Contains(err.Error(), "set aside") {
+		t.Errorf("Expected the set-aside file reported, got %v", err)
+	}
+}
+
+func TestDropAnswered(t *testing.T) {
+	store, err := Open("")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	records := []Record{
+		{Key: "a", Assistant: "writer", Outcome: OutcomeAnswered, Response: "old"},
+		{Key: "b", Assistant: "writer@v2", Outcome: OutcomeAnswered, Response: "old"},
+		{Key: "c", Assistant: "writer", Outcome: OutcomePending, Response: "held"},
+		{Key: "d", Assistant: "writers", Outcome: OutcomeAnswered, Response: "other"},
+	}
+	for _, r := range records {
+		if err := store.Put("notes.md", r); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	dropped, err := store.DropAnswered("writer")
+	if err != nil {
+		t.Fatalf("DropAnswered failed: %v", err)
+	}
+	if dropped != 2 {
+		t.Errorf("Expected 2 records dropped, got %d", dropped)
+	}
+	for key, kept := range map[string]bool{"a": false, "b": false, "c": true, "d": true} {
+		if _, ok := store.Lookup("notes.md", key); ok != kept {
+			t.Errorf("Expected record %s kept %v, got %v", key, kept, ok)
+		}
+	}
+}
+
+func TestLocate(t *testing.T) {
+	content := "# Notes\n!a one\ntext\n  !a one\n!b two\n"
+	instances := Locate(content, []string{"!a one", "!a one", "!b two", "!c missing"})
+
+	wantLines := []int{2, 4, 5, 0}
+	for i, inst := range instances {
+		if inst.Line != wantLines[i] {
+			t.Errorf("Expected command %d on line %d, got %d", i, wantLines[i], inst.Line)
+		}
+	}
+	if instances[0].Key == instances[1].Key {
+		t.Error("Expected repeated commands to have distinct keys")
+	}
+	if instances[0].Key != Key("!a one", 0) {
+		t.Errorf("Expected the first occurrence to be keyed 0, got %s", instances[0].Key)
+	}
+}
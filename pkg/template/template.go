@@ -0,0 +1,168 @@
+// Package template loads command templates: named standing prompts that
+// a short alias such as !summarize expands into.
+package template
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Dir is the directory holding templates inside .skai
+const Dir = "templates"
+
+// Selection is the placeholder replaced by the text following the alias
+const Selection = "{selection}"
+
+// namePattern restricts template names to what can follow ! in a command
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Template is a command template loaded from <name>.md
+type Template struct {
+	Name        string `yaml:"-"`
+	Description string `yaml:"description"`
+	Assistant   string `yaml:"assistant"` // Runs the expanded command, defaults to the default assistant
+	Body        string `yaml:"-"`
+	Path        string `yaml:"-"`
+}
+
+// Expand fills the template with selection. Without a {selection}
+// placeholder, a non-empty selection is appended after the body.
+func (t *Template) Expand(selection string) string {
+	selection = strings.TrimSpace(selection)
+	if strings.Contains(t.Body, Selection) {
+		return strings.ReplaceAll(t.Body, Selection, selection)
+	}
+	if selection == "" {
+		return t.Body
+	}
+	return t.Body + "\n\n" + selection
+}
+
+// Set is the templates of a project, by name
+type Set struct {
+	templates map[string]*Template
+}
+
+// Load reads the templates in dir. A missing directory gives an empty set.
+func Load(dir string) (*Set, error) {
+	set := &Set{templates: make(map[string]*Template)}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return set, nil
+		}
+		return nil, fmt.Errorf("failed to read templates directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".md") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		t, err := loadTemplate(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load template %s: %w", entry.Name(), err)
+		}
+		set.templates[t.Name] = t
+	}
+	return set, nil
+}
+
+// loadTemplate reads a template file with optional YAML front matter
+func loadTemplate(path string) (*Template, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+	if !namePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid template name: %s", name)
+	}
+	t := &Template{Name: name, Path: path}
+
+	body := strings.ReplaceAll(string(content), "\r\n", "\n")
+	if strings.HasPrefix(body, "---\n") {
+		front, rest, found := strings.Cut(body[4:]+"\n", "\n---\n")
+		if !found {
+			return nil, fmt.Errorf("unterminated front matter")
+		}
+		if err := yaml.Unmarshal([]byte(front), t); err != nil {
+			return nil, fmt.Errorf("invalid YAML front matter: %w", err)
+		}
+		body = rest
+	}
+
+	t.Body = strings.TrimSpace(body)
+	if t.Body == "" {
+		return nil, fmt.Errorf("template is empty")
+	}
+	return t, nil
+}
+
+// Get returns the template called name
+func (s *Set) Get(name string) (*Template, bool) {
+	t, ok := s.templates[strings.ToLower(name)]
+	return t, ok
+}
+
+// List returns the templates sorted by name
+func (s *Set) List() []*Template {
+	list := make([]*Template, 0, len(s.templates))
+	for _, t := range s.templates {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// Expand implements parser.Expander
+func (s *Set) Expand(name string, text string) (string, string, bool) {
+	t, ok := s.Get(name)
+	if !ok {
+		return "", "", false
+	}
+	return t.Assistant, t.Expand(text), true
+}
+
+// Create writes a starter template called name to dir and returns its
+// path. An existing template is never overwritten.
+func Create(dir, name string) (string, error) {
+	name = strings.ToLower(name)
+	if !namePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid template name %q: use letters, digits, - and _", name)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create templates directory: %w", err)
+	}
+
+	path := filepath.Join(dir, name+".md")
+	content := fmt.Sprintf(`---
+description: Describe what !%s does
+assistant: default
+---
+Write the standing prompt here. %s is replaced by the text after !%s.
+`, name, Selection, name)
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return "", fmt.Errorf("template %s already exists", name)
+		}
+		return "", fmt.Errorf("failed to create template: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		return "", fmt.Errorf("failed to write template: %w", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,113 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"summarize.md": "---\ndescription: Summarize a section\nassistant: writer\n---\nSummarize in three bullets:\n{selection}\n",
+		"Review.md":    "Review this for clarity.\n",
+		"notes.txt":    "Not a template.",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	set, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	list := set.List()
+	if len(list) != 2 || list[0].Name != "review" || list[1].Name != "summarize" {
+		t.Fatalf("Expected [review summarize], got %+v", list)
+	}
+	if list[1].Assistant != "writer" || list[1].Description != "Summarize a section" {
+		t.Errorf("Expected front matter to be read, got %+v", list[1])
+	}
+
+	tests := []struct {
+		name      string
+		text      string
+		assistant string
+		want      string
+	}{
+		{"summarize", "#Roadmap#", "writer", "Summarize in three bullets:\n#Roadmap#"},
+		{"summarize", "", "writer", "Summarize in three bullets:\n"},
+		{"review", "the intro", "", "Review this for clarity.\n\nthe intro"},
+		{"REVIEW", "", "", "Review this for clarity."},
+	}
+	for _, tt := range tests {
+		assistant, got, ok := set.Expand(tt.name, tt.text)
+		if !ok || assistant != tt.assistant || got != tt.want {
+			t.Errorf("Expand(%q, %q) = %q, %q, %v; want %q, %q", tt.name, tt.text, assistant, got, ok, tt.assistant, tt.want)
+		}
+	}
+	if _, _, ok := set.Expand("unknown", ""); ok {
+		t.Error("Expected unknown template not to expand")
+	}
+
+	// A missing directory has no templates
+	set, err = Load(filepath.Join(dir, "missing"))
+	if err != nil || len(set.List()) != 0 {
+		t.Errorf("Expected an empty set, got %v, %v", set, err)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"empty body", "empty.md", "---\ndescription: Nothing\n---\n"},
+		{"unterminated front matter", "open.md", "---\ndescription: Open\n"},
+		{"invalid name", "two words.md", "Body"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, tt.file), []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to write template: %v", err)
+			}
+			if _, err := Load(dir); err == nil {
+				t.Error("Expected Load() to fail")
+			}
+		})
+	}
+}
+
+func TestCreate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "templates")
+
+	path, err := Create(dir, "Standup")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if filepath.Base(path) != "standup.md" {
+		t.Errorf("Expected standup.md, got %s", path)
+	}
+
+	set, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	tmpl, ok := set.Get("standup")
+	if !ok || !strings.Contains(tmpl.Body, Selection) {
+		t.Errorf("Expected a starter template with a selection placeholder, got %+v", tmpl)
+	}
+
+	if _, err := Create(dir, "standup"); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("Expected already exists error, got %v", err)
+	}
+	if _, err := Create(dir, "../escape"); err == nil {
+		t.Error("Expected invalid name error")
+	}
+}
@@ -0,0 +1,252 @@
+package tool
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/fetch"
+	"github.com/butter-bot-machines/skylark/pkg/fs/osfs"
+)
+
+// LockFile records where installed tools came from, relative to the
+// configuration directory
+const LockFile = "tools.lock"
+
+// Lock holds the installed tools by name
+type Lock struct {
+	Tools map[string]LockEntry `json:"tools"`
+}
+
+// LockEntry pins an installed tool to its source
+type LockEntry struct {
+	Source      string    `json:"source"`
+	Version     string    `json:"version,omitempty"` // Tag, branch or commit requested
+	Commit      string    `json:"commit,omitempty"`  // Commit installed, for git repositories
+	Hash        string    `json:"hash"`              // SHA-256 of the installed sources
+	InstalledAt time.Time `json:"installed_at"`
+}
+
+// LoadLock reads the lock file at path. A missing file is an empty lock.
+func LoadLock(path string) (*Lock, error) {
+	lock := &Lock{Tools: make(map[string]LockEntry)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, iofs.ErrNotExist) {
+		return lock, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tool lock: %w", err)
+	}
+	if err := json.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("failed to parse tool lock: %w", err)
+	}
+	if lock.Tools == nil {
+		lock.Tools = make(map[string]LockEntry)
+	}
+	return lock, nil
+}
+
+// Save writes the lock to path
+func (l *Lock) Save(path string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := osfs.WriteFile(path, append(data, '\n'), 0644, false); err != nil {
+		return fmt.Errorf("failed to write tool lock: %w", err)
+	}
+	return nil
+}
+
+// Installer installs tools from directories and git repositories into a
+// tools directory, pinning them in a lock file
+type Installer struct {
+	ToolsDir string // Tools are installed here, one directory each
+	LockPath string
+}
+
+// Install installs the tool at spec, a directory or git URL optionally
+// followed by @<version>, as name (default: the directory or repository
+// name). The sources are compiled and health checked before the tool is
+// pinned; a tool that fails is removed again. An installed tool is only
+// replaced with force.
+func (i *Installer) Install(spec, name string, force bool) (string, LockEntry, error) {
+	source, version := fetch.SplitVersion(spec)
+	lock, err := LoadLock(i.LockPath)
+	if err != nil {
+		return "", LockEntry{}, err
+	}
+
+	pkg, err := fetch.Fetch(source, version)
+	if err != nil {
+		return "", LockEntry{}, err
+	}
+	defer pkg.Close()
+	if name == "" {
+		name = pkg.Name
+	}
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", LockEntry{}, fmt.Errorf("invalid tool name: %q", name)
+	}
+	if _, err := os.Stat(filepath.Join(i.ToolsDir, name)); err == nil && !force {
+		return "", LockEntry{}, fmt.Errorf("tool %s is already installed", name)
+	}
+
+	entry, err := i.install(pkg, name)
+	if err != nil {
+		return "", LockEntry{}, err
+	}
+	entry.Source, entry.Version = source, version
+	lock.Tools[name] = entry
+	return name, entry, lock.Save(i.LockPath)
+}
+
+// Update installs the pinned tools named again, or all pinned tools
+// without names, from their source and version. A name may carry a new
+// version as name@version. It returns the entries before and after.
+func (i *Installer) Update(names []string) (before, after map[string]LockEntry, err error) {
+	lock, err := LoadLock(i.LockPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	versions := make(map[string]*string)
+	for _, spec := range names {
+		name, version := fetch.SplitVersion(spec)
+		if _, ok := lock.Tools[name]; !ok {
+			return nil, nil, fmt.Errorf("tool %s is not in %s", name, LockFile)
+		}
+		if version == "" {
+			versions[name] = nil
+		} else {
+			versions[name] = &version
+		}
+	}
+	if len(names) == 0 {
+		for name := range lock.Tools {
+			versions[name] = nil
+		}
+	}
+
+	sorted := make([]string, 0, len(versions))
+	for name := range versions {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	before, after = make(map[string]LockEntry), make(map[string]LockEntry)
+	for _, name := range sorted {
+		entry := lock.Tools[name]
+		before[name] = entry
+		if v := versions[name]; v != nil {
+			entry.Version = *v
+		}
+
+		pkg, err := fetch.Fetch(entry.Source, entry.Version)
+		if err != nil {
+			return before, after, fmt.Errorf("failed to update %s: %w", name, err)
+		}
+		updated, err := i.install(pkg, name)
+		pkg.Close()
+		if err != nil {
+			return before, after, fmt.Errorf("failed to update %s: %w", name, err)
+		}
+		updated.Source, updated.Version = entry.Source, entry.Version
+		lock.Tools[name] = updated
+		after[name] = updated
+		if err := lock.Save(i.LockPath); err != nil {
+			return before, after, err
+		}
+	}
+	return before, after, nil
+}
+
+// install copies pkg to the tool directory of name, then compiles and
+// health checks it, restoring the previous version when that fails
+func (i *Installer) install(pkg *fetch.Package, name string) (LockEntry, error) {
+	if _, err := os.Stat(filepath.Join(pkg.Dir, "main.go")); err != nil {
+		return LockEntry{}, fmt.Errorf("tool package has no main.go: %w", err)
+	}
+	hash, err := hashDir(pkg.Dir)
+	if err != nil {
+		return LockEntry{}, fmt.Errorf("failed to hash tool sources: %w", err)
+	}
+
+	target := filepath.Join(i.ToolsDir, name)
+	previous := target + ".previous"
+	if err := os.RemoveAll(previous); err != nil {
+		return LockEntry{}, err
+	}
+	if err := os.MkdirAll(i.ToolsDir, 0755); err != nil {
+		return LockEntry{}, fmt.Errorf("failed to create tools directory: %w", err)
+	}
+	if err := os.Rename(target, previous); err != nil && !errors.Is(err, iofs.ErrNotExist) {
+		return LockEntry{}, fmt.Errorf("failed to move installed tool aside: %w", err)
+	}
+	restore := func() {
+		os.RemoveAll(target)
+		os.Rename(previous, target)
+	}
+
+	if err := pkg.CopyTo(target, nil); err != nil {
+		restore()
+		return LockEntry{}, fmt.Errorf("failed to copy tool: %w", err)
+	}
+	if err := verify(i.ToolsDir, name); err != nil {
+		restore()
+		return LockEntry{}, err
+	}
+	os.RemoveAll(previous)
+
+	return LockEntry{Commit: pkg.Commit, Hash: hash, InstalledAt: time.Now().UTC()}, nil
+}
+
+// verify compiles the tool name under dir and runs its health check
+func verify(dir, name string) error {
+	m, err := NewManager(dir)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	_, err = m.LoadTool(name)
+	return err
+}
+
+// hashDir returns the SHA-256 of the paths and contents of the files under
+// dir, leaving out git metadata
+func hashDir(dir string) (string, error) {
+	h := sha256.New()
+	err := filepath.WalkDir(dir, func(path string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", filepath.ToSlash(rel), len(data))
+		h.Write(data)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,154 @@
+package tool
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// toolSource returns the source of a tool whose health check reports
+// healthy
+func toolSource(healthy bool) string {
+	status := "true"
+	if !healthy {
+		status = "false"
+	}
+	return `package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+func main() {
+	usage := flag.Bool("usage", false, "Print JSON schema")
+	health := flag.Bool("health", false, "Run health check")
+	flag.Parse()
+	if *usage {
+		fmt.Println(` + "`" + `{"schema": {"name": "echo", "description": "Echoes", "parameters": {"type": "object"}}}` + "`" + `)
+		return
+	}
+	if *health {
+		fmt.Println(` + "`" + `{"status": ` + status + `, "details": "checked"}` + "`" + `)
+		return
+	}
+}
+`
+}
+
+// commitTool commits a tool source to the git repository at dir, creating
+// it if needed, and tags the commit when tag is set
+func commitTool(t *testing.T, dir string, healthy bool, tag string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(toolSource(healthy)), 0644); err != nil {
+		t.Fatalf("Failed to write main.go: %v", err)
+	}
+	commands := [][]string{
+		{"init", "--quiet"},
+		{"add", "."},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "--allow-empty", "-m", "Update echo"},
+	}
+	if tag != "" {
+		commands = append(commands, []string{"tag", tag})
+	}
+	for _, args := range commands {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %s: %v", args, output, err)
+		}
+	}
+}
+
+func TestInstallerFromDirectory(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "echo")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "main.go"), []byte(toolSource(true)), 0644); err != nil {
+		t.Fatalf("Failed to write main.go: %v", err)
+	}
+	project := t.TempDir()
+	installer := &Installer{ToolsDir: filepath.Join(project, "tools"), LockPath: filepath.Join(project, LockFile)}
+
+	name, entry, err := installer.Install(src, "", false)
+	if err != nil {
+		t.Fatalf("Failed to install: %v", err)
+	}
+	if name != "echo" || entry.Source != src || entry.Hash == "" || entry.Commit != "" {
+		t.Errorf("Unexpected installation %s: %+v", name, entry)
+	}
+	if _, err := os.Stat(filepath.Join(installer.ToolsDir, "echo", "echo")); err != nil {
+		t.Errorf("Expected the tool to be compiled: %v", err)
+	}
+	lock, err := LoadLock(installer.LockPath)
+	if err != nil || lock.Tools["echo"].Hash != entry.Hash {
+		t.Errorf("Expected the tool in the lock, got %+v, %v", lock, err)
+	}
+
+	if _, _, err := installer.Install(src, "", false); err == nil || !strings.Contains(err.Error(), "already installed") {
+		t.Errorf("Expected already installed error, got %v", err)
+	}
+	if _, _, err := installer.Install(src+"@v1", "other", false); err == nil || !strings.Contains(err.Error(), "only git repositories have versions") {
+		t.Errorf("Expected version error, got %v", err)
+	}
+}
+
+func TestInstallerFromGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	repo := filepath.Join(t.TempDir(), "echo")
+	commitTool(t, repo, true, "v1")
+	commitTool(t, repo, false, "") // The default branch is broken
+
+	project := t.TempDir()
+	installer := &Installer{ToolsDir: filepath.Join(project, "tools"), LockPath: filepath.Join(project, LockFile)}
+
+	// The broken head fails its health check and leaves nothing behind
+	if _, _, err := installer.Install("file://"+repo, "", false); err == nil || !strings.Contains(err.Error(), "unhealthy") {
+		t.Fatalf("Expected health check failure, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(installer.ToolsDir, "echo")); !os.IsNotExist(err) {
+		t.Errorf("Expected the failed tool to be removed, got %v", err)
+	}
+
+	_, v1, err := installer.Install("file://"+repo+"@v1", "", false)
+	if err != nil {
+		t.Fatalf("Failed to install v1: %v", err)
+	}
+	if v1.Version != "v1" || v1.Commit == "" {
+		t.Errorf("Expected v1 pinned to a commit, got %+v", v1)
+	}
+
+	// Updating to the broken head keeps v1
+	if _, _, err := installer.Update([]string{"echo@HEAD"}); err == nil {
+		t.Errorf("Expected the update to fail")
+	}
+	lock, _ := LoadLock(installer.LockPath)
+	if lock.Tools["echo"].Commit != v1.Commit {
+		t.Errorf("Expected v1 to stay pinned, got %+v", lock.Tools["echo"])
+	}
+	if _, err := os.Stat(filepath.Join(installer.ToolsDir, "echo", "main.go")); err != nil {
+		t.Errorf("Expected v1 to stay installed: %v", err)
+	}
+
+	// A fixed head updates
+	commitTool(t, repo, true, "")
+	before, after, err := installer.Update([]string{"echo@HEAD"})
+	if err != nil {
+		t.Fatalf("Failed to update: %v", err)
+	}
+	if before["echo"].Commit != v1.Commit || after["echo"].Commit == v1.Commit || after["echo"].Version != "HEAD" {
+		t.Errorf("Expected the update from v1 to the head, got %+v -> %+v", before["echo"], after["echo"])
+	}
+
+	if _, _, err := installer.Update([]string{"missing"}); err == nil || !strings.Contains(err.Error(), "not in tools.lock") {
+		t.Errorf("Expected unknown tool error, got %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package tool
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/sandbox"
+)
+
+// DefaultHeartbeatTimeout is how long a streaming tool may stay silent
+// before it is considered hung, unless it declares otherwise
+const DefaultHeartbeatTimeout = 30 * time.Second
+
+// StreamSpec is declared in the --usage output of long-running tools, as
+// "stream": {"heartbeat_timeout": "1m"}. Such tools write newline-delimited
+// JSON records to stdout: any number of progress and heartbeat records,
+// then one result or error record:
+//
+//	{"progress": {"message": "Crawled 10 of 40 pages", "percent": 25}}
+//	{"heartbeat": true}
+//	{"result": {"pages": 40}}
+//
+// They have no time limit; instead they are stopped when no record arrives
+// within the heartbeat timeout.
+type StreamSpec struct {
+	HeartbeatTimeout string `json:"heartbeat_timeout,omitempty"` // A Go duration (default: DefaultHeartbeatTimeout)
+}
+
+// timeout returns the heartbeat timeout of the spec
+func (s *StreamSpec) timeout() (time.Duration, error) {
+	if s.HeartbeatTimeout == "" {
+		return DefaultHeartbeatTimeout, nil
+	}
+	d, err := time.ParseDuration(s.HeartbeatTimeout)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid stream heartbeat_timeout: %q", s.HeartbeatTimeout)
+	}
+	return d, nil
+}
+
+// Progress is a progress record of a streaming tool
+type Progress struct {
+	Tool    string  `json:"-"`                 // Set to the tool's name when reported
+	Message string  `json:"message"`           // What the tool is doing
+	Percent float64 `json:"percent,omitempty"` // How far along it is, when known
+}
+
+// String returns the progress as one line
+func (p Progress) String() string {
+	if p.Percent > 0 {
+		return fmt.Sprintf("%s: %s (%.0f%%)", p.Tool, p.Message, p.Percent)
+	}
+	return fmt.Sprintf("%s: %s", p.Tool, p.Message)
+}
+
+type progressKey struct{}
+
+// ContextWithProgress returns a copy of ctx whose streaming tools report
+// their progress to report. It may be called from several goroutines.
+func ContextWithProgress(ctx context.Context, report func(Progress)) context.Context {
+	return context.WithValue(ctx, progressKey{}, report)
+}
+
+// progressFromContext returns the progress function ctx carries, or one
+// that drops progress
+func progressFromContext(ctx context.Context) func(Progress) {
+	if report, ok := ctx.Value(progressKey{}).(func(Progress)); ok && report != nil {
+		return report
+	}
+	return func(Progress) {}
+}
+
+// streamRecord is a line of a streaming tool's output
+type streamRecord struct {
+	Progress  *Progress       `json:"progress"`
+	Heartbeat bool            `json:"heartbeat"`
+	Result    json.RawMessage `json:"result"`
+	Error     *Failure        `json:"error"`
+}
+
+// executeStream runs cmd as a streaming tool, returning its result record
+func (t *Tool) executeStream(ctx context.Context, cmd *exec.Cmd, input []byte, sb *sandbox.Sandbox) ([]byte, error) {
+	heartbeat, err := t.Schema.Stream.timeout()
+	if err != nil {
+		return nil, err
+	}
+	out := &streamWriter{
+		tool:   t.Name,
+		report: progressFromContext(ctx),
+		beats:  make(chan struct{}, 1),
+	}
+	stderr := &tailBuffer{max: maxStderr}
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = out
+	cmd.Stderr = stderr
+
+	err = sb.ExecuteStreaming(ctx, cmd, heartbeat, out.beats)
+	out.flush()
+	if out.failure != nil {
+		return nil, out.failure
+	}
+	if err != nil {
+		return nil, t.executionError(err, stderr)
+	}
+	if out.result == nil {
+		return nil, t.executionError(fmt.Errorf("no result record"), stderr)
+	}
+	return out.result, nil
+}
+
+// streamWriter splits a streaming tool's output into records as it
+// arrives. Every line counts as a heartbeat.
+type streamWriter struct {
+	tool    string
+	report  func(Progress)
+	beats   chan struct{}
+	partial []byte // Incomplete last line
+
+	result  []byte
+	failure *Failure
+}
+
+// Write implements io.Writer
+func (w *streamWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.record(w.partial[:i])
+		w.partial = w.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush handles a last line without a newline
+func (w *streamWriter) flush() {
+	if len(bytes.TrimSpace(w.partial)) > 0 {
+		w.record(w.partial)
+	}
+	w.partial = nil
+}
+
+// record handles one line of output
+func (w *streamWriter) record(line []byte) {
+	select {
+	case w.beats <- struct{}{}:
+	default:
+	}
+
+	var r streamRecord
+	if err := json.Unmarshal(bytes.TrimSpace(line), &r); err != nil {
+		return // Not a record; still a sign of life
+	}
+	switch {
+	case r.Error != nil && r.Error.Message != "":
+		w.failure = r.Error
+	case r.Result != nil:
+		w.result = append([]byte(nil), r.Result...)
+	case r.Progress != nil:
+		progress := *r.Progress
+		progress.Tool = w.tool
+		w.report(progress)
+	}
+}
@@ -0,0 +1,142 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/sandbox"
+)
+
+// crawlerSource is a streaming tool that reports progress every 100ms.
+// The "hang" mode stops sending records and the "fail" mode ends with an
+// error record.
+const crawlerSource = `package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+func main() {
+	usage := flag.Bool("usage", false, "Print JSON schema")
+	health := flag.Bool("health", false, "Run health check")
+	flag.Parse()
+	if *usage {
+		fmt.Println(` + "`" + `{"schema": {"name": "crawler", "description": "Crawls", "parameters": {"type": "object", "properties": {}}}, "stream": {"heartbeat_timeout": "300ms"}}` + "`" + `)
+		return
+	}
+	if *health {
+		fmt.Println(` + "`" + `{"status": true, "details": "ok"}` + "`" + `)
+		return
+	}
+	var input struct{ Mode string }
+	json.NewDecoder(os.Stdin).Decode(&input)
+	for i := 1; i <= 5; i++ {
+		fmt.Printf("{\"progress\": {\"message\": \"page %d of 5\", \"percent\": %d}}\n", i, i*20)
+		if input.Mode == "hang" {
+			time.Sleep(10 * time.Second)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if input.Mode == "fail" {
+		fmt.Println(` + "`" + `{"error": {"code": "blocked", "message": "robots.txt forbids crawling"}}` + "`" + `)
+		os.Exit(1)
+	}
+	fmt.Println(` + "`" + `{"heartbeat": true}` + "`" + `)
+	fmt.Print(` + "`" + `{"result": {"pages": 5}}` + "`" + `)
+}
+`
+
+func TestStreamingTool(t *testing.T) {
+	basePath := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(basePath, "crawler"), 0755); err != nil {
+		t.Fatalf("Failed to create tool directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(basePath, "crawler", "main.go"), []byte(crawlerSource), 0644); err != nil {
+		t.Fatalf("Failed to write main.go: %v", err)
+	}
+	manager, err := NewManager(basePath)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer manager.Close()
+	tool, err := manager.LoadTool("crawler")
+	if err != nil {
+		t.Fatalf("LoadTool() error = %v", err)
+	}
+
+	// The run takes longer than the CPU time limit, which streaming tools
+	// replace with heartbeats
+	limits := sandbox.DefaultLimits
+	limits.MaxCPUTime = 200 * time.Millisecond
+	sb, err := sandbox.NewSandbox(basePath, &limits, &sandbox.NetworkPolicy{})
+	if err != nil {
+		t.Fatalf("Failed to create sandbox: %v", err)
+	}
+
+	var mu sync.Mutex
+	var progress []string
+	ctx := ContextWithProgress(context.Background(), func(p Progress) {
+		mu.Lock()
+		defer mu.Unlock()
+		progress = append(progress, p.String())
+	})
+
+	output, err := tool.ExecuteContext(ctx, []byte(`{}`), nil, sb)
+	if err != nil {
+		t.Fatalf("ExecuteContext() error = %v", err)
+	}
+	if string(output) != `{"pages": 5}` {
+		t.Errorf("Expected the result record, got %s", output)
+	}
+	mu.Lock()
+	if len(progress) != 5 || progress[0] != "crawler: page 1 of 5 (20%)" || progress[4] != "crawler: page 5 of 5 (100%)" {
+		t.Errorf("Expected 5 progress reports, got %v", progress)
+	}
+	mu.Unlock()
+
+	// An error record is a Failure
+	_, err = tool.ExecuteContext(context.Background(), []byte(`{"mode": "fail"}`), nil, sb)
+	var failure *Failure
+	if !errors.As(err, &failure) || failure.Code != "blocked" {
+		t.Errorf("Expected the blocked failure, got %v", err)
+	}
+
+	// A tool that goes quiet is stopped after its heartbeat timeout
+	start := time.Now()
+	_, err = tool.ExecuteContext(context.Background(), []byte(`{"mode": "hang"}`), nil, sb)
+	if err == nil || !strings.Contains(err.Error(), "no heartbeat for 300ms") {
+		t.Errorf("Expected a heartbeat timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the hung tool to be stopped early, took %v", elapsed)
+	}
+}
+
+func TestStreamSpecTimeout(t *testing.T) {
+	tests := []struct {
+		timeout string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", DefaultHeartbeatTimeout, false},
+		{"1m", time.Minute, false},
+		{"soon", 0, true},
+		{"-1s", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := (&StreamSpec{HeartbeatTimeout: tt.timeout}).timeout()
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("Expected %v (error %v) for %q, got %v, %v", tt.want, tt.wantErr, tt.timeout, got, err)
+		}
+	}
+}
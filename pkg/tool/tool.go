@@ -1,16 +1,26 @@
 package tool
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"io/fs"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/butter-bot-machines/skylark/internal/builtins"
+	skerrors "github.com/butter-bot-machines/skylark/pkg/errors"
+	skfs "github.com/butter-bot-machines/skylark/pkg/fs"
+	"github.com/butter-bot-machines/skylark/pkg/fs/osfs"
 	"github.com/butter-bot-machines/skylark/pkg/sandbox"
 	"github.com/fsnotify/fsnotify"
 )
@@ -23,16 +33,35 @@ type Tool struct {
 	LastBuilt   time.Time `json:"last_built"`
 	Description string    `json:"description"`
 	Schema      Schema    `json:"schema"`
+
+	fn      Func    // Set for tools registered in process
+	secrets Secrets // Resolves secret:// environment values (optional)
+}
+
+// Func implements a tool in process. It receives the tool's JSON input and
+// returns its output.
+type Func func(input []byte) ([]byte, error)
+
+// Definition describes a tool implemented by a Go function rather than a
+// compiled binary
+type Definition struct {
+	Name        string
+	Version     string // Semantic version, checked against assistants' min_tool_versions (optional)
+	Description string
+	Parameters  map[string]interface{} // JSON schema, defaults to an object with no properties
+	Func        Func
 }
 
 // Schema represents the tool's schema and environment requirements
 type Schema struct {
-	Schema struct {
+	Version string `json:"version,omitempty"` // Semantic version of the tool, such as 1.2.0
+	Schema  struct {
 		Name        string                 `json:"name"`
 		Description string                 `json:"description"`
 		Parameters  map[string]interface{} `json:"parameters"`
 	} `json:"schema"`
-	Env map[string]EnvVar `json:"env"`
+	Env    map[string]EnvVar `json:"env"`
+	Stream *StreamSpec       `json:"stream,omitempty"` // Set by long-running tools that stream progress
 }
 
 // EnvVar represents an environment variable requirement
@@ -40,27 +69,62 @@ type EnvVar struct {
 	Type        string      `json:"type"`
 	Description string      `json:"description"`
 	Default     interface{} `json:"default,omitempty"`
+	Required    bool        `json:"required,omitempty"` // The tool does not run without it
+}
+
+// SecretScheme prefixes environment values that name a secret instead of
+// holding one, such as secret://search_api_key
+const SecretScheme = "secret://"
+
+// Secrets resolves secret references in tool environments. It is
+// implemented by security.KeyStore.
+type Secrets interface {
+	// Get returns the value of the named secret
+	Get(name string) (string, error)
+}
+
+// BuildOptions customizes how a tool is compiled
+type BuildOptions struct {
+	GoFlags string            // Passed to go build as GOFLAGS, such as -tags=netgo
+	Env     map[string]string // Extra environment of go build, such as CGO_ENABLED
 }
 
 // Manager handles tool compilation and execution
 type Manager struct {
-	tools    map[string]*Tool
-	basePath string
-	watcher  *fsnotify.Watcher
-	mu       sync.RWMutex
+	tools   map[string]*Tool
+	secrets Secrets                 // Resolves secret:// environment values (optional)
+	builds  map[string]BuildOptions // Build options by tool name
+	fs      skfs.FS                 // Tool sources, one directory per tool
+	watcher *fsnotify.Watcher
+	mu      sync.RWMutex
 }
 
-// NewManager creates a new tool manager
+// diskFS is implemented by file systems backed by the OS, where tools can
+// be compiled and run
+type diskFS interface {
+	// Path returns the OS path of name
+	Path(op, name string) (string, error)
+}
+
+// NewManager creates a new tool manager for the tools under basePath
 func NewManager(basePath string) (*Manager, error) {
+	return NewManagerWithFS(osfs.New(basePath, osfs.Options{}))
+}
+
+// NewManagerWithFS creates a new tool manager for the tools in fsys. Only
+// tools on the OS file system can be compiled; with another file system,
+// tools are listed but only registered tools run.
+func NewManagerWithFS(fsys skfs.FS) (*Manager, error) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create watcher: %w", err)
 	}
 
 	m := &Manager{
-		tools:    make(map[string]*Tool),
-		basePath: basePath,
-		watcher:  watcher,
+		tools:   make(map[string]*Tool),
+		builds:  make(map[string]BuildOptions),
+		fs:      fsys,
+		watcher: watcher,
 	}
 
 	// Start watching for tool changes
@@ -78,13 +142,10 @@ func (m *Manager) InitBuiltinTools() error {
 	}
 
 	// Extract to .skai/tools like any other tool
-	toolDir := filepath.Join(m.basePath, "currentdatetime")
-	if err := os.MkdirAll(toolDir, 0755); err != nil {
+	if err := m.fs.MkdirAll("currentdatetime", 0755); err != nil {
 		return fmt.Errorf("failed to create tool directory: %w", err)
 	}
-
-	mainFile := filepath.Join(toolDir, "main.go")
-	if err := os.WriteFile(mainFile, data, 0644); err != nil {
+	if err := m.fs.WriteFile(path.Join("currentdatetime", "main.go"), data, 0644); err != nil {
 		return fmt.Errorf("failed to write source: %w", err)
 	}
 
@@ -94,6 +155,10 @@ func (m *Manager) InitBuiltinTools() error {
 		return fmt.Errorf("failed to compile tool: %w", err)
 	}
 
+	toolDir, err := m.diskPath("currentdatetime")
+	if err != nil {
+		return err
+	}
 	if err := m.watcher.Add(toolDir); err != nil {
 		return fmt.Errorf("failed to watch tool directory: %w", err)
 	}
@@ -109,8 +174,8 @@ func (m *Manager) watchTools() {
 			if !ok {
 				return
 			}
-			// Only handle .go file changes
-			if filepath.Ext(event.Name) != ".go" {
+			// Only handle Go sources and module files
+			if base := filepath.Base(event.Name); filepath.Ext(base) != ".go" && base != "go.mod" && base != "go.sum" {
 				continue
 			}
 			// Get tool name from path
@@ -128,6 +193,15 @@ func (m *Manager) watchTools() {
 	}
 }
 
+// diskPath returns the OS path of the directory of the tool name
+func (m *Manager) diskPath(name string) (string, error) {
+	disk, ok := m.fs.(diskFS)
+	if !ok {
+		return "", fmt.Errorf("tool %s is not on the OS file system and cannot be compiled", name)
+	}
+	return disk.Path("compile", name)
+}
+
 // Close stops the tool manager and cleans up resources
 func (m *Manager) Close() error {
 	return m.watcher.Close()
@@ -136,23 +210,30 @@ func (m *Manager) Close() error {
 // LoadTool loads a tool from the specified directory
 func (m *Manager) LoadTool(name string) (*Tool, error) {
 	// Check if already loaded
-	if tool, exists := m.tools[name]; exists {
+	m.mu.RLock()
+	tool, exists := m.tools[name]
+	m.mu.RUnlock()
+	if exists {
 		return tool, nil
 	}
 
-	toolPath := filepath.Join(m.basePath, name)
-	mainFile := filepath.Join(toolPath, "main.go")
-
 	// Check if main.go exists
-	if _, err := os.Stat(mainFile); os.IsNotExist(err) {
+	if _, err := fs.Stat(m.fs, path.Join(name, "main.go")); errors.Is(err, fs.ErrNotExist) {
 		return nil, fmt.Errorf("tool %s not found: %w", name, err)
 	}
+	toolPath, err := m.diskPath(name)
+	if err != nil {
+		return nil, err
+	}
 
 	// Create tool instance
-	tool := &Tool{
-		Name: name,
-		Path: toolPath,
+	m.mu.RLock()
+	tool = &Tool{
+		Name:    name,
+		Path:    toolPath,
+		secrets: m.secrets,
 	}
+	m.mu.RUnlock()
 
 	// Compile the tool first
 	if err := m.Compile(name); err != nil {
@@ -176,14 +257,122 @@ func (m *Manager) LoadTool(name string) (*Tool, error) {
 	return tool, nil
 }
 
-// Compile compiles the tool's source code
+// Register adds a tool implemented by def.Func. Registered tools take
+// precedence over compiled tools of the same name.
+func (m *Manager) Register(def Definition) error {
+	if def.Name == "" {
+		return fmt.Errorf("tool name is required")
+	}
+	if def.Func == nil {
+		return fmt.Errorf("tool %s has no function", def.Name)
+	}
+
+	if def.Version != "" && !ValidVersion(def.Version) {
+		return fmt.Errorf("tool %s has an invalid version: %q", def.Name, def.Version)
+	}
+
+	t := &Tool{
+		Name:        def.Name,
+		Version:     def.Version,
+		Description: def.Description,
+		fn:          def.Func,
+	}
+	t.Schema.Version = def.Version
+	t.Schema.Schema.Name = def.Name
+	t.Schema.Schema.Description = def.Description
+	t.Schema.Schema.Parameters = def.Parameters
+	if t.Schema.Schema.Parameters == nil {
+		t.Schema.Schema.Parameters = map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{},
+		}
+	}
+
+	m.mu.Lock()
+	m.tools[def.Name] = t
+	m.mu.Unlock()
+	return nil
+}
+
+// List returns the names of the tools under the base path and of the
+// registered tools, sorted. A tool under the base path is any subdirectory
+// containing a main.go.
+func (m *Manager) List() ([]string, error) {
+	seen := make(map[string]bool)
+	var names []string
+
+	m.mu.RLock()
+	for name, t := range m.tools {
+		if t.fn != nil {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	m.mu.RUnlock()
+
+	entries, err := fs.ReadDir(m.fs, ".")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read tools directory: %w", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || seen[entry.Name()] {
+			continue
+		}
+		if _, err := fs.Stat(m.fs, path.Join(entry.Name(), "main.go")); err == nil {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// SetSecrets sets how secret:// values in tool environments are resolved
+func (m *Manager) SetSecrets(secrets Secrets) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.secrets = secrets
+	for _, t := range m.tools {
+		t.secrets = secrets
+	}
+}
+
+// SetBuildOptions sets how the tool name is compiled from now on
+func (m *Manager) SetBuildOptions(name string, opts BuildOptions) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.builds[name] = opts
+}
+
+// Compile compiles the tool's source code. A tool with its own go.mod is
+// built as a module, so it can have packages and dependencies, using its
+// vendor directory when it has one; otherwise its main.go is built alone.
 func (m *Manager) Compile(name string) error {
-	toolPath := filepath.Join(m.basePath, name)
-	mainFile := filepath.Join(toolPath, "main.go")
+	toolPath, err := m.diskPath(name)
+	if err != nil {
+		return err
+	}
 	binaryPath := filepath.Join(toolPath, name)
-
-	cmd := exec.Command("go", "build", "-o", binaryPath, mainFile)
+	m.mu.RLock()
+	opts := m.builds[name]
+	m.mu.RUnlock()
+
+	goflags := opts.GoFlags
+	cmd := exec.Command("go", "build", "-o", binaryPath, filepath.Join(toolPath, "main.go"))
+	cmd.Env = os.Environ()
+	if _, err := os.Stat(filepath.Join(toolPath, "go.mod")); err == nil {
+		cmd = exec.Command("go", "build", "-o", binaryPath, ".")
+		cmd.Env = append(os.Environ(), "GOWORK=off") // The tool's module stands alone
+		if _, err := os.Stat(filepath.Join(toolPath, "vendor", "modules.txt")); err == nil && !strings.Contains(goflags, "-mod=") {
+			goflags = strings.TrimSpace(goflags + " -mod=vendor")
+		}
+	}
 	cmd.Dir = toolPath // Set working directory to tool path
+	if goflags != "" {
+		cmd.Env = append(cmd.Env, "GOFLAGS="+goflags)
+	}
+	for key, value := range opts.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
 
 	if output, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("compilation failed: %s: %w", output, err)
@@ -211,7 +400,39 @@ func (t *Tool) loadSchema() error {
 	if err := json.Unmarshal(output, &t.Schema); err != nil {
 		return fmt.Errorf("invalid schema format: %w", err)
 	}
+	if t.Schema.Version != "" && !ValidVersion(t.Schema.Version) {
+		return fmt.Errorf("invalid tool version: %q", t.Schema.Version)
+	}
+	t.Version = t.Schema.Version
+	if t.Schema.Stream != nil {
+		if _, err := t.Schema.Stream.timeout(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
 
+// semver matches semantic versions, with an optional leading v
+var semver = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+
+// ValidVersion reports whether version is a semantic version such as 1.2.0
+func ValidVersion(version string) bool {
+	return semver.MatchString(version)
+}
+
+// Satisfies returns an error unless the tool's version is minVersion or
+// later. Tools that declare no version satisfy no minimum.
+func (t *Tool) Satisfies(minVersion string) error {
+	if minVersion == "" {
+		return nil
+	}
+	if t.Version == "" {
+		return fmt.Errorf("tool %s declares no version, %s or later required", t.Name, minVersion)
+	}
+	if !sandbox.VersionAtLeast(t.Version, minVersion) {
+		return fmt.Errorf("tool %s is version %s, %s or later required", t.Name, t.Version, minVersion)
+	}
 	return nil
 }
 
@@ -238,92 +459,183 @@ func (t *Tool) checkHealth() error {
 	return nil
 }
 
-// Execute runs the tool with the provided input and environment
+// Execute runs the tool with the provided input and environment.
+// Registered tools run in process and ignore env and sb.
 func (t *Tool) Execute(input []byte, env map[string]string, sb *sandbox.Sandbox) ([]byte, error) {
+	return t.ExecuteContext(context.Background(), input, env, sb)
+}
+
+// ExecuteContext runs the tool like Execute. A streaming tool reports its
+// progress to the function ctx carries (see ContextWithProgress) and is
+// stopped when ctx is done.
+func (t *Tool) ExecuteContext(ctx context.Context, input []byte, env map[string]string, sb *sandbox.Sandbox) ([]byte, error) {
+	if t.fn != nil {
+		output, err := t.fn(input)
+		if err != nil {
+			return nil, fmt.Errorf("tool execution failed: %w", err)
+		}
+		if failure := parseFailure(output); failure != nil {
+			return nil, failure
+		}
+		return output, nil
+	}
+
 	binaryPath := filepath.Join(t.Path, t.Name)
 	cmd := exec.Command(binaryPath)
 
 	// Build environment from schema
+	cmdEnv, err := t.environment(env)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Env = cmdEnv
+
+	if t.Schema.Stream != nil {
+		return t.executeStream(ctx, cmd, input, sb)
+	}
+
+	// Feed input and collect output through buffers, which the command
+	// finishes copying before it returns, so concurrent calls cannot race
+	// the pipes closing
+	var stdout bytes.Buffer
+	stderr := &tailBuffer{max: maxStderr}
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = stderr
+
+	// Execute in sandbox. Structured error output is reported as is,
+	// whatever the exit status.
+	err = sb.Execute(cmd)
+	if failure := parseFailure(stdout.Bytes()); failure != nil {
+		return nil, failure
+	}
+	if err != nil {
+		return nil, t.executionError(err, stderr)
+	}
+	return stdout.Bytes(), nil
+}
+
+// environment returns the environment the tool's schema asks for. Each
+// variable comes from env (the tool's configuration), the current
+// environment or the schema's default, in that order; secret:// values are
+// resolved. It fails listing the required variables that have no value.
+func (t *Tool) environment(env map[string]string) ([]string, error) {
 	cmdEnv := make([]string, 0, len(t.Schema.Env)+1)
 
 	// Add PATH for binary execution
 	if path := os.Getenv("PATH"); path != "" {
 		cmdEnv = append(cmdEnv, "PATH="+path)
 	}
+
+	var missing []string
 	for name, spec := range t.Schema.Env {
-		// Try config value first
-		if value, ok := env[name]; ok {
-			fmt.Printf("Using config value for %s: %s\n", name, value)
-			cmdEnv = append(cmdEnv, fmt.Sprintf("%s=%s", name, value))
-			continue
+		value, ok := env[name]
+		if !ok {
+			value = os.Getenv(name)
 		}
-
-		// Fall back to current environment
-		if value := os.Getenv(name); value != "" {
-			fmt.Printf("Using env value for %s: %s\n", name, value)
-			cmdEnv = append(cmdEnv, fmt.Sprintf("%s=%s", name, value))
-			continue
+		if value == "" && spec.Default != nil {
+			value = fmt.Sprintf("%v", spec.Default)
 		}
-
-		// Use default if available
-		if spec.Default != nil {
-			fmt.Printf("Using default value for %s: %v\n", name, spec.Default)
-			cmdEnv = append(cmdEnv, fmt.Sprintf("%s=%v", name, spec.Default))
+		if strings.HasPrefix(value, SecretScheme) {
+			secret, err := t.resolveSecret(strings.TrimPrefix(value, SecretScheme))
+			if err != nil {
+				return nil, fmt.Errorf("tool %s: failed to resolve %s: %w", t.Name, name, err)
+			}
+			value = secret
+		}
+		if value == "" {
+			if spec.Required {
+				missing = append(missing, name)
+			}
+			continue
 		}
+		cmdEnv = append(cmdEnv, name+"="+value)
 	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("tool %s is missing required environment variables: %s", t.Name, strings.Join(missing, ", "))
+	}
+	return cmdEnv, nil
+}
 
-	fmt.Printf("Final env: %v\n", cmdEnv)
-	cmd.Env = cmdEnv
-
-	// Set up pipes
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+// resolveSecret returns the value of the named secret
+func (t *Tool) resolveSecret(name string) (string, error) {
+	if t.secrets == nil {
+		return "", fmt.Errorf("secret %s: no secret store is configured", name)
 	}
-	stdout, err := cmd.StdoutPipe()
+	value, err := t.secrets.Get(name)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+		return "", fmt.Errorf("secret %s: %w", name, err)
 	}
+	return value, nil
+}
 
-	// Create channel to signal stdin write completion
-	done := make(chan error)
+// executionError wraps the error of a failed run as a ToolError, with the
+// end of the tool's stderr as context
+func (t *Tool) executionError(err error, stderr *tailBuffer) error {
+	e := skerrors.ToolError.Wrap(err, "tool execution failed").WithContext("tool", t.Name)
+	if tail := strings.TrimSpace(stderr.String()); tail != "" {
+		e = e.WithContext("stderr", tail)
+	}
+	return e
+}
 
-	// Write input in goroutine
-	go func() {
-		_, err := stdin.Write(input)
-		stdin.Close()
-		done <- err
-	}()
+// maxStderr is how much of the end of a tool's stderr is kept for errors
+const maxStderr = 4096
 
-	// Start reading output before executing
-	outputCh := make(chan []byte)
-	errCh := make(chan error)
-	go func() {
-		output, err := io.ReadAll(stdout)
-		if err != nil {
-			errCh <- fmt.Errorf("failed to read output: %w", err)
-			return
-		}
-		outputCh <- output
-	}()
+// Failure is an error a tool reports by printing structured error output,
+// {"error": {"code": "...", "message": "..."}}, instead of its result.
+// Assistants send it to the model as the tool result, so the model can
+// correct its call.
+type Failure struct {
+	Code    string `json:"code,omitempty"` // Machine-readable, such as not_found
+	Message string `json:"message"`
+}
 
-	// Wait for stdin write to complete
-	if err := <-done; err != nil {
-		return nil, fmt.Errorf("failed to write input: %w", err)
+// Error implements error
+func (f *Failure) Error() string {
+	if f.Code == "" {
+		return "tool error: " + f.Message
 	}
+	return fmt.Sprintf("tool error %s: %s", f.Code, f.Message)
+}
+
+// Result returns the failure as structured error output
+func (f *Failure) Result() string {
+	data, _ := json.Marshal(map[string]*Failure{"error": f})
+	return string(data)
+}
 
-	// Execute in sandbox
-	if err := sb.Execute(cmd); err != nil {
-		return nil, fmt.Errorf("tool execution failed: %w", err)
+// parseFailure returns the failure in structured error output, or nil when
+// output is anything else
+func parseFailure(output []byte) *Failure {
+	var result struct {
+		Error *Failure `json:"error"`
+	}
+	if err := json.Unmarshal(output, &result); err != nil || result.Error == nil || result.Error.Message == "" {
+		return nil
 	}
+	return result.Error
+}
 
-	// Get output or error
-	select {
-	case err := <-errCh:
-		return nil, err
-	case output := <-outputCh:
-		return output, nil
+// tailBuffer keeps the last max bytes written to it
+type tailBuffer struct {
+	buf []byte
+	max int
+}
+
+// Write implements io.Writer
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.max {
+		b.buf = append(b.buf[:0], b.buf[len(b.buf)-b.max:]...)
 	}
+	return len(p), nil
+}
+
+// String returns the bytes kept
+func (b *tailBuffer) String() string {
+	return string(b.buf)
 }
 
 // ValidateInput checks if the input matches the tool's schema
@@ -2,11 +2,15 @@ package tool
 
 import (
 	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	skerrors "github.com/butter-bot-machines/skylark/pkg/errors"
+	"github.com/butter-bot-machines/skylark/pkg/fs/memory"
 	"github.com/butter-bot-machines/skylark/pkg/sandbox"
 )
 
@@ -368,3 +372,432 @@ func TestBuiltinTools(t *testing.T) {
 		t.Errorf("Invalid date format: %v", err)
 	}
 }
+
+func TestToolManagerList(t *testing.T) {
+	basePath := t.TempDir()
+	manager, err := NewManager(basePath)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer manager.Close()
+
+	for _, dir := range []string{"beta", "alpha", "empty"} {
+		if err := os.MkdirAll(filepath.Join(basePath, dir), 0755); err != nil {
+			t.Fatalf("Failed to create tool directory: %v", err)
+		}
+	}
+	for _, name := range []string{"alpha", "beta"} {
+		if err := os.WriteFile(filepath.Join(basePath, name, "main.go"), []byte("package main\n"), 0644); err != nil {
+			t.Fatalf("Failed to write main.go: %v", err)
+		}
+	}
+
+	names, err := manager.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(names) != 2 || names[0] != "alpha" || names[1] != "beta" {
+		t.Errorf("Expected [alpha beta], got %v", names)
+	}
+
+	missing, err := NewManager(filepath.Join(basePath, "missing"))
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer missing.Close()
+	if names, err := missing.List(); err != nil || len(names) != 0 {
+		t.Errorf("Expected no tools for a missing directory, got %v, %v", names, err)
+	}
+}
+
+func TestToolManagerWithFS(t *testing.T) {
+	fsys := memory.New()
+	for _, name := range []string{"beta", "alpha"} {
+		if err := fsys.MkdirAll(name, 0755); err != nil {
+			t.Fatalf("Failed to create tool directory: %v", err)
+		}
+		if err := fsys.WriteFile(name+"/main.go", []byte("package main\n"), 0644); err != nil {
+			t.Fatalf("Failed to write main.go: %v", err)
+		}
+	}
+
+	manager, err := NewManagerWithFS(fsys)
+	if err != nil {
+		t.Fatalf("NewManagerWithFS() error = %v", err)
+	}
+	defer manager.Close()
+
+	names, err := manager.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(names) != 2 || names[0] != "alpha" || names[1] != "beta" {
+		t.Errorf("Expected [alpha beta], got %v", names)
+	}
+
+	// Tools outside the OS file system cannot be compiled
+	if _, err := manager.LoadTool("alpha"); err == nil || !strings.Contains(err.Error(), "cannot be compiled") {
+		t.Errorf("Expected a compile error, got %v", err)
+	}
+	if _, err := manager.LoadTool("missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+}
+
+func TestToolManagerRegister(t *testing.T) {
+	basePath := t.TempDir()
+	manager, err := NewManager(basePath)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer manager.Close()
+
+	if err := os.MkdirAll(filepath.Join(basePath, "compiled"), 0755); err != nil {
+		t.Fatalf("Failed to create tool directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(basePath, "compiled", "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatalf("Failed to write main.go: %v", err)
+	}
+
+	err = manager.Register(Definition{
+		Name:        "upper",
+		Description: "Uppercases text",
+		Func: func(input []byte) ([]byte, error) {
+			var in struct{ Text string }
+			if err := json.Unmarshal(input, &in); err != nil {
+				return nil, err
+			}
+			return []byte(`"` + strings.ToUpper(in.Text) + `"`), nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if err := manager.Register(Definition{Name: "broken"}); err == nil {
+		t.Error("Expected error registering a tool without a function")
+	}
+
+	names, err := manager.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(names) != 2 || names[0] != "compiled" || names[1] != "upper" {
+		t.Errorf("Expected [compiled upper], got %v", names)
+	}
+
+	tool, err := manager.LoadTool("upper")
+	if err != nil {
+		t.Fatalf("LoadTool() error = %v", err)
+	}
+	if tool.Schema.Schema.Description != "Uppercases text" {
+		t.Errorf("Expected description in schema, got %q", tool.Schema.Schema.Description)
+	}
+	input := []byte(`{"text":"hi"}`)
+	if err := tool.ValidateInput(input); err != nil {
+		t.Errorf("ValidateInput() error = %v", err)
+	}
+	output, err := tool.Execute(input, nil, nil)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if string(output) != `"HI"` {
+		t.Errorf("Expected \"HI\", got %s", output)
+	}
+}
+
+func TestToolVersion(t *testing.T) {
+	manager, err := NewManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer manager.Close()
+
+	noop := func(input []byte) ([]byte, error) { return input, nil }
+	if err := manager.Register(Definition{Name: "bad", Version: "1.2", Func: noop}); err == nil || !strings.Contains(err.Error(), "invalid version") {
+		t.Errorf("Expected invalid version error, got %v", err)
+	}
+	if err := manager.Register(Definition{Name: "echo", Version: "1.4.0", Func: noop}); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if err := manager.Register(Definition{Name: "plain", Func: noop}); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	tests := []struct {
+		tool       string
+		minVersion string
+		wantErr    string
+	}{
+		{"echo", "", ""},
+		{"echo", "1.2.0", ""},
+		{"echo", "v1.4.0", ""},
+		{"echo", "2.0.0", "tool echo is version 1.4.0, 2.0.0 or later required"},
+		{"plain", "", ""},
+		{"plain", "1.0.0", "tool plain declares no version"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tool+"@"+tt.minVersion, func(t *testing.T) {
+			tool, err := manager.LoadTool(tt.tool)
+			if err != nil {
+				t.Fatalf("LoadTool() error = %v", err)
+			}
+			err = tool.Satisfies(tt.minVersion)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	for version, want := range map[string]bool{"1.0.0": true, "v2.10.3": true, "1.0.0-rc.1+build": true, "1.0": false, "01.0.0": false, "latest": false} {
+		if got := ValidVersion(version); got != want {
+			t.Errorf("Expected ValidVersion(%q) = %v, got %v", version, want, got)
+		}
+	}
+}
+
+func TestToolModuleBuild(t *testing.T) {
+	basePath := t.TempDir()
+	toolDir := filepath.Join(basePath, "greeter")
+	files := map[string]string{
+		"go.mod": "module example.com/greeter\n\ngo 1.21\n\nrequire example.com/greet v0.0.0\n\nreplace example.com/greet => ./greet\n",
+		"main.go": `package main
+
+import (
+	"flag"
+	"fmt"
+
+	"example.com/greet"
+)
+
+func main() {
+	usage := flag.Bool("usage", false, "Print JSON schema")
+	health := flag.Bool("health", false, "Run health check")
+	flag.Parse()
+	if *usage {
+		fmt.Println(` + "`" + `{"version": "0.1.0", "schema": {"name": "greeter", "description": "Greets", "parameters": {"type": "object"}}}` + "`" + `)
+		return
+	}
+	if *health {
+		fmt.Println(` + "`" + `{"status": true, "details": "ok"}` + "`" + `)
+		return
+	}
+	fmt.Printf("%q", greet.Loud())
+}
+`,
+		"greet/go.mod":    "module example.com/greet\n\ngo 1.21\n",
+		"greet/greet.go":  "package greet\n\nfunc Hello() string { return \"hello\" }\n",
+		"greet/loud.go":   "//go:build loud\n\npackage greet\n\nfunc init() { suffix = \"!\" }\n",
+		"greet/suffix.go": "package greet\n\nvar suffix string\n\nfunc Loud() string { return Hello() + suffix }\n",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(toolDir, name)), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(toolDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	manager, err := NewManager(basePath)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer manager.Close()
+
+	tool, err := manager.LoadTool("greeter")
+	if err != nil {
+		t.Fatalf("LoadTool() error = %v", err)
+	}
+	if tool.Version != "0.1.0" {
+		t.Errorf("Expected version 0.1.0, got %q", tool.Version)
+	}
+	sb, err := sandbox.NewSandbox(basePath, &sandbox.DefaultLimits, &sandbox.NetworkPolicy{})
+	if err != nil {
+		t.Fatalf("Failed to create sandbox: %v", err)
+	}
+	output, err := tool.Execute([]byte("{}"), nil, sb)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if string(output) != `"hello"` {
+		t.Errorf("Expected \"hello\", got %s", output)
+	}
+
+	// Build flags and environment reach go build
+	manager.SetBuildOptions("greeter", BuildOptions{GoFlags: "-tags=loud", Env: map[string]string{"CGO_ENABLED": "0"}})
+	if err := manager.Compile("greeter"); err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	output, err = tool.Execute([]byte("{}"), nil, sb)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if string(output) != `"hello!"` {
+		t.Errorf("Expected \"hello!\", got %s", output)
+	}
+	manager.SetBuildOptions("greeter", BuildOptions{GoFlags: "-mod=nosuchmode"})
+	if err := manager.Compile("greeter"); err == nil || !strings.Contains(err.Error(), "nosuchmode") {
+		t.Errorf("Expected the invalid -mod flag to fail the build, got %v", err)
+	}
+}
+
+func TestToolErrors(t *testing.T) {
+	basePath := t.TempDir()
+	source := `package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	usage := flag.Bool("usage", false, "Print JSON schema")
+	health := flag.Bool("health", false, "Run health check")
+	flag.Parse()
+	if *usage {
+		fmt.Println(` + "`" + `{"schema": {"name": "flaky", "description": "Fails", "parameters": {"type": "object", "properties": {}}}}` + "`" + `)
+		return
+	}
+	if *health {
+		fmt.Println(` + "`" + `{"status": true, "details": "ok"}` + "`" + `)
+		return
+	}
+	var input struct{ Mode string }
+	json.NewDecoder(os.Stdin).Decode(&input)
+	switch input.Mode {
+	case "crash":
+		fmt.Fprintln(os.Stderr, "cannot reach the index")
+		os.Exit(2)
+	case "fail":
+		fmt.Println(` + "`" + `{"error": {"code": "not_found", "message": "no such page"}}` + "`" + `)
+		os.Exit(1)
+	}
+	fmt.Println(` + "`" + `{"ok": true}` + "`" + `)
+}
+`
+	if err := os.MkdirAll(filepath.Join(basePath, "flaky"), 0755); err != nil {
+		t.Fatalf("Failed to create tool directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(basePath, "flaky", "main.go"), []byte(source), 0644); err != nil {
+		t.Fatalf("Failed to write main.go: %v", err)
+	}
+	manager, err := NewManager(basePath)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer manager.Close()
+	tool, err := manager.LoadTool("flaky")
+	if err != nil {
+		t.Fatalf("LoadTool() error = %v", err)
+	}
+	sb, err := sandbox.NewSandbox(basePath, &sandbox.DefaultLimits, &sandbox.NetworkPolicy{})
+	if err != nil {
+		t.Fatalf("Failed to create sandbox: %v", err)
+	}
+
+	// A crash reports the tool's stderr
+	_, err = tool.Execute([]byte(`{"mode": "crash"}`), nil, sb)
+	if err == nil || skerrors.GetType(err) != skerrors.ToolError {
+		t.Fatalf("Expected a ToolError, got %v", err)
+	}
+	if stderr := skerrors.GetContext(err)["stderr"]; stderr != "cannot reach the index" {
+		t.Errorf("Expected stderr in the error context, got %q", stderr)
+	}
+	if !strings.Contains(err.Error(), "cannot reach the index") {
+		t.Errorf("Expected stderr in the error message, got %v", err)
+	}
+
+	// Structured error output is a Failure
+	_, err = tool.Execute([]byte(`{"mode": "fail"}`), nil, sb)
+	var failure *Failure
+	if !errors.As(err, &failure) {
+		t.Fatalf("Expected a Failure, got %v", err)
+	}
+	if failure.Code != "not_found" || failure.Message != "no such page" {
+		t.Errorf("Unexpected failure %+v", failure)
+	}
+	if want := `{"error":{"code":"not_found","message":"no such page"}}`; failure.Result() != want {
+		t.Errorf("Expected result %s, got %s", want, failure.Result())
+	}
+
+	if output, err := tool.Execute([]byte(`{}`), nil, sb); err != nil || strings.TrimSpace(string(output)) != `{"ok": true}` {
+		t.Errorf("Expected success, got %s, %v", output, err)
+	}
+
+	// Registered tools report failures the same way
+	err = manager.Register(Definition{Name: "missing", Func: func([]byte) ([]byte, error) {
+		return []byte(`{"error": {"message": "gone"}}`), nil
+	}})
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	registered, err := manager.LoadTool("missing")
+	if err != nil {
+		t.Fatalf("LoadTool() error = %v", err)
+	}
+	if _, err := registered.Execute([]byte(`{}`), nil, nil); !errors.As(err, &failure) || failure.Message != "gone" {
+		t.Errorf("Expected a Failure, got %v", err)
+	}
+}
+
+// fakeSecrets resolves secrets from a map
+type fakeSecrets map[string]string
+
+func (s fakeSecrets) Get(name string) (string, error) {
+	if value, ok := s[name]; ok {
+		return value, nil
+	}
+	return "", errors.New("key not found")
+}
+
+func TestToolEnvironment(t *testing.T) {
+	tool := &Tool{Name: "search"}
+	tool.Schema.Env = map[string]EnvVar{
+		"API_KEY":  {Type: "string", Required: true},
+		"ENDPOINT": {Type: "string", Default: "https://example.com"},
+		"TIMEOUT":  {Type: "integer", Default: 30},
+		"REGION":   {Type: "string"},
+	}
+
+	// Required variables without a value are listed
+	t.Setenv("API_KEY", "")
+	tool.Schema.Env["TOKEN"] = EnvVar{Type: "string", Required: true}
+	if _, err := tool.environment(nil); err == nil || !strings.Contains(err.Error(), "missing required environment variables: API_KEY, TOKEN") {
+		t.Errorf("Expected missing variables error, got %v", err)
+	}
+	delete(tool.Schema.Env, "TOKEN")
+
+	// Secret references need a secret store
+	env := map[string]string{"API_KEY": "secret://search_key", "TIMEOUT": "10"}
+	if _, err := tool.environment(env); err == nil || !strings.Contains(err.Error(), "no secret store is configured") {
+		t.Errorf("Expected secret store error, got %v", err)
+	}
+
+	tool.secrets = fakeSecrets{"search_key": "s3cret"}
+	got, err := tool.environment(env)
+	if err != nil {
+		t.Fatalf("environment() error = %v", err)
+	}
+	want := map[string]bool{"API_KEY=s3cret": true, "ENDPOINT=https://example.com": true, "TIMEOUT=10": true}
+	for _, kv := range got {
+		if strings.HasPrefix(kv, "PATH=") {
+			continue
+		}
+		if !want[kv] {
+			t.Errorf("Unexpected variable %s", kv)
+		}
+		delete(want, kv)
+	}
+	if len(want) > 0 {
+		t.Errorf("Expected variables %v in %v", want, got)
+	}
+
+	if _, err := tool.environment(map[string]string{"API_KEY": "secret://unknown"}); err == nil || !strings.Contains(err.Error(), "failed to resolve API_KEY: secret unknown: key not found") {
+		t.Errorf("Expected unknown secret error, got %v", err)
+	}
+}
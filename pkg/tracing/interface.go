@@ -0,0 +1,128 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"time"
+)
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+// String returns the hex encoding of the trace ID
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid reports whether the trace ID is non-zero
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+// String returns the hex encoding of the span ID
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid reports whether the span ID is non-zero
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// SpanContext identifies a span and carries its sampling decision
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid reports whether the span context identifies a span
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Kind describes the relationship of a span to its surroundings
+type Kind int
+
+const (
+	// KindInternal marks work inside Skylark
+	KindInternal Kind = iota + 1
+
+	// KindClient marks requests to remote services such as model providers
+	KindClient Kind = 3
+)
+
+// Attribute is a key/value pair attached to a span
+type Attribute struct {
+	Key   string
+	Value interface{} // string, bool, int, int64 or float64
+}
+
+// String creates a string attribute
+func String(key, value string) Attribute { return Attribute{Key: key, Value: value} }
+
+// Int creates an integer attribute
+func Int(key string, value int) Attribute { return Attribute{Key: key, Value: int64(value)} }
+
+// Bool creates a boolean attribute
+func Bool(key string, value bool) Attribute { return Attribute{Key: key, Value: value} }
+
+// Float creates a floating point attribute
+func Float(key string, value float64) Attribute { return Attribute{Key: key, Value: value} }
+
+// Span is a single timed operation within a trace
+type Span interface {
+	// SpanContext returns the identity of the span
+	SpanContext() SpanContext
+
+	// SetAttributes adds attributes to the span
+	SetAttributes(attrs ...Attribute)
+
+	// RecordError marks the span as failed with err. A nil err is ignored.
+	RecordError(err error)
+
+	// End completes the span. Further calls are ignored.
+	End()
+}
+
+// Tracer creates spans
+type Tracer interface {
+	// Start begins a span as a child of the span in ctx, if any, and
+	// returns a context carrying the new span
+	Start(ctx context.Context, name string, opts ...StartOption) (context.Context, Span)
+
+	// Shutdown flushes finished spans and stops the tracer
+	Shutdown(ctx context.Context) error
+}
+
+// StartConfig holds the options for starting a span
+type StartConfig struct {
+	Kind       Kind
+	Attributes []Attribute
+	Timestamp  time.Time
+}
+
+// StartOption configures a span at start
+type StartOption func(*StartConfig)
+
+// WithKind sets the span kind
+func WithKind(k Kind) StartOption {
+	return func(c *StartConfig) { c.Kind = k }
+}
+
+// WithAttributes sets initial span attributes
+func WithAttributes(attrs ...Attribute) StartOption {
+	return func(c *StartConfig) { c.Attributes = append(c.Attributes, attrs...) }
+}
+
+// NewStartConfig applies options over the defaults
+func NewStartConfig(opts ...StartOption) StartConfig {
+	c := StartConfig{Kind: KindInternal}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
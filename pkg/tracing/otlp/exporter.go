@@ -0,0 +1,295 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/tracing"
+)
+
+// maxQueuedSpans bounds memory when the collector is unreachable
+const maxQueuedSpans = 8192
+
+// exporter batches finished spans and posts them to an OTLP/HTTP endpoint
+type exporter struct {
+	url       string
+	headers   map[string]string
+	client    *http.Client
+	service   string
+	batchSize int
+
+	mu      sync.Mutex
+	queue   []*span
+	dropped uint64
+
+	flushC   chan struct{}
+	done     chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+// newExporter creates an exporter and starts its background loop
+func newExporter(cfg Config) *exporter {
+	e := &exporter{
+		url:       strings.TrimRight(cfg.Endpoint, "/") + "/v1/traces",
+		headers:   cfg.Headers,
+		client:    cfg.Client,
+		service:   cfg.ServiceName,
+		batchSize: cfg.BatchSize,
+		flushC:    make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	e.wg.Add(1)
+	go e.loop(cfg.Interval)
+	return e
+}
+
+// enqueue adds a finished span, dropping it if the queue is full
+func (e *exporter) enqueue(s *span) {
+	e.mu.Lock()
+	if len(e.queue) >= maxQueuedSpans {
+		e.dropped++
+		e.mu.Unlock()
+		return
+	}
+	e.queue = append(e.queue, s)
+	full := len(e.queue) >= e.batchSize
+	e.mu.Unlock()
+
+	if full {
+		select {
+		case e.flushC <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// loop exports batches on an interval or when a batch fills up
+func (e *exporter) loop(interval time.Duration) {
+	defer e.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.done:
+			return
+		case <-ticker.C:
+		case <-e.flushC:
+		}
+		if err := e.flush(context.Background()); err != nil {
+			slog.Warn("failed to export spans", "error", err)
+		}
+	}
+}
+
+// flush exports all queued spans
+func (e *exporter) flush(ctx context.Context) error {
+	e.mu.Lock()
+	batch := e.queue
+	e.queue = nil
+	dropped := e.dropped
+	e.dropped = 0
+	e.mu.Unlock()
+
+	if dropped > 0 {
+		slog.Warn("dropped spans while export queue was full", "dropped", dropped)
+	}
+	for len(batch) > 0 {
+		n := len(batch)
+		if n > e.batchSize {
+			n = e.batchSize
+		}
+		if err := e.export(ctx, batch[:n]); err != nil {
+			return err
+		}
+		batch = batch[n:]
+	}
+	return nil
+}
+
+// export posts a batch of spans
+func (e *exporter) export(ctx context.Context, spans []*span) error {
+	body, err := json.Marshal(e.encode(spans))
+	if err != nil {
+		return fmt.Errorf("failed to encode spans: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create export request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to export spans: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("collector rejected spans: %s", resp.Status)
+	}
+	return nil
+}
+
+// shutdown stops the background loop and exports remaining spans
+func (e *exporter) shutdown(ctx context.Context) error {
+	e.stopOnce.Do(func() { close(e.done) })
+	e.wg.Wait()
+	return e.flush(ctx)
+}
+
+// OTLP JSON encoding, see opentelemetry-proto's ExportTraceServiceRequest
+
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope      `json:"scope"`
+	Spans []spanJSON `json:"spans"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type spanJSON struct {
+	TraceID           string      `json:"traceId"`
+	SpanID            string      `json:"spanId"`
+	ParentSpanID      string      `json:"parentSpanId,omitempty"`
+	Name              string      `json:"name"`
+	Kind              int         `json:"kind"`
+	StartTimeUnixNano string      `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string      `json:"endTimeUnixNano"`
+	Attributes        []keyValue  `json:"attributes,omitempty"`
+	Events            []eventJSON `json:"events,omitempty"`
+	Status            status      `json:"status"`
+}
+
+type eventJSON struct {
+	TimeUnixNano string     `json:"timeUnixNano"`
+	Name         string     `json:"name"`
+	Attributes   []keyValue `json:"attributes,omitempty"`
+}
+
+type status struct {
+	Code    int    `json:"code,omitempty"` // 0 unset, 1 ok, 2 error
+	Message string `json:"message,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"` // int64 is encoded as a string
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// encode converts spans to an OTLP export request
+func (e *exporter) encode(spans []*span) exportRequest {
+	out := make([]spanJSON, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		j := spanJSON{
+			TraceID:           s.sc.TraceID.String(),
+			SpanID:            s.sc.SpanID.String(),
+			Name:              s.name,
+			Kind:              int(s.kind),
+			StartTimeUnixNano: unixNano(s.start),
+			EndTimeUnixNano:   unixNano(s.end),
+			Attributes:        encodeAttributes(s.attrs),
+		}
+		if s.parent.IsValid() {
+			j.ParentSpanID = s.parent.String()
+		}
+		for _, ev := range s.events {
+			j.Events = append(j.Events, eventJSON{
+				TimeUnixNano: unixNano(ev.time),
+				Name:         ev.name,
+				Attributes:   encodeAttributes(ev.attrs),
+			})
+		}
+		if s.failed {
+			j.Status = status{Code: 2, Message: s.message}
+		}
+		s.mu.Unlock()
+		out = append(out, j)
+	}
+
+	return exportRequest{
+		ResourceSpans: []resourceSpans{{
+			Resource: resource{
+				Attributes: encodeAttributes([]tracing.Attribute{
+					tracing.String("service.name", e.service),
+				}),
+			},
+			ScopeSpans: []scopeSpans{{
+				Scope: scope{Name: "github.com/butter-bot-machines/skylark"},
+				Spans: out,
+			}},
+		}},
+	}
+}
+
+// encodeAttributes converts attributes to OTLP key/values
+func encodeAttributes(attrs []tracing.Attribute) []keyValue {
+	if len(attrs) == 0 {
+		return nil
+	}
+	kvs := make([]keyValue, 0, len(attrs))
+	for _, a := range attrs {
+		var v anyValue
+		switch val := a.Value.(type) {
+		case string:
+			v.StringValue = &val
+		case bool:
+			v.BoolValue = &val
+		case int:
+			s := strconv.Itoa(val)
+			v.IntValue = &s
+		case int64:
+			s := strconv.FormatInt(val, 10)
+			v.IntValue = &s
+		case float64:
+			v.DoubleValue = &val
+		default:
+			s := fmt.Sprint(val)
+			v.StringValue = &s
+		}
+		kvs = append(kvs, keyValue{Key: a.Key, Value: v})
+	}
+	return kvs
+}
+
+// unixNano formats a time as OTLP expects
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
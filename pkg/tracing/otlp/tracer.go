@@ -0,0 +1,223 @@
+package otlp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/tracing"
+)
+
+const (
+	// defaultBatchSize is how many finished spans trigger an export
+	defaultBatchSize = 512
+
+	// defaultInterval is the longest finished spans wait before export
+	defaultInterval = 5 * time.Second
+
+	// defaultTimeout bounds each export request
+	defaultTimeout = 10 * time.Second
+)
+
+// Config configures an OTLP tracer
+type Config struct {
+	Endpoint    string            // Collector base URL, e.g. http://localhost:4318
+	ServiceName string            // Reported as the service.name resource attribute
+	Headers     map[string]string // Extra request headers, e.g. for authentication
+	SampleRatio float64           // Fraction of traces recorded; 0 records all
+	BatchSize   int               // Finished spans per export; 0 uses the default
+	Interval    time.Duration     // Maximum delay before export; 0 uses the default
+	Client      *http.Client      // HTTP client; nil uses one with a timeout
+}
+
+// tracer implements tracing.Tracer, exporting sampled spans over OTLP/HTTP
+type tracer struct {
+	ratio    float64
+	exporter *exporter
+}
+
+// NewTracer creates a tracer that exports to an OTLP/HTTP collector using
+// the JSON encoding
+func NewTracer(cfg Config) (tracing.Tracer, error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("otlp endpoint required")
+	}
+	if cfg.SampleRatio < 0 || cfg.SampleRatio > 1 {
+		return nil, fmt.Errorf("sample ratio must be between 0 and 1, got %v", cfg.SampleRatio)
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = "skylark"
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultInterval
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: defaultTimeout}
+	}
+	ratio := cfg.SampleRatio
+	if ratio == 0 {
+		ratio = 1
+	}
+
+	return &tracer{
+		ratio:    ratio,
+		exporter: newExporter(cfg),
+	}, nil
+}
+
+// Start implements tracing.Tracer
+func (t *tracer) Start(ctx context.Context, name string, opts ...tracing.StartOption) (context.Context, tracing.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	cfg := tracing.NewStartConfig(opts...)
+
+	parent := tracing.SpanFromContext(ctx).SpanContext()
+	sc := tracing.SpanContext{SpanID: newSpanID()}
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Sampled = parent.Sampled
+	} else {
+		sc.TraceID = newTraceID()
+		sc.Sampled = t.sample(sc.TraceID)
+	}
+
+	if !sc.Sampled {
+		s := nonRecordingSpan{sc: sc}
+		return tracing.ContextWithSpan(ctx, s), s
+	}
+
+	start := cfg.Timestamp
+	if start.IsZero() {
+		start = time.Now()
+	}
+	s := &span{
+		tracer: t,
+		name:   name,
+		kind:   cfg.Kind,
+		sc:     sc,
+		start:  start,
+		attrs:  cfg.Attributes,
+	}
+	if parent.IsValid() {
+		s.parent = parent.SpanID
+	}
+	return tracing.ContextWithSpan(ctx, s), s
+}
+
+// Shutdown implements tracing.Tracer
+func (t *tracer) Shutdown(ctx context.Context) error {
+	return t.exporter.shutdown(ctx)
+}
+
+// sample decides whether a new trace is recorded, consistently for a trace ID
+func (t *tracer) sample(id tracing.TraceID) bool {
+	if t.ratio >= 1 {
+		return true
+	}
+	bound := uint64(t.ratio * (1 << 63))
+	return binary.BigEndian.Uint64(id[8:])>>1 < bound
+}
+
+// event is a timestamped annotation on a span
+type event struct {
+	name  string
+	time  time.Time
+	attrs []tracing.Attribute
+}
+
+// span implements tracing.Span for sampled spans
+type span struct {
+	tracer *tracer
+	name   string
+	kind   tracing.Kind
+	sc     tracing.SpanContext
+	parent tracing.SpanID
+	start  time.Time
+
+	mu      sync.Mutex
+	attrs   []tracing.Attribute
+	events  []event
+	failed  bool
+	message string
+	end     time.Time
+	ended   bool
+}
+
+func (s *span) SpanContext() tracing.SpanContext {
+	return s.sc
+}
+
+func (s *span) SetAttributes(attrs ...tracing.Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.attrs = append(s.attrs, attrs...)
+	}
+}
+
+func (s *span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	s.failed = true
+	s.message = err.Error()
+	s.events = append(s.events, event{
+		name: "exception",
+		time: time.Now(),
+		attrs: []tracing.Attribute{
+			tracing.String("exception.type", fmt.Sprintf("%T", err)),
+			tracing.String("exception.message", err.Error()),
+		},
+	})
+}
+
+func (s *span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	s.tracer.exporter.enqueue(s)
+}
+
+// nonRecordingSpan carries the identity of an unsampled span so that its
+// children make the same sampling decision
+type nonRecordingSpan struct {
+	sc tracing.SpanContext
+}
+
+func (s nonRecordingSpan) SpanContext() tracing.SpanContext         { return s.sc }
+func (s nonRecordingSpan) SetAttributes(attrs ...tracing.Attribute) {}
+func (s nonRecordingSpan) RecordError(err error)                    {}
+func (s nonRecordingSpan) End()                                     {}
+
+// newTraceID returns a random trace ID
+func newTraceID() tracing.TraceID {
+	var id tracing.TraceID
+	rand.Read(id[:])
+	return id
+}
+
+// newSpanID returns a random span ID
+func newSpanID() tracing.SpanID {
+	var id tracing.SpanID
+	rand.Read(id[:])
+	return id
+}
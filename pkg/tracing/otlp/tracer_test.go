@@ -0,0 +1,179 @@
+package otlp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/tracing"
+)
+
+// collector records OTLP export requests
+type collector struct {
+	mu       sync.Mutex
+	requests []exportRequest
+	headers  []http.Header
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/traces" {
+		http.NotFound(w, r)
+		return
+	}
+	var req exportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	c.requests = append(c.requests, req)
+	c.headers = append(c.headers, r.Header.Clone())
+	c.mu.Unlock()
+}
+
+// spans returns all exported spans by name
+func (c *collector) spans() map[string]spanJSON {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	spans := make(map[string]spanJSON)
+	for _, req := range c.requests {
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, s := range ss.Spans {
+					spans[s.Name] = s
+				}
+			}
+		}
+	}
+	return spans
+}
+
+func TestTracerExport(t *testing.T) {
+	c := &collector{}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	tracer, err := NewTracer(Config{
+		Endpoint:    srv.URL,
+		ServiceName: "skylark-test",
+		Headers:     map[string]string{"Authorization": "Bearer token"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create tracer: %v", err)
+	}
+
+	ctx, root := tracer.Start(context.Background(), "file.event",
+		tracing.WithAttributes(tracing.String("file.path", "notes.md")))
+	_, child := tracer.Start(ctx, "provider.send", tracing.WithKind(tracing.KindClient))
+	child.SetAttributes(tracing.Int("usage.prompt_tokens", 42))
+	child.RecordError(errors.New("rate limited"))
+	child.End()
+	root.End()
+
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	c.mu.Lock()
+	if len(c.requests) == 0 {
+		c.mu.Unlock()
+		t.Fatal("Expected spans to be exported")
+	}
+	if got := c.headers[0].Get("Authorization"); got != "Bearer token" {
+		t.Errorf("Expected Authorization header, got %q", got)
+	}
+	res := c.requests[0].ResourceSpans[0].Resource.Attributes
+	c.mu.Unlock()
+	if len(res) == 0 || res[0].Key != "service.name" || *res[0].Value.StringValue != "skylark-test" {
+		t.Errorf("Expected service.name resource attribute, got %+v", res)
+	}
+
+	spans := c.spans()
+	parent, ok := spans["file.event"]
+	if !ok {
+		t.Fatal("Expected file.event span")
+	}
+	send, ok := spans["provider.send"]
+	if !ok {
+		t.Fatal("Expected provider.send span")
+	}
+
+	if parent.ParentSpanID != "" {
+		t.Errorf("Expected root span without parent, got %s", parent.ParentSpanID)
+	}
+	if send.TraceID != parent.TraceID {
+		t.Errorf("Expected child in trace %s, got %s", parent.TraceID, send.TraceID)
+	}
+	if send.ParentSpanID != parent.SpanID {
+		t.Errorf("Expected child parent %s, got %s", parent.SpanID, send.ParentSpanID)
+	}
+	if send.Kind != int(tracing.KindClient) {
+		t.Errorf("Expected client kind, got %d", send.Kind)
+	}
+	if send.Status.Code != 2 || send.Status.Message != "rate limited" {
+		t.Errorf("Expected error status, got %+v", send.Status)
+	}
+	if len(send.Events) != 1 || send.Events[0].Name != "exception" {
+		t.Errorf("Expected exception event, got %+v", send.Events)
+	}
+	if len(send.Attributes) != 1 || send.Attributes[0].Key != "usage.prompt_tokens" ||
+		send.Attributes[0].Value.IntValue == nil || *send.Attributes[0].Value.IntValue != "42" {
+		t.Errorf("Expected token usage attribute, got %+v", send.Attributes)
+	}
+	if parent.Status.Code != 0 {
+		t.Errorf("Expected unset status on root span, got %+v", parent.Status)
+	}
+}
+
+func TestTracerSampling(t *testing.T) {
+	c := &collector{}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		ratio   float64
+		wantErr bool
+	}{
+		{name: "negative ratio", ratio: -0.1, wantErr: true},
+		{name: "ratio above one", ratio: 1.1, wantErr: true},
+		{name: "partial ratio", ratio: 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewTracer(Config{Endpoint: srv.URL, SampleRatio: tt.ratio})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewTracer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	tr, err := NewTracer(Config{Endpoint: srv.URL, SampleRatio: 0.5})
+	if err != nil {
+		t.Fatalf("Failed to create tracer: %v", err)
+	}
+	defer tr.Shutdown(context.Background())
+
+	sampled := 0
+	for i := 0; i < 1000; i++ {
+		ctx, root := tr.Start(context.Background(), "root")
+		_, child := tr.Start(ctx, "child")
+		if child.SpanContext().Sampled != root.SpanContext().Sampled {
+			t.Fatal("Expected children to follow the root sampling decision")
+		}
+		if root.SpanContext().Sampled {
+			sampled++
+		}
+	}
+	if sampled < 350 || sampled > 650 {
+		t.Errorf("Expected about half of traces sampled, got %d/1000", sampled)
+	}
+
+	if _, err := NewTracer(Config{}); err == nil {
+		t.Error("Expected error without endpoint")
+	}
+}
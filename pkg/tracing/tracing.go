@@ -0,0 +1,70 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+)
+
+var (
+	mu     sync.RWMutex
+	global Tracer = noopTracer{}
+)
+
+// SetTracer installs the tracer used by Start. A nil tracer disables tracing.
+func SetTracer(t Tracer) {
+	mu.Lock()
+	defer mu.Unlock()
+	if t == nil {
+		t = noopTracer{}
+	}
+	global = t
+}
+
+// GetTracer returns the installed tracer
+func GetTracer() Tracer {
+	mu.RLock()
+	defer mu.RUnlock()
+	return global
+}
+
+// Start begins a span using the installed tracer
+func Start(ctx context.Context, name string, opts ...StartOption) (context.Context, Span) {
+	return GetTracer().Start(ctx, name, opts...)
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying span
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the span in ctx, or a no-op span
+func SpanFromContext(ctx context.Context) Span {
+	if ctx != nil {
+		if span, ok := ctx.Value(spanKey{}).(Span); ok {
+			return span
+		}
+	}
+	return noopSpan{}
+}
+
+// noopTracer creates spans that record nothing
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, name string, opts ...StartOption) (context.Context, Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return ctx, noopSpan{}
+}
+
+func (noopTracer) Shutdown(ctx context.Context) error { return nil }
+
+// noopSpan implements Span without recording anything
+type noopSpan struct{}
+
+func (noopSpan) SpanContext() SpanContext         { return SpanContext{} }
+func (noopSpan) SetAttributes(attrs ...Attribute) {}
+func (noopSpan) RecordError(err error)            {}
+func (noopSpan) End()                             {}
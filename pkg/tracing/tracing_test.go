@@ -0,0 +1,58 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+)
+
+// recordingTracer records started span names
+type recordingTracer struct {
+	names []string
+}
+
+func (r *recordingTracer) Start(ctx context.Context, name string, opts ...StartOption) (context.Context, Span) {
+	r.names = append(r.names, name)
+	return ctx, noopSpan{}
+}
+
+func (r *recordingTracer) Shutdown(ctx context.Context) error { return nil }
+
+func TestGlobalTracer(t *testing.T) {
+	defer SetTracer(nil)
+
+	// Default tracer is a no-op
+	ctx, span := Start(context.Background(), "noop")
+	if span.SpanContext().IsValid() {
+		t.Error("Expected invalid span context from no-op tracer")
+	}
+	span.RecordError(nil)
+	span.End()
+	if SpanFromContext(ctx).SpanContext().IsValid() {
+		t.Error("Expected no-op span in context")
+	}
+
+	rec := &recordingTracer{}
+	SetTracer(rec)
+	Start(context.Background(), "file.event")
+	if len(rec.names) != 1 || rec.names[0] != "file.event" {
+		t.Errorf("Expected installed tracer to start span, got %v", rec.names)
+	}
+
+	SetTracer(nil)
+	if _, ok := GetTracer().(noopTracer); !ok {
+		t.Errorf("Expected nil to restore no-op tracer, got %T", GetTracer())
+	}
+}
+
+func TestStartConfig(t *testing.T) {
+	cfg := NewStartConfig(WithKind(KindClient), WithAttributes(String("a", "b"), Int("n", 3)))
+	if cfg.Kind != KindClient {
+		t.Errorf("Expected client kind, got %v", cfg.Kind)
+	}
+	if len(cfg.Attributes) != 2 || cfg.Attributes[1].Value != int64(3) {
+		t.Errorf("Expected two attributes with int64 value, got %+v", cfg.Attributes)
+	}
+	if NewStartConfig().Kind != KindInternal {
+		t.Error("Expected internal kind by default")
+	}
+}
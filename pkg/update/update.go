@@ -0,0 +1,321 @@
+// Package update installs new releases of skai in place. A release
+// endpoint serves, for each channel, a manifest <channel>.json listing the
+// binary of every platform with its SHA-256 checksum, and <channel>.json.sig
+// holding the base64 Ed25519 signature of the manifest. A release is only
+// installed when the signature verifies against the release key and the
+// downloaded binary matches its checksum; it then replaces the running
+// binary with a rename, so an interrupted update leaves the old one intact.
+package update
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+)
+
+// DefaultURL and DefaultPublicKey are the release endpoint and the base64
+// Ed25519 key releases are signed with, set when building release binaries:
+//
+//	go build -ldflags "-X github.com/butter-bot-machines/skylark/pkg/update.DefaultURL=... \
+//	  -X github.com/butter-bot-machines/skylark/pkg/update.DefaultPublicKey=..."
+//
+// update.url and update.public_key in config.yaml override them.
+var (
+	DefaultURL       string
+	DefaultPublicKey string
+)
+
+const (
+	requestTimeout = 5 * time.Minute
+	maxManifest    = 1 << 20 // Bytes read of a manifest or signature
+)
+
+var (
+	// ErrNotConfigured is returned when no release endpoint or key is known
+	ErrNotConfigured = errors.New("self-update not configured")
+	// ErrSignature is returned for manifests that do not verify
+	ErrSignature = errors.New("release signature does not verify")
+	// ErrChecksum is returned for downloads that do not match the manifest
+	ErrChecksum = errors.New("release checksum mismatch")
+	// ErrNoAsset is returned when a release has no binary for this platform
+	ErrNoAsset = errors.New("no release for this platform")
+)
+
+// Asset is the binary of one platform
+type Asset struct {
+	URL    string `json:"url"`    // Absolute, or relative to the manifest
+	SHA256 string `json:"sha256"` // Hex checksum of the binary
+}
+
+// Release is a channel's manifest
+type Release struct {
+	Version string           `json:"version"`
+	Channel string           `json:"channel"`
+	Notes   string           `json:"notes,omitempty"`
+	Assets  map[string]Asset `json:"assets"` // By GOOS-GOARCH, e.g. linux-amd64
+}
+
+// Updater checks a release endpoint and installs its releases
+type Updater struct {
+	base     *url.URL
+	channel  config.UpdateChannel
+	key      ed25519.PublicKey
+	client   *http.Client
+	platform string
+}
+
+// New creates an updater for the channel, endpoint and key of cfg, falling
+// back to the built-in endpoint and key. client may be nil.
+func New(cfg config.UpdateConfig, client *http.Client) (*Updater, error) {
+	endpoint := cfg.URL
+	if endpoint == "" {
+		endpoint = DefaultURL
+	}
+	if endpoint == "" {
+		return nil, fmt.Errorf("%w: set update.url to the release endpoint", ErrNotConfigured)
+	}
+	base, err := url.Parse(strings.TrimSuffix(endpoint, "/") + "/")
+	if err != nil || base.Host == "" {
+		return nil, fmt.Errorf("invalid update url %q", endpoint)
+	}
+
+	encoded := cfg.PublicKey
+	if encoded == "" {
+		encoded = DefaultPublicKey
+	}
+	if encoded == "" {
+		return nil, fmt.Errorf("%w: set update.public_key to the release signing key", ErrNotConfigured)
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid update public_key: expected a base64 Ed25519 public key")
+	}
+
+	channel := cfg.Channel
+	if channel == "" {
+		channel = config.UpdateStable
+	}
+	if client == nil {
+		client = &http.Client{Timeout: requestTimeout}
+	}
+	return &Updater{
+		base:     base,
+		channel:  channel,
+		key:      key,
+		client:   client,
+		platform: runtime.GOOS + "-" + runtime.GOARCH,
+	}, nil
+}
+
+// Channel returns the channel the updater follows
+func (u *Updater) Channel() config.UpdateChannel {
+	return u.channel
+}
+
+// Latest fetches and verifies the manifest of the channel
+func (u *Updater) Latest(ctx context.Context) (*Release, error) {
+	name := string(u.channel) + ".json"
+	manifest, err := u.fetch(ctx, u.base.ResolveReference(&url.URL{Path: name}), maxManifest)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := u.fetch(ctx, u.base.ResolveReference(&url.URL{Path: name + ".sig"}), maxManifest)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(encoded)))
+	if err != nil || !ed25519.Verify(u.key, manifest, sig) {
+		return nil, fmt.Errorf("%w: %s", ErrSignature, name)
+	}
+
+	var r Release
+	if err := json.Unmarshal(manifest, &r); err != nil {
+		return nil, fmt.Errorf("invalid release manifest: %w", err)
+	}
+	// A signed manifest of another channel must not be served in its place
+	if r.Channel != string(u.channel) {
+		return nil, fmt.Errorf("%w: %s is for channel %q", ErrSignature, name, r.Channel)
+	}
+	if r.Version == "" {
+		return nil, fmt.Errorf("invalid release manifest: version required")
+	}
+	return &r, nil
+}
+
+// Install downloads the binary of r for this platform, checks it against
+// the manifest and atomically replaces the file at executable with it
+func (u *Updater) Install(ctx context.Context, r *Release, executable string) error {
+	asset, ok := r.Assets[u.platform]
+	if !ok {
+		return fmt.Errorf("%w: %s %s has no %s binary", ErrNoAsset, r.Channel, r.Version, u.platform)
+	}
+	want, err := hex.DecodeString(asset.SHA256)
+	if err != nil || len(want) != sha256.Size {
+		return fmt.Errorf("invalid release manifest: bad sha256 for %s", u.platform)
+	}
+	ref, err := url.Parse(asset.URL)
+	if err != nil {
+		return fmt.Errorf("invalid release manifest: bad url for %s: %w", u.platform, err)
+	}
+
+	info, err := os.Stat(executable)
+	if err != nil {
+		return err
+	}
+	// The new binary is written beside the old one so the rename is atomic
+	tmp, err := os.CreateTemp(filepath.Dir(executable), "."+filepath.Base(executable)+".update-*")
+	if err != nil {
+		return fmt.Errorf("cannot write beside %s: %w", executable, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	err = u.download(ctx, u.base.ResolveReference(ref), tmp, want)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()|0111); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), executable); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", executable, err)
+	}
+	return nil
+}
+
+// download writes the body at target to w, failing unless its SHA-256 is want
+func (u *Updater) download(ctx context.Context, target *url.URL, w io.Writer, want []byte) error {
+	resp, err := u.get(ctx, target)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w, hash), resp.Body); err != nil {
+		return fmt.Errorf("failed to download %s: %w", target, err)
+	}
+	if !bytes.Equal(hash.Sum(nil), want) {
+		return fmt.Errorf("%w: %s", ErrChecksum, target)
+	}
+	return nil
+}
+
+// fetch returns the body at target, at most limit bytes of it
+func (u *Updater) fetch(ctx context.Context, target *url.URL, limit int64) ([]byte, error) {
+	resp, err := u.get(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", target, err)
+	}
+	return data, nil
+}
+
+// get requests target, failing on statuses other than 200
+func (u *Updater) get(ctx context.Context, target *url.URL) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", target, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to fetch %s: %s", target, resp.Status)
+	}
+	return resp, nil
+}
+
+// Newer reports whether version a is newer than b. Versions are compared
+// as semantic versions, with or without a leading v; a pre-release such as
+// 1.2.0-beta.1 comes before 1.2.0.
+func Newer(a, b string) bool {
+	return compareVersions(a, b) > 0
+}
+
+// compareVersions returns -1, 0 or 1 as a is older than, the same as or
+// newer than b
+func compareVersions(a, b string) int {
+	aCore, aPre := splitVersion(a)
+	bCore, bPre := splitVersion(b)
+	for i := range aCore {
+		if aCore[i] != bCore[i] {
+			return sign(aCore[i] - bCore[i])
+		}
+	}
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	}
+
+	aIDs, bIDs := strings.Split(aPre, "."), strings.Split(bPre, ".")
+	for i := 0; i < len(aIDs) && i < len(bIDs); i++ {
+		if aIDs[i] == bIDs[i] {
+			continue
+		}
+		an, aErr := strconv.Atoi(aIDs[i])
+		bn, bErr := strconv.Atoi(bIDs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			return sign(an - bn)
+		case aErr == nil:
+			return -1 // Numeric identifiers sort before alphanumeric ones
+		case bErr == nil:
+			return 1
+		}
+		return strings.Compare(aIDs[i], bIDs[i])
+	}
+	return sign(len(aIDs) - len(bIDs))
+}
+
+// splitVersion returns the major, minor and patch numbers of v and its
+// pre-release, dropping a leading v and any build metadata
+func splitVersion(v string) ([3]int, string) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	v, _, _ = strings.Cut(v, "+")
+	core, pre, _ := strings.Cut(v, "-")
+	var nums [3]int
+	for i, part := range strings.SplitN(core, ".", 3) {
+		nums[i], _ = strconv.Atoi(part)
+	}
+	return nums, pre
+}
+
+func sign(n int) int {
+	switch {
+	case n > 0:
+		return 1
+	case n < 0:
+		return -1
+	}
+	return 0
+}
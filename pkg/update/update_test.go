@@ -0,0 +1,226 @@
+package update
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/butter-bot-machines/skylark/pkg/config"
+)
+
+// releaseServer serves a signed manifest of r for its channel, with the
+// binary of linux-amd64 at /bin
+type releaseServer struct {
+	*httptest.Server
+	files map[string][]byte
+}
+
+func newReleaseServer(t *testing.T, key ed25519.PrivateKey, r Release, binary []byte) *releaseServer {
+	t.Helper()
+	manifest, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &releaseServer{files: map[string][]byte{
+		"/" + r.Channel + ".json":     manifest,
+		"/" + r.Channel + ".json.sig": []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(key, manifest)) + "\n"),
+		"/bin":                        binary,
+	}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, ok := s.files[req.URL.Path]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newKey(t *testing.T) (ed25519.PrivateKey, string) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv, base64.StdEncoding.EncodeToString(pub)
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestUpdate(t *testing.T) {
+	priv, pub := newKey(t)
+	binary := []byte("#!/bin/sh\necho new\n")
+	srv := newReleaseServer(t, priv, Release{
+		Version: "0.2.0-beta.1",
+		Channel: "beta",
+		Assets:  map[string]Asset{"linux-amd64": {URL: "bin", SHA256: checksum(binary)}},
+	}, binary)
+
+	u, err := New(config.UpdateConfig{Channel: config.UpdateBeta, URL: srv.URL, PublicKey: pub}, srv.Client())
+	if err != nil {
+		t.Fatalf("Failed to create updater: %v", err)
+	}
+	u.platform = "linux-amd64"
+
+	r, err := u.Latest(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to fetch release: %v", err)
+	}
+	if r.Version != "0.2.0-beta.1" {
+		t.Errorf("Expected version 0.2.0-beta.1, got %s", r.Version)
+	}
+
+	executable := filepath.Join(t.TempDir(), "skai")
+	if err := os.WriteFile(executable, []byte("old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Install(context.Background(), r, executable); err != nil {
+		t.Fatalf("Failed to install release: %v", err)
+	}
+	got, err := os.ReadFile(executable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(binary) {
+		t.Errorf("Expected the new binary to be installed, got %q", got)
+	}
+	if info, _ := os.Stat(executable); info.Mode().Perm() != 0755 {
+		t.Errorf("Expected mode 0755, got %v", info.Mode().Perm())
+	}
+	entries, _ := os.ReadDir(filepath.Dir(executable))
+	if len(entries) != 1 {
+		t.Errorf("Expected no temporary files to remain, got %d entries", len(entries))
+	}
+}
+
+func TestUpdateRejected(t *testing.T) {
+	priv, pub := newKey(t)
+	_, otherPub := newKey(t)
+	binary := []byte("new")
+	release := Release{
+		Version: "0.2.0",
+		Channel: "stable",
+		Assets:  map[string]Asset{"linux-amd64": {URL: "bin", SHA256: checksum([]byte("other"))}},
+	}
+
+	t.Run("signature", func(t *testing.T) {
+		srv := newReleaseServer(t, priv, release, binary)
+		u, err := New(config.UpdateConfig{URL: srv.URL, PublicKey: otherPub}, srv.Client())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := u.Latest(context.Background()); !errors.Is(err, ErrSignature) {
+			t.Errorf("Expected ErrSignature for a manifest signed by another key, got %v", err)
+		}
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		srv := newReleaseServer(t, priv, release, binary)
+		srv.files["/stable.json"] = []byte(`{"version":"9.9.9","channel":"stable"}`)
+		u, err := New(config.UpdateConfig{URL: srv.URL, PublicKey: pub}, srv.Client())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := u.Latest(context.Background()); !errors.Is(err, ErrSignature) {
+			t.Errorf("Expected ErrSignature for a modified manifest, got %v", err)
+		}
+	})
+
+	t.Run("channel", func(t *testing.T) {
+		srv := newReleaseServer(t, priv, release, binary)
+		srv.files["/beta.json"] = srv.files["/stable.json"]
+		srv.files["/beta.json.sig"] = srv.files["/stable.json.sig"]
+		u, err := New(config.UpdateConfig{Channel: config.UpdateBeta, URL: srv.URL, PublicKey: pub}, srv.Client())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := u.Latest(context.Background()); !errors.Is(err, ErrSignature) {
+			t.Errorf("Expected the stable manifest to be rejected on the beta channel, got %v", err)
+		}
+	})
+
+	t.Run("checksum", func(t *testing.T) {
+		srv := newReleaseServer(t, priv, release, binary)
+		u, err := New(config.UpdateConfig{URL: srv.URL, PublicKey: pub}, srv.Client())
+		if err != nil {
+			t.Fatal(err)
+		}
+		u.platform = "linux-amd64"
+		r, err := u.Latest(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		executable := filepath.Join(t.TempDir(), "skai")
+		if err := os.WriteFile(executable, []byte("old"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := u.Install(context.Background(), r, executable); !errors.Is(err, ErrChecksum) {
+			t.Errorf("Expected ErrChecksum, got %v", err)
+		}
+		if got, _ := os.ReadFile(executable); string(got) != "old" {
+			t.Errorf("Expected the old binary to remain, got %q", got)
+		}
+
+		u.platform = "plan9-386"
+		if err := u.Install(context.Background(), r, executable); !errors.Is(err, ErrNoAsset) {
+			t.Errorf("Expected ErrNoAsset, got %v", err)
+		}
+	})
+}
+
+func TestNewNotConfigured(t *testing.T) {
+	_, pub := newKey(t)
+	tests := []struct {
+		name string
+		cfg  config.UpdateConfig
+	}{
+		{"no url", config.UpdateConfig{PublicKey: pub}},
+		{"no key", config.UpdateConfig{URL: "https://example.com/releases"}},
+	}
+	for _, tt := range tests {
+		if _, err := New(tt.cfg, nil); !errors.Is(err, ErrNotConfigured) {
+			t.Errorf("%s: expected ErrNotConfigured, got %v", tt.name, err)
+		}
+	}
+	if _, err := New(config.UpdateConfig{URL: "https://example.com", PublicKey: "c2hvcnQ="}, nil); err == nil {
+		t.Error("Expected a short key to be rejected")
+	}
+}
+
+func TestNewer(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"0.2.0", "0.1.0", true},
+		{"v0.10.0", "0.9.1", true},
+		{"0.1.0", "0.1.0", false},
+		{"0.1.0", "0.2.0", false},
+		{"0.2.0", "0.2.0-beta.2", true},
+		{"0.2.0-beta.2", "0.2.0", false},
+		{"0.2.0-beta.10", "0.2.0-beta.2", true},
+		{"0.2.0-rc.1", "0.2.0-beta.3", true},
+		{"0.2.0-beta.1", "0.1.0", true},
+		{"0.2.0+build.5", "0.2.0", false},
+	}
+	for _, tt := range tests {
+		if got := Newer(tt.a, tt.b); got != tt.want {
+			t.Errorf("Expected Newer(%q, %q) = %v, got %v", tt.a, tt.b, tt.want, got)
+		}
+	}
+}
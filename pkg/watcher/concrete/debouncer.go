@@ -19,8 +19,10 @@ type debouncerImpl struct {
 }
 
 type timerCtx struct {
-	timer     timing.Timer
-	lastEvent time.Time
+	timer      timing.Timer
+	firstEvent time.Time // Start of the current burst
+	fn         func()    // Run for the last event of the burst
+	events     int       // Events in the burst, to detect stale timers
 }
 
 // newDebouncer creates a new debouncer
@@ -37,7 +39,10 @@ func newDebouncer(delay, maxDelay time.Duration, clock timing.Clock) watcher.Deb
 	}
 }
 
-// Debounce delays execution of fn until events settle
+// Debounce delays execution of fn until events for key settle. Events in
+// a burst are coalesced and only the fn of the last one runs, once no
+// event followed for the delay or, during a longer burst, once the burst
+// has lasted maxDelay.
 func (d *debouncerImpl) Debounce(key string, fn func()) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
@@ -49,48 +54,64 @@ func (d *debouncerImpl) Debounce(key string, fn func()) {
 	default:
 	}
 
+	now := d.clock.Now()
+
 	// Get or create timer context
 	ctx, ok := d.timers[key]
 	if !ok {
-		ctx = &timerCtx{}
+		ctx = &timerCtx{firstEvent: now}
 		d.timers[key] = ctx
 	}
+	ctx.fn = fn
+	ctx.events++
+	events := ctx.events
 
 	// Stop existing timer
 	if ctx.timer != nil {
 		ctx.timer.Stop()
 	}
 
-	now := d.clock.Now()
-	ctx.lastEvent = now
+	// Wait for the delay, but not past the end of the burst's max delay
+	wait := d.delay
+	if d.maxDelay > 0 {
+		if remaining := d.maxDelay - now.Sub(ctx.firstEvent); remaining < wait {
+			wait = remaining
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
 
-	// Create new timer
-	ctx.timer = d.clock.AfterFunc(d.delay, func() {
+	ctx.timer = d.clock.AfterFunc(wait, func() {
 		d.mu.Lock()
 		defer d.mu.Unlock()
 
-		// Check if already stopped
+		// Check if already stopped, or replaced by a later event
 		select {
 		case <-d.done:
 			return
 		default:
 		}
-
-		// Check if max delay exceeded
-		if d.clock.Now().Sub(ctx.lastEvent) >= d.maxDelay {
-			delete(d.timers, key)
-			go fn()
+		if d.timers[key] != ctx || ctx.events != events {
 			return
 		}
 
-		// If not exceeded, check if events have settled
-		if d.clock.Now().Sub(ctx.lastEvent) >= d.delay {
-			delete(d.timers, key)
-			go fn()
-		}
+		delete(d.timers, key)
+		go ctx.fn()
 	})
 }
 
+// Cancel forgets a pending call for key
+func (d *debouncerImpl) Cancel(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if ctx, ok := d.timers[key]; ok {
+		ctx.timer.Stop()
+		delete(d.timers, key)
+	}
+}
+
 // Stop stops the debouncer
 func (d *debouncerImpl) Stop() {
 	d.mu.Lock()
@@ -0,0 +1,108 @@
+package concrete
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/timing"
+)
+
+// callRecorder records the values debounced calls ran with
+type callRecorder struct {
+	mu    sync.Mutex
+	calls []string
+	ran   chan struct{}
+}
+
+func newCallRecorder() *callRecorder {
+	return &callRecorder{ran: make(chan struct{}, 10)}
+}
+
+func (r *callRecorder) fn(value string) func() {
+	return func() {
+		r.mu.Lock()
+		r.calls = append(r.calls, value)
+		r.mu.Unlock()
+		r.ran <- struct{}{}
+	}
+}
+
+// wait returns the calls after n of them ran, or what ran before a timeout
+func (r *callRecorder) wait(n int) []string {
+	for i := 0; i < n; i++ {
+		select {
+		case <-r.ran:
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.calls...)
+}
+
+func TestDebouncer(t *testing.T) {
+	t.Run("coalesces a burst", func(t *testing.T) {
+		clock := timing.NewMock()
+		d := newDebouncer(100*time.Millisecond, time.Second, clock)
+		defer d.Stop()
+		r := newCallRecorder()
+
+		for _, v := range []string{"first", "second", "third"} {
+			d.Debounce("a.md", r.fn(v))
+			clock.Add(50 * time.Millisecond)
+		}
+		if calls := r.wait(0); len(calls) != 0 {
+			t.Errorf("Expected no calls during the burst, got %v", calls)
+		}
+		clock.Add(50 * time.Millisecond)
+		if calls := r.wait(1); len(calls) != 1 || calls[0] != "third" {
+			t.Errorf("Expected only the last call, got %v", calls)
+		}
+	})
+
+	t.Run("keys are independent", func(t *testing.T) {
+		clock := timing.NewMock()
+		d := newDebouncer(100*time.Millisecond, time.Second, clock)
+		defer d.Stop()
+		r := newCallRecorder()
+
+		d.Debounce("a.md", r.fn("a"))
+		d.Debounce("b.md", r.fn("b"))
+		clock.Add(100 * time.Millisecond)
+		if calls := r.wait(2); len(calls) != 2 {
+			t.Errorf("Expected a call per key, got %v", calls)
+		}
+	})
+
+	t.Run("max delay bounds a long burst", func(t *testing.T) {
+		clock := timing.NewMock()
+		d := newDebouncer(100*time.Millisecond, 300*time.Millisecond, clock)
+		defer d.Stop()
+		r := newCallRecorder()
+
+		for i := 0; i < 4; i++ {
+			d.Debounce("a.md", r.fn("a"))
+			clock.Add(80 * time.Millisecond)
+		}
+		// The burst started 320ms ago
+		if calls := r.wait(1); len(calls) != 1 {
+			t.Errorf("Expected a call once the max delay passed, got %v", calls)
+		}
+	})
+
+	t.Run("cancel forgets a pending call", func(t *testing.T) {
+		clock := timing.NewMock()
+		d := newDebouncer(100*time.Millisecond, time.Second, clock)
+		defer d.Stop()
+		r := newCallRecorder()
+
+		d.Debounce("a.md", r.fn("a"))
+		d.Cancel("a.md")
+		d.Cancel("missing.md")
+		clock.Add(time.Second)
+		if calls := r.wait(1); len(calls) != 0 {
+			t.Errorf("Expected no calls, got %v", calls)
+		}
+	})
+}
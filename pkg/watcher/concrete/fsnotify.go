@@ -0,0 +1,62 @@
+package concrete
+
+import (
+	"github.com/butter-bot-machines/skylark/pkg/watcher"
+	"github.com/fsnotify/fsnotify"
+)
+
+// fsnotifyBackend implements watcher.Backend with operating system
+// notifications
+type fsnotifyBackend struct {
+	w      *fsnotify.Watcher
+	events chan watcher.Event
+	done   chan struct{}
+}
+
+// newFSNotifyBackend creates a backend using fsnotify
+func newFSNotifyBackend() (*fsnotifyBackend, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	b := &fsnotifyBackend{
+		w:      w,
+		events: make(chan watcher.Event),
+		done:   make(chan struct{}),
+	}
+	go b.forward()
+	return b, nil
+}
+
+// forward translates fsnotify events until the watcher is closed
+func (b *fsnotifyBackend) forward() {
+	defer close(b.events)
+	for event := range b.w.Events {
+		select {
+		case b.events <- watcher.Event{Path: event.Name, Op: event.Op.String()}:
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// Add implements watcher.Backend
+func (b *fsnotifyBackend) Add(path string) error {
+	return b.w.Add(path)
+}
+
+// Events implements watcher.Backend
+func (b *fsnotifyBackend) Events() <-chan watcher.Event {
+	return b.events
+}
+
+// Errors implements watcher.Backend
+func (b *fsnotifyBackend) Errors() <-chan error {
+	return b.w.Errors
+}
+
+// Close implements watcher.Backend
+func (b *fsnotifyBackend) Close() error {
+	close(b.done)
+	return b.w.Close()
+}
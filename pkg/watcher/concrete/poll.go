@@ -0,0 +1,210 @@
+package concrete
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/timing"
+	"github.com/butter-bot-machines/skylark/pkg/watcher"
+)
+
+// defaultPollInterval is used when no poll interval is configured
+const defaultPollInterval = time.Second
+
+// pollBackend implements watcher.Backend by scanning watched paths
+// periodically. A file has changed when the hash of its modification time
+// and size differs from the previous scan.
+type pollBackend struct {
+	interval time.Duration
+	clock    timing.Clock
+	events   chan watcher.Event
+	errors   chan error
+	done     chan struct{}
+	wg       sync.WaitGroup
+
+	mu     sync.Mutex
+	paths  []string
+	hashes map[string]uint64 // By file path, as of the last scan
+}
+
+// newPollBackend creates a backend scanning every interval. A zero
+// interval uses the default; a nil clock uses the real clock.
+func newPollBackend(interval time.Duration, clock timing.Clock) *pollBackend {
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	if clock == nil {
+		clock = timing.New()
+	}
+	b := &pollBackend{
+		interval: interval,
+		clock:    clock,
+		events:   make(chan watcher.Event),
+		errors:   make(chan error),
+		done:     make(chan struct{}),
+		hashes:   make(map[string]uint64),
+	}
+	b.wg.Add(1)
+	go b.poll()
+	return b
+}
+
+// Add implements watcher.Backend. Files already present are not reported.
+func (b *pollBackend) Add(path string) error {
+	hashes, err := scan(path)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.paths = append(b.paths, path)
+	for name, h := range hashes {
+		b.hashes[name] = h
+	}
+	return nil
+}
+
+// Events implements watcher.Backend
+func (b *pollBackend) Events() <-chan watcher.Event {
+	return b.events
+}
+
+// Errors implements watcher.Backend
+func (b *pollBackend) Errors() <-chan error {
+	return b.errors
+}
+
+// Close implements watcher.Backend
+func (b *pollBackend) Close() error {
+	close(b.done)
+	b.wg.Wait()
+	close(b.events)
+	close(b.errors)
+	return nil
+}
+
+func (b *pollBackend) poll() {
+	defer b.wg.Done()
+
+	ticker := b.clock.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C():
+			events, errs := b.check()
+			for _, err := range errs {
+				select {
+				case b.errors <- err:
+				case <-b.done:
+					return
+				}
+			}
+			for _, event := range events {
+				select {
+				case b.events <- event:
+				case <-b.done:
+					return
+				}
+			}
+		}
+	}
+}
+
+// check scans all watched paths and returns the changes since the last scan
+func (b *pollBackend) check() ([]watcher.Event, []error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	current := make(map[string]uint64, len(b.hashes))
+	var errs []error
+	for _, path := range b.paths {
+		hashes, err := scan(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+			// Keep the files of an unreadable path rather than reporting
+			// them removed
+			for name, h := range b.hashes {
+				if within(path, name) {
+					current[name] = h
+				}
+			}
+			continue
+		}
+		for name, h := range hashes {
+			current[name] = h
+		}
+	}
+
+	var events []watcher.Event
+	for name, h := range current {
+		old, ok := b.hashes[name]
+		switch {
+		case !ok:
+			events = append(events, watcher.Event{Path: name, Op: "CREATE"})
+		case old != h:
+			events = append(events, watcher.Event{Path: name, Op: "WRITE"})
+		}
+	}
+	for name := range b.hashes {
+		if _, ok := current[name]; !ok {
+			events = append(events, watcher.Event{Path: name, Op: "REMOVE"})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Path < events[j].Path })
+
+	b.hashes = current
+	return events, errs
+}
+
+// scan hashes path if it is a file, or the files directly in it if it is
+// a directory
+func scan(path string) (map[string]uint64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make(map[string]uint64)
+	if !info.IsDir() {
+		hashes[path] = hashInfo(info)
+		return hashes, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", path, err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue // Removed since it was listed
+		}
+		hashes[filepath.Join(path, entry.Name())] = hashInfo(info)
+	}
+	return hashes, nil
+}
+
+// hashInfo hashes the modification time and size of a file
+func hashInfo(info fs.FileInfo) uint64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d:%d", info.ModTime().UnixNano(), info.Size())
+	return h.Sum64()
+}
+
+// within reports whether name is path or directly in it
+func within(path, name string) bool {
+	return name == path || filepath.Dir(name) == path
+}
@@ -0,0 +1,84 @@
+package concrete
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/timing"
+	"github.com/butter-bot-machines/skylark/pkg/watcher"
+)
+
+// nextEvent advances clock by one poll and returns the next event
+func nextEvent(t *testing.T, b *pollBackend, clock timing.MockClock) (watcher.Event, bool) {
+	t.Helper()
+	clock.Add(time.Second)
+	select {
+	case event := <-b.Events():
+		return event, true
+	case <-time.After(200 * time.Millisecond):
+		return watcher.Event{}, false
+	}
+}
+
+func TestPollBackend(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.md")
+	if err := os.WriteFile(existing, []byte("old"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	clock := timing.NewMock()
+	b := newPollBackend(time.Second, clock)
+	defer b.Close()
+	if err := b.Add(dir); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	// Files present when the path is added are not reported
+	if event, ok := nextEvent(t, b, clock); ok {
+		t.Errorf("Expected no event, got %+v", event)
+	}
+
+	created := filepath.Join(dir, "created.md")
+	tests := []struct {
+		name   string
+		change func() error
+		want   watcher.Event
+	}{
+		{
+			name:   "create",
+			change: func() error { return os.WriteFile(created, []byte("new"), 0644) },
+			want:   watcher.Event{Path: created, Op: "CREATE"},
+		},
+		{
+			name:   "write",
+			change: func() error { return os.WriteFile(existing, []byte("changed"), 0644) },
+			want:   watcher.Event{Path: existing, Op: "WRITE"},
+		},
+		{
+			name:   "remove",
+			change: func() error { return os.Remove(created) },
+			want:   watcher.Event{Path: created, Op: "REMOVE"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.change(); err != nil {
+				t.Fatalf("Failed to change file: %v", err)
+			}
+			event, ok := nextEvent(t, b, clock)
+			if !ok {
+				t.Fatal("Timed out waiting for event")
+			}
+			if event != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, event)
+			}
+		})
+	}
+
+	if err := b.Add(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expected an error adding a missing path")
+	}
+}
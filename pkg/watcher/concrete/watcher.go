@@ -1,24 +1,31 @@
 package concrete
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
+	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/ignore"
 	"github.com/butter-bot-machines/skylark/pkg/job"
 	"github.com/butter-bot-machines/skylark/pkg/processor"
+	"github.com/butter-bot-machines/skylark/pkg/tracing"
 	"github.com/butter-bot-machines/skylark/pkg/watcher"
-	"github.com/fsnotify/fsnotify"
 )
 
 // watcherImpl implements watcher.FileWatcher
 type watcherImpl struct {
-	fsWatcher *fsnotify.Watcher
+	backend   watcher.Backend
+	ignored   *ignore.Matcher
 	jobQueue  chan<- job.Job
 	debouncer watcher.Debouncer
 	processor processor.ProcessManager
+	knowledge map[string]string // Assistant owning each watched knowledge directory
+	prompts   map[string]string // Assistant of each watched assistant directory
 	done      chan struct{}
 	wg        sync.WaitGroup
 	stopped   bool
@@ -38,29 +45,45 @@ func NewWatcher(cfg *config.Config, jobQueue chan<- job.Job, proc processor.Proc
 		return nil, fmt.Errorf("processor is required")
 	}
 
-	fsWatcher, err := fsnotify.NewWatcher()
+	// Resolve watch paths
+	paths := make([]string, 0, len(cfg.WatchPaths))
+	for _, path := range cfg.WatchPaths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve path %s: %w", path, err)
+		}
+		paths = append(paths, absPath)
+	}
+
+	// Load ignore rules from the project directory
+	root := "."
+	if cfg.Environment.ConfigDir != "" {
+		root = filepath.Dir(cfg.Environment.ConfigDir)
+	}
+	ignored, err := ignore.Load(root, cfg.FileWatch.Ignore)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create watcher: %w", err)
+		return nil, err
+	}
+
+	backend, err := newBackend(cfg.FileWatch, paths)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		slog.Info("Watching path", "path", path)
 	}
 
 	w := &watcherImpl{
-		fsWatcher: fsWatcher,
+		backend:   backend,
+		ignored:   ignored,
 		jobQueue:  jobQueue,
 		processor: proc,
 		debouncer: newDebouncer(cfg.FileWatch.DebounceDelay, cfg.FileWatch.MaxDelay, nil), // Use default real clock
 		done:      make(chan struct{}),
 	}
-
-	// Add watch paths
-	for _, path := range cfg.WatchPaths {
-		absPath, err := filepath.Abs(path)
-		if err != nil {
-			return nil, fmt.Errorf("failed to resolve path %s: %w", path, err)
-		}
-		if err := fsWatcher.Add(absPath); err != nil {
-			return nil, fmt.Errorf("failed to watch path %s: %w", absPath, err)
-		}
-		slog.Info("Watching path", "path", absPath)
+	if cfg.Environment.ConfigDir != "" {
+		w.watchPrompts(filepath.Join(cfg.Environment.ConfigDir, "assistants"))
+		w.watchKnowledge(filepath.Join(cfg.Environment.ConfigDir, "assistants"))
 	}
 
 	w.wg.Add(1)
@@ -82,7 +105,53 @@ func (w *watcherImpl) Stop() error {
 
 	w.wg.Wait()
 	w.debouncer.Stop()
-	return w.fsWatcher.Close()
+	return w.backend.Close()
+}
+
+// newBackend creates the configured backend watching paths. In auto mode,
+// fsnotify is used unless it cannot watch an existing path, as happens on
+// some network file systems; all paths are then polled instead.
+func newBackend(cfg config.FileWatchConfig, paths []string) (watcher.Backend, error) {
+	switch cfg.Backend {
+	case config.WatchPoll:
+		return addPaths(newPollBackend(cfg.PollInterval, nil), paths)
+	case config.WatchFSNotify:
+		b, err := newFSNotifyBackend()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create watcher: %w", err)
+		}
+		return addPaths(b, paths)
+	case "", config.WatchAuto:
+		b, err := newFSNotifyBackend()
+		if err != nil {
+			slog.Warn("fsnotify unavailable, polling for changes", "error", err)
+			return addPaths(newPollBackend(cfg.PollInterval, nil), paths)
+		}
+		for _, path := range paths {
+			if err := b.Add(path); err != nil {
+				b.Close()
+				if _, statErr := os.Stat(path); statErr != nil {
+					return nil, fmt.Errorf("failed to watch path %s: %w", path, err)
+				}
+				slog.Warn("fsnotify cannot watch path, polling for changes", "path", path, "error", err)
+				return addPaths(newPollBackend(cfg.PollInterval, nil), paths)
+			}
+		}
+		return b, nil
+	default:
+		return nil, fmt.Errorf("unknown file watch backend %q", cfg.Backend)
+	}
+}
+
+// addPaths adds paths to b, closing it on failure
+func addPaths(b watcher.Backend, paths []string) (watcher.Backend, error) {
+	for _, path := range paths {
+		if err := b.Add(path); err != nil {
+			b.Close()
+			return nil, fmt.Errorf("failed to watch path %s: %w", path, err)
+		}
+	}
+	return b, nil
 }
 
 func (w *watcherImpl) watch() {
@@ -92,19 +161,43 @@ func (w *watcherImpl) watch() {
 		select {
 		case <-w.done:
 			return
-		case event, ok := <-w.fsWatcher.Events:
+		case event, ok := <-w.backend.Events():
 			if !ok {
 				return
 			}
-			// Skip files in .skai directory and non-markdown files
-			if filepath.Ext(event.Name) != ".md" || filepath.Base(filepath.Dir(event.Name)) == ".skai" {
+			// Changed knowledge is re-indexed once changes settle
+			if name, ok := w.knowledge[filepath.Dir(event.Path)]; ok {
+				w.debouncer.Debounce("knowledge:"+name, func() {
+					w.refreshKnowledge(name)
+				})
+				continue
+			}
+			// Edited prompts are reloaded once changes settle
+			if name, ok := w.prompts[filepath.Dir(event.Path)]; ok && filepath.Base(event.Path) == "prompt.md" {
+				w.debouncer.Debounce("assistant:"+name, func() {
+					w.reloadAssistant(name)
+				})
+				continue
+			}
+			// Skip files in .skai directory, non-markdown and ignored files
+			if filepath.Ext(event.Path) != ".md" || filepath.Base(filepath.Dir(event.Path)) == ".skai" {
+				continue
+			}
+			if w.ignored.Ignored(event.Path, false) {
+				continue
+			}
+			// A removed or renamed file has nothing left to process. Editors
+			// that save by renaming create the file again, and a renamed
+			// file is reported created at its new path.
+			if isRemoval(event.Op) {
+				w.debouncer.Cancel(event.Path)
 				continue
 			}
 			// Debounce events
-			w.debouncer.Debounce(event.Name, func() {
+			w.debouncer.Debounce(event.Path, func() {
 				w.handleEvent(event)
 			})
-		case err, ok := <-w.fsWatcher.Errors:
+		case err, ok := <-w.backend.Errors():
 			if !ok {
 				return
 			}
@@ -113,10 +206,120 @@ func (w *watcherImpl) watch() {
 	}
 }
 
-func (w *watcherImpl) handleEvent(event fsnotify.Event) {
-	// Create job from event using NewFileChangeJob
-	j := job.NewFileChangeJob(event.Name, w.processor)
+// isRemoval reports whether op only removes the file from its path.
+// Combined operations are debounced and checked when they are handled.
+func isRemoval(op string) bool {
+	removed := strings.Contains(op, "REMOVE") || strings.Contains(op, "RENAME")
+	return removed && !strings.Contains(op, "CREATE") && !strings.Contains(op, "WRITE")
+}
+
+func (w *watcherImpl) handleEvent(event watcher.Event) {
+	// Drop events for files deleted before processing
+	if _, err := os.Stat(event.Path); err != nil {
+		slog.Debug("Skipping missing file", "path", event.Path, "error", err)
+		return
+	}
+
+	// Each file event starts a trace that follows the job through the pipeline
+	ctx, span := tracing.Start(context.Background(), "file.event",
+		tracing.WithAttributes(
+			tracing.String("file.path", event.Path),
+			tracing.String("file.op", event.Op)))
+	defer span.End()
+
+	// Create job from event using NewFileChangeJob; edits made while
+	// watching are interactive and take precedence over batch work
+	j := job.NewFileChangeJob(event.Path, w.processor).
+		WithPriority(job.PriorityInteractive).
+		WithContext(ctx)
 
 	// Send to job queue
 	w.jobQueue <- j
 }
+
+// watchPrompts watches the directories of the assistants in dir for
+// changes to their prompt.md, when the processor can reload assistants.
+// Directories that cannot be watched are logged and skipped.
+func (w *watcherImpl) watchPrompts(dir string) {
+	if _, ok := w.processor.(processor.AssistantReloader); !ok {
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	w.prompts = make(map[string]string)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		path, err := filepath.Abs(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		if err := w.backend.Add(path); err != nil {
+			slog.Warn("Cannot watch assistant directory", "path", path, "error", err)
+			continue
+		}
+		w.prompts[path] = entry.Name()
+	}
+	if len(w.prompts) > 0 {
+		slog.Info("Watching assistant prompts", "path", dir, "assistants", len(w.prompts))
+	}
+}
+
+// reloadAssistant loads the assistant name again after its prompt.md
+// changed
+func (w *watcherImpl) reloadAssistant(name string) {
+	r := w.processor.(processor.AssistantReloader)
+	if err := r.ReloadAssistant(context.Background(), name); err != nil {
+		slog.Error("Failed to reload assistant", "assistant", name, "error", err)
+	}
+}
+
+// watchKnowledge watches the knowledge directories of the assistants in
+// dir, and the directories within them, when the processor can refresh
+// knowledge. Directories that cannot be watched are logged and skipped.
+func (w *watcherImpl) watchKnowledge(dir string) {
+	if _, ok := w.processor.(processor.KnowledgeRefresher); !ok {
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	w.knowledge = make(map[string]string)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		root := filepath.Join(dir, name, "knowledge")
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			continue
+		}
+		filepath.WalkDir(absRoot, func(path string, d os.DirEntry, err error) error {
+			if err != nil || !d.IsDir() {
+				return nil
+			}
+			if err := w.backend.Add(path); err != nil {
+				slog.Warn("Cannot watch knowledge directory", "path", path, "error", err)
+				return filepath.SkipDir
+			}
+			w.knowledge[path] = name
+			return nil
+		})
+	}
+	for path, name := range w.knowledge {
+		slog.Info("Watching knowledge", "assistant", name, "path", path)
+	}
+}
+
+// refreshKnowledge re-indexes the knowledge of the assistant name
+func (w *watcherImpl) refreshKnowledge(name string) {
+	r := w.processor.(processor.KnowledgeRefresher)
+	if err := r.RefreshKnowledge(context.Background(), name); err != nil {
+		slog.Error("Failed to refresh knowledge", "assistant", name, "error", err)
+	}
+}
@@ -1,6 +1,7 @@
 package concrete
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"sync"
@@ -56,6 +57,10 @@ func (p *mockProcessor) GetProcessManager() process.Manager {
 	return p.procMgr
 }
 
+func (p *mockProcessor) Close() error {
+	return nil
+}
+
 func TestWatcher(t *testing.T) {
 	// Create temporary test directory
 	tmpDir := t.TempDir()
@@ -203,6 +208,136 @@ func TestWatcher(t *testing.T) {
 	})
 }
 
+func TestWatcherPollBackend(t *testing.T) {
+	tmpDir := t.TempDir()
+	jobQueue := make(chan job.Job, 10)
+	proc := &mockProcessor{
+		procMgr: &mockProcessManager{},
+	}
+	cfg := &config.Config{
+		WatchPaths: []string{tmpDir},
+		FileWatch: config.FileWatchConfig{
+			DebounceDelay: 10 * time.Millisecond,
+			MaxDelay:      100 * time.Millisecond,
+			Backend:       config.WatchPoll,
+			PollInterval:  20 * time.Millisecond,
+		},
+	}
+
+	w, err := NewWatcher(cfg, jobQueue, proc)
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	defer w.Stop()
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "new.md"), []byte("new content"), 0644); err != nil {
+		t.Fatalf("Failed to create new file: %v", err)
+	}
+	select {
+	case j := <-jobQueue:
+		if j == nil {
+			t.Error("Received nil job")
+		}
+	case <-time.After(time.Second):
+		t.Error("Timed out waiting for job")
+	}
+}
+
+func TestWatcherIgnore(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, ".skylarkignore"), []byte("scratch-*.md\n"), 0644); err != nil {
+		t.Fatalf("Failed to write ignore file: %v", err)
+	}
+	jobQueue := make(chan job.Job, 10)
+	proc := &mockProcessor{
+		procMgr: &mockProcessManager{},
+	}
+	cfg := &config.Config{
+		Environment: config.EnvironmentConfig{ConfigDir: filepath.Join(tmpDir, ".skai")},
+		WatchPaths:  []string{tmpDir},
+		FileWatch: config.FileWatchConfig{
+			DebounceDelay: 10 * time.Millisecond,
+			MaxDelay:      100 * time.Millisecond,
+			Ignore:        []string{"*.draft.md"},
+			Backend:       config.WatchPoll,
+			PollInterval:  20 * time.Millisecond,
+		},
+	}
+
+	w, err := NewWatcher(cfg, jobQueue, proc)
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	defer w.Stop()
+
+	for _, name := range []string{"scratch-1.md", "plan.draft.md"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte("ignored"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+	select {
+	case <-jobQueue:
+		t.Error("Received job for ignored file")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestWatcherRenameAndDelete(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldPath := filepath.Join(tmpDir, "old.md")
+	if err := os.WriteFile(oldPath, []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	jobQueue := make(chan job.Job, 10)
+	proc := &mockProcessor{
+		procMgr: &mockProcessManager{},
+	}
+	cfg := &config.Config{
+		WatchPaths: []string{tmpDir},
+		FileWatch: config.FileWatchConfig{
+			DebounceDelay: 100 * time.Millisecond,
+			MaxDelay:      time.Second,
+			Backend:       config.WatchPoll,
+			PollInterval:  20 * time.Millisecond,
+		},
+	}
+
+	w, err := NewWatcher(cfg, jobQueue, proc)
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	defer w.Stop()
+
+	// A file deleted before it is processed is dropped
+	if err := os.WriteFile(filepath.Join(tmpDir, "temp.md"), []byte("temp"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := os.Remove(filepath.Join(tmpDir, "temp.md")); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+
+	// A renamed file is processed at its new path only
+	newPath := filepath.Join(tmpDir, "new.md")
+	if err := os.Rename(oldPath, newPath); err != nil {
+		t.Fatalf("Failed to rename file: %v", err)
+	}
+
+	var paths []string
+	timeout := time.After(500 * time.Millisecond)
+	for done := false; !done; {
+		select {
+		case j := <-jobQueue:
+			paths = append(paths, j.(*job.FileChangeJob).Path)
+		case <-timeout:
+			done = true
+		}
+	}
+	if len(paths) != 1 || paths[0] != newPath {
+		t.Errorf("Expected a single job for %s, got %v", newPath, paths)
+	}
+}
+
 func TestWatcherErrors(t *testing.T) {
 	t.Run("invalid path", func(t *testing.T) {
 		cfg := &config.Config{
@@ -219,6 +354,21 @@ func TestWatcherErrors(t *testing.T) {
 		}
 	})
 
+	t.Run("unknown backend", func(t *testing.T) {
+		cfg := &config.Config{
+			WatchPaths: []string{"."},
+			FileWatch:  config.FileWatchConfig{Backend: "inotify"},
+		}
+		proc := &mockProcessor{
+			procMgr: &mockProcessManager{},
+		}
+
+		_, err := NewWatcher(cfg, make(chan job.Job), proc)
+		if err == nil {
+			t.Error("Expected error for unknown backend")
+		}
+	})
+
 	t.Run("nil config", func(t *testing.T) {
 		jobQueue := make(chan job.Job)
 		proc := &mockProcessor{
@@ -257,3 +407,127 @@ func TestWatcherErrors(t *testing.T) {
 		}
 	})
 }
+
+// knowledgeProcessor is a mockProcessor that reports knowledge refreshes
+type knowledgeProcessor struct {
+	mockProcessor
+	refreshed chan string
+}
+
+func (p *knowledgeProcessor) RefreshKnowledge(ctx context.Context, assistant string) error {
+	p.refreshed <- assistant
+	return nil
+}
+
+func TestWatcherKnowledge(t *testing.T) {
+	tmpDir := t.TempDir()
+	configDir := filepath.Join(tmpDir, ".skai")
+	knowledgeDir := filepath.Join(configDir, "assistants", "research", "knowledge", "papers")
+	if err := os.MkdirAll(knowledgeDir, 0755); err != nil {
+		t.Fatalf("Failed to create knowledge directory: %v", err)
+	}
+	jobQueue := make(chan job.Job, 10)
+	proc := &knowledgeProcessor{
+		mockProcessor: mockProcessor{procMgr: &mockProcessManager{}},
+		refreshed:     make(chan string, 10),
+	}
+	cfg := &config.Config{
+		Environment: config.EnvironmentConfig{ConfigDir: configDir},
+		WatchPaths:  []string{tmpDir},
+		FileWatch: config.FileWatchConfig{
+			DebounceDelay: 10 * time.Millisecond,
+			MaxDelay:      100 * time.Millisecond,
+			Backend:       config.WatchPoll,
+			PollInterval:  20 * time.Millisecond,
+		},
+	}
+
+	w, err := NewWatcher(cfg, jobQueue, proc)
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	defer w.Stop()
+
+	// Knowledge files of any type, also in subdirectories, are refreshed
+	// instead of processed
+	if err := os.WriteFile(filepath.Join(knowledgeDir, "survey.txt"), []byte("findings"), 0644); err != nil {
+		t.Fatalf("Failed to write knowledge file: %v", err)
+	}
+	select {
+	case name := <-proc.refreshed:
+		if name != "research" {
+			t.Errorf("Expected research to be refreshed, got %s", name)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for knowledge refresh")
+	}
+	select {
+	case <-jobQueue:
+		t.Error("Expected no job for a knowledge file")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// reloadProcessor is a mockProcessor that reports assistant reloads
+type reloadProcessor struct {
+	mockProcessor
+	reloaded chan string
+}
+
+func (p *reloadProcessor) ReloadAssistant(ctx context.Context, assistant string) error {
+	p.reloaded <- assistant
+	return nil
+}
+
+func TestWatcherPrompts(t *testing.T) {
+	tmpDir := t.TempDir()
+	configDir := filepath.Join(tmpDir, ".skai")
+	assistantDir := filepath.Join(configDir, "assistants", "editor")
+	if err := os.MkdirAll(assistantDir, 0755); err != nil {
+		t.Fatalf("Failed to create assistant directory: %v", err)
+	}
+	jobQueue := make(chan job.Job, 10)
+	proc := &reloadProcessor{
+		mockProcessor: mockProcessor{procMgr: &mockProcessManager{}},
+		reloaded:      make(chan string, 10),
+	}
+	cfg := &config.Config{
+		Environment: config.EnvironmentConfig{ConfigDir: configDir},
+		WatchPaths:  []string{tmpDir},
+		FileWatch: config.FileWatchConfig{
+			DebounceDelay: 10 * time.Millisecond,
+			MaxDelay:      100 * time.Millisecond,
+			Backend:       config.WatchPoll,
+			PollInterval:  20 * time.Millisecond,
+		},
+	}
+
+	w, err := NewWatcher(cfg, jobQueue, proc)
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	defer w.Stop()
+
+	// Other files of the assistant are not reloaded
+	if err := os.WriteFile(filepath.Join(assistantDir, "notes.txt"), []byte("draft"), 0644); err != nil {
+		t.Fatalf("Failed to write notes: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(assistantDir, "prompt.md"), []byte("You edit."), 0644); err != nil {
+		t.Fatalf("Failed to write prompt: %v", err)
+	}
+	select {
+	case name := <-proc.reloaded:
+		if name != "editor" {
+			t.Errorf("Expected editor to be reloaded, got %s", name)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for assistant reload")
+	}
+	select {
+	case name := <-proc.reloaded:
+		t.Errorf("Expected a single reload, got another for %s", name)
+	case <-jobQueue:
+		t.Error("Expected no job for a prompt")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
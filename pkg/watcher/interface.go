@@ -16,6 +16,8 @@ type EventHandler interface {
 type Debouncer interface {
 	// Debounce delays execution of fn until events settle
 	Debounce(key string, fn func())
+	// Cancel forgets a pending call for key
+	Cancel(key string)
 	// Stop stops the debouncer
 	Stop()
 }
@@ -30,6 +32,24 @@ type PathManager interface {
 	IsWatched(path string) bool
 }
 
+// Event is a change to a watched file
+type Event struct {
+	Path string
+	Op   string // CREATE, WRITE, REMOVE, RENAME or CHMOD, joined by | when combined
+}
+
+// Backend detects changes to files in watched paths
+type Backend interface {
+	// Add watches a file, or the files directly in a directory
+	Add(path string) error
+	// Events delivers changes
+	Events() <-chan Event
+	// Errors delivers errors that do not stop watching
+	Errors() <-chan error
+	// Close stops watching and closes both channels
+	Close() error
+}
+
 // FileWatcher monitors files for changes
 type FileWatcher interface {
 	// Stop stops the watcher
@@ -1,10 +1,14 @@
 package concrete
 
 import (
+	"context"
 	"fmt"
+	"runtime/debug"
+	"sort"
 	"sync"
-	"sync/atomic"
+	"time"
 
+	"github.com/butter-bot-machines/skylark/pkg/errors"
 	"github.com/butter-bot-machines/skylark/pkg/job"
 	"github.com/butter-bot-machines/skylark/pkg/logging"
 	"github.com/butter-bot-machines/skylark/pkg/process"
@@ -12,29 +16,177 @@ import (
 	"github.com/butter-bot-machines/skylark/pkg/worker"
 )
 
-// poolStats implements worker.Stats
+const (
+	// defaultRetryBackoff is the delay before the first retry of a failed job
+	defaultRetryBackoff = time.Second
+
+	// maxRetryBackoff caps the exponential delay between retries
+	maxRetryBackoff = 5 * time.Minute
+
+	// scaleCheckInterval is how often the autoscaler samples queue depth
+	scaleCheckInterval = time.Second
+
+	// scaleUpChecks is how many consecutive samples must exceed the
+	// threshold before a worker is added
+	scaleUpChecks = 2
+
+	// eventBuffer is the capacity of each progress event subscription
+	eventBuffer = 256
+
+	// defaultIdleTimeout is how long an extra worker may sit idle before
+	// it is retired
+	defaultIdleTimeout = 30 * time.Second
+
+	// interruptWait is how long Shutdown waits, once the grace period is
+	// over, for the jobs it interrupts to return
+	interruptWait = 2 * time.Second
+)
+
+// poolStats holds the counters behind worker.Stats. A single lock guards
+// them all so that a snapshot never sees a job counted twice or not at all.
 type poolStats struct {
-	processedJobs uint64
-	failedJobs    uint64
-	queuedJobs    uint64
+	mu          sync.Mutex
+	processed   uint64
+	failed      uint64
+	queued      uint64
+	byPriority  [3]worker.PriorityStats
+	inFlight    int
+	workers     int
+	scaledUp    uint64
+	scaledDown  uint64
+	runs        uint64        // Attempts finished
+	runTime     time.Duration // Total time of the attempts finished
+	latency     worker.Histogram
+	errors      map[string]uint64
+	lastFailure *worker.Failure
+}
+
+// newPoolStats creates empty statistics
+func newPoolStats() *poolStats {
+	return &poolStats{
+		latency: worker.NewHistogram(worker.LatencyBounds),
+		errors:  make(map[string]uint64),
+	}
+}
+
+// snapshot returns the statistics as of now
+func (s *poolStats) snapshot() worker.Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := worker.Stats{
+		ProcessedJobs: s.processed,
+		FailedJobs:    s.failed,
+		QueuedJobs:    s.queued,
+		InFlight:      s.inFlight,
+		ActiveWorkers: s.workers,
+		ScaledUp:      s.scaledUp,
+		ScaledDown:    s.scaledDown,
+		Latency:       s.latency.Clone(),
+		Priorities:    make(map[job.Priority]worker.PriorityStats, len(s.byPriority)),
+	}
+	if s.runs > 0 {
+		stats.AvgDuration = s.runTime / time.Duration(s.runs)
+	}
+	if len(s.errors) > 0 {
+		stats.Errors = make(map[string]uint64, len(s.errors))
+		for kind, n := range s.errors {
+			stats.Errors[kind] = n
+		}
+	}
+	for p := range s.byPriority {
+		stats.Priorities[job.Priority(p)] = s.byPriority[p]
+	}
+	if s.lastFailure != nil {
+		f := *s.lastFailure
+		stats.LastFailure = &f
+	}
+	return stats
+}
+
+// counters returns the counters for a priority, treating unknown values as
+// batch. The caller holds s.mu.
+func (s *poolStats) counters(p job.Priority) *worker.PriorityStats {
+	if p < 0 || int(p) >= len(s.byPriority) {
+		p = job.PriorityBatch
+	}
+	return &s.byPriority[p]
+}
+
+// enqueue counts a job of priority p as queued
+func (s *poolStats) enqueue(p job.Priority) {
+	s.mu.Lock()
+	s.queued++
+	s.counters(p).Queued++
+	s.mu.Unlock()
 }
 
-func (s *poolStats) ProcessedJobs() uint64 {
-	return atomic.LoadUint64(&s.processedJobs)
+// dequeue stops counting a job of priority p as queued
+func (s *poolStats) dequeue(p job.Priority) {
+	s.mu.Lock()
+	s.queued--
+	s.counters(p).Queued--
+	s.mu.Unlock()
 }
 
-func (s *poolStats) FailedJobs() uint64 {
-	return atomic.LoadUint64(&s.failedJobs)
+// start counts a job as running
+func (s *poolStats) start() {
+	s.mu.Lock()
+	s.inFlight++
+	s.mu.Unlock()
 }
 
-func (s *poolStats) QueuedJobs() uint64 {
-	return atomic.LoadUint64(&s.queuedJobs)
+// ran records an attempt that took d, which is no longer running
+func (s *poolStats) ran(d time.Duration) {
+	s.mu.Lock()
+	s.inFlight--
+	s.runs++
+	s.runTime += d
+	s.latency.Observe(d)
+	s.mu.Unlock()
+}
+
+// complete records the outcome of a job of priority p that will not run
+// again. A failure is nil for a job that succeeded.
+func (s *poolStats) complete(p job.Priority, failure *worker.Failure, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counters := s.counters(p)
+	s.queued--
+	counters.Queued--
+	if failure == nil {
+		s.processed++
+		counters.Processed++
+		return
+	}
+	s.failed++
+	counters.Failed++
+	s.errors[worker.ErrorKind(err)]++
+	s.lastFailure = failure
+}
+
+// addWorkers changes the count of running workers by n
+func (s *poolStats) addWorkers(n int) {
+	s.mu.Lock()
+	s.workers += n
+	s.mu.Unlock()
+}
+
+// scale counts a worker added or retired by the autoscaler
+func (s *poolStats) scale(up bool) {
+	s.mu.Lock()
+	if up {
+		s.scaledUp++
+	} else {
+		s.scaledDown++
+	}
+	s.mu.Unlock()
 }
 
 // workerImpl implements worker.Worker
 type workerImpl struct {
-	id   int
-	pool *poolImpl
+	id      int
+	pool    *poolImpl
+	elastic bool // Added by the autoscaler and retired when idle
 }
 
 func (w *workerImpl) ID() int {
@@ -43,52 +195,155 @@ func (w *workerImpl) ID() int {
 
 func (w *workerImpl) Start() error {
 	defer w.pool.wg.Done()
+	defer w.pool.stats.addWorkers(-1)
 	logger := w.pool.logger.WithGroup(fmt.Sprintf("worker-%d", w.id))
 	logger.Info("worker started")
 
 	for {
 		select {
-		case <-w.pool.done:
-			logger.Info("worker stopping")
+		case <-w.pool.draining:
+			logger.Info("worker draining")
 			return nil
-		case job, ok := <-w.pool.jobQueue:
-			if !ok {
-				logger.Info("worker stopping (queue closed)")
+		default:
+		}
+
+		item, ok := w.pool.take()
+		if !ok {
+			if !w.wait(logger) {
 				return nil
 			}
+			continue
+		}
 
-			logger.Debug("processing job")
+		select {
+		case <-w.pool.done:
+			w.pool.abandon(item)
+			logger.Info("worker stopping")
+			return nil
+		default:
+		}
 
-			// Set resource limits for the job
-			limits := process.ResourceLimits{
-				MaxCPUTime:    w.pool.limits.MaxCPUTime,
-				MaxMemoryMB:   w.pool.limits.MaxMemoryMB,
-				MaxFileSizeMB: w.pool.limits.MaxFileSizeMB,
-				MaxFiles:      w.pool.limits.MaxFiles,
-				MaxProcesses:  w.pool.limits.MaxProcesses,
-			}
-			w.pool.procMgr.SetDefaultLimits(limits)
-
-			// Run the job
-			logger.Debug("running job")
-			if err := job.Process(); err != nil {
-				logger.Error("job failed", "error", err)
-				atomic.AddUint64(&w.pool.stats.failedJobs, 1)
-				job.OnFailure(err)
-			} else {
-				logger.Debug("job completed successfully")
-				atomic.AddUint64(&w.pool.stats.processedJobs, 1)
-				logger.Debug("stats updated",
-					"processed_jobs", atomic.LoadUint64(&w.pool.stats.processedJobs),
-					"failed_jobs", atomic.LoadUint64(&w.pool.stats.failedJobs))
-			}
+		w.run(logger, item)
+	}
+}
+
+// wait blocks until jobs may be available. It returns false when the worker
+// should exit, either because the pool is stopping or because an elastic
+// worker has been idle for too long.
+func (w *workerImpl) wait(logger logging.Logger) bool {
+	var idle <-chan time.Time
+	if w.elastic {
+		timer := w.pool.clock.NewTimer(w.pool.idleTimeout)
+		defer timer.Stop()
+		idle = timer.C()
+	}
+
+	select {
+	case <-w.pool.done:
+		logger.Info("worker stopping")
+		return false
+	case <-w.pool.draining:
+	case <-w.pool.queue.Ready():
+	case <-idle:
+		w.pool.retire(w)
+		return false
+	}
+	return true
+}
+
+// run processes a single queued job and updates statistics
+func (w *workerImpl) run(logger logging.Logger, item *queueItem) {
+	job := item.job
+	if item.desc.File != "" {
+		logger = logger.With("file", item.desc.File)
+	}
+
+	logger.Debug("processing job", "priority", item.priority.String())
+
+	// Set resource limits for the job
+	limits := process.ResourceLimits{
+		MaxCPUTime:    w.pool.limits.MaxCPUTime,
+		MaxMemoryMB:   w.pool.limits.MaxMemoryMB,
+		MaxFileSizeMB: w.pool.limits.MaxFileSizeMB,
+		MaxFiles:      w.pool.limits.MaxFiles,
+		MaxProcesses:  w.pool.limits.MaxProcesses,
+	}
+	w.pool.procMgr.SetDefaultLimits(limits)
+
+	// Run the job
+	logger.Debug("running job")
+	item.started = w.pool.clock.Now()
+	w.pool.stats.start()
+	w.pool.emit(worker.EventStarted, item, nil)
+	w.pool.reportProgress(item)
+	ctx, cancel := w.pool.jobContext()
+	stack, err := execute(ctx, job)
+	if err != nil && ctx.Err() != nil && w.pool.ctx.Err() == nil {
+		err = fmt.Errorf("%w: %w", context.Cause(ctx), err)
+	}
+	cancel()
+	w.pool.stats.ran(w.pool.clock.Now().Sub(item.started))
+	w.pool.finish(item)
+
+	if err != nil && w.pool.ctx.Err() != nil {
+		// Shutdown has returned the job to be replayed
+		logger.Warn("job interrupted by shutdown", "error", err)
+		w.pool.interrupt(item)
+		return
+	}
+
+	if err != nil && item.attempts < job.MaxRetries() {
+		// Leave the job counted as queued while it waits to be retried
+		item.attempts++
+		delay := w.pool.backoff(item.attempts)
+		logger.Warn("job failed, scheduling retry",
+			"error", err,
+			"attempt", item.attempts,
+			"max_retries", job.MaxRetries(),
+			"backoff", delay)
+		w.pool.emit(worker.EventRetrying, item, err)
+		w.pool.scheduleRetry(item, delay)
+		return
+	}
+
+	if err != nil {
+		logger.Error("job failed", "error", err, "attempts", item.attempts+1)
+		w.pool.stats.complete(item.priority, &worker.Failure{
+			File:  item.desc.File,
+			Error: err.Error(),
+			Time:  w.pool.clock.Now(),
+		}, err)
+		job.OnFailure(err)
+		w.pool.deadLetter(item, err, stack)
+	} else {
+		logger.Debug("job completed successfully")
+		w.pool.stats.complete(item.priority, nil, nil)
+	}
+
+	if err != nil {
+		w.pool.emit(worker.EventFailed, item, err)
+	} else {
+		w.pool.emit(worker.EventCompleted, item, nil)
+	}
+}
+
+// execute runs a job, converting a panic into an error. The returned stack
+// comes from the panic or from the error itself when it carries one.
+func execute(ctx context.Context, j job.Job) (stack string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", worker.ErrPanic, r)
+			stack = string(debug.Stack())
+		}
+	}()
 
-			// Decrement queued jobs counter
-			atomic.AddUint64(&w.pool.stats.queuedJobs, ^uint64(0))
-			logger.Debug("queued jobs decremented",
-				"queued_jobs", atomic.LoadUint64(&w.pool.stats.queuedJobs))
+	if err := j.Process(ctx); err != nil {
+		if e, ok := err.(interface{ Stack() errors.StackTrace }); ok && e.Stack() != nil {
+			stack = e.Stack().String()
 		}
+		return stack, err
 	}
+	return "", nil
 }
 
 func (w *workerImpl) Stop() error {
@@ -98,8 +353,11 @@ func (w *workerImpl) Stop() error {
 // poolImpl implements worker.Pool
 type poolImpl struct {
 	workers       []*workerImpl
-	jobQueue      chan job.Job
+	queue         *priorityQueue
 	done          chan struct{}
+	draining      chan struct{}
+	stopOnce      sync.Once
+	drainOnce     sync.Once
 	wg            sync.WaitGroup
 	stats         *poolStats
 	limits        process.ResourceLimits
@@ -107,6 +365,34 @@ type poolImpl struct {
 	logger        logging.Logger
 	procMgr       process.Manager
 	clock         timing.Clock
+	retryBackoff  time.Duration
+	deadLetters   worker.DeadLetterSink
+	jobTimeout    time.Duration
+	gates         []worker.Gate
+
+	// ctx is canceled when shutdown interrupts the jobs still running
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Autoscaling
+	maxWorkers     int
+	scaleThreshold int
+	idleTimeout    time.Duration
+	nextID         int
+	scaler         sync.WaitGroup
+
+	mu          sync.Mutex
+	concurrency map[string]int // Maximum running jobs per concurrency key
+	running     map[string]int // Running jobs per concurrency key
+	inFlight    map[*queueItem]struct{}
+	paused      bool // Workers take no new jobs while set
+
+	subsMu   sync.Mutex
+	subs     map[chan worker.Event]struct{}
+	retrying map[*queueItem]timing.Timer // Failed jobs waiting out their backoff
+	spilled  []job.Job                   // Jobs accepted but never dispatched
+
+	interrupted []*queueItem // Jobs that returned after shutdown interrupted them
 }
 
 // NewPool creates a new worker pool
@@ -122,28 +408,64 @@ func NewPool(opts worker.Options) (worker.Pool, error) {
 	}
 
 	p := &poolImpl{
-		jobQueue: make(chan job.Job, opts.QueueSize),
+		queue:    newPriorityQueue(opts.QueueSize),
 		done:     make(chan struct{}),
-		stats:    &poolStats{},
+		draining: make(chan struct{}),
+		stats:    newPoolStats(),
 		limits:   opts.ProcMgr.GetDefaultLimits(),
 		logger:   opts.Logger.WithGroup("worker"),
 		procMgr:  opts.ProcMgr,
-		clock:    timing.New(),
+		clock:    opts.Clock,
+		inFlight: make(map[*queueItem]struct{}),
+		retrying: make(map[*queueItem]timing.Timer),
+
+		concurrency: opts.Concurrency,
+		running:     make(map[string]int),
+		subs:        make(map[chan worker.Event]struct{}),
+
+		retryBackoff: opts.RetryBackoff,
+		deadLetters:  opts.DeadLetters,
+		jobTimeout:   opts.JobTimeout,
+		gates:        opts.Gates,
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	if p.retryBackoff <= 0 {
+		p.retryBackoff = defaultRetryBackoff
+	}
+	if p.clock == nil {
+		p.clock = timing.New()
+	}
+
+	p.maxWorkers = opts.MaxWorkers
+	if p.maxWorkers < opts.Workers {
+		p.maxWorkers = opts.Workers
+	}
+	p.scaleThreshold = opts.ScaleThreshold
+	if p.scaleThreshold <= 0 {
+		p.scaleThreshold = opts.Workers
+	}
+	p.idleTimeout = opts.IdleTimeout
+	if p.idleTimeout <= 0 {
+		p.idleTimeout = defaultIdleTimeout
 	}
 
-	p.workers = make([]*workerImpl, opts.Workers)
+	p.mu.Lock()
 	for i := 0; i < opts.Workers; i++ {
-		w := &workerImpl{
-			id:   i,
-			pool: p,
-		}
-		p.workers[i] = w
-		p.wg.Add(1)
-		go w.Start()
+		p.addWorker(false)
+	}
+	p.mu.Unlock()
+
+	if p.maxWorkers > opts.Workers {
+		p.scaler.Add(1)
+		go p.autoscale()
+	}
+	for _, gate := range p.gates {
+		go p.watchGate(gate)
 	}
 
 	p.logger.Info("worker pool started",
 		"workers", opts.Workers,
+		"max_workers", p.maxWorkers,
 		"queue_size", opts.QueueSize)
 
 	return p, nil
@@ -157,8 +479,8 @@ func (p *poolImpl) WithClock(clock timing.Clock) worker.Pool {
 
 // Queue returns a channel for queueing jobs
 func (p *poolImpl) Queue() chan<- job.Job {
-	// Create a buffered channel with same capacity as jobQueue
-	ch := make(chan job.Job, cap(p.jobQueue))
+	// Create a buffered channel with same capacity as the queue
+	ch := make(chan job.Job, cap(p.queue.slots))
 	p.queueWrappers.Add(1)
 	go func() {
 		defer p.queueWrappers.Done()
@@ -166,20 +488,26 @@ func (p *poolImpl) Queue() chan<- job.Job {
 		for {
 			select {
 			case <-p.done:
+				p.spill(ch)
 				return
 			case j, ok := <-ch:
 				if !ok {
 					return
 				}
-				atomic.AddUint64(&p.stats.queuedJobs, 1)
+				p.stats.enqueue(job.PriorityOf(j))
 				p.logger.Debug("job queued",
-					"queued_jobs", atomic.LoadUint64(&p.stats.queuedJobs))
+					"priority", job.PriorityOf(j).String())
 
-				// Try to send the job, but give up if pool is shutting down
-				select {
-				case <-p.done:
+				// Try to queue the job, but give up if pool is shutting down
+				item := newQueueItem(j)
+				p.emit(worker.EventQueued, item, nil)
+				if !p.queue.requeue(item, p.done) {
+					p.unqueue(job.PriorityOf(j))
+					p.mu.Lock()
+					p.spilled = append(p.spilled, j)
+					p.mu.Unlock()
+					p.spill(ch)
 					return
-				case p.jobQueue <- j:
 				}
 			}
 		}
@@ -187,17 +515,483 @@ func (p *poolImpl) Queue() chan<- job.Job {
 	return ch
 }
 
-// Stats returns the current worker pool statistics
+// Stats returns a snapshot of the worker pool statistics
 func (p *poolImpl) Stats() worker.Stats {
-	return p.stats
+	return p.stats.snapshot()
+}
+
+// Subscribe returns a channel of job progress events
+func (p *poolImpl) Subscribe() (<-chan worker.Event, func()) {
+	ch := make(chan worker.Event, eventBuffer)
+	p.subsMu.Lock()
+	p.subs[ch] = struct{}{}
+	p.subsMu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			p.subsMu.Lock()
+			delete(p.subs, ch)
+			p.subsMu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// reportProgress has a job that reports progress publish it as progress
+// events of its current attempt
+func (p *poolImpl) reportProgress(item *queueItem) {
+	r, ok := item.job.(job.Reporter)
+	if !ok {
+		return
+	}
+	attempt := item.attempts + 1
+	r.ReportProgress(func(message string) {
+		p.publish(worker.Event{
+			Type:     worker.EventProgress,
+			File:     item.desc.File,
+			Commands: item.desc.Commands,
+			Priority: item.priority,
+			Attempt:  attempt,
+			Message:  message,
+			Time:     p.clock.Now(),
+		})
+	})
+}
+
+// emit publishes a progress event to all subscribers without blocking
+func (p *poolImpl) emit(t worker.EventType, item *queueItem, err error) {
+	now := p.clock.Now()
+	e := worker.Event{
+		Type:     t,
+		File:     item.desc.File,
+		Commands: item.desc.Commands,
+		Priority: item.priority,
+		Attempt:  item.attempts + 1,
+		Err:      err,
+		Time:     now,
+	}
+	switch t {
+	case worker.EventRetrying:
+		e.Attempt = item.attempts // Already advanced to the next attempt
+		e.Duration = now.Sub(item.started)
+	case worker.EventCompleted, worker.EventFailed:
+		e.Duration = now.Sub(item.started)
+	}
+	p.publish(e)
+}
+
+// publish sends e to all subscribers without blocking
+func (p *poolImpl) publish(e worker.Event) {
+	p.subsMu.Lock()
+	defer p.subsMu.Unlock()
+	for ch := range p.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
 }
 
 // Stop gracefully shuts down the worker pool
 func (p *poolImpl) Stop() {
-	p.logger.Info("stopping worker pool")
-	close(p.done)          // Signal all goroutines to stop
-	p.queueWrappers.Wait() // Wait for queue wrapper goroutines to finish
-	close(p.jobQueue)      // Close the job queue
-	p.wg.Wait()            // Wait for all workers to finish
-	p.logger.Info("worker pool stopped")
+	p.stopOnce.Do(func() {
+		p.logger.Info("stopping worker pool")
+		p.cancelRetries()
+		close(p.done)          // Signal all goroutines to stop
+		p.queueWrappers.Wait() // Wait for queue wrapper goroutines to finish
+		p.scaler.Wait()        // Wait for the autoscaler so no workers are added
+		p.wg.Wait()            // Wait for all workers to finish
+		p.cancel()
+		p.logger.Info("worker pool stopped")
+	})
+}
+
+// Shutdown stops dispatching jobs and waits for in-flight jobs to finish
+// until ctx is done, then interrupts those still running and stops the
+// pool. It returns the jobs that did not complete: those that returned
+// interrupted, followed by those that were never started. Jobs that finish
+// despite the interruption, or are still running after interruptWait, are
+// not returned, so that a replay never answers them a second time.
+func (p *poolImpl) Shutdown(ctx context.Context) []job.Job {
+	p.logger.Info("draining worker pool")
+	p.drainOnce.Do(func() { close(p.draining) })
+	p.scaler.Wait()
+
+	workersDone := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(workersDone)
+	}()
+
+	select {
+	case <-workersDone:
+	case <-ctx.Done():
+		p.mu.Lock()
+		running := len(p.inFlight)
+		p.mu.Unlock()
+		p.logger.Warn("grace period expired with jobs in flight",
+			"in_flight", running)
+	}
+
+	// Stop queue wrappers without waiting on workers that are still busy
+	p.stopOnce.Do(func() {
+		close(p.done)
+		p.queueWrappers.Wait()
+	})
+
+	// Interrupt the jobs still running and wait for them to return
+	p.cancel()
+	timer := p.clock.NewTimer(interruptWait)
+	select {
+	case <-workersDone:
+	case <-timer.C():
+	}
+	timer.Stop()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.inFlight) > 0 {
+		p.logger.Warn("jobs still running after interruption are not returned",
+			"in_flight", len(p.inFlight))
+	}
+	sort.Slice(p.interrupted, func(i, j int) bool { return p.interrupted[i].seq < p.interrupted[j].seq })
+
+	var pending []job.Job
+	for _, item := range p.interrupted {
+		pending = append(pending, item.job)
+	}
+	p.interrupted = nil
+	for _, item := range p.cancelRetriesLocked() {
+		p.unqueue(item.priority)
+		pending = append(pending, item.job)
+	}
+	for _, item := range p.queue.drain() {
+		p.unqueue(item.priority)
+		pending = append(pending, item.job)
+	}
+	pending = append(pending, p.spilled...)
+	p.spilled = nil
+
+	p.logger.Info("worker pool shut down", "pending", len(pending))
+	return pending
+}
+
+// timeoutError is the cause of the cancellation of a job that ran out of
+// time. It matches context.DeadlineExceeded.
+type timeoutError time.Duration
+
+func (e timeoutError) Error() string {
+	return fmt.Sprintf("job timed out after %s", time.Duration(e))
+}
+
+func (e timeoutError) Is(target error) bool {
+	return target == context.DeadlineExceeded
+}
+
+// jobContext returns the context a job runs with, done when shutdown
+// interrupts the job or its timeout expires
+func (p *poolImpl) jobContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(p.ctx)
+	if p.jobTimeout <= 0 {
+		return ctx, func() { cancel(context.Canceled) }
+	}
+	timeout := p.jobTimeout
+	timer := p.clock.AfterFunc(timeout, func() { cancel(timeoutError(timeout)) })
+	return ctx, func() {
+		timer.Stop()
+		cancel(context.Canceled)
+	}
+}
+
+// addWorker starts a new worker. Callers must hold p.mu.
+func (p *poolImpl) addWorker(elastic bool) {
+	w := &workerImpl{
+		id:      p.nextID,
+		pool:    p,
+		elastic: elastic,
+	}
+	p.nextID++
+	p.workers = append(p.workers, w)
+	p.stats.addWorkers(1)
+	p.wg.Add(1)
+	go w.Start()
+}
+
+// retire removes an idle elastic worker from the pool
+func (p *poolImpl) retire(w *workerImpl) {
+	p.mu.Lock()
+	for i, other := range p.workers {
+		if other == w {
+			p.workers = append(p.workers[:i], p.workers[i+1:]...)
+			break
+		}
+	}
+	workers := len(p.workers)
+	p.mu.Unlock()
+
+	p.stats.scale(false)
+	p.logger.Info("scaled down worker pool",
+		"worker", w.id,
+		"workers", workers,
+		"idle", p.idleTimeout)
+}
+
+// autoscale adds elastic workers while the queue stays deeper than the
+// scale threshold, up to the configured maximum
+func (p *poolImpl) autoscale() {
+	defer p.scaler.Done()
+	ticker := p.clock.NewTicker(scaleCheckInterval)
+	defer ticker.Stop()
+
+	backlogged := 0
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-p.draining:
+			return
+		case <-ticker.C():
+		}
+
+		depth := p.queue.Len()
+		if depth <= p.scaleThreshold || p.Paused() {
+			backlogged = 0
+			continue
+		}
+		backlogged++
+		if backlogged < scaleUpChecks {
+			continue
+		}
+
+		p.mu.Lock()
+		if len(p.workers) < p.maxWorkers {
+			p.addWorker(true)
+			p.stats.scale(true)
+			p.logger.Info("scaled up worker pool",
+				"workers", len(p.workers),
+				"max_workers", p.maxWorkers,
+				"queue_depth", depth)
+		}
+		p.mu.Unlock()
+	}
+}
+
+// Pause implements worker.Pool
+func (p *poolImpl) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.paused {
+		p.paused = true
+		p.logger.Info("worker pool paused")
+	}
+}
+
+// Resume implements worker.Pool
+func (p *poolImpl) Resume() {
+	p.mu.Lock()
+	wasPaused := p.paused
+	p.paused = false
+	p.mu.Unlock()
+
+	if wasPaused {
+		p.logger.Info("worker pool resumed")
+		p.queue.signal()
+	}
+}
+
+// Paused implements worker.Pool
+func (p *poolImpl) Paused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.paused
+}
+
+// watchGate wakes workers when gate may have stopped holding jobs
+func (p *poolImpl) watchGate(gate worker.Gate) {
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-p.draining:
+			return
+		case <-gate.Changed():
+			p.queue.signal()
+		}
+	}
+}
+
+// held reports whether a gate is holding jobs
+func (p *poolImpl) held() bool {
+	for _, gate := range p.gates {
+		if gate.Holding() {
+			return true
+		}
+	}
+	return false
+}
+
+// take pops the next job whose concurrency keys all have capacity and
+// records it as in flight
+func (p *poolImpl) take() (*queueItem, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.paused || p.held() {
+		return nil, false
+	}
+	item, ok := p.queue.PopWhere(p.admissible)
+	if ok {
+		p.inFlight[item] = struct{}{}
+		for _, key := range item.keys {
+			p.running[key]++
+		}
+	}
+	return item, ok
+}
+
+// admissible reports whether a job can start without exceeding the
+// concurrency limit of any of its keys. With limits set, the keys are
+// taken again from the job, as a file may have changed since it was
+// queued. Callers must hold p.mu.
+func (p *poolImpl) admissible(item *queueItem) bool {
+	if len(p.concurrency) > 0 {
+		item.keys = job.ConcurrencyKeysOf(item.job)
+	}
+	for _, key := range item.keys {
+		if limit := p.concurrency[key]; limit > 0 && p.running[key] >= limit {
+			return false
+		}
+	}
+	return true
+}
+
+// finish records that an in-flight job has completed, waking a worker if
+// it frees capacity for jobs held back by a concurrency limit
+func (p *poolImpl) finish(item *queueItem) {
+	p.mu.Lock()
+	delete(p.inFlight, item)
+	p.release(item)
+	p.mu.Unlock()
+}
+
+// release returns the concurrency keys held by a job. Callers must hold p.mu.
+func (p *poolImpl) release(item *queueItem) {
+	freed := false
+	for _, key := range item.keys {
+		if p.concurrency[key] > 0 {
+			freed = true
+		}
+		if p.running[key]--; p.running[key] <= 0 {
+			delete(p.running, key)
+		}
+	}
+	if freed {
+		p.queue.signal()
+	}
+}
+
+// backoff returns the delay before the given retry attempt
+func (p *poolImpl) backoff(attempt int) time.Duration {
+	delay := p.retryBackoff
+	for i := 1; i < attempt && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryBackoff {
+		delay = maxRetryBackoff
+	}
+	return delay
+}
+
+// scheduleRetry requeues a failed job once its backoff has elapsed
+func (p *poolImpl) scheduleRetry(item *queueItem, delay time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.retrying[item] = p.clock.AfterFunc(delay, func() { p.retry(item) })
+}
+
+// retry moves a job whose backoff has elapsed back onto the queue
+func (p *poolImpl) retry(item *queueItem) {
+	p.mu.Lock()
+	if _, ok := p.retrying[item]; !ok {
+		p.mu.Unlock()
+		return // Collected by Shutdown
+	}
+	delete(p.retrying, item)
+	p.mu.Unlock()
+
+	if !p.queue.requeue(item, p.done) {
+		p.unqueue(item.priority)
+		p.mu.Lock()
+		p.spilled = append(p.spilled, item.job)
+		p.mu.Unlock()
+	}
+}
+
+// cancelRetries stops all pending retry timers
+func (p *poolImpl) cancelRetries() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cancelRetriesLocked()
+}
+
+// cancelRetriesLocked stops pending retry timers and returns their jobs in
+// queue order. Callers must hold p.mu.
+func (p *poolImpl) cancelRetriesLocked() []*queueItem {
+	items := make([]*queueItem, 0, len(p.retrying))
+	for item, timer := range p.retrying {
+		timer.Stop()
+		items = append(items, item)
+	}
+	p.retrying = make(map[*queueItem]timing.Timer)
+	sort.Slice(items, func(i, j int) bool { return items[i].seq < items[j].seq })
+	return items
+}
+
+// deadLetter records a permanently failed job, if a sink is configured
+func (p *poolImpl) deadLetter(item *queueItem, err error, stack string) {
+	if p.deadLetters == nil {
+		return
+	}
+	if dlErr := p.deadLetters.Add(item.job, err, stack, item.attempts+1); dlErr != nil {
+		p.logger.Error("failed to record dead letter", "error", dlErr)
+	}
+}
+
+// interrupt records a job that returned after shutdown interrupted it, for
+// Shutdown to return
+func (p *poolImpl) interrupt(item *queueItem) {
+	p.mu.Lock()
+	p.interrupted = append(p.interrupted, item)
+	p.mu.Unlock()
+	p.unqueue(item.priority)
+}
+
+// abandon returns a job taken by a stopping worker to the spilled list
+func (p *poolImpl) abandon(item *queueItem) {
+	p.mu.Lock()
+	delete(p.inFlight, item)
+	p.release(item)
+	p.spilled = append(p.spilled, item.job)
+	p.mu.Unlock()
+	p.unqueue(item.priority)
+}
+
+// spill moves jobs still buffered in a queue wrapper channel to the spilled list
+func (p *poolImpl) spill(ch chan job.Job) {
+	for {
+		select {
+		case j := <-ch:
+			p.mu.Lock()
+			p.spilled = append(p.spilled, j)
+			p.mu.Unlock()
+		default:
+			return
+		}
+	}
+}
+
+// unqueue decrements the queued counters for a job that will not run
+func (p *poolImpl) unqueue(priority job.Priority) {
+	p.stats.dequeue(priority)
 }
@@ -1,16 +1,20 @@
 package concrete
 
 import (
+	"context"
 	"errors"
 	"os"
+	"reflect"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/butter-bot-machines/skylark/pkg/config"
+	"github.com/butter-bot-machines/skylark/pkg/job"
 	"github.com/butter-bot-machines/skylark/pkg/logging"
 	"github.com/butter-bot-machines/skylark/pkg/process"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
 	"github.com/butter-bot-machines/skylark/pkg/timing"
 	"github.com/butter-bot-machines/skylark/pkg/worker"
 )
@@ -18,11 +22,15 @@ import (
 // mockJob implements the Job interface for testing
 type mockJob struct {
 	processFunc func() error
+	processCtx  func(ctx context.Context) error
 	maxRetries  int
 	onFailure   func(error)
 }
 
-func (j *mockJob) Process() error {
+func (j *mockJob) Process(ctx context.Context) error {
+	if j.processCtx != nil {
+		return j.processCtx(ctx)
+	}
 	if j.processFunc != nil {
 		return j.processFunc()
 	}
@@ -215,11 +223,11 @@ func TestWorkerPool(t *testing.T) {
 		}
 
 		stats := pool.Stats()
-		if stats.ProcessedJobs() != 1 {
-			t.Errorf("Expected 1 processed job, got %d", stats.ProcessedJobs())
+		if stats.ProcessedJobs != 1 {
+			t.Errorf("Expected 1 processed job, got %d", stats.ProcessedJobs)
 		}
-		if stats.FailedJobs() != 0 {
-			t.Errorf("Expected 0 failed jobs, got %d", stats.FailedJobs())
+		if stats.FailedJobs != 0 {
+			t.Errorf("Expected 0 failed jobs, got %d", stats.FailedJobs)
 		}
 	})
 
@@ -249,8 +257,11 @@ func TestWorkerPool(t *testing.T) {
 		}
 
 		stats := pool.Stats()
-		if stats.FailedJobs() != 1 {
-			t.Errorf("Expected 1 failed job, got %d", stats.FailedJobs())
+		if stats.FailedJobs != 1 {
+			t.Errorf("Expected 1 failed job, got %d", stats.FailedJobs)
+		}
+		if f := stats.LastFailure; f == nil || f.Error != "test error" {
+			t.Errorf("Expected last failure %q, got %+v", "test error", f)
 		}
 	})
 
@@ -294,7 +305,7 @@ func TestWorkerPool(t *testing.T) {
 		var stats worker.Stats
 		for time.Now().Before(deadline) {
 			stats = pool.Stats()
-			if stats.ProcessedJobs() == uint64(jobCount)+1 { // +1 from first test (second test failed)
+			if stats.ProcessedJobs == uint64(jobCount)+1 { // +1 from first test (second test failed)
 				break
 			}
 			time.Sleep(100 * time.Millisecond)
@@ -304,8 +315,8 @@ func TestWorkerPool(t *testing.T) {
 			t.Errorf("Expected %d processed jobs, got %d", jobCount, processedCount)
 		}
 
-		if stats.ProcessedJobs() != uint64(jobCount)+1 { // +1 from first test (second test failed)
-			t.Errorf("Expected %d processed jobs in stats, got %d", jobCount+1, stats.ProcessedJobs())
+		if stats.ProcessedJobs != uint64(jobCount)+1 { // +1 from first test (second test failed)
+			t.Errorf("Expected %d processed jobs in stats, got %d", jobCount+1, stats.ProcessedJobs)
 		}
 	})
 }
@@ -396,8 +407,8 @@ func TestWorkerPoolCPULimit(t *testing.T) {
 		}
 
 		stats := pool.Stats()
-		if stats.FailedJobs() != 1 {
-			t.Errorf("Expected 1 failed job, got %d", stats.FailedJobs())
+		if stats.FailedJobs != 1 {
+			t.Errorf("Expected 1 failed job, got %d", stats.FailedJobs)
 		}
 	})
 
@@ -424,3 +435,1167 @@ func TestWorkerPoolCPULimit(t *testing.T) {
 		}
 	})
 }
+
+// prioritizedJob is a mockJob with an explicit scheduling priority
+type prioritizedJob struct {
+	mockJob
+	priority job.Priority
+}
+
+func (j *prioritizedJob) Priority() job.Priority {
+	return j.priority
+}
+
+func TestWorkerPoolPriority(t *testing.T) {
+	logger := &mockLogger{}
+	procMgr := newMockProcMgr()
+
+	opts := worker.Options{
+		Config:    &mockConfig{},
+		Logger:    logger,
+		ProcMgr:   procMgr,
+		QueueSize: 10,
+		Workers:   1,
+	}
+
+	pool, err := NewPool(opts)
+	if err != nil {
+		t.Fatalf("Failed to create worker pool: %v", err)
+	}
+	defer pool.Stop()
+
+	// Block the only worker so queued jobs accumulate
+	gate := make(chan struct{})
+	started := make(chan struct{})
+	queue := pool.Queue()
+	queue <- &mockJob{
+		processFunc: func() error {
+			close(started)
+			<-gate
+			return nil
+		},
+	}
+	<-started
+
+	var mu sync.Mutex
+	var order []job.Priority
+	var wg sync.WaitGroup
+	newJob := func(p job.Priority) job.Job {
+		wg.Add(1)
+		return &prioritizedJob{
+			priority: p,
+			mockJob: mockJob{
+				processFunc: func() error {
+					mu.Lock()
+					order = append(order, p)
+					mu.Unlock()
+					wg.Done()
+					return nil
+				},
+			},
+		}
+	}
+
+	queue <- newJob(job.PriorityBackground)
+	queue <- newJob(job.PriorityBatch)
+	queue <- newJob(job.PriorityInteractive)
+	queue <- newJob(job.PriorityBatch)
+
+	// Wait until all jobs are waiting in the queue
+	deadline := time.Now().Add(5 * time.Second)
+	for pool.(*poolImpl).queue.Len() < 4 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(gate)
+	wg.Wait()
+
+	want := []job.Priority{
+		job.PriorityInteractive,
+		job.PriorityBatch,
+		job.PriorityBatch,
+		job.PriorityBackground,
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(order) != len(want) {
+		t.Fatalf("Expected %d jobs, got %d", len(want), len(order))
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Errorf("Job %d: expected priority %s, got %s", i, want[i], order[i])
+		}
+	}
+
+	// Wait for stats to settle and verify per-priority breakdown
+	deadline = time.Now().Add(5 * time.Second)
+	for pool.Stats().ProcessedJobs < 5 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	stats := pool.Stats()
+	if got := stats.ForPriority(job.PriorityBatch).Processed; got != 3 {
+		t.Errorf("Expected 3 processed batch jobs, got %d", got)
+	}
+	if got := stats.ForPriority(job.PriorityInteractive).Processed; got != 1 {
+		t.Errorf("Expected 1 processed interactive job, got %d", got)
+	}
+	if got := stats.ForPriority(job.PriorityBackground).Processed; got != 1 {
+		t.Errorf("Expected 1 processed background job, got %d", got)
+	}
+}
+
+func TestWorkerPoolDrain(t *testing.T) {
+	newPool := func(t *testing.T) worker.Pool {
+		pool, err := NewPool(worker.Options{
+			Config:    &mockConfig{},
+			Logger:    &mockLogger{},
+			ProcMgr:   newMockProcMgr(),
+			QueueSize: 10,
+			Workers:   1,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create worker pool: %v", err)
+		}
+		return pool
+	}
+
+	// blockingJob occupies the only worker until gate is closed
+	blockingJob := func(started, gate chan struct{}, finished *int32) *mockJob {
+		return &mockJob{
+			processFunc: func() error {
+				close(started)
+				<-gate
+				atomic.StoreInt32(finished, 1)
+				return nil
+			},
+		}
+	}
+
+	waitQueued := func(t *testing.T, pool worker.Pool, n int) {
+		deadline := time.Now().Add(5 * time.Second)
+		for pool.(*poolImpl).queue.Len() < n && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	t.Run("in-flight job completes within grace period", func(t *testing.T) {
+		pool := newPool(t)
+		started, gate := make(chan struct{}), make(chan struct{})
+		var finished int32
+		queue := pool.Queue()
+		queue <- blockingJob(started, gate, &finished)
+		<-started
+
+		waiting := &mockJob{}
+		queue <- waiting
+		waitQueued(t, pool, 1)
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			close(gate)
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		pending := pool.Shutdown(ctx)
+
+		if atomic.LoadInt32(&finished) != 1 {
+			t.Error("Expected in-flight job to finish before shutdown returned")
+		}
+		if len(pending) != 1 || pending[0] != waiting {
+			t.Errorf("Expected only the queued job to be pending, got %d jobs", len(pending))
+		}
+		if got := pool.Stats().QueuedJobs; got != 0 {
+			t.Errorf("Expected 0 queued jobs after shutdown, got %d", got)
+		}
+		pool.Stop() // Stop after Shutdown must not block or panic
+	})
+
+	t.Run("grace period expires", func(t *testing.T) {
+		pool := newPool(t)
+		started := make(chan struct{})
+		queue := pool.Queue()
+		running := &mockJob{processCtx: func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		}}
+		queue <- running
+		<-started
+
+		waiting := &prioritizedJob{priority: job.PriorityInteractive}
+		queue <- waiting
+		waitQueued(t, pool, 1)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		pending := pool.Shutdown(ctx)
+
+		if len(pending) != 2 {
+			t.Fatalf("Expected 2 pending jobs, got %d", len(pending))
+		}
+		if pending[0] != running {
+			t.Error("Expected the interrupted job to be returned first")
+		}
+		if pending[1] != waiting {
+			t.Error("Expected the queued job to be returned second")
+		}
+	})
+
+	t.Run("job finishes after grace period", func(t *testing.T) {
+		pool := newPool(t)
+		started, gate := make(chan struct{}), make(chan struct{})
+		var finished int32
+		queue := pool.Queue()
+		queue <- blockingJob(started, gate, &finished)
+		<-started
+
+		waiting := &mockJob{}
+		queue <- waiting
+		waitQueued(t, pool, 1)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		go func() {
+			<-ctx.Done()
+			time.Sleep(50 * time.Millisecond)
+			close(gate)
+		}()
+		pending := pool.Shutdown(ctx)
+
+		if atomic.LoadInt32(&finished) != 1 {
+			t.Fatal("Expected the job to finish after the grace period")
+		}
+		if len(pending) != 1 || pending[0] != waiting {
+			t.Errorf("Expected only the queued job to be pending, got %d jobs", len(pending))
+		}
+	})
+}
+
+// mockDeadLetters implements worker.DeadLetterSink for testing
+type mockDeadLetters struct {
+	mu       sync.Mutex
+	entries  []string
+	stacks   []string
+	attempts []int
+	added    chan struct{}
+}
+
+func (d *mockDeadLetters) Add(j job.Job, err error, stack string, attempts int) error {
+	d.mu.Lock()
+	d.entries = append(d.entries, err.Error())
+	d.stacks = append(d.stacks, stack)
+	d.attempts = append(d.attempts, attempts)
+	d.mu.Unlock()
+	d.added <- struct{}{}
+	return nil
+}
+
+func TestWorkerPoolRetry(t *testing.T) {
+	newPool := func(t *testing.T, dl *mockDeadLetters, mock timing.MockClock) worker.Pool {
+		pool, err := NewPool(worker.Options{
+			Config:       &mockConfig{},
+			Logger:       &mockLogger{},
+			ProcMgr:      newMockProcMgr(),
+			QueueSize:    10,
+			Workers:      1,
+			RetryBackoff: time.Second,
+			DeadLetters:  dl,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create worker pool: %v", err)
+		}
+		pool.(*poolImpl).WithClock(mock)
+		return pool
+	}
+
+	// waitRetrying waits until a failed job is waiting out its backoff
+	waitRetrying := func(t *testing.T, pool worker.Pool) {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			p := pool.(*poolImpl)
+			p.mu.Lock()
+			n := len(p.retrying)
+			p.mu.Unlock()
+			if n > 0 {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatal("Timed out waiting for retry to be scheduled")
+	}
+
+	t.Run("succeeds after backoff", func(t *testing.T) {
+		mock := timing.NewMock()
+		dl := &mockDeadLetters{added: make(chan struct{}, 1)}
+		pool := newPool(t, dl, mock)
+		defer pool.Stop()
+
+		var calls int32
+		done := make(chan struct{})
+		pool.Queue() <- &mockJob{
+			maxRetries: 3,
+			processFunc: func() error {
+				if atomic.AddInt32(&calls, 1) < 3 {
+					return errors.New("transient")
+				}
+				close(done)
+				return nil
+			},
+		}
+
+		waitCalls := func(n int32) {
+			deadline := time.Now().Add(5 * time.Second)
+			for atomic.LoadInt32(&calls) < n && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+			waitRetrying(t, pool)
+		}
+
+		// First retry after 1s, second after 2s
+		waitCalls(1)
+		mock.Add(time.Second)
+		waitCalls(2)
+		mock.Add(1500 * time.Millisecond)
+		if got := atomic.LoadInt32(&calls); got != 2 {
+			t.Errorf("Expected second retry to wait for backoff, got %d calls", got)
+		}
+		mock.Add(500 * time.Millisecond)
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for job to succeed")
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for pool.Stats().ProcessedJobs < 1 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		stats := pool.Stats()
+		if stats.ProcessedJobs != 1 || stats.FailedJobs != 0 {
+			t.Errorf("Expected 1 processed and 0 failed, got %d and %d",
+				stats.ProcessedJobs, stats.FailedJobs)
+		}
+		if len(dl.entries) != 0 {
+			t.Errorf("Expected no dead letters, got %d", len(dl.entries))
+		}
+	})
+
+	t.Run("exhausted retries go to dead letters", func(t *testing.T) {
+		mock := timing.NewMock()
+		dl := &mockDeadLetters{added: make(chan struct{}, 1)}
+		pool := newPool(t, dl, mock)
+		defer pool.Stop()
+
+		var failures int32
+		pool.Queue() <- &mockJob{
+			maxRetries:  1,
+			processFunc: func() error { return errors.New("permanent") },
+			onFailure:   func(error) { atomic.AddInt32(&failures, 1) },
+		}
+
+		waitRetrying(t, pool)
+		mock.Add(time.Second)
+
+		select {
+		case <-dl.added:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for dead letter")
+		}
+
+		dl.mu.Lock()
+		defer dl.mu.Unlock()
+		if dl.entries[0] != "permanent" {
+			t.Errorf("Expected error 'permanent', got %q", dl.entries[0])
+		}
+		if dl.attempts[0] != 2 {
+			t.Errorf("Expected 2 attempts, got %d", dl.attempts[0])
+		}
+		if got := atomic.LoadInt32(&failures); got != 1 {
+			t.Errorf("Expected OnFailure to be called once, got %d", got)
+		}
+	})
+
+	t.Run("panic is recorded with stack", func(t *testing.T) {
+		dl := &mockDeadLetters{added: make(chan struct{}, 1)}
+		pool := newPool(t, dl, timing.NewMock())
+		defer pool.Stop()
+
+		pool.Queue() <- &mockJob{
+			processFunc: func() error { panic("boom") },
+		}
+
+		select {
+		case <-dl.added:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for dead letter")
+		}
+
+		dl.mu.Lock()
+		defer dl.mu.Unlock()
+		if dl.entries[0] != "job panicked: boom" {
+			t.Errorf("Expected panic error, got %q", dl.entries[0])
+		}
+		if dl.stacks[0] == "" {
+			t.Error("Expected stack trace for panicked job")
+		}
+	})
+
+	t.Run("shutdown returns jobs waiting to retry", func(t *testing.T) {
+		dl := &mockDeadLetters{added: make(chan struct{}, 1)}
+		pool := newPool(t, dl, timing.NewMock())
+
+		failing := &mockJob{
+			maxRetries:  3,
+			processFunc: func() error { return errors.New("transient") },
+		}
+		pool.Queue() <- failing
+		waitRetrying(t, pool)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		pending := pool.Shutdown(ctx)
+		if len(pending) != 1 || pending[0] != failing {
+			t.Errorf("Expected the retrying job to be pending, got %d jobs", len(pending))
+		}
+	})
+}
+
+func TestWorkerPoolAutoscale(t *testing.T) {
+	mock := timing.NewMock()
+	pool, err := NewPool(worker.Options{
+		Config:         &mockConfig{},
+		Logger:         &mockLogger{},
+		ProcMgr:        newMockProcMgr(),
+		QueueSize:      10,
+		Workers:        1,
+		MaxWorkers:     3,
+		ScaleThreshold: 1,
+		IdleTimeout:    10 * time.Second,
+		Clock:          mock,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create worker pool: %v", err)
+	}
+	defer pool.Stop()
+
+	// advanceUntil moves the mock clock forward until cond holds
+	advanceUntil := func(step time.Duration, cond func() bool) bool {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if cond() {
+				return true
+			}
+			mock.Add(step)
+			time.Sleep(5 * time.Millisecond)
+		}
+		return cond()
+	}
+
+	// Queue a burst of jobs that block until released
+	gate := make(chan struct{})
+	var wg sync.WaitGroup
+	queue := pool.Queue()
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		queue <- &mockJob{
+			processFunc: func() error {
+				defer wg.Done()
+				<-gate
+				return nil
+			},
+		}
+	}
+
+	if !advanceUntil(time.Second, func() bool { return pool.Stats().ActiveWorkers == 3 }) {
+		t.Fatalf("Expected pool to scale up to 3 workers, got %d", pool.Stats().ActiveWorkers)
+	}
+
+	// The pool must not grow beyond its maximum
+	for i := 0; i < 5; i++ {
+		mock.Add(time.Second)
+		time.Sleep(5 * time.Millisecond)
+	}
+	stats := pool.Stats()
+	if stats.ActiveWorkers != 3 {
+		t.Errorf("Expected 3 active workers at maximum, got %d", stats.ActiveWorkers)
+	}
+	if stats.ScaledUp != 2 {
+		t.Errorf("Expected 2 scale-up events, got %d", stats.ScaledUp)
+	}
+
+	// Once the burst is done, extra workers retire after the idle timeout
+	close(gate)
+	wg.Wait()
+
+	if !advanceUntil(time.Second, func() bool { return pool.Stats().ActiveWorkers == 1 }) {
+		t.Fatalf("Expected pool to scale down to 1 worker, got %d", pool.Stats().ActiveWorkers)
+	}
+	if got := pool.Stats().ScaledDown; got != 2 {
+		t.Errorf("Expected 2 scale-down events, got %d", got)
+	}
+}
+
+type limitedJob struct {
+	mockJob
+	keys []string
+}
+
+func (j *limitedJob) ConcurrencyKeys() []string {
+	return j.keys
+}
+
+func TestWorkerPoolConcurrencyLimits(t *testing.T) {
+	pool, err := NewPool(worker.Options{
+		Config:      &mockConfig{},
+		Logger:      &mockLogger{},
+		ProcMgr:     newMockProcMgr(),
+		QueueSize:   10,
+		Workers:     3,
+		Concurrency: map[string]int{"slow": 1},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create worker pool: %v", err)
+	}
+	defer pool.Stop()
+
+	gate := make(chan struct{})
+	var running, peak int32
+	var wg sync.WaitGroup
+	slowJob := func() job.Job {
+		wg.Add(1)
+		return &limitedJob{
+			keys: []string{"slow"},
+			mockJob: mockJob{
+				processFunc: func() error {
+					defer wg.Done()
+					n := atomic.AddInt32(&running, 1)
+					for {
+						p := atomic.LoadInt32(&peak)
+						if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+							break
+						}
+					}
+					<-gate
+					atomic.AddInt32(&running, -1)
+					return nil
+				},
+			},
+		}
+	}
+
+	queue := pool.Queue()
+	queue <- slowJob()
+	queue <- slowJob()
+
+	// A job for another assistant must not wait behind the limited ones
+	fastDone := make(chan struct{})
+	queue <- &limitedJob{
+		keys:    []string{"fast"},
+		mockJob: mockJob{processFunc: func() error { close(fastDone); return nil }},
+	}
+
+	select {
+	case <-fastDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Unlimited job was blocked by a concurrency limit")
+	}
+
+	// Give the idle worker a chance to (incorrectly) start the second slow job
+	time.Sleep(50 * time.Millisecond)
+	if got := atomic.LoadInt32(&running); got != 1 {
+		t.Errorf("Expected 1 running slow job, got %d", got)
+	}
+
+	close(gate)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&peak); got != 1 {
+		t.Errorf("Expected at most 1 concurrent slow job, got %d", got)
+	}
+}
+
+// editedJob is a limited job whose keys change while it is queued, as
+// those of a file edited before it runs
+type editedJob struct {
+	mockJob
+	mu   sync.Mutex
+	keys []string
+}
+
+func (j *editedJob) ConcurrencyKeys() []string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.keys
+}
+
+func TestWorkerPoolConcurrencyKeysRefreshed(t *testing.T) {
+	pool, err := NewPool(worker.Options{
+		Config:      &mockConfig{},
+		Logger:      &mockLogger{},
+		ProcMgr:     newMockProcMgr(),
+		QueueSize:   10,
+		Workers:     2,
+		Concurrency: map[string]int{"slow": 1},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create worker pool: %v", err)
+	}
+	defer pool.Stop()
+
+	gate := make(chan struct{})
+	started := make(chan struct{})
+	pool.Queue() <- &limitedJob{
+		keys:    []string{"slow"},
+		mockJob: mockJob{processFunc: func() error { close(started); <-gate; return nil }},
+	}
+	<-started
+	defer close(gate)
+
+	// Queued for the limited assistant, then edited to use another one
+	editedDone := make(chan struct{})
+	edited := &editedJob{
+		keys:    []string{"slow"},
+		mockJob: mockJob{processFunc: func() error { close(editedDone); return nil }},
+	}
+	pool.Queue() <- edited
+	time.Sleep(50 * time.Millisecond)
+	edited.mu.Lock()
+	edited.keys = []string{"fast"}
+	edited.mu.Unlock()
+
+	// Any job finishing or queued makes the pool look again
+	pool.Queue() <- &limitedJob{keys: []string{"other"}, mockJob: mockJob{processFunc: func() error { return nil }}}
+
+	select {
+	case <-editedDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the edited job admitted with its new keys")
+	}
+}
+
+type describedJob struct {
+	mockJob
+	desc job.Description
+}
+
+func (j *describedJob) Describe() job.Description {
+	return j.desc
+}
+
+func TestWorkerPoolEvents(t *testing.T) {
+	mock := timing.NewMock()
+	pool, err := NewPool(worker.Options{
+		Config:       &mockConfig{},
+		Logger:       &mockLogger{},
+		ProcMgr:      newMockProcMgr(),
+		QueueSize:    10,
+		Workers:      1,
+		RetryBackoff: time.Second,
+		Clock:        mock,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create worker pool: %v", err)
+	}
+	defer pool.Stop()
+
+	events, unsubscribe := pool.Subscribe()
+	defer unsubscribe()
+
+	var calls int32
+	pool.Queue() <- &describedJob{
+		desc: job.Description{File: "notes.md", Commands: []string{"!summarize"}},
+		mockJob: mockJob{
+			maxRetries: 1,
+			processFunc: func() error {
+				if atomic.AddInt32(&calls, 1) == 1 {
+					return errors.New("transient")
+				}
+				return nil
+			},
+		},
+	}
+
+	next := func() worker.Event {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for event")
+			return worker.Event{}
+		}
+	}
+
+	want := []struct {
+		typ     worker.EventType
+		attempt int
+	}{
+		{worker.EventQueued, 1},
+		{worker.EventStarted, 1},
+		{worker.EventRetrying, 1},
+		{worker.EventStarted, 2},
+		{worker.EventCompleted, 2},
+	}
+	for i, w := range want {
+		e := next()
+		if e.Type != w.typ || e.Attempt != w.attempt {
+			t.Fatalf("Event %d: expected %s attempt %d, got %s attempt %d", i, w.typ, w.attempt, e.Type, e.Attempt)
+		}
+		if e.File != "notes.md" || len(e.Commands) != 1 {
+			t.Errorf("Event %d: expected file and commands, got %q %v", i, e.File, e.Commands)
+		}
+		if e.Type == worker.EventRetrying {
+			if e.Err == nil {
+				t.Error("Expected retrying event to carry the error")
+			}
+			// Release the retry once the worker has scheduled it
+			deadline := time.Now().Add(5 * time.Second)
+			for time.Now().Before(deadline) {
+				p := pool.(*poolImpl)
+				p.mu.Lock()
+				n := len(p.retrying)
+				p.mu.Unlock()
+				if n > 0 {
+					break
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+			mock.Add(time.Second)
+		}
+	}
+
+	// Unsubscribing closes the channel and is safe to repeat
+	unsubscribe()
+	if _, ok := <-events; ok {
+		t.Error("Expected event channel to be closed after unsubscribe")
+	}
+}
+
+type reportingJob struct {
+	describedJob
+	report func(message string)
+}
+
+func (j *reportingJob) ReportProgress(report func(message string)) {
+	j.report = report
+}
+
+func TestWorkerPoolProgress(t *testing.T) {
+	pool, err := NewPool(worker.Options{
+		Config:    &mockConfig{},
+		Logger:    &mockLogger{},
+		ProcMgr:   newMockProcMgr(),
+		QueueSize: 10,
+		Workers:   1,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create worker pool: %v", err)
+	}
+	defer pool.Stop()
+
+	events, unsubscribe := pool.Subscribe()
+	defer unsubscribe()
+
+	j := &reportingJob{describedJob: describedJob{desc: job.Description{File: "crawl.md"}}}
+	j.processFunc = func() error {
+		j.report("crawler: page 1 of 2")
+		j.report("crawler: page 2 of 2")
+		return nil
+	}
+	pool.Queue() <- j
+
+	var messages []string
+	for done := false; !done; {
+		select {
+		case e := <-events:
+			switch e.Type {
+			case worker.EventProgress:
+				if e.File != "crawl.md" || e.Attempt != 1 {
+					t.Errorf("Expected progress of attempt 1 of crawl.md, got %+v", e)
+				}
+				messages = append(messages, e.Message)
+			case worker.EventCompleted:
+				done = true
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for events")
+		}
+	}
+	want := []string{"crawler: page 1 of 2", "crawler: page 2 of 2"}
+	if !reflect.DeepEqual(messages, want) {
+		t.Errorf("Expected progress %v, got %v", want, messages)
+	}
+}
+
+func TestWorkerPoolPause(t *testing.T) {
+	pool, err := NewPool(worker.Options{
+		Config:    &mockConfig{},
+		Logger:    &mockLogger{},
+		ProcMgr:   newMockProcMgr(),
+		QueueSize: 10,
+		Workers:   2,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create worker pool: %v", err)
+	}
+	defer pool.Stop()
+
+	pool.Pause()
+	if !pool.Paused() {
+		t.Fatal("Expected pool to report paused")
+	}
+
+	var processed int32
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		pool.Queue() <- &mockJob{
+			processFunc: func() error {
+				atomic.AddInt32(&processed, 1)
+				wg.Done()
+				return nil
+			},
+		}
+	}
+
+	// Jobs stay queued while paused
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt32(&processed); n != 0 {
+		t.Fatalf("Expected no jobs processed while paused, got %d", n)
+	}
+	if q := pool.Stats().QueuedJobs; q != 3 {
+		t.Errorf("Expected 3 queued jobs while paused, got %d", q)
+	}
+
+	pool.Resume()
+	if pool.Paused() {
+		t.Error("Expected pool to report resumed")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected all jobs processed after resume, got %d", atomic.LoadInt32(&processed))
+	}
+}
+
+// mockGate holds jobs until released
+type mockGate struct {
+	holding int32
+	changed chan struct{}
+}
+
+func (g *mockGate) Holding() bool {
+	return atomic.LoadInt32(&g.holding) == 1
+}
+
+func (g *mockGate) Changed() <-chan struct{} {
+	return g.changed
+}
+
+func TestWorkerPoolGate(t *testing.T) {
+	gate := &mockGate{holding: 1, changed: make(chan struct{}, 1)}
+	pool, err := NewPool(worker.Options{
+		Config:    &mockConfig{},
+		Logger:    &mockLogger{},
+		ProcMgr:   newMockProcMgr(),
+		QueueSize: 10,
+		Workers:   2,
+		Gates:     []worker.Gate{gate},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create worker pool: %v", err)
+	}
+	defer pool.Stop()
+
+	done := make(chan struct{})
+	pool.Queue() <- &mockJob{
+		processFunc: func() error {
+			close(done)
+			return nil
+		},
+	}
+
+	// The job stays queued while the gate holds it
+	select {
+	case <-done:
+		t.Fatal("Expected no job processed while the gate is holding")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if q := pool.Stats().QueuedJobs; q != 1 {
+		t.Errorf("Expected 1 queued job while held, got %d", q)
+	}
+
+	atomic.StoreInt32(&gate.holding, 0)
+	gate.changed <- struct{}{}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the job processed once the gate released it")
+	}
+}
+
+// squareTask is a task returning the square of n
+type squareTask struct {
+	n     int
+	fails int32 // Attempts that fail before one succeeds
+	calls int32
+}
+
+func (t *squareTask) Process(ctx context.Context) (int, error) {
+	if atomic.AddInt32(&t.calls, 1) <= t.fails {
+		return 0, errors.New("transient")
+	}
+	return t.n * t.n, nil
+}
+
+func (t *squareTask) MaxRetries() int {
+	return 1
+}
+
+func TestWorkerPoolSubmit(t *testing.T) {
+	pool, err := NewPool(worker.Options{
+		Config:       &mockConfig{},
+		Logger:       &mockLogger{},
+		ProcMgr:      newMockProcMgr(),
+		QueueSize:    10,
+		Workers:      2,
+		RetryBackoff: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create worker pool: %v", err)
+	}
+	defer pool.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tests := []struct {
+		name    string
+		task    *squareTask
+		want    int
+		wantErr bool
+	}{
+		{"result", &squareTask{n: 3}, 9, false},
+		{"after retry", &squareTask{n: 4, fails: 1}, 16, false},
+		{"retries exhausted", &squareTask{n: 5, fails: 2}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			future, err := worker.Submit[int](ctx, pool, tt.task)
+			if err != nil {
+				t.Fatalf("Submit() error = %v", err)
+			}
+			got, err := future.Wait(ctx)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, got)
+			}
+			select {
+			case <-future.Done():
+			default:
+				t.Error("Expected the future to be done")
+			}
+		})
+	}
+
+	t.Run("adapted job", func(t *testing.T) {
+		var failed error
+		j := &mockJob{
+			processFunc: func() error { return errors.New("broken") },
+			onFailure:   func(err error) { failed = err },
+		}
+		future, err := worker.Submit(ctx, pool, worker.FromJob(j))
+		if err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+		if _, err := future.Wait(ctx); err == nil || err.Error() != "broken" {
+			t.Errorf("Expected the job's error, got %v", err)
+		}
+		if failed == nil {
+			t.Error("Expected the job's OnFailure to be called")
+		}
+	})
+
+	t.Run("canceled before running", func(t *testing.T) {
+		pool.Pause()
+		taskCtx, cancelTask := context.WithCancel(ctx)
+		task := &squareTask{n: 2}
+		future, err := worker.Submit[int](taskCtx, pool, task)
+		if err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+
+		// Waiting gives up with its own context
+		short, cancelShort := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancelShort()
+		if _, err := future.Wait(short); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected the wait to time out, got %v", err)
+		}
+
+		cancelTask()
+		pool.Resume()
+		if _, err := future.Wait(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected the task to be canceled, got %v", err)
+		}
+		if calls := atomic.LoadInt32(&task.calls); calls != 0 {
+			t.Errorf("Expected a canceled task not to run, got %d calls", calls)
+		}
+	})
+}
+
+func TestWorkerPoolStatsSnapshot(t *testing.T) {
+	mock := timing.NewMock()
+	pool, err := NewPool(worker.Options{
+		Config:    &mockConfig{},
+		Logger:    &mockLogger{},
+		ProcMgr:   newMockProcMgr(),
+		QueueSize: 10,
+		Workers:   1,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create worker pool: %v", err)
+	}
+	pool.(*poolImpl).WithClock(mock)
+	defer pool.Stop()
+
+	// A job that takes two seconds of the mock clock
+	started, release := make(chan struct{}), make(chan struct{})
+	pool.Queue() <- &mockJob{processFunc: func() error {
+		close(started)
+		<-release
+		mock.Add(2 * time.Second)
+		return nil
+	}}
+	<-started
+	if stats := pool.Stats(); stats.InFlight != 1 || stats.QueuedJobs != 1 {
+		t.Errorf("Expected one job in flight, got %+v", stats)
+	}
+	close(release)
+
+	pool.Queue() <- &mockJob{processFunc: func() error { panic("boom") }}
+	pool.Queue() <- &mockJob{processFunc: func() error {
+		return &provider.Error{Code: provider.ErrRateLimit, Message: "slow down"}
+	}}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for pool.Stats().FailedJobs < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	stats := pool.Stats()
+	if stats.ProcessedJobs != 1 || stats.FailedJobs != 2 || stats.QueuedJobs != 0 || stats.InFlight != 0 {
+		t.Errorf("Unexpected counts: %+v", stats)
+	}
+	if want := map[string]uint64{worker.ErrorPanic: 1, provider.ErrRateLimit: 1}; !reflect.DeepEqual(stats.Errors, want) {
+		t.Errorf("Expected errors %v, got %v", want, stats.Errors)
+	}
+	if stats.Latency.Total() != 3 {
+		t.Errorf("Expected 3 runs in the latency histogram, got %d", stats.Latency.Total())
+	}
+	if want := 2 * time.Second / 3; stats.AvgDuration != want {
+		t.Errorf("Expected average duration %v, got %v", want, stats.AvgDuration)
+	}
+	if got := stats.ForPriority(job.PriorityBatch); got.Processed != 1 || got.Failed != 2 {
+		t.Errorf("Expected batch counts, got %+v", got)
+	}
+
+	// Snapshots do not change with the pool
+	stats.Errors[worker.ErrorOther] = 1
+	stats.Latency.Observe(time.Second)
+	if again := pool.Stats(); again.Errors[worker.ErrorOther] != 0 || again.Latency.Total() != 3 {
+		t.Errorf("Expected an unchanged snapshot, got %+v", again)
+	}
+}
+
+func TestWorkerPoolJobContext(t *testing.T) {
+	newPool := func(t *testing.T, timeout time.Duration, clock timing.Clock) worker.Pool {
+		pool, err := NewPool(worker.Options{
+			Config:     &mockConfig{},
+			Logger:     &mockLogger{},
+			ProcMgr:    newMockProcMgr(),
+			QueueSize:  10,
+			Workers:    1,
+			JobTimeout: timeout,
+			Clock:      clock,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create worker pool: %v", err)
+		}
+		return pool
+	}
+
+	// blocking returns a job that runs until its context is done
+	blocking := func(started chan<- struct{}, failed *int32) *mockJob {
+		j := &mockJob{onFailure: func(error) { atomic.AddInt32(failed, 1) }}
+		j.processCtx = func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return j
+	}
+
+	t.Run("timeout", func(t *testing.T) {
+		mock := timing.NewMock()
+		pool := newPool(t, time.Minute, mock)
+		defer pool.Stop()
+
+		started := make(chan struct{})
+		var failed int32
+		pool.Queue() <- blocking(started, &failed)
+		<-started
+		mock.Add(time.Minute)
+
+		deadline := time.Now().Add(5 * time.Second)
+		for pool.Stats().FailedJobs < 1 && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		stats := pool.Stats()
+		if stats.FailedJobs != 1 || stats.Errors[worker.ErrorTimeout] != 1 {
+			t.Fatalf("Expected a timed out job, got %+v", stats)
+		}
+		if f := stats.LastFailure; f == nil || f.Error != "job timed out after 1m0s: context canceled" {
+			t.Errorf("Expected a timeout error, got %+v", f)
+		}
+		if atomic.LoadInt32(&failed) != 1 {
+			t.Error("Expected OnFailure to be called")
+		}
+	})
+
+	t.Run("interrupted by shutdown", func(t *testing.T) {
+		pool := newPool(t, 0, nil)
+
+		started := make(chan struct{})
+		var failed int32
+		j := blocking(started, &failed)
+		pool.Queue() <- j
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		pending := pool.Shutdown(ctx)
+		if len(pending) != 1 || pending[0] != j {
+			t.Fatalf("Expected the running job to be returned, got %v", pending)
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for pool.Stats().QueuedJobs > 0 && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if stats := pool.Stats(); stats.QueuedJobs != 0 || stats.FailedJobs != 0 {
+			t.Errorf("Expected the interrupted job not to count as failed, got %+v", stats)
+		}
+		if atomic.LoadInt32(&failed) != 0 {
+			t.Error("Expected no OnFailure for an interrupted job")
+		}
+		pool.Stop()
+	})
+}
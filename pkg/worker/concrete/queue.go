@@ -0,0 +1,167 @@
+package concrete
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/job"
+)
+
+// queueItem is a job waiting in the priority queue
+type queueItem struct {
+	job      job.Job
+	priority job.Priority
+	seq      uint64   // Insertion order, keeps FIFO within a priority
+	attempts int      // Failed attempts so far
+	keys     []string // Concurrency keys the job holds while running
+	desc     job.Description
+	started  time.Time // When the current attempt started
+}
+
+// newQueueItem wraps a job for queueing
+func newQueueItem(j job.Job) *queueItem {
+	return &queueItem{
+		job:      j,
+		priority: job.PriorityOf(j),
+		keys:     job.ConcurrencyKeysOf(j),
+		desc:     job.DescriptionOf(j),
+	}
+}
+
+// itemHeap implements heap.Interface ordered by priority then insertion order
+type itemHeap []*queueItem
+
+func (h itemHeap) Len() int { return len(h) }
+func (h itemHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority < h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+func (h itemHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *itemHeap) Push(x interface{}) { *h = append(*h, x.(*queueItem)) }
+func (h *itemHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+// priorityQueue is a bounded job queue that serves higher priorities first
+type priorityQueue struct {
+	mu    sync.Mutex
+	items itemHeap
+	seq   uint64
+	slots chan struct{} // Bounds the number of queued jobs
+	ready chan struct{} // Signals workers that jobs are available
+}
+
+// newPriorityQueue creates a priority queue holding at most capacity jobs
+func newPriorityQueue(capacity int) *priorityQueue {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &priorityQueue{
+		slots: make(chan struct{}, capacity),
+		ready: make(chan struct{}, 1),
+	}
+}
+
+// Push adds a job, blocking while the queue is full. It returns false if
+// done is closed before space becomes available.
+func (q *priorityQueue) Push(j job.Job, done <-chan struct{}) bool {
+	return q.requeue(newQueueItem(j), done)
+}
+
+// requeue adds an existing item behind others of the same priority,
+// blocking while the queue is full. It returns false if done is closed
+// before space becomes available.
+func (q *priorityQueue) requeue(item *queueItem, done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return false
+	case q.slots <- struct{}{}:
+	}
+
+	q.mu.Lock()
+	q.seq++
+	item.seq = q.seq
+	heap.Push(&q.items, item)
+	q.mu.Unlock()
+
+	q.signal()
+	return true
+}
+
+// Pop removes the highest priority job, returning false if the queue is empty
+func (q *priorityQueue) Pop() (*queueItem, bool) {
+	return q.PopWhere(nil)
+}
+
+// PopWhere removes the highest priority job accepted by eligible, leaving
+// the others queued in order. It returns false if no job is eligible.
+func (q *priorityQueue) PopWhere(eligible func(*queueItem) bool) (*queueItem, bool) {
+	q.mu.Lock()
+	var item *queueItem
+	var skipped []*queueItem
+	for len(q.items) > 0 {
+		next := heap.Pop(&q.items).(*queueItem)
+		if eligible == nil || eligible(next) {
+			item = next
+			break
+		}
+		skipped = append(skipped, next)
+	}
+	for _, s := range skipped {
+		heap.Push(&q.items, s)
+	}
+	remaining := len(q.items)
+	q.mu.Unlock()
+
+	if item == nil {
+		return nil, false
+	}
+
+	<-q.slots
+
+	// Wake another worker if more jobs are waiting
+	if remaining > 0 {
+		q.signal()
+	}
+	return item, true
+}
+
+// drain removes all queued jobs in priority order
+func (q *priorityQueue) drain() []*queueItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	items := make([]*queueItem, 0, len(q.items))
+	for len(q.items) > 0 {
+		items = append(items, heap.Pop(&q.items).(*queueItem))
+		<-q.slots
+	}
+	return items
+}
+
+// Ready returns a channel that receives when jobs may be available
+func (q *priorityQueue) Ready() <-chan struct{} {
+	return q.ready
+}
+
+// Len returns the number of queued jobs
+func (q *priorityQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// signal notifies a waiting worker without blocking
+func (q *priorityQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
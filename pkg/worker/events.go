@@ -0,0 +1,48 @@
+package worker
+
+import (
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/job"
+)
+
+// EventType identifies a stage in a job's lifecycle
+type EventType string
+
+const (
+	// EventQueued is published when a job enters the queue
+	EventQueued EventType = "queued"
+
+	// EventStarted is published when a worker begins running a job
+	EventStarted EventType = "started"
+
+	// EventProgress is published when a running job reports progress
+	EventProgress EventType = "progress"
+
+	// EventRetrying is published when a failed job is scheduled for another attempt
+	EventRetrying EventType = "retrying"
+
+	// EventCompleted is published when a job succeeds
+	EventCompleted EventType = "completed"
+
+	// EventFailed is published when a job fails permanently
+	EventFailed EventType = "failed"
+)
+
+// Event reports progress of a single job through the pool
+type Event struct {
+	Type     EventType
+	File     string        // File the job operates on, if known
+	Commands []string      // Commands the job runs, if known
+	Priority job.Priority  // Scheduling priority of the job
+	Attempt  int           // Attempt number, starting at 1
+	Err      error         // Failure cause for retrying and failed events
+	Message  string        // What the job is doing, for progress events
+	Duration time.Duration // Run time for retrying, completed and failed events
+	Time     time.Time     // When the event occurred
+}
+
+// Finished reports whether the event ends the job's lifecycle
+func (e Event) Finished() bool {
+	return e.Type == EventCompleted || e.Type == EventFailed
+}
@@ -0,0 +1,177 @@
+package worker
+
+import (
+	"context"
+	"sync"
+
+	"github.com/butter-bot-machines/skylark/pkg/job"
+)
+
+// Task is work that produces a result of type T. Tasks are submitted to a
+// pool with Submit and, like jobs, may implement job.Prioritized,
+// job.Limited, job.Described and job.Reporter, and OnFailure(error) to be
+// told of a permanent failure.
+type Task[T any] interface {
+	// Process runs the task with the context it was submitted with, also
+	// done when the pool cancels the attempt
+	Process(ctx context.Context) (T, error)
+
+	// MaxRetries returns the maximum number of retry attempts
+	MaxRetries() int
+}
+
+// Future is the eventual result of a submitted task
+type Future[T any] struct {
+	done   chan struct{}
+	once   sync.Once
+	result T
+	err    error
+}
+
+// newFuture creates an unresolved future
+func newFuture[T any]() *Future[T] {
+	return &Future[T]{done: make(chan struct{})}
+}
+
+// resolve completes the future. Only the first call has an effect.
+func (f *Future[T]) resolve(result T, err error) {
+	f.once.Do(func() {
+		f.result, f.err = result, err
+		close(f.done)
+	})
+}
+
+// Done returns a channel closed once the task has succeeded or failed for
+// good
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait waits for the task and returns its result, or the error it failed
+// with after exhausting its retries. It returns the error of ctx if ctx is
+// done first; the task itself carries on.
+func (f *Future[T]) Wait(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.result, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// Submit queues task on pool and returns its future. A task whose ctx is
+// done by the time a worker takes it is not run, and its future fails with
+// the error of ctx. Submit fails if ctx is done before the pool accepts the
+// task. Tasks the pool never runs, such as those still queued at
+// shutdown, leave their futures unresolved.
+func Submit[T any](ctx context.Context, pool Pool, task Task[T]) (*Future[T], error) {
+	t := &taskJob[T]{ctx: ctx, task: task, future: newFuture[T]()}
+	select {
+	case pool.Queue() <- t:
+		return t.future, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// FromJob adapts j to a task without a result, so that it can be submitted
+// and waited for. The task keeps the priority, concurrency keys,
+// description and failure handling of j.
+func FromJob(j job.Job) Task[struct{}] {
+	return jobTask{j}
+}
+
+// jobTask is a job run as a task
+type jobTask struct {
+	job.Job
+}
+
+// Process runs the job
+func (t jobTask) Process(ctx context.Context) (struct{}, error) {
+	return struct{}{}, t.Job.Process(ctx)
+}
+
+// unwrap returns the job, for its optional interfaces
+func (t jobTask) unwrap() any {
+	return t.Job
+}
+
+// taskJob runs a task as a job of the pool, resolving its future
+type taskJob[T any] struct {
+	ctx    context.Context
+	task   Task[T]
+	future *Future[T]
+}
+
+// Process runs the task, resolving the future if it succeeds. Errors are
+// left to the pool to retry.
+func (t *taskJob[T]) Process(ctx context.Context) error {
+	if err := t.ctx.Err(); err != nil {
+		var zero T
+		t.future.resolve(zero, err)
+		return nil
+	}
+	ctx, cancel := job.MergeContext(t.ctx, ctx)
+	defer cancel()
+	result, err := t.task.Process(ctx)
+	if err != nil {
+		return err
+	}
+	t.future.resolve(result, nil)
+	return nil
+}
+
+// OnFailure passes the final error to the task, then fails the future
+func (t *taskJob[T]) OnFailure(err error) {
+	if f, ok := t.inner().(interface{ OnFailure(error) }); ok {
+		f.OnFailure(err)
+	}
+	var zero T
+	t.future.resolve(zero, err)
+}
+
+// MaxRetries returns the retries of the task
+func (t *taskJob[T]) MaxRetries() int {
+	return t.task.MaxRetries()
+}
+
+// Priority implements job.Prioritized with the priority of the task
+func (t *taskJob[T]) Priority() job.Priority {
+	if p, ok := t.inner().(job.Prioritized); ok {
+		return p.Priority()
+	}
+	return job.PriorityBatch
+}
+
+// ConcurrencyKeys implements job.Limited with the keys of the task
+func (t *taskJob[T]) ConcurrencyKeys() []string {
+	if l, ok := t.inner().(job.Limited); ok {
+		return l.ConcurrencyKeys()
+	}
+	return nil
+}
+
+// Describe implements job.Described with the description of the task
+func (t *taskJob[T]) Describe() job.Description {
+	if d, ok := t.inner().(job.Described); ok {
+		return d.Describe()
+	}
+	return job.Description{}
+}
+
+// ReportProgress implements job.Reporter, passing report to the task
+func (t *taskJob[T]) ReportProgress(report func(message string)) {
+	if r, ok := t.inner().(job.Reporter); ok {
+		r.ReportProgress(report)
+	}
+}
+
+// inner returns the value whose optional interfaces the job forwards: the
+// task, or the job a task adapts
+func (t *taskJob[T]) inner() any {
+	if u, ok := any(t.task).(interface{ unwrap() any }); ok {
+		return u.unwrap()
+	}
+	return t.task
+}
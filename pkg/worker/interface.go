@@ -1,22 +1,61 @@
 package worker
 
 import (
+	"context"
+	"time"
+
 	"github.com/butter-bot-machines/skylark/pkg/config"
 	"github.com/butter-bot-machines/skylark/pkg/job"
 	"github.com/butter-bot-machines/skylark/pkg/logging"
 	"github.com/butter-bot-machines/skylark/pkg/process"
+	"github.com/butter-bot-machines/skylark/pkg/timing"
 )
 
-// Stats tracks worker pool statistics
-type Stats interface {
-	// ProcessedJobs returns the number of successfully processed jobs
-	ProcessedJobs() uint64
+// Stats is a snapshot of worker pool statistics, taken at one instant so
+// that its counts agree with each other
+type Stats struct {
+	ProcessedJobs uint64 `json:"processed_jobs"` // Jobs that succeeded
+	FailedJobs    uint64 `json:"failed_jobs"`    // Jobs that failed after exhausting their retries
+	QueuedJobs    uint64 `json:"queued_jobs"`    // Jobs waiting to run or to be retried, or running
+	InFlight      int    `json:"in_flight"`      // Jobs running
+	ActiveWorkers int    `json:"active_workers"` // Workers running
+	ScaledUp      uint64 `json:"scaled_up"`      // Workers the autoscaler has added
+	ScaledDown    uint64 `json:"scaled_down"`    // Idle workers the autoscaler has retired
+
+	// AvgDuration is the mean time a job ran, over every attempt
+	AvgDuration time.Duration `json:"avg_duration"`
+
+	// Latency counts the attempts by how long they ran
+	Latency Histogram `json:"latency"`
+
+	// Errors counts the jobs that failed for good by the kind of their
+	// final error (see ErrorKind)
+	Errors map[string]uint64 `json:"errors,omitempty"`
+
+	// Priorities holds the job counts of each priority
+	Priorities map[job.Priority]PriorityStats `json:"priorities,omitempty"`
+
+	// LastFailure is the most recent permanent job failure, if any
+	LastFailure *Failure `json:"last_failure,omitempty"`
+}
+
+// ForPriority returns the statistics for jobs of a single priority
+func (s Stats) ForPriority(p job.Priority) PriorityStats {
+	return s.Priorities[p]
+}
 
-	// FailedJobs returns the number of failed jobs
-	FailedJobs() uint64
+// Failure describes a job that failed after exhausting its retries
+type Failure struct {
+	File  string    `json:"file,omitempty"` // File the job processed, when known
+	Error string    `json:"error"`          // Final error message
+	Time  time.Time `json:"time"`           // When the job failed
+}
 
-	// QueuedJobs returns the number of currently queued jobs
-	QueuedJobs() uint64
+// PriorityStats holds job counts for a single priority level
+type PriorityStats struct {
+	Processed uint64
+	Failed    uint64
+	Queued    uint64
 }
 
 // Worker represents a single worker in the pool
@@ -33,23 +72,87 @@ type Worker interface {
 
 // Pool represents a worker pool for processing jobs
 type Pool interface {
-	// Queue returns a channel for queueing jobs
+	// Queue returns a channel for queueing jobs. Jobs are dispatched by
+	// priority (see job.Prioritized), then in the order they were queued.
 	Queue() chan<- job.Job
 
-	// Stats returns the current worker pool statistics
+	// Stats returns a snapshot of the worker pool statistics
 	Stats() Stats
 
+	// Subscribe returns a channel of job progress events and a function that
+	// ends the subscription. Events are dropped rather than blocking workers
+	// when the subscriber falls behind.
+	Subscribe() (<-chan Event, func())
+
+	// Pause stops workers from taking new jobs. Running jobs finish and
+	// queued jobs wait until Resume.
+	Pause()
+
+	// Resume lets workers take jobs again after Pause
+	Resume()
+
+	// Paused reports whether the pool is paused
+	Paused() bool
+
 	// Stop gracefully shuts down the worker pool
 	Stop()
+
+	// Shutdown stops dispatching new jobs, gives in-flight jobs until ctx is
+	// done to finish, then cancels the contexts of those still running and
+	// stops the pool. It returns the jobs that did not complete so they can
+	// be persisted and replayed later; jobs that complete after their
+	// context is cancelled are not returned.
+	Shutdown(ctx context.Context) []job.Job
+}
+
+// Gate holds back queued jobs while a service they depend on is
+// unavailable, such as a provider whose circuit breaker is open or all
+// providers while offline
+type Gate interface {
+	// Holding reports whether workers must leave queued jobs waiting
+	Holding() bool
+
+	// Changed returns a channel that receives, or is closed, when Holding
+	// may have changed. It is called again to wait for the next change.
+	Changed() <-chan struct{}
+}
+
+// DeadLetterSink receives jobs that have exhausted their retries
+type DeadLetterSink interface {
+	// Add records a permanently failed job with its final error, an
+	// optional stack trace and the number of attempts made
+	Add(j job.Job, err error, stack string, attempts int) error
 }
 
 // Options configures a worker pool
 type Options struct {
-	Config    config.Store
-	Logger    logging.Logger
-	ProcMgr   process.Manager
-	QueueSize int
-	Workers   int
+	Config       config.Store
+	Logger       logging.Logger
+	ProcMgr      process.Manager
+	QueueSize    int
+	Workers      int
+	RetryBackoff time.Duration  // Delay before the first retry, doubled for each further attempt
+	DeadLetters  DeadLetterSink // Optional store for permanently failed jobs
+	Clock        timing.Clock   // Optional clock, defaults to the system clock
+
+	// Gates hold back queued jobs while any of them is holding
+	Gates []Gate
+
+	// JobTimeout bounds each attempt of a job; an attempt still running
+	// when it expires has its context canceled and fails. Zero means no
+	// limit.
+	JobTimeout time.Duration
+
+	// Autoscaling. Extra workers are added while more than ScaleThreshold
+	// jobs stay queued (default: Workers) and retired after IdleTimeout.
+	MaxWorkers     int
+	ScaleThreshold int
+	IdleTimeout    time.Duration
+
+	// Concurrency caps how many jobs holding each concurrency key (see
+	// job.Limited) may run at once. Jobs over the limit wait in the queue
+	// while workers move on to other jobs.
+	Concurrency map[string]int
 }
 
 // Factory creates new worker pools
@@ -0,0 +1,112 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	skerrors "github.com/butter-bot-machines/skylark/pkg/errors"
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+)
+
+// Kinds of job errors counted in Stats.Errors. Provider errors are counted
+// by their code, such as provider.ErrRateLimit.
+const (
+	ErrorPanic    = "panic"
+	ErrorTimeout  = "timeout"
+	ErrorCanceled = "canceled"
+	ErrorOther    = "other"
+)
+
+// ErrPanic is wrapped by the errors of jobs that panicked
+var ErrPanic = errors.New("job panicked")
+
+// ErrorKind classifies the error a job failed with
+func ErrorKind(err error) string {
+	var perr *provider.Error
+	switch {
+	case errors.Is(err, ErrPanic):
+		return ErrorPanic
+	case errors.As(err, &perr) && perr.Code != "":
+		return perr.Code
+	case errors.Is(err, context.DeadlineExceeded) || skerrors.IsTimeout(err):
+		return ErrorTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrorCanceled
+	}
+	return ErrorOther
+}
+
+// LatencyBounds are the upper bounds of the buckets of Stats.Latency
+var LatencyBounds = []time.Duration{
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+	time.Minute,
+	5 * time.Minute,
+}
+
+// Histogram counts durations by bucket. Durations longer than the last
+// bound fall in a final, unbounded bucket.
+type Histogram struct {
+	Bounds []time.Duration `json:"bounds"` // Upper bound of each bucket, ascending
+	Counts []uint64        `json:"counts"` // Durations in each bucket, one more than Bounds
+}
+
+// NewHistogram creates an empty histogram with the given bucket bounds
+func NewHistogram(bounds []time.Duration) Histogram {
+	return Histogram{
+		Bounds: append([]time.Duration(nil), bounds...),
+		Counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+// Observe counts d in its bucket
+func (h *Histogram) Observe(d time.Duration) {
+	i := sort.Search(len(h.Bounds), func(i int) bool { return d <= h.Bounds[i] })
+	h.Counts[i]++
+}
+
+// Total returns the number of durations counted
+func (h Histogram) Total() uint64 {
+	var n uint64
+	for _, c := range h.Counts {
+		n += c
+	}
+	return n
+}
+
+// Quantile returns the upper bound of the bucket holding the q quantile,
+// for q between 0 and 1. Durations in the unbounded bucket are reported as
+// the last bound; an empty histogram returns 0.
+func (h Histogram) Quantile(q float64) time.Duration {
+	total := h.Total()
+	if total == 0 || len(h.Bounds) == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(total)))
+	if rank == 0 {
+		rank = 1
+	}
+	var n uint64
+	for i, c := range h.Counts {
+		n += c
+		if n >= rank && i < len(h.Bounds) {
+			return h.Bounds[i]
+		}
+	}
+	return h.Bounds[len(h.Bounds)-1]
+}
+
+// Clone returns a copy of the histogram sharing no memory with it
+func (h Histogram) Clone() Histogram {
+	return Histogram{
+		Bounds: append([]time.Duration(nil), h.Bounds...),
+		Counts: append([]uint64(nil), h.Counts...),
+	}
+}
@@ -0,0 +1,69 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/butter-bot-machines/skylark/pkg/provider"
+)
+
+func TestErrorKind(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"panic", fmt.Errorf("%w: boom", ErrPanic), ErrorPanic},
+		{"provider", fmt.Errorf("failed: %w", &provider.Error{Code: provider.ErrRateLimit}), provider.ErrRateLimit},
+		{"deadline", fmt.Errorf("failed: %w", context.DeadlineExceeded), ErrorTimeout},
+		{"canceled", context.Canceled, ErrorCanceled},
+		{"other", errors.New("broken"), ErrorOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ErrorKind(tt.err); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram([]time.Duration{time.Second, 5 * time.Second})
+	if got := h.Quantile(0.5); got != 0 {
+		t.Errorf("Expected 0 for an empty histogram, got %v", got)
+	}
+	for _, d := range []time.Duration{500 * time.Millisecond, time.Second, 3 * time.Second, time.Minute} {
+		h.Observe(d)
+	}
+	if want := []uint64{2, 1, 1}; fmt.Sprint(h.Counts) != fmt.Sprint(want) {
+		t.Errorf("Expected counts %v, got %v", want, h.Counts)
+	}
+	if h.Total() != 4 {
+		t.Errorf("Expected 4 durations, got %d", h.Total())
+	}
+
+	tests := []struct {
+		q    float64
+		want time.Duration
+	}{
+		{0, time.Second},
+		{0.5, time.Second},
+		{0.75, 5 * time.Second},
+		{1, 5 * time.Second}, // The unbounded bucket reports the last bound
+	}
+	for _, tt := range tests {
+		if got := h.Quantile(tt.q); got != tt.want {
+			t.Errorf("Quantile(%v): expected %v, got %v", tt.q, tt.want, got)
+		}
+	}
+
+	clone := h.Clone()
+	clone.Observe(0)
+	if h.Total() != 4 {
+		t.Error("Expected a clone not to share counts")
+	}
+}
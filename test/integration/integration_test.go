@@ -1,6 +1,7 @@
 package integration
 
 import (
+	"context"
 	"io"
 	"os"
 	"path/filepath"
@@ -107,8 +108,8 @@ func TestWorkerPool(t *testing.T) {
 
 	// Verify job was processed
 	stats := pool.Stats()
-	if stats.ProcessedJobs() != 1 {
-		t.Errorf("Expected 1 processed job, got %d", stats.ProcessedJobs())
+	if stats.ProcessedJobs != 1 {
+		t.Errorf("Expected 1 processed job, got %d", stats.ProcessedJobs)
 	}
 }
 
@@ -119,7 +120,7 @@ type testJob struct {
 	maxRetries int
 }
 
-func (j *testJob) Process() error {
+func (j *testJob) Process(ctx context.Context) error {
 	if j.onProcess != nil {
 		return j.onProcess()
 	}
@@ -210,7 +211,7 @@ func TestWatcherWorkerIntegration(t *testing.T) {
 			t.Fatal("Timeout waiting for file to be processed")
 		case <-ticker.C:
 			stats := pool.Stats()
-			if stats.ProcessedJobs() > 0 {
+			if stats.ProcessedJobs > 0 {
 				return // Test passed
 			}
 		}
@@ -287,7 +288,7 @@ type commandJob struct {
 	assistant *testAssistant
 }
 
-func (j *commandJob) Process() error {
+func (j *commandJob) Process(ctx context.Context) error {
 	// Strip the command prefix and pass to assistant
 	cmd := j.command[6:] // Remove "!test " including the space
 	return j.assistant.ProcessCommand(cmd)
@@ -1,6 +1,7 @@
 package performance
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -317,7 +318,7 @@ type benchmarkJob struct {
 	onComplete func()
 }
 
-func (j *benchmarkJob) Process() error {
+func (j *benchmarkJob) Process(ctx context.Context) error {
 	// Simulate some work
 	time.Sleep(100 * time.Microsecond)
 	j.onComplete()
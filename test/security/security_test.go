@@ -457,7 +457,7 @@ type accessJob struct {
 	onComplete func(error)
 }
 
-func (j *accessJob) Process() error {
+func (j *accessJob) Process(ctx context.Context) error {
 	// Validate path is within allowed directory
 	cleanPath := filepath.Clean(j.path)
 	if !strings.HasPrefix(cleanPath, j.allowedDir) {
@@ -485,7 +485,7 @@ type memoryHogJob struct {
 	onComplete func(bool)
 }
 
-func (j *memoryHogJob) Process() error {
+func (j *memoryHogJob) Process(ctx context.Context) error {
 	// Check memory limit before allocation
 	if err := j.proc.enforceMemoryLimit(j.size); err != nil {
 		j.onComplete(true)
@@ -525,7 +525,7 @@ type cpuHogJob struct {
 	onComplete func(bool)
 }
 
-func (j *cpuHogJob) Process() error {
+func (j *cpuHogJob) Process(ctx context.Context) error {
 	start := time.Now()
 	defer func() {
 		if r := recover(); r != nil {
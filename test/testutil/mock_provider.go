@@ -19,7 +19,7 @@ func NewMockProvider() *MockProvider {
 }
 
 // Send implements the provider.Provider interface
-func (p *MockProvider) Send(ctx context.Context, prompt string) (*provider.Response, error) {
+func (p *MockProvider) Send(ctx context.Context, messages []provider.Message, opts *provider.RequestOptions) (*provider.Response, error) {
 	return &provider.Response{
 		Content: p.response,
 		Usage: provider.Usage{